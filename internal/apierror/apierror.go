@@ -0,0 +1,179 @@
+// Package apierror gives every API error response the same shape, so clients
+// can branch on a stable code and show a translated message.
+package apierror
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// CorrelationHeader carries the ID tying a response to the server's logs. An
+// incoming X-Correlation-ID or X-Request-ID is reused when present.
+const CorrelationHeader = "X-Correlation-ID"
+
+const correlationKey = "correlation_id"
+
+const rawKey = "apierror_raw"
+
+// Response is the body of every API error
+type Response struct {
+	// Error is a human-readable message, kept for existing clients
+	Error string `json:"error"`
+	// Code is the stable, machine-readable reason for the error
+	Code string `json:"code"`
+	// ErrorType repeats Code for clients written before Code existed
+	ErrorType     string                 `json:"error_type"`
+	I18nKey       string                 `json:"i18n_key"`
+	CorrelationID string                 `json:"correlation_id"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+}
+
+// CorrelationID returns the correlation ID of the current request
+func CorrelationID(c *gin.Context) string {
+	if id := c.GetString(correlationKey); id != "" {
+		return id
+	}
+	id := incomingCorrelationID(c)
+	c.Set(correlationKey, id)
+	return id
+}
+
+func incomingCorrelationID(c *gin.Context) string {
+	for _, h := range []string{CorrelationHeader, "X-Request-ID"} {
+		id := strings.TrimSpace(c.GetHeader(h))
+		if id != "" && len(id) <= 128 && !strings.ContainsAny(id, " \t\r\n") {
+			return id
+		}
+	}
+	return uuid.NewString()
+}
+
+// New builds the error envelope for the current request. An empty code is
+// derived from status, and an empty message from the status text.
+func New(c *gin.Context, status int, code, message string, details map[string]interface{}) Response {
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return Response{
+		Error:         message,
+		Code:          code,
+		ErrorType:     code,
+		I18nKey:       I18nKey(status, code, message),
+		CorrelationID: CorrelationID(c),
+		Details:       details,
+	}
+}
+
+// Respond writes an error response with the given code and optional details
+func Respond(c *gin.Context, status int, code, message string, details ...gin.H) {
+	var d map[string]interface{}
+	if len(details) > 0 {
+		d = details[0]
+	}
+	c.JSON(status, New(c, status, code, message, d))
+}
+
+// Abort writes an error response like Respond and stops the handler chain
+func Abort(c *gin.Context, status int, code, message string, details ...gin.H) {
+	c.Abort()
+	Respond(c, status, code, message, details...)
+}
+
+// Raw leaves a route's error bodies as the handler wrote them, for endpoints
+// such as health probes whose documented shape monitors read
+func Raw() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(rawKey, true)
+		c.Next()
+	}
+}
+
+// Middleware assigns each request a correlation ID and rewrites JSON error
+// bodies that handlers wrote as gin.H{"error": ...} or gin.H{"error_type": ...}
+// into the standard envelope. Any other fields move into details.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := CorrelationID(c)
+		c.Header(CorrelationHeader, id)
+
+		w := &envelopeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if w.buf.Len() == 0 {
+			return
+		}
+		status := w.Status()
+		body := w.buf.Bytes()
+		if !c.GetBool(rawKey) {
+			body = normalize(c, status, body)
+		}
+		if status >= http.StatusInternalServerError {
+			logging.Logf("[API] %s %s returned %d (correlation %s)", c.Request.Method, c.Request.URL.Path, status, id)
+		}
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// envelopeWriter holds back JSON error bodies until the handler finishes so
+// Middleware can rewrite them
+type envelopeWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *envelopeWriter) buffering() bool {
+	return w.Status() >= http.StatusBadRequest &&
+		!w.ResponseWriter.Written() &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if w.buffering() {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	if w.buffering() {
+		return w.buf.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// normalize converts a legacy error body to the envelope, leaving bodies that
+// already are one, or aren't JSON objects, unchanged
+func normalize(c *gin.Context, status int, body []byte) []byte {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	if _, ok := fields["correlation_id"]; ok {
+		return body
+	}
+
+	message, _ := fields["error"].(string)
+	code, _ := fields["error_type"].(string)
+	delete(fields, "error")
+	delete(fields, "error_type")
+	delete(fields, "success")
+	if len(fields) == 0 {
+		fields = nil
+	}
+
+	out, err := json.Marshal(New(c, status, code, message, fields))
+	if err != nil {
+		return body
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serve(t *testing.T, handler gin.HandlerFunc, header map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/", handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	if w.Code >= 400 {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("error body is not JSON: %v (%s)", err, w.Body.String())
+		}
+	}
+	return w, body
+}
+
+func TestMiddlewareNormalizesLegacyErrors(t *testing.T) {
+	w, body := serve(t, func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	}, map[string]string{"X-Request-ID": "req-123"})
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	want := map[string]interface{}{
+		"error":          "User not found",
+		"code":           CodeNotFound,
+		"error_type":     CodeNotFound,
+		"i18n_key":       "backend.errors.not_found",
+		"correlation_id": "req-123",
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %v, want %v", k, body[k], v)
+		}
+	}
+	if got := w.Header().Get(CorrelationHeader); got != "req-123" {
+		t.Errorf("%s header = %q, want req-123", CorrelationHeader, got)
+	}
+}
+
+func TestMiddlewareKeepsErrorTypeAndDetails(t *testing.T) {
+	_, body := serve(t, func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_upload_id", "upload_id": "x"})
+	}, nil)
+
+	if body["code"] != "invalid_upload_id" || body["i18n_key"] != "admin.errors.invalid_upload_id" {
+		t.Errorf("code = %v, i18n_key = %v", body["code"], body["i18n_key"])
+	}
+	if body["error"] != http.StatusText(http.StatusBadRequest) {
+		t.Errorf("error = %v, want status text", body["error"])
+	}
+	details, _ := body["details"].(map[string]interface{})
+	if details["upload_id"] != "x" {
+		t.Errorf("details = %v, want upload_id", body["details"])
+	}
+	if id, _ := body["correlation_id"].(string); id == "" {
+		t.Error("correlation_id is empty")
+	}
+}
+
+func TestMiddlewareUsesTranslationKeyMessages(t *testing.T) {
+	_, body := serve(t, func(c *gin.Context) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "backend.auth.invalid_credentials"})
+	}, nil)
+
+	if body["i18n_key"] != "backend.auth.invalid_credentials" {
+		t.Errorf("i18n_key = %v", body["i18n_key"])
+	}
+}
+
+func TestMiddlewareLeavesSuccessAndEnvelopesAlone(t *testing.T) {
+	w, _ := serve(t, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"error": "not an error response"})
+	}, nil)
+	if w.Body.String() != `{"error":"not an error response"}` {
+		t.Errorf("success body rewritten: %s", w.Body.String())
+	}
+
+	_, body := serve(t, func(c *gin.Context) {
+		Respond(c, http.StatusServiceUnavailable, "maintenance_mode", "down", gin.H{"reason": "admin"})
+	}, nil)
+	details, _ := body["details"].(map[string]interface{})
+	if body["code"] != "maintenance_mode" || details["reason"] != "admin" {
+		t.Errorf("Respond body = %v", body)
+	}
+}
+
+func TestRawLeavesErrorBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/", Raw(), func(c *gin.Context) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready"})
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != `{"status":"not_ready"}` {
+		t.Errorf("raw route = %d %s, want the handler's body", w.Code, w.Body)
+	}
+	if w.Header().Get(CorrelationHeader) == "" {
+		t.Error("raw route has no correlation header")
+	}
+}
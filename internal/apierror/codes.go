@@ -0,0 +1,96 @@
+package apierror
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Codes for errors that only carry an HTTP status. Handlers with a more
+// specific reason use their own code, e.g. maintenance_mode.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeInternalError      = "internal_error"
+	CodeBadGateway         = "bad_gateway"
+	CodeServiceUnavailable = "service_unavailable"
+)
+
+// backendCodes have a translation under backend.errors
+var backendCodes = map[string]bool{
+	CodeBadRequest: true, CodeUnauthorized: true, CodeForbidden: true, CodeNotFound: true,
+	CodeConflict: true, CodePayloadTooLarge: true, CodeTooManyRequests: true,
+	CodeInternalError: true, CodeBadGateway: true, CodeServiceUnavailable: true,
+	"missing_url": true, "parse_form": true, "get_file": true, "open_file": true,
+	"create_dir": true, "create_file": true, "save_file": true, "no_form": true,
+	"no_file_field": true, "file_too_large": true, "maintenance_mode": true,
+	"memory_constrained": true, "upload_stream_failed": true, "on_behalf_forbidden": true,
+	"target_user_not_found": true, "server_busy": true, "too_many_jobs": true,
+	"backend_unsupported": true, "content_type_blocked": true,
+}
+
+// adminCodes have a translation under admin.errors, used by the backup and
+// restore handlers
+var adminCodes = map[string]bool{
+	"backup_create": true, "backup_invalid": true, "backup_analyze": true, "backup_file_type": true,
+	"restore_failed": true, "restore_error": true, "restore_cancel_failed": true,
+	"restore_delete_failed": true, "restore_import_failed": true, "restore_delete_record_failed": true,
+	"backup_download": true, "no_backup_file": true, "backup_not_found": true, "backup_not_ready": true,
+	"backup_file_unavailable": true, "parse_form_failed": true, "create_temp_file_failed": true,
+	"save_uploaded_file_failed": true, "backup_analyze_failed": true, "get_file_info_failed": true,
+	"save_upload_record_failed": true, "invalid_request": true, "invalid_upload_id": true,
+	"upload_not_found": true, "create_backup_job_failed": true, "get_backup_jobs_failed": true,
+	"invalid_job_id": true, "backup_job_not_found": true, "delete_backup_job_failed": true,
+	"max_api_keys_invalid": true,
+}
+
+// CodeForStatus returns the generic code for an HTTP status
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	case http.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	}
+	if status >= 500 {
+		return CodeInternalError
+	}
+	return CodeBadRequest
+}
+
+// isTranslationKey reports whether message is already a locale key, as some
+// handlers return keys like backend.auth.account_disabled as the error
+func isTranslationKey(message string) bool {
+	return strings.HasPrefix(message, "backend.") && !strings.ContainsAny(message, " \t\n")
+}
+
+// I18nKey returns the locale key clients should show for an error, falling
+// back to the generic key for status when code has no translation
+func I18nKey(status int, code, message string) string {
+	if isTranslationKey(message) {
+		return message
+	}
+	if backendCodes[code] {
+		return "backend.errors." + code
+	}
+	if adminCodes[code] {
+		return "admin.errors." + code
+	}
+	return "backend.errors." + CodeForStatus(status)
+}
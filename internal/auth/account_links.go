@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	oidcLinkCookie   = "oidc_link"
+	oidcLinkAudience = "aviary-oidc-link"
+)
+
+// SetLocalPasswordRequest represents a request to add a password to an account without one
+type SetLocalPasswordRequest struct {
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// GetAccountLinksHandler reports which sign-in methods are attached to the current user
+func GetAccountLinksHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	c.JSON(http.StatusOK, gin.H{
+		"has_local_password": userService.HasLocalPassword(user),
+		"oidc_linked":        user.OidcSubject != nil,
+		"oidc_enabled":       IsOIDCEnabled(),
+	})
+}
+
+// SetLocalPasswordHandler lets a user whose account was created through OIDC
+// set a password, so they can still sign in when the identity provider is down
+func SetLocalPasswordHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var req SetLocalPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	if userService.HasLocalPassword(user) {
+		c.JSON(http.StatusConflict, gin.H{"error_type": "local_password_exists"})
+		return
+	}
+
+	if err := userService.UpdateUserPassword(user.ID, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+
+	logging.Logf("[AUTH] User %s set a local password", user.Username)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// OIDCLinkHandler starts an OIDC login whose callback attaches the returned
+// subject to the current account instead of signing in. It is a POST that
+// returns the provider URL for the frontend to open, so another site can't
+// start a link for a signed-in user by sending them to a URL.
+func OIDCLinkHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	if !oidcEnabled {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "OIDC not configured"})
+		return
+	}
+
+	// The auth cookie is not sent on the cross-site redirect back from the
+	// provider, so carry the user in a short-lived signed cookie instead
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID.String(),
+		"exp":     time.Now().Add(10 * time.Minute).Unix(),
+		"iat":     time.Now().Unix(),
+		"iss":     "aviary",
+		"aud":     oidcLinkAudience,
+	})
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start account linking"})
+		return
+	}
+
+	secure := !allowInsecure()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLinkCookie, tokenString, 600, "/", "", secure, true)
+
+	if authURL, ok := startOIDCLogin(c); ok {
+		c.JSON(http.StatusOK, gin.H{"redirect_url": authURL})
+	}
+}
+
+// UnlinkOIDCHandler detaches the OIDC subject from the current account
+func UnlinkOIDCHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	if user.OidcSubject == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "oidc_not_linked"})
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	if !userService.HasLocalPassword(user) {
+		// Unlinking would leave the account with no way to sign in
+		c.JSON(http.StatusConflict, gin.H{"error_type": "local_password_required"})
+		return
+	}
+
+	if err := userService.UnlinkOIDCSubject(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink OIDC account"})
+		return
+	}
+
+	logging.Logf("[AUTH] User %s unlinked their OIDC account", user.Username)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// pendingOIDCLink returns the user ID from a valid link cookie, clearing the cookie
+func pendingOIDCLink(c *gin.Context) (uuid.UUID, bool) {
+	tokenString, err := c.Cookie(oidcLinkCookie)
+	if err != nil || tokenString == "" {
+		return uuid.Nil, false
+	}
+
+	secure := !allowInsecure()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLinkCookie, "", -1, "/", "", secure, true)
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwtSecret, nil
+	}, jwt.WithAudience(oidcLinkAudience), jwt.WithIssuer("aviary"))
+	if err != nil || !token.Valid {
+		return uuid.Nil, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userIDStr, _ := claims["user_id"].(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// completeOIDCLink attaches subject to the user that started the link flow
+// and redirects back to the frontend with the outcome
+func completeOIDCLink(c *gin.Context, userID uuid.UUID, subject string) {
+	redirectURL := config.Get("OIDC_SUCCESS_REDIRECT_URL", "")
+	if redirectURL == "" {
+		redirectURL = "/"
+	}
+
+	userService := database.NewUserService(database.DB)
+	result := "success"
+	if err := userService.LinkOIDCSubject(userID, subject); err != nil {
+		logging.Logf("[AUTH] Failed to link OIDC subject to user %s: %v", userID, err)
+		result = "failed"
+		if errors.Is(err, database.ErrOIDCSubjectInUse) {
+			result = "subject_in_use"
+		}
+	} else {
+		logging.Logf("[AUTH] Linked OIDC account to user %s", userID)
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s%soidc_link=%s", redirectURL, querySeparator(redirectURL), url.QueryEscape(result)))
+}
+
+// querySeparator returns the character needed to append a query parameter to rawURL
+func querySeparator(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.RawQuery != "" {
+		return "&"
+	}
+	return "?"
+}
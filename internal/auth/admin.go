@@ -2,26 +2,48 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/rmitchellscott/aviary/internal/backup"
+	"github.com/rmitchellscott/aviary/internal/compressor"
 	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/contentpolicy"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/degraded"
 	"github.com/rmitchellscott/aviary/internal/export"
+	"github.com/rmitchellscott/aviary/internal/health"
 	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
 	"github.com/rmitchellscott/aviary/internal/restore"
 	"github.com/rmitchellscott/aviary/internal/smtp"
-	"github.com/rmitchellscott/aviary/internal/storage"
+	"github.com/rmitchellscott/aviary/internal/version"
 )
 
+// restoreJobDrainTimeout is how long a restore waits for running jobs to finish
+const restoreJobDrainTimeout = 2 * time.Minute
+
+// PostRestoreCallback is called after a successful restore with the restored
+// user IDs (empty when every user was restored)
+type PostRestoreCallback func(userIDs []uuid.UUID)
+
+// Global callback for post-restore actions
+var postRestoreCallback PostRestoreCallback
+
+// SetPostRestoreCallback sets the callback to be called after a successful restore
+func SetPostRestoreCallback(callback PostRestoreCallback) {
+	postRestoreCallback = callback
+}
+
 // TestSMTPHandler tests SMTP configuration (admin only)
 func TestSMTPHandler(c *gin.Context) {
 	if !database.IsMultiUserMode() {
@@ -80,6 +102,11 @@ func GetSystemStatusHandler(c *gin.Context) {
 	// Get system settings
 	registrationEnabled, _ := database.GetSystemSetting("registration_enabled")
 	maxAPIKeys, _ := database.GetSystemSetting("max_api_keys_per_user")
+	maxUploadMB, _ := database.GetSystemSetting("max_upload_mb")
+	blockedContentTypes, _ := database.GetSystemSetting(contentpolicy.SettingKey)
+	publicStatusFields, _ := database.GetSystemSetting(health.PublicFieldsSettingKey)
+	maintenanceMode, _ := database.GetSystemSetting(maintenance.SettingKey)
+	maintenanceEnabled, maintenanceReason := maintenance.Status()
 
 	// Check if we're in dry run mode
 	dryRunMode := config.Get("DRY_RUN", "") != ""
@@ -97,13 +124,28 @@ func GetSystemStatusHandler(c *gin.Context) {
 		"settings": gin.H{
 			"registration_enabled":  registrationEnabled,
 			"max_api_keys_per_user": maxAPIKeys,
+			"max_upload_mb":         maxUploadMB,
+			"blocked_content_types": blockedContentTypes,
+			"maintenance_mode":      maintenanceMode,
+			"public_status_fields":  publicStatusFields,
+		},
+		"maintenance": gin.H{
+			"enabled":     maintenanceEnabled,
+			"reason":      maintenanceReason,
+			"active_jobs": maintenance.ActiveJobs(),
 		},
+		"degraded": degraded.GetStatus(),
+		"update":   version.UpdateCheck(),
 		"auth": gin.H{
 			"oidc_enabled":       oidcEnabled,
 			"proxy_auth_enabled": proxyAuthEnabled,
 		},
 		"mode":    "multi_user",
 		"dry_run": dryRunMode,
+		"low_resource": gin.H{
+			"enabled":          config.LowResource(),
+			"compress_workers": compressor.Workers(),
+		},
 	})
 }
 
@@ -131,9 +173,15 @@ func UpdateSystemSettingHandler(c *gin.Context) {
 
 	// Validate allowed settings
 	allowedSettings := map[string]bool{
-		"registration_enabled":         true,
-		"max_api_keys_per_user":        true,
-		"password_reset_timeout_hours": true,
+		"registration_enabled":           true,
+		"max_api_keys_per_user":          true,
+		"max_upload_mb":                  true,
+		contentpolicy.SettingKey:         true,
+		"password_reset_timeout_hours":   true,
+		"backup_retention_days":          true,
+		"restore_upload_retention_hours": true,
+		maintenance.SettingKey:           true,
+		health.PublicFieldsSettingKey:    true,
 	}
 
 	if !allowedSettings[req.Key] {
@@ -141,6 +189,38 @@ func UpdateSystemSettingHandler(c *gin.Context) {
 		return
 	}
 
+	// Retention windows and the upload limit must be whole, non-negative numbers
+	switch req.Key {
+	case backup.RetentionSettingKey, restore.UploadRetentionSettingKey:
+		if n, err := strconv.Atoi(req.Value); err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_retention_value"})
+			return
+		}
+	case "max_upload_mb":
+		if n, err := strconv.Atoi(req.Value); err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+			return
+		}
+	case health.PublicFieldsSettingKey:
+		if _, ok := health.ParsePublicFields(req.Value); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+			return
+		}
+	case contentpolicy.SettingKey:
+		if _, ok := contentpolicy.Parse(req.Value); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+			return
+		}
+	}
+
+	if req.Key == maintenance.SettingKey {
+		if req.Value != "true" && req.Value != "false" {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+			return
+		}
+		logging.LogfWithUser(user.Username, "[MAINTENANCE] Maintenance mode set to %s", req.Value)
+	}
+
 	// Update the setting
 	if err := database.SetSystemSetting(req.Key, req.Value, &user.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
@@ -175,6 +255,9 @@ func GetSystemSettingsHandler(c *gin.Context) {
 	// Convert to map for easier frontend consumption
 	settingsMap := make(map[string]interface{})
 	for _, setting := range settings {
+		if secretSettingKeys[setting.Key] && setting.Value != "" {
+			setting.Value = "********"
+		}
 		settingsMap[setting.Key] = gin.H{
 			"value":       setting.Value,
 			"description": setting.Description,
@@ -210,9 +293,22 @@ func CleanupDataHandler(c *gin.Context) {
 		logging.Logf("[WARNING] Failed to cleanup orphaned restore uploads: %v", err)
 	}
 
+	backups, err := backup.CleanupExpiredBackups(database.DB)
+	if err != nil {
+		logging.Logf("[WARNING] Failed to cleanup expired backups: %v", err)
+	}
+
+	uploads, err := restore.CleanupExpiredUploads(database.DB)
+	if err != nil {
+		logging.Logf("[WARNING] Failed to cleanup expired restore uploads: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Data cleanup completed successfully",
+		"success":         true,
+		"message":         "Data cleanup completed successfully",
+		"backups":         backups,
+		"restore_uploads": uploads,
+		"reclaimed_bytes": backups.ReclaimedBytes + uploads.ReclaimedBytes,
 	})
 }
 
@@ -419,6 +515,17 @@ func UploadRestoreFileHandler(c *gin.Context) {
 		return
 	}
 
+	// Uploads expire after the configured retention unless overridden per upload
+	retention := restore.GetUploadRetention()
+	if hoursStr := c.Request.FormValue("retention_hours"); hoursStr != "" {
+		hours, err := strconv.Atoi(hoursStr)
+		if err != nil || hours <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_retention_value"})
+			return
+		}
+		retention = time.Duration(hours) * time.Hour
+	}
+
 	// Create database record
 	uploadID := uuid.New()
 	tempDir := os.TempDir()
@@ -452,7 +559,7 @@ func UploadRestoreFileHandler(c *gin.Context) {
 		FilePath:    tempFilePath,
 		FileSize:    fileInfo.Size(),
 		Status:      "uploaded",
-		ExpiresAt:   time.Now().Add(24 * time.Hour), // Expire after 24 hours
+		ExpiresAt:   time.Now().Add(retention),
 	}
 
 	if err := database.DB.Create(&restoreUpload).Error; err != nil {
@@ -524,6 +631,13 @@ func RestoreDatabaseHandler(c *gin.Context) {
 		}
 	}
 
+	// Reject new jobs while importing, giving running jobs a chance to finish first
+	endMaintenance := maintenance.BeginRestore()
+	defer endMaintenance()
+	if !maintenance.WaitForJobs(restoreJobDrainTimeout) {
+		logging.Logf("[RESTORE] %d job(s) still running after %s, restoring anyway", maintenance.ActiveJobs(), restoreJobDrainTimeout)
+	}
+
 	dataDir := config.Get("DATA_DIR", "")
 	if dataDir == "" {
 		dataDir = "/data"
@@ -563,8 +677,10 @@ func RestoreDatabaseHandler(c *gin.Context) {
 		}
 	}
 	if err != nil {
+		logging.Logf("[RESTORE] Restore failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error_type": "restore_import_failed",
+			"tables":     importer.TableResults(),
 		})
 		return
 	}
@@ -582,6 +698,10 @@ func RestoreDatabaseHandler(c *gin.Context) {
 		// Don't fail the restore - migrations can be run manually if needed
 	}
 
+	if postRestoreCallback != nil {
+		postRestoreCallback(userIDs)
+	}
+
 	// Clean up any associated extraction job before deleting the upload
 	if extractionJob, err := restore.GetExtractionJobByUpload(database.DB, uploadID, user.ID); err == nil {
 		if cleanupErr := restore.CleanupExtractionJob(database.DB, extractionJob.ID, user.ID); cleanupErr != nil {
@@ -605,6 +725,7 @@ func RestoreDatabaseHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"tables":  importer.TableResults(),
 	})
 }
 
@@ -774,6 +895,34 @@ func CreateBackupJobHandler(c *gin.Context) {
 	includeConfigs := c.DefaultQuery("include_configs", "true") == "true"
 	userIDsParam := c.Query("user_ids")
 
+	// Optional per-job retention override in days (0 keeps the backup until deleted)
+	var retentionDays *int
+	if daysStr := c.Query("retention_days"); daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_retention_value"})
+			return
+		}
+		retentionDays = &days
+	}
+
+	// Database format: "json" (default) or "sql" for a pg_dump on PostgreSQL
+	databaseFormat := c.DefaultQuery("database_format", export.DatabaseFormatJSON)
+	if !export.IsValidDatabaseFormat(databaseFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_database_format"})
+		return
+	}
+	if databaseFormat == export.DatabaseFormatSQL && database.GetDatabaseConfig().Type != "postgres" {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "sql_format_requires_postgres"})
+		return
+	}
+	if databaseFormat == export.DatabaseFormatSQL {
+		if err := export.CheckPostgresClient("pg_dump"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "pg_dump_not_found", "error": err.Error()})
+			return
+		}
+	}
+
 	// Parse user IDs if specified
 	var userIDs []uuid.UUID
 	if userIDsParam != "" {
@@ -784,8 +933,24 @@ func CreateBackupJobHandler(c *gin.Context) {
 		}
 	}
 
+	// Optionally leave some archived documents out, keeping their records
+	var exclude backup.FileExclusions
+	for _, idStr := range strings.Split(c.Query("exclude_file_user_ids"), ",") {
+		if id, err := uuid.Parse(strings.TrimSpace(idStr)); err == nil {
+			exclude.UserIDs = append(exclude.UserIDs, id)
+		}
+	}
+	if daysStr := c.Query("files_max_age_days"); daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_files_max_age"})
+			return
+		}
+		exclude.MaxAgeDays = days
+	}
+
 	// Create backup job
-	job, err := backup.CreateBackupJob(database.DB, user.ID, includeFiles, includeConfigs, userIDs)
+	job, err := backup.CreateBackupJob(database.DB, user.ID, includeFiles, includeConfigs, userIDs, retentionDays, databaseFormat, exclude)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error_type": "create_backup_job_failed",
@@ -803,7 +968,94 @@ func CreateBackupJobHandler(c *gin.Context) {
 	})
 }
 
-// GetBackupJobsHandler returns backup jobs for the admin user
+// GetBackupScheduleHandler returns the recurring backup schedule, when it
+// next runs and the last scheduled backup (admin only)
+func GetBackupScheduleHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Background backup not available in single-user mode"})
+		return
+	}
+
+	if _, ok := RequireAdmin(c); !ok {
+		return
+	}
+
+	schedule := backup.GetSchedule()
+	lastJob, err := backup.LastScheduledBackup(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get backup schedule"})
+		return
+	}
+
+	response := gin.H{
+		"schedule": schedule,
+		"last_job": lastJob,
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		response["next_run"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateBackupScheduleHandler replaces the recurring backup schedule (admin only)
+func UpdateBackupScheduleHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Background backup not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	schedule := backup.GetSchedule()
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+		return
+	}
+	if schedule.DatabaseFormat == "" {
+		schedule.DatabaseFormat = export.DatabaseFormatJSON
+	}
+	if schedule.DatabaseFormat == export.DatabaseFormatSQL && database.GetDatabaseConfig().Type != "postgres" {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "sql_format_requires_postgres"})
+		return
+	}
+	if schedule.DatabaseFormat == export.DatabaseFormatSQL {
+		if err := export.CheckPostgresClient("pg_dump"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "pg_dump_not_found", "error": err.Error()})
+			return
+		}
+	}
+	if err := schedule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_backup_schedule", "error": err.Error()})
+		return
+	}
+
+	if err := backup.SaveSchedule(schedule, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save backup schedule"})
+		return
+	}
+	logging.LogfWithUser(user.Username, "[BACKUP] Backup schedule set to %q (enabled: %t, keep: %d)", schedule.Cron, schedule.Enabled, schedule.Keep)
+
+	schedule = backup.GetSchedule()
+	response := gin.H{"success": true, "schedule": schedule}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		response["next_run"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// backupJobSortColumns are the columns the backup job listing can sort by
+var backupJobSortColumns = map[string]string{
+	"created_at":   "created_at",
+	"completed_at": "completed_at",
+	"file_size":    "file_size",
+	"status":       "status",
+}
+
+// GetBackupJobsHandler returns a page of the admin user's backup jobs, optionally
+// filtered by status or database format
 func GetBackupJobsHandler(c *gin.Context) {
 	if !database.IsMultiUserMode() {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Background backup not available in single-user mode"})
@@ -815,7 +1067,19 @@ func GetBackupJobsHandler(c *gin.Context) {
 		return
 	}
 
-	jobs, err := backup.GetBackupJobs(database.DB, user.ID)
+	params, err := parseListParams(c, 10, backupJobSortColumns, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "invalid_request"})
+		return
+	}
+
+	jobs, total, err := backup.ListBackupJobs(database.DB, user.ID, backup.BackupJobQuery{
+		Status:         strings.ToLower(c.Query("status")),
+		DatabaseFormat: strings.ToLower(c.Query("database_format")),
+		Order:          params.Order(),
+		Offset:         params.Offset(),
+		Limit:          params.Limit,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error_type": "get_backup_jobs_failed",
@@ -823,9 +1087,7 @@ func GetBackupJobsHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"jobs": jobs,
-	})
+	c.JSON(http.StatusOK, params.Response(total, gin.H{"jobs": jobs}))
 }
 
 // GetBackupJobHandler returns a specific backup job
@@ -886,30 +1148,27 @@ func DownloadBackupHandler(c *gin.Context) {
 		return
 	}
 
-	if job.FilePath == "" || job.Filename == "" {
+	if (job.FilePath == "" && job.RemoteKey == "") || job.Filename == "" {
 		c.JSON(http.StatusInternalServerError, gin.H{"error_type": "backup_file_unavailable"})
 		return
 	}
 
-	ctx := context.Background()
-	backend := storage.GetStorageBackend()
-	exists, err := backend.Exists(ctx, job.FilePath)
-	if err != nil || !exists {
+	// Streams from the backup bucket when the local copy is gone
+	reader, err := backup.OpenBackup(context.Background(), job)
+	if errors.Is(err, os.ErrNotExist) {
 		c.JSON(http.StatusNotFound, gin.H{"error_type": "backup_not_found"})
 		return
 	}
-
-	// Set headers for download
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", job.Filename))
-	c.Header("Content-Type", "application/gzip")
-	c.Header("Content-Description", "Aviary Backup")
-
-	reader, err := backend.Get(ctx, job.FilePath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve backup file"})
 		return
 	}
 	defer reader.Close()
+
+	// Set headers for download
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", job.Filename))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Description", "Aviary Backup")
 	
 	if _, err := io.Copy(c.Writer, reader); err != nil {
 		logging.Logf("[ERROR] Failed to stream backup file: %v", err)
@@ -3,6 +3,7 @@ package auth
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,13 +19,15 @@ type CreateAPIKeyRequest struct {
 
 // APIKeyResponse represents an API key in responses
 type APIKeyResponse struct {
-	ID        uuid.UUID  `json:"id"`
-	Name      string     `json:"name"`
-	KeyPrefix string     `json:"key_prefix"`
-	IsActive  bool       `json:"is_active"`
-	LastUsed  *time.Time `json:"last_used,omitempty"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID               uuid.UUID  `json:"id"`
+	Name             string     `json:"name"`
+	KeyPrefix        string     `json:"key_prefix"`
+	IsActive         bool       `json:"is_active"`
+	LastUsed         *time.Time `json:"last_used,omitempty"`
+	LastUsedIP       string     `json:"last_used_ip,omitempty"`
+	LastUsedEndpoint string     `json:"last_used_endpoint,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 // CreateAPIKeyResponse includes the full API key (only returned once)
@@ -71,16 +74,19 @@ func CreateAPIKeyHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
 		return
 	}
+	database.RecordOnboarding(user.ID, database.OnboardingAPIKey)
 
 	response := CreateAPIKeyResponse{
 		APIKeyResponse: APIKeyResponse{
-			ID:        apiKey.ID,
-			Name:      apiKey.Name,
-			KeyPrefix: apiKey.KeyPrefix,
-			IsActive:  apiKey.IsActive,
-			LastUsed:  apiKey.LastUsed,
-			ExpiresAt: apiKey.ExpiresAt,
-			CreatedAt: apiKey.CreatedAt,
+			ID:               apiKey.ID,
+			Name:             apiKey.Name,
+			KeyPrefix:        apiKey.KeyPrefix,
+			IsActive:         apiKey.IsActive,
+			LastUsed:         apiKey.LastUsed,
+			LastUsedIP:       apiKey.LastUsedIP,
+			LastUsedEndpoint: apiKey.LastUsedEndpoint,
+			ExpiresAt:        apiKey.ExpiresAt,
+			CreatedAt:        apiKey.CreatedAt,
 		},
 		APIKey: keyString,
 	}
@@ -133,13 +139,15 @@ func GetAPIKeysHandler(c *gin.Context) {
 	apiKeyResponses := make([]APIKeyResponse, len(apiKeys))
 	for i, key := range apiKeys {
 		apiKeyResponses[i] = APIKeyResponse{
-			ID:        key.ID,
-			Name:      key.Name,
-			KeyPrefix: key.KeyPrefix,
-			IsActive:  key.IsActive,
-			LastUsed:  key.LastUsed,
-			ExpiresAt: key.ExpiresAt,
-			CreatedAt: key.CreatedAt,
+			ID:               key.ID,
+			Name:             key.Name,
+			KeyPrefix:        key.KeyPrefix,
+			IsActive:         key.IsActive,
+			LastUsed:         key.LastUsed,
+			LastUsedIP:       key.LastUsedIP,
+			LastUsedEndpoint: key.LastUsedEndpoint,
+			ExpiresAt:        key.ExpiresAt,
+			CreatedAt:        key.CreatedAt,
 		}
 	}
 
@@ -179,13 +187,15 @@ func GetAPIKeyHandler(c *gin.Context) {
 	}
 
 	response := APIKeyResponse{
-		ID:        apiKey.ID,
-		Name:      apiKey.Name,
-		KeyPrefix: apiKey.KeyPrefix,
-		IsActive:  apiKey.IsActive,
-		LastUsed:  apiKey.LastUsed,
-		ExpiresAt: apiKey.ExpiresAt,
-		CreatedAt: apiKey.CreatedAt,
+		ID:               apiKey.ID,
+		Name:             apiKey.Name,
+		KeyPrefix:        apiKey.KeyPrefix,
+		IsActive:         apiKey.IsActive,
+		LastUsed:         apiKey.LastUsed,
+		LastUsedIP:       apiKey.LastUsedIP,
+		LastUsedEndpoint: apiKey.LastUsedEndpoint,
+		ExpiresAt:        apiKey.ExpiresAt,
+		CreatedAt:        apiKey.CreatedAt,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -326,7 +336,17 @@ func CleanupExpiredAPIKeysHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Expired API keys have been cleaned up"})
 }
 
-// GetAllAPIKeysHandler returns all API keys in the system (admin only)
+// apiKeySortColumns are the columns the admin API key listing can sort by
+var apiKeySortColumns = map[string]string{
+	"created_at": "api_keys.created_at",
+	"last_used":  "api_keys.last_used",
+	"expires_at": "api_keys.expires_at",
+	"name":       "api_keys.name",
+	"username":   "users.username",
+}
+
+// GetAllAPIKeysHandler returns API keys across all users, filtered, sorted
+// and paginated by the query string (admin only)
 func GetAllAPIKeysHandler(c *gin.Context) {
 	if !database.IsMultiUserMode() {
 		c.JSON(http.StatusNotFound, gin.H{"error": "API key management not available in single-user mode"})
@@ -338,36 +358,57 @@ func GetAllAPIKeysHandler(c *gin.Context) {
 		return
 	}
 
-	// Parse query parameters
-	page := 1
-	limit := 50
-	if p := c.Query("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
+	params, err := parseListParams(c, 50, apiKeySortColumns, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Model(&database.APIKey{}).
+		Joins("LEFT JOIN users ON users.id = api_keys.user_id")
+
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
 		}
+		query = query.Where("api_keys.user_id = ?", id)
+	}
+	active, set, err := queryBool(c, "active")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
+	if set {
+		query = query.Where("api_keys.is_active = ?", active)
+	}
+	expired, set, err := queryBool(c, "expired")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if set {
+		if expired {
+			query = query.Where("api_keys.expires_at IS NOT NULL AND api_keys.expires_at <= ?", time.Now())
+		} else {
+			query = query.Where("api_keys.expires_at IS NULL OR api_keys.expires_at > ?", time.Now())
 		}
 	}
+	if search := strings.ToLower(strings.TrimSpace(c.Query("search"))); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("LOWER(api_keys.name) LIKE ? OR LOWER(api_keys.key_prefix) LIKE ? OR LOWER(users.username) LIKE ?", like, like, like)
+	}
 
-	offset := (page - 1) * limit
-
-	// Get API keys with pagination
-	var apiKeys []database.APIKey
 	var total int64
-
-	query := database.DB.Model(&database.APIKey{})
-	
-	// Count total
 	if err := query.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count API keys"})
 		return
 	}
 
-	// Get paginated results with user info
-	if err := query.Preload("User").Offset(offset).Limit(limit).Order("created_at DESC").Find(&apiKeys).Error; err != nil {
+	var apiKeys []database.APIKey
+	if err := query.Preload("User").Select("api_keys.*").Order(params.Order()).
+		Offset(params.Offset()).Limit(params.Limit).Find(&apiKeys).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API keys"})
 		return
 	}
@@ -383,24 +424,20 @@ func GetAllAPIKeysHandler(c *gin.Context) {
 	for i, key := range apiKeys {
 		response[i] = AdminAPIKeyResponse{
 			APIKeyResponse: APIKeyResponse{
-				ID:        key.ID,
-				Name:      key.Name,
-				KeyPrefix: key.KeyPrefix,
-				IsActive:  key.IsActive,
-				LastUsed:  key.LastUsed,
-				ExpiresAt: key.ExpiresAt,
-				CreatedAt: key.CreatedAt,
+				ID:               key.ID,
+				Name:             key.Name,
+				KeyPrefix:        key.KeyPrefix,
+				IsActive:         key.IsActive,
+				LastUsed:         key.LastUsed,
+				LastUsedIP:       key.LastUsedIP,
+				LastUsedEndpoint: key.LastUsedEndpoint,
+				ExpiresAt:        key.ExpiresAt,
+				CreatedAt:        key.CreatedAt,
 			},
 			UserID:   key.UserID,
 			Username: key.User.Username,
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"api_keys":     response,
-		"total":        total,
-		"page":         page,
-		"limit":        limit,
-		"total_pages":  (total + int64(limit) - 1) / int64(limit),
-	})
+	c.JSON(http.StatusOK, params.Response(total, gin.H{"api_keys": response}))
 }
\ No newline at end of file
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// archiveFolder is a folder in the archive browser
+type archiveFolder struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Documents counts the archived documents anywhere below the folder
+	Documents int `json:"documents"`
+}
+
+// remoteFolder returns the reMarkable folder a document was uploaded to, as
+// a clean path starting with "/"
+func remoteFolder(doc database.Document) string {
+	return path.Dir(path.Clean("/" + doc.RemotePath))
+}
+
+// GetArchiveHandler lists one folder of the current user's archived
+// documents, laid out like the reMarkable folders they were uploaded to. The
+// folder is given by the path query parameter and defaults to the root.
+func GetArchiveHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document history not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	folder := path.Clean("/" + c.Query("path"))
+	docs, err := database.NewUserService(database.DB).ArchivedDocuments(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get archived documents"})
+		return
+	}
+
+	prefix := strings.TrimSuffix(folder, "/") + "/"
+	documents := make([]database.Document, 0)
+	subfolders := make(map[string]*archiveFolder)
+	for _, doc := range docs {
+		dir := remoteFolder(doc)
+		if dir == folder {
+			documents = append(documents, doc)
+			continue
+		}
+		if !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(dir, prefix), "/")
+		sub, ok := subfolders[name]
+		if !ok {
+			sub = &archiveFolder{Name: name, Path: prefix + name}
+			subfolders[name] = sub
+		}
+		sub.Documents++
+	}
+	if len(documents) == 0 && len(subfolders) == 0 && folder != "/" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	folders := make([]archiveFolder, 0, len(subfolders))
+	for _, sub := range subfolders {
+		folders = append(folders, *sub)
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return strings.ToLower(folders[i].Name) < strings.ToLower(folders[j].Name)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"path":      folder,
+		"folders":   folders,
+		"documents": documents,
+	})
+}
+
+// DownloadArchivedDocumentHandler streams the archived copy of one of the
+// current user's documents
+func DownloadArchivedDocumentHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document history not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	doc, err := database.NewUserService(database.DB).GetDocument(user.ID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if doc.ArchiveKey == "" || !storage.IsUserStorageKey(doc.ArchiveKey, user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document has no archived copy"})
+		return
+	}
+
+	ctx := context.Background()
+	backend := storage.GetStorageBackend()
+	if exists, err := backend.Exists(ctx, doc.ArchiveKey); err == nil && !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archived copy not found"})
+		return
+	}
+	reader, err := backend.Get(ctx, doc.ArchiveKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve archived copy"})
+		return
+	}
+	defer reader.Close()
+
+	filename := path.Base(doc.ArchiveKey)
+	contentType := mime.TypeByExtension(path.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Content-Type", contentType)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		logging.Logf("[ERROR] Failed to stream archived document %s: %v", doc.ID, err)
+	}
+}
@@ -41,6 +41,13 @@ func getLoginLimiter(ip string) *rate.Limiter {
 	return limiter
 }
 
+// AllowLogin reports whether another password login from ip may be tried,
+// counting it against the same per-IP limit as the web login. The SFTP server
+// uses it so passwords can't be guessed faster there.
+func AllowLogin(ip string) bool {
+	return getLoginLimiter(ip).Allow()
+}
+
 func allowInsecure() bool {
 	v := strings.ToLower(config.Get("ALLOW_INSECURE", ""))
 	return v == "1" || v == "true" || v == "yes"
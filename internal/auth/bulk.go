@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+)
+
+// Bulk user actions
+const (
+	BulkActionDeactivate     = "deactivate"
+	BulkActionActivate       = "activate"
+	BulkActionDelete         = "delete"
+	BulkActionSetQuota       = "set_quota"
+	BulkActionRefreshFolders = "refresh_folders"
+)
+
+// maxBulkUsers caps how many users one bulk request can act on
+const maxBulkUsers = 500
+
+// FolderRefreshCallback queues folder cache refreshes for the given users and
+// returns how many were queued
+type FolderRefreshCallback func(userIDs []uuid.UUID) int
+
+// Global callback for queuing folder refreshes, set by main to avoid an import cycle
+var folderRefreshCallback FolderRefreshCallback
+
+// SetFolderRefreshCallback sets the callback used to queue folder cache refreshes
+func SetFolderRefreshCallback(callback FolderRefreshCallback) {
+	folderRefreshCallback = callback
+}
+
+// BulkUsersRequest applies one action to a list of users
+type BulkUsersRequest struct {
+	Action  string   `json:"action" binding:"required"`
+	UserIDs []string `json:"user_ids" binding:"required,min=1"`
+	// Quotas for set_quota; a field left out keeps each user's current value
+	StorageQuotaMB *int `json:"storage_quota_mb,omitempty" binding:"omitempty,min=0"`
+	UploadQuota    *int `json:"upload_quota,omitempty" binding:"omitempty,min=0"`
+}
+
+// BulkUserResult is the outcome of a bulk action for one user
+type BulkUserResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkUsersHandler deactivates, activates, deletes, sets quotas on or
+// refreshes the folders of several users at once (admin only). Each user is
+// handled separately, so one failure doesn't stop the rest.
+func BulkUsersHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	currentUser, ok := RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req BulkUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+	if len(req.UserIDs) > maxBulkUsers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many users in one request"})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	updates := make(map[string]interface{})
+	switch action {
+	case BulkActionDeactivate, BulkActionActivate, BulkActionDelete:
+	case BulkActionSetQuota:
+		if req.StorageQuotaMB != nil {
+			updates["storage_quota_mb"] = *req.StorageQuotaMB
+		}
+		if req.UploadQuota != nil {
+			updates["upload_quota"] = *req.UploadQuota
+		}
+		if len(updates) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "storage_quota_mb or upload_quota is required"})
+			return
+		}
+	case BulkActionRefreshFolders:
+		if folderRefreshCallback == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Folder refresh not available"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown action"})
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	results := make([]BulkUserResult, len(req.UserIDs))
+	var refreshIDs []uuid.UUID
+	var refreshIdx []int
+
+	for i, idStr := range req.UserIDs {
+		results[i].ID = idStr
+		userID, err := uuid.Parse(idStr)
+		if err != nil {
+			results[i].Error = "Invalid user ID"
+			continue
+		}
+		user, err := userService.GetUserByID(userID)
+		if err != nil {
+			results[i].Error = "User not found"
+			continue
+		}
+
+		switch action {
+		case BulkActionDeactivate:
+			if user.ID == currentUser.ID {
+				results[i].Error = "Cannot deactivate yourself"
+				continue
+			}
+			if err := userService.DeactivateUser(user.ID); err != nil {
+				results[i].Error = "Failed to deactivate user"
+				continue
+			}
+		case BulkActionActivate:
+			if err := userService.ActivateUser(user.ID); err != nil {
+				results[i].Error = "Failed to activate user"
+				continue
+			}
+		case BulkActionDelete:
+			if user.ID == currentUser.ID {
+				results[i].Error = "Cannot delete yourself"
+				continue
+			}
+			if err := userService.DeleteUser(user.ID); err != nil {
+				results[i].Error = "Failed to delete user"
+				continue
+			}
+		case BulkActionSetQuota:
+			// UpdateUserSettings adds updated_at to the map it's given
+			userUpdates := make(map[string]interface{}, len(updates))
+			for k, v := range updates {
+				userUpdates[k] = v
+			}
+			if err := userService.UpdateUserSettings(user.ID, userUpdates); err != nil {
+				results[i].Error = "Failed to update quota"
+				continue
+			}
+		case BulkActionRefreshFolders:
+			if !user.IsActive {
+				results[i].Error = "User is inactive"
+				continue
+			}
+			if !rmapi.IsUserPaired(user.ID) {
+				results[i].Error = "User is not paired"
+				continue
+			}
+			refreshIDs = append(refreshIDs, user.ID)
+			refreshIdx = append(refreshIdx, i)
+			continue
+		}
+		results[i].Success = true
+	}
+
+	// Queue the refreshes together so they're staggered by the folder refresh rate
+	if len(refreshIDs) > 0 {
+		folderRefreshCallback(refreshIDs)
+		for _, i := range refreshIdx {
+			results[i].Success = true
+		}
+	}
+
+	succeeded := 0
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		}
+	}
+	logging.Logf("[AUTH] Admin %s ran bulk %s on %d users (%d succeeded)", currentUser.Username, action, len(results), succeeded)
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":    action,
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
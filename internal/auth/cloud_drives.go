@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/clouddrive"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	cloudDriveCookie   = "cloud_drive_connect"
+	cloudDriveAudience = "aviary-cloud-drive"
+)
+
+// GetCloudDrivesHandler lists the cloud drive providers and whether the
+// current user has connected each one
+func GetCloudDrivesHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	connected := clouddrive.Connected(user.ID)
+	providers := make([]gin.H, 0, len(clouddrive.Providers))
+	for _, provider := range clouddrive.Providers {
+		providers = append(providers, gin.H{
+			"provider":   provider,
+			"name":       clouddrive.ProviderName(provider),
+			"configured": clouddrive.OAuthConfig(provider) != nil,
+			"connected":  connected[provider],
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+// ConnectCloudDriveHandler redirects to the provider's consent page so the
+// current user can grant access to their private files
+func ConnectCloudDriveHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	provider := c.Param("provider")
+	if clouddrive.OAuthConfig(provider) == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Cloud drive provider not configured"})
+		return
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start cloud drive connection"})
+		return
+	}
+	state := hex.EncodeToString(nonce)
+
+	// As with OIDC linking, the auth cookie is not sent on the cross-site
+	// redirect back from the provider, so carry the user in a signed cookie
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":  user.ID.String(),
+		"provider": provider,
+		"state":    state,
+		"exp":      time.Now().Add(10 * time.Minute).Unix(),
+		"iat":      time.Now().Unix(),
+		"iss":      "aviary",
+		"aud":      cloudDriveAudience,
+	})
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start cloud drive connection"})
+		return
+	}
+
+	authURL, err := clouddrive.AuthCodeURL(provider, state)
+	if err != nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Cloud drive provider not configured"})
+		return
+	}
+
+	secure := !allowInsecure()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cloudDriveCookie, tokenString, 600, "/", "", secure, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// CloudDriveCallbackHandler stores the token returned by the provider and
+// redirects back to the frontend with the outcome
+func CloudDriveCallbackHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	redirectURL := config.Get("OIDC_SUCCESS_REDIRECT_URL", "")
+	if redirectURL == "" {
+		redirectURL = "/"
+	}
+	finish := func(result string) {
+		c.Redirect(http.StatusFound, fmt.Sprintf("%s%scloud_drive=%s", redirectURL, querySeparator(redirectURL), url.QueryEscape(result)))
+	}
+
+	userID, provider, state, ok := pendingCloudDriveConnect(c)
+	if !ok || c.Query("state") != state {
+		finish("invalid_state")
+		return
+	}
+	if c.Query("error") != "" {
+		finish("denied")
+		return
+	}
+
+	if err := clouddrive.Connect(c.Request.Context(), userID, provider, c.Query("code")); err != nil {
+		logging.Logf("[AUTH] Failed to connect %s for user %s: %v", clouddrive.ProviderName(provider), userID, err)
+		finish("failed")
+		return
+	}
+
+	logging.Logf("[AUTH] Connected %s for user %s", clouddrive.ProviderName(provider), userID)
+	finish("connected")
+}
+
+// DisconnectCloudDriveHandler removes the current user's token for a provider
+func DisconnectCloudDriveHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	provider := c.Param("provider")
+	if err := clouddrive.Disconnect(user.ID, provider); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect cloud drive"})
+		return
+	}
+
+	logging.Logf("[AUTH] User %s disconnected %s", user.Username, clouddrive.ProviderName(provider))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// pendingCloudDriveConnect reads and clears the connect cookie
+func pendingCloudDriveConnect(c *gin.Context) (uuid.UUID, string, string, bool) {
+	tokenString, err := c.Cookie(cloudDriveCookie)
+	if err != nil || tokenString == "" {
+		return uuid.Nil, "", "", false
+	}
+
+	secure := !allowInsecure()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cloudDriveCookie, "", -1, "/", "", secure, true)
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwtSecret, nil
+	}, jwt.WithAudience(cloudDriveAudience), jwt.WithIssuer("aviary"))
+	if err != nil || !token.Valid {
+		return uuid.Nil, "", "", false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, "", "", false
+	}
+	userIDStr, _ := claims["user_id"].(string)
+	provider, _ := claims["provider"].(string)
+	state, _ := claims["state"].(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil || state == "" {
+		return uuid.Nil, "", "", false
+	}
+	return userID, provider, state, true
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// UpdateDeliveryRequest sets how documents reach the current user's tablet
+type UpdateDeliveryRequest struct {
+	Method  string `json:"method" binding:"required"`
+	Host    string `json:"host"`
+	SSHUser string `json:"ssh_user"`
+	// SSHKey replaces the stored private key when set; it is never returned
+	SSHKey     *string `json:"ssh_key"`
+	SSHHostKey string  `json:"ssh_host_key"`
+}
+
+func deliveryResponse(user *database.User) gin.H {
+	return gin.H{
+		"allowed":      delivery.UserDeliveryAllowed(),
+		"method":       delivery.ForUser(user).Method,
+		"host":         user.DeliveryHost,
+		"ssh_user":     user.DeliverySSHUser,
+		"ssh_key_set":  user.DeliverySSHKey != "",
+		"ssh_host_key": user.DeliverySSHHostKey,
+	}
+}
+
+// GetDeliveryHandler returns the current user's delivery settings
+func GetDeliveryHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveryResponse(user))
+}
+
+// UpdateDeliveryHandler switches the current user between the reMarkable cloud
+// and direct USB or SSH delivery
+func UpdateDeliveryHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	if !delivery.UserDeliveryAllowed() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Offline delivery is disabled on this server"})
+		return
+	}
+
+	var req UpdateDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+
+	sshKey := user.DeliverySSHKey
+	if req.SSHKey != nil {
+		sshKey = strings.TrimSpace(*req.SSHKey)
+	}
+	target := delivery.Target{
+		Method:     strings.ToLower(strings.TrimSpace(req.Method)),
+		Host:       strings.TrimSpace(req.Host),
+		SSHUser:    strings.TrimSpace(req.SSHUser),
+		SSHKey:     sshKey,
+		SSHHostKey: strings.TrimSpace(req.SSHHostKey),
+	}
+	if err := target.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"delivery_method":       target.Method,
+		"delivery_host":         target.Host,
+		"delivery_ssh_user":     target.SSHUser,
+		"delivery_ssh_key":      target.SSHKey,
+		"delivery_ssh_host_key": target.SSHHostKey,
+	}
+	userService := database.NewUserService(database.DB)
+	if err := userService.UpdateUserSettings(user.ID, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update delivery settings"})
+		return
+	}
+
+	user.DeliveryMethod = target.Method
+	user.DeliveryHost = target.Host
+	user.DeliverySSHUser = target.SSHUser
+	user.DeliverySSHKey = target.SSHKey
+	user.DeliverySSHHostKey = target.SSHHostKey
+
+	logging.Logf("[AUTH] User %s set delivery method to %s", user.Username, target.Method)
+	c.JSON(http.StatusOK, deliveryResponse(user))
+}
+
+// TestDeliveryHandler connects to the current user's tablet with their saved
+// delivery settings and lists its folders
+func TestDeliveryHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	target := delivery.ForUser(user)
+	if !target.Offline() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "USB or SSH delivery is not configured"})
+		return
+	}
+
+	folders, err := delivery.ListFolders(c.Request.Context(), target)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "folders": len(folders)})
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"gorm.io/gorm"
+)
+
+// documentSortColumns are the columns the document history can sort by
+var documentSortColumns = map[string]string{
+	"upload_date":   "upload_date",
+	"document_name": "document_name",
+	"file_size":     "file_size",
+	"status":        "status",
+}
+
+// queryDate parses an optional date query parameter, either YYYY-MM-DD or
+// RFC 3339. A bare date given as an upper bound includes that whole day.
+func queryDate(c *gin.Context, key string, upper bool) (*time.Time, error) {
+	v := strings.TrimSpace(c.Query(key))
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 time", key)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// GetDocumentsHandler returns a page of the current user's upload history,
+// optionally filtered by status, type, upload date or label
+func GetDocumentsHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document history not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	params, err := parseListParams(c, 20, documentSortColumns, "upload_date")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "invalid_request"})
+		return
+	}
+	from, err := queryDate(c, "from", false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "invalid_request"})
+		return
+	}
+	to, err := queryDate(c, "to", true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "invalid_request"})
+		return
+	}
+
+	labels := make(map[string]string)
+	for _, f := range c.QueryArray("label") {
+		key, value, err := database.ParseLabelFilter(f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "invalid_request"})
+			return
+		}
+		labels[key] = value
+	}
+
+	userService := database.NewUserService(database.DB)
+	docs, total, err := userService.ListDocuments(user.ID, database.DocumentQuery{
+		Status:       strings.ToLower(c.Query("status")),
+		DocumentType: c.Query("type"),
+		From:         from,
+		To:           to,
+		Labels:       labels,
+		Order:        params.Order(),
+		Offset:       params.Offset(),
+		Limit:        params.Limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get documents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, params.Response(total, gin.H{"documents": docs}))
+}
+
+// GetDocumentHandler returns one document from the current user's history
+func GetDocumentHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document history not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	doc, err := database.NewUserService(database.DB).GetDocument(user.ID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// DeleteDocumentHandler removes a document from the current user's history.
+// The copy on the reMarkable is left alone.
+func DeleteDocumentHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document history not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	err = database.NewUserService(database.DB).DeleteDocument(user.ID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+		return
+	}
+
+	logging.LogfWithUser(user.Username, "[DOCUMENTS] Removed document %s from history", id)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxListLimit caps the page size of admin listings
+const maxListLimit = 100
+
+// listParams holds the page and sort order requested for an admin listing
+type listParams struct {
+	Page  int
+	Limit int
+	Sort  string
+	Desc  bool
+	order string
+}
+
+// parseListParams reads page, limit, sort and order from the query string.
+// sortable maps the sort names clients may use to their columns; sort can
+// also be given as "-name" for descending order.
+func parseListParams(c *gin.Context, defaultLimit int, sortable map[string]string, defaultSort string) (listParams, error) {
+	p := listParams{Page: 1, Limit: defaultLimit, Sort: defaultSort, Desc: true}
+	if v := c.Query("page"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			p.Page = parsed
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= maxListLimit {
+			p.Limit = parsed
+		}
+	}
+
+	if name := strings.TrimSpace(c.Query("sort")); name != "" {
+		p.Desc = strings.HasPrefix(name, "-")
+		p.Sort = strings.TrimPrefix(name, "-")
+	}
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+	case "asc":
+		p.Desc = false
+	case "desc":
+		p.Desc = true
+	default:
+		return p, fmt.Errorf("order must be asc or desc")
+	}
+
+	column, ok := sortable[p.Sort]
+	if !ok {
+		names := make([]string, 0, len(sortable))
+		for name := range sortable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return p, fmt.Errorf("sort must be one of: %s", strings.Join(names, ", "))
+	}
+	p.order = column + " ASC"
+	if p.Desc {
+		p.order = column + " DESC"
+	}
+	return p, nil
+}
+
+// Offset returns the number of rows before the requested page
+func (p listParams) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Order returns the ORDER BY clause for the requested sort
+func (p listParams) Order() string {
+	return p.order
+}
+
+// Response adds the page details to a listing response
+func (p listParams) Response(total int64, body gin.H) gin.H {
+	order := "asc"
+	if p.Desc {
+		order = "desc"
+	}
+	body["total"] = total
+	body["page"] = p.Page
+	body["limit"] = p.Limit
+	body["total_pages"] = (total + int64(p.Limit) - 1) / int64(p.Limit)
+	body["sort"] = p.Sort
+	body["order"] = order
+	return body
+}
+
+// queryBool parses an optional true/false query parameter
+func queryBool(c *gin.Context, key string) (value, set bool, err error) {
+	v := c.Query(key)
+	if v == "" {
+		return false, false, nil
+	}
+	value, err = strconv.ParseBool(v)
+	if err != nil {
+		return false, false, fmt.Errorf("%s must be true or false", key)
+	}
+	return value, true, nil
+}
@@ -7,8 +7,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
 )
 
 // MultiUserAuthMiddleware provides authentication for multi-user mode
@@ -47,8 +49,7 @@ func MultiUserAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		c.Abort()
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 	}
 }
 
@@ -63,15 +64,13 @@ func AdminRequiredMiddleware() gin.HandlerFunc {
 
 		currentUser, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 			return
 		}
 
 		user := currentUser.(*database.User)
 		if !user.IsAdmin {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
-			c.Abort()
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden, "Admin privileges required")
 			return
 		}
 
@@ -154,11 +153,23 @@ func checkAPIKey(c *gin.Context) *database.User {
 
 	// Validate API key against database
 	apiKeyService := database.NewAPIKeyService(database.DB)
-	user, err := apiKeyService.ValidateAPIKeyConstantTime(apiKey)
+	user, key, err := apiKeyService.AuthenticateAPIKey(apiKey)
 	if err != nil {
 		return nil
 	}
 
+	// Record usage in the background so the request isn't held up by the write
+	ip := c.ClientIP()
+	endpoint := c.Request.Method + " " + c.FullPath()
+	if c.FullPath() == "" {
+		endpoint = c.Request.Method + " " + c.Request.URL.Path
+	}
+	go func(keyID uuid.UUID) {
+		if err := apiKeyService.RecordAPIKeyUsage(keyID, ip, endpoint); err != nil {
+			logging.Logf("[WARNING] Failed to record API key usage for %s: %v", keyID, err)
+		}
+	}(key.ID)
+
 	return user
 }
 
@@ -234,7 +245,7 @@ func GetAuthMethod(c *gin.Context) string {
 func RequireUser(c *gin.Context) (*database.User, bool) {
 	user := GetCurrentUser(c)
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return nil, false
 	}
 	return user, true
@@ -248,7 +259,7 @@ func RequireAdmin(c *gin.Context) (*database.User, bool) {
 	}
 
 	if !user.IsAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Admin privileges required")
 		return nil, false
 	}
 
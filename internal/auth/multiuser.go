@@ -13,6 +13,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/i18n"
 	"github.com/rmitchellscott/aviary/internal/rmapi"
 	"github.com/rmitchellscott/aviary/internal/smtp"
 	"golang.org/x/crypto/bcrypt"
@@ -53,15 +55,31 @@ type UserResponse struct {
 	PageResolution         string     `json:"page_resolution,omitempty"`
 	PageDPI                float64    `json:"page_dpi,omitempty"`
 	ConversionOutputFormat string     `json:"conversion_output_format,omitempty"`
+	UploadTimeout          int        `json:"upload_timeout"`
+	JobTimeout             int        `json:"job_timeout"`
+	StorageQuotaMB         int        `json:"storage_quota_mb"`
+	UploadQuota            int        `json:"upload_quota"`
+	MaxUploadMB            int        `json:"max_upload_mb"`
+	BlockedContentTypes    string     `json:"blocked_content_types"`
+	Language               string     `json:"language"`
 	RmapiPaired            bool       `json:"rmapi_paired"`
+	DeliveryMethod         string     `json:"delivery_method"`
+	DeliveryWindowStart    string     `json:"delivery_window_start,omitempty"`
+	DeliveryWindowEnd      string     `json:"delivery_window_end,omitempty"`
+	DeliveryTimezone       string     `json:"delivery_timezone,omitempty"`
+	OIDCLinked             bool       `json:"oidc_linked"`
 	PDFBackgroundRemoval   *bool      `json:"pdf_background_removal,omitempty"`
 	ExperimentalDownloadLink *bool   `json:"experimental_download_link,omitempty"`
+	ExtractContent         *bool      `json:"extract_content,omitempty"`
 	CreatedAt              time.Time  `json:"created_at"`
 	LastLogin              *time.Time `json:"last_login,omitempty"`
+	SessionsRevokedAt      *time.Time `json:"sessions_revoked_at,omitempty"`
 }
 
 // userToResponse converts a database.User to a UserResponse
 func userToResponse(user *database.User) UserResponse {
+	// A tablet reached over USB or SSH needs no cloud pairing to receive uploads
+	target := delivery.ForUser(user)
 	return UserResponse{
 		ID:                     user.ID,
 		Username:               user.Username,
@@ -69,7 +87,12 @@ func userToResponse(user *database.User) UserResponse {
 		IsAdmin:                user.IsAdmin,
 		IsActive:               user.IsActive,
 		RmapiHost:              user.RmapiHost,
-		RmapiPaired:            rmapi.IsUserPaired(user.ID),
+		RmapiPaired:            rmapi.IsUserPaired(user.ID) || target.Offline(),
+		DeliveryMethod:         target.Method,
+		DeliveryWindowStart:    user.DeliveryWindowStart,
+		DeliveryWindowEnd:      user.DeliveryWindowEnd,
+		DeliveryTimezone:       user.DeliveryTimezone,
+		OIDCLinked:             user.OidcSubject != nil,
 		DefaultRmdir:           user.DefaultRmdir,
 		CoverpageSetting:       user.CoverpageSetting,
 		ContrastSetting:        user.ContrastSetting,
@@ -79,10 +102,19 @@ func userToResponse(user *database.User) UserResponse {
 		PageResolution:         user.PageResolution,
 		PageDPI:                user.PageDPI,
 		ConversionOutputFormat: user.ConversionOutputFormat,
+		UploadTimeout:          user.UploadTimeout,
+		JobTimeout:             user.JobTimeout,
+		StorageQuotaMB:         user.StorageQuotaMB,
+		UploadQuota:            user.UploadQuota,
+		MaxUploadMB:            user.MaxUploadMB,
+		BlockedContentTypes:    user.BlockedContentTypes,
+		Language:               user.Language,
 		PDFBackgroundRemoval:     user.PDFBackgroundRemoval,
 		ExperimentalDownloadLink: user.ExperimentalDownloadLink,
+		ExtractContent:           user.ExtractContent,
 		CreatedAt:                user.CreatedAt,
 		LastLogin:              user.LastLogin,
+		SessionsRevokedAt:      user.SessionsRevokedAt,
 	}
 }
 
@@ -153,6 +185,13 @@ func PublicRegisterHandler(c *gin.Context) {
 		return
 	}
 
+	// Emails go out in the language of the browser the user registered with
+	// until they choose one
+	lang := i18n.Resolve(c.GetHeader("Accept-Language"))
+	if err := userService.UpdateUserSettings(newUser.ID, map[string]interface{}{"language": lang}); err == nil {
+		newUser.Language = lang
+	}
+
 	// If this is the first user, migrate single-user data asynchronously
 	if firstUser {
 		go func() {
@@ -164,7 +203,7 @@ func PublicRegisterHandler(c *gin.Context) {
 
 	// Send welcome email if SMTP is configured and not disabled
 	if smtp.IsSMTPConfigured() && !config.GetBool("DISABLE_WELCOME_EMAIL", false) {
-		if err := smtp.SendWelcomeEmail(newUser.Email, newUser.Username); err != nil {
+		if err := smtp.SendWelcomeEmail(newUser.Email, newUser.Username, newUser.Language); err != nil {
 			// Log error but don't fail user creation
 			fmt.Printf("Failed to send welcome email: %v\n", err)
 		}
@@ -225,7 +264,7 @@ func RegisterHandler(c *gin.Context) {
 
 	// Send welcome email if SMTP is configured and not disabled
 	if smtp.IsSMTPConfigured() && !config.GetBool("DISABLE_WELCOME_EMAIL", false) {
-		if err := smtp.SendWelcomeEmail(newUser.Email, newUser.Username); err != nil {
+		if err := smtp.SendWelcomeEmail(newUser.Email, newUser.Username, newUser.Language); err != nil {
 			// Log error but don't fail user creation
 			fmt.Printf("Failed to send welcome email: %v\n", err)
 		}
@@ -351,7 +390,7 @@ func PasswordResetHandler(c *gin.Context) {
 		// Get user info for email
 		user, err := database.GetUserByEmail(req.Email)
 		if err == nil {
-			if err := smtp.SendPasswordResetEmail(user.Email, user.Username, token); err != nil {
+			if err := smtp.SendPasswordResetEmail(user.Email, user.Username, token, user.Language); err != nil {
 				// Log error but don't reveal it to user
 				fmt.Printf("Failed to send password reset email: %v\n", err)
 			}
@@ -463,7 +502,7 @@ func MultiUserCheckAuthHandler(c *gin.Context) {
 	// Verify user still exists and is active
 	userService := database.NewUserService(database.DB)
 	user, err := userService.GetUserByID(userID)
-	if err != nil {
+	if err != nil || sessionRevoked(user, claims) {
 		c.JSON(http.StatusOK, gin.H{"authenticated": false})
 		return
 	}
@@ -503,7 +542,29 @@ func extractUserFromToken(tokenString string) (*database.User, error) {
 	}
 
 	userService := database.NewUserService(database.DB)
-	return userService.GetUserByID(userID)
+	user, err := userService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sessionRevoked(user, claims) {
+		return nil, errors.New("session revoked")
+	}
+	return user, nil
+}
+
+// sessionRevoked reports whether a login cookie with claims was issued before
+// an admin signed its user out everywhere. The check is made on every
+// request, as the cookie itself stays valid until it expires.
+func sessionRevoked(user *database.User, claims jwt.MapClaims) bool {
+	if user.SessionsRevokedAt == nil {
+		return false
+	}
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return true
+	}
+	// iat has whole seconds, so a cookie from the same second is revoked too
+	return iat.Unix() <= user.SessionsRevokedAt.Unix()
 }
 
 // generateSecureToken generates a cryptographically secure random token
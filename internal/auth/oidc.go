@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -27,11 +28,39 @@ var (
 	oidcEnabled  bool
 )
 
-// oidcDebugLog logs OIDC debug messages if OIDC_DEBUG is enabled
+var (
+	errOIDCUserNotFound    = errors.New("user not found and auto-creation disabled")
+	errOIDCAccountDisabled = errors.New("account disabled")
+)
+
+// oidcDebugLog logs OIDC debug messages when OIDC_DEBUG or LOG_LEVEL=debug is set
 func oidcDebugLog(format string, v ...interface{}) {
-	if config.Get("OIDC_DEBUG", "") == "true" || config.Get("OIDC_DEBUG", "") == "1" {
-		logging.Logf("[OIDC DEBUG] "+format, v...)
+	if config.GetBool("OIDC_DEBUG", false) {
+		logging.Logf("[DEBUG] [OIDC] "+format, v...)
+		return
+	}
+	logging.Debugf("[OIDC] "+format, v...)
+}
+
+// oidcErrorRedirect logs a failed OIDC login and sends the browser back to the
+// login page with an error code the frontend can translate
+func oidcErrorRedirect(c *gin.Context, code string, err error) {
+	if err != nil {
+		logging.Logf("[OIDC] Login failed (%s): %v", code, err)
+	} else {
+		logging.Logf("[OIDC] Login failed (%s)", code)
 	}
+	redirectURL := oidcSuccessRedirectURL()
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s%soidc_error=%s", redirectURL, querySeparator(redirectURL), url.QueryEscape(code)))
+}
+
+// oidcSuccessRedirectURL returns the frontend URL the browser goes back to
+// after an OIDC login, OIDC_SUCCESS_REDIRECT_URL or the home page
+func oidcSuccessRedirectURL() string {
+	if redirectURL := config.Get("OIDC_SUCCESS_REDIRECT_URL", ""); redirectURL != "" {
+		return redirectURL
+	}
+	return "/"
 }
 
 type OIDCConfig struct {
@@ -134,11 +163,20 @@ func OIDCAuthHandler(c *gin.Context) {
 		return
 	}
 
+	if authURL, ok := startOIDCLogin(c); ok {
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// startOIDCLogin stores the state and nonce of a new OIDC login in cookies
+// and returns the provider URL to send the browser to. It responds with an
+// error and returns false if they can't be generated.
+func startOIDCLogin(c *gin.Context) (string, bool) {
 	// Generate state parameter for CSRF protection
 	state, err := generateState()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate state"})
-		return
+		return "", false
 	}
 
 	// Store state in session cookie (secure, httponly)
@@ -151,61 +189,40 @@ func OIDCAuthHandler(c *gin.Context) {
 	nonce, err := generateNonce()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate nonce"})
-		return
+		return "", false
 	}
 
 	// Store nonce in session cookie
 	c.SetCookie("oidc_nonce", nonce, 600, "/", "", secure, true)
 
 	// Build auth URL with state and nonce
-	authURL := oauth2Config.AuthCodeURL(state,
+	return oauth2Config.AuthCodeURL(state,
 		oauth2.SetAuthURLParam("nonce", nonce),
 		oauth2.SetAuthURLParam("prompt", "select_account"),
-	)
-
-	c.Redirect(http.StatusFound, authURL)
+	), true
 }
 
 // OIDCCallbackHandler handles the OIDC callback
 func OIDCCallbackHandler(c *gin.Context) {
 	if !oidcEnabled {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "OIDC not configured"})
+		oidcErrorRedirect(c, "not_configured", nil)
 		return
 	}
 
 	oidcDebugLog("OIDC callback handler started")
 
-	// Debug: Log all query parameters and cookies
-	oidcDebugLog("OIDC Callback - Query params: %v", c.Request.URL.Query())
-	oidcDebugLog("OIDC Callback - All cookies: %v", c.Request.Cookies())
-
 	// Verify state parameter
 	state := c.Query("state")
 	storedState, err := c.Cookie("oidc_state")
-	oidcDebugLog("OIDC Callback - State from query: %s, State from cookie: %s, Cookie error: %v", state, storedState, err)
-
-	if err != nil || state != storedState {
-		// More detailed error for debugging
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid state parameter",
-				"details": fmt.Sprintf("Cookie error: %v", err),
-				"debug":   "State cookie not found or unreadable",
-			})
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid state parameter",
-				"details": fmt.Sprintf("Expected: %s, Got: %s", storedState, state),
-				"debug":   "State mismatch - possible CSRF attack or cookie issue",
-			})
-		}
+	if err != nil || state == "" || state != storedState {
+		oidcErrorRedirect(c, "invalid_state", err)
 		return
 	}
 
 	// Get nonce from cookie
 	nonce, err := c.Cookie("oidc_nonce")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing nonce"})
+		oidcErrorRedirect(c, "invalid_state", err)
 		return
 	}
 
@@ -217,59 +234,54 @@ func OIDCCallbackHandler(c *gin.Context) {
 
 	// Handle error from provider
 	if errMsg := c.Query("error"); errMsg != "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "OIDC authentication failed",
-			"details": errMsg,
-		})
+		oidcErrorRedirect(c, "provider_error", fmt.Errorf("%s: %s", errMsg, c.Query("error_description")))
 		return
 	}
 
 	// Exchange code for token
 	code := c.Query("code")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing authorization code"})
+		oidcErrorRedirect(c, "missing_code", nil)
 		return
 	}
 
 	ctx := context.Background()
 	oauth2Token, err := oauth2Config.Exchange(ctx, code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange code for token"})
+		oidcErrorRedirect(c, "token_exchange_failed", err)
 		return
 	}
 
 	// Extract ID token
 	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No ID token received"})
+		oidcErrorRedirect(c, "invalid_token", errors.New("no ID token received"))
 		return
 	}
 
 	// Verify ID token
 	idToken, err := oidcVerifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify ID token"})
+		oidcErrorRedirect(c, "invalid_token", err)
 		return
 	}
 
 	// Verify nonce
 	if idToken.Nonce != nonce {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid nonce"})
+		oidcErrorRedirect(c, "invalid_state", errors.New("nonce mismatch"))
 		return
 	}
 
 	// Extract raw claims first for debug logging
 	var rawClaims map[string]interface{}
 	if err := idToken.Claims(&rawClaims); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extract raw claims"})
+		oidcErrorRedirect(c, "invalid_token", err)
 		return
 	}
 
 	// Debug log raw claims from OIDC provider
 	if rawClaimsJSON, err := json.MarshalIndent(rawClaims, "", "  "); err == nil {
 		oidcDebugLog("Raw claims from OIDC provider:\n%s", string(rawClaimsJSON))
-	} else {
-		oidcDebugLog("Raw claims from OIDC provider (failed to serialize): %+v", rawClaims)
 	}
 
 	// Extract claims into our structured format
@@ -283,44 +295,42 @@ func OIDCCallbackHandler(c *gin.Context) {
 	}
 
 	if err := idToken.Claims(&claims); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extract claims"})
+		oidcErrorRedirect(c, "invalid_token", err)
 		return
 	}
 
-	// Debug log parsed claims
-	if claimsJSON, err := json.Marshal(claims); err == nil {
-		oidcDebugLog("Parsed claims: %s", string(claimsJSON))
-	} else {
-		oidcDebugLog("Parsed claims (failed to serialize): email=%s, name=%s, preferred_username=%s, subject=%s, email_verified=%t, groups=%v",
-			claims.Email, claims.Name, claims.PreferredUsername, claims.Subject, claims.EmailVerified, claims.Groups)
+	// A link flow started from the profile page attaches the subject instead of signing in
+	if linkUserID, ok := pendingOIDCLink(c); ok {
+		completeOIDCLink(c, linkUserID, claims.Subject)
+		return
 	}
 
-	// Determine username - prefer preferred_username, fallback to email, then subject
-	username := claims.PreferredUsername
-	if username == "" {
-		username = claims.Email
-	}
-	if username == "" {
-		username = claims.Subject
-	}
+	// Determine username and email, honoring OIDC_USERNAME_TEMPLATE/OIDC_USERNAME_CLAIM
+	// and OIDC_EMAIL_CLAIM before the standard claims
+	username := oidcUsername(rawClaims)
+	email := oidcEmail(rawClaims)
+	oidcDebugLog("Resolved username: %s, email: %s, subject: %s, groups: %v", username, email, claims.Subject, claims.Groups)
 
 	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No suitable username claim found"})
+		oidcErrorRedirect(c, "no_username", nil)
 		return
 	}
 
 	// OIDC authentication requires multi-user mode
 	if !database.IsMultiUserMode() {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "OIDC authentication requires multi-user mode"})
+		oidcErrorRedirect(c, "multi_user_required", nil)
 		return
 	}
 
 	// Handle user authentication in multi-user mode
-	if err := handleOIDCMultiUserAuth(c, username, claims.Email, claims.Name, claims.Subject, claims.Groups, rawIDToken); err != nil {
-		if err.Error() == "account disabled" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "backend.auth.account_disabled"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := handleOIDCMultiUserAuth(c, username, email, claims.Name, claims.Subject, claims.Groups, rawIDToken); err != nil {
+		switch {
+		case errors.Is(err, errOIDCAccountDisabled):
+			oidcErrorRedirect(c, "account_disabled", err)
+		case errors.Is(err, errOIDCUserNotFound):
+			oidcErrorRedirect(c, "user_not_found", err)
+		default:
+			oidcErrorRedirect(c, "login_failed", err)
 		}
 		return
 	}
@@ -346,7 +356,7 @@ func handleOIDCMultiUserAuth(c *gin.Context, username, email, name, subject stri
 				oidcDebugLog("OIDC_AUTO_CREATE_USERS setting: %s", autoCreateUsers)
 				if autoCreateUsers != "true" && autoCreateUsers != "1" {
 					oidcDebugLog("Auto-creation disabled, rejecting user creation")
-					return fmt.Errorf("user not found and auto-creation disabled")
+					return errOIDCUserNotFound
 				}
 
 				// Check if this would be the first user (for admin privileges)
@@ -471,7 +481,7 @@ func handleOIDCMultiUserAuth(c *gin.Context, username, email, name, subject stri
 	oidcDebugLog("Checking if user %s is active: %t", user.Username, user.IsActive)
 	if !user.IsActive {
 		oidcDebugLog("User account is disabled, rejecting authentication")
-		return fmt.Errorf("account disabled")
+		return errOIDCAccountDisabled
 	}
 
 	// Generate JWT token
@@ -501,10 +511,7 @@ func handleOIDCMultiUserAuth(c *gin.Context, username, email, name, subject stri
 	c.SetCookie("oidc_id_token", rawIDToken, int(sessionTimeout.Seconds()), "/", "", secure, true)
 
 	// Redirect to frontend
-	redirectURL := config.Get("OIDC_SUCCESS_REDIRECT_URL", "")
-	if redirectURL == "" {
-		redirectURL = "/" // Default to home page
-	}
+	redirectURL := oidcSuccessRedirectURL()
 	oidcDebugLog("OIDC authentication successful for user %s (ID: %s, admin: %t), redirecting to: %s", user.Username, user.ID, user.IsAdmin, redirectURL)
 	c.Redirect(http.StatusFound, redirectURL)
 	return nil
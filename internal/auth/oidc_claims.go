@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+var (
+	usernameTemplate     *template.Template
+	usernameTemplateErr  error
+	usernameTemplateOnce sync.Once
+)
+
+// usernameTemplateFuncs are available to OIDC_USERNAME_TEMPLATE
+var usernameTemplateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	// localpart returns the part of an email address before the @
+	"localpart": func(v interface{}) string {
+		s := claimString(v)
+		if i := strings.Index(s, "@"); i >= 0 {
+			return s[:i]
+		}
+		return s
+	},
+	"replace": strings.ReplaceAll,
+}
+
+// claimString converts a claim value to a string, ignoring lists and objects
+func claimString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []interface{}, map[string]interface{}:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// getUsernameTemplate parses OIDC_USERNAME_TEMPLATE once
+func getUsernameTemplate() (*template.Template, error) {
+	usernameTemplateOnce.Do(func() {
+		tmpl := config.Get("OIDC_USERNAME_TEMPLATE", "")
+		if tmpl == "" {
+			return
+		}
+		usernameTemplate, usernameTemplateErr = template.New("username").
+			Funcs(usernameTemplateFuncs).
+			Option("missingkey=zero").
+			Parse(tmpl)
+		if usernameTemplateErr != nil {
+			logging.Logf("[OIDC] Invalid OIDC_USERNAME_TEMPLATE, falling back to claims: %v", usernameTemplateErr)
+		}
+	})
+	return usernameTemplate, usernameTemplateErr
+}
+
+// oidcUsername derives the username for a login from the raw ID token claims.
+// OIDC_USERNAME_TEMPLATE wins over OIDC_USERNAME_CLAIM; when neither yields a
+// value the default preferred_username, email, sub order is used.
+func oidcUsername(rawClaims map[string]interface{}) string {
+	if tmpl, err := getUsernameTemplate(); tmpl != nil && err == nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, rawClaims); err != nil {
+			oidcDebugLog("Username template failed: %v", err)
+		} else if username := strings.TrimSpace(buf.String()); username != "" && username != "<no value>" {
+			return username
+		}
+	}
+
+	if claim := config.Get("OIDC_USERNAME_CLAIM", ""); claim != "" {
+		if username := strings.TrimSpace(claimString(rawClaims[claim])); username != "" {
+			return username
+		}
+		oidcDebugLog("Username claim %q missing from ID token, using defaults", claim)
+	}
+
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if username := claimString(rawClaims[claim]); username != "" {
+			return username
+		}
+	}
+	return ""
+}
+
+// oidcEmail returns the email for a login, reading OIDC_EMAIL_CLAIM when set
+func oidcEmail(rawClaims map[string]interface{}) string {
+	claim := config.Get("OIDC_EMAIL_CLAIM", "email")
+	if claim == "" {
+		claim = "email"
+	}
+	return strings.TrimSpace(claimString(rawClaims[claim]))
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOIDCErrorRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		successURL string
+		want       string
+	}{
+		{"", "/?oidc_error=invalid_state"},
+		{"/aviary/", "/aviary/?oidc_error=invalid_state"},
+		{"https://example.com/aviary/?tab=login", "https://example.com/aviary/?tab=login&oidc_error=invalid_state"},
+	}
+	for _, tt := range tests {
+		t.Setenv("OIDC_SUCCESS_REDIRECT_URL", tt.successURL)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback", nil)
+
+		oidcErrorRedirect(c, "invalid_state", nil)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != tt.want {
+			t.Errorf("OIDC_SUCCESS_REDIRECT_URL=%q: redirected %d to %q, want %q", tt.successURL, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	secretsBundleFormat  = "aviary-secrets"
+	secretsBundleVersion = 1
+	// minBundlePassphrase is the shortest passphrase a bundle can be
+	// encrypted with. The bundle holds a reMarkable cloud token, so it should
+	// be hard to guess offline.
+	minBundlePassphrase = 12
+)
+
+// secretsBundle is the file a user downloads. Only the format fields and
+// the key derivation parameters are readable; the rest is encrypted.
+type secretsBundle struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// bundleContents is what a bundle carries: the reMarkable pairing and the
+// user's own settings. Admin-managed settings such as quotas are left out.
+type bundleContents struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Username   string    `json:"username"`
+
+	RmapiHost   string `json:"rmapi_host"`
+	RmapiConfig string `json:"rmapi_config"`
+
+	DefaultRmdir             string  `json:"default_rmdir"`
+	CoverpageSetting         string  `json:"coverpage_setting"`
+	ContrastSetting          string  `json:"contrast_setting"`
+	ConflictResolution       string  `json:"conflict_resolution"`
+	FolderDepthLimit         int     `json:"folder_depth_limit"`
+	FolderExclusionList      string  `json:"folder_exclusion_list"`
+	PageResolution           string  `json:"page_resolution"`
+	PageDPI                  float64 `json:"page_dpi"`
+	ConversionOutputFormat   string  `json:"conversion_output_format"`
+	UploadTimeout            int     `json:"upload_timeout"`
+	JobTimeout               int     `json:"job_timeout"`
+	PDFBackgroundRemoval     *bool   `json:"pdf_background_removal"`
+	ExperimentalDownloadLink *bool   `json:"experimental_download_link"`
+	ExtractContent           *bool   `json:"extract_content"`
+
+	DeliveryMethod      string `json:"delivery_method"`
+	DeliveryHost        string `json:"delivery_host"`
+	DeliverySSHUser     string `json:"delivery_ssh_user"`
+	DeliverySSHKey      string `json:"delivery_ssh_key"`
+	DeliverySSHHostKey  string `json:"delivery_ssh_host_key"`
+	DeliveryWindowStart string `json:"delivery_window_start"`
+	DeliveryWindowEnd   string `json:"delivery_window_end"`
+	DeliveryTimezone    string `json:"delivery_timezone"`
+}
+
+// settingsRequest returns the bundle's settings as a profile update
+func (b *bundleContents) settingsRequest() UpdateUserRequest {
+	req := UpdateUserRequest{
+		RmapiHost:                &b.RmapiHost,
+		FolderDepthLimit:         &b.FolderDepthLimit,
+		FolderExclusionList:      &b.FolderExclusionList,
+		PageResolution:           &b.PageResolution,
+		PageDPI:                  &b.PageDPI,
+		ConversionOutputFormat:   &b.ConversionOutputFormat,
+		UploadTimeout:            &b.UploadTimeout,
+		JobTimeout:               &b.JobTimeout,
+		PDFBackgroundRemoval:     b.PDFBackgroundRemoval,
+		ExperimentalDownloadLink: b.ExperimentalDownloadLink,
+		ExtractContent:           b.ExtractContent,
+		// Empty values keep the defaults already in place
+		DefaultRmdir:       &b.DefaultRmdir,
+		CoverpageSetting:   &b.CoverpageSetting,
+		ContrastSetting:    &b.ContrastSetting,
+		ConflictResolution: &b.ConflictResolution,
+	}
+	// Bundles from before delivery windows existed leave the window alone
+	if b.DeliveryWindowStart != "" || b.DeliveryWindowEnd != "" || b.DeliveryTimezone != "" {
+		req.DeliveryWindowStart = &b.DeliveryWindowStart
+		req.DeliveryWindowEnd = &b.DeliveryWindowEnd
+		req.DeliveryTimezone = &b.DeliveryTimezone
+	}
+	return req
+}
+
+// deliveryTarget returns the bundle's offline delivery settings
+func (b *bundleContents) deliveryTarget() delivery.Target {
+	return delivery.Target{
+		Method:     strings.ToLower(strings.TrimSpace(b.DeliveryMethod)),
+		Host:       strings.TrimSpace(b.DeliveryHost),
+		SSHUser:    strings.TrimSpace(b.DeliverySSHUser),
+		SSHKey:     strings.TrimSpace(b.DeliverySSHKey),
+		SSHHostKey: strings.TrimSpace(b.DeliverySSHHostKey),
+	}
+}
+
+// SecretsExportRequest sets the passphrase the bundle is encrypted with
+type SecretsExportRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// SecretsImportRequest carries a bundle and the passphrase it was encrypted
+// with
+type SecretsImportRequest struct {
+	Bundle     json.RawMessage `json:"bundle" binding:"required"`
+	Passphrase string          `json:"passphrase" binding:"required"`
+}
+
+// bundleKey derives the encryption key from a passphrase with scrypt
+func bundleKey(passphrase string, b *secretsBundle) ([]byte, error) {
+	if b.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", b.KDF)
+	}
+	return scrypt.Key([]byte(passphrase), b.Salt, b.N, b.R, b.P, 32)
+}
+
+func bundleCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBundle encrypts contents with a key derived from passphrase
+func sealBundle(contents *bundleContents, passphrase string) (*secretsBundle, error) {
+	plaintext, err := json.Marshal(contents)
+	if err != nil {
+		return nil, err
+	}
+	b := &secretsBundle{
+		Format:  secretsBundleFormat,
+		Version: secretsBundleVersion,
+		KDF:     "scrypt",
+		N:       1 << 15,
+		R:       8,
+		P:       1,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(b.Salt); err != nil {
+		return nil, err
+	}
+	key, err := bundleKey(passphrase, b)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := bundleCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	b.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(b.Nonce); err != nil {
+		return nil, err
+	}
+	// The format fields are authenticated along with the contents
+	b.Ciphertext = aead.Seal(nil, b.Nonce, plaintext, []byte(secretsBundleFormat))
+	return b, nil
+}
+
+// errBundlePassphrase is returned when a bundle can't be decrypted, which
+// is almost always a wrong passphrase
+var errBundlePassphrase = errors.New("wrong passphrase or damaged bundle")
+
+// openBundle decrypts b with passphrase
+func openBundle(b *secretsBundle, passphrase string) (*bundleContents, error) {
+	if b.Format != secretsBundleFormat {
+		return nil, errors.New("not an Aviary secrets bundle")
+	}
+	if b.Version != secretsBundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	// Keep a crafted bundle from making the server spend minutes on scrypt
+	if b.N <= 1 || b.N > 1<<20 || b.R < 1 || b.R > 32 || b.P < 1 || b.P > 16 {
+		return nil, errors.New("unsupported key derivation parameters")
+	}
+	key, err := bundleKey(passphrase, b)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := bundleCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Nonce) != aead.NonceSize() {
+		return nil, errBundlePassphrase
+	}
+	plaintext, err := aead.Open(nil, b.Nonce, b.Ciphertext, []byte(secretsBundleFormat))
+	if err != nil {
+		return nil, errBundlePassphrase
+	}
+	var contents bundleContents
+	if err := json.Unmarshal(plaintext, &contents); err != nil {
+		return nil, errBundlePassphrase
+	}
+	return &contents, nil
+}
+
+// ExportSecretsHandler returns the current user's reMarkable pairing and
+// settings as a bundle encrypted with a passphrase of their choosing, to be
+// imported on another Aviary instance
+func ExportSecretsHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+	// An API key shouldn't be enough to carry the pairing off the server
+	if GetAuthMethod(c) == "api_key" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Secrets can only be exported when signed in"})
+		return
+	}
+
+	var req SecretsExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+	if len(req.Passphrase) < minBundlePassphrase {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Passphrase must be at least %d characters", minBundlePassphrase)})
+		return
+	}
+
+	rmapiConfig, err := rmapi.LoadUserConfig(user.ID)
+	if err != nil {
+		rmapiConfig = ""
+	}
+	bundle, err := sealBundle(&bundleContents{
+		ExportedAt:               time.Now().UTC(),
+		Username:                 user.Username,
+		RmapiHost:                user.RmapiHost,
+		RmapiConfig:              rmapiConfig,
+		DefaultRmdir:             user.DefaultRmdir,
+		CoverpageSetting:         user.CoverpageSetting,
+		ContrastSetting:          user.ContrastSetting,
+		ConflictResolution:       user.ConflictResolution,
+		FolderDepthLimit:         user.FolderDepthLimit,
+		FolderExclusionList:      user.FolderExclusionList,
+		PageResolution:           user.PageResolution,
+		PageDPI:                  user.PageDPI,
+		ConversionOutputFormat:   user.ConversionOutputFormat,
+		UploadTimeout:            user.UploadTimeout,
+		JobTimeout:               user.JobTimeout,
+		PDFBackgroundRemoval:     user.PDFBackgroundRemoval,
+		ExperimentalDownloadLink: user.ExperimentalDownloadLink,
+		ExtractContent:           user.ExtractContent,
+		DeliveryMethod:           user.DeliveryMethod,
+		DeliveryHost:             user.DeliveryHost,
+		DeliverySSHUser:          user.DeliverySSHUser,
+		DeliverySSHKey:           user.DeliverySSHKey,
+		DeliverySSHHostKey:       user.DeliverySSHHostKey,
+		DeliveryWindowStart:      user.DeliveryWindowStart,
+		DeliveryWindowEnd:        user.DeliveryWindowEnd,
+		DeliveryTimezone:         user.DeliveryTimezone,
+	}, req.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export secrets"})
+		return
+	}
+
+	logging.LogfWithUser(user.Username, "[AUDIT] Exported secrets bundle from %s", c.ClientIP())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=aviary-secrets-%s.json", user.Username))
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportSecretsHandler restores a bundle made by ExportSecretsHandler onto the
+// current user, replacing their pairing and settings
+func ImportSecretsHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var req SecretsImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+	var bundle secretsBundle
+	if err := json.Unmarshal(req.Bundle, &bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not an Aviary secrets bundle"})
+		return
+	}
+	contents, err := openBundle(&bundle, req.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Settings are checked the way the profile page checks them, so a
+	// bundle can't carry values the upload pipeline can't use
+	settings := contents.settingsRequest()
+	if err := validateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := unsupportedSettings(c, user, settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "backend_unsupported"})
+		return
+	}
+	updates := map[string]interface{}{}
+	if err := settingsUpdates(user, settings, updates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Offline delivery only carries over to servers that allow it
+	skipped := []string{}
+	if contents.DeliveryMethod != "" {
+		target := contents.deliveryTarget()
+		if err := target.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if delivery.UserDeliveryAllowed() {
+			updates["delivery_method"] = target.Method
+			updates["delivery_host"] = target.Host
+			updates["delivery_ssh_user"] = target.SSHUser
+			updates["delivery_ssh_key"] = target.SSHKey
+			updates["delivery_ssh_host_key"] = target.SSHHostKey
+		} else {
+			skipped = append(skipped, "delivery")
+		}
+	}
+
+	userService := database.NewUserService(database.DB)
+	if err := userService.UpdateUserSettings(user.ID, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import settings"})
+		return
+	}
+
+	paired := contents.RmapiConfig != ""
+	if paired {
+		if err := rmapi.SaveUserConfig(user.ID, contents.RmapiConfig); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import reMarkable pairing"})
+			return
+		}
+		// The cache belongs to the previous pairing
+		rmapi.CleanupUserCache(rmapi.GetUserCachePath(user.ID))
+		database.RecordOnboarding(user.ID, database.OnboardingPairedDevice)
+		if callback := rmapi.GetPostPairingCallback(); callback != nil {
+			go callback(user.ID.String(), false)
+		}
+	}
+
+	logging.LogfWithUser(user.Username, "[AUDIT] Imported secrets bundle exported by %s at %s", contents.Username, contents.ExportedAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, gin.H{"success": true, "paired": paired, "skipped": skipped})
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+)
+
+const testPassphrase = "correct horse battery"
+
+func TestSecretsBundleRoundTrip(t *testing.T) {
+	contents := &bundleContents{Username: "alice", RmapiConfig: "devicetoken: abc", ConflictResolution: "overwrite"}
+	bundle, err := sealBundle(contents, testPassphrase)
+	if err != nil {
+		t.Fatalf("sealBundle: %v", err)
+	}
+
+	got, err := openBundle(bundle, testPassphrase)
+	if err != nil {
+		t.Fatalf("openBundle: %v", err)
+	}
+	if got.Username != "alice" || got.RmapiConfig != "devicetoken: abc" || got.ConflictResolution != "overwrite" {
+		t.Errorf("openBundle = %+v, want %+v", got, contents)
+	}
+	if _, err := openBundle(bundle, "wrong passphrase"); err != errBundlePassphrase {
+		t.Errorf("wrong passphrase: err = %v, want %v", err, errBundlePassphrase)
+	}
+}
+
+func TestImportSecretsRejectsInvalidSettings(t *testing.T) {
+	t.Setenv("MULTI_USER", "true")
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		contents bundleContents
+	}{
+		{"conflict resolution", bundleContents{ConflictResolution: "explode"}},
+		{"cover page", bundleContents{CoverpageSetting: "middle"}},
+		{"contrast", bundleContents{ContrastSetting: "max"}},
+		{"page resolution", bundleContents{PageResolution: "big"}},
+		{"page DPI", bundleContents{PageDPI: -1}},
+		{"output format", bundleContents{ConversionOutputFormat: "docx"}},
+		{"timeout", bundleContents{JobTimeout: -5}},
+		{"delivery window", bundleContents{DeliveryWindowStart: "25:00", DeliveryWindowEnd: "07:00"}},
+		{"delivery method", bundleContents{DeliveryMethod: "carrier-pigeon"}},
+		{"SSH without a key", bundleContents{DeliveryMethod: "ssh", DeliveryHost: "10.11.99.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := sealBundle(&tt.contents, testPassphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := json.Marshal(bundle)
+			body, _ := json.Marshal(SecretsImportRequest{Bundle: raw, Passphrase: testPassphrase})
+
+			// database.DB is unset, so reaching the update would panic
+			router := gin.New()
+			router.POST("/import", func(c *gin.Context) {
+				c.Set("user", &database.User{ID: uuid.New(), Username: "alice"})
+				ImportSecretsHandler(c)
+			})
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/import", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400 (%s)", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidateSettingsAcceptsProfileValues(t *testing.T) {
+	overwrite, resolution, dpi, format := "overwrite", "1620x2160", 229.0, "epub"
+	req := UpdateUserRequest{ConflictResolution: &overwrite, PageResolution: &resolution, PageDPI: &dpi, ConversionOutputFormat: &format}
+	if err := validateSettings(req); err != nil {
+		t.Errorf("validateSettings = %v, want nil", err)
+	}
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/sendto"
+	"github.com/rmitchellscott/aviary/internal/smtp"
+)
+
+// maxSendTargets caps how many "also send to" targets a user can add
+const maxSendTargets = 10
+
+// SendTargetRequest creates or updates an "also send to" target
+type SendTargetRequest struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind" binding:"required"`
+	Address string `json:"address" binding:"required"`
+	Formats string `json:"formats"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// getSendTarget loads one of the current user's targets, responding 404 if
+// it doesn't exist
+func getSendTarget(c *gin.Context, userID uuid.UUID) (*database.SendTarget, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target ID"})
+		return nil, false
+	}
+	var target database.SendTarget
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&target).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target not found"})
+		return nil, false
+	}
+	return &target, true
+}
+
+// GetSendTargetsHandler lists the current user's "also send to" targets and
+// which kinds the server supports
+func GetSendTargetsHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var targets []database.SendTarget
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&targets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get targets"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"targets":         targets,
+		"email_enabled":   smtp.IsSMTPConfigured(),
+		"folders_enabled": sendto.FoldersEnabled(),
+	})
+}
+
+// CreateSendTargetHandler adds an "also send to" target for the current user
+func CreateSendTargetHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var req SendTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&database.SendTarget{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target"})
+		return
+	}
+	if count >= maxSendTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many targets"})
+		return
+	}
+
+	target := database.SendTarget{
+		UserID:  user.ID,
+		Name:    req.Name,
+		Kind:    req.Kind,
+		Address: req.Address,
+		Formats: req.Formats,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if err := sendto.Normalize(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target"})
+		return
+	}
+
+	logging.Logf("[AUTH] User %s added %s target %s", user.Username, target.Kind, target.Name)
+	c.JSON(http.StatusCreated, target)
+}
+
+// UpdateSendTargetHandler replaces one of the current user's targets
+func UpdateSendTargetHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	target, ok := getSendTarget(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req SendTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+
+	target.Name = req.Name
+	target.Kind = req.Kind
+	target.Address = req.Address
+	target.Formats = req.Formats
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+	if err := sendto.Normalize(target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Save(target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update target"})
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteSendTargetHandler removes one of the current user's targets
+func DeleteSendTargetHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	target, ok := getSendTarget(c, user.ID)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete target"})
+		return
+	}
+
+	logging.Logf("[AUTH] User %s removed %s target %s", user.Username, target.Kind, target.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// TestSendTargetHandler sends a short text document to one of the current
+// user's targets
+func TestSendTargetHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	target, ok := getSendTarget(c, user.ID)
+	if !ok {
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "aviary-sendto-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create test document"})
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Aviary test.txt")
+	if err := os.WriteFile(path, []byte("This is a test document from Aviary.\n"), 0600); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create test document"})
+		return
+	}
+
+	if err := sendto.Send(*target, path); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
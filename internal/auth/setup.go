@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+	"github.com/rmitchellscott/aviary/internal/smtp"
+	"github.com/rmitchellscott/aviary/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SetupCompletedSettingKey records whether the setup wizard has finished.
+// It's unset on installs that never used the wizard, which count as set up
+// once they have a user.
+const SetupCompletedSettingKey = "setup_completed"
+
+// storageSettingKeys map the storage variables the wizard can save to their
+// system settings
+var storageSettingKeys = map[string]string{
+	"STORAGE_BACKEND":      "storage_backend",
+	"S3_ENDPOINT":          "s3_endpoint",
+	"S3_REGION":            "s3_region",
+	"S3_BUCKET":            "s3_bucket",
+	"S3_ACCESS_KEY_ID":     "s3_access_key_id",
+	"S3_SECRET_ACCESS_KEY": "s3_secret_access_key",
+	"S3_FORCE_PATH_STYLE":  "s3_force_path_style",
+}
+
+// secretSettingKeys are system settings that are never returned by the API
+var secretSettingKeys = map[string]bool{
+	"smtp_password":        true,
+	"s3_secret_access_key": true,
+}
+
+// setupCheckTimeout bounds the storage and reMarkable cloud checks
+const setupCheckTimeout = 30 * time.Second
+
+// setupAdminMu keeps two requests from both creating the first admin
+var setupAdminMu sync.Mutex
+
+// SetupComplete reports whether the setup wizard is finished or was never
+// needed. Single-user installs have nothing to set up.
+func SetupComplete() bool {
+	if !database.IsMultiUserMode() {
+		return true
+	}
+	if value, err := database.GetSystemSetting(SetupCompletedSettingKey); err == nil && value != "" {
+		return value == "true"
+	}
+	var userCount int64
+	database.DB.Model(&database.User{}).Count(&userCount)
+	return userCount > 0
+}
+
+// ApplyStoredStorage switches to the storage backend chosen in the setup
+// wizard. STORAGE_BACKEND in the environment always wins.
+func ApplyStoredStorage() {
+	if !database.IsMultiUserMode() || config.Get("STORAGE_BACKEND", "") != "" {
+		return
+	}
+	backend, err := database.GetSystemSetting(storageSettingKeys["STORAGE_BACKEND"])
+	if err != nil || backend == "" {
+		return
+	}
+	cfg := storage.GetStorageConfig()
+	cfg.Backend = backend
+	cfg.S3Endpoint = storedStorageSetting("S3_ENDPOINT", cfg.S3Endpoint)
+	cfg.S3Region = storedStorageSetting("S3_REGION", cfg.S3Region)
+	cfg.S3Bucket = storedStorageSetting("S3_BUCKET", cfg.S3Bucket)
+	cfg.S3AccessKeyID = storedStorageSetting("S3_ACCESS_KEY_ID", cfg.S3AccessKeyID)
+	cfg.S3SecretKey = storedStorageSetting("S3_SECRET_ACCESS_KEY", cfg.S3SecretKey)
+	cfg.S3ForcePathStyle = storedStorageSetting("S3_FORCE_PATH_STYLE", strconv.FormatBool(cfg.S3ForcePathStyle)) == "true"
+	if err := storage.ConfigureStorage(cfg); err != nil {
+		logging.Logf("[SETUP] Failed to use the %s storage chosen during setup: %v", backend, err)
+	}
+}
+
+func storedStorageSetting(key, def string) string {
+	if value, err := database.GetSystemSetting(storageSettingKeys[key]); err == nil && value != "" {
+		return value
+	}
+	return def
+}
+
+// requireSetupOpen rejects the request once setup is complete
+func requireSetupOpen(c *gin.Context) bool {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Setup not available in single-user mode"})
+		return false
+	}
+	if SetupComplete() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Setup has already been completed"})
+		return false
+	}
+	return true
+}
+
+// requireSetupAdmin rejects the request once setup is complete or when the
+// caller isn't an admin
+func requireSetupAdmin(c *gin.Context) (*database.User, bool) {
+	if !requireSetupOpen(c) {
+		return nil, false
+	}
+	return RequireAdmin(c)
+}
+
+// GetSetupStatusHandler reports whether setup is needed and which steps are
+// done (public endpoint)
+func GetSetupStatusHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() || SetupComplete() {
+		c.JSON(http.StatusOK, gin.H{"required": false, "completed": true})
+		return
+	}
+
+	var userCount int64
+	if err := database.DB.Model(&database.User{}).Count(&userCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user count"})
+		return
+	}
+
+	steps := gin.H{"admin": userCount > 0}
+	// The rest is only shown to the admin finishing setup
+	if user := GetCurrentUser(c); user != nil && user.IsAdmin {
+		steps["smtp"] = smtp.IsSMTPConfigured()
+		steps["rmapi"] = rmapi.IsUserPaired(user.ID)
+		steps["storage"] = storage.GetStorageType()
+		steps["storage_from_env"] = config.Get("STORAGE_BACKEND", "") != ""
+		steps["smtp_from_env"] = config.Get("SMTP_HOST", "") != ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"required":  true,
+		"completed": false,
+		"steps":     steps,
+	})
+}
+
+// SetupAdminHandler creates the first admin account and signs them in. It
+// only works while there are no users.
+func SetupAdminHandler(c *gin.Context) {
+	if !requireSetupOpen(c) {
+		return
+	}
+	setupAdminMu.Lock()
+	defer setupAdminMu.Unlock()
+
+	var userCount int64
+	if err := database.DB.Model(&database.User{}).Count(&userCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user count"})
+		return
+	}
+	if userCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An admin account already exists"})
+		return
+	}
+
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if err := ValidateNewUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	admin, err := userService.CreateUser(req.Username, req.Email, req.Password, true)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			c.JSON(http.StatusConflict, gin.H{"error": "User with this username or email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	// Keep the wizard open for the remaining steps now that a user exists
+	if err := database.SetSystemSetting(SetupCompletedSettingKey, "false", &admin.ID); err != nil {
+		logging.Logf("[SETUP] Failed to record setup progress: %v", err)
+	}
+	logging.Logf("[SETUP] Admin user created: %s (ID: %s)", admin.Username, admin.ID)
+
+	go func() {
+		if err := database.MigrateSingleUserData(admin.ID); err != nil {
+			logging.Logf("[WARNING] failed to migrate single-user data: %v", err)
+		}
+	}()
+
+	if err := startSetupSession(c, admin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "backend.auth.token_error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"user":    userToResponse(admin),
+	})
+}
+
+// startSetupSession signs in the admin created by the wizard
+func startSetupSession(c *gin.Context, user *database.User) error {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":  user.ID.String(),
+		"username": user.Username,
+		"is_admin": user.IsAdmin,
+		"exp":      time.Now().Add(sessionTimeout).Unix(),
+		"iat":      time.Now().Unix(),
+	})
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return err
+	}
+
+	secure := !allowInsecure()
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("auth_token", tokenString, int(sessionTimeout.Seconds()), "/", "", secure, true)
+
+	sessionHash, _ := bcrypt.GenerateFromPassword([]byte(tokenString), bcrypt.DefaultCost)
+	database.DB.Create(&database.UserSession{
+		UserID:    user.ID,
+		TokenHash: string(sessionHash),
+		ExpiresAt: time.Now().Add(sessionTimeout),
+		UserAgent: c.GetHeader("User-Agent"),
+		IPAddress: c.ClientIP(),
+	})
+	return nil
+}
+
+// SetupSMTPHandler saves SMTP settings and checks that they work
+func SetupSMTPHandler(c *gin.Context) {
+	user, ok := requireSetupAdmin(c)
+	if !ok {
+		return
+	}
+	if config.Get("SMTP_HOST", "") != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "SMTP is configured by environment variables"})
+		return
+	}
+
+	var req struct {
+		Host     string `json:"host" binding:"required"`
+		Port     int    `json:"port"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		From     string `json:"from" binding:"required"`
+		TLS      *bool  `json:"tls"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+		return
+	}
+	if req.Port == 0 {
+		req.Port = 587
+	}
+	useTLS := req.TLS == nil || *req.TLS
+
+	settings := map[string]string{
+		"smtp_host":     req.Host,
+		"smtp_port":     strconv.Itoa(req.Port),
+		"smtp_username": req.Username,
+		"smtp_password": req.Password,
+		"smtp_from":     req.From,
+		"smtp_tls":      strconv.FormatBool(useTLS),
+		"smtp_enabled":  "true",
+	}
+	for key, value := range settings {
+		if err := database.SetSystemSetting(key, value, &user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
+			return
+		}
+	}
+
+	if err := smtp.TestSMTPConnection(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"error":   "SMTP connection failed: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "SMTP connection successful",
+	})
+}
+
+// SetupRmapiTestHandler checks that the admin's reMarkable pairing works by
+// listing their cloud's root folder. Pairing itself uses /api/profile/pair.
+func SetupRmapiTestHandler(c *gin.Context) {
+	user, ok := requireSetupAdmin(c)
+	if !ok {
+		return
+	}
+	if !rmapi.IsUserPaired(user.ID) {
+		c.JSON(http.StatusOK, gin.H{"success": false, "paired": false})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), setupCheckTimeout)
+	defer cancel()
+	proc, cleanup := rmapi.NewCommand(user, "ls", "/")
+	defer cleanup()
+	done := make(chan error, 1)
+	go func() { done <- proc.Run() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		if proc.Process != nil {
+			proc.Process.Kill()
+		}
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"paired":  true,
+			"error":   "reMarkable cloud check failed: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "paired": true})
+}
+
+// SetupStorageHandler checks a storage backend with a test write, switches to
+// it and saves it for future starts
+func SetupStorageHandler(c *gin.Context) {
+	user, ok := requireSetupAdmin(c)
+	if !ok {
+		return
+	}
+	if config.Get("STORAGE_BACKEND", "") != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Storage is configured by environment variables"})
+		return
+	}
+
+	var req struct {
+		Backend          string `json:"backend" binding:"required,oneof=filesystem s3"`
+		S3Endpoint       string `json:"s3_endpoint"`
+		S3Region         string `json:"s3_region"`
+		S3Bucket         string `json:"s3_bucket"`
+		S3AccessKeyID    string `json:"s3_access_key_id"`
+		S3SecretKey      string `json:"s3_secret_access_key"`
+		S3ForcePathStyle bool   `json:"s3_force_path_style"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+		return
+	}
+
+	cfg := storage.GetStorageConfig()
+	cfg.Backend = req.Backend
+	if req.Backend == "s3" {
+		cfg.S3Endpoint = req.S3Endpoint
+		if req.S3Region != "" {
+			cfg.S3Region = req.S3Region
+		}
+		cfg.S3Bucket = req.S3Bucket
+		cfg.S3AccessKeyID = req.S3AccessKeyID
+		cfg.S3SecretKey = req.S3SecretKey
+		cfg.S3ForcePathStyle = req.S3ForcePathStyle
+	}
+
+	backend, err := storage.NewBackend(cfg)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), setupCheckTimeout)
+		defer cancel()
+		key := ".aviary-setup-check"
+		if err = backend.Put(ctx, key, strings.NewReader(time.Now().UTC().Format(time.RFC3339))); err == nil {
+			err = backend.Delete(ctx, key)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Storage check failed: " + err.Error()})
+		return
+	}
+
+	settings := map[string]string{
+		"STORAGE_BACKEND":      cfg.Backend,
+		"S3_ENDPOINT":          cfg.S3Endpoint,
+		"S3_REGION":            cfg.S3Region,
+		"S3_BUCKET":            cfg.S3Bucket,
+		"S3_ACCESS_KEY_ID":     cfg.S3AccessKeyID,
+		"S3_SECRET_ACCESS_KEY": cfg.S3SecretKey,
+		"S3_FORCE_PATH_STYLE":  strconv.FormatBool(cfg.S3ForcePathStyle),
+	}
+	for key, value := range settings {
+		if err := database.SetSystemSetting(storageSettingKeys[key], value, &user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
+			return
+		}
+	}
+	if err := storage.ConfigureStorage(cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch storage: " + err.Error()})
+		return
+	}
+	logging.LogfWithUser(user.Username, "[SETUP] Storage set to %s", cfg.Backend)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "backend": cfg.Backend})
+}
+
+// SetupCompleteHandler finishes setup, after which every /api/setup change
+// is rejected
+func SetupCompleteHandler(c *gin.Context) {
+	user, ok := requireSetupAdmin(c)
+	if !ok {
+		return
+	}
+	if err := database.SetSystemSetting(SetupCompletedSettingKey, "true", &user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
+		return
+	}
+	logging.LogfWithUser(user.Username, "[SETUP] Setup completed")
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/database"
+)
+
+// setupTestDB points database.DB at a fresh multi-user SQLite database
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("SMTP_HOST", "")
+
+	orig := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = orig
+	})
+}
+
+// setupRouter serves the setup endpoints as the user held in *current
+func setupRouter(current **database.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if *current != nil {
+			c.Set("user", *current)
+		}
+	})
+	r.GET("/api/setup", GetSetupStatusHandler)
+	r.POST("/api/setup/admin", SetupAdminHandler)
+	r.PUT("/api/setup/storage", SetupStorageHandler)
+	r.POST("/api/setup/complete", SetupCompleteHandler)
+	return r
+}
+
+func setupRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func setupStatus(t *testing.T, r *gin.Engine) (required bool, steps map[string]interface{}) {
+	t.Helper()
+	w := setupRequest(r, http.MethodGet, "/api/setup", "")
+	var resp struct {
+		Required bool                   `json:"required"`
+		Steps    map[string]interface{} `json:"steps"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("setup status %d: %s", w.Code, w.Body)
+	}
+	return resp.Required, resp.Steps
+}
+
+func TestSetupWizard(t *testing.T) {
+	setupTestDB(t)
+	var current *database.User
+	r := setupRouter(&current)
+
+	if required, steps := setupStatus(t, r); !required || steps["admin"] != false {
+		t.Fatalf("fresh install: required = %v, steps = %v, want the admin step open", required, steps)
+	}
+
+	if w := setupRequest(r, http.MethodPost, "/api/setup/admin", `{"username":"admin","email":"admin@example.com","password":"short"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("admin with a short password: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w := setupRequest(r, http.MethodPost, "/api/setup/admin", `{"username":"admin","email":"admin@example.com","password":"correct-horse"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create admin: status = %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Header().Get("Set-Cookie"), "auth_token=") {
+		t.Error("creating the admin didn't sign them in")
+	}
+	if w := setupRequest(r, http.MethodPost, "/api/setup/admin", `{"username":"second","email":"second@example.com","password":"correct-horse"}`); w.Code != http.StatusConflict {
+		t.Errorf("second admin: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// A user now exists, but the wizard stays open for the admin
+	admin, err := database.GetUserByUsername("admin")
+	if err != nil || !admin.IsAdmin {
+		t.Fatalf("admin user = %+v, %v", admin, err)
+	}
+	if SetupComplete() {
+		t.Fatal("setup complete after only creating the admin")
+	}
+	if _, steps := setupStatus(t, r); steps["admin"] != true || steps["storage"] != nil {
+		t.Errorf("anonymous steps = %v, want only the admin step", steps)
+	}
+	current = admin
+	if _, steps := setupStatus(t, r); steps["storage"] == nil || steps["smtp"] == nil {
+		t.Errorf("admin steps = %v, want every step", steps)
+	}
+
+	current = &database.User{Username: "someone", IsAdmin: false}
+	if w := setupRequest(r, http.MethodPost, "/api/setup/complete", ""); w.Code != http.StatusForbidden {
+		t.Errorf("complete as a non-admin: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	current = admin
+
+	if w := setupRequest(r, http.MethodPut, "/api/setup/storage", `{"backend":"ftp"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown storage backend: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := setupRequest(r, http.MethodPut, "/api/setup/storage", `{"backend":"filesystem"}`); w.Code != http.StatusOK {
+		t.Errorf("filesystem storage: status = %d: %s", w.Code, w.Body)
+	}
+	if backend, err := database.GetSystemSetting("storage_backend"); err != nil || backend != "filesystem" {
+		t.Errorf("stored storage backend = %q, %v", backend, err)
+	}
+	t.Setenv("STORAGE_BACKEND", "filesystem")
+	if w := setupRequest(r, http.MethodPut, "/api/setup/storage", `{"backend":"filesystem"}`); w.Code != http.StatusConflict {
+		t.Errorf("storage set by the environment: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	if w := setupRequest(r, http.MethodPost, "/api/setup/complete", ""); w.Code != http.StatusOK {
+		t.Fatalf("complete: status = %d: %s", w.Code, w.Body)
+	}
+	if !SetupComplete() {
+		t.Error("setup not complete after finishing the wizard")
+	}
+	if required, _ := setupStatus(t, r); required {
+		t.Error("setup still required after finishing the wizard")
+	}
+	for _, path := range []string{"/api/setup/admin", "/api/setup/complete"} {
+		if w := setupRequest(r, http.MethodPost, path, `{}`); w.Code != http.StatusForbidden {
+			t.Errorf("POST %s after setup: status = %d, want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestSetupCompleteForExistingInstalls(t *testing.T) {
+	setupTestDB(t)
+	if SetupComplete() {
+		t.Error("an install without users is set up")
+	}
+
+	// Installs that never used the wizard are set up once they have a user
+	userService := database.NewUserService(database.DB)
+	if _, err := userService.CreateUser("admin", "admin@example.com", "correct-horse", true); err != nil {
+		t.Fatal(err)
+	}
+	if !SetupComplete() {
+		t.Error("an install with users but no wizard setting isn't set up")
+	}
+
+	t.Setenv("MULTI_USER", "false")
+	var current *database.User
+	r := setupRouter(&current)
+	if required, _ := setupStatus(t, r); required {
+		t.Error("single-user mode requires setup")
+	}
+	if w := setupRequest(r, http.MethodPost, "/api/setup/admin", `{}`); w.Code != http.StatusNotFound {
+		t.Errorf("setup admin in single-user mode: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
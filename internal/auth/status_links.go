@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const statusLinkAudience = "aviary-status"
+
+// SignStatusToken returns a token granting read-only access to a single job's
+// status until it expires
+func SignStatusToken(jobID string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"job_id": jobID,
+		"exp":    expiresAt.Unix(),
+		"iat":    time.Now().Unix(),
+		"iss":    "aviary",
+		"aud":    statusLinkAudience,
+	})
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// VerifyStatusToken checks that tokenString was issued for jobID and has not expired
+func VerifyStatusToken(jobID, tokenString string) error {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwtSecret, nil
+	}, jwt.WithAudience(statusLinkAudience), jwt.WithIssuer("aviary"))
+	if err != nil || !token.Valid {
+		return errors.New("invalid or expired status token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["job_id"] != jobID {
+		return errors.New("status token does not match job")
+	}
+	return nil
+}
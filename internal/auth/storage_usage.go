@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// GetStorageUsageHandler reports how much space the local storage backend
+// takes up, overall and per user, and how close it is to
+// LOCAL_STORAGE_LIMIT_MB (admin only). The storage is measured again on
+// each request.
+func GetStorageUsageHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Storage usage not available in single-user mode"})
+		return
+	}
+
+	if _, ok := RequireAdmin(c); !ok {
+		return
+	}
+
+	usage, err := storage.RefreshUsage(context.Background())
+	if err != nil {
+		logging.Logf("[STORAGE] Failed to measure storage usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to measure storage usage"})
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(usage.Users))
+	for _, u := range usage.Users {
+		ids = append(ids, u.UserID)
+	}
+	if len(ids) > 0 {
+		var users []database.User
+		database.DB.Select("id", "username").Where("id IN ?", ids).Find(&users)
+		names := make(map[uuid.UUID]string, len(users))
+		for _, u := range users {
+			names[u.ID] = u.Username
+		}
+		for i := range usage.Users {
+			usage.Users[i].Username = names[usage.Users[i].UserID]
+		}
+	}
+	c.JSON(http.StatusOK, usage)
+}
@@ -1,13 +1,22 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/contentpolicy"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/i18n"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+	"github.com/rmitchellscott/aviary/internal/smtp"
 )
 
 
@@ -25,11 +34,234 @@ type UpdateUserRequest struct {
 	PageResolution         *string  `json:"page_resolution,omitempty"`
 	PageDPI                *float64 `json:"page_dpi,omitempty"`
 	ConversionOutputFormat *string  `json:"conversion_output_format,omitempty"`
+	UploadTimeout          *int     `json:"upload_timeout,omitempty" binding:"omitempty,min=0"` // Seconds; 0 uses the server default
+	JobTimeout             *int     `json:"job_timeout,omitempty" binding:"omitempty,min=0"`
+	StorageQuotaMB         *int     `json:"storage_quota_mb,omitempty" binding:"omitempty,min=0"` // Admin only; 0 means unlimited
+	UploadQuota            *int     `json:"upload_quota,omitempty" binding:"omitempty,min=0"`
+	MaxUploadMB            *int     `json:"max_upload_mb,omitempty" binding:"omitempty,min=0"` // 0 uses the max_upload_mb setting
+	BlockedContentTypes    *string  `json:"blocked_content_types,omitempty"`                   // Admin only; "" uses the blocked_content_types setting
 	IsAdmin                *bool    `json:"is_admin,omitempty"`
 	IsActive               *bool    `json:"is_active,omitempty"`
+	// Delivery window (HH:MM); set both times to "" to deliver at any time
+	DeliveryWindowStart *string `json:"delivery_window_start,omitempty"`
+	DeliveryWindowEnd   *string `json:"delivery_window_end,omitempty"`
+	DeliveryTimezone    *string `json:"delivery_timezone,omitempty"`
 	// PDF processing
 	PDFBackgroundRemoval *bool `json:"pdf_background_removal,omitempty"`
 	ExperimentalDownloadLink *bool `json:"experimental_download_link,omitempty"`
+	ExtractContent *bool `json:"extract_content,omitempty"`
+	// Language emails are written in; "" uses DEFAULT_LANGUAGE
+	Language *string `json:"language,omitempty"`
+}
+
+// languageUpdate validates the language in req and adds it to updates
+func languageUpdate(req UpdateUserRequest, updates map[string]interface{}) error {
+	if req.Language == nil {
+		return nil
+	}
+	lang := strings.TrimSpace(*req.Language)
+	if lang != "" && !i18n.Supported(lang) {
+		return fmt.Errorf("unsupported language %q", lang)
+	}
+	updates["language"] = lang
+	return nil
+}
+
+// deliveryWindowUpdates validates the delivery window user will have after
+// req is applied and adds any changed fields to updates
+func deliveryWindowUpdates(user *database.User, req UpdateUserRequest, updates map[string]interface{}) error {
+	if req.DeliveryWindowStart == nil && req.DeliveryWindowEnd == nil && req.DeliveryTimezone == nil {
+		return nil
+	}
+	start, end, tz := user.DeliveryWindowStart, user.DeliveryWindowEnd, user.DeliveryTimezone
+	if req.DeliveryWindowStart != nil {
+		start = strings.TrimSpace(*req.DeliveryWindowStart)
+	}
+	if req.DeliveryWindowEnd != nil {
+		end = strings.TrimSpace(*req.DeliveryWindowEnd)
+	}
+	if req.DeliveryTimezone != nil {
+		tz = strings.TrimSpace(*req.DeliveryTimezone)
+	}
+	if _, err := delivery.ParseWindow(start, end, tz); err != nil {
+		return err
+	}
+	updates["delivery_window_start"] = start
+	updates["delivery_window_end"] = end
+	updates["delivery_timezone"] = tz
+	return nil
+}
+
+// unsupportedSettings returns an error when the conflict resolution or cover
+// page setting in req can't be honored by the reMarkable cloud host the user
+// will upload to after the update
+func unsupportedSettings(c *gin.Context, user *database.User, req UpdateUserRequest) error {
+	host, conflictResolution, coverpage := user.RmapiHost, user.ConflictResolution, user.CoverpageSetting
+	if req.RmapiHost != nil {
+		host = *req.RmapiHost
+	}
+	if req.ConflictResolution != nil && *req.ConflictResolution != "" {
+		conflictResolution = *req.ConflictResolution
+	}
+	if req.CoverpageSetting != nil && *req.CoverpageSetting != "" {
+		coverpage = *req.CoverpageSetting
+	}
+	if conflictResolution != "content_only" && coverpage != "first" {
+		return nil
+	}
+	return rmapi.GetCapabilities(c.Request.Context(), host).Check(conflictResolution, coverpage)
+}
+
+// settingValues lists the accepted values of the settings that take one of a
+// few keywords. An empty value keeps the current setting.
+var settingValues = map[string][]string{
+	"coverpage_setting":        {"current", "first"},
+	"contrast_setting":         {"none", "off", "fullpage", "adaptive"},
+	"conflict_resolution":      {"abort", "overwrite", "content_only"},
+	"conversion_output_format": {"pdf", "epub"},
+}
+
+// validateSettings returns an error when a setting in req has a value the
+// upload pipeline can't use
+func validateSettings(req UpdateUserRequest) error {
+	for column, value := range map[string]*string{
+		"coverpage_setting":        req.CoverpageSetting,
+		"contrast_setting":         req.ContrastSetting,
+		"conflict_resolution":      req.ConflictResolution,
+		"conversion_output_format": req.ConversionOutputFormat,
+	} {
+		if value != nil && *value != "" && !slices.Contains(settingValues[column], *value) {
+			return fmt.Errorf("invalid %s %q", column, *value)
+		}
+	}
+	if req.PageResolution != nil && *req.PageResolution != "" && !validPageResolution(*req.PageResolution) {
+		return fmt.Errorf("invalid page_resolution %q, expected WIDTHxHEIGHT", *req.PageResolution)
+	}
+	if req.PageDPI != nil && (*req.PageDPI < 0 || *req.PageDPI > 1200) {
+		return fmt.Errorf("page_dpi must be between 0 and 1200")
+	}
+	if req.FolderDepthLimit != nil && *req.FolderDepthLimit < 0 {
+		return fmt.Errorf("folder_depth_limit must not be negative")
+	}
+	if (req.UploadTimeout != nil && *req.UploadTimeout < 0) || (req.JobTimeout != nil && *req.JobTimeout < 0) {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	return nil
+}
+
+// validPageResolution reports whether s is a page size in pixels, such as
+// 1404x1872
+func validPageResolution(s string) bool {
+	width, height, ok := strings.Cut(s, "x")
+	if !ok {
+		return false
+	}
+	w, err := strconv.Atoi(width)
+	if err != nil || w <= 0 || w > 10000 {
+		return false
+	}
+	h, err := strconv.Atoi(height)
+	return err == nil && h > 0 && h <= 10000
+}
+
+// settingsUpdates adds the user's own settings in req to updates, validating
+// the delivery window and language. Imported bundles go through it too.
+func settingsUpdates(user *database.User, req UpdateUserRequest, updates map[string]interface{}) error {
+	if req.RmapiHost != nil {
+		updates["rmapi_host"] = *req.RmapiHost // Allow clearing by setting to empty string
+	}
+
+	if req.DefaultRmdir != nil && *req.DefaultRmdir != "" {
+		updates["default_rmdir"] = *req.DefaultRmdir
+	}
+
+	if req.CoverpageSetting != nil && *req.CoverpageSetting != "" {
+		updates["coverpage_setting"] = *req.CoverpageSetting
+	}
+
+	if req.ContrastSetting != nil && *req.ContrastSetting != "" {
+		updates["contrast_setting"] = *req.ContrastSetting
+	}
+
+	if req.ConflictResolution != nil && *req.ConflictResolution != "" {
+		updates["conflict_resolution"] = *req.ConflictResolution
+	}
+
+	if req.FolderDepthLimit != nil {
+		updates["folder_depth_limit"] = *req.FolderDepthLimit
+	}
+
+	if req.FolderExclusionList != nil {
+		updates["folder_exclusion_list"] = *req.FolderExclusionList // Allow clearing by setting to empty string
+	}
+
+	if req.PageResolution != nil {
+		updates["page_resolution"] = *req.PageResolution // Allow clearing by setting to empty string
+	}
+
+	if req.PageDPI != nil {
+		updates["page_dpi"] = *req.PageDPI // Allow clearing by setting to 0
+	}
+
+	if req.ConversionOutputFormat != nil {
+		updates["conversion_output_format"] = *req.ConversionOutputFormat // Allow clearing by setting to empty string
+	}
+
+	if req.UploadTimeout != nil {
+		updates["upload_timeout"] = *req.UploadTimeout // Allow clearing by setting to 0
+	}
+
+	if req.JobTimeout != nil {
+		updates["job_timeout"] = *req.JobTimeout // Allow clearing by setting to 0
+	}
+
+	if req.PDFBackgroundRemoval != nil {
+		updates["pdf_background_removal"] = *req.PDFBackgroundRemoval
+	}
+
+	if req.ExperimentalDownloadLink != nil {
+		updates["experimental_download_link"] = *req.ExperimentalDownloadLink
+	}
+
+	if req.ExtractContent != nil {
+		updates["extract_content"] = *req.ExtractContent
+	}
+
+	if err := deliveryWindowUpdates(user, req, updates); err != nil {
+		return err
+	}
+
+	return languageUpdate(req, updates)
+}
+
+// CreateUserRequest represents an admin request to create a user directly
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Email    string `json:"email" binding:"required,email"`
+	// Password is optional when SendInvite is set; the user then picks one
+	// through the emailed link
+	Password      string  `json:"password" binding:"omitempty,min=8"`
+	SendInvite    bool    `json:"send_invite"`
+	Role          string  `json:"role" binding:"omitempty,oneof=user admin"`
+	DefaultRmdir  string  `json:"default_rmdir"`
+	DeviceProfile string  `json:"device_profile"`
+	RmapiHost     *string `json:"rmapi_host,omitempty"`
+	// PairingCode is a one-time code from my.remarkable.com to pair the new
+	// account on the user's behalf
+	PairingCode string `json:"pairing_code"`
+}
+
+// deviceProfile is the page size documents are converted at for a tablet model
+type deviceProfile struct {
+	Resolution string
+	DPI        float64
+}
+
+// deviceProfiles match the device presets offered in user settings
+var deviceProfiles = map[string]deviceProfile{
+	"remarkable_1_2":            {Resolution: "1404x1872", DPI: 226},
+	"remarkable_paper_pro":      {Resolution: "1620x2160", DPI: 229},
+	"remarkable_paper_pro_move": {Resolution: "954x1696", DPI: 264},
 }
 
 // UpdatePasswordRequest represents a password update request
@@ -164,6 +396,132 @@ func GetUserHandler(c *gin.Context) {
 	})
 }
 
+// CreateUserHandler creates a user with initial settings, optionally emailing
+// them an invitation to set their password and pairing their tablet (admin only)
+func CreateUserHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	currentUser, ok := RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErrorMessage(err)})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if err := ValidateNewUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Password == "" && !req.SendInvite {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A password or send_invite is required"})
+		return
+	}
+	if req.SendInvite && !smtp.IsSMTPConfigured() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitations require SMTP to be configured"})
+		return
+	}
+
+	var profile deviceProfile
+	if req.DeviceProfile != "" {
+		p, ok := deviceProfiles[req.DeviceProfile]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown device profile"})
+			return
+		}
+		profile = p
+	}
+
+	// Invited users get a random password they never see until they set their own
+	password := req.Password
+	if password == "" {
+		token, err := generateSecureToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+		password = token
+	}
+
+	userService := database.NewUserService(database.DB)
+	newUser, err := userService.CreateUser(req.Username, req.Email, password, req.Role == "admin")
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			c.JSON(http.StatusConflict, gin.H{"error": "User with this username or email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if rmdir := strings.TrimSpace(req.DefaultRmdir); rmdir != "" {
+		updates["default_rmdir"] = rmdir
+	}
+	if req.DeviceProfile != "" {
+		updates["page_resolution"] = profile.Resolution
+		updates["page_dpi"] = profile.DPI
+	}
+	if req.RmapiHost != nil {
+		updates["rmapi_host"] = strings.TrimSpace(*req.RmapiHost)
+	}
+	if len(updates) > 0 {
+		if err := userService.UpdateUserSettings(newUser.ID, updates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User created but initial settings could not be saved"})
+			return
+		}
+		if updated, err := userService.GetUserByID(newUser.ID); err == nil {
+			newUser = updated
+		}
+	}
+
+	inviteSent := false
+	if req.SendInvite {
+		token, err := userService.GeneratePasswordResetToken(newUser.Email)
+		if err == nil {
+			err = smtp.SendInviteEmail(newUser.Email, newUser.Username, token, newUser.Language)
+		}
+		if err != nil {
+			logging.Logf("[AUTH] Failed to send invitation to %s: %v", newUser.Username, err)
+		} else {
+			inviteSent = true
+		}
+	} else if smtp.IsSMTPConfigured() && !config.GetBool("DISABLE_WELCOME_EMAIL", false) {
+		if err := smtp.SendWelcomeEmail(newUser.Email, newUser.Username, newUser.Language); err != nil {
+			logging.Logf("[AUTH] Failed to send welcome email to %s: %v", newUser.Username, err)
+		}
+	}
+
+	resp := gin.H{
+		"success":     true,
+		"user":        userToResponse(newUser),
+		"invite_sent": inviteSent,
+	}
+
+	// A failed pairing leaves the account in place; the user can pair later
+	if code := strings.TrimSpace(req.PairingCode); code != "" {
+		if err := rmapi.PairUser(newUser, code); err != nil {
+			logging.Logf("[AUTH] Pairing on behalf of %s failed: %v", newUser.Username, err)
+			resp["pairing_error"] = "Pairing failed"
+		} else {
+			resp["paired"] = true
+			resp["user"] = userToResponse(newUser)
+		}
+	}
+
+	logging.Logf("[AUTH] Admin %s created user %s", currentUser.Username, newUser.Username)
+	c.JSON(http.StatusCreated, resp)
+}
+
 // UpdateUserHandler updates a user (admin only)
 func UpdateUserHandler(c *gin.Context) {
 	if !database.IsMultiUserMode() {
@@ -189,6 +547,19 @@ func UpdateUserHandler(c *gin.Context) {
 		return
 	}
 
+	if err := validateSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, targetErr := database.NewUserService(database.DB).GetUserByID(userID)
+	if targetErr == nil {
+		if err := unsupportedSettings(c, target, req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "backend_unsupported"})
+			return
+		}
+	}
+
 	// Build update map
 	updates := make(map[string]interface{})
 	if req.Username != nil && *req.Username != "" {
@@ -223,12 +594,50 @@ func UpdateUserHandler(c *gin.Context) {
 	if req.PageDPI != nil {
 		updates["page_dpi"] = *req.PageDPI
 	}
+	if req.UploadTimeout != nil {
+		updates["upload_timeout"] = *req.UploadTimeout
+	}
+	if req.JobTimeout != nil {
+		updates["job_timeout"] = *req.JobTimeout
+	}
+	if req.StorageQuotaMB != nil {
+		updates["storage_quota_mb"] = *req.StorageQuotaMB
+	}
+	if req.UploadQuota != nil {
+		updates["upload_quota"] = *req.UploadQuota
+	}
+	if req.MaxUploadMB != nil {
+		updates["max_upload_mb"] = *req.MaxUploadMB
+	}
+	if req.BlockedContentTypes != nil {
+		kinds, ok := contentpolicy.Parse(*req.BlockedContentTypes)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown content type in blocked_content_types"})
+			return
+		}
+		// Keep "none" so the user isn't given the setting's list
+		value := strings.Join(kinds, ",")
+		if strings.EqualFold(strings.TrimSpace(*req.BlockedContentTypes), "none") {
+			value = "none"
+		}
+		updates["blocked_content_types"] = value
+	}
 	if req.IsAdmin != nil {
 		updates["is_admin"] = *req.IsAdmin
 	}
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if err := languageUpdate(req, updates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if targetErr == nil {
+		if err := deliveryWindowUpdates(target, req, updates); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
@@ -312,6 +721,15 @@ func UpdateCurrentUserHandler(c *gin.Context) {
 		return
 	}
 
+	if err := validateSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := unsupportedSettings(c, user, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_type": "backend_unsupported"})
+		return
+	}
+
 	// Build update map (non-admin users can't change admin/active status)
 	updates := make(map[string]interface{})
 
@@ -327,52 +745,9 @@ func UpdateCurrentUserHandler(c *gin.Context) {
 		updates["email"] = *req.Email
 	}
 
-	if req.RmapiHost != nil {
-		updates["rmapi_host"] = *req.RmapiHost // Allow clearing by setting to empty string
-	}
-
-	if req.DefaultRmdir != nil && *req.DefaultRmdir != "" {
-		updates["default_rmdir"] = *req.DefaultRmdir
-	}
-
-	if req.CoverpageSetting != nil && *req.CoverpageSetting != "" {
-		updates["coverpage_setting"] = *req.CoverpageSetting
-	}
-
-	if req.ContrastSetting != nil && *req.ContrastSetting != "" {
-		updates["contrast_setting"] = *req.ContrastSetting
-	}
-
-	if req.ConflictResolution != nil && *req.ConflictResolution != "" {
-		updates["conflict_resolution"] = *req.ConflictResolution
-	}
-
-	if req.FolderDepthLimit != nil {
-		updates["folder_depth_limit"] = *req.FolderDepthLimit
-	}
-
-	if req.FolderExclusionList != nil {
-		updates["folder_exclusion_list"] = *req.FolderExclusionList // Allow clearing by setting to empty string
-	}
-
-	if req.PageResolution != nil {
-		updates["page_resolution"] = *req.PageResolution // Allow clearing by setting to empty string
-	}
-
-	if req.PageDPI != nil {
-		updates["page_dpi"] = *req.PageDPI // Allow clearing by setting to 0
-	}
-
-	if req.ConversionOutputFormat != nil {
-		updates["conversion_output_format"] = *req.ConversionOutputFormat // Allow clearing by setting to empty string
-	}
-
-	if req.PDFBackgroundRemoval != nil {
-		updates["pdf_background_removal"] = *req.PDFBackgroundRemoval
-	}
-
-	if req.ExperimentalDownloadLink != nil {
-		updates["experimental_download_link"] = *req.ExperimentalDownloadLink
+	if err := settingsUpdates(user, req, updates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if len(updates) == 0 {
@@ -389,6 +764,9 @@ func UpdateCurrentUserHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
+	if rmdir, ok := updates["default_rmdir"].(string); ok && rmdir != "/" {
+		database.RecordOnboarding(user.ID, database.OnboardingDefaultFolder)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
@@ -525,6 +903,65 @@ func ActivateUserHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// LogoutAllRequest optionally also revokes the user's API keys
+type LogoutAllRequest struct {
+	RevokeAPIKeys bool `json:"revoke_api_keys"`
+}
+
+// LogoutAllSessionsHandler signs a user out of every browser at once, for
+// when their account may be compromised (admin only). Login cookies issued so
+// far are rejected from the next request on; with revoke_api_keys the user's
+// API keys are deactivated too.
+func LogoutAllSessionsHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	currentUser, ok := RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// The body is optional
+	var req LogoutAllRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	// Deactivated users can still be signed out
+	var user database.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	sessions, keys, err := userService.RevokeSessions(userID, req.RevokeAPIKeys)
+	if err != nil {
+		logging.Logf("[AUTH] Failed to sign out %s everywhere: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out user"})
+		return
+	}
+
+	logging.Logf("[AUDIT] Admin %s signed out %s everywhere (%d sessions, %d API keys revoked) from %s",
+		currentUser.Username, user.Username, sessions, keys, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{
+		"success":          true,
+		"sessions_revoked": sessions,
+		"api_keys_revoked": keys,
+	})
+}
+
 // GetUserStatsHandler returns user statistics (admin only)
 func GetUserStatsHandler(c *gin.Context) {
 	if !database.IsMultiUserMode() {
@@ -565,9 +1002,79 @@ func GetCurrentUserStatsHandler(c *gin.Context) {
 		return
 	}
 
+	usage, err := userService.GetQuotaUsage(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user statistics"})
+		return
+	}
+	warnPercent := database.QuotaWarningPercent()
+	stats["quota"] = gin.H{
+		"state":               usage.State(warnPercent),
+		"warning_percent":     warnPercent,
+		"storage_bytes":       usage.StorageBytes,
+		"storage_limit_bytes": usage.StorageLimitBytes,
+		"storage_percent":     usage.StoragePercent(),
+		"uploads":             usage.Uploads,
+		"upload_limit":        usage.UploadLimit,
+		"upload_percent":      usage.UploadPercent(),
+		"period_start":        usage.PeriodStart,
+	}
+
+	// A tablet reached over USB or SSH needs no cloud pairing
+	paired := rmapi.IsUserPaired(user.ID) || delivery.ForUser(user).Offline()
+	onboarding, err := userService.GetOnboarding(user, paired)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user statistics"})
+		return
+	}
+	stats["onboarding"] = onboarding
+
 	c.JSON(http.StatusOK, stats)
 }
 
+// DismissOnboardingHandler hides the current user's onboarding checklist
+func DismissOnboardingHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	if err := userService.DismissOnboarding(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding checklist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ResetOnboardingHandler shows the current user's onboarding checklist again
+// with every step started over
+func ResetOnboardingHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User management not available in single-user mode"})
+		return
+	}
+
+	user, ok := RequireUser(c)
+	if !ok {
+		return
+	}
+
+	userService := database.NewUserService(database.DB)
+	if err := userService.ResetOnboarding(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding checklist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 // DeleteUserHandler deletes a user (admin only)
 func DeleteUserHandler(c *gin.Context) {
 	if !database.IsMultiUserMode() {
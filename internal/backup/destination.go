@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// remoteBackend is the S3 bucket completed archives are copied to, built on
+// first use
+var (
+	remoteMu      sync.Mutex
+	remoteBackend storage.StorageBackendWithInfo
+)
+
+// RemoteEnabled reports whether completed archives are also uploaded to
+// BACKUP_S3_BUCKET
+func RemoteEnabled() bool {
+	return config.Get("BACKUP_S3_BUCKET", "") != ""
+}
+
+// keepLocalCopy reports whether the archive stays in the storage backend
+// after it's uploaded to the backup bucket
+func keepLocalCopy() bool {
+	return config.GetBool("BACKUP_S3_KEEP_LOCAL", true)
+}
+
+// remoteStorageConfig reads the BACKUP_S3_* variables, falling back to the
+// matching S3_* variable for each one that's unset
+func remoteStorageConfig() storage.StorageConfig {
+	get := func(key, def string) string {
+		return config.Get("BACKUP_"+key, config.Get(key, def))
+	}
+	return storage.StorageConfig{
+		Backend:          "s3",
+		S3Endpoint:       get("S3_ENDPOINT", ""),
+		S3Region:         get("S3_REGION", "us-east-1"),
+		S3Bucket:         config.Get("BACKUP_S3_BUCKET", ""),
+		S3AccessKeyID:    get("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey:      get("S3_SECRET_ACCESS_KEY", ""),
+		S3ForcePathStyle: config.GetBool("BACKUP_S3_FORCE_PATH_STYLE", config.GetBool("S3_FORCE_PATH_STYLE", false)),
+
+		S3PartSizeMB:        config.GetInt("BACKUP_S3_PART_SIZE_MB", config.GetInt("S3_PART_SIZE_MB", 5)),
+		S3UploadConcurrency: config.GetInt("BACKUP_S3_UPLOAD_CONCURRENCY", config.GetInt("S3_UPLOAD_CONCURRENCY", 5)),
+		S3MaxAttempts:       config.GetInt("BACKUP_S3_MAX_ATTEMPTS", config.GetInt("S3_MAX_ATTEMPTS", 5)),
+	}
+}
+
+// getRemoteBackend returns the backup bucket, connecting on first use
+func getRemoteBackend() (storage.StorageBackendWithInfo, error) {
+	if !RemoteEnabled() {
+		return nil, errors.New("BACKUP_S3_BUCKET is not set")
+	}
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	if remoteBackend == nil {
+		backend, err := storage.NewBackend(remoteStorageConfig())
+		if err != nil {
+			return nil, err
+		}
+		remoteBackend = backend
+	}
+	return remoteBackend, nil
+}
+
+// uploadRemote copies the archive at path to the backup bucket under key
+func uploadRemote(ctx context.Context, key, path string) error {
+	backend, err := getRemoteBackend()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return backend.Put(ctx, key, f)
+}
+
+// OpenBackup opens a completed job's archive, from the storage backend when
+// it's there and otherwise from the backup bucket
+func OpenBackup(ctx context.Context, job *database.BackupJob) (io.ReadCloser, error) {
+	if job.FilePath != "" {
+		backend := storage.GetStorageBackend()
+		if exists, err := backend.Exists(ctx, job.FilePath); err == nil && exists {
+			return backend.Get(ctx, job.FilePath)
+		}
+	}
+	if job.RemoteKey != "" {
+		backend, err := getRemoteBackend()
+		if err != nil {
+			return nil, err
+		}
+		return backend.Get(ctx, job.RemoteKey)
+	}
+	return nil, os.ErrNotExist
+}
+
+// deleteBackupFiles removes a job's archive from the storage backend and the
+// backup bucket
+func deleteBackupFiles(ctx context.Context, job database.BackupJob) error {
+	if job.FilePath != "" {
+		if err := storage.GetStorageBackend().Delete(ctx, job.FilePath); err != nil {
+			return err
+		}
+	}
+	if job.RemoteKey != "" {
+		backend, err := getRemoteBackend()
+		if err != nil {
+			return err
+		}
+		if err := backend.Delete(ctx, job.RemoteKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"gorm.io/gorm"
+)
+
+// RetentionSettingKey is the system setting controlling how long completed backups are kept
+const RetentionSettingKey = "backup_retention_days"
+
+// retentionInterval is how often StartRetention sweeps expired backups
+const retentionInterval = time.Hour
+
+// CleanupResult summarizes what a retention sweep removed
+type CleanupResult struct {
+	Removed        int   `json:"removed"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// GetRetentionDays returns the configured backup retention in days.
+// Zero means completed backups are kept until deleted manually.
+func GetRetentionDays() int {
+	value, err := database.GetSystemSetting(RetentionSettingKey)
+	if err != nil {
+		return 0
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0
+	}
+	return days
+}
+
+// expiryFor returns when a backup completed at completedAt should expire,
+// honoring the per-job override before the system-wide setting
+func expiryFor(job database.BackupJob, completedAt time.Time) *time.Time {
+	days := GetRetentionDays()
+	if job.RetentionDays != nil {
+		days = *job.RetentionDays
+	}
+	if days <= 0 {
+		return nil
+	}
+	expiresAt := completedAt.AddDate(0, 0, days)
+	return &expiresAt
+}
+
+// CleanupExpiredBackups deletes completed backups whose retention has elapsed
+// and reports how much storage was reclaimed
+func CleanupExpiredBackups(db *gorm.DB) (CleanupResult, error) {
+	var result CleanupResult
+
+	var expiredJobs []database.BackupJob
+	if err := db.Where("expires_at IS NOT NULL AND expires_at < ? AND status = ?", time.Now(), "completed").Find(&expiredJobs).Error; err != nil {
+		return result, err
+	}
+
+	ctx := context.Background()
+
+	for _, job := range expiredJobs {
+		if err := deleteBackupFiles(ctx, job); err != nil {
+			logging.Logf("[BACKUP] Warning: failed to delete backup %s: %v", job.Filename, err)
+			continue
+		}
+		if err := db.Delete(&job).Error; err != nil {
+			logging.Logf("[BACKUP] Warning: failed to delete backup job %s: %v", job.ID, err)
+			continue
+		}
+		result.Removed++
+		result.ReclaimedBytes += job.FileSize
+	}
+
+	if result.Removed > 0 {
+		logging.Logf("[BACKUP] Retention removed %d expired backup(s), reclaimed %d bytes", result.Removed, result.ReclaimedBytes)
+	}
+
+	return result, nil
+}
+
+// StartRetention removes expired backups every hour until ctx is cancelled.
+// Backups expire by date, so the sweep runs for the life of the server
+// rather than with the on-demand worker, which stops once it is idle.
+func StartRetention(ctx context.Context, db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := CleanupExpiredBackups(db); err != nil {
+					logging.Logf("[BACKUP] Warning: failed to cleanup expired backups: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// setupRetention creates a SQLite database with an admin and a filesystem
+// backend for the backup files
+func setupRetention(t *testing.T) *database.User {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("BACKUP_S3_BUCKET", "")
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	if err := storage.ConfigureStorage(storage.StorageConfig{Backend: "filesystem", DataDir: dataDir}); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := database.NewUserService(database.DB).CreateUser("admin", "admin@example.com", "correct-horse", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+// createBackup stores a backup file and its job, created age ago
+func createBackup(t *testing.T, admin *database.User, name, status string, scheduled bool, age time.Duration, expiresAt *time.Time) database.BackupJob {
+	t.Helper()
+	key := "backups/" + name
+	body := "backup " + name
+	if err := storage.GetStorageBackend().Put(context.Background(), key, strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	job := database.BackupJob{
+		ID:          uuid.New(),
+		AdminUserID: admin.ID,
+		Status:      status,
+		Scheduled:   scheduled,
+		FilePath:    key,
+		Filename:    name,
+		FileSize:    int64(len(body)),
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now().Add(-age),
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// remaining returns the file names of the backups still recorded, and
+// checks each one's file is still stored
+func remaining(t *testing.T) map[string]bool {
+	t.Helper()
+	var jobs []database.BackupJob
+	if err := database.DB.Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		names[job.Filename] = true
+		if exists, _ := storage.GetStorageBackend().Exists(context.Background(), job.FilePath); !exists {
+			t.Errorf("%s is recorded but its file is gone", job.Filename)
+		}
+	}
+	return names
+}
+
+func TestCleanupExpiredBackups(t *testing.T) {
+	admin := setupRetention(t)
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	expired := createBackup(t, admin, "expired.tar.gz", "completed", false, 48*time.Hour, &past)
+	createBackup(t, admin, "current.tar.gz", "completed", false, time.Hour, &future)
+	createBackup(t, admin, "kept.tar.gz", "completed", false, 48*time.Hour, nil)
+	createBackup(t, admin, "failed.tar.gz", "failed", false, 48*time.Hour, &past)
+
+	result, err := CleanupExpiredBackups(database.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Removed != 1 || result.ReclaimedBytes != expired.FileSize {
+		t.Errorf("result = %+v, want 1 backup of %d bytes removed", result, expired.FileSize)
+	}
+	got := remaining(t)
+	if got["expired.tar.gz"] || !got["current.tar.gz"] || !got["kept.tar.gz"] || !got["failed.tar.gz"] {
+		t.Errorf("remaining = %v, want all but the expired backup", got)
+	}
+	if exists, _ := storage.GetStorageBackend().Exists(context.Background(), expired.FilePath); exists {
+		t.Error("expired backup's file was kept")
+	}
+}
+
+func TestPruneScheduledBackups(t *testing.T) {
+	admin := setupRetention(t)
+	createBackup(t, admin, "oldest.tar.gz", "completed", true, 72*time.Hour, nil)
+	createBackup(t, admin, "older.tar.gz", "completed", true, 48*time.Hour, nil)
+	createBackup(t, admin, "newest.tar.gz", "completed", true, 24*time.Hour, nil)
+	createBackup(t, admin, "manual.tar.gz", "completed", false, 96*time.Hour, nil)
+	createBackup(t, admin, "running.tar.gz", "running", true, 96*time.Hour, nil)
+
+	// Keeping none means keeping all
+	pruneScheduledBackups(database.DB, 0)
+	if got := remaining(t); len(got) != 5 {
+		t.Errorf("remaining = %v, want nothing pruned", got)
+	}
+
+	// Only completed scheduled backups count, newest first
+	pruneScheduledBackups(database.DB, 2)
+	got := remaining(t)
+	if got["oldest.tar.gz"] || !got["older.tar.gz"] || !got["newest.tar.gz"] || !got["manual.tar.gz"] || !got["running.tar.gz"] {
+		t.Errorf("remaining = %v, want the oldest scheduled backup pruned", got)
+	}
+}
+
+func TestExpiryFor(t *testing.T) {
+	setupRetention(t)
+	completed := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	if got := expiryFor(database.BackupJob{}, completed); got != nil {
+		t.Errorf("expiry without a retention = %v, want none", got)
+	}
+
+	if err := database.SetSystemSetting(RetentionSettingKey, "7", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := expiryFor(database.BackupJob{}, completed); got == nil || !got.Equal(completed.AddDate(0, 0, 7)) {
+		t.Errorf("expiry with the setting = %v, want 7 days later", got)
+	}
+	days := 30
+	if got := expiryFor(database.BackupJob{RetentionDays: &days}, completed); got == nil || !got.Equal(completed.AddDate(0, 0, 30)) {
+		t.Errorf("expiry with an override = %v, want 30 days later", got)
+	}
+	days = 0
+	if got := expiryFor(database.BackupJob{RetentionDays: &days}, completed); got != nil {
+		t.Errorf("expiry with a zero override = %v, want none", got)
+	}
+}
@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/export"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"gorm.io/gorm"
+)
+
+// ScheduleSettingKey is the system setting holding the backup schedule as JSON
+const ScheduleSettingKey = "backup_schedule"
+
+// Schedule describes recurring automatic backups
+type Schedule struct {
+	Enabled bool `json:"enabled"`
+	// Cron is a five-field cron expression, e.g. "0 2 * * *" for 02:00 nightly
+	Cron string `json:"cron"`
+	// Timezone is an IANA name; empty uses the server's
+	Timezone string `json:"timezone,omitempty"`
+	// Keep is how many scheduled backups to keep; 0 keeps them all, subject
+	// to backup_retention_days
+	Keep           int    `json:"keep"`
+	IncludeFiles   bool   `json:"include_files"`
+	IncludeConfigs bool   `json:"include_configs"`
+	DatabaseFormat string `json:"database_format"`
+	// ExcludeFileUserIDs and FilesMaxAgeDays leave archived documents out of
+	// scheduled backups, as for a single backup job
+	ExcludeFileUserIDs []uuid.UUID `json:"exclude_file_user_ids,omitempty"`
+	FilesMaxAgeDays    int         `json:"files_max_age_days,omitempty"`
+	// AdminUserID owns the scheduled backup jobs: the admin who last saved it
+	AdminUserID uuid.UUID `json:"admin_user_id"`
+}
+
+// defaultSchedule is returned until an admin saves a schedule
+var defaultSchedule = Schedule{
+	Cron:           "0 2 * * *",
+	Keep:           7,
+	IncludeFiles:   true,
+	IncludeConfigs: true,
+	DatabaseFormat: export.DatabaseFormatJSON,
+}
+
+// scheduleChanged wakes the scheduler when the schedule is saved
+var scheduleChanged = make(chan struct{}, 1)
+
+// GetSchedule returns the saved backup schedule, or a disabled default
+func GetSchedule() Schedule {
+	value, err := database.GetSystemSetting(ScheduleSettingKey)
+	if err != nil || value == "" {
+		return defaultSchedule
+	}
+	s := defaultSchedule
+	if err := json.Unmarshal([]byte(value), &s); err != nil {
+		logging.Logf("[BACKUP] Warning: ignoring invalid backup schedule: %v", err)
+		return defaultSchedule
+	}
+	return s
+}
+
+// Validate checks the cron expression, timezone, retention count and
+// database format
+func (s Schedule) Validate() error {
+	if _, err := ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	if s.Keep < 0 {
+		return errors.New("keep must not be negative")
+	}
+	if s.FilesMaxAgeDays < 0 {
+		return errors.New("files_max_age_days must not be negative")
+	}
+	if !export.IsValidDatabaseFormat(s.DatabaseFormat) {
+		return fmt.Errorf("invalid database format %q", s.DatabaseFormat)
+	}
+	return nil
+}
+
+// Next returns when the schedule next runs after t, or the zero time if it's
+// disabled or never matches
+func (s Schedule) Next(t time.Time) time.Time {
+	if !s.Enabled {
+		return time.Time{}
+	}
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.Next(t.In(loc))
+}
+
+// SaveSchedule validates and saves s, and reschedules the next run
+func SaveSchedule(s Schedule, updatedBy uuid.UUID) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	s.AdminUserID = updatedBy
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := database.SetSystemSetting(ScheduleSettingKey, string(value), &updatedBy); err != nil {
+		return err
+	}
+	select {
+	case scheduleChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// LastScheduledBackup returns the most recent scheduled backup job, if any
+func LastScheduledBackup(db *gorm.DB) (*database.BackupJob, error) {
+	var job database.BackupJob
+	err := db.Where("scheduled = ?", true).Order("created_at DESC").First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// StartScheduler queues a backup job each time the schedule comes due, until
+// ctx is cancelled. It runs for the life of the server, unlike the on-demand
+// worker that processes the jobs.
+func StartScheduler(ctx context.Context, db *gorm.DB) {
+	go func() {
+		for {
+			s := GetSchedule()
+			next := s.Next(time.Now())
+			// Nothing scheduled: sleep until the schedule is saved
+			wait := 24 * time.Hour
+			if !next.IsZero() {
+				wait = time.Until(next)
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-scheduleChanged:
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+			if next.IsZero() {
+				continue
+			}
+			runScheduledBackup(db, s)
+		}
+	}()
+}
+
+// runScheduledBackup queues one scheduled backup and starts the worker
+func runScheduledBackup(db *gorm.DB, s Schedule) {
+	if enabled, reason := maintenance.Status(); enabled && reason == maintenance.ReasonRestore {
+		logging.Logf("[BACKUP] Skipping scheduled backup while a restore is running")
+		return
+	}
+	var active int64
+	if err := db.Model(&database.BackupJob{}).Where("scheduled = ? AND status IN ?", true, []string{"pending", "running"}).Count(&active).Error; err == nil && active > 0 {
+		logging.Logf("[BACKUP] Skipping scheduled backup, the previous one hasn't finished")
+		return
+	}
+
+	job := database.BackupJob{
+		AdminUserID:        s.AdminUserID,
+		Status:             "pending",
+		IncludeFiles:       s.IncludeFiles,
+		IncludeConfigs:     s.IncludeConfigs,
+		DatabaseFormat:     s.DatabaseFormat,
+		ExcludeFileUserIDs: joinIDs(s.ExcludeFileUserIDs),
+		FilesMaxAgeDays:    s.FilesMaxAgeDays,
+		Scheduled:          true,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		logging.Logf("[BACKUP] Failed to create scheduled backup job: %v", err)
+		return
+	}
+	logging.Logf("[BACKUP] Scheduled backup job %s queued", job.ID)
+	EnsureWorkerRunning(db)
+}
+
+// pruneScheduledBackups deletes the oldest completed scheduled backups beyond
+// the schedule's keep count
+func pruneScheduledBackups(db *gorm.DB, keep int) {
+	if keep <= 0 {
+		return
+	}
+	var jobs []database.BackupJob
+	if err := db.Where("scheduled = ? AND status = ?", true, "completed").
+		Order("created_at DESC").Find(&jobs).Error; err != nil {
+		logging.Logf("[BACKUP] Warning: failed to list old scheduled backups: %v", err)
+		return
+	}
+	if len(jobs) <= keep {
+		return
+	}
+	for _, job := range jobs[keep:] {
+		if err := DeleteBackupJob(db, job.ID, job.AdminUserID); err != nil {
+			logging.Logf("[BACKUP] Warning: failed to delete old scheduled backup %s: %v", job.ID, err)
+			continue
+		}
+		logging.Logf("[BACKUP] Removed old scheduled backup %s", job.Filename)
+	}
+}
@@ -72,6 +72,11 @@ func (w *Worker) run() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	// Enforce retention whenever the worker spins up
+	if _, err := CleanupExpiredBackups(w.db); err != nil {
+		logging.Logf("[BACKUP] Warning: failed to cleanup expired backups: %v", err)
+	}
+
 	for {
 		select {
 		case <-w.quit:
@@ -137,20 +142,14 @@ func (w *Worker) processJob(job database.BackupJob) {
 
 	exporter := export.NewExporter(w.db, w.dataDir)
 
-	var userIDs []uuid.UUID
-	if job.UserIDs != "" {
-		for _, idStr := range strings.Split(job.UserIDs, ",") {
-			if id, err := uuid.Parse(strings.TrimSpace(idStr)); err == nil {
-				userIDs = append(userIDs, id)
-			}
-		}
-	}
-
 	exportOptions := export.ExportOptions{
-		IncludeDatabase: true,
-		IncludeFiles:    job.IncludeFiles,
-		IncludeConfigs:  job.IncludeConfigs,
-		UserIDs:         userIDs,
+		IncludeDatabase:    true,
+		IncludeFiles:       job.IncludeFiles,
+		IncludeConfigs:     job.IncludeConfigs,
+		UserIDs:            splitIDs(job.UserIDs),
+		DatabaseFormat:     job.DatabaseFormat,
+		ExcludeFileUserIDs: splitIDs(job.ExcludeFileUserIDs),
+		FilesMaxAgeDays:    job.FilesMaxAgeDays,
 	}
 
 	job.Progress = 50
@@ -183,8 +182,25 @@ func (w *Worker) processJob(job database.BackupJob) {
 		return
 	}
 
+	// Copy the archive off-site when a backup bucket is configured
+	if RemoteEnabled() {
+		if err := uploadRemote(ctx, storageKey, tempBackupPath); err != nil {
+			w.failJob(job, fmt.Sprintf("Failed to upload backup to S3: %v", err))
+			return
+		}
+		job.RemoteKey = storageKey
+		logging.Logf("[BACKUP] Uploaded %s to s3://%s", storageKey, config.Get("BACKUP_S3_BUCKET", ""))
+
+		if !keepLocalCopy() {
+			if err := backend.Delete(ctx, storageKey); err != nil {
+				logging.Logf("[BACKUP] Warning: failed to remove local copy of %s: %v", storageKey, err)
+			} else {
+				storageKey = ""
+			}
+		}
+	}
+
 	completedAt := time.Now()
-	expiresAt := completedAt.Add(24 * time.Hour)
 
 	job.Status = "completed"
 	job.Progress = 100
@@ -192,9 +208,16 @@ func (w *Worker) processJob(job database.BackupJob) {
 	job.Filename = filename
 	job.FileSize = stat.Size()
 	job.CompletedAt = &completedAt
-	job.ExpiresAt = &expiresAt
+	job.ExpiresAt = expiryFor(job, completedAt)
 
 	w.db.Save(&job)
+
+	if job.Scheduled {
+		pruneScheduledBackups(w.db, GetSchedule().Keep)
+	}
+	if _, err := CleanupExpiredBackups(w.db); err != nil {
+		logging.Logf("[BACKUP] Warning: failed to cleanup expired backups: %v", err)
+	}
 }
 
 func (w *Worker) failJob(job database.BackupJob, errorMsg string) {
@@ -205,22 +228,44 @@ func (w *Worker) failJob(job database.BackupJob, errorMsg string) {
 	w.db.Save(&job)
 }
 
-func CreateBackupJob(db *gorm.DB, adminUserID uuid.UUID, includeFiles, includeConfigs bool, userIDs []uuid.UUID) (*database.BackupJob, error) {
-	var userIDsStr string
-	if len(userIDs) > 0 {
-		var strs []string
-		for _, id := range userIDs {
-			strs = append(strs, id.String())
+// FileExclusions leave archived documents out of a backup to keep routine
+// backups small. The documents' database records are still backed up.
+type FileExclusions struct {
+	UserIDs    []uuid.UUID // Leave out all of these users' documents
+	MaxAgeDays int         // Leave out documents last modified longer ago; 0 keeps all
+}
+
+// joinIDs returns ids as the comma-separated list BackupJob stores
+func joinIDs(ids []uuid.UUID) string {
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, id.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// splitIDs parses a comma-separated list of IDs, skipping invalid ones
+func splitIDs(s string) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, idStr := range strings.Split(s, ",") {
+		if id, err := uuid.Parse(strings.TrimSpace(idStr)); err == nil {
+			ids = append(ids, id)
 		}
-		userIDsStr = strings.Join(strs, ",")
 	}
+	return ids
+}
 
+func CreateBackupJob(db *gorm.DB, adminUserID uuid.UUID, includeFiles, includeConfigs bool, userIDs []uuid.UUID, retentionDays *int, databaseFormat string, exclude FileExclusions) (*database.BackupJob, error) {
 	job := database.BackupJob{
-		AdminUserID:    adminUserID,
-		Status:         "pending",
-		IncludeFiles:   includeFiles,
-		IncludeConfigs: includeConfigs,
-		UserIDs:        userIDsStr,
+		AdminUserID:        adminUserID,
+		Status:             "pending",
+		IncludeFiles:       includeFiles,
+		IncludeConfigs:     includeConfigs,
+		UserIDs:            joinIDs(userIDs),
+		RetentionDays:      retentionDays,
+		DatabaseFormat:     databaseFormat,
+		ExcludeFileUserIDs: joinIDs(exclude.UserIDs),
+		FilesMaxAgeDays:    exclude.MaxAgeDays,
 	}
 
 	if err := db.Create(&job).Error; err != nil {
@@ -230,13 +275,39 @@ func CreateBackupJob(db *gorm.DB, adminUserID uuid.UUID, includeFiles, includeCo
 	return &job, nil
 }
 
-func GetBackupJobs(db *gorm.DB, adminUserID uuid.UUID) ([]database.BackupJob, error) {
+// BackupJobQuery selects a page of an admin's backup jobs. Empty filters match
+// every job.
+type BackupJobQuery struct {
+	Status         string
+	DatabaseFormat string
+	Order          string
+	Offset         int
+	Limit          int
+}
+
+// ListBackupJobs returns one page of an admin's backup jobs and the total
+// number matching the query's filters
+func ListBackupJobs(db *gorm.DB, adminUserID uuid.UUID, q BackupJobQuery) ([]database.BackupJob, int64, error) {
+	query := db.Model(&database.BackupJob{}).Where("admin_user_id = ?", adminUserID)
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.DatabaseFormat != "" {
+		query = query.Where("database_format = ?", q.DatabaseFormat)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := q.Order
+	if order == "" {
+		order = "created_at DESC"
+	}
 	var jobs []database.BackupJob
-	err := db.Where("admin_user_id = ?", adminUserID).
-		Order("created_at DESC").
-		Limit(10).
-		Find(&jobs).Error
-	return jobs, err
+	err := query.Order(order).Offset(q.Offset).Limit(q.Limit).Find(&jobs).Error
+	return jobs, total, err
 }
 
 func GetBackupJob(db *gorm.DB, jobID uuid.UUID, adminUserID uuid.UUID) (*database.BackupJob, error) {
@@ -248,27 +319,6 @@ func GetBackupJob(db *gorm.DB, jobID uuid.UUID, adminUserID uuid.UUID) (*databas
 	return &job, nil
 }
 
-func CleanupExpiredBackups(db *gorm.DB) error {
-	var expiredJobs []database.BackupJob
-	if err := db.Where("expires_at < ? AND status = ?", time.Now(), "completed").Find(&expiredJobs).Error; err != nil {
-		return err
-	}
-
-	ctx := context.Background()
-	backend := storage.GetStorageBackend()
-
-	for _, job := range expiredJobs {
-		if job.FilePath != "" {
-			if err := backend.Delete(ctx, job.FilePath); err != nil {
-				logging.Logf("[BACKUP] Warning: failed to delete backup %s: %v", job.FilePath, err)
-			}
-		}
-		db.Delete(&job)
-	}
-
-	return nil
-}
-
 func DeleteBackupJob(db *gorm.DB, jobID uuid.UUID, adminUserID uuid.UUID) error {
 	var job database.BackupJob
 	if err := db.Where("id = ? AND admin_user_id = ?", jobID, adminUserID).First(&job).Error; err != nil {
@@ -276,12 +326,8 @@ func DeleteBackupJob(db *gorm.DB, jobID uuid.UUID, adminUserID uuid.UUID) error
 	}
 
 	// Delete the backup file if it exists
-	if job.FilePath != "" {
-		ctx := context.Background()
-		backend := storage.GetStorageBackend()
-		if err := backend.Delete(ctx, job.FilePath); err != nil {
-			logging.Logf("[BACKUP] Warning: failed to delete backup %s: %v", job.FilePath, err)
-		}
+	if err := deleteBackupFiles(context.Background(), job); err != nil {
+		logging.Logf("[BACKUP] Warning: failed to delete backup %s: %v", job.Filename, err)
 	}
 
 	// Delete the job record
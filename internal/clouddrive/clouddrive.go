@@ -0,0 +1,226 @@
+// Package clouddrive recognizes share links from Dropbox, Google Drive and
+// OneDrive and turns them into requests for the underlying file. Public links
+// are fetched through each provider's public download or export endpoint; when
+// a user has connected their account, the provider's API is used instead so
+// private files work too.
+package clouddrive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Dropbox     = "dropbox"
+	GoogleDrive = "google_drive"
+	OneDrive    = "onedrive"
+)
+
+// Providers lists every supported provider
+var Providers = []string{Dropbox, GoogleDrive, OneDrive}
+
+// Link is a recognized cloud drive share link
+type Link struct {
+	Provider string
+	// Original is the share link as given
+	Original string
+	// DownloadURL fetches the file without authentication
+	DownloadURL string
+	// FileID is the provider's file ID, when the link contains one
+	FileID string
+	// Export is set for Google Docs/Sheets/Slides, which are exported as PDF
+	Export bool
+}
+
+var (
+	googleFilePathRe = regexp.MustCompile(`^/file/d/([A-Za-z0-9_-]+)`)
+	googleDocPathRe  = regexp.MustCompile(`^/(document|spreadsheets|presentation)/d/([A-Za-z0-9_-]+)`)
+)
+
+// Parse reports whether rawURL is a share link from a supported provider and,
+// if so, how to download it
+func Parse(rawURL string) (*Link, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	switch {
+	case host == "dropbox.com" || host == "www.dropbox.com":
+		if !strings.HasPrefix(u.Path, "/s/") && !strings.HasPrefix(u.Path, "/scl/fi/") {
+			return nil, false
+		}
+		q := u.Query()
+		q.Del("raw")
+		q.Set("dl", "1")
+		direct := *u
+		direct.RawQuery = q.Encode()
+		return &Link{Provider: Dropbox, Original: rawURL, DownloadURL: direct.String()}, true
+
+	case host == "drive.google.com":
+		id := u.Query().Get("id")
+		if m := googleFilePathRe.FindStringSubmatch(u.Path); m != nil {
+			id = m[1]
+		} else if u.Path != "/open" && u.Path != "/uc" {
+			return nil, false
+		}
+		if id == "" {
+			return nil, false
+		}
+		q := url.Values{"id": {id}, "export": {"download"}, "confirm": {"t"}}
+		if key := u.Query().Get("resourcekey"); key != "" {
+			q.Set("resourcekey", key)
+		}
+		return &Link{
+			Provider:    GoogleDrive,
+			Original:    rawURL,
+			FileID:      id,
+			DownloadURL: "https://drive.usercontent.google.com/download?" + q.Encode(),
+		}, true
+
+	case host == "docs.google.com":
+		m := googleDocPathRe.FindStringSubmatch(u.Path)
+		if m == nil {
+			return nil, false
+		}
+		kind, id := m[1], m[2]
+		export := fmt.Sprintf("https://docs.google.com/%s/d/%s/export?format=pdf", kind, id)
+		if kind == "presentation" {
+			export = fmt.Sprintf("https://docs.google.com/presentation/d/%s/export/pdf", id)
+		}
+		return &Link{Provider: GoogleDrive, Original: rawURL, FileID: id, DownloadURL: export, Export: true}, true
+
+	case host == "1drv.ms" || host == "onedrive.live.com":
+		return &Link{
+			Provider:    OneDrive,
+			Original:    rawURL,
+			DownloadURL: "https://api.onedrive.com/v1.0/shares/" + shareID(rawURL) + "/root/content",
+		}, true
+
+	case strings.HasSuffix(host, ".sharepoint.com") && strings.HasPrefix(u.Path, "/:"):
+		// Business share links look like https://tenant.sharepoint.com/:b:/g/personal/...
+		q := u.Query()
+		q.Set("download", "1")
+		direct := *u
+		direct.RawQuery = q.Encode()
+		return &Link{Provider: OneDrive, Original: rawURL, DownloadURL: direct.String()}, true
+	}
+	return nil, false
+}
+
+// shareID encodes a share link for the OneDrive shares API
+func shareID(rawURL string) string {
+	return "u!" + strings.TrimRight(base64.URLEncoding.EncodeToString([]byte(rawURL)), "=")
+}
+
+// NewRequest builds the request that downloads link for userID. The returned
+// client is non-nil when the request must be sent with the user's connected
+// account; otherwise the caller's own client should be used. name is a
+// filename hint for responses that don't carry one.
+func NewRequest(ctx context.Context, link *Link, userID uuid.UUID) (req *http.Request, client *http.Client, name string, err error) {
+	client, err = userClient(ctx, userID, link.Provider)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if client == nil {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, link.DownloadURL, nil)
+		return req, nil, "", err
+	}
+
+	switch link.Provider {
+	case Dropbox:
+		arg, _ := json.Marshal(map[string]string{"url": link.Original})
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, "https://content.dropboxapi.com/2/sharing/get_shared_link_file", nil)
+		if err == nil {
+			req.Header.Set("Dropbox-API-Arg", string(arg))
+		}
+	case GoogleDrive:
+		name, err = googleFileName(ctx, client, link)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		endpoint := "https://www.googleapis.com/drive/v3/files/" + url.PathEscape(link.FileID)
+		if link.Export {
+			endpoint += "/export?mimeType=application%2Fpdf"
+		} else {
+			endpoint += "?alt=media&supportsAllDrives=true"
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	case OneDrive:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, "https://graph.microsoft.com/v1.0/shares/"+shareID(link.Original)+"/driveItem/content", nil)
+	default:
+		err = fmt.Errorf("unsupported provider %q", link.Provider)
+	}
+	return req, client, name, err
+}
+
+// googleFileName looks up a Drive file's name, since API downloads don't
+// include a Content-Disposition header
+func googleFileName(ctx context.Context, client *http.Client, link *Link) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://www.googleapis.com/drive/v3/files/"+url.PathEscape(link.FileID)+"?fields=name&supportsAllDrives=true", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google drive metadata request failed: %s", resp.Status)
+	}
+	var meta struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return "", err
+	}
+	if link.Export && path.Ext(meta.Name) == "" {
+		meta.Name += ".pdf"
+	}
+	return meta.Name, nil
+}
+
+// ResponseFilename returns the filename a provider sent with resp, if any
+func ResponseFilename(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return path.Base(params["filename"])
+		}
+	}
+	// Dropbox API downloads describe the file in a JSON header
+	if result := resp.Header.Get("Dropbox-API-Result"); result != "" {
+		var meta struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal([]byte(result), &meta) == nil && meta.Name != "" {
+			return path.Base(meta.Name)
+		}
+	}
+	return ""
+}
+
+// ProviderName returns a display name for provider
+func ProviderName(provider string) string {
+	switch provider {
+	case Dropbox:
+		return "Dropbox"
+	case GoogleDrive:
+		return "Google Drive"
+	case OneDrive:
+		return "OneDrive"
+	}
+	return provider
+}
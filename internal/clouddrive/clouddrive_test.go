@@ -0,0 +1,85 @@
+package clouddrive
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseShareLinks(t *testing.T) {
+	tests := []struct {
+		in       string
+		provider string
+		download string
+	}{
+		{
+			"https://www.dropbox.com/scl/fi/abc123/paper.pdf?rlkey=xyz&dl=0",
+			Dropbox,
+			"https://www.dropbox.com/scl/fi/abc123/paper.pdf?dl=1&rlkey=xyz",
+		},
+		{
+			"https://drive.google.com/file/d/1AbC_d-E/view?usp=sharing",
+			GoogleDrive,
+			"https://drive.usercontent.google.com/download?confirm=t&export=download&id=1AbC_d-E",
+		},
+		{
+			"https://drive.google.com/open?id=1AbC",
+			GoogleDrive,
+			"https://drive.usercontent.google.com/download?confirm=t&export=download&id=1AbC",
+		},
+		{
+			"https://docs.google.com/document/d/1Doc/edit",
+			GoogleDrive,
+			"https://docs.google.com/document/d/1Doc/export?format=pdf",
+		},
+		{
+			"https://docs.google.com/presentation/d/1Deck/edit#slide=id.p",
+			GoogleDrive,
+			"https://docs.google.com/presentation/d/1Deck/export/pdf",
+		},
+		{
+			"https://1drv.ms/b/s!AkZ",
+			OneDrive,
+			"https://api.onedrive.com/v1.0/shares/u!aHR0cHM6Ly8xZHJ2Lm1zL2IvcyFBa1o/root/content",
+		},
+		{
+			"https://contoso.sharepoint.com/:b:/g/personal/me/EAbc?e=x1",
+			OneDrive,
+			"https://contoso.sharepoint.com/:b:/g/personal/me/EAbc?download=1&e=x1",
+		},
+	}
+	for _, tt := range tests {
+		link, ok := Parse(tt.in)
+		if !ok {
+			t.Errorf("Parse(%q) did not recognize the link", tt.in)
+			continue
+		}
+		if link.Provider != tt.provider || link.DownloadURL != tt.download {
+			t.Errorf("Parse(%q) = %s %s, want %s %s", tt.in, link.Provider, link.DownloadURL, tt.provider, tt.download)
+		}
+	}
+
+	for _, in := range []string{
+		"https://example.com/paper.pdf",
+		"https://www.dropbox.com/home",
+		"https://drive.google.com/drive/folders/1Folder",
+		"https://dl.dropboxusercontent.com/s/abc/paper.pdf",
+	} {
+		if _, ok := Parse(in); ok {
+			t.Errorf("Parse(%q) should not match", in)
+		}
+	}
+}
+
+func TestResponseFilename(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Content-Disposition", `attachment; filename="Quarterly Report.pdf"`)
+	if got := ResponseFilename(resp); got != "Quarterly Report.pdf" {
+		t.Errorf("ResponseFilename = %q", got)
+	}
+
+	resp.Header.Del("Content-Disposition")
+	resp.Header.Set("Dropbox-API-Result", `{"name": "notes.epub", "size": 10}`)
+	if got := ResponseFilename(resp); got != "notes.epub" {
+		t.Errorf("ResponseFilename = %q", got)
+	}
+}
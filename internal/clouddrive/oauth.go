@@ -0,0 +1,195 @@
+package clouddrive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+var endpoints = map[string]struct {
+	envPrefix string
+	endpoint  oauth2.Endpoint
+	scopes    []string
+	options   []oauth2.AuthCodeOption
+}{
+	Dropbox: {
+		envPrefix: "DROPBOX",
+		endpoint: oauth2.Endpoint{
+			AuthURL:  "https://www.dropbox.com/oauth2/authorize",
+			TokenURL: "https://api.dropboxapi.com/oauth2/token",
+		},
+		scopes:  []string{"sharing.read", "files.content.read"},
+		options: []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("token_access_type", "offline")},
+	},
+	GoogleDrive: {
+		envPrefix: "GOOGLE_DRIVE",
+		endpoint: oauth2.Endpoint{
+			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+			TokenURL: "https://oauth2.googleapis.com/token",
+		},
+		scopes:  []string{"https://www.googleapis.com/auth/drive.readonly"},
+		options: []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent")},
+	},
+	OneDrive: {
+		envPrefix: "ONEDRIVE",
+		endpoint: oauth2.Endpoint{
+			AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+			TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		},
+		scopes: []string{"Files.Read.All", "offline_access"},
+	},
+}
+
+// OAuthConfig returns the OAuth client for provider, or nil when
+// <PROVIDER>_CLIENT_ID, <PROVIDER>_CLIENT_SECRET or CLOUD_DRIVE_REDIRECT_URL
+// is not set. Account connections are only available in multi-user mode.
+func OAuthConfig(provider string) *oauth2.Config {
+	p, ok := endpoints[provider]
+	if !ok || !database.IsMultiUserMode() {
+		return nil
+	}
+	clientID := config.Get(p.envPrefix+"_CLIENT_ID", "")
+	clientSecret := config.Get(p.envPrefix+"_CLIENT_SECRET", "")
+	redirectURL := config.Get("CLOUD_DRIVE_REDIRECT_URL", "")
+	if clientID == "" || clientSecret == "" || redirectURL == "" {
+		return nil
+	}
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     p.endpoint,
+		RedirectURL:  redirectURL,
+		Scopes:       p.scopes,
+	}
+}
+
+// AuthCodeURL returns the provider's consent page URL for state
+func AuthCodeURL(provider, state string) (string, error) {
+	cfg := OAuthConfig(provider)
+	if cfg == nil {
+		return "", errors.New("cloud drive provider not configured")
+	}
+	return cfg.AuthCodeURL(state, endpoints[provider].options...), nil
+}
+
+// Connect exchanges an authorization code and stores the token for userID
+func Connect(ctx context.Context, userID uuid.UUID, provider, code string) error {
+	cfg := OAuthConfig(provider)
+	if cfg == nil {
+		return errors.New("cloud drive provider not configured")
+	}
+	token, err := cfg.Exchange(ctx, code)
+	if err != nil {
+		return err
+	}
+	return saveToken(userID, provider, token)
+}
+
+// Disconnect removes the stored token for userID and provider
+func Disconnect(userID uuid.UUID, provider string) error {
+	return database.DB.Where("user_id = ? AND provider = ?", userID, provider).Delete(&database.CloudDriveToken{}).Error
+}
+
+// Connected reports which providers userID has connected
+func Connected(userID uuid.UUID) map[string]bool {
+	connected := make(map[string]bool)
+	if !database.IsMultiUserMode() || database.DB == nil {
+		return connected
+	}
+	var tokens []database.CloudDriveToken
+	if err := database.DB.Where("user_id = ?", userID).Find(&tokens).Error; err != nil {
+		return connected
+	}
+	for _, t := range tokens {
+		connected[t.Provider] = true
+	}
+	return connected
+}
+
+func saveToken(userID uuid.UUID, provider string, token *oauth2.Token) error {
+	var record database.CloudDriveToken
+	err := database.DB.Where("user_id = ? AND provider = ?", userID, provider).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	record.UserID = userID
+	record.Provider = provider
+	record.AccessToken = token.AccessToken
+	record.TokenType = token.TokenType
+	record.Expiry = token.Expiry
+	// Providers only send a refresh token on the first exchange
+	if token.RefreshToken != "" {
+		record.RefreshToken = token.RefreshToken
+	}
+	return database.DB.Save(&record).Error
+}
+
+// userClient returns an HTTP client authorized as userID's connected account,
+// or nil when the user hasn't connected provider
+func userClient(ctx context.Context, userID uuid.UUID, provider string) (*http.Client, error) {
+	if userID == uuid.Nil {
+		return nil, nil
+	}
+	cfg := OAuthConfig(provider)
+	if cfg == nil {
+		return nil, nil
+	}
+	var record database.CloudDriveToken
+	if err := database.DB.Where("user_id = ? AND provider = ?", userID, provider).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  record.AccessToken,
+		RefreshToken: record.RefreshToken,
+		TokenType:    record.TokenType,
+		Expiry:       record.Expiry,
+	}
+	src := &savingTokenSource{
+		base:     cfg.TokenSource(ctx, token),
+		userID:   userID,
+		provider: provider,
+		last:     token.AccessToken,
+	}
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, src)), nil
+}
+
+// savingTokenSource persists refreshed tokens so the next job reuses them
+type savingTokenSource struct {
+	mu       sync.Mutex
+	base     oauth2.TokenSource
+	userID   uuid.UUID
+	provider string
+	last     string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid_grant") {
+			logging.Logf("[CLOUDDRIVE] %s access for user %s was revoked; reconnect the account", ProviderName(s.provider), s.userID)
+		}
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		if err := saveToken(s.userID, s.provider, token); err != nil {
+			logging.Logf("[CLOUDDRIVE] Failed to save refreshed %s token: %v", ProviderName(s.provider), err)
+		}
+	}
+	return token, nil
+}
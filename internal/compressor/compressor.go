@@ -2,12 +2,14 @@ package compressor
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/procstats"
 )
 
 // ExecCommand is exec.Command by default, but can be overridden in tests.
@@ -22,20 +24,25 @@ func CompressPDF(path string) (string, error) {
 // CompressPDFWithProgress runs Ghostscript and reports progress via the callback.
 // progress is called with the current page and total pages processed.
 func CompressPDFWithProgress(path string, progress func(page, total int)) (string, error) {
+	return CompressPDFWithOptions(path, Options{}, progress)
+}
+
+// CompressPDFWithOptions is CompressPDFWithProgress with per-file options.
+// The program and arguments come from the preset's Profile: device when
+// opts downsamples images, standard otherwise.
+func CompressPDFWithOptions(path string, opts Options, progress func(page, total int)) (string, error) {
 	ext := filepath.Ext(path)
 	base := path[:len(path)-len(ext)]
 	out := fmt.Sprintf("%s_compressed%s", base, ext)
-	compat := config.Get("GS_COMPAT", "1.7")
-	settings := config.Get("GS_SETTINGS", "/ebook")
-	args := []string{
-		"gs", "-sDEVICE=pdfwrite",
-		fmt.Sprintf("-dCompatibilityLevel=%s", compat),
-		fmt.Sprintf("-dPDFSETTINGS=%s", settings),
-		"-dNOPAUSE", "-dBATCH",
-		fmt.Sprintf("-sOutputFile=%s", out),
-		path,
+	preset := PresetStandard
+	if opts.ImageDPI > 0 {
+		preset = PresetDevice
 	}
-	cmd := ExecCommand(args[0], args[1:]...)
+	profile, err := ProfileFor(preset)
+	if err != nil {
+		return "", err
+	}
+	cmd := ExecCommand(profile.Path, profile.command(path, out, opts)...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -43,9 +50,16 @@ func CompressPDFWithProgress(path string, progress func(page, total int)) (strin
 	}
 	cmd.Stderr = cmd.Stdout
 
+	release := acquireGS()
+	defer release()
 	if err := cmd.Start(); err != nil {
 		return "", err
 	}
+	if opts.Context != nil {
+		// Kill Ghostscript if the job is cancelled
+		stop := context.AfterFunc(opts.Context, func() { cmd.Process.Kill() })
+		defer stop()
+	}
 
 	// Parse progress lines like "Processing pages 1 through N." and "Page X"
 	done := 0
@@ -65,7 +79,13 @@ func CompressPDFWithProgress(path string, progress func(page, total int)) (strin
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	procstats.Record(opts.Usage, profile.Engine, cmd.ProcessState)
+	if opts.Context != nil && opts.Context.Err() != nil {
+		os.Remove(out)
+		return "", opts.Context.Err()
+	}
+	if err != nil {
 		return "", err
 	}
 
@@ -75,23 +95,38 @@ func CompressPDFWithProgress(path string, progress func(page, total int)) (strin
 	return out, nil
 }
 
-// GetPDFPageCount returns the number of pages in a PDF file using ghostscript
+// GetPDFPageCount returns the number of pages in a PDF file using ghostscript.
+// Counts are cached by content hash, so asking again for the same file, or a
+// copy of it, doesn't start another Ghostscript process.
 func GetPDFPageCount(path string) (int, error) {
+	hash, hashErr := fileHash(path)
+	if hashErr == nil {
+		if pages, ok := pageCounts.get(hash); ok {
+			return pages, nil
+		}
+	}
+
 	args := []string{
-		"gs", "-q", "-dNODISPLAY", "-dBATCH",
+		GSPath(), "-q", "-dNODISPLAY", "-dBATCH",
 		"-c", "(" + path + ") (r) file runpdfbegin pdfpagecount = quit",
 	}
 	cmd := ExecCommand(args[0], args[1:]...)
-	
+
+	release := acquireGS()
 	output, err := cmd.Output()
+	release()
+	procstats.Record(nil, "gs", cmd.ProcessState)
 	if err != nil {
 		return 0, err
 	}
-	
+
 	var pageCount int
 	if _, err := fmt.Sscanf(string(output), "%d", &pageCount); err != nil {
 		return 0, err
 	}
-	
+
+	if hashErr == nil {
+		pageCounts.put(hash, pageCount)
+	}
 	return pageCount, nil
 }
@@ -0,0 +1,157 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetPDFPageCountCachesByContent(t *testing.T) {
+	calls := 0
+	orig := ExecCommand
+	ExecCommand = func(string, ...string) *exec.Cmd {
+		calls++
+		return exec.Command("echo", "7")
+	}
+	defer func() { ExecCommand = orig }()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.pdf")
+	copied := filepath.Join(dir, "b.pdf")
+	other := filepath.Join(dir, "c.pdf")
+	for path, content := range map[string]string{first: "%PDF-1.7 a", copied: "%PDF-1.7 a", other: "%PDF-1.7 c"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{first, first, copied} {
+		if pages, err := GetPDFPageCount(path); err != nil || pages != 7 {
+			t.Fatalf("GetPDFPageCount(%s) = %d, %v; want 7", path, pages, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("gs ran %d times for identical content, want 1", calls)
+	}
+
+	if _, err := GetPDFPageCount(other); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("gs ran %d times after a new file, want 2", calls)
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	orig := ExecCommand
+	ExecCommand = func(string, ...string) *exec.Cmd { return exec.Command("echo", "100") }
+	defer func() { ExecCommand = orig }()
+	t.Setenv("COMPRESS_SKIP_BELOW", "1000")
+	t.Setenv("COMPRESS_SKIP_BYTES_PER_PAGE", "100")
+
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	padding := make([]byte, 64*1024) // pushes the image past the first read
+	image := []byte("<< /Type /XObject /Subtype /Image /Width 10 >>")
+
+	cases := []struct {
+		name string
+		path string
+		skip bool
+	}{
+		{"small", write("small.pdf", []byte("%PDF-1.7 /Subtype /Image")), true},
+		{"no images", write("text.pdf", padding), true},
+		{"dense images", write("dense.pdf", append(append([]byte{}, padding[:5000]...), image...)), true},
+		{"large images", write("scan.pdf", append(append([]byte{}, padding...), image...)), false},
+	}
+	for _, tc := range cases {
+		if reason, skip := SkipReason(tc.path); skip != tc.skip {
+			t.Errorf("%s: skip = %v (%s), want %v", tc.name, skip, reason, tc.skip)
+		}
+	}
+
+	t.Setenv("COMPRESS_SKIP", "false")
+	if _, skip := SkipReason(cases[0].path); skip {
+		t.Error("COMPRESS_SKIP=false still skipped")
+	}
+}
+
+func TestDeviceDPI(t *testing.T) {
+	cases := []struct {
+		name          string
+		width, height float64
+		want          int
+	}{
+		{"letter", 612, 792, 166},
+		{"a4", 595.28, 841.89, 161},
+		{"letter landscape", 792, 612, 166},
+		{"unknown size", 0, 792, 0},
+	}
+	for _, tc := range cases {
+		if got := DeviceDPI(tc.width, tc.height, 1404, 1872); got != tc.want {
+			t.Errorf("%s: DeviceDPI = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProfileCommand(t *testing.T) {
+	t.Setenv("GS_PATH", "/opt/gs/bin/gs")
+	p, err := ProfileFor(PresetDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := p.command("/tmp/my file.pdf", "/tmp/out.pdf", Options{ImageDPI: 166})
+	if p.Path != "/opt/gs/bin/gs" || args[len(args)-1] != "/tmp/my file.pdf" || args[len(args)-2] != "-sOutputFile=/tmp/out.pdf" {
+		t.Errorf("default gs profile: %s %q", p.Path, args)
+	}
+	if !strings.Contains(strings.Join(args, " "), "-dColorImageResolution=166") {
+		t.Errorf("device profile lacks downsampling: %q", args)
+	}
+
+	t.Setenv("COMPRESS_DEVICE_ENGINE", "mutool")
+	t.Setenv("COMPRESS_DEVICE_ARGS", "clean -z {input} {output}")
+	p, err = ProfileFor(PresetDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(p.command("in.pdf", "out.pdf", Options{}), " "); p.Engine != EngineMutool || got != "clean -z in.pdf out.pdf" {
+		t.Errorf("mutool profile: %s %q", p.Engine, got)
+	}
+	if p, _ := ProfileFor(PresetStandard); p.Engine != EngineGS {
+		t.Errorf("standard preset picked up the device engine: %s", p.Engine)
+	}
+
+	t.Setenv("COMPRESS_ENGINE", "qpdf")
+	if _, err := ProfileFor(PresetStandard); err == nil {
+		t.Error("unknown engine accepted")
+	}
+}
+
+func TestCompressPDFCancelled(t *testing.T) {
+	orig := ExecCommand
+	ExecCommand = func(string, ...string) *exec.Cmd { return exec.Command("sleep", "10") }
+	defer func() { ExecCommand = orig }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := CompressPDFWithOptions(filepath.Join(t.TempDir(), "a.pdf"), Options{Context: ctx}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to stop after cancelling", elapsed)
+	}
+}
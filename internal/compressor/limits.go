@@ -0,0 +1,80 @@
+package compressor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// maxCachedPageCounts bounds the page-count cache; it's emptied when full
+const maxCachedPageCounts = 1024
+
+var (
+	gsOnce  sync.Once
+	gsSlots chan struct{}
+
+	pageCounts = pageCountCache{counts: make(map[string]int)}
+)
+
+// Workers returns how many Ghostscript processes may run at once across all
+// jobs, from COMPRESS_WORKERS. It defaults to the number of CPUs, and is 1 in
+// low resource mode.
+func Workers() int {
+	if config.LowResource() {
+		return 1
+	}
+	if n := config.GetInt("COMPRESS_WORKERS", 0); n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+// acquireGS waits for a Ghostscript slot and returns a func that frees it
+func acquireGS() func() {
+	gsOnce.Do(func() {
+		gsSlots = make(chan struct{}, Workers())
+	})
+	gsSlots <- struct{}{}
+	return func() { <-gsSlots }
+}
+
+// pageCountCache maps a PDF's SHA-256 to its page count
+type pageCountCache struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *pageCountCache) get(hash string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pages, ok := c.counts[hash]
+	return pages, ok
+}
+
+func (c *pageCountCache) put(hash string, pages int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.counts) >= maxCachedPageCounts {
+		clear(c.counts)
+	}
+	c.counts[hash] = pages
+}
+
+// fileHash returns the hex SHA-256 of the file at path
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
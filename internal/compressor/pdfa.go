@@ -0,0 +1,52 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+// ConvertToPDFA writes a PDF/A copy of the PDF at path next to it and returns
+// the copy's path. PDFA_LEVEL picks the PDF/A part (1, 2 or 3, default 2).
+// Ghostscript needs an ICC output intent for strictly conforming files;
+// point PDFA_DEF at a PDFA_def.ps that embeds one. usage, if not nil,
+// collects what Ghostscript used.
+func ConvertToPDFA(path string, usage *procstats.Usage) (string, error) {
+	level := config.Get("PDFA_LEVEL", "2")
+	if level != "1" && level != "2" && level != "3" {
+		return "", fmt.Errorf("PDFA_LEVEL %q must be 1, 2 or 3", level)
+	}
+
+	ext := filepath.Ext(path)
+	out := fmt.Sprintf("%s_pdfa%s", path[:len(path)-len(ext)], ext)
+	args := []string{
+		GSPath(), "-sDEVICE=pdfwrite",
+		"-dPDFA=" + level,
+		"-dPDFACompatibilityPolicy=1",
+		"-sColorConversionStrategy=RGB",
+		"-dNOPAUSE", "-dBATCH", "-dNOOUTERSAVE",
+		fmt.Sprintf("-sOutputFile=%s", out),
+	}
+	if def := config.Get("PDFA_DEF", ""); def != "" {
+		args = append(args, def)
+	}
+	args = append(args, path)
+
+	cmd := ExecCommand(args[0], args[1:]...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	release := acquireGS()
+	defer release()
+	err := cmd.Run()
+	procstats.Record(usage, "gs", cmd.ProcessState)
+	if err != nil {
+		return "", fmt.Errorf("ghostscript PDF/A conversion failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return out, nil
+}
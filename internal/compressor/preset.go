@@ -0,0 +1,81 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+// Compression presets
+const (
+	// PresetStandard compresses with GS_SETTINGS alone
+	PresetStandard = "standard"
+	// PresetDevice also downsamples images to what the tablet can show
+	PresetDevice = "device"
+	// PresetAuto uses PresetDevice for scanned, image-only PDFs and
+	// PresetStandard for everything else
+	PresetAuto = "auto"
+)
+
+// Options tune a single Ghostscript run
+type Options struct {
+	// ImageDPI downsamples color and grayscale images above this resolution.
+	// 0 leaves them to GS_SETTINGS.
+	ImageDPI int
+	// Usage, when set, collects the CPU time and memory Ghostscript used
+	Usage *procstats.Usage
+	// Context, when set, stops Ghostscript once it's done, e.g. when the
+	// job is cancelled
+	Context context.Context
+}
+
+func (o Options) args() []string {
+	if o.ImageDPI <= 0 {
+		return nil
+	}
+	var args []string
+	for _, kind := range []string{"Color", "Gray"} {
+		args = append(args,
+			fmt.Sprintf("-dDownsample%sImages=true", kind),
+			fmt.Sprintf("-d%sImageDownsampleType=/Bicubic", kind),
+			fmt.Sprintf("-d%sImageResolution=%d", kind, o.ImageDPI),
+			fmt.Sprintf("-d%sImageDownsampleThreshold=1.0", kind),
+		)
+	}
+	return args
+}
+
+// Preset returns the compression preset for a job: option if it names one,
+// otherwise COMPRESS_PRESET, defaulting to auto. Low resource mode defaults
+// to standard, skipping the image detection auto needs.
+func Preset(option string) string {
+	for _, p := range []string{option, config.Get("COMPRESS_PRESET", "")} {
+		switch p = strings.ToLower(strings.TrimSpace(p)); p {
+		case PresetStandard, PresetDevice, PresetAuto:
+			return p
+		}
+	}
+	if config.LowResource() {
+		return PresetStandard
+	}
+	return PresetAuto
+}
+
+// DeviceDPI returns the image resolution, in dots per inch, at which a page
+// of widthPt by heightPt points fills a screen of screenW by screenH pixels.
+// Landscape pages are fitted to the screen turned sideways. Detail beyond
+// this is never visible on the tablet.
+func DeviceDPI(widthPt, heightPt float64, screenW, screenH int) int {
+	if widthPt <= 0 || heightPt <= 0 || screenW <= 0 || screenH <= 0 {
+		return 0
+	}
+	if (widthPt > heightPt) != (screenW > screenH) {
+		screenW, screenH = screenH, screenW
+	}
+	dpi := math.Min(float64(screenW)*72/widthPt, float64(screenH)*72/heightPt)
+	return int(math.Ceil(dpi))
+}
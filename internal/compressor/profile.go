@@ -0,0 +1,82 @@
+package compressor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// Compression engines
+const (
+	EngineGS     = "gs"
+	EngineMutool = "mutool"
+)
+
+// Default argument templates for each engine. {downsample} expands to the
+// device preset's image downsampling flags, which only Ghostscript has.
+var defaultArgs = map[string]string{
+	EngineGS:     "-sDEVICE=pdfwrite -dCompatibilityLevel={compat} -dPDFSETTINGS={settings} -dNOPAUSE -dBATCH {downsample} -sOutputFile={output} {input}",
+	EngineMutool: "clean -gggz -i -f {input} {output}",
+}
+
+// Profile is the program and arguments a compression preset runs
+type Profile struct {
+	Engine string
+	Path   string
+	Args   string
+}
+
+// GSPath is the Ghostscript binary, from GS_PATH
+func GSPath() string {
+	return config.Get("GS_PATH", "gs")
+}
+
+// MutoolPath is the mutool binary, from MUTOOL_PATH
+func MutoolPath() string {
+	return config.Get("MUTOOL_PATH", "mutool")
+}
+
+// ProfileFor returns the profile for preset (standard or device). The engine
+// comes from COMPRESS_<PRESET>_ENGINE or COMPRESS_ENGINE, and the argument
+// template from COMPRESS_<PRESET>_ARGS or COMPRESS_ARGS, defaulting to the
+// engine's usual flags.
+func ProfileFor(preset string) (Profile, error) {
+	key := "COMPRESS_" + strings.ToUpper(preset) + "_"
+	engine := strings.ToLower(config.Get(key+"ENGINE", config.Get("COMPRESS_ENGINE", EngineGS)))
+	var p Profile
+	switch engine {
+	case EngineGS:
+		p = Profile{Engine: engine, Path: GSPath()}
+	case EngineMutool:
+		p = Profile{Engine: engine, Path: MutoolPath()}
+	default:
+		return Profile{}, fmt.Errorf("unknown compression engine %q, expected gs or mutool", engine)
+	}
+	p.Args = config.Get(key+"ARGS", config.Get("COMPRESS_ARGS", defaultArgs[engine]))
+	return p, nil
+}
+
+// command returns the arguments to compress input into output, filling in
+// the template's {input}, {output}, {compat}, {settings}, {dpi} and
+// {downsample} placeholders. Arguments are split on spaces; quoting isn't
+// supported.
+func (p Profile) command(input, output string, opts Options) []string {
+	vars := strings.NewReplacer(
+		"{input}", input,
+		"{output}", output,
+		"{compat}", config.Get("GS_COMPAT", "1.7"),
+		"{settings}", config.Get("GS_SETTINGS", "/ebook"),
+		"{dpi}", strconv.Itoa(opts.ImageDPI),
+	)
+	var args []string
+	for _, field := range strings.Fields(p.Args) {
+		if field == "{downsample}" {
+			args = append(args, opts.args()...)
+			continue
+		}
+		args = append(args, vars.Replace(field))
+	}
+	return args
+}
@@ -0,0 +1,75 @@
+package compressor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// imageSubtype matches an image XObject's dictionary. Images are streams,
+// which can't live in compressed object streams, so their dictionaries are
+// always readable in the file.
+var imageSubtype = regexp.MustCompile(`/Subtype\s*/Image\b`)
+
+// SkipReason reports whether compressing the PDF at path is likely a waste
+// of time, and why. Ghostscript gains little on files that are already small
+// (COMPRESS_SKIP_BELOW bytes), already dense (under COMPRESS_SKIP_BYTES_PER_PAGE
+// bytes a page) or have no images. COMPRESS_SKIP=false always compresses.
+func SkipReason(path string) (string, bool) {
+	if !config.GetBool("COMPRESS_SKIP", true) {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	size := info.Size()
+
+	if below := int64(config.GetInt("COMPRESS_SKIP_BELOW", 512*1024)); below > 0 && size < below {
+		return fmt.Sprintf("%d bytes is under the %d byte threshold", size, below), true
+	}
+
+	if found, err := hasImages(path); err == nil && !found {
+		return "no images", true
+	}
+
+	if perPage := int64(config.GetInt("COMPRESS_SKIP_BYTES_PER_PAGE", 25*1024)); perPage > 0 {
+		if pages, err := GetPDFPageCount(path); err == nil && pages > 0 && size/int64(pages) < perPage {
+			return fmt.Sprintf("%d bytes a page is under the %d byte threshold", size/int64(pages), perPage), true
+		}
+	}
+	return "", false
+}
+
+// hasImages reports whether the PDF at path contains an image XObject
+func hasImages(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// Scan in chunks, carrying a tail over so a match split across two
+	// chunks is still found
+	const overlap = 64
+	r := bufio.NewReader(f)
+	buf := make([]byte, 64*1024)
+	carry := 0
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		if imageSubtype.Match(buf[:carry+n]) {
+			return true, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		carry = copy(buf, buf[carry+n-overlap:carry+n])
+	}
+}
@@ -38,13 +38,21 @@ func GetInt(key string, def int) int {
 // Recognised true values are: 1, t, true, y, yes (case-insensitive).
 // Recognised false values are: 0, f, false, n, no.
 func GetBool(key string, def bool) bool {
-	if val := Get(key, ""); val != "" {
-		switch strings.ToLower(val) {
-		case "1", "t", "true", "y", "yes":
-			return true
-		case "0", "f", "false", "n", "no":
-			return false
-		}
+	return parseBool(Get(key, ""), def)
+}
+
+// BoolOption returns a per-request option parsed like GetBool, falling back
+// to the environment variable `key` when the option is empty or unrecognised.
+func BoolOption(option, key string, def bool) bool {
+	return parseBool(strings.TrimSpace(option), GetBool(key, def))
+}
+
+func parseBool(val string, def bool) bool {
+	switch strings.ToLower(val) {
+	case "1", "t", "true", "y", "yes":
+		return true
+	case "0", "f", "false", "n", "no":
+		return false
 	}
 	return def
 }
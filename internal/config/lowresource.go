@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+// LowResource reports whether LOW_RESOURCE_MODE is on. It tunes Aviary for
+// Raspberry Pi-class hosts: jobs and Ghostscript run one at a time, PDFs get
+// the standard compression preset and ImageMagick is kept to a small memory
+// budget, trading speed for staying within RAM.
+func LowResource() bool {
+	return GetBool("LOW_RESOURCE_MODE", false)
+}
+
+// ApplyLowResourceLimits gives the Go runtime a soft memory limit in low
+// resource mode, from LOW_RESOURCE_MEMORY_LIMIT in MB (default 256), so it
+// collects garbage before the host starts swapping. GOMEMLIMIT takes
+// precedence. It returns the limit set in bytes, or 0 if none was.
+func ApplyLowResourceLimits() int64 {
+	if !LowResource() || os.Getenv("GOMEMLIMIT") != "" {
+		return 0
+	}
+	limit := int64(GetInt("LOW_RESOURCE_MEMORY_LIMIT", 256)) << 20
+	if limit <= 0 {
+		return 0
+	}
+	debug.SetMemoryLimit(limit)
+	return limit
+}
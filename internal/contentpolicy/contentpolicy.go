@@ -0,0 +1,87 @@
+// Package contentpolicy decides which kinds of content a user may send.
+// Admins list the blocked kinds per user, or for every non-admin user with the
+// blocked_content_types system setting; uploads of a blocked kind are turned
+// away before they are saved and jobs fail before any work is done.
+package contentpolicy
+
+import (
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+)
+
+// SettingKey is the system setting listing the kinds non-admin users without
+// their own list may not send
+const SettingKey = "blocked_content_types"
+
+// Kinds of content that can be blocked
+const (
+	PDF      = "pdf"
+	EPUB     = "epub"
+	Image    = "image"
+	Office   = "office"
+	Markdown = "markdown"
+	HTML     = "html"
+	WebPage  = "webpage"
+)
+
+// Kinds are all the kinds that can be blocked
+var Kinds = []string{PDF, EPUB, Image, Office, Markdown, HTML, WebPage}
+
+// Parse returns the kinds in a comma-separated list, or false if it names one
+// that doesn't exist. "none" is an empty list.
+func Parse(value string) ([]string, bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "none") {
+		return nil, true
+	}
+	var kinds []string
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind == "" {
+			continue
+		}
+		known := false
+		for _, k := range Kinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, false
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, true
+}
+
+// BlockedFor returns the kinds user may not send: their own list when an
+// admin gave them one ("none" blocks nothing), otherwise the
+// blocked_content_types setting unless they're an admin. Nothing is blocked
+// in single-user mode.
+func BlockedFor(user *database.User) []string {
+	if !database.IsMultiUserMode() || user == nil {
+		return nil
+	}
+	value := user.BlockedContentTypes
+	if value == "" {
+		if user.IsAdmin {
+			return nil
+		}
+		value, _ = database.GetSystemSetting(SettingKey)
+	}
+	kinds, _ := Parse(value)
+	return kinds
+}
+
+// Blocked reports whether user may not send content of kind. An unknown
+// kind ("") is never blocked.
+func Blocked(user *database.User, kind string) bool {
+	if kind == "" {
+		return false
+	}
+	for _, k := range BlockedFor(user) {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
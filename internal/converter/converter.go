@@ -12,6 +12,7 @@ import (
 
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/procstats"
 )
 
 // defaultRemarkable2Resolution and defaultRemarkable2DPI are Remarkable 2’s
@@ -53,6 +54,15 @@ func parseResolutionString(raw string) (widthPx int, heightPx int, err error) {
 	return w, h, nil
 }
 
+// ScreenResolution returns the page resolution in pixels documents are laid
+// out at: resolution if set, otherwise PAGE_RESOLUTION.
+func ScreenResolution(resolution string) (widthPx int, heightPx int, err error) {
+	if resolution != "" {
+		return parseResolutionString(resolution)
+	}
+	return parseEnvResolution()
+}
+
 // parseEnvDPI reads PAGE_DPI (dots per inch) from the environment.
 // If unset or malformed, it falls back to defaultRemarkable2DPI.
 // Returns (dpi, error).
@@ -133,14 +143,16 @@ func ConvertImageToPDF(imgPath string) (string, error) {
 		outPDF,
 	}
 	logging.Logf("[CONVERT] ConvertImageToPDF: running ImageMagick convert with args: %v", args)
-	cmd := exec.Command("convert", args...)
+	cmd := exec.Command("convert", append(imageMagickLimits(), args...)...)
 
 	// Capture combined stdout+stderr so we can log if conversion fails:
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
 
-	if outputErr := cmd.Run(); outputErr != nil {
+	outputErr := cmd.Run()
+	procstats.Record(nil, "convert", cmd.ProcessState)
+	if outputErr != nil {
 		// Dump the full convert output for diagnosis:
 		logging.Logf("[CONVERT] ConvertImageToPDF: ImageMagick output:\n%s", buf.String())
 		return "", fmt.Errorf("imagemagick convert failed (exit: %v): %s", outputErr, buf.String())
@@ -201,14 +213,16 @@ func ConvertImageToPDFWithSettings(imgPath, resolution string, dpi float64) (str
 		outPDF,
 	}
 	logging.Logf("[CONVERT] ConvertImageToPDFWithSettings: running ImageMagick convert with args: %v", args)
-	cmd := exec.Command("convert", args...)
+	cmd := exec.Command("convert", append(imageMagickLimits(), args...)...)
 
 	// Capture combined stdout+stderr so we can log if conversion fails:
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
 
-	if outputErr := cmd.Run(); outputErr != nil {
+	outputErr := cmd.Run()
+	procstats.Record(nil, "convert", cmd.ProcessState)
+	if outputErr != nil {
 		// Dump the full convert output for diagnosis:
 		logging.Logf("[CONVERT] ConvertImageToPDFWithSettings: ImageMagick output:\n%s", buf.String())
 		return "", fmt.Errorf("imagemagick convert failed (exit: %v): %s", outputErr, buf.String())
@@ -217,3 +231,35 @@ func ConvertImageToPDFWithSettings(imgPath, resolution string, dpi float64) (str
 	logging.Logf("[CONVERT] ConvertImageToPDFWithSettings: successfully created PDF = %s", outPDF)
 	return outPDF, nil
 }
+
+// imageMagickLimits keeps ImageMagick within a small memory budget in low
+// resource mode, spilling large images to disk instead
+func imageMagickLimits() []string {
+	if !config.LowResource() {
+		return nil
+	}
+	return []string{"-limit", "memory", "64MiB", "-limit", "map", "128MiB"}
+}
+
+// ConvertPostScriptToPDF renders a PostScript file to PDF with Ghostscript,
+// writing it alongside the input (basename + ".pdf") and returning its path.
+func ConvertPostScriptToPDF(psPath string) (string, error) {
+	ext := filepath.Ext(psPath)
+	outPDF := strings.TrimSuffix(psPath, ext) + ".pdf"
+	if outPDF == psPath {
+		outPDF = strings.TrimSuffix(psPath, ext) + "_converted.pdf"
+	}
+
+	args := []string{"-sDEVICE=pdfwrite", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-sOutputFile=" + outPDF, psPath}
+	cmd := exec.Command(config.Get("GS_PATH", "gs"), args...)
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	procstats.Record(nil, "gs", cmd.ProcessState)
+	if err != nil {
+		logging.Logf("[CONVERT] ConvertPostScriptToPDF: Ghostscript output:\n%s", buf.String())
+		return "", fmt.Errorf("ghostscript failed (exit: %v): %s", err, buf.String())
+	}
+	return outPDF, nil
+}
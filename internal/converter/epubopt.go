@@ -0,0 +1,326 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+// minEPUBImageSize is the size below which images are left alone, as
+// re-encoding them saves next to nothing
+const minEPUBImageSize = 64 * 1024
+
+// EPUBOptimizeOptions control OptimizeEPUB
+type EPUBOptimizeOptions struct {
+	// MaxWidth and MaxHeight are the pixel size images are shrunk to fit,
+	// keeping their aspect ratio. Smaller images aren't enlarged.
+	MaxWidth, MaxHeight int
+	// Quality is the JPEG quality images are re-encoded at
+	Quality int
+	// StripFonts removes embedded fonts, leaving the reader's own
+	StripFonts bool
+	// Context stops ImageMagick when it's cancelled
+	Context context.Context
+	// Usage collects the CPU time and memory ImageMagick used
+	Usage *procstats.Usage
+	// Progress is called after each image with how many of them are done
+	Progress func(done, total int)
+}
+
+var (
+	// epubTextFiles may refer to images and fonts by name
+	epubTextFiles = map[string]bool{".opf": true, ".xhtml": true, ".html": true, ".htm": true, ".css": true, ".ncx": true, ".xml": true, ".svg": true}
+	// epubFontFiles are removed by StripFonts
+	epubFontFiles = map[string]bool{".ttf": true, ".otf": true, ".woff": true, ".woff2": true}
+	fontFaceRule  = regexp.MustCompile(`(?s)@font-face\s*\{[^}]*\}`)
+	manifestItem  = regexp.MustCompile(`<item\b[^>]*>`)
+)
+
+// OptimizeEPUB rewrites the EPUB at epubPath with its images shrunk to fit
+// MaxWidth×MaxHeight and re-encoded with ImageMagick's convert, opaque PNGs
+// turned into JPEGs, and, with StripFonts, its embedded fonts removed. Images
+// that wouldn't get smaller are kept as they are. It writes alongside the
+// input (basename + "_optimized.epub") and returns its path.
+func OptimizeEPUB(epubPath string, opts EPUBOptimizeOptions) (string, error) {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	r, err := zip.OpenReader(epubPath)
+	if err != nil {
+		return "", fmt.Errorf("open epub: %w", err)
+	}
+	defer r.Close()
+
+	workDir, err := os.MkdirTemp(filepath.Dir(epubPath), "epub-optimize-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	names := make(map[string]bool, len(r.File))
+	var images []*zip.File
+	for _, f := range r.File {
+		names[f.Name] = true
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".jpg", ".jpeg", ".png":
+			if f.UncompressedSize64 >= minEPUBImageSize {
+				images = append(images, f)
+			}
+		}
+	}
+
+	// Re-encoded images, keyed by their new name, and the images renamed
+	// from .png to .jpg
+	replaced := make(map[string]string)
+	renamed := make(map[string]string)
+	for i, f := range images {
+		out, newName, err := shrinkEPUBImage(f, names, workDir, i, opts)
+		if err != nil {
+			return "", err
+		}
+		if out != "" {
+			replaced[newName] = out
+			if newName != f.Name {
+				renamed[f.Name] = newName
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(images))
+		}
+	}
+
+	outPath := strings.TrimSuffix(epubPath, filepath.Ext(epubPath)) + "_optimized.epub"
+	if err := writeOptimizedEPUB(r, outPath, replaced, renamed, opts.StripFonts); err != nil {
+		os.Remove(outPath)
+		return "", err
+	}
+	logging.Logf("[CONVERT] OptimizeEPUB: re-encoded %d of %d images in %s", len(replaced), len(images), filepath.Base(epubPath))
+	return outPath, nil
+}
+
+// shrinkEPUBImage re-encodes one image into workDir, returning the file and
+// the name it takes in the EPUB, or "" when the result isn't smaller
+func shrinkEPUBImage(f *zip.File, names map[string]bool, workDir string, n int, opts EPUBOptimizeOptions) (string, string, error) {
+	ext := strings.ToLower(path.Ext(f.Name))
+	in := filepath.Join(workDir, strconv.Itoa(n)+ext)
+	if err := extractZipFile(f, in); err != nil {
+		return "", "", err
+	}
+
+	newName, outExt := f.Name, ext
+	if ext == ".png" {
+		jpgName := strings.TrimSuffix(f.Name, path.Ext(f.Name)) + ".jpg"
+		if !names[jpgName] && imageOpaque(opts.Context, in, opts.Usage) {
+			newName, outExt = jpgName, ".jpg"
+		}
+	}
+	out := filepath.Join(workDir, strconv.Itoa(n)+"_out"+outExt)
+
+	args := []string{in, "-resize", fmt.Sprintf("%dx%d>", opts.MaxWidth, opts.MaxHeight), "-strip"}
+	if outExt != ".png" {
+		args = append(args, "-quality", strconv.Itoa(opts.Quality))
+	}
+	cmd := exec.CommandContext(opts.Context, "convert", append(imageMagickLimits(), append(args, out)...)...)
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	procstats.Record(opts.Usage, "convert", cmd.ProcessState)
+	if err != nil {
+		if opts.Context.Err() != nil {
+			return "", "", opts.Context.Err()
+		}
+		// A broken image is left for the reader to deal with
+		logging.Logf("[CONVERT] OptimizeEPUB: could not re-encode %s: %v: %s", f.Name, err, buf.String())
+		return "", "", nil
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		return "", "", err
+	}
+	if uint64(info.Size()) >= f.UncompressedSize64 {
+		return "", "", nil
+	}
+	return out, newName, nil
+}
+
+// imageOpaque reports whether the image at path has no transparent pixels,
+// so it can become a JPEG
+func imageOpaque(ctx context.Context, path string, usage *procstats.Usage) bool {
+	cmd := exec.CommandContext(ctx, "convert", append(imageMagickLimits(), path, "-format", "%[opaque]", "info:")...)
+	output, err := cmd.Output()
+	procstats.Record(usage, "convert", cmd.ProcessState)
+	return err == nil && strings.EqualFold(strings.TrimSpace(string(output)), "true")
+}
+
+func extractZipFile(f *zip.File, dst string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeOptimizedEPUB copies r to outPath with the re-encoded images, the
+// references to renamed images updated and, with stripFonts, the fonts and
+// their @font-face rules and manifest entries left out. The mimetype entry
+// stays first and uncompressed, as EPUB readers require.
+func writeOptimizedEPUB(r *zip.ReadCloser, outPath string, replaced, renamed map[string]string, stripFonts bool) error {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := zip.NewWriter(out)
+
+	var fonts []string
+	if stripFonts {
+		for _, f := range r.File {
+			if epubFontFiles[strings.ToLower(path.Ext(f.Name))] {
+				fonts = append(fonts, path.Base(f.Name))
+			}
+		}
+	}
+
+	for _, f := range r.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		switch {
+		case f.Name == "mimetype":
+			if err := copyZipFile(w, f, zip.Store, nil); err != nil {
+				return err
+			}
+		case stripFonts && epubFontFiles[ext]:
+			continue
+		case renamed[f.Name] != "" || replaced[f.Name] != "":
+			name := f.Name
+			if n := renamed[f.Name]; n != "" {
+				name = n
+			}
+			if err := addZipFile(w, name, replaced[name]); err != nil {
+				return err
+			}
+		case epubTextFiles[ext] && (len(renamed) > 0 || len(fonts) > 0):
+			rewrite := func(b []byte) []byte { return rewriteEPUBText(b, ext, renamed, fonts) }
+			if err := copyZipFile(w, f, zip.Deflate, rewrite); err != nil {
+				return err
+			}
+		default:
+			if err := copyRawZipFile(w, f); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// rewriteEPUBText points references to renamed images at their new name and
+// drops the given fonts' manifest entries and @font-face rules
+func rewriteEPUBText(b []byte, ext string, renamed map[string]string, fonts []string) []byte {
+	s := string(b)
+	for oldName, newName := range renamed {
+		oldBase, newBase := path.Base(oldName), path.Base(newName)
+		ref := regexp.MustCompile(`([/"'(])` + regexp.QuoteMeta(oldBase) + `([#?"')])`)
+		s = ref.ReplaceAllString(s, "${1}"+newBase+"${2}")
+		if ext == ".opf" {
+			s = manifestItem.ReplaceAllStringFunc(s, func(item string) string {
+				if strings.Contains(item, newBase) {
+					return strings.Replace(item, "image/png", "image/jpeg", 1)
+				}
+				return item
+			})
+		}
+	}
+	if len(fonts) > 0 {
+		if ext == ".opf" {
+			s = manifestItem.ReplaceAllStringFunc(s, func(item string) string {
+				for _, font := range fonts {
+					if strings.Contains(item, "/"+font+`"`) || strings.Contains(item, `"`+font+`"`) {
+						return ""
+					}
+				}
+				return item
+			})
+		}
+		s = fontFaceRule.ReplaceAllString(s, "")
+	}
+	return []byte(s)
+}
+
+// copyZipFile copies f into w with method, passing its content through
+// rewrite when it's set
+func copyZipFile(w *zip.Writer, f *zip.File, method uint16, rewrite func([]byte) []byte) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if rewrite != nil {
+		content = rewrite(content)
+	}
+	dst, err := w.CreateHeader(&zip.FileHeader{Name: f.Name, Method: method, Modified: f.Modified})
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(content)
+	return err
+}
+
+// copyRawZipFile copies f into w without recompressing it
+func copyRawZipFile(w *zip.Writer, f *zip.File) error {
+	rc, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	header := f.FileHeader
+	dst, err := w.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, rc)
+	return err
+}
+
+// addZipFile adds the file at src to w as name. Images are already
+// compressed, so they're stored.
+func addZipFile(w *zip.Writer, name, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dst, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, in)
+	return err
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/procstats"
 )
 
 // PDFOptions contains options for PDF generation
@@ -27,6 +28,7 @@ type PDFOptions struct {
 	MarginRight  string
 	DPI          uint   // Dots per inch for rendering
 	SourceURL    string
+	Usage        *procstats.Usage // collects what mutool used, when set
 }
 
 // defaultPDFCSS provides readable styling for PDF content optimized for reMarkable
@@ -139,7 +141,27 @@ func ConvertHTMLToPDF(htmlContent string, outputPath string, options PDFOptions)
 
 	// Step 2: Convert EPUB to PDF using mutool
 	logging.Logf("[HTMLPDF] Step 2: Converting EPUB to PDF using mutool")
+	if err := renderEPUBToPDF(tempEPUBPath, outputPath, options); err != nil {
+		return err
+	}
 
+	logging.Logf("[HTMLPDF] ConvertHTMLToPDF: successfully created PDF")
+	return nil
+}
+
+// ConvertEPUBToPDF lays out an EPUB as a PDF at the page size in options and
+// returns the path of the PDF, which is written next to the EPUB
+func ConvertEPUBToPDF(epubPath string, options PDFOptions) (string, error) {
+	pdfPath := strings.TrimSuffix(epubPath, filepath.Ext(epubPath)) + ".pdf"
+	logging.Logf("[HTMLPDF] ConvertEPUBToPDF: converting %s", epubPath)
+	if err := renderEPUBToPDF(epubPath, pdfPath, options); err != nil {
+		return "", err
+	}
+	return pdfPath, nil
+}
+
+// renderEPUBToPDF runs mutool to lay out epubPath as a PDF at outputPath
+func renderEPUBToPDF(epubPath, outputPath string, options PDFOptions) error {
 	// Calculate page dimensions from PageSize or default to A4
 	width, height := getPageDimensions(options.PageSize, options.DPI)
 
@@ -151,23 +173,23 @@ func ConvertHTMLToPDF(htmlContent string, outputPath string, options PDFOptions)
 		"-H", strings.TrimSuffix(height, "pt"),
 		"-F", "pdf",
 		"-o", outputPath,
-		tempEPUBPath,
+		epubPath,
 	}
 
 	logging.Logf("[HTMLPDF] Running mutool with args: %v", args)
 
 	// Execute mutool
-	cmd := exec.Command("mutool", args...)
+	cmd := exec.Command(config.Get("MUTOOL_PATH", "mutool"), args...)
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
 
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	procstats.Record(options.Usage, "mutool", cmd.ProcessState)
+	if err != nil {
 		logging.Logf("[HTMLPDF] mutool output:\n%s", buf.String())
 		return fmt.Errorf("mutool conversion failed: %w: %s", err, buf.String())
 	}
-
-	logging.Logf("[HTMLPDF] ConvertHTMLToPDF: successfully created PDF")
 	return nil
 }
 
@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+// OfficeContentTypes maps the office formats LibreOffice converts to their
+// file extensions
+var OfficeContentTypes = map[string]string{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/vnd.oasis.opendocument.text":                                   ".odt",
+}
+
+// IsOfficeDocument reports whether path is a .docx, .odt or .pptx file
+func IsOfficeDocument(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".docx", ".odt", ".pptx":
+		return true
+	}
+	return false
+}
+
+// ConvertOfficeToPDF converts a .docx, .odt or .pptx file to PDF with
+// LibreOffice in headless mode (LIBREOFFICE_PATH, default "soffice"), writing
+// it alongside the input (basename + ".pdf") and returning its path. Each run
+// gets its own LibreOffice profile so conversions can run in parallel, and is
+// stopped after OFFICE_CONVERT_TIMEOUT (default 2m).
+func ConvertOfficeToPDF(docPath string) (string, error) {
+	outDir, err := os.MkdirTemp("", "aviary-office-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(outDir)
+	profile := filepath.Join(outDir, "profile")
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetDuration("OFFICE_CONVERT_TIMEOUT", 2*time.Minute))
+	defer cancel()
+
+	args := []string{
+		"-env:UserInstallation=" + (&url.URL{Scheme: "file", Path: profile}).String(),
+		"--headless", "--norestore", "--nologo",
+		"--convert-to", "pdf",
+		"--outdir", outDir,
+		docPath,
+	}
+	cmd := exec.CommandContext(ctx, config.Get("LIBREOFFICE_PATH", "soffice"), args...)
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err = cmd.Run()
+	procstats.Record(nil, "soffice", cmd.ProcessState)
+	if err != nil {
+		logging.Logf("[CONVERT] ConvertOfficeToPDF: LibreOffice output:\n%s", buf.String())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("libreoffice timed out converting %s", filepath.Base(docPath))
+		}
+		return "", fmt.Errorf("libreoffice failed (exit: %v): %s", err, buf.String())
+	}
+
+	// LibreOffice exits 0 even when it couldn't load the file, so check
+	// that the PDF was written
+	base := strings.TrimSuffix(filepath.Base(docPath), filepath.Ext(docPath))
+	converted := filepath.Join(outDir, base+".pdf")
+	if _, err := os.Stat(converted); err != nil {
+		logging.Logf("[CONVERT] ConvertOfficeToPDF: LibreOffice output:\n%s", buf.String())
+		return "", fmt.Errorf("libreoffice produced no PDF for %s", filepath.Base(docPath))
+	}
+
+	outPDF := strings.TrimSuffix(docPath, filepath.Ext(docPath)) + ".pdf"
+	if err := moveFile(converted, outPDF); err != nil {
+		return "", err
+	}
+	logging.Logf("[CONVERT] ConvertOfficeToPDF: successfully created PDF = %s", outPDF)
+	return outPDF, nil
+}
+
+// moveFile renames src to dst, copying when they're on different filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
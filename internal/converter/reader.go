@@ -16,6 +16,8 @@ import (
 	"github.com/rmitchellscott/aviary/internal/downloader"
 	"github.com/rmitchellscott/aviary/internal/logging"
 	"github.com/rmitchellscott/aviary/internal/security"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // ArticleContent represents the extracted clean article content
@@ -48,47 +50,11 @@ func articleToContent(article readability.Article) (*ArticleContent, error) {
 func ExtractFromURL(urlStr string) (*ArticleContent, error) {
 	logging.Logf("[READER] ExtractFromURL: fetching %s", urlStr)
 
-	// Validate URL for SSRF protection
-	if err := security.ValidateURL(urlStr); err != nil {
-		return nil, fmt.Errorf("URL validation failed: %w", err)
-	}
-
-	// Parse URL for readability
-	parsedURL, err := url.Parse(urlStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid URL %q: %w", urlStr, err)
-	}
-
-	// Fetch the webpage with timeout and realistic User-Agent
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("User-Agent", downloader.PickUA())
-
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	// codeql[go/request-forgery]: URL is validated by security.ValidateURL above
-	resp, err := client.Do(req)
+	page, pageURL, err := downloader.FetchPage(urlStr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d when fetching URL", resp.StatusCode)
-	}
-
-	// Parse with readability
-	article, err := readability.FromReader(resp.Body, parsedURL)
-	if err != nil {
-		return nil, fmt.Errorf("readability extraction failed: %w", err)
-	}
-
-	logging.Logf("[READER] ExtractFromURL: successfully extracted article %q", article.Title())
-
-	return articleToContent(article)
+	return ExtractFromHTMLString(page, pageURL)
 }
 
 // ExtractFromHTML reads an HTML file from disk and extracts readable article content.
@@ -148,6 +114,84 @@ func ExtractFromHTMLString(html string, baseURL *url.URL) (*ArticleContent, erro
 	return articleToContent(article)
 }
 
+// PageFromHTMLString returns a whole web page as ArticleContent, for pages
+// readability would strip too much from. Only what can't be rendered, such as
+// scripts and styles, is removed, and links and images are made absolute
+// against baseURL.
+func PageFromHTMLString(htmlContent string, baseURL *url.URL) (*ArticleContent, error) {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	var title string
+	var body *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode {
+				switch c.DataAtom {
+				case atom.Script, atom.Style, atom.Noscript, atom.Iframe, atom.Object,
+					atom.Embed, atom.Template, atom.Link, atom.Meta, atom.Form:
+					n.RemoveChild(c)
+					c = next
+					continue
+				case atom.Title:
+					if title == "" && c.FirstChild != nil {
+						title = strings.TrimSpace(c.FirstChild.Data)
+					}
+				case atom.Body:
+					body = c
+				}
+				resolvePageLinks(c, baseURL)
+			}
+			walk(c)
+			c = next
+		}
+	}
+	walk(doc)
+
+	var buf bytes.Buffer
+	if body == nil {
+		body = doc
+	}
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return nil, fmt.Errorf("failed to render page HTML: %w", err)
+		}
+	}
+
+	logging.Logf("[READER] PageFromHTMLString: kept whole page %q", title)
+
+	pageHTML := buf.String()
+	return &ArticleContent{
+		HTML:   pageHTML,
+		Title:  title,
+		Images: extractImageURLs(pageHTML),
+	}, nil
+}
+
+// resolvePageLinks makes the link and image URLs of n absolute. srcset is
+// dropped so the plain src is the image that's fetched.
+func resolvePageLinks(n *html.Node, baseURL *url.URL) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "srcset":
+			continue
+		case "src", "href":
+			if baseURL != nil {
+				if ref, err := url.Parse(strings.TrimSpace(a.Val)); err == nil {
+					a.Val = baseURL.ResolveReference(ref).String()
+				}
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
 // extractImageURLs finds all image URLs in the HTML content.
 // This is a simple implementation that looks for <img src="..."> tags.
 func extractImageURLs(html string) []string {
@@ -113,8 +113,22 @@ func (s *APIKeyService) ValidateAPIKey(apiKey string) (*User, error) {
 
 // ValidateAPIKeyConstantTime validates an API key with constant time comparison
 func (s *APIKeyService) ValidateAPIKeyConstantTime(providedKey string) (*User, error) {
+	user, key, err := s.AuthenticateAPIKey(providedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update last used timestamp
+	s.db.Model(key).Update("last_used", time.Now())
+
+	return user, nil
+}
+
+// AuthenticateAPIKey validates an API key with constant time comparison and
+// returns both the user and the matching key, without recording usage
+func (s *APIKeyService) AuthenticateAPIKey(providedKey string) (*User, *APIKey, error) {
 	if !strings.HasPrefix(providedKey, "aviary_") {
-		return nil, errors.New("invalid API key format")
+		return nil, nil, errors.New("invalid API key format")
 	}
 	
 	// Get the prefix to narrow down the search
@@ -130,20 +144,19 @@ func (s *APIKeyService) ValidateAPIKeyConstantTime(providedKey string) (*User, e
 	}
 	
 	if err := query.Find(&apiKeys).Error; err != nil {
-		return nil, fmt.Errorf("failed to query API keys: %w", err)
+		return nil, nil, fmt.Errorf("failed to query API keys: %w", err)
 	}
 	
 	var foundUser *User
+	var foundKey *APIKey
 	validKey := false
 	
 	// Check all keys with constant time comparison
-	for _, key := range apiKeys {
+	for i, key := range apiKeys {
 		if err := bcrypt.CompareHashAndPassword([]byte(key.KeyHash), []byte(providedKey)); err == nil {
 			if !validKey { // Only set once to maintain constant time
 				validKey = true
-				
-				// Update last used timestamp
-				s.db.Model(&key).Update("last_used", time.Now())
+				foundKey = &apiKeys[i]
 				
 				// Get the user
 				var user User
@@ -155,10 +168,25 @@ func (s *APIKeyService) ValidateAPIKeyConstantTime(providedKey string) (*User, e
 	}
 	
 	if !validKey || foundUser == nil {
-		return nil, errors.New("invalid API key")
+		return nil, nil, errors.New("invalid API key")
 	}
 	
-	return foundUser, nil
+	return foundUser, foundKey, nil
+}
+
+// RecordAPIKeyUsage stores when, from where and against which endpoint a key was last used
+func (s *APIKeyService) RecordAPIKeyUsage(keyID uuid.UUID, ip, endpoint string) error {
+	if len(ip) > 45 {
+		ip = ip[:45]
+	}
+	if len(endpoint) > 255 {
+		endpoint = endpoint[:255]
+	}
+	return s.db.Model(&APIKey{}).Where("id = ?", keyID).Updates(map[string]interface{}{
+		"last_used":          time.Now(),
+		"last_used_ip":       ip,
+		"last_used_endpoint": endpoint,
+	}).Error
 }
 
 // GetUserAPIKeys retrieves all API keys for a user
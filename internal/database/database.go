@@ -210,11 +210,41 @@ func initializeSystemSettings() error {
 			Value:       "10",
 			Description: "Maximum API keys per user",
 		},
+		"max_upload_mb": {
+			Key:         "max_upload_mb",
+			Value:       "0",
+			Description: "Largest file users may upload in MB (0 uses MAX_UPLOAD_SIZE)",
+		},
+		"blocked_content_types": {
+			Key:         "blocked_content_types",
+			Value:       "",
+			Description: "Comma-separated content kinds non-admin users may not send (pdf, epub, image, office, markdown, html, webpage)",
+		},
 		"password_reset_timeout_hours": {
 			Key:         "password_reset_timeout_hours",
 			Value:       "24",
 			Description: "Password reset token timeout in hours",
 		},
+		"backup_retention_days": {
+			Key:         "backup_retention_days",
+			Value:       "0",
+			Description: "Days to keep completed backups before they are deleted (0 keeps them until deleted manually)",
+		},
+		"restore_upload_retention_hours": {
+			Key:         "restore_upload_retention_hours",
+			Value:       "24",
+			Description: "Hours to keep uploaded restore files before they expire",
+		},
+		"maintenance_mode": {
+			Key:         "maintenance_mode",
+			Value:       "false",
+			Description: "Whether new job submissions are rejected for maintenance",
+		},
+		"public_status_fields": {
+			Key:         "public_status_fields",
+			Value:       "health,version,registration",
+			Description: "What the unauthenticated status endpoint shows (health, version, registration, or none)",
+		},
 	}
 
 	for _, setting := range defaultSettings {
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DocumentQuery selects a page of a user's upload history. Empty filters
+// match every document.
+type DocumentQuery struct {
+	Status       string
+	DocumentType string
+	From         *time.Time
+	To           *time.Time
+	Labels       map[string]string // documents must carry every one of these labels
+	Order        string
+	Offset       int
+	Limit        int
+}
+
+// ListDocuments returns one page of userID's documents and the total number
+// matching the query's filters
+func (s *UserService) ListDocuments(userID uuid.UUID, q DocumentQuery) ([]Document, int64, error) {
+	query := s.db.Model(&Document{}).Where("user_id = ?", userID)
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.DocumentType != "" {
+		query = query.Where("UPPER(document_type) = UPPER(?)", q.DocumentType)
+	}
+	if q.From != nil {
+		query = query.Where("upload_date >= ?", *q.From)
+	}
+	if q.To != nil {
+		query = query.Where("upload_date < ?", *q.To)
+	}
+	for key, value := range q.Labels {
+		query = query.Where(`labels LIKE ? ESCAPE '\'`, labelPattern(key, value))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := q.Order
+	if order == "" {
+		order = "upload_date DESC"
+	}
+	var docs []Document
+	err := query.Order(order).Offset(q.Offset).Limit(q.Limit).Find(&docs).Error
+	return docs, total, err
+}
+
+// GetDocument returns one of userID's documents
+func (s *UserService) GetDocument(userID, documentID uuid.UUID) (*Document, error) {
+	var doc Document
+	if err := s.db.Where("id = ? AND user_id = ?", documentID, userID).First(&doc).Error; err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// DeleteDocument removes one of userID's documents from their history. It
+// doesn't touch the copy on the reMarkable.
+func (s *UserService) DeleteDocument(userID, documentID uuid.UUID) error {
+	result := s.db.Where("id = ? AND user_id = ?", documentID, userID).Delete(&Document{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// LabelCounts returns how many of userID's documents carry each label, keyed
+// "key=value"
+func (s *UserService) LabelCounts(userID uuid.UUID) (map[string]int64, error) {
+	var rows []string
+	if err := s.db.Model(&Document{}).Where("user_id = ? AND labels <> ''", userID).Pluck("labels", &rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		var labels map[string]string
+		if json.Unmarshal([]byte(row), &labels) != nil {
+			continue
+		}
+		for k, v := range labels {
+			counts[k+"="+v]++
+		}
+	}
+	return counts, nil
+}
+
+// ArchivedDocuments returns userID's documents that have an archived copy,
+// by reMarkable path
+func (s *UserService) ArchivedDocuments(userID uuid.UUID) ([]Document, error) {
+	var docs []Document
+	err := s.db.Where("user_id = ? AND archive_key <> ''", userID).Order("remote_path").Find(&docs).Error
+	return docs, err
+}
+
+// UploadedDocuments returns userID's documents that record where they were
+// put on the reMarkable, oldest first
+func (s *UserService) UploadedDocuments(userID uuid.UUID) ([]Document, error) {
+	var docs []Document
+	err := s.db.Where("user_id = ? AND remote_path <> ''", userID).Order("upload_date").Find(&docs).Error
+	return docs, err
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Limits on the labels a job can carry
+const (
+	MaxLabels           = 10
+	maxLabelKeyLength   = 40
+	maxLabelValueLength = 100
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ParseLabels parses labels given as "key=value" pairs separated by commas,
+// e.g. "source=rss,project=thesis". Keys are letters, digits, "_", "." and
+// "-"; values may contain anything but commas, quotes, backslashes, "<", ">",
+// "&" and control characters, so they can be matched inside the stored JSON.
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("label %q must be key=value", pair)
+		}
+		if err := validateLabel(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	if len(labels) > MaxLabels {
+		return nil, fmt.Errorf("at most %d labels are allowed", MaxLabels)
+	}
+	return labels, nil
+}
+
+func validateLabel(key, value string) error {
+	if len(key) > maxLabelKeyLength || !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	if len(value) > maxLabelValueLength || strings.ContainsAny(value, "\"\\<>&,\u2028\u2029") {
+		return fmt.Errorf("invalid value for label %q", key)
+	}
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("invalid value for label %q", key)
+		}
+	}
+	return nil
+}
+
+// FormatLabels returns labels in the form ParseLabels reads, sorted by key
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// LabelsJSON returns labels as a JSON object for Document.Labels, or "" if
+// there are none
+func LabelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// ParseLabelFilter parses a "key:value" label filter from a listing query
+func ParseLabelFilter(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, ":")
+	if !ok || value == "" {
+		return "", "", fmt.Errorf("label filter %q must be key:value", s)
+	}
+	if err := validateLabel(key, value); err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// labelPattern returns a LIKE pattern, escaped with "\", matching documents
+// whose Labels JSON has key set to value. Validated labels hold no quotes,
+// so the quoted pair can't match across two labels.
+func labelPattern(key, value string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(`"`+key+`":"`+value+`"`) + "%"
+}
@@ -41,7 +41,7 @@ func MigrateToMultiUser() error {
 	email := config.Get("ADMIN_EMAIL", "")
 
 	if username == "" || password == "" {
-		logging.Logf("[STARTUP] No admin user configured - navigate to /register to create the first admin account")
+		logging.Logf("[STARTUP] No admin user configured - open Aviary to run the setup wizard (POST /api/setup/admin) and create the first admin account")
 		return nil
 	}
 
@@ -174,6 +174,47 @@ func RunMigrations(logPrefix string) error {
 				return tx.Migrator().DropColumn(&User{}, "rmapi_config")
 			},
 		},
+		{
+			ID: "202508030001_clear_legacy_backup_expiry",
+			Migrate: func(tx *gorm.DB) error {
+				// Backups used to be stamped with a 24h expiry that was never enforced.
+				// Clear it so existing backups follow backup_retention_days instead of
+				// being removed on the first retention sweep.
+				if !tx.Migrator().HasColumn(&BackupJob{}, "retention_days") {
+					if err := tx.Migrator().AddColumn(&BackupJob{}, "RetentionDays"); err != nil {
+						return fmt.Errorf("failed to add retention_days column: %w", err)
+					}
+					logging.Logf("[MIGRATE] Added retention_days column to backup_jobs table")
+				}
+				return tx.Model(&BackupJob{}).Where("status = ?", "completed").Update("expires_at", nil).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&BackupJob{}, "retention_days")
+			},
+		},
+		{
+			ID: "202610160001_clear_empty_password_hashes",
+			Migrate: func(tx *gorm.DB) error {
+				// Users created through OIDC were stored with a hash of the empty
+				// password. Clear it so they show as having no local password.
+				var users []User
+				if err := tx.Select("id", "password").Where("password <> ?", "").Find(&users).Error; err != nil {
+					return err
+				}
+				for _, user := range users {
+					if !IsEmptyPasswordHash(user.Password) {
+						continue
+					}
+					if err := tx.Model(&User{}).Where("id = ?", user.ID).Update("password", "").Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return nil
+			},
+		},
 	})
 
 	// Set initial schema if this is a fresh database
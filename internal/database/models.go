@@ -30,18 +30,56 @@ type User struct {
 	PageDPI float64 `gorm:"column:page_dpi" json:"page_dpi,omitempty"`
 	ConversionOutputFormat string `gorm:"column:conversion_output_format;default:epub" json:"conversion_output_format,omitempty"`
 	RmapiConfig string `gorm:"column:rmapi_config;type:text" json:"-"` // Never return config in JSON
+	UploadTimeout int `gorm:"column:upload_timeout;default:0" json:"upload_timeout"` // Seconds; 0 uses UPLOAD_TIMEOUT
+	JobTimeout int `gorm:"column:job_timeout;default:0" json:"job_timeout"` // Seconds; 0 uses JOB_TIMEOUT
+	StorageQuotaMB int `gorm:"column:storage_quota_mb;default:0" json:"storage_quota_mb"` // Total size of uploaded documents; 0 means unlimited
+	UploadQuota int `gorm:"column:upload_quota;default:0" json:"upload_quota"` // Uploads per calendar month; 0 means unlimited
+	MaxUploadMB int `gorm:"column:max_upload_mb;default:0" json:"max_upload_mb"` // Largest file the user may upload; 0 uses the max_upload_mb setting
+	BlockedContentTypes string `gorm:"column:blocked_content_types" json:"blocked_content_types"` // Comma-separated content kinds the user may not send; "none" blocks nothing, empty uses the blocked_content_types setting
+	Language string `gorm:"column:language;size:16" json:"language"` // Locale emails are written in; empty uses DEFAULT_LANGUAGE
+	StorageQuotaWarned int `gorm:"column:storage_quota_warned;default:0" json:"-"` // Highest storage quota percentage the user was warned about
+	UploadQuotaWarned int `gorm:"column:upload_quota_warned;default:0" json:"-"` // Highest upload quota percentage warned about in UploadQuotaWarnedFor
+	UploadQuotaWarnedFor *time.Time `gorm:"column:upload_quota_warned_for" json:"-"` // Quota period UploadQuotaWarned applies to
+
+	// Offline delivery (USB web interface or SSH) instead of the reMarkable cloud
+	DeliveryMethod     string `gorm:"column:delivery_method" json:"delivery_method,omitempty"`
+	DeliveryHost       string `gorm:"column:delivery_host" json:"delivery_host,omitempty"`
+	DeliverySSHUser    string `gorm:"column:delivery_ssh_user" json:"delivery_ssh_user,omitempty"`
+	DeliverySSHKey     string `gorm:"column:delivery_ssh_key;type:text" json:"-"` // Never return key in JSON
+	DeliverySSHHostKey string `gorm:"column:delivery_ssh_host_key" json:"delivery_ssh_host_key,omitempty"`
+
+	// Time of day documents may be delivered (HH:MM); jobs outside it are queued
+	DeliveryWindowStart string `gorm:"column:delivery_window_start;size:5" json:"delivery_window_start,omitempty"`
+	DeliveryWindowEnd   string `gorm:"column:delivery_window_end;size:5" json:"delivery_window_end,omitempty"`
+	DeliveryTimezone    string `gorm:"column:delivery_timezone" json:"delivery_timezone,omitempty"` // IANA name; empty uses the server's
+
+	// Onboarding checklist: when each step was first done, and when it was dismissed
+	OnboardingPairedAt    *time.Time `gorm:"column:onboarding_paired_at" json:"-"`
+	OnboardingFolderAt    *time.Time `gorm:"column:onboarding_folder_at" json:"-"`
+	OnboardingAPIKeyAt    *time.Time `gorm:"column:onboarding_api_key_at" json:"-"`
+	OnboardingUploadAt    *time.Time `gorm:"column:onboarding_upload_at" json:"-"`
+	OnboardingDismissedAt *time.Time `gorm:"column:onboarding_dismissed_at" json:"-"`
 
 	// PDF processing settings
 	PDFBackgroundRemoval *bool `gorm:"column:pdf_background_removal" json:"pdf_background_removal"`
 	ExperimentalDownloadLink *bool `gorm:"column:experimental_download_link" json:"experimental_download_link"`
+	ExtractContent *bool `gorm:"column:extract_content" json:"extract_content"` // Web pages: keep only the readable article; nil uses EXTRACT_CONTENT
 	
 	// Password reset
 	ResetToken        string    `gorm:"index" json:"-"`
 	ResetTokenExpires time.Time `json:"-"`
+
+	// Login cookies issued before this no longer sign the user in, after an
+	// admin signed them out everywhere
+	SessionsRevokedAt *time.Time `gorm:"column:sessions_revoked_at" json:"sessions_revoked_at,omitempty"`
 	
 	
 	// OIDC integration
 	OidcSubject *string `gorm:"column:oidc_subject;uniqueIndex" json:"oidc_subject,omitempty"`
+
+	// Token in the user's personal inbound email address (base+token@domain);
+	// nil when the address is turned off
+	InboundEmailToken *string `gorm:"column:inbound_email_token;size:32;uniqueIndex" json:"-"`
 	
 	// Timestamps
 	CreatedAt time.Time  `json:"created_at"`
@@ -53,6 +91,11 @@ type User struct {
 	Sessions      []UserSession  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
 	FoldersCache  []FolderCache  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
 	Documents     []Document     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	CloudDrives   []CloudDriveToken `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	SendTargets   []SendTarget   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	FolderMirrors []FolderMirror `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Subscriptions []Subscription `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Mailboxes     []Mailbox      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 // BeforeCreate sets UUID and randomized folder refresh minute if not already set
@@ -69,16 +112,18 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 
 // APIKey represents an API key for a user
 type APIKey struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	Name      string    `gorm:"not null" json:"name"`
-	KeyHash   string    `gorm:"not null;index" json:"-"` // Never return actual key
-	KeyPrefix string    `gorm:"size:16;not null" json:"key_prefix"` // First 16 chars for display
-	IsActive  bool      `gorm:"default:true" json:"is_active"`
-	LastUsed  *time.Time `json:"last_used,omitempty"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
-	
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name             string     `gorm:"not null" json:"name"`
+	KeyHash          string     `gorm:"not null;index" json:"-"`            // Never return actual key
+	KeyPrefix        string     `gorm:"size:16;not null" json:"key_prefix"` // First 16 chars for display
+	IsActive         bool       `gorm:"default:true" json:"is_active"`
+	LastUsed         *time.Time `json:"last_used,omitempty"`
+	LastUsedIP       string     `gorm:"size:45" json:"last_used_ip,omitempty"`
+	LastUsedEndpoint string     `gorm:"size:255" json:"last_used_endpoint,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+
 	// Association
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
@@ -90,6 +135,167 @@ func (a *APIKey) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// CloudDriveToken stores a user's OAuth token for a cloud drive provider, used
+// to download share links to private files
+type CloudDriveToken struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_cloud_drive_user_provider" json:"user_id"`
+	Provider     string    `gorm:"size:32;not null;uniqueIndex:idx_cloud_drive_user_provider" json:"provider"`
+	AccessToken  string    `gorm:"type:text" json:"-"`
+	RefreshToken string    `gorm:"type:text" json:"-"`
+	TokenType    string    `gorm:"size:32" json:"-"`
+	Expiry       time.Time `json:"expiry"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Association
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (t *CloudDriveToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// SendTarget is another reader a user's uploads are also sent to once they
+// reach the reMarkable, such as a Send to Kindle address or a folder a Kobo
+// syncs from
+type SendTarget struct {
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name    string    `gorm:"size:100" json:"name"`
+	Kind    string    `gorm:"size:20;not null" json:"kind"`     // "email" or "folder"
+	Address string    `gorm:"size:500;not null" json:"address"` // Email address, or folder under SEND_TARGET_DIR
+	Formats string    `gorm:"size:100" json:"formats"`          // Comma-separated extensions to send, e.g. "epub,pdf"; empty sends all
+	Enabled bool      `json:"enabled"` // No gorm default: gorm leaves a false value out of the INSERT when the column has one
+
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Association
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (t *SendTarget) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// FolderMirror keeps a reMarkable folder in step with a storage prefix, so
+// files dropped into the prefix are delivered to the tablet
+type FolderMirror struct {
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Prefix  string    `gorm:"size:1000;not null" json:"prefix"` // Under the user's storage prefix, e.g. "pdfs/Papers"
+	RmDir   string    `gorm:"size:1000;not null" json:"rm_dir"`
+	Prune   bool      `gorm:"default:false" json:"prune"` // Remove documents whose files were deleted from the prefix
+	Enabled bool      `json:"enabled"`
+	// State is a JSON object of the mirrored storage keys and the size and
+	// modification time they were uploaded at
+	State string `gorm:"type:text" json:"-"`
+
+	LastSyncAt *time.Time `json:"last_sync_at,omitempty"`
+	LastError  string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Association
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (m *FolderMirror) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// Mailbox is an IMAP mailbox polled for emailed documents. Attachments are
+// uploaded for the mailbox's owner, to the folder a route picks by sender or
+// else RmDir.
+type Mailbox struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Host     string    `gorm:"size:255;not null" json:"host"`
+	Port     int       `gorm:"default:993" json:"port"`
+	Security string    `gorm:"size:20;default:tls" json:"security"` // "tls" (implicit, usually port 993) or "starttls" (usually 143)
+	Username string    `gorm:"size:255;not null" json:"username"`
+	Password string    `gorm:"type:text" json:"-"`
+	Folder   string    `gorm:"size:255;default:INBOX" json:"folder"`
+	RmDir    string    `gorm:"size:1000" json:"rm_dir,omitempty"`
+	// Routes are "sender=folder" rules, one per line, where sender is an
+	// address or "@domain"
+	Routes string `gorm:"type:text" json:"routes,omitempty"`
+	// AllowedSenders is a comma-separated list of addresses and "@domain"
+	// entries whose mail is ingested; empty allows everyone
+	AllowedSenders string `gorm:"type:text" json:"allowed_senders,omitempty"`
+	Enabled        bool   `json:"enabled"`
+
+	LastCheckAt *time.Time `json:"last_check_at,omitempty"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Association
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (m *Mailbox) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// Subscription fetches a URL on a cron schedule and uploads it, e.g. a daily
+// newspaper PDF. With Manage set each upload is named Prefix plus the date and
+// copies older than RetentionDays are removed, as for a managed webhook upload.
+type Subscription struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name     string    `gorm:"size:255;not null" json:"name"`
+	URL      string    `gorm:"size:2000;not null" json:"url"`
+	Cron     string    `gorm:"size:100;not null" json:"cron"`      // Five-field cron expression, e.g. "0 6 * * *"
+	Timezone string    `gorm:"size:100" json:"timezone,omitempty"` // IANA name; empty uses the server's
+	Enabled  bool      `json:"enabled"`
+
+	// Upload options, as for the webhook
+	RmDir         string `gorm:"size:1000" json:"rm_dir,omitempty"`
+	Prefix        string `gorm:"size:255" json:"prefix,omitempty"`
+	Manage        bool   `gorm:"default:false" json:"manage"`
+	RetentionDays int    `gorm:"default:7" json:"retention_days"`
+	Archive       bool   `gorm:"default:false" json:"archive"`
+	Compress      bool   `gorm:"default:false" json:"compress"`
+	OutputFormat  string `gorm:"size:10" json:"output_format,omitempty"` // "pdf" or "epub" for web pages
+	// UpdatePolicy is "always" (or empty) to upload every fetch, "skip" to
+	// skip fetches whose content is unchanged since the last delivery, or
+	// "replace" to also remove the last delivery once the content changes
+	UpdatePolicy string `gorm:"size:20" json:"update_policy,omitempty"`
+
+	NextRunAt *time.Time `gorm:"index" json:"next_run_at,omitempty"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	LastJobID string     `gorm:"size:100" json:"last_job_id,omitempty"`
+	LastError string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Association
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (s *Subscription) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
 // UserSession represents a user's login session
 type UserSession struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
@@ -147,11 +353,62 @@ type Document struct {
 	FileSize     int64     `json:"file_size,omitempty"`
 	Status       string    `gorm:"size:50;default:uploaded" json:"status"`
 	UploadDate   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"upload_date"`
+
+	// Where the document came from and how it was processed
+	SourceURL         string `gorm:"size:2000" json:"source_url,omitempty"`
+	OriginalFilename  string `gorm:"size:500" json:"original_filename,omitempty"`
+	ContentHash       string `gorm:"size:64;index" json:"content_hash,omitempty"` // SHA-256 of the uploaded file
+	Converter         string `gorm:"size:100" json:"converter,omitempty"`         // e.g. "article_to_epub", "image_to_pdf"
+	ProcessingOptions string `gorm:"type:text" json:"processing_options,omitempty"` // JSON object of the job's options
+
+	// Fingerprint is the SHA-256 of the content fetched from SourceURL before
+	// conversion: the downloaded file, the raw markdown or the article's text.
+	// It tells whether a URL's content changed since it was last delivered.
+	Fingerprint string `gorm:"size:64;index" json:"fingerprint,omitempty"`
+
+	// SyncStatus is "verified" once the document was seen on the reMarkable
+	// cloud after upload, "unverified" if it never showed up, or empty when
+	// SYNC_VERIFY is off
+	SyncStatus string     `gorm:"size:20" json:"sync_status,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+
+	// Environment is a JSON snapshot of the Aviary and tool versions and the
+	// conversion settings the document was processed with
+	Environment string `gorm:"type:text" json:"environment,omitempty"`
+
+	// ArchiveKey is the storage key of the archived copy, if the document
+	// was archived
+	ArchiveKey string `gorm:"size:1000" json:"archive_key,omitempty"`
+	// ArchiveHash is the SHA-256 of the archived copy, checked when it was
+	// stored and again by each verification run at ArchiveVerifiedAt
+	ArchiveHash       string     `gorm:"size:64" json:"archive_hash,omitempty"`
+	ArchiveVerifiedAt *time.Time `json:"archive_verified_at,omitempty"`
+	// ArchiveStatus is ArchiveStatusArchived or ArchiveStatusFailed when the
+	// job asked for an archived copy, or ArchiveStatusCorrupt once a
+	// verification run finds the copy changed or gone. The last failure is
+	// in ArchiveError.
+	ArchiveStatus string `gorm:"size:20;index" json:"archive_status,omitempty"`
+	ArchiveError  string `gorm:"size:1000" json:"archive_error,omitempty"`
+
+	// Labels is a JSON object of the labels the job was submitted with,
+	// e.g. {"project":"thesis","source":"rss"}
+	Labels string `gorm:"type:text" json:"labels,omitempty"`
+
+	// DeletedAt hides a document the user removed from their history. The
+	// row is kept so it still counts toward that month's upload quota.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	
 	// Association
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
 
+// Document archive statuses
+const (
+	ArchiveStatusArchived = "archived"
+	ArchiveStatusFailed   = "failed"
+	ArchiveStatusCorrupt  = "corrupt"
+)
+
 func (d *Document) BeforeCreate(tx *gorm.DB) error {
 	if d.ID == uuid.Nil {
 		d.ID = uuid.New()
@@ -197,8 +454,14 @@ type BackupJob struct {
 	IncludeFiles  bool      `gorm:"default:true" json:"include_files"`
 	IncludeConfigs bool     `gorm:"default:true" json:"include_configs"`
 	UserIDs       string    `gorm:"type:text" json:"user_ids,omitempty"`
+	ExcludeFileUserIDs string `gorm:"type:text" json:"exclude_file_user_ids,omitempty"` // Users whose archived documents are left out
+	FilesMaxAgeDays int     `gorm:"default:0" json:"files_max_age_days,omitempty"` // Leave out archived documents older than this; 0 keeps all
+	RetentionDays *int      `json:"retention_days,omitempty"` // Overrides backup_retention_days when set
+	DatabaseFormat string   `gorm:"size:10;default:json" json:"database_format"` // "json" or "sql" (pg_dump)
+	Scheduled     bool      `gorm:"default:false" json:"scheduled"` // Created by the backup schedule rather than an admin
 	FilePath      string    `gorm:"size:1000" json:"file_path,omitempty"`
 	Filename      string    `gorm:"size:255" json:"filename,omitempty"`
+	RemoteKey     string    `gorm:"size:1000" json:"remote_key,omitempty"` // Key of the copy in BACKUP_S3_BUCKET
 	FileSize      int64     `json:"file_size,omitempty"`
 	ErrorMessage  string    `gorm:"type:text" json:"error_message,omitempty"`
 	StartedAt     *time.Time `json:"started_at,omitempty"`
@@ -276,6 +539,11 @@ func GetAllModels() []interface{} {
 		&Document{},
 		&SystemSetting{},
 		&LoginAttempt{},
+		&CloudDriveToken{},
+		&SendTarget{},
+		&FolderMirror{},
+		&Subscription{},
+		&Mailbox{},
 		&BackupJob{},
 		&RestoreUpload{},
 		&RestoreExtractionJob{},
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCreateKeepsDisabled(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, id := uuid.New(), uuid.New()
+	records := map[string]interface{}{
+		"send target":  &SendTarget{ID: id, UserID: userID, Kind: "email", Address: "a@example.com"},
+		"mirror":       &FolderMirror{ID: id, UserID: userID, Prefix: "pdfs", RmDir: "/"},
+		"mailbox":      &Mailbox{ID: id, UserID: userID, Host: "imap.example.com", Username: "a"},
+		"subscription": &Subscription{ID: id, UserID: userID, URL: "https://example.com/feed", Cron: "0 6 * * *"},
+	}
+	for name, record := range records {
+		if err := db.AutoMigrate(record); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		var enabled bool
+		if err := db.Model(record).Select("enabled").Where("id = ?", id).Scan(&enabled).Error; err != nil {
+			t.Fatalf("reload %s: %v", name, err)
+		}
+		if enabled {
+			t.Errorf("%s created disabled was stored enabled", name)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// Onboarding checklist steps
+const (
+	OnboardingPairedDevice  = "paired_device"
+	OnboardingDefaultFolder = "default_folder"
+	OnboardingAPIKey        = "api_key"
+	OnboardingFirstUpload   = "first_upload"
+)
+
+// onboardingColumns are the user columns recording when each step was first
+// done, in checklist order
+var onboardingColumns = []struct {
+	step, column string
+}{
+	{OnboardingPairedDevice, "onboarding_paired_at"},
+	{OnboardingDefaultFolder, "onboarding_folder_at"},
+	{OnboardingAPIKey, "onboarding_api_key_at"},
+	{OnboardingFirstUpload, "onboarding_upload_at"},
+}
+
+// OnboardingStep is one item on a user's checklist
+type OnboardingStep struct {
+	Name        string     `json:"name"`
+	Done        bool       `json:"done"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Onboarding is a user's checklist
+type Onboarding struct {
+	Steps       []OnboardingStep `json:"steps"`
+	Complete    bool             `json:"complete"`
+	Dismissed   bool             `json:"dismissed"`
+	DismissedAt *time.Time       `json:"dismissed_at,omitempty"`
+}
+
+// RecordOnboardingStep marks step done for userID, keeping the time it was
+// first done
+func (s *UserService) RecordOnboardingStep(userID uuid.UUID, step string) error {
+	for _, c := range onboardingColumns {
+		if c.step == step {
+			return s.db.Model(&User{}).
+				Where("id = ? AND "+c.column+" IS NULL", userID).
+				Update(c.column, time.Now()).Error
+		}
+	}
+	return fmt.Errorf("unknown onboarding step %q", step)
+}
+
+// RecordOnboarding marks step done for userID, logging rather than failing
+// on errors since the checklist is only a guide
+func RecordOnboarding(userID uuid.UUID, step string) {
+	if DB == nil {
+		return
+	}
+	if err := NewUserService(DB).RecordOnboardingStep(userID, step); err != nil {
+		logging.Logf("[WARNING] failed to record onboarding step %s: %v", step, err)
+	}
+}
+
+// GetOnboarding returns user's checklist. Steps already done before they
+// were tracked (paired is passed in, since pairing lives outside the
+// database) are recorded as done now.
+func (s *UserService) GetOnboarding(user *User, paired bool) (*Onboarding, error) {
+	var apiKeyCount, docCount int64
+	if err := s.db.Model(&APIKey{}).Where("user_id = ?", user.ID).Count(&apiKeyCount).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&Document{}).Where("user_id = ?", user.ID).Count(&docCount).Error; err != nil {
+		return nil, err
+	}
+	current := map[string]bool{
+		OnboardingPairedDevice:  paired,
+		OnboardingDefaultFolder: user.DefaultRmdir != "" && user.DefaultRmdir != "/",
+		OnboardingAPIKey:        apiKeyCount > 0,
+		OnboardingFirstUpload:   docCount > 0,
+	}
+	recorded := map[string]*time.Time{
+		OnboardingPairedDevice:  user.OnboardingPairedAt,
+		OnboardingDefaultFolder: user.OnboardingFolderAt,
+		OnboardingAPIKey:        user.OnboardingAPIKeyAt,
+		OnboardingFirstUpload:   user.OnboardingUploadAt,
+	}
+
+	o := &Onboarding{
+		Complete:    true,
+		Dismissed:   user.OnboardingDismissedAt != nil,
+		DismissedAt: user.OnboardingDismissedAt,
+	}
+	for _, c := range onboardingColumns {
+		at := recorded[c.step]
+		if at == nil && current[c.step] {
+			now := time.Now()
+			if err := s.RecordOnboardingStep(user.ID, c.step); err != nil {
+				return nil, err
+			}
+			at = &now
+		}
+		o.Steps = append(o.Steps, OnboardingStep{Name: c.step, Done: at != nil, CompletedAt: at})
+		if at == nil {
+			o.Complete = false
+		}
+	}
+	return o, nil
+}
+
+// DismissOnboarding hides userID's checklist
+func (s *UserService) DismissOnboarding(userID uuid.UUID) error {
+	return s.db.Model(&User{}).Where("id = ?", userID).Update("onboarding_dismissed_at", time.Now()).Error
+}
+
+// ResetOnboarding shows userID's checklist again and starts every step over.
+// Steps that are still done are picked up again the next time it's read.
+func (s *UserService) ResetOnboarding(userID uuid.UUID) error {
+	updates := map[string]interface{}{"onboarding_dismissed_at": nil}
+	for _, c := range onboardingColumns {
+		updates[c.column] = nil
+	}
+	return s.db.Model(&User{}).Where("id = ?", userID).Updates(updates).Error
+}
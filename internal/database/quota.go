@@ -0,0 +1,105 @@
+package database
+
+import (
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// QuotaUsage reports a user's use of their storage and monthly upload quotas.
+// Limits of zero mean unlimited.
+type QuotaUsage struct {
+	StorageBytes      int64     `json:"storage_bytes"`
+	StorageLimitBytes int64     `json:"storage_limit_bytes"`
+	Uploads           int64     `json:"uploads"`
+	UploadLimit       int64     `json:"upload_limit"`
+	PeriodStart       time.Time `json:"period_start"`
+}
+
+// Exceeded returns which quota is used up, "storage" or "uploads", or "" if
+// neither is
+func (q *QuotaUsage) Exceeded() string {
+	if q.StorageLimitBytes > 0 && q.StorageBytes >= q.StorageLimitBytes {
+		return "storage"
+	}
+	if q.UploadLimit > 0 && q.Uploads >= q.UploadLimit {
+		return "uploads"
+	}
+	return ""
+}
+
+// quotaPeriodStart returns the start of the calendar month upload quotas count from
+func quotaPeriodStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// GetQuotaUsage totals the documents user has uploaded against their quotas
+func (s *UserService) GetQuotaUsage(user *User) (*QuotaUsage, error) {
+	usage := &QuotaUsage{
+		StorageLimitBytes: int64(user.StorageQuotaMB) * 1024 * 1024,
+		UploadLimit:       int64(user.UploadQuota),
+		PeriodStart:       quotaPeriodStart(time.Now()),
+	}
+
+	var storage struct{ Total int64 }
+	if err := s.db.Model(&Document{}).Select("COALESCE(SUM(file_size), 0) AS total").
+		Where("user_id = ?", user.ID).Scan(&storage).Error; err != nil {
+		return nil, err
+	}
+	usage.StorageBytes = storage.Total
+
+	// Uploads removed from the history still count toward the month
+	if err := s.db.Unscoped().Model(&Document{}).Where("user_id = ? AND upload_date >= ?", user.ID, usage.PeriodStart).
+		Count(&usage.Uploads).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Quota states reported in profile stats
+const (
+	QuotaStateOK       = "ok"
+	QuotaStateWarning  = "warning"
+	QuotaStateExceeded = "exceeded"
+)
+
+// quotaPercent returns used as a percentage of limit, or 0 when unlimited
+func quotaPercent(used, limit int64) int {
+	if limit <= 0 {
+		return 0
+	}
+	return int(used * 100 / limit)
+}
+
+// StoragePercent returns how much of the storage quota is used
+func (q *QuotaUsage) StoragePercent() int {
+	return quotaPercent(q.StorageBytes, q.StorageLimitBytes)
+}
+
+// UploadPercent returns how much of this month's upload quota is used
+func (q *QuotaUsage) UploadPercent() int {
+	return quotaPercent(q.Uploads, q.UploadLimit)
+}
+
+// State returns QuotaStateExceeded when a quota is used up, QuotaStateWarning
+// when either is at warnPercent or more, and QuotaStateOK otherwise
+func (q *QuotaUsage) State(warnPercent int) string {
+	if q.Exceeded() != "" {
+		return QuotaStateExceeded
+	}
+	if (q.StorageLimitBytes > 0 && q.StoragePercent() >= warnPercent) ||
+		(q.UploadLimit > 0 && q.UploadPercent() >= warnPercent) {
+		return QuotaStateWarning
+	}
+	return QuotaStateOK
+}
+
+// QuotaWarningPercent returns QUOTA_WARNING_PERCENT, the share of a quota at
+// which users are warned before it's enforced (default 80)
+func QuotaWarningPercent() int {
+	p := config.GetInt("QUOTA_WARNING_PERCENT", 80)
+	if p <= 0 || p >= 100 {
+		return 80
+	}
+	return p
+}
@@ -13,6 +13,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrOIDCSubjectInUse is returned when an OIDC subject is already linked to another account
+var ErrOIDCSubjectInUse = errors.New("oidc subject already linked to another user")
+
 // UserService provides user-related database operations
 type UserService struct {
 	db *gorm.DB
@@ -60,10 +63,14 @@ func (s *UserService) CreateUser(username, email, password string, isAdmin bool)
 		return nil, errors.New("user with this username or email already exists")
 	}
 
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+	// Hash password; users created through OIDC have none
+	var hashedPassword []byte
+	if password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
 	}
 
 	// Set coverpage setting based on server's RMAPI_COVERPAGE environment variable
@@ -200,6 +207,45 @@ func (s *UserService) GetUserByID(userID uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
+// HasLocalPassword reports whether the user can sign in with a password.
+// Users auto-created through OIDC are stored without a password hash.
+func (s *UserService) HasLocalPassword(user *User) bool {
+	return user.Password != ""
+}
+
+// IsEmptyPasswordHash reports whether hash is a hash of the empty password,
+// which users created through OIDC were stored with before they were stored
+// without one
+func IsEmptyPasswordHash(hash string) bool {
+	return hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), nil) == nil
+}
+
+// LinkOIDCSubject attaches an OIDC subject to a user, refusing subjects
+// already linked to a different account
+func (s *UserService) LinkOIDCSubject(userID uuid.UUID, subject string) error {
+	var existing User
+	err := s.db.Where("oidc_subject = ?", subject).First(&existing).Error
+	if err == nil && existing.ID != userID {
+		return ErrOIDCSubjectInUse
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return s.db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"oidc_subject": subject,
+		"updated_at":   time.Now(),
+	}).Error
+}
+
+// UnlinkOIDCSubject removes the OIDC subject from a user
+func (s *UserService) UnlinkOIDCSubject(userID uuid.UUID) error {
+	return s.db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"oidc_subject": nil,
+		"updated_at":   time.Now(),
+	}).Error
+}
+
 // GetAllUsers retrieves all users (for admin)
 func (s *UserService) GetAllUsers() ([]User, error) {
 	var users []User
@@ -257,6 +303,13 @@ func (s *UserService) GetUserStats(userID uuid.UUID) (map[string]interface{}, er
 	}
 	stats["documents"] = docCount
 
+	// Count documents per label
+	labelCounts, err := s.LabelCounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats["labels"] = labelCounts
+
 	// Count active sessions
 	var sessionCount int64
 	if err := s.db.Model(&UserSession{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Count(&sessionCount).Error; err != nil {
@@ -280,6 +333,39 @@ func (s *UserService) CleanupExpiredResetTokens() error {
 	}).Error
 }
 
+// RevokeSessions signs the user out everywhere: login cookies issued until now
+// stop working and the session records are removed. With revokeAPIKeys the
+// user's active API keys are deactivated as well. It returns how many
+// sessions and API keys were revoked.
+func (s *UserService) RevokeSessions(userID uuid.UUID, revokeAPIKeys bool) (int64, int64, error) {
+	var sessions, keys int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"sessions_revoked_at": now,
+			"updated_at":          now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+
+		result := tx.Where("user_id = ?", userID).Delete(&UserSession{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete user sessions: %w", result.Error)
+		}
+		sessions = result.RowsAffected
+
+		if revokeAPIKeys {
+			result := tx.Model(&APIKey{}).Where("user_id = ? AND is_active = ?", userID, true).Update("is_active", false)
+			if result.Error != nil {
+				return fmt.Errorf("failed to deactivate API keys: %w", result.Error)
+			}
+			keys = result.RowsAffected
+		}
+		return nil
+	})
+	return sessions, keys, err
+}
+
 // DeleteUser permanently deletes a user and all associated data
 func (s *UserService) DeleteUser(userID uuid.UUID) error {
 	// Start a transaction to ensure atomicity
@@ -295,10 +381,35 @@ func (s *UserService) DeleteUser(userID uuid.UUID) error {
 		}
 
 		// Delete all documents
-		if err := tx.Where("user_id = ?", userID).Delete(&Document{}).Error; err != nil {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&Document{}).Error; err != nil {
 			return fmt.Errorf("failed to delete documents: %w", err)
 		}
 
+		// Delete connected cloud drive accounts
+		if err := tx.Where("user_id = ?", userID).Delete(&CloudDriveToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete cloud drive tokens: %w", err)
+		}
+
+		// Delete "also send to" targets
+		if err := tx.Where("user_id = ?", userID).Delete(&SendTarget{}).Error; err != nil {
+			return fmt.Errorf("failed to delete send targets: %w", err)
+		}
+
+		// Delete folder mirrors
+		if err := tx.Where("user_id = ?", userID).Delete(&FolderMirror{}).Error; err != nil {
+			return fmt.Errorf("failed to delete folder mirrors: %w", err)
+		}
+
+		// Delete subscriptions
+		if err := tx.Where("user_id = ?", userID).Delete(&Subscription{}).Error; err != nil {
+			return fmt.Errorf("failed to delete subscriptions: %w", err)
+		}
+
+		// Delete mailboxes
+		if err := tx.Where("user_id = ?", userID).Delete(&Mailbox{}).Error; err != nil {
+			return fmt.Errorf("failed to delete mailboxes: %w", err)
+		}
+
 		// Delete login attempts
 		if err := tx.Where("username = (SELECT username FROM users WHERE id = ?)", userID).Delete(&LoginAttempt{}).Error; err != nil {
 			return fmt.Errorf("failed to delete login attempts: %w", err)
@@ -0,0 +1,214 @@
+// Package degraded watches the dependencies jobs need (the storage backend and
+// the reMarkable cloud) and switches Aviary into degraded mode when they keep
+// failing their health checks. While degraded, new jobs are queued instead of
+// run, and processing resumes once every dependency is healthy again.
+package degraded
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	defaultInterval  = time.Minute
+	defaultThreshold = 3
+	checkTimeout     = 15 * time.Second
+)
+
+// CheckFunc returns an error when a dependency is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+// CheckStatus is the latest result of a single health check
+type CheckStatus struct {
+	Name        string     `json:"name"`
+	Healthy     bool       `json:"healthy"`
+	Failures    int        `json:"consecutive_failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+}
+
+// Status describes whether degraded mode is active and why
+type Status struct {
+	Active bool          `json:"active"`
+	Since  *time.Time    `json:"since,omitempty"`
+	Checks []CheckStatus `json:"checks"`
+}
+
+type check struct {
+	name   string
+	fn     CheckFunc
+	status CheckStatus
+}
+
+// Monitor runs the registered checks on an interval
+type Monitor struct {
+	mu        sync.RWMutex
+	checks    []*check
+	threshold int
+	active    bool
+	since     time.Time
+	onRecover []func()
+}
+
+var defaultMonitor = NewMonitor(defaultThreshold)
+
+// NewMonitor returns a monitor that enters degraded mode after threshold
+// consecutive failures of any check
+func NewMonitor(threshold int) *Monitor {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Monitor{threshold: threshold}
+}
+
+// Register adds a health check to the default monitor
+func Register(name string, fn CheckFunc) {
+	defaultMonitor.Register(name, fn)
+}
+
+// OnRecover registers fn to run on the default monitor when degraded mode ends
+func OnRecover(fn func()) {
+	defaultMonitor.OnRecover(fn)
+}
+
+// Active reports whether the default monitor is in degraded mode
+func Active() bool {
+	return defaultMonitor.Active()
+}
+
+// GetStatus returns the default monitor's status
+func GetStatus() Status {
+	return defaultMonitor.Status()
+}
+
+// Start runs the default monitor's checks every DEGRADED_CHECK_INTERVAL until
+// ctx is cancelled. It does nothing when DEGRADED_MODE is false.
+func Start(ctx context.Context) {
+	if !config.GetBool("DEGRADED_MODE", true) {
+		logging.Logf("[DEGRADED] Dependency health checks disabled (DEGRADED_MODE=false)")
+		return
+	}
+	defaultMonitor.mu.Lock()
+	defaultMonitor.threshold = config.GetInt("DEGRADED_FAILURE_THRESHOLD", defaultThreshold)
+	if defaultMonitor.threshold < 1 {
+		defaultMonitor.threshold = 1
+	}
+	defaultMonitor.mu.Unlock()
+
+	interval := config.GetDuration("DEGRADED_CHECK_INTERVAL", defaultInterval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			defaultMonitor.RunChecks(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Register adds a health check
+func (m *Monitor) Register(name string, fn CheckFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks = append(m.checks, &check{name: name, fn: fn, status: CheckStatus{Name: name, Healthy: true}})
+}
+
+// OnRecover registers fn to run (in its own goroutine) when degraded mode ends
+func (m *Monitor) OnRecover(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onRecover = append(m.onRecover, fn)
+}
+
+// Active reports whether degraded mode is on
+func (m *Monitor) Active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.active
+}
+
+// Status returns a snapshot of degraded mode and every check
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := Status{Active: m.active, Checks: make([]CheckStatus, 0, len(m.checks))}
+	if m.active {
+		since := m.since
+		status.Since = &since
+	}
+	for _, c := range m.checks {
+		status.Checks = append(status.Checks, c.status)
+	}
+	return status
+}
+
+// RunChecks runs every check once and updates degraded mode. Degraded mode
+// starts when any check reaches the failure threshold and ends once all checks
+// pass again.
+func (m *Monitor) RunChecks(ctx context.Context) {
+	m.mu.RLock()
+	checks := append([]*check(nil), m.checks...)
+	m.mu.RUnlock()
+
+	type result struct {
+		c   *check
+		err error
+	}
+	results := make([]result, 0, len(checks))
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		results = append(results, result{c, c.fn(checkCtx)})
+		cancel()
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	failing := false
+	for _, r := range results {
+		s := &r.c.status
+		s.LastChecked = &now
+		if r.err != nil {
+			s.Failures++
+			s.Healthy = false
+			s.LastError = r.err.Error()
+			// Once degraded, stay degraded until every dependency has recovered
+			if s.Failures >= m.threshold || m.active {
+				failing = true
+			}
+		} else {
+			s.Failures = 0
+			s.Healthy = true
+			s.LastError = ""
+		}
+	}
+
+	var recovered []func()
+	switch {
+	case failing && !m.active:
+		m.active = true
+		m.since = now
+		for _, r := range results {
+			if r.err != nil {
+				logging.Logf("[DEGRADED] %s health check failed %d times: %v", r.c.name, r.c.status.Failures, r.err)
+			}
+		}
+		logging.Logf("[DEGRADED] Entering degraded mode: new jobs will be queued until dependencies recover")
+	case !failing && m.active:
+		m.active = false
+		logging.Logf("[DEGRADED] Dependencies recovered after %s, resuming queued jobs", now.Sub(m.since).Round(time.Second))
+		recovered = append(recovered, m.onRecover...)
+	}
+	m.mu.Unlock()
+
+	for _, fn := range recovered {
+		go fn()
+	}
+}
@@ -0,0 +1,61 @@
+package degraded
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMonitorEntersAndLeavesDegradedMode(t *testing.T) {
+	m := NewMonitor(2)
+	storageErr := errors.New("bucket unreachable")
+	var failStorage, failCloud bool
+	m.Register("storage", func(context.Context) error {
+		if failStorage {
+			return storageErr
+		}
+		return nil
+	})
+	m.Register("rmapi", func(context.Context) error {
+		if failCloud {
+			return errors.New("timeout")
+		}
+		return nil
+	})
+	recovered := make(chan struct{}, 1)
+	m.OnRecover(func() { recovered <- struct{}{} })
+
+	ctx := context.Background()
+	failStorage = true
+	m.RunChecks(ctx)
+	if m.Active() {
+		t.Fatal("entered degraded mode before reaching the threshold")
+	}
+	m.RunChecks(ctx)
+	if !m.Active() {
+		t.Fatal("expected degraded mode after repeated failures")
+	}
+	status := m.Status()
+	if status.Since == nil || status.Checks[0].LastError != storageErr.Error() || status.Checks[0].Failures != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// A different dependency failing keeps the monitor degraded
+	failStorage, failCloud = false, true
+	m.RunChecks(ctx)
+	if !m.Active() {
+		t.Fatal("left degraded mode while a dependency was still failing")
+	}
+
+	failCloud = false
+	m.RunChecks(ctx)
+	if m.Active() {
+		t.Fatal("expected degraded mode to end once all checks pass")
+	}
+	select {
+	case <-recovered:
+	case <-time.After(time.Second):
+		t.Fatal("recovery callback was not called")
+	}
+}
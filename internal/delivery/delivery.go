@@ -0,0 +1,191 @@
+// Package delivery sends documents to a reMarkable tablet without the
+// reMarkable cloud, for tablets kept offline. Documents are uploaded through
+// the tablet's USB web interface or copied into its document store over SSH.
+// The cloud (rmapi) remains the default method.
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	// MethodCloud uploads through the reMarkable cloud with rmapi
+	MethodCloud = "cloud"
+	// MethodUSB uploads through the tablet's USB web interface
+	MethodUSB = "usb"
+	// MethodSSH copies files into the tablet's document store over SSH
+	MethodSSH = "ssh"
+)
+
+// defaultUSBHost is the tablet's address when connected over USB
+const defaultUSBHost = "10.11.99.1"
+
+// Target describes where and how to deliver documents
+type Target struct {
+	Method string
+	// Host is the tablet's address, optionally with a port
+	Host        string
+	SSHUser     string
+	SSHKey      string
+	SSHPassword string
+	// SSHHostKey is an optional SHA256 fingerprint the tablet's host key must match
+	SSHHostKey string
+}
+
+// Options controls how a document is placed on the tablet
+type Options struct {
+	// ConflictResolution is abort, overwrite or content_only
+	ConflictResolution string
+	// CoverFirstPage uses the first page as the cover instead of the last opened page
+	CoverFirstPage bool
+}
+
+// Offline reports whether the target bypasses the reMarkable cloud
+func (t Target) Offline() bool {
+	return t.Method == MethodUSB || t.Method == MethodSSH
+}
+
+// UserDeliveryAllowed reports whether users may configure their own USB or SSH
+// delivery in multi-user mode. It is off by default because it lets users make
+// Aviary connect to hosts on its network.
+func UserDeliveryAllowed() bool {
+	return config.GetBool("ALLOW_OFFLINE_DELIVERY", false)
+}
+
+// ForUser returns the delivery target for user. In multi-user mode it comes
+// from the user's settings, otherwise from the RM_DELIVERY_* environment
+// variables.
+func ForUser(user *database.User) Target {
+	var t Target
+	if database.IsMultiUserMode() {
+		if user == nil || !UserDeliveryAllowed() {
+			return Target{Method: MethodCloud}
+		}
+		t = Target{
+			Method:     user.DeliveryMethod,
+			Host:       user.DeliveryHost,
+			SSHUser:    user.DeliverySSHUser,
+			SSHKey:     user.DeliverySSHKey,
+			SSHHostKey: user.DeliverySSHHostKey,
+		}
+	} else {
+		t = Target{
+			Method:      strings.ToLower(config.Get("RM_DELIVERY", MethodCloud)),
+			Host:        config.Get("RM_DELIVERY_HOST", ""),
+			SSHUser:     config.Get("RM_SSH_USER", ""),
+			SSHKey:      config.Get("RM_SSH_KEY", ""),
+			SSHPassword: config.Get("RM_SSH_PASSWORD", ""),
+			SSHHostKey:  config.Get("RM_SSH_HOST_KEY", ""),
+		}
+	}
+	return t.withDefaults()
+}
+
+func (t Target) withDefaults() Target {
+	switch t.Method {
+	case MethodUSB:
+		if t.Host == "" {
+			t.Host = defaultUSBHost
+		}
+	case MethodSSH:
+		if t.Host == "" {
+			t.Host = defaultUSBHost
+		}
+		if t.SSHUser == "" {
+			t.SSHUser = "root"
+		}
+	default:
+		t.Method = MethodCloud
+	}
+	return t
+}
+
+// Validate checks that the target has what its method needs
+func (t Target) Validate() error {
+	switch t.Method {
+	case MethodCloud:
+		return nil
+	case MethodUSB, MethodSSH:
+		host := t.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" || strings.ContainsAny(host, "/?#@ ") {
+			return fmt.Errorf("invalid delivery host %q", t.Host)
+		}
+		if t.Method == MethodSSH && t.SSHKey == "" && t.SSHPassword == "" {
+			return fmt.Errorf("SSH delivery needs a private key or password")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown delivery method %q", t.Method)
+}
+
+// Upload delivers the file at path into rmDir on the tablet and returns the
+// uploaded file's name
+func Upload(ctx context.Context, t Target, path, rmDir string, opts Options) (string, error) {
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+	if config.Get("DRY_RUN", "") != "" {
+		logging.Logf("[DRY RUN] would deliver %s to %s:%s over %s", path, t.Host, rmDir, t.Method)
+		return baseName(path), nil
+	}
+	switch t.Method {
+	case MethodUSB:
+		return uploadUSB(ctx, t, path, rmDir, opts)
+	case MethodSSH:
+		return uploadSSH(ctx, t, path, rmDir, opts)
+	}
+	return "", fmt.Errorf("delivery method %q does not upload directly", t.Method)
+}
+
+// ListFolders returns every folder on the tablet with a leading slash,
+// including the root "/"
+func ListFolders(ctx context.Context, t Target) ([]string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	switch t.Method {
+	case MethodUSB:
+		return listFoldersUSB(ctx, t)
+	case MethodSSH:
+		return listFoldersSSH(ctx, t)
+	}
+	return nil, fmt.Errorf("delivery method %q does not list folders directly", t.Method)
+}
+
+// splitDir splits an rmDir such as "/Books/Fiction" into its folder names
+func splitDir(rmDir string) []string {
+	var parts []string
+	for _, p := range strings.Split(rmDir, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// baseName returns the last element of a slash- or OS-separated path
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// visibleName is the name the tablet shows for a file: its name without extension
+func visibleName(path string) string {
+	name := baseName(path)
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[:i]
+	}
+	return name
+}
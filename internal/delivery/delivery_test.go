@@ -0,0 +1,161 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTargetValidate(t *testing.T) {
+	tests := []struct {
+		target Target
+		ok     bool
+	}{
+		{Target{Method: MethodCloud}, true},
+		{Target{Method: MethodUSB, Host: "10.11.99.1"}, true},
+		{Target{Method: MethodUSB, Host: "10.11.99.1:8080"}, true},
+		{Target{Method: MethodUSB, Host: ""}, false},
+		{Target{Method: MethodUSB, Host: "evil.example/path"}, false},
+		{Target{Method: MethodUSB, Host: "user@tablet"}, false},
+		{Target{Method: MethodSSH, Host: "tablet", SSHKey: "key"}, true},
+		{Target{Method: MethodSSH, Host: "tablet", SSHPassword: "pass"}, true},
+		{Target{Method: MethodSSH, Host: "tablet"}, false},
+		{Target{Method: "ftp", Host: "tablet"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.target.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v.Validate() = %v, want ok=%v", tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestForUserFromEnvironment(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+
+	t.Setenv("RM_DELIVERY", "SSH")
+	t.Setenv("RM_SSH_PASSWORD", "pass")
+	got := ForUser(nil)
+	want := Target{Method: MethodSSH, Host: defaultUSBHost, SSHUser: "root", SSHPassword: "pass"}
+	if got != want {
+		t.Errorf("ForUser with RM_DELIVERY=SSH = %+v, want %+v", got, want)
+	}
+	if !got.Offline() {
+		t.Error("SSH target is not offline")
+	}
+
+	t.Setenv("RM_DELIVERY", "carrier-pigeon")
+	if got := ForUser(nil); got.Method != MethodCloud || got.Offline() {
+		t.Errorf("ForUser with an unknown method = %+v, want cloud", got)
+	}
+}
+
+func TestPathHelpers(t *testing.T) {
+	if got := splitDir("/Books//Fiction/ "); !reflect.DeepEqual(got, []string{"Books", "Fiction"}) {
+		t.Errorf("splitDir = %q", got)
+	}
+	if got := splitDir("/"); got != nil {
+		t.Errorf("splitDir(/) = %q, want none", got)
+	}
+	names := map[string][2]string{
+		"/tmp/a/Report.v2.pdf": {"Report.v2.pdf", "Report.v2"},
+		`C:\docs\notes.epub`:   {"notes.epub", "notes"},
+		".hidden":              {".hidden", ".hidden"},
+		"plain":                {"plain", "plain"},
+	}
+	for in, want := range names {
+		if got := baseName(in); got != want[0] {
+			t.Errorf("baseName(%q) = %q, want %q", in, got, want[0])
+		}
+		if got := visibleName(in); got != want[1] {
+			t.Errorf("visibleName(%q) = %q, want %q", in, got, want[1])
+		}
+	}
+	if got := shellQuote("it's"); got != `'it'\''s'` {
+		t.Errorf("shellQuote = %s", got)
+	}
+}
+
+// fakeUSB serves a tablet's USB web interface with the given folders (ID to
+// entries) and records uploaded file names
+func fakeUSB(t *testing.T, folders map[string][]usbEntry) (Target, *[]string) {
+	t.Helper()
+	var uploaded []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/documents/"):
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			entries, ok := folders[strings.TrimPrefix(r.URL.Path, "/documents/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(entries)
+		case r.URL.Path == "/upload" && r.Method == http.MethodPost:
+			if r.Header.Get("Origin") != "http://"+r.Host {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			f, header, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			io.Copy(io.Discard, f)
+			uploaded = append(uploaded, header.Filename)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return Target{Method: MethodUSB, Host: strings.TrimPrefix(srv.URL, "http://")}, &uploaded
+}
+
+func TestUSBDelivery(t *testing.T) {
+	t.Setenv("DRY_RUN", "")
+	target, uploaded := fakeUSB(t, map[string][]usbEntry{
+		"":        {{ID: "books", Name: "Books", Type: usbCollectionType}, {ID: "d1", Name: "Loose", Type: "DocumentType"}},
+		"books":   {{ID: "fiction", Name: "Fiction", Type: usbCollectionType}, {ID: "d2", Name: "Existing", Type: "DocumentType"}},
+		"fiction": {},
+	})
+
+	folders, err := ListFolders(context.Background(), target)
+	if err != nil || !reflect.DeepEqual(folders, []string{"/", "/Books", "/Books/Fiction"}) {
+		t.Errorf("ListFolders = %q, %v", folders, err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("%PDF-1.4"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	name, err := Upload(context.Background(), target, write("New.pdf"), "/Books/Fiction", Options{})
+	if err != nil || name != "New.pdf" {
+		t.Errorf("Upload = %q, %v", name, err)
+	}
+	if _, err := Upload(context.Background(), target, write("New.pdf"), "/Magazines", Options{}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Upload to a missing folder = %v, want not found", err)
+	}
+	if _, err := Upload(context.Background(), target, write("Existing.pdf"), "/Books", Options{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Upload of an existing name = %v, want already exists", err)
+	}
+	if _, err := Upload(context.Background(), target, write("Existing.pdf"), "/Books", Options{ConflictResolution: "overwrite"}); err != nil {
+		t.Errorf("Upload with overwrite = %v", err)
+	}
+	if !reflect.DeepEqual(*uploaded, []string{"New.pdf", "Existing.pdf"}) {
+		t.Errorf("uploaded %q", *uploaded)
+	}
+}
@@ -0,0 +1,265 @@
+package delivery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"golang.org/x/crypto/ssh"
+)
+
+// xochitlDir is where the tablet's reading app keeps documents
+const xochitlDir = "/home/root/.local/share/remarkable/xochitl"
+
+// xochitlMetadata is the .metadata file stored next to every document and folder
+type xochitlMetadata struct {
+	Deleted          bool   `json:"deleted"`
+	LastModified     string `json:"lastModified"`
+	MetadataModified bool   `json:"metadatamodified"`
+	Modified         bool   `json:"modified"`
+	Parent           string `json:"parent"`
+	Pinned           bool   `json:"pinned"`
+	Synced           bool   `json:"synced"`
+	Type             string `json:"type"`
+	Version          int    `json:"version"`
+	VisibleName      string `json:"visibleName"`
+}
+
+type xochitlEntry struct {
+	id   string
+	meta xochitlMetadata
+}
+
+func dialSSH(ctx context.Context, t Target) (*ssh.Client, error) {
+	var auths []ssh.AuthMethod
+	if t.SSHKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(t.SSHKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH private key: %w", err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if t.SSHPassword != "" {
+		auths = append(auths, ssh.Password(t.SSHPassword))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if t.SSHHostKey != "" {
+		want := t.SSHHostKey
+		hostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != want {
+				return fmt.Errorf("host key mismatch for %s: got %s, want %s", hostname, got, want)
+			}
+			return nil
+		}
+	}
+
+	addr := t.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	dialer := net.Dialer{Timeout: 15 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("tablet unreachable at %s: %w", addr, err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            t.SSHUser,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         15 * time.Second,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH login to %s failed: %w", addr, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// run executes cmd on the tablet with stdin as its input and returns stdout
+func run(client *ssh.Client, cmd string, stdin io.Reader) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", cmd, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// shellQuote quotes s for the tablet's POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// readEntries loads the metadata of every document and folder on the tablet
+func readEntries(client *ssh.Client) ([]xochitlEntry, error) {
+	// One line per item: "<id>\t<metadata json on one line>"
+	out, err := run(client, `cd `+xochitlDir+` && for f in *.metadata; do [ -e "$f" ] || continue; printf '%s\t' "${f%.metadata}"; tr -d '\n' < "$f"; echo; done`, nil)
+	if err != nil {
+		return nil, err
+	}
+	var entries []xochitlEntry
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		id, data, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		var meta xochitlMetadata
+		if err := json.Unmarshal([]byte(data), &meta); err != nil {
+			logging.Debugf("[DELIVERY] Skipping unreadable metadata for %s: %v", id, err)
+			continue
+		}
+		if !meta.Deleted && meta.Parent != "trash" {
+			entries = append(entries, xochitlEntry{id: id, meta: meta})
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func findChild(entries []xochitlEntry, parent, name, typ string) string {
+	for _, e := range entries {
+		if e.meta.Parent == parent && e.meta.VisibleName == name && e.meta.Type == typ {
+			return e.id
+		}
+	}
+	return ""
+}
+
+// writeFile writes data to name inside the document store
+func writeFile(client *ssh.Client, name string, data io.Reader) error {
+	_, err := run(client, "cat > "+shellQuote(path.Join(xochitlDir, name)), data)
+	return err
+}
+
+func writeItem(client *ssh.Client, id, parent, name, typ string, content interface{}) error {
+	meta, _ := json.Marshal(xochitlMetadata{
+		LastModified: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Parent:       parent,
+		Type:         typ,
+		VisibleName:  name,
+	})
+	contentJSON, _ := json.Marshal(content)
+	if err := writeFile(client, id+".content", bytes.NewReader(contentJSON)); err != nil {
+		return err
+	}
+	return writeFile(client, id+".metadata", bytes.NewReader(meta))
+}
+
+func uploadSSH(ctx context.Context, t Target, filePath, rmDir string, opts Options) (string, error) {
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(baseName(filePath))), ".")
+	if ext != "pdf" && ext != "epub" {
+		return "", fmt.Errorf("SSH delivery supports PDF and EPUB files, not %q", ext)
+	}
+
+	client, err := dialSSH(ctx, t)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	entries, err := readEntries(client)
+	if err != nil {
+		return "", fmt.Errorf("reading documents on the tablet: %w", err)
+	}
+
+	// Find or create each folder of rmDir
+	parent := ""
+	for _, name := range splitDir(rmDir) {
+		id := findChild(entries, parent, name, "CollectionType")
+		if id == "" {
+			id = uuid.NewString()
+			if err := writeItem(client, id, parent, name, "CollectionType", map[string]interface{}{}); err != nil {
+				return "", fmt.Errorf("creating folder %q: %w", name, err)
+			}
+			entries = append(entries, xochitlEntry{id: id, meta: xochitlMetadata{Parent: parent, VisibleName: name, Type: "CollectionType"}})
+			logging.Logf("[DELIVERY] Created folder %s on the tablet", name)
+		}
+		parent = id
+	}
+
+	name := visibleName(filePath)
+	if existing := findChild(entries, parent, name, "DocumentType"); existing != "" {
+		if opts.ConflictResolution == "" || opts.ConflictResolution == "abort" {
+			return "", fmt.Errorf("entry already exists: %s", name)
+		}
+		// Annotations can't be carried over to a new file, so content_only replaces the whole document
+		if _, err := run(client, "cd "+xochitlDir+" && rm -rf "+shellQuote(existing)+" "+shellQuote(existing)+".*", nil); err != nil {
+			return "", fmt.Errorf("removing existing document: %w", err)
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	id := uuid.NewString()
+	if err := writeFile(client, id+"."+ext, f); err != nil {
+		return "", fmt.Errorf("copying document: %w", err)
+	}
+	content := map[string]interface{}{"fileType": ext}
+	if opts.CoverFirstPage {
+		content["coverPageNumber"] = 0
+	}
+	if err := writeItem(client, id, parent, name, "DocumentType", content); err != nil {
+		return "", fmt.Errorf("writing document metadata: %w", err)
+	}
+
+	// The reading app only picks up new files when it starts
+	if _, err := run(client, "systemctl restart xochitl", nil); err != nil {
+		logging.Logf("[DELIVERY] Uploaded %s but could not restart xochitl: %v", name, err)
+	}
+
+	logging.Logf("[DELIVERY] Copied %s to %s over SSH", baseName(filePath), rmDir)
+	return baseName(filePath), nil
+}
+
+func listFoldersSSH(ctx context.Context, t Target) ([]string, error) {
+	client, err := dialSSH(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	entries, err := readEntries(client)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := []string{"/"}
+	seen := make(map[string]bool)
+	var walk func(parent, dir string)
+	walk = func(parent, dir string) {
+		for _, e := range entries {
+			if e.meta.Type == "CollectionType" && e.meta.Parent == parent && !seen[e.id] {
+				seen[e.id] = true
+				child := path.Join(dir, e.meta.VisibleName)
+				folders = append(folders, child)
+				walk(e.id, child)
+			}
+		}
+	}
+	walk("", "/")
+	return folders, nil
+}
@@ -0,0 +1,170 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// usbClient talks to the tablet's USB web interface. Uploads can be large and
+// the tablet is slow to import them, so the timeout is generous.
+var usbClient = &http.Client{Timeout: 5 * time.Minute}
+
+// usbEntry is an item returned by the USB web interface's /documents endpoint
+type usbEntry struct {
+	ID   string `json:"ID"`
+	Name string `json:"VissibleName"`
+	Type string `json:"Type"`
+}
+
+const usbCollectionType = "CollectionType"
+
+func usbURL(t Target, p string) string {
+	return "http://" + t.Host + p
+}
+
+// usbList lists a folder. The USB web interface also makes it the folder
+// that uploads go into.
+func usbList(ctx context.Context, t Target, folderID string) ([]usbEntry, error) {
+	var resp *http.Response
+	// Current firmware lists folders with POST, older firmware with GET
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, usbURL(t, "/documents/"+folderID), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = usbClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("USB web interface unreachable at %s: %w", t.Host, err)
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			break
+		}
+		resp.Body.Close()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("USB web interface returned %s", resp.Status)
+	}
+	var entries []usbEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("unexpected USB web interface response: %w", err)
+	}
+	return entries, nil
+}
+
+func uploadUSB(ctx context.Context, t Target, filePath, rmDir string, opts Options) (string, error) {
+	// Walk down to rmDir; the last folder listed is where the upload lands
+	entries, err := usbList(ctx, t, "")
+	if err != nil {
+		return "", err
+	}
+	for _, name := range splitDir(rmDir) {
+		folderID := ""
+		for _, e := range entries {
+			if e.Type == usbCollectionType && e.Name == name {
+				folderID = e.ID
+				break
+			}
+		}
+		if folderID == "" {
+			// The USB web interface can't create folders
+			return "", fmt.Errorf("folder %q not found on the tablet; create it on the device first", rmDir)
+		}
+		if entries, err = usbList(ctx, t, folderID); err != nil {
+			return "", err
+		}
+	}
+
+	name := visibleName(filePath)
+	for _, e := range entries {
+		if e.Type != usbCollectionType && e.Name == name {
+			if opts.ConflictResolution == "" || opts.ConflictResolution == "abort" {
+				return "", fmt.Errorf("entry already exists: %s", name)
+			}
+			// The USB web interface can only add documents, not replace them
+			logging.Logf("[DELIVERY] %s already exists on the tablet; the USB web interface will add a copy", name)
+			break
+		}
+	}
+	if opts.CoverFirstPage {
+		logging.Debugf("[DELIVERY] Cover page setting is not supported over USB")
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Stream the multipart body rather than buffering the whole file
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", baseName(filePath))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, usbURL(t, "/upload"), pr)
+	if err != nil {
+		pr.Close()
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	// The web interface rejects uploads that don't appear to come from its own page
+	req.Header.Set("Origin", usbURL(t, ""))
+	req.Header.Set("Referer", usbURL(t, "/"))
+
+	resp, err := usbClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("USB upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("USB upload failed: %s %s", resp.Status, body)
+	}
+
+	logging.Logf("[DELIVERY] Uploaded %s to %s over USB", baseName(filePath), rmDir)
+	return baseName(filePath), nil
+}
+
+func listFoldersUSB(ctx context.Context, t Target) ([]string, error) {
+	folders := []string{"/"}
+	var walk func(id, dir string) error
+	walk = func(id, dir string) error {
+		entries, err := usbList(ctx, t, id)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Type != usbCollectionType {
+				continue
+			}
+			child := path.Join(dir, e.Name)
+			folders = append(folders, child)
+			if err := walk(e.ID, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("", "/"); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+)
+
+// Window is the time of day documents may be delivered to a tablet. Jobs
+// submitted outside it are queued until it opens, so the tablet isn't woken
+// by overnight automation. End before Start wraps past midnight.
+type Window struct {
+	// Start and End are minutes after midnight in Location
+	Start    int
+	End      int
+	Location *time.Location
+}
+
+// parseClock parses an HH:MM time of day into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ParseWindow builds a window from HH:MM start and end times and an IANA
+// time zone, defaulting to the server's. It returns nil when start and end
+// are both empty, meaning delivery at any time.
+func ParseWindow(start, end, tz string) (*Window, error) {
+	start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+	if start == "" && end == "" {
+		return nil, nil
+	}
+	if start == "" || end == "" {
+		return nil, fmt.Errorf("delivery window needs both a start and an end time")
+	}
+	w := &Window{Location: time.Local}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	if w.Start == w.End {
+		return nil, fmt.Errorf("delivery window start and end must differ")
+	}
+	if tz = strings.TrimSpace(tz); tz != "" {
+		if w.Location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", tz)
+		}
+	}
+	return w, nil
+}
+
+// WindowForUser returns the delivery window for user, falling back to
+// DELIVERY_WINDOW (e.g. "06:00-22:00") and DELIVERY_TIMEZONE when the user
+// hasn't set one. It returns nil when documents can be delivered at any time.
+func WindowForUser(user *database.User) *Window {
+	start, end, tz := "", "", config.Get("DELIVERY_TIMEZONE", "")
+	if user != nil && user.DeliveryWindowStart != "" {
+		start, end = user.DeliveryWindowStart, user.DeliveryWindowEnd
+		if user.DeliveryTimezone != "" {
+			tz = user.DeliveryTimezone
+		}
+	} else if def := config.Get("DELIVERY_WINDOW", ""); def != "" {
+		start, end, _ = strings.Cut(def, "-")
+	}
+	w, err := ParseWindow(start, end, tz)
+	if err != nil {
+		return nil
+	}
+	return w
+}
+
+// Open reports whether t falls inside the window
+func (w *Window) Open(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	t = t.In(w.Location)
+	m := t.Hour()*60 + t.Minute()
+	if w.Start < w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+// NextOpen returns when the window next opens after t, or t if it's open
+func (w *Window) NextOpen(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+	local := t.In(w.Location)
+	opens := time.Date(local.Year(), local.Month(), local.Day(), w.Start/60, w.Start%60, 0, 0, w.Location)
+	if !opens.After(local) {
+		opens = opens.AddDate(0, 0, 1)
+	}
+	return opens
+}
+
+// String formats the window as HH:MM-HH:MM with its time zone
+func (w *Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s", w.Start/60, w.Start%60, w.End/60, w.End%60, w.Location)
+}
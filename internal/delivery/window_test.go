@@ -0,0 +1,69 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowOpen(t *testing.T) {
+	day, err := ParseWindow("06:00", "22:00", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night, err := ParseWindow("22:00", "06:00", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		clock      string
+		day, night bool
+	}{
+		{"05:59", false, true},
+		{"06:00", true, false},
+		{"12:30", true, false},
+		{"21:59", true, false},
+		{"22:00", false, true},
+		{"23:45", false, true},
+	}
+	for _, tc := range cases {
+		now, _ := time.Parse("2006-01-02 15:04", "2026-10-16 "+tc.clock)
+		if got := day.Open(now); got != tc.day {
+			t.Errorf("06:00-22:00 at %s: open = %v, want %v", tc.clock, got, tc.day)
+		}
+		if got := night.Open(now); got != tc.night {
+			t.Errorf("22:00-06:00 at %s: open = %v, want %v", tc.clock, got, tc.night)
+		}
+	}
+}
+
+func TestWindowNextOpen(t *testing.T) {
+	w, err := ParseWindow("06:00", "22:00", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	late := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	if got, want := w.NextOpen(late), time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextOpen(23:00) = %v, want %v", got, want)
+	}
+	early := time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	if got, want := w.NextOpen(early), time.Date(2026, 10, 16, 6, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextOpen(02:00) = %v, want %v", got, want)
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	if w, err := ParseWindow("", "", ""); w != nil || err != nil {
+		t.Errorf("empty window = %v, %v; want nil, nil", w, err)
+	}
+	for _, c := range [][3]string{
+		{"06:00", "", ""},
+		{"6am", "22:00", ""},
+		{"06:00", "06:00", ""},
+		{"06:00", "22:00", "Not/AZone"},
+	} {
+		if _, err := ParseWindow(c[0], c[1], c[2]); err == nil {
+			t.Errorf("ParseWindow(%q, %q, %q) succeeded, want error", c[0], c[1], c[2])
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package demo runs Aviary as a public demo instance. DEMO_MODE forces
+// DRY_RUN so nothing reaches a real reMarkable, seeds synthetic users and
+// upload history to explore, and blocks actions that would change accounts,
+// server settings or stored data for other visitors.
+package demo
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"gorm.io/gorm"
+)
+
+// Username is the seeded admin account visitors sign in with
+const Username = "demo"
+
+// Enabled reports whether DEMO_MODE is on
+func Enabled() bool {
+	return config.GetBool("DEMO_MODE", false)
+}
+
+// Password is the password of every seeded account
+func Password() string {
+	return config.Get("DEMO_PASSWORD", "aviary-demo")
+}
+
+// Apply forces DRY_RUN when demo mode is on. It must run before anything
+// reads DRY_RUN.
+func Apply() {
+	if !Enabled() {
+		return
+	}
+	if err := os.Setenv("DRY_RUN", "true"); err != nil {
+		logging.Logf("[DEMO] Failed to force DRY_RUN: %v", err)
+	}
+	logging.Logf("[DEMO] Demo mode enabled: DRY_RUN forced on and destructive actions blocked")
+}
+
+// blockedRoutes are requests rejected in demo mode, as "METHOD route". Every
+// DELETE, and every change under /api/admin and /api/setup, is blocked too.
+var blockedRoutes = map[string]bool{
+	"POST /api/auth/register":                         true,
+	"POST /api/auth/register/public":                  true,
+	"POST /api/auth/password-reset":                   true,
+	"POST /api/auth/password-reset/confirm":           true,
+	"POST /api/users":                                 true,
+	"PUT /api/users/:id":                              true,
+	"POST /api/users/:id/password":                    true,
+	"POST /api/users/:id/reset-password":              true,
+	"POST /api/users/:id/deactivate":                  true,
+	"POST /api/users/:id/activate":                    true,
+	"POST /api/users/:id/promote":                     true,
+	"POST /api/users/:id/demote":                      true,
+	"POST /api/users/bulk":                            true,
+	"PUT /api/profile":                                true,
+	"POST /api/profile/password":                      true,
+	"POST /api/profile/password/local":                true,
+	"POST /api/profile/oidc/link":                     true,
+	"GET /api/profile/cloud-drives/:provider/connect": true,
+	"PUT /api/profile/delivery":                       true,
+	"POST /api/profile/delivery/test":                 true,
+	"POST /api/profile/send-targets":                  true,
+	"PUT /api/profile/send-targets/:id":               true,
+	"POST /api/profile/send-targets/:id/test":         true,
+	"POST /api/profile/pair":                          true,
+	"POST /api/profile/disconnect":                    true,
+	"POST /api/pair":                                  true,
+	"POST /api/rm/documents/move":                     true,
+}
+
+// uploadRoutes accept documents; their bodies are capped by DEMO_MAX_UPLOAD_MB
+var uploadRoutes = map[string]bool{
+	"POST /api/upload":  true,
+	"POST /api/webhook": true,
+}
+
+// Blocked reports whether a request for route is rejected in demo mode
+func Blocked(method, route string) bool {
+	if method == http.MethodDelete {
+		return true
+	}
+	if method != http.MethodGet && method != http.MethodHead &&
+		(strings.HasPrefix(route, "/api/admin/") || strings.HasPrefix(route, "/api/setup")) {
+		return true
+	}
+	return blockedRoutes[method+" "+route]
+}
+
+// Middleware rejects blocked requests with 403 and caps upload sizes. It's a
+// no-op unless demo mode is on.
+func Middleware() gin.HandlerFunc {
+	if !Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	maxUpload := int64(config.GetInt("DEMO_MAX_UPLOAD_MB", 10)) << 20
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if Blocked(c.Request.Method, route) {
+			apierror.Abort(c, http.StatusForbidden, "demo_mode",
+				"This action is disabled on the demo instance")
+			return
+		}
+		if uploadRoutes[c.Request.Method+" "+route] && maxUpload > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUpload)
+		}
+		c.Next()
+	}
+}
+
+// demoUsers are the seeded accounts; the first is the admin
+var demoUsers = []struct {
+	username, email, rmdir string
+	admin                  bool
+}{
+	{Username, "demo@demo.invalid", "/Aviary", true},
+	{"reader", "reader@demo.invalid", "/Articles", false},
+	{"researcher", "researcher@demo.invalid", "/Papers", false},
+}
+
+// demoDocuments are the synthetic uploads spread across the seeded users
+var demoDocuments = []struct {
+	name, docType, sourceURL, converter string
+}{
+	{"The Art of Note Taking", "EPUB", "https://example.com/articles/note-taking", "article_to_epub"},
+	{"Quarterly Report", "PDF", "", ""},
+	{"Attention Is All You Need", "PDF", "https://example.org/papers/attention.pdf", ""},
+	{"Field Guide to Birds", "PDF", "https://example.net/guides/birds.pdf", ""},
+	{"Whiteboard Sketch", "PDF", "", "image_to_pdf"},
+	{"Reading List", "EPUB", "https://example.com/blog/reading-list", "article_to_epub"},
+	{"Meeting Notes 2024-03", "PDF", "", ""},
+	{"A Short History of Paper", "EPUB", "https://example.org/history-of-paper", "article_to_epub"},
+	{"Lecture Slides Week 4", "PDF", "https://example.edu/courses/week4.pdf", ""},
+	{"Recipe Collection", "PDF", "", "image_to_pdf"},
+	{"Sleep and Memory", "PDF", "https://example.org/papers/sleep-memory.pdf", ""},
+	{"Weekend Longread", "EPUB", "https://example.com/longreads/weekend", "article_to_epub"},
+}
+
+// Seed creates the demo accounts and their upload history. It does nothing
+// if the demo admin already exists, so restarts keep the same data.
+func Seed(db *gorm.DB) error {
+	var existing int64
+	if err := db.Model(&database.User{}).Where("username = ?", Username).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	userService := database.NewUserService(db)
+	var users []*database.User
+	for _, u := range demoUsers {
+		user, err := userService.CreateUser(u.username, u.email, Password(), u.admin)
+		if err != nil {
+			return fmt.Errorf("create demo user %s: %w", u.username, err)
+		}
+		if err := db.Model(user).Update("default_rmdir", u.rmdir).Error; err != nil {
+			return err
+		}
+		user.DefaultRmdir = u.rmdir
+		users = append(users, user)
+	}
+
+	// A fixed seed gives every demo instance the same history
+	r := rand.New(rand.NewSource(1))
+	now := time.Now()
+	for i, d := range demoDocuments {
+		user := users[i%len(users)]
+		ext := strings.ToLower(d.docType)
+		uploaded := now.Add(-time.Duration(i*53+r.Intn(48)) * time.Hour)
+		doc := database.Document{
+			UserID:       user.ID,
+			DocumentName: d.name,
+			RemotePath:   user.DefaultRmdir + "/" + d.name,
+			DocumentType: d.docType,
+			FileSize:     int64(200+r.Intn(8000)) << 10,
+			Status:       "uploaded",
+			UploadDate:   uploaded,
+			SourceURL:    d.sourceURL,
+			Converter:    d.converter,
+			SyncStatus:   "verified",
+			VerifiedAt:   &uploaded,
+		}
+		if d.converter == "image_to_pdf" {
+			ext = "png"
+		}
+		if d.sourceURL == "" {
+			doc.OriginalFilename = strings.ReplaceAll(strings.ToLower(d.name), " ", "-") + "." + ext
+		}
+		if err := db.Create(&doc).Error; err != nil {
+			return err
+		}
+	}
+
+	logging.Logf("[DEMO] Seeded %d demo users and %d documents", len(users), len(demoDocuments))
+	return nil
+}
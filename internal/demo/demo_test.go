@@ -0,0 +1,26 @@
+package demo
+
+import "testing"
+
+func TestBlocked(t *testing.T) {
+	cases := []struct {
+		method, route string
+		want          bool
+	}{
+		{"DELETE", "/api/api-keys/:id", true},
+		{"PUT", "/api/admin/settings", true},
+		{"POST", "/api/admin/backup-job", true},
+		{"GET", "/api/admin/status", false},
+		{"POST", "/api/setup/complete", true},
+		{"POST", "/api/users/:id/promote", true},
+		{"POST", "/api/profile/password", true},
+		{"POST", "/api/upload", false},
+		{"POST", "/api/webhook", false},
+		{"GET", "/api/profile/stats", false},
+	}
+	for _, tc := range cases {
+		if got := Blocked(tc.method, tc.route); got != tc.want {
+			t.Errorf("Blocked(%s %s) = %v, want %v", tc.method, tc.route, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package downloader
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/clouddrive"
 	"github.com/rmitchellscott/aviary/internal/manager"
 	"github.com/rmitchellscott/aviary/internal/security"
 )
@@ -26,6 +28,10 @@ const (
 	uaListURL = "https://raw.githubusercontent.com/jnrbsn/user-agents/main/user-agents.json"
 )
 
+// ErrCloudDriveNotShared is returned when a cloud drive link needs a signed-in
+// account to download and the user hasn't connected one
+var ErrCloudDriveNotShared = errors.New("cloud drive file is not publicly shared")
+
 var (
 	userAgents []string
 	rng        *rand.Rand
@@ -90,6 +96,12 @@ func DownloadPDF(urlStr string, tmp bool, prefix string, progress func(done, tot
 // Archival to storage backend happens later in the pipeline.
 // progress is an optional callback receiving bytes downloaded and total bytes.
 func DownloadPDFForUser(urlStr string, tmp bool, prefix string, userID uuid.UUID, progress func(done, total int64)) (string, error) {
+	return DownloadPDFForUserContext(context.Background(), urlStr, tmp, prefix, userID, progress)
+}
+
+// DownloadPDFForUserContext is DownloadPDFForUser stopped when ctx is done,
+// e.g. when the job is cancelled. A partial download is removed.
+func DownloadPDFForUserContext(ctx context.Context, urlStr string, tmp bool, prefix string, userID uuid.UUID, progress func(done, total int64)) (string, error) {
 	// Validate URL before attempting download
 	if err := security.ValidateURL(urlStr); err != nil {
 		return "", fmt.Errorf("URL validation failed: %w", err)
@@ -102,25 +114,55 @@ func DownloadPDFForUser(urlStr string, tmp bool, prefix string, userID uuid.UUID
 		return "", err
 	}
 
-	// 2) Build request with a random UA
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+	// 2) Build request with a random UA. Cloud drive share links are fetched
+	// from the provider's download endpoint instead of the HTML viewer page.
+	client := downloadClient
+	var req *http.Request
+	var nameHint string
+	link, isCloudDrive := clouddrive.Parse(urlStr)
+	if isCloudDrive {
+		var userClient *http.Client
+		req, userClient, nameHint, err = clouddrive.NewRequest(ctx, link, userID)
+		if err != nil {
+			return "", fmt.Errorf("preparing %s download: %w", clouddrive.ProviderName(link.Provider), err)
+		}
+		if userClient != nil {
+			userClient.Timeout = downloadTimeout
+			client = userClient
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+		if err != nil {
+			return "", fmt.Errorf("creating request: %w", err)
+		}
 	}
 	req.Header.Set("User-Agent", PickUA())
 
-	resp, err := downloadClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("performing request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if isCloudDrive && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound) {
+		return "", fmt.Errorf("%w: %s returned %s", ErrCloudDriveNotShared, clouddrive.ProviderName(link.Provider), resp.Status)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return "", errors.New("failed to download PDF: status " + resp.Status)
 	}
+	// Private files get a sign-in page instead of the file
+	if isCloudDrive && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return "", fmt.Errorf("%w: %s returned a web page", ErrCloudDriveNotShared, clouddrive.ProviderName(link.Provider))
+	}
 
-	// 3) Choose a filename, preferring the final URL
-	name := filepath.Base(resp.Request.URL.Path)
+	// 3) Choose a filename, preferring the name the server sent, then the final URL
+	name := clouddrive.ResponseFilename(resp)
+	if strings.TrimSpace(name) == "" {
+		name = nameHint
+	}
+	if strings.TrimSpace(name) == "" {
+		name = filepath.Base(resp.Request.URL.Path)
+	}
 	if strings.TrimSpace(name) == "" {
 		name = filepath.Base(urlStr)
 	}
@@ -137,6 +179,12 @@ func DownloadPDFForUser(urlStr string, tmp bool, prefix string, userID uuid.UUID
 			name += ".jpg"
 		case strings.HasPrefix(ct, "application/epub+zip"):
 			name += ".epub"
+		case strings.HasPrefix(ct, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"):
+			name += ".docx"
+		case strings.HasPrefix(ct, "application/vnd.openxmlformats-officedocument.presentationml.presentation"):
+			name += ".pptx"
+		case strings.HasPrefix(ct, "application/vnd.oasis.opendocument.text"):
+			name += ".odt"
 		default:
 			// Fallback: try to extract extension from original URL
 			originalName := filepath.Base(urlStr)
@@ -172,6 +220,7 @@ func DownloadPDFForUser(urlStr string, tmp bool, prefix string, userID uuid.UUID
 		progress(0, resp.ContentLength)
 	}
 	if _, err := io.Copy(f, pr); err != nil {
+		os.RemoveAll(tempDir)
 		return "", err
 	}
 
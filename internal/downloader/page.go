@@ -0,0 +1,60 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/rmitchellscott/aviary/internal/security"
+	"golang.org/x/net/html/charset"
+)
+
+// maxPageSize bounds the HTML read from a web page
+const maxPageSize = 20 << 20
+
+// FetchPage downloads the HTML of a web page, converted to UTF-8, and returns
+// it with the URL it was served from after redirects, against which its
+// relative links resolve.
+func FetchPage(urlStr string) (string, *url.URL, error) {
+	return FetchPageContext(context.Background(), urlStr)
+}
+
+// FetchPageContext is FetchPage stopped when ctx is done
+func FetchPageContext(ctx context.Context, urlStr string) (string, *url.URL, error) {
+	if err := security.ValidateURL(urlStr); err != nil {
+		return "", nil, fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", PickUA())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+
+	// codeql[go/request-forgery]: URL is validated by security.ValidateURL above
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("HTTP %d when fetching URL", resp.StatusCode)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxPageSize+1), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", nil, fmt.Errorf("unsupported page encoding: %w", err)
+	}
+	page, err := io.ReadAll(body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read page: %w", err)
+	}
+	if len(page) > maxPageSize {
+		return "", nil, fmt.Errorf("page is larger than %d MB", maxPageSize>>20)
+	}
+	return string(page), resp.Request.URL, nil
+}
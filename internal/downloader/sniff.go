@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/rmitchellscott/aviary/internal/clouddrive"
 	"github.com/rmitchellscott/aviary/internal/security"
 )
 
@@ -16,6 +17,10 @@ func SniffMime(urlStr string) (string, error) {
 	if err := security.ValidateURL(urlStr); err != nil {
 		return "", fmt.Errorf("URL validation failed: %w", err)
 	}
+	// Sniff the shared file rather than the cloud drive's viewer page
+	if link, ok := clouddrive.Parse(urlStr); ok {
+		urlStr = link.DownloadURL
+	}
 
 	req, err := http.NewRequest("GET", urlStr, nil)
 	if err != nil {
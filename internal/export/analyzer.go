@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/rmitchellscott/aviary/internal/database"
 	"github.com/rmitchellscott/aviary/internal/logging"
 	"gorm.io/gorm"
 )
@@ -21,6 +22,7 @@ type BackupAnalysis struct {
 	GitCommit       string                 `json:"git_commit"`
 	ExportTimestamp string                 `json:"export_timestamp"`
 	DatabaseType    string                 `json:"database_type"`
+	DatabaseFormat  string                 `json:"database_format,omitempty"`
 	UserCount       int                    `json:"user_count"`
 	APIKeyCount     int                    `json:"api_key_count"`
 	DocumentCount   int64                  `json:"document_count"`
@@ -105,7 +107,9 @@ func (a *Analyzer) tryFastAnalysis(archivePath string) (*BackupAnalysis, error)
 		UsersExported:   metadata.UsersExported,
 		UserCount:       metadata.TotalUsers,    // Use from metadata if available
 		APIKeyCount:     metadata.TotalAPIKeys,  // Use from metadata if available
+		DatabaseFormat:  metadata.DatabaseFormat,
 	}
+	checkDatabaseFormat(analysis)
 
 	// Check if this is an old backup without user/API key counts
 	if metadata.TotalUsers == 0 && metadata.TotalAPIKeys == 0 && len(metadata.ExportedTables) > 0 {
@@ -175,7 +179,9 @@ func (a *Analyzer) AnalyzeBackup(archivePath string) (*BackupAnalysis, error) {
 		ExportedTables:  metadata.ExportedTables,
 		UsersExported:   metadata.UsersExported,
 		ExtractionPath:  extractionDir, // Set extraction path for reuse
+		DatabaseFormat:  metadata.DatabaseFormat,
 	}
+	checkDatabaseFormat(analysis)
 
 	// Analyze database files
 	dbDir := filepath.Join(extractionDir, "database")
@@ -263,3 +269,17 @@ func (a *Analyzer) validateBackupStructure(tempDir string, analysis *BackupAnaly
 		analysis.Valid = false
 	}
 }
+
+// checkDatabaseFormat flags SQL dump backups that can't be restored into the current database
+func checkDatabaseFormat(analysis *BackupAnalysis) {
+	if analysis.DatabaseFormat != DatabaseFormatSQL {
+		return
+	}
+	if current := database.GetDatabaseConfig().Type; current != "postgres" {
+		analysis.Errors = append(analysis.Errors, fmt.Sprintf("SQL dump backups can only be restored into PostgreSQL (current database: %s)", current))
+		analysis.Valid = false
+	} else if err := CheckPostgresClient("psql"); err != nil {
+		analysis.Errors = append(analysis.Errors, err.Error())
+		analysis.Valid = false
+	}
+}
@@ -32,6 +32,18 @@ type ExportMetadata struct {
 	ExportedTables  []string  `json:"exported_tables"`
 	TotalUsers      int       `json:"total_users"`     // Total number of users in backup
 	TotalAPIKeys    int       `json:"total_api_keys"`  // Total number of API keys in backup
+	DatabaseFormat  string    `json:"database_format,omitempty"` // "json" (default) or "sql"
+	// What ExportOptions left out of the files, if anything. The documents'
+	// database records are still included.
+	FilesExcludedUsers []string `json:"files_excluded_users,omitempty"`
+	FilesMaxAgeDays    int      `json:"files_max_age_days,omitempty"`
+	ExcludedDocuments  int64    `json:"excluded_documents,omitempty"`
+}
+
+// PartialFiles reports whether archived documents were left out of the
+// backup, so restoring it mustn't clear the documents already in storage
+func (m *ExportMetadata) PartialFiles() bool {
+	return len(m.FilesExcludedUsers) > 0 || m.FilesMaxAgeDays > 0
 }
 
 // ExportOptions configures what to include in the export
@@ -40,6 +52,12 @@ type ExportOptions struct {
 	IncludeFiles    bool
 	IncludeConfigs  bool
 	UserIDs         []uuid.UUID // If specified, only export these users
+	DatabaseFormat  string      // "json" (default) or "sql" for a pg_dump of PostgreSQL
+	// ExcludeFileUserIDs and FilesMaxAgeDays leave archived documents out
+	// of the files, keeping routine backups small: those of the given users,
+	// and those last modified more than FilesMaxAgeDays ago (0 keeps all)
+	ExcludeFileUserIDs []uuid.UUID
+	FilesMaxAgeDays    int
 }
 
 // ImportOptions configures how to handle the import
@@ -47,14 +65,19 @@ type ImportOptions struct {
 	OverwriteFiles    bool
 	OverwriteDatabase bool
 	UserIDs           []uuid.UUID // If specified, only import these users
+	// Merge adds the users in UserIDs alongside the existing ones, as when
+	// pulling users from another instance. Instance-wide tables such as
+	// system settings and other users' data are left untouched.
+	Merge bool
 }
 
 // Exporter handles creating complete backups
 type Exporter struct {
-	db              *gorm.DB
-	dataDir         string
-	storageBackend  storage.StorageBackendWithInfo
-	totalDocuments  int64
+	db                *gorm.DB
+	dataDir           string
+	storageBackend    storage.StorageBackendWithInfo
+	totalDocuments    int64
+	excludedDocuments int64
 }
 
 // NewExporter creates a new exporter instance
@@ -118,6 +141,13 @@ func (e *Exporter) Export(outputPath string, options ExportOptions) error {
 	metadata.UsersExported = exportedUsers
 	metadata.TotalSizeBytes = totalSize
 	metadata.TotalDocuments = e.totalDocuments // Use actual file count
+	if options.IncludeFiles {
+		for _, id := range options.ExcludeFileUserIDs {
+			metadata.FilesExcludedUsers = append(metadata.FilesExcludedUsers, id.String())
+		}
+		metadata.FilesMaxAgeDays = options.FilesMaxAgeDays
+		metadata.ExcludedDocuments = e.excludedDocuments
+	}
 
 	// Write metadata
 	metadataFile := filepath.Join(tempDir, "metadata.json")
@@ -133,13 +163,34 @@ func (e *Exporter) Export(outputPath string, options ExportOptions) error {
 	return nil
 }
 
-// exportDatabase exports all database tables to JSON files
+// exportDatabase exports all database tables to JSON files, or to a single
+// SQL dump when the SQL format is requested on PostgreSQL
 func (e *Exporter) exportDatabase(dbDir string, metadata *ExportMetadata, options ExportOptions) error {
 	models := database.GetAllModels()
 	var exportedTables []string
 
+	useSQL := options.DatabaseFormat == DatabaseFormatSQL
+	if useSQL && len(options.UserIDs) > 0 {
+		// pg_dump can't filter rows by user, so per-user exports stay on JSON
+		logging.Logf("[EXPORT] SQL dump does not support per-user exports, falling back to JSON")
+		useSQL = false
+	}
+
+	if useSQL {
+		if err := dumpPostgres(dbDir); err != nil {
+			return err
+		}
+		metadata.DatabaseFormat = DatabaseFormatSQL
+	} else {
+		metadata.DatabaseFormat = DatabaseFormatJSON
+	}
+
 	for _, model := range models {
 		tableName := getTableName(model)
+		if useSQL {
+			exportedTables = append(exportedTables, tableName)
+			continue
+		}
 		
 		// Get all records for this model
 		var records []map[string]interface{}
@@ -210,6 +261,16 @@ func (e *Exporter) exportFilesystem(fsDir string, options ExportOptions) (int64,
 		return 0, nil, fmt.Errorf("failed to get users: %w", err)
 	}
 
+	excludeFiles := make(map[uuid.UUID]bool, len(options.ExcludeFileUserIDs))
+	for _, id := range options.ExcludeFileUserIDs {
+		excludeFiles[id] = true
+	}
+	var cutoff time.Time
+	if options.FilesMaxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -options.FilesMaxAgeDays)
+	}
+	var excludedDocuments int64
+
 	for _, user := range users {
 		userID := user.ID.String()
 		exportedUsers = append(exportedUsers, userID)
@@ -223,6 +284,8 @@ func (e *Exporter) exportFilesystem(fsDir string, options ExportOptions) (int64,
 			if err != nil {
 				return 0, nil, fmt.Errorf("failed to list documents for user %s: %w", userID, err)
 			}
+			fileInfos, skipped := filterFiles(fileInfos, excludeFiles[user.ID], cutoff)
+			excludedDocuments += skipped
 			
 			if len(fileInfos) > 0 {
 				destDir := filepath.Join(fsDir, "documents", userID)
@@ -328,12 +391,35 @@ func (e *Exporter) exportFilesystem(fsDir string, options ExportOptions) (int64,
 
 	// Store the actual document count in metadata
 	e.totalDocuments = totalDocuments
+	e.excludedDocuments = excludedDocuments
 
 	return totalSize, exportedUsers, nil
 }
 
 // Helper functions
 
+// filterFiles drops the archived documents a backup leaves out: all of them
+// when excludeAll is set, otherwise those last modified before cutoff, if
+// set. It returns the files kept and how many were dropped.
+func filterFiles(infos []storage.StorageInfo, excludeAll bool, cutoff time.Time) ([]storage.StorageInfo, int64) {
+	if excludeAll {
+		return nil, int64(len(infos))
+	}
+	if cutoff.IsZero() {
+		return infos, 0
+	}
+	kept := infos[:0]
+	for _, info := range infos {
+		// Keep files whose age can't be told rather than lose them
+		modified, err := time.Parse(time.RFC3339, info.LastModified)
+		if err == nil && modified.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, info)
+	}
+	return kept, int64(len(infos) - len(kept))
+}
+
 func getTableName(model interface{}) string {
 	// This is a simplified version - you might want to use GORM's naming strategy
 	switch model.(type) {
@@ -351,6 +437,16 @@ func getTableName(model interface{}) string {
 		return "login_attempts"
 	case *database.FolderCache:
 		return "user_folders_cache"
+	case *database.CloudDriveToken:
+		return "cloud_drive_tokens"
+	case *database.SendTarget:
+		return "send_targets"
+	case *database.FolderMirror:
+		return "folder_mirrors"
+	case *database.Subscription:
+		return "subscriptions"
+	case *database.Mailbox:
+		return "mailboxes"
 	default:
 		return "unknown"
 	}
@@ -24,6 +24,18 @@ type Importer struct {
 	db             *gorm.DB
 	dataDir        string
 	storageBackend storage.StorageBackendWithInfo
+	tableResults   []TableImportResult
+}
+
+// TableImportResult reports the outcome of restoring a single table
+type TableImportResult struct {
+	Table   string `json:"table"`
+	Success bool   `json:"success"`
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+	// Skipped is set for a table that kept its previous contents because a
+	// table restored together with it failed
+	Skipped bool `json:"skipped,omitempty"`
 }
 
 // NewImporter creates a new importer instance
@@ -72,7 +84,7 @@ func (i *Importer) Import(archivePath string, options ImportOptions) (*ExportMet
 	// Import filesystem if present
 	fsDir := filepath.Join(tempDir, "filesystem")
 	if _, err := os.Stat(fsDir); err == nil {
-		if err := i.importFilesystem(fsDir, options); err != nil {
+		if err := i.importFilesystem(fsDir, options, metadata.PartialFiles()); err != nil {
 			return nil, fmt.Errorf("failed to import filesystem: %w", err)
 		}
 	}
@@ -105,7 +117,7 @@ func (i *Importer) ImportFromExtractedDirectory(extractedDir string, options Imp
 	// Import filesystem if present
 	fsDir := filepath.Join(extractedDir, "filesystem")
 	if _, err := os.Stat(fsDir); err == nil {
-		if err := i.importFilesystem(fsDir, options); err != nil {
+		if err := i.importFilesystem(fsDir, options, metadata.PartialFiles()); err != nil {
 			return nil, fmt.Errorf("failed to import filesystem: %w", err)
 		}
 	}
@@ -113,8 +125,24 @@ func (i *Importer) ImportFromExtractedDirectory(extractedDir string, options Imp
 	return &metadata, nil
 }
 
-// importDatabase imports all JSON files back to database tables
+// importDatabase imports all JSON files back to database tables, or replays
+// the SQL dump when the backup was exported in SQL format
 func (i *Importer) importDatabase(dbDir string, options ImportOptions) error {
+	dumpFile := filepath.Join(dbDir, sqlDumpFilename)
+	if _, err := os.Stat(dumpFile); err == nil {
+		if len(options.UserIDs) > 0 {
+			return fmt.Errorf("SQL dump backups can't be restored for individual users")
+		}
+		// psql runs the dump in a single transaction, so it succeeds or fails as a whole
+		err := restorePostgres(dumpFile)
+		result := TableImportResult{Table: sqlDumpFilename, Success: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		i.tableResults = []TableImportResult{result}
+		return err
+	}
+
 	// Get the import order - dependencies first
 	// Note: system_settings references users, so import users first, then update system_settings
 	importOrder := []string{
@@ -124,27 +152,127 @@ func (i *Importer) importDatabase(dbDir string, options ImportOptions) error {
 		"user_sessions",
 		"documents",
 		"user_folders_cache",
+		"cloud_drive_tokens",
+		"send_targets",
+		"folder_mirrors",
+		"subscriptions",
+		"mailboxes",
 		"login_attempts",
 	}
 
+	// Replacing users also removes, through ON DELETE CASCADE, the rows that
+	// belong to them, so users and the tables of user data are restored
+	// together: if one of them fails, all of them keep their previous
+	// contents. The other tables each get their own savepoint, so a failure
+	// rolls back only that table instead of leaving it half-cleared.
+	var userTables, otherTables []string
 	for _, tableName := range importOrder {
-		jsonFile := filepath.Join(dbDir, tableName+".json")
-
 		// Skip if file doesn't exist
-		if _, err := os.Stat(jsonFile); os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Join(dbDir, tableName+".json")); os.IsNotExist(err) {
 			continue
 		}
+		if tableName == "users" || hasUserIDInTable(tableName) {
+			userTables = append(userTables, tableName)
+		} else {
+			otherTables = append(otherTables, tableName)
+		}
+	}
+
+	i.tableResults = nil
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		i.tableResults = append(i.tableResults, i.importUserTables(tx, dbDir, userTables, options)...)
 
-		if err := i.importTable(jsonFile, tableName, options); err != nil {
-			return fmt.Errorf("failed to import table %s: %w", tableName, err)
+		for _, tableName := range otherTables {
+			jsonFile := filepath.Join(dbDir, tableName+".json")
+			result := TableImportResult{Table: tableName}
+			tableErr := tx.Transaction(func(tableTx *gorm.DB) error {
+				tableImporter := *i
+				tableImporter.db = tableTx
+				count, err := tableImporter.importTable(jsonFile, tableName, options)
+				result.Records = count
+				return err
+			})
+
+			if tableErr != nil {
+				logging.Logf("[RESTORE] Rolled back table %s: %v", tableName, tableErr)
+				result.Records = 0
+				result.Error = tableErr.Error()
+			} else {
+				result.Success = true
+				logging.Logf("[RESTORE] Imported %d records into %s", result.Records, tableName)
+			}
+			i.tableResults = append(i.tableResults, result)
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit database import: %w", err)
+	}
+
+	var failedTables []string
+	for _, result := range i.tableResults {
+		if !result.Success {
+			failedTables = append(failedTables, result.Table)
+		}
+	}
+	if len(failedTables) > 0 {
+		return fmt.Errorf("failed to import tables: %s", strings.Join(failedTables, ", "))
 	}
 
 	return nil
 }
 
-// cleanupExistingUserDirectories removes existing user files before restore
-func (i *Importer) cleanupExistingUserDirectories(options ImportOptions) error {
+// importUserTables restores users and the tables of their data inside one
+// savepoint and returns each table's result. When a table fails, the ones
+// imported before it are rolled back and the rest aren't attempted; both are
+// reported as skipped.
+func (i *Importer) importUserTables(tx *gorm.DB, dbDir string, tables []string, options ImportOptions) []TableImportResult {
+	results := make([]TableImportResult, len(tables))
+	for n, tableName := range tables {
+		results[n].Table = tableName
+	}
+
+	failed := -1
+	tx.Transaction(func(groupTx *gorm.DB) error {
+		tableImporter := *i
+		tableImporter.db = groupTx
+		for n, tableName := range tables {
+			count, err := tableImporter.importTable(filepath.Join(dbDir, tableName+".json"), tableName, options)
+			if err != nil {
+				failed = n
+				results[n].Error = err.Error()
+				return err
+			}
+			results[n].Records = count
+		}
+		return nil
+	})
+
+	for n := range results {
+		switch {
+		case failed < 0:
+			results[n].Success = true
+			logging.Logf("[RESTORE] Imported %d records into %s", results[n].Records, results[n].Table)
+		case n == failed:
+			logging.Logf("[RESTORE] Rolled back table %s: %s", results[n].Table, results[n].Error)
+		default:
+			logging.Logf("[RESTORE] Kept the previous contents of %s because %s failed to import", results[n].Table, tables[failed])
+			results[n].Records = 0
+			results[n].Skipped = true
+			results[n].Error = "kept its previous contents because " + tables[failed] + " failed to import"
+		}
+	}
+	return results
+}
+
+// TableResults returns the per-table outcome of the last database import
+func (i *Importer) TableResults() []TableImportResult {
+	return i.tableResults
+}
+
+// cleanupExistingUserDirectories removes existing user files before restore,
+// apart from archived documents when keepDocuments is set
+func (i *Importer) cleanupExistingUserDirectories(options ImportOptions, keepDocuments bool) error {
 	ctx := context.Background()
 	
 	// Get list of users to clean
@@ -178,6 +306,9 @@ func (i *Importer) cleanupExistingUserDirectories(options ImportOptions) error {
 		
 		// Delete all files
 		for _, key := range keys {
+			if keepDocuments && strings.HasPrefix(key, userPrefix+"pdfs/") {
+				continue
+			}
 			if err := i.storageBackend.Delete(ctx, key); err != nil {
 				logging.Logf("[RESTORE] Warning: failed to delete %s: %v", key, err)
 			}
@@ -191,39 +322,51 @@ func (i *Importer) cleanupExistingUserDirectories(options ImportOptions) error {
 	return nil
 }
 
-// importTable imports a specific table from JSON
-func (i *Importer) importTable(jsonFile, tableName string, options ImportOptions) error {
+// importTable imports a specific table from JSON and returns the number of records written
+func (i *Importer) importTable(jsonFile, tableName string, options ImportOptions) (int, error) {
 	// Read JSON data
 	var records []map[string]interface{}
 	if err := readJSON(jsonFile, &records); err != nil {
-		return fmt.Errorf("failed to read JSON file: %w", err)
+		return 0, fmt.Errorf("failed to read JSON file: %w", err)
 	}
 
 	if len(records) == 0 {
-		return nil // Nothing to import
+		return 0, nil // Nothing to import
+	}
+
+	// A merge only brings in the selected users and what belongs to them
+	if options.Merge && tableName != "users" && !hasUserIDInTable(tableName) {
+		return 0, nil
 	}
 
 	// Filter records by user ID if specified
 	if len(options.UserIDs) > 0 && hasUserIDInTable(tableName) {
 		records = filterRecordsByUserID(records, options.UserIDs)
 	}
+	if options.Merge && tableName == "users" {
+		records = filterRecordsByID(records, options.UserIDs)
+	}
 
 	// Get the appropriate model
 	model := getModelForTable(tableName)
 	if model == nil {
-		return fmt.Errorf("unknown table: %s", tableName)
+		return 0, fmt.Errorf("unknown table: %s", tableName)
 	}
 
 	// Clear existing data (restore should replace everything)
 	if len(options.UserIDs) > 0 && hasUserIDInTable(tableName) {
 		// Only delete records for specific users
 		if err := i.db.Where("user_id IN ?", options.UserIDs).Delete(model).Error; err != nil {
-			return fmt.Errorf("failed to clear existing user data: %w", err)
+			return 0, fmt.Errorf("failed to clear existing user data: %w", err)
+		}
+	} else if options.Merge {
+		if err := i.db.Where("id IN ?", options.UserIDs).Delete(model).Error; err != nil {
+			return 0, fmt.Errorf("failed to clear existing users: %w", err)
 		}
 	} else {
 		// Clear entire table for full restore using constraint-aware method
 		if err := i.clearTableWithConstraintHandling(tableName, model); err != nil {
-			return fmt.Errorf("failed to clear existing data: %w", err)
+			return 0, fmt.Errorf("failed to clear existing data: %w", err)
 		}
 	}
 
@@ -237,11 +380,11 @@ func (i *Importer) importTable(jsonFile, tableName string, options ImportOptions
 
 		batch := records[batchStart:end]
 		if err := i.importBatch(batch, tableName); err != nil {
-			return fmt.Errorf("failed to import batch: %w", err)
+			return 0, fmt.Errorf("failed to import batch: %w", err)
 		}
 	}
 
-	return nil
+	return len(records), nil
 }
 
 // importBatch imports a batch of records
@@ -261,6 +404,16 @@ func (i *Importer) importBatch(records []map[string]interface{}, tableName strin
 		return i.importLoginAttemptBatch(records)
 	case "user_folders_cache":
 		return i.importFolderCacheBatch(records)
+	case "cloud_drive_tokens":
+		return i.importCloudDriveTokenBatch(records)
+	case "send_targets":
+		return i.importSendTargetBatch(records)
+	case "folder_mirrors":
+		return i.importFolderMirrorBatch(records)
+	case "subscriptions":
+		return i.importSubscriptionBatch(records)
+	case "mailboxes":
+		return i.importMailboxBatch(records)
 	default:
 		return fmt.Errorf("unsupported table: %s", tableName)
 	}
@@ -355,18 +508,93 @@ func (i *Importer) importFolderCacheBatch(records []map[string]interface{}) erro
 	return i.db.CreateInBatches(batch, len(batch)).Error
 }
 
+func (i *Importer) importCloudDriveTokenBatch(records []map[string]interface{}) error {
+	var batch []database.CloudDriveToken
+	for _, record := range records {
+		var token database.CloudDriveToken
+		if err := mapToStruct(record, &token); err != nil {
+			return err
+		}
+		// Token fields are hidden from JSON, so copy them over directly
+		token.AccessToken, _ = record["access_token"].(string)
+		token.RefreshToken, _ = record["refresh_token"].(string)
+		token.TokenType, _ = record["token_type"].(string)
+		batch = append(batch, token)
+	}
+	return i.db.CreateInBatches(batch, len(batch)).Error
+}
+
+func (i *Importer) importSendTargetBatch(records []map[string]interface{}) error {
+	var batch []database.SendTarget
+	for _, record := range records {
+		var target database.SendTarget
+		if err := mapToStruct(record, &target); err != nil {
+			return err
+		}
+		batch = append(batch, target)
+	}
+	return i.db.CreateInBatches(batch, len(batch)).Error
+}
+
+func (i *Importer) importFolderMirrorBatch(records []map[string]interface{}) error {
+	var batch []database.FolderMirror
+	for _, record := range records {
+		var mirror database.FolderMirror
+		if err := mapToStruct(record, &mirror); err != nil {
+			return err
+		}
+		// State is hidden from JSON, so copy it over directly
+		mirror.State, _ = record["state"].(string)
+		batch = append(batch, mirror)
+	}
+	return i.db.CreateInBatches(batch, len(batch)).Error
+}
+
+func (i *Importer) importSubscriptionBatch(records []map[string]interface{}) error {
+	var batch []database.Subscription
+	for _, record := range records {
+		var sub database.Subscription
+		if err := mapToStruct(record, &sub); err != nil {
+			return err
+		}
+		batch = append(batch, sub)
+	}
+	return i.db.CreateInBatches(batch, len(batch)).Error
+}
+
+func (i *Importer) importMailboxBatch(records []map[string]interface{}) error {
+	var batch []database.Mailbox
+	for _, record := range records {
+		var mailbox database.Mailbox
+		if err := mapToStruct(record, &mailbox); err != nil {
+			return err
+		}
+		// Password is hidden from JSON, so copy it over directly
+		mailbox.Password, _ = record["password"].(string)
+		batch = append(batch, mailbox)
+	}
+	return i.db.CreateInBatches(batch, len(batch)).Error
+}
+
 // importFilesystem restores user files and configurations
-func (i *Importer) importFilesystem(fsDir string, options ImportOptions) error {
-	// Clean up existing user directories first if overwriting
+func (i *Importer) importFilesystem(fsDir string, options ImportOptions, partialFiles bool) error {
+	// Clean up existing user directories first if overwriting. A backup that
+	// left archived documents out keeps the ones already in storage.
 	if options.OverwriteFiles {
-		if err := i.cleanupExistingUserDirectories(options); err != nil {
+		if partialFiles {
+			logging.Logf("[RESTORE] Backup leaves out some archived documents, keeping existing documents")
+		}
+		if err := i.cleanupExistingUserDirectories(options, partialFiles); err != nil {
 			return fmt.Errorf("failed to cleanup existing directories: %w", err)
 		}
 	}
 
-	// Clean up existing backup files to prevent orphaned files after restore
-	if err := i.cleanupExistingBackupDirectory(); err != nil {
-		return fmt.Errorf("failed to cleanup existing backup directory: %w", err)
+	// Clean up existing backup files to prevent orphaned files after restore.
+	// A merge keeps them, as the database they describe stays in place.
+	if !options.Merge {
+		if err := i.cleanupExistingBackupDirectory(); err != nil {
+			return fmt.Errorf("failed to cleanup existing backup directory: %w", err)
+		}
 	}
 
 	// Import documents
@@ -580,6 +808,16 @@ func getModelForTable(tableName string) interface{} {
 		return &database.LoginAttempt{}
 	case "user_folders_cache":
 		return &database.FolderCache{}
+	case "cloud_drive_tokens":
+		return &database.CloudDriveToken{}
+	case "send_targets":
+		return &database.SendTarget{}
+	case "folder_mirrors":
+		return &database.FolderMirror{}
+	case "subscriptions":
+		return &database.Subscription{}
+	case "mailboxes":
+		return &database.Mailbox{}
 	default:
 		return nil
 	}
@@ -615,6 +853,21 @@ func filterRecordsByUserID(records []map[string]interface{}, userIDs []uuid.UUID
 	return filtered
 }
 
+// filterRecordsByID keeps the records whose own ID is in ids
+func filterRecordsByID(records []map[string]interface{}, ids []uuid.UUID) []map[string]interface{} {
+	keep := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		keep[id.String()] = true
+	}
+	var filtered []map[string]interface{}
+	for _, record := range records {
+		if idStr, ok := record["id"].(string); ok && keep[idStr] {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
 func readJSON(filename string, v interface{}) error {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -661,6 +914,10 @@ func mapUserRecord(data map[string]interface{}, user *database.User) error {
 	// CRITICAL: Handle password hash directly to avoid corruption
 	if password, ok := data["password"].(string); ok {
 		user.Password = password // Direct assignment preserves exact hash
+		// Older exports store OIDC users with a hash of the empty password
+		if database.IsEmptyPasswordHash(password) {
+			user.Password = ""
+		}
 	}
 
 	// Handle boolean fields
@@ -691,12 +948,60 @@ func mapUserRecord(data map[string]interface{}, user *database.User) error {
 	if rmapiConfig, ok := data["rmapi_config"].(string); ok {
 		user.RmapiConfig = rmapiConfig
 	}
+	if v, ok := data["inbound_email_token"].(string); ok && v != "" {
+		user.InboundEmailToken = &v
+	}
+	if v, ok := data["delivery_window_start"].(string); ok {
+		user.DeliveryWindowStart = v
+	}
+	if v, ok := data["delivery_window_end"].(string); ok {
+		user.DeliveryWindowEnd = v
+	}
+	if v, ok := data["delivery_timezone"].(string); ok {
+		user.DeliveryTimezone = v
+	}
+	if deliveryMethod, ok := data["delivery_method"].(string); ok {
+		user.DeliveryMethod = deliveryMethod
+	}
+	if deliveryHost, ok := data["delivery_host"].(string); ok {
+		user.DeliveryHost = deliveryHost
+	}
+	if deliverySSHUser, ok := data["delivery_ssh_user"].(string); ok {
+		user.DeliverySSHUser = deliverySSHUser
+	}
+	if deliverySSHKey, ok := data["delivery_ssh_key"].(string); ok {
+		user.DeliverySSHKey = deliverySSHKey
+	}
+	if deliverySSHHostKey, ok := data["delivery_ssh_host_key"].(string); ok {
+		user.DeliverySSHHostKey = deliverySSHHostKey
+	}
 	// Skip verification_token field (removed from model)
 
 	// Handle integer fields
 	if folderRefreshPercent, ok := data["folder_refresh_percent"].(float64); ok {
 		user.FolderRefreshPercent = int(folderRefreshPercent)
 	}
+	if uploadTimeout, ok := data["upload_timeout"].(float64); ok {
+		user.UploadTimeout = int(uploadTimeout)
+	}
+	if jobTimeout, ok := data["job_timeout"].(float64); ok {
+		user.JobTimeout = int(jobTimeout)
+	}
+	if storageQuotaMB, ok := data["storage_quota_mb"].(float64); ok {
+		user.StorageQuotaMB = int(storageQuotaMB)
+	}
+	if uploadQuota, ok := data["upload_quota"].(float64); ok {
+		user.UploadQuota = int(uploadQuota)
+	}
+	if maxUploadMB, ok := data["max_upload_mb"].(float64); ok {
+		user.MaxUploadMB = int(maxUploadMB)
+	}
+	if blocked, ok := data["blocked_content_types"].(string); ok {
+		user.BlockedContentTypes = blocked
+	}
+	if language, ok := data["language"].(string); ok {
+		user.Language = language
+	}
 
 	// Handle time fields
 	if createdAtStr, ok := data["created_at"].(string); ok {
@@ -719,6 +1024,11 @@ func mapUserRecord(data map[string]interface{}, user *database.User) error {
 			user.ResetTokenExpires = resetExpires
 		}
 	}
+	if revokedStr, ok := data["sessions_revoked_at"].(string); ok && revokedStr != "" {
+		if revoked, err := time.Parse(time.RFC3339, revokedStr); err == nil {
+			user.SessionsRevokedAt = &revoked
+		}
+	}
 
 	logging.Logf("[RESTORE] Mapped user %s", user.Username)
 	return nil
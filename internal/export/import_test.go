@@ -0,0 +1,178 @@
+package export
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+)
+
+// setupImport creates a SQLite database with one user and document and
+// exports it as JSON to the returned directory
+func setupImport(t *testing.T) (*database.User, string) {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", dataDir)
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	user, err := database.NewUserService(database.DB).CreateUser("restorer", "restorer@example.com", "correct-horse", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addDocument(t, user, "Backed up")
+
+	dbDir := t.TempDir()
+	if err := NewExporter(database.DB, dataDir).exportDatabase(dbDir, &ExportMetadata{}, ExportOptions{IncludeDatabase: true}); err != nil {
+		t.Fatal(err)
+	}
+	return user, dbDir
+}
+
+func addDocument(t *testing.T, user *database.User, name string) {
+	t.Helper()
+	doc := database.Document{ID: uuid.New(), UserID: user.ID, DocumentName: name}
+	if err := database.DB.Create(&doc).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// duplicateFirstRecord makes table's import fail partway, on the second
+// insert of its first record's primary key
+func duplicateFirstRecord(t *testing.T, dbDir, table string) {
+	t.Helper()
+	path := filepath.Join(dbDir, table+".json")
+	var records []map[string]interface{}
+	if err := readJSON(path, &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatalf("%s has no records", table)
+	}
+	if err := writeJSON(path, append(records, records[0])); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func documentNames(t *testing.T) []string {
+	t.Helper()
+	var names []string
+	if err := database.DB.Model(&database.Document{}).Order("document_name").Pluck("document_name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func resultsByTable(results []TableImportResult) map[string]TableImportResult {
+	byTable := make(map[string]TableImportResult, len(results))
+	for _, r := range results {
+		byTable[r.Table] = r
+	}
+	return byTable
+}
+
+func TestImportDatabase(t *testing.T) {
+	_, dbDir := setupImport(t)
+	importer := NewImporter(database.DB, t.TempDir())
+	if err := importer.importDatabase(dbDir, ImportOptions{OverwriteDatabase: true}); err != nil {
+		t.Fatal(err)
+	}
+	results := resultsByTable(importer.TableResults())
+	if r := results["users"]; !r.Success || r.Records != 1 || r.Error != "" {
+		t.Errorf("users result = %+v, want 1 record imported", r)
+	}
+	if r := results["documents"]; !r.Success || r.Records != 1 {
+		t.Errorf("documents result = %+v, want 1 record imported", r)
+	}
+	for _, r := range importer.TableResults() {
+		if !r.Success || r.Skipped {
+			t.Errorf("%s result = %+v, want success", r.Table, r)
+		}
+	}
+}
+
+// checkKept checks that the previous user and both of their documents are
+// still there after a failed import
+func checkKept(t *testing.T, user *database.User) {
+	t.Helper()
+	var users []database.User
+	if err := database.DB.Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("users = %+v, want the previous user kept", users)
+	}
+	if names := documentNames(t); len(names) != 2 || names[0] != "Added after the backup" || names[1] != "Backed up" {
+		t.Errorf("documents = %v, want both previous documents kept", names)
+	}
+}
+
+func TestImportDatabaseRollsBackFailedTable(t *testing.T) {
+	user, dbDir := setupImport(t)
+	addDocument(t, user, "Added after the backup")
+	duplicateFirstRecord(t, dbDir, "documents")
+
+	importer := NewImporter(database.DB, t.TempDir())
+	err := importer.importDatabase(dbDir, ImportOptions{OverwriteDatabase: true})
+	if err == nil || !strings.Contains(err.Error(), "documents") {
+		t.Fatalf("importDatabase = %v, want documents reported as failed", err)
+	}
+
+	// The failed table keeps the rows it had before the import, which means
+	// keeping the users they belong to as well
+	checkKept(t, user)
+	results := resultsByTable(importer.TableResults())
+	if r := results["documents"]; r.Success || r.Skipped || r.Records != 0 || !strings.Contains(r.Error, "UNIQUE") {
+		t.Errorf("documents result = %+v, want the failure with its error", r)
+	}
+	for _, table := range []string{"users", "api_keys", "mailboxes"} {
+		if r := results[table]; r.Success || !r.Skipped || r.Records != 0 || !strings.Contains(r.Error, "documents failed") {
+			t.Errorf("%s result = %+v, want it kept because documents failed", table, r)
+		}
+	}
+	// Tables that don't belong to users are still restored
+	if r := results["system_settings"]; !r.Success || r.Records == 0 {
+		t.Errorf("system_settings result = %+v, want it imported", r)
+	}
+}
+
+func TestImportDatabaseKeepsUserTablesWhenUsersFail(t *testing.T) {
+	user, dbDir := setupImport(t)
+	addDocument(t, user, "Added after the backup")
+	duplicateFirstRecord(t, dbDir, "users")
+
+	importer := NewImporter(database.DB, t.TempDir())
+	err := importer.importDatabase(dbDir, ImportOptions{OverwriteDatabase: true})
+	if err == nil || !strings.Contains(err.Error(), "users") || !strings.Contains(err.Error(), "documents") {
+		t.Fatalf("importDatabase = %v, want users and its dependents reported", err)
+	}
+	checkKept(t, user)
+
+	results := importer.TableResults()
+	if len(results) == 0 || results[0].Table != "users" || results[0].Success || results[0].Skipped || results[0].Error == "" {
+		t.Fatalf("results = %+v, want users first, failed", results)
+	}
+	byTable := resultsByTable(results)
+	for _, table := range []string{"api_keys", "user_sessions", "documents", "folder_mirrors", "subscriptions"} {
+		if r, ok := byTable[table]; !ok || r.Success || !r.Skipped || !strings.Contains(r.Error, "users failed") {
+			t.Errorf("%s result = %+v, want skipped because users failed", table, r)
+		}
+	}
+	for _, table := range []string{"system_settings", "login_attempts"} {
+		if r, ok := byTable[table]; !ok || !r.Success || r.Skipped {
+			t.Errorf("%s result = %+v, want success", table, r)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	// DatabaseFormatJSON exports each table as a JSON file (default, works for every database)
+	DatabaseFormatJSON = "json"
+	// DatabaseFormatSQL exports the database as a plain SQL dump via pg_dump (PostgreSQL only)
+	DatabaseFormatSQL = "sql"
+
+	sqlDumpFilename = "aviary.sql"
+)
+
+// ExecCommand is exec.Command by default, but can be overridden in tests.
+var ExecCommand = exec.Command
+
+// LookPath is exec.LookPath by default, but can be overridden in tests.
+var LookPath = exec.LookPath
+
+// CheckPostgresClient returns an error naming binary, pg_dump or psql, when
+// it isn't installed, so SQL dump backups and restores fail before they
+// start instead of partway through
+func CheckPostgresClient(binary string) error {
+	if _, err := LookPath(binary); err != nil {
+		return fmt.Errorf("%s not found: SQL dump backups need the PostgreSQL client tools (e.g. the postgresql-client package) on the PATH", binary)
+	}
+	return nil
+}
+
+// IsValidDatabaseFormat reports whether format is a supported export format
+func IsValidDatabaseFormat(format string) bool {
+	return format == "" || format == DatabaseFormatJSON || format == DatabaseFormatSQL
+}
+
+// postgresEnv returns the environment for pg_dump/psql so credentials never appear in argv
+func postgresEnv(cfg *database.DatabaseConfig) []string {
+	return append(os.Environ(),
+		"PGHOST="+cfg.Host,
+		"PGPORT="+strconv.Itoa(cfg.Port),
+		"PGUSER="+cfg.User,
+		"PGPASSWORD="+cfg.Password,
+		"PGDATABASE="+cfg.DBName,
+		"PGSSLMODE="+cfg.SSLMode,
+	)
+}
+
+// dumpPostgres writes a plain SQL dump of the current PostgreSQL database into dbDir
+func dumpPostgres(dbDir string) error {
+	cfg := database.GetDatabaseConfig()
+	if cfg.Type != "postgres" {
+		return fmt.Errorf("SQL dump export requires PostgreSQL (current database: %s)", cfg.Type)
+	}
+
+	if err := CheckPostgresClient("pg_dump"); err != nil {
+		return err
+	}
+
+	cmd := ExecCommand("pg_dump", pgDumpArgs(filepath.Join(dbDir, sqlDumpFilename))...)
+	cmd.Env = postgresEnv(cfg)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	logging.Logf("[EXPORT] Created SQL dump of database %s", cfg.DBName)
+	return nil
+}
+
+// restorePostgres replays a plain SQL dump into the current PostgreSQL database
+// in a single transaction, so a failing statement leaves the database untouched
+func restorePostgres(dumpFile string) error {
+	cfg := database.GetDatabaseConfig()
+	if cfg.Type != "postgres" {
+		return fmt.Errorf("SQL dump backups can only be restored into PostgreSQL (current database: %s)", cfg.Type)
+	}
+
+	if err := CheckPostgresClient("psql"); err != nil {
+		return err
+	}
+
+	cmd := ExecCommand("psql", psqlArgs(dumpFile)...)
+	cmd.Env = postgresEnv(cfg)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("psql restore failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	logging.Logf("[RESTORE] Restored SQL dump into database %s", cfg.DBName)
+	return nil
+}
+
+// pgDumpArgs returns the pg_dump arguments writing a plain SQL dump to
+// outputFile that drops and recreates each object, so it restores over an
+// existing database
+func pgDumpArgs(outputFile string) []string {
+	return []string{
+		"--format=plain",
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--no-privileges",
+		"--file=" + outputFile,
+	}
+}
+
+// psqlArgs returns the psql arguments replaying dumpFile in one transaction
+// that stops at the first error
+func psqlArgs(dumpFile string) []string {
+	return []string{
+		"--quiet",
+		"--no-psqlrc",
+		"--single-transaction",
+		"--set=ON_ERROR_STOP=1",
+		"--file=" + dumpFile,
+	}
+}
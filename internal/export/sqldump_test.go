@@ -0,0 +1,134 @@
+package export
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordedCommand is a pg_dump or psql run
+type recordedCommand struct {
+	name string
+	args []string
+	cmd  *exec.Cmd
+}
+
+// stubPostgresClient makes the PostgreSQL client tools in installed look
+// present and records the commands run instead of running them
+func stubPostgresClient(t *testing.T, installed ...string) *[]recordedCommand {
+	t.Helper()
+	t.Setenv("DB_TYPE", "postgres")
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_PORT", "5433")
+	t.Setenv("DB_USER", "aviary")
+	t.Setenv("DB_PASSWORD", "s3cret")
+	t.Setenv("DB_NAME", "aviary")
+	t.Setenv("DB_SSLMODE", "require")
+	var cmds []recordedCommand
+	origExec, origLook := ExecCommand, LookPath
+	ExecCommand = func(name string, args ...string) *exec.Cmd {
+		cmd := exec.Command("true")
+		cmds = append(cmds, recordedCommand{name: name, args: args, cmd: cmd})
+		return cmd
+	}
+	LookPath = func(file string) (string, error) {
+		for _, name := range installed {
+			if name == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+	t.Cleanup(func() { ExecCommand, LookPath = origExec, origLook })
+	return &cmds
+}
+
+func TestPgDumpArgs(t *testing.T) {
+	want := []string{"--format=plain", "--clean", "--if-exists", "--no-owner", "--no-privileges", "--file=/tmp/db/aviary.sql"}
+	if got := pgDumpArgs("/tmp/db/aviary.sql"); !reflect.DeepEqual(got, want) {
+		t.Errorf("pgDumpArgs = %q, want %q", got, want)
+	}
+}
+
+func TestPsqlArgs(t *testing.T) {
+	want := []string{"--quiet", "--no-psqlrc", "--single-transaction", "--set=ON_ERROR_STOP=1", "--file=/tmp/db/aviary.sql"}
+	if got := psqlArgs("/tmp/db/aviary.sql"); !reflect.DeepEqual(got, want) {
+		t.Errorf("psqlArgs = %q, want %q", got, want)
+	}
+}
+
+func TestPostgresCommands(t *testing.T) {
+	cmds := stubPostgresClient(t, "pg_dump", "psql")
+	dir := t.TempDir()
+	if err := dumpPostgres(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := restorePostgres(filepath.Join(dir, sqlDumpFilename)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*cmds) != 2 || (*cmds)[0].name != "pg_dump" || (*cmds)[1].name != "psql" {
+		t.Fatalf("ran %+v, want pg_dump then psql", *cmds)
+	}
+	if want := pgDumpArgs(filepath.Join(dir, sqlDumpFilename)); !reflect.DeepEqual((*cmds)[0].args, want) {
+		t.Errorf("pg_dump args = %q, want %q", (*cmds)[0].args, want)
+	}
+	if want := psqlArgs(filepath.Join(dir, sqlDumpFilename)); !reflect.DeepEqual((*cmds)[1].args, want) {
+		t.Errorf("psql args = %q, want %q", (*cmds)[1].args, want)
+	}
+
+	want := []string{"PGHOST=db", "PGPORT=5433", "PGUSER=aviary", "PGPASSWORD=s3cret", "PGDATABASE=aviary", "PGSSLMODE=require"}
+	for _, c := range *cmds {
+		if strings.Contains(strings.Join(c.args, " "), "s3cret") {
+			t.Errorf("%s arguments contain the password: %q", c.name, c.args)
+		}
+		env := c.cmd.Env
+		if len(env) < len(want) {
+			t.Fatalf("%s environment = %q, want it to end with %q", c.name, env, want)
+		}
+		if got := env[len(env)-len(want):]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s environment ends with %q, want %q", c.name, got, want)
+		}
+	}
+}
+
+func TestMissingPostgresClient(t *testing.T) {
+	cmds := stubPostgresClient(t)
+	dir := t.TempDir()
+
+	err := dumpPostgres(dir)
+	if err == nil || !strings.Contains(err.Error(), "pg_dump not found") {
+		t.Errorf("dumpPostgres without pg_dump = %v, want it named", err)
+	}
+	err = restorePostgres(filepath.Join(dir, sqlDumpFilename))
+	if err == nil || !strings.Contains(err.Error(), "psql not found") {
+		t.Errorf("restorePostgres without psql = %v, want it named", err)
+	}
+	if len(*cmds) != 0 {
+		t.Errorf("ran %+v without the client tools", *cmds)
+	}
+
+	// A restore reports the missing psql and leaves the database alone
+	dumpFile := filepath.Join(dir, sqlDumpFilename)
+	if err := os.WriteFile(dumpFile, []byte("DROP TABLE users;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	importer := &Importer{}
+	err = importer.importDatabase(dir, ImportOptions{OverwriteDatabase: true})
+	if err == nil || !strings.Contains(err.Error(), "psql not found") {
+		t.Errorf("importDatabase = %v, want psql named", err)
+	}
+	results := importer.TableResults()
+	if len(results) != 1 || results[0].Success || !strings.Contains(results[0].Error, "psql not found") {
+		t.Errorf("results = %+v, want the dump reported as failed", results)
+	}
+
+	// So does the analysis of an SQL dump backup
+	analysis := &BackupAnalysis{DatabaseFormat: DatabaseFormatSQL, Valid: true}
+	checkDatabaseFormat(analysis)
+	if analysis.Valid || len(analysis.Errors) != 1 || !strings.Contains(analysis.Errors[0], "psql not found") {
+		t.Errorf("analysis = %+v, want psql reported", analysis)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/rmitchellscott/aviary/internal/auth"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/demo"
 	"github.com/rmitchellscott/aviary/internal/manager"
 	"github.com/rmitchellscott/aviary/internal/rmapi"
 	"github.com/rmitchellscott/aviary/internal/smtp"
@@ -74,8 +76,9 @@ func ConfigHandler(c *gin.Context) {
 		// In multi-user mode, pairing status is per-user and handled by /api/auth/check
 		// We don't include it here as it requires user context
 	} else {
-		// In single-user mode, check the global rmapi.conf file
-		rmapiPaired = rmapi.IsUserPaired(uuid.Nil)
+		// In single-user mode, check the global rmapi.conf file; a tablet
+		// reached over USB or SSH needs no pairing
+		rmapiPaired = rmapi.IsUserPaired(uuid.Nil) || delivery.ForUser(nil).Offline()
 	}
 
 	// Check authentication methods (multi-user mode only)
@@ -108,10 +111,20 @@ func ConfigHandler(c *gin.Context) {
 		"experimentalDownloadLink":  config.GetBool("EXPERIMENTAL_DOWNLOAD_LINK", false),
 	}
 
+	// Let the login page show the demo account's credentials
+	if demo.Enabled() {
+		response["demoMode"] = true
+		if multiUserMode {
+			response["demoUsername"] = demo.Username
+			response["demoPassword"] = demo.Password()
+		}
+	}
+
 	// Add single-user mode specific settings
 	if !multiUserMode {
 		response["rmapi_paired"] = rmapiPaired
 		response["pdf_background_removal"] = config.GetBool("PDF_BACKGROUND_REMOVAL", false)
+		response["extract_content"] = config.GetBool("EXTRACT_CONTENT", true)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/version"
+)
+
+// VersionHandler returns build information. Admins (and everyone in
+// single-user mode) also get the result of the release check when
+// UPDATE_CHECK is enabled.
+func VersionHandler(c *gin.Context) {
+	info := version.Get()
+	update := version.UpdateCheck()
+	if !update.Enabled || (database.IsMultiUserMode() && !auth.IsCurrentUserAdmin(c)) {
+		c.JSON(http.StatusOK, info)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"version":    info.Version,
+		"git_commit": info.GitCommit,
+		"build_date": info.BuildDate,
+		"go_version": info.GoVersion,
+		"update":     update,
+	})
+}
@@ -0,0 +1,118 @@
+// Package health serves the liveness and readiness endpoints container
+// orchestrators probe, so they don't have to load the UI to tell whether
+// Aviary is up.
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// checkTimeout bounds each readiness check
+const checkTimeout = 5 * time.Second
+
+// Check is the result of one readiness check
+type Check struct {
+	Healthy   bool   `json:"healthy"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// errSkipped marks a check that doesn't apply to this instance
+var errSkipped = errors.New("skipped")
+
+// checks are the subsystems Aviary can't serve requests without
+var checks = map[string]func(ctx context.Context) error{
+	"database": checkDatabase,
+	"storage":  checkStorage,
+	"rmapi":    checkRmapi,
+}
+
+// checkDatabase pings the database, which only multi-user mode uses
+func checkDatabase(ctx context.Context) error {
+	if !database.IsMultiUserMode() {
+		return errSkipped
+	}
+	if database.DB == nil {
+		return errors.New("database not initialized")
+	}
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkStorage looks up an object in the storage backend, which reaches the
+// bucket for S3 and the directory for the filesystem backend
+func checkStorage(ctx context.Context) error {
+	_, err := storage.GetStorageBackend().Exists(ctx, ".aviary-healthcheck")
+	return err
+}
+
+// checkRmapi makes sure the rmapi binary every upload runs is installed
+func checkRmapi(context.Context) error {
+	_, err := exec.LookPath("rmapi")
+	return err
+}
+
+// LivenessHandler reports that the process is up and serving requests
+func LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadinessHandler runs every check and responds 200 when they all pass and
+// 503 otherwise, with the result of each
+func ReadinessHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+	defer cancel()
+
+	results, ready := runChecks(ctx)
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// runChecks runs every check concurrently and reports whether they all passed
+func runChecks(ctx context.Context) (map[string]Check, bool) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]Check, len(checks))
+	for name, fn := range checks {
+		wg.Add(1)
+		go func(name string, fn func(context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			err := fn(ctx)
+			result := Check{Healthy: err == nil, LatencyMS: time.Since(start).Milliseconds()}
+			switch {
+			case errors.Is(err, errSkipped):
+				result.Healthy, result.Skipped = true, true
+			case err != nil:
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, fn)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if !r.Healthy {
+			return results, false
+		}
+	}
+	return results, true
+}
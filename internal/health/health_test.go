@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+)
+
+// withChecks replaces the readiness checks for the rest of the test
+func withChecks(t *testing.T, replacement map[string]func(context.Context) error) {
+	t.Helper()
+	orig := checks
+	checks = replacement
+	t.Cleanup(func() { checks = orig })
+}
+
+// probe serves path the way main.go routes the probes
+func probe(t *testing.T, path string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apierror.Middleware())
+	r.GET(path, apierror.Raw(), handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestReadinessHandler(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	tests := []struct {
+		name   string
+		checks map[string]func(context.Context) error
+		code   int
+		status string
+	}{
+		{"all pass", map[string]func(context.Context) error{"database": ok, "storage": ok}, http.StatusOK, "ready"},
+		{"skipped counts as healthy", map[string]func(context.Context) error{
+			"database": func(context.Context) error { return errSkipped },
+			"storage":  ok,
+		}, http.StatusOK, "ready"},
+		{"one fails", map[string]func(context.Context) error{
+			"database": ok,
+			"storage":  func(context.Context) error { return errors.New("bucket unreachable") },
+		}, http.StatusServiceUnavailable, "not_ready"},
+	}
+	for _, tt := range tests {
+		withChecks(t, tt.checks)
+		w := probe(t, "/readyz", ReadinessHandler)
+		if w.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.code)
+		}
+
+		// Monitors read status and checks at the top level, even on a 503
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: body %s: %v", tt.name, w.Body, err)
+		}
+		if len(body) != 2 || string(body["status"]) != `"`+tt.status+`"` {
+			t.Errorf("%s: body = %s, want only status %q and checks", tt.name, w.Body, tt.status)
+		}
+		var results map[string]Check
+		if err := json.Unmarshal(body["checks"], &results); err != nil || len(results) != len(tt.checks) {
+			t.Errorf("%s: checks = %s, %v", tt.name, body["checks"], err)
+		}
+		if tt.code != http.StatusOK && results["storage"].Error != "bucket unreachable" {
+			t.Errorf("%s: storage check = %+v, want its error", tt.name, results["storage"])
+		}
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	w := probe(t, "/healthz", LivenessHandler)
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"ok"}` {
+		t.Errorf("liveness = %d %s", w.Code, w.Body)
+	}
+}
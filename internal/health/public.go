@@ -0,0 +1,192 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/degraded"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/version"
+	"golang.org/x/time/rate"
+)
+
+// PublicFieldsSettingKey is the system setting listing what the public status
+// endpoint shows
+const PublicFieldsSettingKey = "public_status_fields"
+
+// PublicFields are the fields the public status endpoint can show
+var PublicFields = []string{"health", "version", "registration"}
+
+// publicStatusTTL is how long the health shown publicly is reused, so
+// monitors polling it don't each run the checks
+const publicStatusTTL = 15 * time.Second
+
+// publicLimiterTTL is how long a client's limiter is kept after its last
+// request. A full bucket refills well within it, so a client coming back
+// later starts where it would have anyway.
+const publicLimiterTTL = 10 * time.Minute
+
+// publicLimiter is one client's limiter and when it was last used
+type publicLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+var (
+	publicLimitersMu   sync.Mutex
+	publicLimiters     = make(map[string]*publicLimiter)
+	publicLimiterSwept time.Time
+	publicRate         = rate.Every(time.Minute / 30) // 30 requests per minute
+)
+
+var (
+	publicHealthMu      sync.Mutex
+	publicHealth        string
+	publicHealthChecked time.Time
+)
+
+// getPublicLimiter returns ip's limiter. The endpoint is unauthenticated, so
+// limiters idle for publicLimiterTTL are dropped to keep the map from growing
+// with every client that ever called it.
+func getPublicLimiter(ip string) *rate.Limiter {
+	publicLimitersMu.Lock()
+	defer publicLimitersMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(publicLimiterSwept) >= publicLimiterTTL {
+		for key, l := range publicLimiters {
+			if now.Sub(l.lastSeen) >= publicLimiterTTL {
+				delete(publicLimiters, key)
+			}
+		}
+		publicLimiterSwept = now
+	}
+
+	l, ok := publicLimiters[ip]
+	if !ok {
+		l = &publicLimiter{limiter: rate.NewLimiter(publicRate, 10)}
+		publicLimiters[ip] = l
+	}
+	l.lastSeen = now
+	return l.limiter
+}
+
+// ParsePublicFields returns the fields in a comma-separated list, or false if
+// it names one that doesn't exist. "none" is an empty list.
+func ParsePublicFields(value string) ([]string, bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "none") {
+		return nil, true
+	}
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		known := false
+		for _, f := range PublicFields {
+			known = known || f == field
+		}
+		if !known {
+			return nil, false
+		}
+		fields = append(fields, field)
+	}
+	return fields, true
+}
+
+// publicFields returns the fields the public status endpoint shows: the
+// public_status_fields setting in multi-user mode, otherwise
+// PUBLIC_STATUS_FIELDS, defaulting to all of them
+func publicFields() []string {
+	value := config.Get("PUBLIC_STATUS_FIELDS", "")
+	if database.IsMultiUserMode() {
+		if stored, err := database.GetSystemSetting(PublicFieldsSettingKey); err == nil && stored != "" {
+			value = stored
+		}
+	}
+	if value == "" {
+		return PublicFields
+	}
+	fields, ok := ParsePublicFields(value)
+	if !ok {
+		return PublicFields
+	}
+	return fields
+}
+
+// healthStatus sums the instance's health up in one word: "down" when a
+// readiness check fails, "maintenance" while jobs aren't accepted,
+// "degraded" while a dependency is failing, otherwise "ok"
+func healthStatus(ctx context.Context) string {
+	publicHealthMu.Lock()
+	defer publicHealthMu.Unlock()
+	if time.Since(publicHealthChecked) < publicStatusTTL {
+		return publicHealth
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	_, ready := runChecks(ctx)
+	maintenanceOn, _ := maintenance.Status()
+	switch {
+	case !ready:
+		publicHealth = "down"
+	case maintenanceOn:
+		publicHealth = "maintenance"
+	case degraded.Active():
+		publicHealth = "degraded"
+	default:
+		publicHealth = "ok"
+	}
+	publicHealthChecked = time.Now()
+	return publicHealth
+}
+
+// PublicStatusHandler shows the instance's health, version and whether
+// registration is open to anyone, without authentication, for uptime
+// monitors and users checking before they sign in. It's a 503 while the
+// instance is down. Admins choose which of these are shown; the endpoint is
+// a 404 when none are.
+func PublicStatusHandler(c *gin.Context) {
+	if !getPublicLimiter(c.ClientIP()).Allow() {
+		apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeTooManyRequests, "")
+		return
+	}
+
+	fields := publicFields()
+	if len(fields) == 0 {
+		apierror.Respond(c, http.StatusNotFound, "", "")
+		return
+	}
+
+	resp, code := gin.H{}, http.StatusOK
+	for _, field := range fields {
+		switch field {
+		case "health":
+			resp["status"] = healthStatus(c.Request.Context())
+			if resp["status"] == "down" {
+				code = http.StatusServiceUnavailable
+			}
+		case "version":
+			resp["version"] = version.Version
+		case "registration":
+			open := false
+			if database.IsMultiUserMode() {
+				enabled, err := database.GetSystemSetting("registration_enabled")
+				open = err == nil && enabled == "true"
+			}
+			resp["registration_open"] = open
+		}
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(code, resp)
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/version"
+)
+
+func TestPublicStatusDown(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	t.Setenv("PUBLIC_STATUS_FIELDS", "health,version")
+	withChecks(t, map[string]func(context.Context) error{
+		"storage": func(context.Context) error { return errors.New("bucket unreachable") },
+	})
+	publicHealthMu.Lock()
+	publicHealthChecked = time.Time{}
+	publicHealthMu.Unlock()
+
+	w := probe(t, "/api/status/public", PublicStatusHandler)
+	want := `{"status":"down","version":"` + version.Version + `"}`
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != want {
+		t.Errorf("public status = %d %s, want 503 %s", w.Code, w.Body, want)
+	}
+}
+
+func TestPublicLimitersEvicted(t *testing.T) {
+	publicLimitersMu.Lock()
+	publicLimiters = map[string]*publicLimiter{
+		"192.0.2.1": {limiter: nil, lastSeen: time.Now().Add(-2 * publicLimiterTTL)},
+		"192.0.2.2": {limiter: nil, lastSeen: time.Now()},
+	}
+	publicLimiterSwept = time.Now().Add(-2 * publicLimiterTTL)
+	publicLimitersMu.Unlock()
+
+	if getPublicLimiter("192.0.2.3") == nil {
+		t.Fatal("no limiter for a new client")
+	}
+	publicLimitersMu.Lock()
+	defer publicLimitersMu.Unlock()
+	if _, ok := publicLimiters["192.0.2.1"]; ok {
+		t.Error("idle client's limiter was kept")
+	}
+	if _, ok := publicLimiters["192.0.2.2"]; !ok {
+		t.Error("recent client's limiter was dropped")
+	}
+	if len(publicLimiters) != 2 {
+		t.Errorf("%d limiters, want 2", len(publicLimiters))
+	}
+}
@@ -0,0 +1,174 @@
+// Package hooks runs admin-configured commands around document uploads so
+// custom processing (watermarking, OCR, notifications) can be added without
+// changing the pipeline.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	// StagePreUpload runs after conversion and compression, before the upload.
+	// The hook may modify the file at AVIARY_FILE in place.
+	StagePreUpload = "pre_upload"
+	// StagePostUpload runs after the document is on the reMarkable
+	StagePostUpload = "post_upload"
+
+	// PolicyAbort fails the job when a pre-upload hook fails (default)
+	PolicyAbort = "abort"
+	// PolicyContinue logs the failure and uploads anyway
+	PolicyContinue = "continue"
+
+	maxLoggedOutput = 2048
+)
+
+// ExecCommand is exec.CommandContext by default, but can be overridden in tests.
+var ExecCommand = exec.CommandContext
+
+// Event describes the document a hook is run for
+type Event struct {
+	Stage      string
+	JobID      string
+	FilePath   string
+	RmDir      string
+	RemoteName string
+	Username   string
+	UserID     string
+	// Metadata is exported to the hook as AVIARY_META_<KEY> variables
+	Metadata map[string]string
+}
+
+// commandFor returns the configured command for a stage
+func commandFor(stage string) string {
+	switch stage {
+	case StagePreUpload:
+		return config.Get("HOOK_PRE_UPLOAD", "")
+	case StagePostUpload:
+		return config.Get("HOOK_POST_UPLOAD", "")
+	}
+	return ""
+}
+
+// Enabled reports whether a hook command is configured for stage
+func Enabled(stage string) bool {
+	return commandFor(stage) != ""
+}
+
+// FailurePolicy returns HOOK_FAILURE_POLICY, defaulting to abort
+func FailurePolicy() string {
+	if strings.EqualFold(config.Get("HOOK_FAILURE_POLICY", ""), PolicyContinue) {
+		return PolicyContinue
+	}
+	return PolicyAbort
+}
+
+// Run executes the hook for ev.Stage, if one is configured. The command runs
+// through /bin/sh with only PATH, HOME and the event's AVIARY_* variables in
+// its environment, so Aviary's own secrets aren't passed on. It is killed
+// after HOOK_TIMEOUT or when ctx, the job's context, is done. A non-nil error
+// means the hook failed; callers decide what that means for the job using
+// FailurePolicy.
+func Run(ctx context.Context, ev Event) error {
+	command := commandFor(ev.Stage)
+	if command == "" {
+		return nil
+	}
+
+	timeout := config.GetDuration("HOOK_TIMEOUT", 60*time.Second)
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := ExecCommand(hookCtx, "/bin/sh", "-c", command)
+	cmd.Env = append(baseEnv(), eventEnv(ev)...)
+	if ev.FilePath != "" {
+		cmd.Dir = filepath.Dir(ev.FilePath)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait on children of the shell that still hold the output open after a timeout
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		// The job was cancelled or ran out of time
+		err = ctx.Err()
+	case hookCtx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	out := strings.TrimSpace(output.String())
+	if len(out) > maxLoggedOutput {
+		out = out[:maxLoggedOutput] + "…"
+	}
+	if err != nil {
+		logging.LogfWithUser(ev.Username, "[HOOKS] %s hook failed for job %s: %v: %s", ev.Stage, ev.JobID, err, out)
+		return fmt.Errorf("%s hook failed: %w", ev.Stage, err)
+	}
+	if out != "" {
+		logging.LogfWithUser(ev.Username, "[HOOKS] %s hook output: %s", ev.Stage, out)
+	}
+	logging.LogfWithUser(ev.Username, "[HOOKS] %s hook completed for job %s in %s", ev.Stage, ev.JobID, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// baseEnv returns the variables of Aviary's own environment a hook gets
+func baseEnv() []string {
+	var env []string
+	for _, name := range []string{"PATH", "HOME"} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// eventEnv returns the environment variables describing ev
+func eventEnv(ev Event) []string {
+	env := []string{
+		"AVIARY_HOOK_STAGE=" + ev.Stage,
+		"AVIARY_JOB_ID=" + ev.JobID,
+		"AVIARY_FILE=" + ev.FilePath,
+		"AVIARY_FILENAME=" + filepath.Base(ev.FilePath),
+		"AVIARY_RM_DIR=" + ev.RmDir,
+		"AVIARY_REMOTE_NAME=" + ev.RemoteName,
+		"AVIARY_USERNAME=" + ev.Username,
+		"AVIARY_USER_ID=" + ev.UserID,
+	}
+
+	keys := make([]string, 0, len(ev.Metadata))
+	for k := range ev.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, "AVIARY_META_"+envName(k)+"="+ev.Metadata[k])
+	}
+	return env
+}
+
+// envName upper-cases key and replaces anything that isn't a letter or digit with _
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
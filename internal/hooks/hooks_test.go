@@ -0,0 +1,121 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunExportsEventAndAllowsInPlaceEdits(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "doc.pdf")
+	if err := os.WriteFile(file, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("HOOK_PRE_UPLOAD", `printf '%s|%s|%s' "$AVIARY_HOOK_STAGE" "$AVIARY_RM_DIR" "$AVIARY_META_SOURCE_URL" > "$AVIARY_FILE"`)
+	err := Run(context.Background(), Event{
+		Stage:    StagePreUpload,
+		JobID:    "job-1",
+		FilePath: file,
+		RmDir:    "/Books",
+		Metadata: map[string]string{"source_url": "https://example.com/a.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	got, _ := os.ReadFile(file)
+	want := "pre_upload|/Books|https://example.com/a.pdf"
+	if string(got) != want {
+		t.Errorf("file contents = %q, want %q", got, want)
+	}
+}
+
+func TestRunReportsFailureAndTimeout(t *testing.T) {
+	t.Setenv("HOOK_POST_UPLOAD", "exit 3")
+	if err := Run(context.Background(), Event{Stage: StagePostUpload, JobID: "job-2"}); err == nil {
+		t.Error("expected error for non-zero exit")
+	}
+
+	t.Setenv("HOOK_POST_UPLOAD", "sleep 5")
+	t.Setenv("HOOK_TIMEOUT", "100ms")
+	start := time.Now()
+	err := Run(context.Background(), Event{Stage: StagePostUpload, JobID: "job-3"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Error("hook was not killed at the timeout")
+	}
+}
+
+func TestRunStopsWithTheJob(t *testing.T) {
+	t.Setenv("HOOK_POST_UPLOAD", "sleep 5")
+	t.Setenv("HOOK_TIMEOUT", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err := Run(ctx, Event{Stage: StagePostUpload, JobID: "job-4"})
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("expected the cancellation, got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Error("hook was not killed when the job was cancelled")
+	}
+
+	// A job that times out stops its hook too
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = Run(ctx, Event{Stage: StagePostUpload, JobID: "job-5"})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected the job's deadline, got %v", err)
+	}
+}
+
+func TestRunPassesMinimalEnvironment(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env")
+	t.Setenv("HOOK_POST_UPLOAD", "env > "+out)
+	t.Setenv("S3_SECRET_KEY", "hunter2")
+	t.Setenv("HOME", "/home/aviary")
+	if err := Run(context.Background(), Event{Stage: StagePostUpload, JobID: "job-6"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := string(data)
+	for _, want := range []string{"PATH=", "HOME=/home/aviary", "AVIARY_JOB_ID=job-6"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("hook environment is missing %s:\n%s", want, env)
+		}
+	}
+	if strings.Contains(env, "hunter2") {
+		t.Errorf("hook environment leaks S3_SECRET_KEY:\n%s", env)
+	}
+}
+
+func TestRunWithoutCommandIsNoop(t *testing.T) {
+	t.Setenv("HOOK_PRE_UPLOAD", "")
+	if Enabled(StagePreUpload) {
+		t.Fatal("expected hook to be disabled")
+	}
+	if err := Run(context.Background(), Event{Stage: StagePreUpload}); err != nil {
+		t.Errorf("Run returned error: %v", err)
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	t.Setenv("HOOK_FAILURE_POLICY", "")
+	if FailurePolicy() != PolicyAbort {
+		t.Errorf("default policy = %q, want %q", FailurePolicy(), PolicyAbort)
+	}
+	t.Setenv("HOOK_FAILURE_POLICY", "Continue")
+	if FailurePolicy() != PolicyContinue {
+		t.Errorf("policy = %q, want %q", FailurePolicy(), PolicyContinue)
+	}
+}
@@ -0,0 +1,157 @@
+// Package httpcompress gzips responses that compress well, such as API JSON
+// and the UI's scripts and stylesheets, for clients that accept it.
+package httpcompress
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// minSize is the smallest response of a known length worth compressing
+const minSize = 1024
+
+// compressibleTypes are the content types compressed; documents, images and
+// archives are already compressed, and event streams must not be buffered
+var compressibleTypes = map[string]bool{
+	"application/json":          true,
+	"application/javascript":    true,
+	"application/manifest+json": true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+	"text/css":                  true,
+	"text/html":                 true,
+	"text/javascript":           true,
+	"text/plain":                true,
+	"text/xml":                  true,
+}
+
+// Middleware gzips compressible responses when the client accepts gzip. It's
+// on unless RESPONSE_COMPRESSION is false; RESPONSE_COMPRESSION_LEVEL (1-9)
+// trades speed for size.
+func Middleware() gin.HandlerFunc {
+	if !config.GetBool("RESPONSE_COMPRESSION", true) {
+		return func(c *gin.Context) { c.Next() }
+	}
+	level := config.GetInt("RESPONSE_COMPRESSION_LEVEL", gzip.DefaultCompression)
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	pool := sync.Pool{New: func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}}
+
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.Request.Method == http.MethodHead ||
+			c.GetHeader("Range") != "" || c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		w := &writer{ResponseWriter: c.Writer, pool: &pool}
+		c.Writer = w
+		defer w.close()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		q := strings.TrimSpace(params)
+		if v, ok := strings.CutPrefix(q, "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writer decides on the first write whether to compress, once the handler
+// has set the status and headers
+type writer struct {
+	gin.ResponseWriter
+	pool    *sync.Pool
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *writer) start() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.Header()
+	if !shouldCompress(w.Status(), h) {
+		return
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	// The compressed body differs byte for byte, but not in meaning
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	w.gz = w.pool.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func shouldCompress(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent ||
+		status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < minSize {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && compressibleTypes[mediaType]
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.start()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	return w.gz.Write(b)
+}
+
+func (w *writer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *writer) Flush() {
+	w.start()
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close finishes the gzip stream, if one was started
+func (w *writer) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	w.gz.Reset(nil)
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
@@ -0,0 +1,48 @@
+package httpcompress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	body := strings.Repeat(`{"name":"folder"},`, 200)
+	router.GET("/json", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(body)) })
+	router.GET("/pdf", func(c *gin.Context) { c.Data(http.StatusOK, "application/pdf", []byte(body)) })
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/json", "br, gzip;q=0.8")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("JSON not compressed, headers %v", w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(gz); string(got) != body {
+		t.Errorf("decompressed body differs")
+	}
+
+	if w := get("/json", "gzip;q=0"); w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("compressed although gzip was refused")
+	}
+	if w := get("/pdf", "gzip"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Errorf("PDF was compressed")
+	}
+}
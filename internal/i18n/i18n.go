@@ -0,0 +1,148 @@
+// Package i18n translates the server's own messages, such as emails, with
+// the same locale files the UI uses.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// fallback is the language used when a key is missing from another one
+const fallback = "en"
+
+var (
+	mu      sync.RWMutex
+	locales = map[string]map[string]interface{}{}
+)
+
+// Load reads every <language>.json locale file in fsys
+func Load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]map[string]interface{}, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var messages map[string]interface{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		loaded[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+	mu.Lock()
+	locales = loaded
+	mu.Unlock()
+	return nil
+}
+
+// Languages returns the languages there are locale files for
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	langs := make([]string, 0, len(locales))
+	for lang := range locales {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Supported reports whether lang has a locale file of its own
+func Supported(lang string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := locales[lang]
+	return ok
+}
+
+// DefaultLanguage is the instance's language for users who haven't chosen
+// one, from DEFAULT_LANGUAGE (default en)
+func DefaultLanguage() string {
+	if lang := match(config.Get("DEFAULT_LANGUAGE", "")); lang != "" {
+		return lang
+	}
+	return fallback
+}
+
+// Resolve returns the supported language closest to lang, which may be a
+// tag such as "de-AT" or an Accept-Language header, falling back to the
+// instance default
+func Resolve(lang string) string {
+	for _, part := range strings.Split(lang, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if l := match(tag); l != "" {
+			return l
+		}
+	}
+	return DefaultLanguage()
+}
+
+// match finds the locale for tag, first exactly (ignoring case), then by its
+// primary language, so "de-AT" gets "de" and "zh" gets "zh-CN"
+func match(tag string) string {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" {
+		return ""
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	base, _, _ := strings.Cut(tag, "-")
+	var byBase, byRegion string
+	for lang := range locales {
+		langBase, _, _ := strings.Cut(lang, "-")
+		switch {
+		case strings.EqualFold(lang, tag):
+			return lang
+		case strings.EqualFold(lang, base):
+			byBase = lang
+		case strings.EqualFold(langBase, base) && (byRegion == "" || lang < byRegion):
+			byRegion = lang
+		}
+	}
+	if byBase != "" {
+		return byBase
+	}
+	return byRegion
+}
+
+// T returns the message for the dot-separated key in lang, or in English if
+// lang doesn't have it, with {{name}} placeholders replaced from vars. The
+// key itself is returned if no locale has it.
+func T(lang, key string, vars map[string]string) string {
+	msg, ok := lookup(Resolve(lang), key)
+	if !ok {
+		if msg, ok = lookup(fallback, key); !ok {
+			msg = key
+		}
+	}
+	for name, value := range vars {
+		msg = strings.ReplaceAll(msg, "{{"+name+"}}", value)
+	}
+	return msg
+}
+
+func lookup(lang, key string) (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	var node interface{} = locales[lang]
+	for _, part := range strings.Split(key, ".") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		node = m[part]
+	}
+	msg, ok := node.(string)
+	return msg, ok && msg != ""
+}
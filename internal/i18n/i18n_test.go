@@ -0,0 +1,50 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func loadTestLocales(t *testing.T) {
+	t.Helper()
+	err := Load(fstest.MapFS{
+		"en.json":    {Data: []byte(`{"email": {"greeting": "Hello {{username}},", "footer": "Sent by {{site}}"}}`)},
+		"de.json":    {Data: []byte(`{"email": {"greeting": "Hallo {{username}},"}}`)},
+		"zh-CN.json": {Data: []byte(`{"email": {"greeting": "{{username}},您好:"}}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	loadTestLocales(t)
+	tests := map[string]string{
+		"de":                        "de",
+		"de-AT":                     "de",
+		"zh-cn":                     "zh-CN",
+		"zh":                        "zh-CN",
+		"fr-CH, fr;q=0.9, de;q=0.8": "de",
+		"":                          "en",
+		"xx":                        "en",
+	}
+	for lang, want := range tests {
+		if got := Resolve(lang); got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	loadTestLocales(t)
+	if got := T("de", "email.greeting", map[string]string{"username": "ana"}); got != "Hallo ana," {
+		t.Errorf("got %q", got)
+	}
+	// Missing in German, so English
+	if got := T("de", "email.footer", map[string]string{"site": "Aviary"}); got != "Sent by Aviary" {
+		t.Errorf("got %q", got)
+	}
+	if got := T("de", "email.missing", nil); got != "email.missing" {
+		t.Errorf("got %q", got)
+	}
+}
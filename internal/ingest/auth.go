@@ -0,0 +1,56 @@
+package ingest
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// singleUserAuthConfigured reports whether API_KEY or AUTH_USERNAME and
+// AUTH_PASSWORD are set
+func singleUserAuthConfigured() bool {
+	return config.Get("API_KEY", "") != "" ||
+		(config.Get("AUTH_USERNAME", "") != "" && config.Get("AUTH_PASSWORD", "") != "")
+}
+
+// authenticatePassword checks credentials given to the SFTP or IPP servers. In
+// multi-user mode the password may be one of the user's API keys or their
+// account password; in single-user mode it's API_KEY, or AUTH_USERNAME and
+// AUTH_PASSWORD. client names the server in the API key's usage record.
+func authenticatePassword(username, password, host, client string) (uuid.UUID, error) {
+	if !database.IsMultiUserMode() {
+		if envKey := config.Get("API_KEY", ""); envKey != "" && subtle.ConstantTimeCompare([]byte(password), []byte(envKey)) == 1 {
+			return uuid.Nil, nil
+		}
+		envUser, envPass := config.Get("AUTH_USERNAME", ""), config.Get("AUTH_PASSWORD", "")
+		if envUser != "" && envPass != "" &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(envUser)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(envPass)) == 1 {
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, errors.New("invalid credentials")
+	}
+
+	if strings.HasPrefix(password, "aviary_") {
+		apiKeyService := database.NewAPIKeyService(database.DB)
+		user, key, err := apiKeyService.AuthenticateAPIKey(password)
+		if err != nil || !strings.EqualFold(user.Username, username) {
+			return uuid.Nil, errors.New("invalid API key")
+		}
+		if err := apiKeyService.RecordAPIKeyUsage(key.ID, host, client); err != nil {
+			logging.Logf("[WARNING] Failed to record API key usage for %s: %v", key.ID, err)
+		}
+		return user.ID, nil
+	}
+
+	user, err := database.NewUserService(database.DB).AuthenticateUser(username, password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,218 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"strings"
+)
+
+// emailExts are the attachment types ingested from email
+var emailExts = map[string]bool{".pdf": true, ".epub": true, ".png": true, ".jpg": true, ".jpeg": true}
+
+// emailImageExts are only ingested when attached, so logos and pictures
+// embedded in the message body are left alone
+var emailImageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true}
+
+// maxEmailParts caps how many MIME parts of one message are looked at
+const maxEmailParts = 100
+
+// emailAttachment is a file attached to an email
+type emailAttachment struct {
+	Filename string
+	Data     []byte
+}
+
+// email is the part of a message mail ingestion uses
+type email struct {
+	From        string // Sender address, lowercased
+	Subject     string
+	Recipients  []string // To, Cc and delivery headers, lowercased
+	Attachments []emailAttachment
+}
+
+var headerDecoder = mime.WordDecoder{}
+
+// parseEmail reads a raw RFC 5322 message and returns its sender, subject
+// and the PDF, EPUB and image attachments in it
+func parseEmail(raw []byte) (*email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From header: %w", err)
+	}
+	subject, err := headerDecoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	e := &email{From: strings.ToLower(from.Address), Subject: subject, Recipients: recipients(msg.Header)}
+	parts := 0
+	err = walkParts(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Disposition"),
+		msg.Header.Get("Content-Transfer-Encoding"), msg.Body, &parts, e)
+	return e, err
+}
+
+// recipients returns the addresses a message was sent to. Delivery headers
+// added by the receiving server are included, as Bcc recipients and
+// forwarded mail don't appear in To or Cc.
+func recipients(h mail.Header) []string {
+	var addrs []string
+	for _, key := range []string{"Delivered-To", "X-Original-To", "Envelope-To", "To", "Cc"} {
+		for _, value := range h[key] {
+			list, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, a := range list {
+				addrs = append(addrs, strings.ToLower(a.Address))
+			}
+		}
+	}
+	return addrs
+}
+
+// walkParts collects the attachments in one MIME part, descending into
+// multipart containers and forwarded messages
+func walkParts(contentType, disposition, encoding string, body io.Reader, parts *int, e *email) error {
+	if *parts++; *parts > maxEmailParts {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkParts(p.Header.Get("Content-Type"), p.Header.Get("Content-Disposition"),
+				p.Header.Get("Content-Transfer-Encoding"), p, parts, e); err != nil {
+				return err
+			}
+		}
+	}
+	if mediaType == "message/rfc822" {
+		msg, err := mail.ReadMessage(decodeTransfer(body, encoding))
+		if err != nil {
+			return nil
+		}
+		return walkParts(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Disposition"),
+			msg.Header.Get("Content-Transfer-Encoding"), msg.Body, parts, e)
+	}
+
+	dispType, dispParams, _ := mime.ParseMediaType(disposition)
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decoded, err := headerDecoder.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "" || filename == "." || filename == "/" {
+		return nil
+	}
+	ext := strings.ToLower(path.Ext(filename))
+	if !emailExts[ext] || (emailImageExts[ext] && dispType != "attachment") {
+		return nil
+	}
+
+	data, err := io.ReadAll(decodeTransfer(body, encoding))
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", filename, err)
+	}
+	e.Attachments = append(e.Attachments, emailAttachment{Filename: filename, Data: data})
+	return nil
+}
+
+// decodeTransfer undoes a part's Content-Transfer-Encoding
+func decodeTransfer(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// mailRoutes picks the reMarkable folder for a sender. Each rule matches
+// one address ("alice@example.com") or a whole domain ("@example.com");
+// an address rule wins over a domain rule.
+type mailRoutes map[string]string
+
+// parseMailRoutes reads rules given as "sender=folder" pairs separated by
+// commas or new lines
+func parseMailRoutes(s string) (mailRoutes, error) {
+	routes := mailRoutes{}
+	for _, rule := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		sender, dir, ok := strings.Cut(rule, "=")
+		sender = strings.ToLower(strings.TrimSpace(sender))
+		dir = strings.TrimSpace(dir)
+		if !ok || sender == "" || dir == "" || !strings.Contains(sender, "@") {
+			return nil, fmt.Errorf("route %q must be sender=folder", rule)
+		}
+		routes[sender] = path.Clean("/" + dir)
+	}
+	return routes, nil
+}
+
+// match returns the folder for sender, if a rule matches it
+func (r mailRoutes) match(sender string) (string, bool) {
+	if dir, ok := r[sender]; ok {
+		return dir, true
+	}
+	if at := strings.LastIndexByte(sender, '@'); at >= 0 {
+		dir, ok := r[sender[at:]]
+		return dir, ok
+	}
+	return "", false
+}
+
+// senderAllowed reports whether sender matches one of the addresses or
+// "@domain" entries in allowed; an empty list allows everyone
+func senderAllowed(allowed []string, sender string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	at := strings.LastIndexByte(sender, '@')
+	for _, a := range allowed {
+		if a == sender || (at >= 0 && a == sender[at:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSenders parses a comma-separated list of addresses and "@domain"
+// entries
+func splitSenders(s string) []string {
+	var senders []string
+	for _, sender := range strings.Split(s, ",") {
+		if sender = strings.ToLower(strings.TrimSpace(sender)); sender != "" {
+			senders = append(senders, sender)
+		}
+	}
+	return senders
+}
@@ -0,0 +1,196 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// crlf converts a message written with \n line ends to the wire form
+func crlf(s string) []byte {
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+func attachmentNames(e *email) []string {
+	var names []string
+	for _, a := range e.Attachments {
+		names = append(names, a.Filename)
+	}
+	return names
+}
+
+func TestParseEmailMultipart(t *testing.T) {
+	pdf := base64.StdEncoding.EncodeToString([]byte("%PDF-1.7 base64 attachment"))
+	raw := crlf(`From: "Alice Example" <Alice@Example.com>
+To: aviary@example.com
+Cc: Bob <bob@example.com>
+Delivered-To: aviary+token@example.com
+Subject: =?UTF-8?Q?R=C3=A9sum=C3=A9?=
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain; charset=utf-8
+
+See attached.
+--inner
+Content-Type: multipart/related; boundary="related"
+
+--related
+Content-Type: text/html; charset=utf-8
+
+<p>See attached.<img src="cid:logo"></p>
+--related
+Content-Type: image/png; name="logo.png"
+Content-Disposition: inline; filename="logo.png"
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgo=
+--related--
+--inner--
+--outer
+Content-Type: application/pdf; name="report.pdf"
+Content-Disposition: attachment; filename="report.pdf"
+Content-Transfer-Encoding: base64
+
+` + pdf[:20] + "\n" + pdf[20:] + `
+--outer
+Content-Type: application/epub+zip
+Content-Disposition: attachment; filename="book.epub"
+Content-Transfer-Encoding: quoted-printable
+
+PK=03=04 quoted=
+-printable
+--outer
+Content-Type: image/jpeg
+Content-Disposition: attachment; filename="photo.JPG"
+
+jpeg
+--outer
+Content-Type: text/plain
+Content-Disposition: attachment; filename="notes.txt"
+
+not delivered
+--outer--
+`)
+
+	e, err := parseEmail(raw)
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+	if e.From != "alice@example.com" {
+		t.Errorf("From = %q, want alice@example.com", e.From)
+	}
+	if e.Subject != "Résumé" {
+		t.Errorf("Subject = %q, want Résumé", e.Subject)
+	}
+	wantRecipients := []string{"aviary+token@example.com", "aviary@example.com", "bob@example.com"}
+	if !reflect.DeepEqual(e.Recipients, wantRecipients) {
+		t.Errorf("Recipients = %v, want %v", e.Recipients, wantRecipients)
+	}
+
+	// The inline logo and the text file are skipped
+	want := []emailAttachment{
+		{"report.pdf", []byte("%PDF-1.7 base64 attachment")},
+		{"book.epub", []byte("PK\x03\x04 quoted-printable")},
+		{"photo.JPG", []byte("jpeg")},
+	}
+	if !reflect.DeepEqual(e.Attachments, want) {
+		t.Errorf("Attachments = %q, want %q", e.Attachments, want)
+	}
+}
+
+func TestParseEmailEncodedFilenames(t *testing.T) {
+	raw := crlf(`From: alice@example.com
+Subject: files
+Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: application/pdf; name="=?UTF-8?B?w5xiZXJzaWNodC5wZGY=?="
+Content-Disposition: attachment
+
+one
+--b
+Content-Type: application/pdf
+Content-Disposition: attachment; filename*=UTF-8''Fa%C3%A7ture%20mai.pdf
+
+two
+--b
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="C:\Users\alice\..\scan.pdf"
+
+three
+--b--
+`)
+
+	e, err := parseEmail(raw)
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+	want := []string{"Übersicht.pdf", "Façture mai.pdf", "scan.pdf"}
+	if got := attachmentNames(e); !reflect.DeepEqual(got, want) {
+		t.Errorf("filenames = %q, want %q", got, want)
+	}
+}
+
+func TestParseEmailForwardedMessage(t *testing.T) {
+	raw := crlf(`From: bob@example.com
+Subject: Fwd: invoice
+Content-Type: multipart/mixed; boundary=fwd
+
+--fwd
+Content-Type: text/plain
+
+Forwarding this.
+--fwd
+Content-Type: message/rfc822
+
+From: billing@example.com
+Subject: invoice
+Content-Type: multipart/mixed; boundary=orig
+
+--orig
+Content-Type: application/pdf; name=invoice.pdf
+Content-Transfer-Encoding: base64
+
+JVBERg==
+--orig--
+--fwd--
+`)
+
+	e, err := parseEmail(raw)
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+	if len(e.Attachments) != 1 || e.Attachments[0].Filename != "invoice.pdf" || string(e.Attachments[0].Data) != "%PDF" {
+		t.Errorf("Attachments = %q, want invoice.pdf", e.Attachments)
+	}
+}
+
+func TestParseEmailPartLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("From: a@example.com\nContent-Type: multipart/mixed; boundary=x\n\n")
+	for i := 0; i < maxEmailParts+10; i++ {
+		b.WriteString("--x\nContent-Type: application/pdf\nContent-Disposition: attachment; filename=a.pdf\n\n%PDF\n")
+	}
+	b.WriteString("--x--\n")
+
+	e, err := parseEmail(crlf(b.String()))
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+	// The message itself counts as the first part
+	if len(e.Attachments) != maxEmailParts-1 {
+		t.Errorf("got %d attachments, want %d", len(e.Attachments), maxEmailParts-1)
+	}
+}
+
+func TestParseEmailRejectsBadFrom(t *testing.T) {
+	if _, err := parseEmail(crlf("From: not an address\nSubject: x\n\nbody\n")); err == nil {
+		t.Error("parseEmail accepted a message without a valid From")
+	}
+}
@@ -0,0 +1,247 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	imapDialTimeout    = 15 * time.Second
+	imapCommandTimeout = 2 * time.Minute
+)
+
+// imapResponse is one response line from the server, with the contents of
+// any literals ({n} followed by n bytes) it carried
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+// imapClient speaks the small part of IMAP4rev1 (RFC 3501) that mail
+// ingestion needs: log in, find unseen messages, fetch them and mark them
+// seen
+type imapClient struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	tag        int
+	maxLiteral int64
+}
+
+// dialIMAP connects to addr and reads the greeting. With implicitTLS the
+// connection is TLS from the start (port 993); otherwise it's upgraded with
+// STARTTLS, and servers that don't offer it are refused.
+func dialIMAP(ctx context.Context, addr string, implicitTLS bool, maxLiteral int64) (*imapClient, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: imapDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if implicitTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c := &imapClient{conn: conn, reader: bufio.NewReader(conn), maxLiteral: maxLiteral}
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting %q", greeting.text)
+	}
+
+	if !implicitTLS {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.conn = tlsConn
+		c.reader = bufio.NewReader(tlsConn)
+	}
+	return c, nil
+}
+
+// Close logs out and closes the connection
+func (c *imapClient) Close() error {
+	c.command("LOGOUT")
+	return c.conn.Close()
+}
+
+// quoteIMAP returns s as an IMAP quoted string
+func quoteIMAP(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Login authenticates with a username and password
+func (c *imapClient) Login(username, password string) error {
+	if strings.ContainsAny(username+password, "\r\n") {
+		return errors.New("credentials must not contain line breaks")
+	}
+	_, err := c.command("LOGIN " + quoteIMAP(username) + " " + quoteIMAP(password))
+	return err
+}
+
+// Select opens a mailbox folder such as INBOX
+func (c *imapClient) Select(folder string) error {
+	_, err := c.command("SELECT " + quoteIMAP(folder))
+	return err
+}
+
+// SearchUnseen returns the UIDs of the messages not yet marked seen
+func (c *imapClient) SearchUnseen() ([]uint32, error) {
+	resps, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, r := range resps {
+		rest, ok := strings.CutPrefix(r.text, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(rest) {
+			if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// Size returns the size in bytes of message uid
+func (c *imapClient) Size(uid uint32) (int64, error) {
+	resps, err := c.command(fmt.Sprintf("UID FETCH %d (RFC822.SIZE)", uid))
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range resps {
+		_, rest, ok := strings.Cut(r.text, "RFC822.SIZE ")
+		if !ok {
+			continue
+		}
+		end := strings.IndexAny(rest, " )")
+		if end < 0 {
+			end = len(rest)
+		}
+		return strconv.ParseInt(rest[:end], 10, 64)
+	}
+	return 0, fmt.Errorf("no size returned for message %d", uid)
+}
+
+// Fetch returns the whole raw message uid without marking it seen
+func (c *imapClient) Fetch(uid uint32) ([]byte, error) {
+	resps, err := c.command(fmt.Sprintf("UID FETCH %d (BODY.PEEK[])", uid))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resps {
+		if strings.Contains(r.text, "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("message %d not found", uid)
+}
+
+// MarkSeen flags message uid as seen, so it isn't ingested again
+func (c *imapClient) MarkSeen(uid uint32) error {
+	_, err := c.command(fmt.Sprintf(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid))
+	return err
+}
+
+// command sends a tagged command and returns the untagged responses, or an
+// error if the server didn't answer OK
+func (c *imapClient) command(cmd string) ([]imapResponse, error) {
+	c.tag++
+	tag := "A" + strconv.Itoa(c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	if _, err := io.WriteString(c.conn, tag+" "+cmd+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var untagged []imapResponse
+	for {
+		r, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		status, ok := strings.CutPrefix(r.text, tag+" ")
+		if !ok {
+			untagged = append(untagged, r)
+			continue
+		}
+		if !strings.HasPrefix(status, "OK") {
+			verb, _, _ := strings.Cut(cmd, " ")
+			return nil, fmt.Errorf("%s: %s", verb, status)
+		}
+		return untagged, nil
+	}
+}
+
+// readResponse reads one response, following the literals it contains
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var r imapResponse
+	var text strings.Builder
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return r, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		text.WriteString(line)
+
+		n, ok := literalSize(line)
+		if !ok {
+			break
+		}
+		if n > c.maxLiteral {
+			return r, fmt.Errorf("response of %d bytes exceeds the %d byte limit", n, c.maxLiteral)
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.reader, literal); err != nil {
+			return r, err
+		}
+		r.literals = append(r.literals, literal)
+	}
+	r.text = text.String()
+	return r, nil
+}
+
+// literalSize returns n if line ends with a literal announcement "{n}"
+func literalSize(line string) (int64, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(line[open+1:len(line)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeIMAP answers each command read from conn with the scripted response for
+// its verb, with "TAG" replaced by the command's tag
+func fakeIMAP(t *testing.T, conn net.Conn, script map[string]string) {
+	t.Helper()
+	go func() {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			verb := cmd
+			if strings.HasPrefix(cmd, "UID ") {
+				verb = strings.Join(strings.Fields(cmd)[:2], " ")
+			} else if i := strings.IndexByte(cmd, ' '); i >= 0 {
+				verb = cmd[:i]
+			}
+			reply, ok := script[verb]
+			if !ok {
+				reply = "TAG BAD unknown command\r\n"
+			}
+			conn.Write([]byte(strings.ReplaceAll(reply, "TAG", tag)))
+		}
+	}()
+}
+
+func newFakeIMAPClient(t *testing.T, script map[string]string) *imapClient {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	fakeIMAP(t, server, script)
+	return &imapClient{conn: client, reader: bufio.NewReader(client), maxLiteral: 1 << 20}
+}
+
+func TestIMAPClientCommands(t *testing.T) {
+	message := "From: a@example.com\r\nSubject: hi\r\n\r\nbody\r\n"
+	c := newFakeIMAPClient(t, map[string]string{
+		"LOGIN":      "TAG OK LOGIN completed\r\n",
+		"SELECT":     "* 3 EXISTS\r\n* OK [UIDVALIDITY 1]\r\nTAG OK [READ-WRITE] SELECT completed\r\n",
+		"UID SEARCH": "* SEARCH 4 9 12\r\nTAG OK SEARCH completed\r\n",
+		"UID FETCH":  "* 2 FETCH (UID 9 BODY[] {" + strconv.Itoa(len(message)) + "}\r\n" + message + ")\r\nTAG OK FETCH completed\r\n",
+		"UID STORE":  "TAG OK STORE completed\r\n",
+	})
+
+	if err := c.Login("alice", `pa"ss`); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := c.Select("INBOX"); err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	uids, err := c.SearchUnseen()
+	if err != nil || !reflect.DeepEqual(uids, []uint32{4, 9, 12}) {
+		t.Errorf("SearchUnseen = %v, %v, want [4 9 12]", uids, err)
+	}
+	raw, err := c.Fetch(9)
+	if err != nil || string(raw) != message {
+		t.Errorf("Fetch = %q, %v, want %q", raw, err, message)
+	}
+	if err := c.MarkSeen(9); err != nil {
+		t.Errorf("MarkSeen: %v", err)
+	}
+}
+
+func TestIMAPClientErrors(t *testing.T) {
+	c := newFakeIMAPClient(t, map[string]string{
+		"LOGIN":     "TAG NO [AUTHENTICATIONFAILED] Invalid credentials\r\n",
+		"UID FETCH": "* 1 FETCH (BODY[] {5000000}\r\n",
+	})
+	c.maxLiteral = 1000
+
+	if err := c.Login("alice", "wrong"); err == nil || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+		t.Errorf("Login error = %v, want the server's NO response", err)
+	}
+	if err := c.Login("alice", "pass\r\nA2 LOGOUT"); err == nil {
+		t.Error("Login accepted credentials with a line break")
+	}
+	if _, err := c.Fetch(1); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("Fetch error = %v, want the literal size limit", err)
+	}
+}
+
+func TestLiteralSize(t *testing.T) {
+	tests := []struct {
+		line string
+		want int64
+		ok   bool
+	}{
+		{"* 1 FETCH (BODY[] {42}", 42, true},
+		{"* 1 FETCH (BODY[] {0}", 0, true},
+		{"* OK done", 0, false},
+		{"* 1 FETCH {abc}", 0, false},
+		{"* 1 FETCH {-1}", 0, false},
+	}
+	for _, tt := range tests {
+		if n, ok := literalSize(tt.line); n != tt.want || ok != tt.ok {
+			t.Errorf("literalSize(%q) = %d %v, want %d %v", tt.line, n, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestQuoteIMAP(t *testing.T) {
+	if got := quoteIMAP(`a "b" \c`); got != `"a \"b\" \\c"` {
+		t.Errorf("quoteIMAP = %s", got)
+	}
+}
@@ -0,0 +1,222 @@
+package ingest
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// Personal inbound addresses work like Send to Kindle addresses: each user
+// gets INBOUND_EMAIL_ADDRESS with a secret token added after a "+"
+// (aviary+k3x9q2m7pd@example.com), and documents mailed to it are uploaded
+// for them. The mail arrives through the IMAP_URL mailbox, or from a mail
+// provider's inbound webhook.
+
+// inboundTokenEncoding spells tokens in lowercase letters and digits, as some
+// mail servers lowercase the local part
+var inboundTokenEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newInboundToken returns a random 16 character token
+func newInboundToken() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return inboundTokenEncoding.EncodeToString(b), nil
+}
+
+// inboundBase splits INBOUND_EMAIL_ADDRESS into its local part and domain
+func inboundBase() (local, domain string, ok bool) {
+	addr := strings.ToLower(strings.TrimSpace(config.Get("INBOUND_EMAIL_ADDRESS", "")))
+	local, domain, ok = strings.Cut(addr, "@")
+	return local, domain, ok && local != "" && domain != ""
+}
+
+// inboundAddress returns the personal address for token, or "" when
+// INBOUND_EMAIL_ADDRESS isn't set
+func inboundAddress(token string) string {
+	local, domain, ok := inboundBase()
+	if !ok {
+		return ""
+	}
+	return local + "+" + token + "@" + domain
+}
+
+// inboundToken returns the token in addr if it's a personal address
+func inboundToken(addr string) string {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return ""
+	}
+	if baseLocal, baseDomain, configured := inboundBase(); configured {
+		if domain != baseDomain || !strings.HasPrefix(local, baseLocal+"+") {
+			return ""
+		}
+	}
+	plus := strings.LastIndexByte(local, '+')
+	if plus < 0 {
+		return ""
+	}
+	return local[plus+1:]
+}
+
+// userByInboundToken returns the active user whose personal address is one
+// of addrs
+func userByInboundToken(addrs []string) *database.User {
+	for _, addr := range addrs {
+		token := inboundToken(addr)
+		if token == "" {
+			continue
+		}
+		var user database.User
+		if err := database.DB.Where("inbound_email_token = ? AND is_active = ?", token, true).First(&user).Error; err == nil {
+			return &user
+		}
+	}
+	return nil
+}
+
+func inboundResponse(user *database.User) gin.H {
+	resp := gin.H{"configured": false, "enabled": user.InboundEmailToken != nil, "address": ""}
+	if _, _, ok := inboundBase(); ok {
+		resp["configured"] = true
+		if user.InboundEmailToken != nil {
+			resp["address"] = inboundAddress(*user.InboundEmailToken)
+		}
+	}
+	return resp
+}
+
+// GetInboundEmailHandler returns the current user's personal inbound address
+func GetInboundEmailHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound email not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, inboundResponse(user))
+}
+
+// RotateInboundEmailHandler gives the current user a new personal address,
+// turning it on if it was off. The old address stops working.
+func RotateInboundEmailHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound email not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+	if _, _, ok := inboundBase(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Inbound email is not configured on this server"})
+		return
+	}
+
+	token, err := newInboundToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create address"})
+		return
+	}
+	if err := database.DB.Model(&database.User{}).Where("id = ?", user.ID).Update("inbound_email_token", token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create address"})
+		return
+	}
+	user.InboundEmailToken = &token
+
+	logging.LogfWithUser(user.Username, "[EMAIL] Personal inbound address rotated")
+	c.JSON(http.StatusOK, inboundResponse(user))
+}
+
+// DisableInboundEmailHandler turns off the current user's personal address
+func DisableInboundEmailHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound email not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Model(&database.User{}).Where("id = ?", user.ID).Update("inbound_email_token", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to turn off address"})
+		return
+	}
+	user.InboundEmailToken = nil
+	c.JSON(http.StatusOK, inboundResponse(user))
+}
+
+// InboundEmailHandler receives mail from a mail provider's inbound webhook
+// and uploads its attachments for the user whose personal address it was
+// sent to. The raw message is read from the "email" (SendGrid) or
+// "body-mime" (Mailgun) form field, or from the request body. The request
+// must carry INBOUND_EMAIL_SECRET in the X-Inbound-Secret header or the
+// secret query parameter.
+func InboundEmailHandler(c *gin.Context) {
+	secret := config.Get("INBOUND_EMAIL_SECRET", "")
+	if !database.IsMultiUserMode() || secret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound email webhook not enabled"})
+		return
+	}
+	given := c.GetHeader("X-Inbound-Secret")
+	if given == "" {
+		given = c.Query("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid secret"})
+		return
+	}
+	// Providers retry later, so nothing is lost
+	if maintenance.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "maintenance mode: not accepting new jobs"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, webhook.MaxUploadSize()*2)
+	var raw []byte
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		for _, field := range []string{"email", "body-mime"} {
+			if v := c.PostForm(field); v != "" {
+				raw = []byte(v)
+				break
+			}
+		}
+	} else {
+		var err error
+		if raw, err = io.ReadAll(c.Request.Body); err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Message too large"})
+			return
+		}
+	}
+	if len(raw) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No message found"})
+		return
+	}
+
+	// Mail that can't be delivered is dropped and answered with 200, so the
+	// provider doesn't retry it
+	n, err := ingestEmail(&mailboxConfig{name: "inbound webhook", tokenOnly: true}, raw)
+	if err != nil {
+		logging.Logf("[EMAIL] Dropping message from inbound webhook: %v", err)
+		c.JSON(http.StatusOK, gin.H{"attachments": n, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": n})
+}
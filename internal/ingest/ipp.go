@@ -0,0 +1,631 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/converter"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// IPP operations
+const (
+	ippPrintJob             = 0x0002
+	ippValidateJob          = 0x0004
+	ippCancelJob            = 0x0008
+	ippGetJobAttributes     = 0x0009
+	ippGetJobs              = 0x000A
+	ippGetPrinterAttributes = 0x000B
+)
+
+// IPP status codes
+const (
+	ippOK                      = 0x0000
+	ippBadRequest              = 0x0400
+	ippNotFound                = 0x0406
+	ippTooLarge                = 0x0409
+	ippFormatNotSupported      = 0x040A
+	ippNotPossible             = 0x040C
+	ippFormatError             = 0x040E
+	ippCompressionNotSupported = 0x040F
+	ippInternalError           = 0x0500
+	ippOperationNotSupported   = 0x0501
+	ippVersionNotSupported     = 0x0503
+	ippNotAcceptingJobs        = 0x0506
+)
+
+// IPP job and printer states
+const (
+	ippJobPending    = 3
+	ippJobProcessing = 5
+	ippJobCanceled   = 7
+	ippJobAborted    = 8
+	ippJobCompleted  = 9
+
+	ippPrinterIdle    = 3
+	ippPrinterStopped = 5
+)
+
+// ippFormats maps the document formats accepted for printing to the file
+// extension the pipeline expects
+var ippFormats = map[string]string{
+	"application/pdf":        ".pdf",
+	"application/postscript": ".ps",
+	"image/jpeg":             ".jpg",
+	"image/png":              ".png",
+}
+
+// enqueueLocalFile hands a received file to the upload pipeline. Tests
+// replace it to keep jobs from running.
+var enqueueLocalFile = webhook.EnqueueLocalFile
+
+// maxIPPJobs is how many submitted jobs are remembered for status queries
+const maxIPPJobs = 100
+
+// ippJob is a print job handed to the upload pipeline
+type ippJob struct {
+	id      int
+	jobID   string
+	userID  uuid.UUID
+	name    string
+	owner   string
+	printed time.Time
+}
+
+// IPPServer is a virtual IPP printer. Documents printed to it are converted to
+// PDF where needed and delivered to the reMarkable like an upload, so any
+// app's Print dialog can send to the tablet.
+type IPPServer struct {
+	addr    string
+	name    string
+	owner   string
+	options webhook.DocumentRequest
+	started time.Time
+
+	mu     sync.Mutex
+	jobs   []*ippJob
+	nextID int
+}
+
+// NewIPPServerFromEnv returns a printer configured from IPP_LISTEN and the
+// other IPP_ settings, or nil when IPP_LISTEN is not set
+func NewIPPServerFromEnv() (*IPPServer, error) {
+	addr := config.Get("IPP_LISTEN", "")
+	if addr == "" {
+		return nil, nil
+	}
+	owner := config.Get("IPP_USER", "")
+	if owner != "" && !database.IsMultiUserMode() {
+		return nil, errors.New("IPP_USER is only used in multi-user mode")
+	}
+	return &IPPServer{
+		addr:  addr,
+		name:  config.Get("IPP_PRINTER_NAME", "Aviary"),
+		owner: owner,
+		options: webhook.DocumentRequest{
+			RmDir: config.Get("IPP_RM_DIR", ""),
+		},
+		started: time.Now(),
+		nextID:  1,
+	}, nil
+}
+
+// Start listens in the background until ctx is cancelled
+func (s *IPPServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	logging.Logf("[IPP] Printer %q listening on %s", s.name, listener.Addr())
+
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logging.Logf("[IPP] Server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// authRequired reports whether print jobs need credentials. Without them,
+// jobs go to IPP_USER in multi-user mode; in single-user mode the printer is
+// as open as the web UI.
+func (s *IPPServer) authRequired() bool {
+	if database.IsMultiUserMode() {
+		return s.owner == ""
+	}
+	return singleUserAuthConfigured()
+}
+
+// ServeHTTP handles IPP requests, which are POSTed with the application/ipp
+// content type
+func (s *IPPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "IPP printer: POST application/ipp requests", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/ipp") {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Credentials come with the HTTP headers, so nothing of the body is read
+	// for clients that can't use the printer
+	userID, user, ok := s.authorize(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Aviary"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, webhook.MaxUploadSize()+maxIPPHeaderSize)
+	body := bufio.NewReader(r.Body)
+	req, err := readIPPMessage(body)
+	if errors.Is(err, errIPPTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := s.newResponse(req, ippOK)
+	if req.major != 1 && req.major != 2 {
+		resp.code = ippVersionNotSupported
+		s.write(w, resp)
+		return
+	}
+	if req.operationString("attributes-charset") == "" || req.operationString("attributes-natural-language") == "" {
+		resp.code = ippBadRequest
+		s.write(w, resp)
+		return
+	}
+
+	switch req.code {
+	case ippGetPrinterAttributes:
+		s.printerAttributes(resp, r)
+	case ippPrintJob:
+		s.printJob(req, resp, body, r, userID, user)
+	case ippValidateJob:
+		if code := checkIPPFormat(req, resp); code != ippOK {
+			resp.code = code
+		}
+	case ippGetJobAttributes:
+		s.getJobAttributes(req, resp, r, userID)
+	case ippGetJobs:
+		s.getJobs(req, resp, r, userID)
+	case ippCancelJob:
+		// Jobs are handed to the pipeline as soon as they're received
+		resp.code = ippNotPossible
+	default:
+		resp.code = ippOperationNotSupported
+	}
+	s.write(w, resp)
+}
+
+// authorize resolves the user a request acts for from HTTP basic credentials,
+// falling back to IPP_USER
+func (s *IPPServer) authorize(r *http.Request) (uuid.UUID, *database.User, bool) {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if username, password, ok := r.BasicAuth(); ok {
+		userID, err := authenticatePassword(username, password, host, "IPP")
+		if err != nil {
+			logging.Logf("[IPP] Rejected login for %s from %s: %v", username, host, err)
+			return uuid.Nil, nil, false
+		}
+		if !database.IsMultiUserMode() {
+			return uuid.Nil, nil, true
+		}
+		user, err := database.NewUserService(database.DB).GetUserByID(userID)
+		if err != nil {
+			return uuid.Nil, nil, false
+		}
+		return user.ID, user, true
+	}
+
+	if s.authRequired() {
+		return uuid.Nil, nil, false
+	}
+	if database.IsMultiUserMode() {
+		user := activeUser(s.owner)
+		if user == nil {
+			logging.Logf("[IPP] IPP_USER %s not found or inactive", s.owner)
+			return uuid.Nil, nil, false
+		}
+		return user.ID, user, true
+	}
+	return uuid.Nil, nil, true
+}
+
+// checkIPPFormat checks the document format and compression of a job,
+// listing unsupported values in resp
+func checkIPPFormat(req, resp *ippMessage) uint16 {
+	if format := req.operationString("document-format"); format != "" && format != "application/octet-stream" {
+		if _, ok := ippFormats[format]; !ok {
+			resp.groups = append(resp.groups, ippGroup{tag: ippTagUnsupported, attrs: []ippAttr{
+				ippStrings("document-format", ippTagMimeMediaType, format),
+			}})
+			return ippFormatNotSupported
+		}
+	}
+	if compression := req.operationString("compression"); compression != "" && compression != "none" && compression != "gzip" {
+		resp.groups = append(resp.groups, ippGroup{tag: ippTagUnsupported, attrs: []ippAttr{
+			ippStrings("compression", ippTagKeyword, compression),
+		}})
+		return ippCompressionNotSupported
+	}
+	return ippOK
+}
+
+// printJob saves the document that follows the request and starts a job for it
+func (s *IPPServer) printJob(req, resp *ippMessage, body io.Reader, r *http.Request, userID uuid.UUID, user *database.User) {
+	if code := checkIPPFormat(req, resp); code != ippOK {
+		resp.code = code
+		return
+	}
+	if maintenance.Enabled() {
+		resp.code = ippNotAcceptingJobs
+		return
+	}
+	if req.operationString("compression") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			resp.code = ippFormatError
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	tempDir, err := manager.CreateUserTempDir(userID)
+	if err != nil {
+		resp.code = ippInternalError
+		return
+	}
+	path, code := saveIPPDocument(body, tempDir, req)
+	if code != ippOK {
+		os.RemoveAll(tempDir)
+		resp.code = code
+		return
+	}
+	if filepath.Ext(path) == ".ps" {
+		pdfPath, err := converter.ConvertPostScriptToPDF(path)
+		os.Remove(path)
+		if err != nil {
+			logging.Logf("[IPP] Failed to convert PostScript job: %v", err)
+			os.RemoveAll(tempDir)
+			resp.code = ippFormatError
+			return
+		}
+		path = pdfPath
+	}
+
+	jobID := enqueueLocalFile(path, s.options, "ipp", userID)
+	owner := req.operationString("requesting-user-name")
+	if user != nil {
+		owner = user.Username
+		logging.LogfWithUser(user.Username, "[IPP] Enqueued job %s for %s", jobID, filepath.Base(path))
+	} else {
+		logging.Logf("[IPP] Enqueued job %s for %s", jobID, filepath.Base(path))
+	}
+
+	job := s.addJob(&ippJob{jobID: jobID, userID: userID, name: filepath.Base(path), owner: owner, printed: time.Now()})
+	resp.groups = append(resp.groups, ippGroup{tag: ippTagJob, attrs: s.jobAttributes(job, r)})
+}
+
+// saveIPPDocument writes the document data of a Print-Job request to dir,
+// named after the job and with the extension of its format
+func saveIPPDocument(body io.Reader, dir string, req *ippMessage) (string, uint16) {
+	// Sniff the format when the client didn't say
+	br := bufio.NewReader(body)
+	head, _ := br.Peek(8)
+	format := req.operationString("document-format")
+	if _, ok := ippFormats[format]; !ok {
+		format = sniffIPPFormat(head)
+		if format == "" {
+			return "", ippFormatNotSupported
+		}
+	}
+	if len(head) == 0 {
+		return "", ippBadRequest
+	}
+
+	name := ippJobName(req)
+	path := filepath.Join(dir, name+ippFormats[format])
+	f, err := os.Create(path)
+	if err != nil {
+		return "", ippInternalError
+	}
+	limit := webhook.MaxUploadSize()
+	n, err := io.Copy(f, io.LimitReader(br, limit+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", ippInternalError
+	}
+	if n > limit {
+		return "", ippTooLarge
+	}
+	return path, ippOK
+}
+
+// sniffIPPFormat returns the format of a document from its first bytes
+func sniffIPPFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF")):
+		return "application/pdf"
+	case bytes.HasPrefix(head, []byte("%!")):
+		return "application/postscript"
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG")):
+		return "image/png"
+	}
+	return ""
+}
+
+// maxIPPJobName is the longest file name, in bytes, taken from a job
+const maxIPPJobName = 200
+
+// ippJobName returns a file name for a job from its job-name or
+// document-name, which apps often set to the title or file name
+func ippJobName(req *ippMessage) string {
+	name := req.operationString("document-name")
+	if name == "" {
+		name = req.operationString("job-name")
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if ext := filepath.Ext(name); len(ext) > 1 && len(ext) <= 5 && !strings.Contains(ext, " ") {
+		name = strings.TrimSuffix(name, ext)
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		name = "Print job " + time.Now().Format("2006-01-02 15.04.05")
+	}
+	if len(name) > maxIPPJobName {
+		cut := maxIPPJobName
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	return name
+}
+
+func (s *IPPServer) addJob(job *ippJob) *ippJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.id = s.nextID
+	s.nextID++
+	s.jobs = append(s.jobs, job)
+	if len(s.jobs) > maxIPPJobs {
+		s.jobs = s.jobs[len(s.jobs)-maxIPPJobs:]
+	}
+	return job
+}
+
+// userJobs returns the remembered jobs of a user, oldest first
+func (s *IPPServer) userJobs(userID uuid.UUID) []*ippJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []*ippJob
+	for _, job := range s.jobs {
+		if job.userID == userID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func (s *IPPServer) getJobAttributes(req, resp *ippMessage, r *http.Request, userID uuid.UUID) {
+	id, ok := req.operationInt("job-id")
+	if !ok {
+		if uri := req.operationString("job-uri"); uri != "" {
+			_, err := fmt.Sscanf(uri[strings.LastIndex(uri, "/")+1:], "%d", &id)
+			ok = err == nil
+		}
+	}
+	if !ok {
+		resp.code = ippBadRequest
+		return
+	}
+	for _, job := range s.userJobs(userID) {
+		if job.id == id {
+			resp.groups = append(resp.groups, ippGroup{tag: ippTagJob, attrs: s.jobAttributes(job, r)})
+			return
+		}
+	}
+	resp.code = ippNotFound
+}
+
+func (s *IPPServer) getJobs(req, resp *ippMessage, r *http.Request, userID uuid.UUID) {
+	completed := req.operationString("which-jobs") == "completed"
+	limit, hasLimit := req.operationInt("limit")
+	jobs := s.userJobs(userID)
+	// Newest first
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if hasLimit && limit <= 0 {
+			break
+		}
+		if (jobState(jobs[i]) >= ippJobCanceled) != completed {
+			continue
+		}
+		resp.groups = append(resp.groups, ippGroup{tag: ippTagJob, attrs: s.jobAttributes(jobs[i], r)})
+		limit--
+	}
+}
+
+// jobState maps the pipeline's status of a job to an IPP job state
+func jobState(job *ippJob) int {
+	status, ok := webhook.JobStatus(job.jobID)
+	switch {
+	case !ok || status == "success":
+		return ippJobCompleted
+	case status == "error":
+		return ippJobAborted
+	case status == "cancelled":
+		return ippJobCanceled
+	case status == "running":
+		return ippJobProcessing
+	}
+	return ippJobPending
+}
+
+func (s *IPPServer) jobAttributes(job *ippJob, r *http.Request) []ippAttr {
+	state := jobState(job)
+	reason := "none"
+	switch state {
+	case ippJobCompleted:
+		reason = "job-completed-successfully"
+	case ippJobAborted:
+		reason = "aborted-by-system"
+	case ippJobCanceled:
+		reason = "job-canceled-by-user"
+	case ippJobProcessing:
+		reason = "job-printing"
+	case ippJobPending:
+		reason = "job-queued"
+	}
+	printerURI := ippPrinterURI(r)
+	return []ippAttr{
+		ippInts("job-id", ippTagInteger, job.id),
+		ippStrings("job-uri", ippTagURI, fmt.Sprintf("%s/%d", printerURI, job.id)),
+		ippStrings("job-printer-uri", ippTagURI, printerURI),
+		ippStrings("job-name", ippTagName, job.name),
+		ippStrings("job-originating-user-name", ippTagName, job.owner),
+		ippInts("job-state", ippTagEnum, state),
+		ippStrings("job-state-reasons", ippTagKeyword, reason),
+		ippInts("time-at-creation", ippTagInteger, int(job.printed.Sub(s.started).Seconds())+1),
+	}
+}
+
+// ippPrinterURI returns the printer's URI as the client addressed it
+func ippPrinterURI(r *http.Request) string {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	return "ipp://" + r.Host + strings.TrimSuffix(path, "/")
+}
+
+func (s *IPPServer) printerAttributes(resp *ippMessage, r *http.Request) {
+	accepting := !maintenance.Enabled()
+	state, reason := ippPrinterIdle, "none"
+	if !accepting {
+		state, reason = ippPrinterStopped, "paused"
+	}
+	authentication := "requesting-user-name"
+	if s.authRequired() {
+		authentication = "basic"
+	}
+	formats := []string{"application/pdf", "application/postscript", "image/jpeg", "image/png", "application/octet-stream"}
+
+	s.mu.Lock()
+	queued := 0
+	for _, job := range s.jobs {
+		if jobState(job) < ippJobCanceled {
+			queued++
+		}
+	}
+	s.mu.Unlock()
+
+	resp.groups = append(resp.groups, ippGroup{tag: ippTagPrinter, attrs: []ippAttr{
+		ippStrings("printer-uri-supported", ippTagURI, ippPrinterURI(r)),
+		ippStrings("uri-security-supported", ippTagKeyword, "none"),
+		ippStrings("uri-authentication-supported", ippTagKeyword, authentication),
+		ippStrings("printer-name", ippTagName, s.name),
+		ippStrings("printer-info", ippTagText, s.name),
+		ippStrings("printer-make-and-model", ippTagText, "Aviary reMarkable Printer"),
+		ippStrings("printer-uuid", ippTagURI, "urn:uuid:"+uuid.NewSHA1(uuid.NameSpaceURL, []byte("aviary-ipp:"+s.name)).String()),
+		ippInts("printer-state", ippTagEnum, state),
+		ippStrings("printer-state-reasons", ippTagKeyword, reason),
+		ippBool("printer-is-accepting-jobs", accepting),
+		ippInts("printer-up-time", ippTagInteger, int(time.Since(s.started).Seconds())+1),
+		ippInts("queued-job-count", ippTagInteger, queued),
+		ippInts("operations-supported", ippTagEnum,
+			ippPrintJob, ippValidateJob, ippCancelJob, ippGetJobAttributes, ippGetJobs, ippGetPrinterAttributes),
+		ippStrings("ipp-versions-supported", ippTagKeyword, "1.1", "2.0"),
+		ippStrings("charset-configured", ippTagCharset, "utf-8"),
+		ippStrings("charset-supported", ippTagCharset, "utf-8"),
+		ippStrings("natural-language-configured", ippTagLanguage, "en"),
+		ippStrings("generated-natural-language-supported", ippTagLanguage, "en"),
+		ippStrings("document-format-default", ippTagMimeMediaType, "application/pdf"),
+		ippStrings("document-format-supported", ippTagMimeMediaType, formats...),
+		ippStrings("compression-supported", ippTagKeyword, "none", "gzip"),
+		ippStrings("pdl-override-supported", ippTagKeyword, "attempted"),
+		ippBool("multiple-document-jobs-supported", false),
+		ippBool("color-supported", true),
+		ippStrings("print-color-mode-default", ippTagKeyword, "auto"),
+		ippStrings("print-color-mode-supported", ippTagKeyword, "auto", "color", "monochrome"),
+		ippStrings("media-default", ippTagKeyword, "iso_a4_210x297mm"),
+		ippStrings("media-supported", ippTagKeyword, "iso_a4_210x297mm", "na_letter_8.5x11in"),
+		ippStrings("media-ready", ippTagKeyword, "iso_a4_210x297mm", "na_letter_8.5x11in"),
+		ippStrings("sides-default", ippTagKeyword, "one-sided"),
+		ippStrings("sides-supported", ippTagKeyword, "one-sided"),
+		ippInts("copies-default", ippTagInteger, 1),
+		ippRange("copies-supported", 1, 1),
+		ippInts("orientation-requested-default", ippTagEnum, 3),
+		ippInts("orientation-requested-supported", ippTagEnum, 3, 4),
+		ippInts("print-quality-default", ippTagEnum, 4),
+		ippInts("print-quality-supported", ippTagEnum, 4),
+		ippResolution("printer-resolution-default", 300),
+		ippResolution("printer-resolution-supported", 300),
+	}})
+}
+
+// newResponse returns a response to req carrying the required charset and
+// language attributes
+func (s *IPPServer) newResponse(req *ippMessage, code uint16) *ippMessage {
+	major, minor := req.major, req.minor
+	if major != 1 && major != 2 {
+		major, minor = 1, 1
+	}
+	return &ippMessage{
+		major:     major,
+		minor:     minor,
+		code:      code,
+		requestID: req.requestID,
+		groups: []ippGroup{{tag: ippTagOperation, attrs: []ippAttr{
+			ippStrings("attributes-charset", ippTagCharset, "utf-8"),
+			ippStrings("attributes-natural-language", ippTagLanguage, "en"),
+		}}},
+	}
+}
+
+func (s *IPPServer) write(w http.ResponseWriter, resp *ippMessage) {
+	w.Header().Set("Content-Type", "application/ipp")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.encode())
+}
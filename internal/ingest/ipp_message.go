@@ -0,0 +1,239 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// IPP delimiter and value tags (RFC 8010)
+const (
+	ippTagOperation   = 0x01
+	ippTagJob         = 0x02
+	ippTagEnd         = 0x03
+	ippTagPrinter     = 0x04
+	ippTagUnsupported = 0x05
+
+	ippTagUnknown       = 0x12
+	ippTagNoValue       = 0x13
+	ippTagInteger       = 0x21
+	ippTagBoolean       = 0x22
+	ippTagEnum          = 0x23
+	ippTagResolution    = 0x32
+	ippTagRange         = 0x33
+	ippTagText          = 0x41
+	ippTagName          = 0x42
+	ippTagKeyword       = 0x44
+	ippTagURI           = 0x45
+	ippTagURIScheme     = 0x46
+	ippTagCharset       = 0x47
+	ippTagLanguage      = 0x48
+	ippTagMimeMediaType = 0x49
+)
+
+// ippAttr is an attribute with one or more values of the same tag. Values
+// are raw bytes; the helpers below build and read the common types.
+type ippAttr struct {
+	name   string
+	tag    byte
+	values [][]byte
+}
+
+// ippGroup is a group of attributes, such as the operation or printer group
+type ippGroup struct {
+	tag   byte
+	attrs []ippAttr
+}
+
+// ippMessage is an IPP request or response. code is the operation in a
+// request and the status in a response.
+type ippMessage struct {
+	major, minor byte
+	code         uint16
+	requestID    uint32
+	groups       []ippGroup
+}
+
+// Limits on the attributes of a request, which are read into memory. Real
+// clients send a few dozen attributes in well under a kilobyte.
+const (
+	maxIPPAttributes = 512
+	maxIPPHeaderSize = 64 << 10
+)
+
+var (
+	errBadIPP      = errors.New("malformed IPP message")
+	errIPPTooLarge = errors.New("IPP attributes too large")
+)
+
+// readIPPMessage decodes the attributes of a request, leaving r at the start
+// of the document data that follows them
+func readIPPMessage(r *bufio.Reader) (*ippMessage, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errBadIPP
+	}
+	msg := &ippMessage{
+		major:     header[0],
+		minor:     header[1],
+		code:      binary.BigEndian.Uint16(header[2:4]),
+		requestID: binary.BigEndian.Uint32(header[4:8]),
+	}
+
+	var group *ippGroup
+	var last *ippAttr
+	budget := maxIPPHeaderSize - len(header)
+	values := 0
+	for {
+		if budget--; budget < 0 {
+			return nil, errIPPTooLarge
+		}
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, errBadIPP
+		}
+		if tag == ippTagEnd {
+			return msg, nil
+		}
+		if tag < 0x10 {
+			msg.groups = append(msg.groups, ippGroup{tag: tag})
+			group = &msg.groups[len(msg.groups)-1]
+			last = nil
+			continue
+		}
+		if group == nil {
+			return nil, errBadIPP
+		}
+		if values++; values > maxIPPAttributes {
+			return nil, errIPPTooLarge
+		}
+		name, err := readIPPField(r, &budget)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readIPPField(r, &budget)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) == 0 {
+			// An additional value of the previous attribute
+			if last == nil {
+				return nil, errBadIPP
+			}
+			last.values = append(last.values, value)
+			continue
+		}
+		group.attrs = append(group.attrs, ippAttr{name: string(name), tag: tag, values: [][]byte{value}})
+		last = &group.attrs[len(group.attrs)-1]
+	}
+}
+
+// readIPPField reads a length-prefixed name or value, charging it to budget
+func readIPPField(r *bufio.Reader, budget *int) ([]byte, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, errBadIPP
+	}
+	size := int(binary.BigEndian.Uint16(n[:]))
+	if *budget -= len(n) + size; *budget < 0 {
+		return nil, errIPPTooLarge
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, errBadIPP
+	}
+	return buf, nil
+}
+
+// encode returns the wire form of the message
+func (m *ippMessage) encode() []byte {
+	buf := []byte{m.major, m.minor}
+	buf = binary.BigEndian.AppendUint16(buf, m.code)
+	buf = binary.BigEndian.AppendUint32(buf, m.requestID)
+	for _, g := range m.groups {
+		buf = append(buf, g.tag)
+		for _, a := range g.attrs {
+			for i, v := range a.values {
+				name := a.name
+				if i > 0 {
+					name = ""
+				}
+				buf = append(buf, a.tag)
+				buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+				buf = append(buf, name...)
+				buf = binary.BigEndian.AppendUint16(buf, uint16(len(v)))
+				buf = append(buf, v...)
+			}
+		}
+	}
+	return append(buf, ippTagEnd)
+}
+
+// attr returns the first attribute named name in the group with the given tag
+func (m *ippMessage) attr(groupTag byte, name string) *ippAttr {
+	for i := range m.groups {
+		if m.groups[i].tag != groupTag {
+			continue
+		}
+		for j := range m.groups[i].attrs {
+			if m.groups[i].attrs[j].name == name {
+				return &m.groups[i].attrs[j]
+			}
+		}
+	}
+	return nil
+}
+
+// operationString returns the first value of a string operation attribute
+func (m *ippMessage) operationString(name string) string {
+	if a := m.attr(ippTagOperation, name); a != nil && len(a.values) > 0 {
+		return string(a.values[0])
+	}
+	return ""
+}
+
+// operationInt returns the first value of an integer operation attribute
+func (m *ippMessage) operationInt(name string) (int, bool) {
+	if a := m.attr(ippTagOperation, name); a != nil && len(a.values) > 0 && len(a.values[0]) == 4 {
+		return int(int32(binary.BigEndian.Uint32(a.values[0]))), true
+	}
+	return 0, false
+}
+
+func ippStrings(name string, tag byte, values ...string) ippAttr {
+	a := ippAttr{name: name, tag: tag}
+	for _, v := range values {
+		a.values = append(a.values, []byte(v))
+	}
+	return a
+}
+
+func ippInts(name string, tag byte, values ...int) ippAttr {
+	a := ippAttr{name: name, tag: tag}
+	for _, v := range values {
+		a.values = append(a.values, binary.BigEndian.AppendUint32(nil, uint32(int32(v))))
+	}
+	return a
+}
+
+func ippBool(name string, v bool) ippAttr {
+	b := byte(0)
+	if v {
+		b = 1
+	}
+	return ippAttr{name: name, tag: ippTagBoolean, values: [][]byte{{b}}}
+}
+
+func ippRange(name string, lower, upper int) ippAttr {
+	v := binary.BigEndian.AppendUint32(nil, uint32(int32(lower)))
+	v = binary.BigEndian.AppendUint32(v, uint32(int32(upper)))
+	return ippAttr{name: name, tag: ippTagRange, values: [][]byte{v}}
+}
+
+// ippResolution is a resolution in dots per inch
+func ippResolution(name string, dpi int) ippAttr {
+	v := binary.BigEndian.AppendUint32(nil, uint32(dpi))
+	v = binary.BigEndian.AppendUint32(v, uint32(dpi))
+	return ippAttr{name: name, tag: ippTagResolution, values: [][]byte{append(v, 3)}}
+}
@@ -0,0 +1,206 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// ippRequest returns a request with the required operation attributes plus attrs
+func ippRequest(code uint16, attrs ...ippAttr) *ippMessage {
+	return &ippMessage{
+		major:     2,
+		minor:     0,
+		code:      code,
+		requestID: 7,
+		groups: []ippGroup{{tag: ippTagOperation, attrs: append([]ippAttr{
+			ippStrings("attributes-charset", ippTagCharset, "utf-8"),
+			ippStrings("attributes-natural-language", ippTagLanguage, "en"),
+		}, attrs...)}},
+	}
+}
+
+func TestIPPMessageRoundTrip(t *testing.T) {
+	msg := ippRequest(ippPrintJob,
+		ippStrings("document-format", ippTagMimeMediaType, "application/pdf"),
+		ippInts("job-id", ippTagInteger, 42),
+	)
+	msg.groups = append(msg.groups, ippGroup{tag: ippTagPrinter, attrs: []ippAttr{
+		ippStrings("compression-supported", ippTagKeyword, "none", "gzip"),
+		ippBool("color-supported", true),
+		ippRange("copies-supported", 1, 1),
+		ippResolution("printer-resolution-default", 300),
+	}})
+
+	r := bufio.NewReader(bytes.NewReader(append(msg.encode(), "%PDF-1.7"...)))
+	got, err := readIPPMessage(r)
+	if err != nil {
+		t.Fatalf("readIPPMessage: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("round trip mismatch:\n got  %+v\n want %+v", got, msg)
+	}
+	if id, ok := got.operationInt("job-id"); !ok || id != 42 {
+		t.Errorf("job-id = %d %v, want 42", id, ok)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "%PDF-1.7" {
+		t.Errorf("document data = %q, want %%PDF-1.7", rest)
+	}
+}
+
+func TestReadIPPMessageRejectsBadInput(t *testing.T) {
+	var many []ippAttr
+	for i := 0; i <= maxIPPAttributes; i++ {
+		many = append(many, ippStrings("x", ippTagKeyword, "y"))
+	}
+	var large []ippAttr
+	for i := 0; i < 70; i++ {
+		large = append(large, ippStrings("job-name", ippTagName, strings.Repeat("a", 1000)))
+	}
+	encoded := ippRequest(ippPrintJob).encode()
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"truncated header", encoded[:5], errBadIPP},
+		{"missing end tag", encoded[:len(encoded)-1], errBadIPP},
+		{"attribute before group", []byte{2, 0, 0, 2, 0, 0, 0, 1, ippTagKeyword, 0, 1, 'a', 0, 0, ippTagEnd}, errBadIPP},
+		{"too many attributes", ippRequest(ippPrintJob, many...).encode(), errIPPTooLarge},
+		{"attributes too large", ippRequest(ippPrintJob, large...).encode(), errIPPTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := readIPPMessage(bufio.NewReader(bytes.NewReader(tt.data))); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestIPPJobName(t *testing.T) {
+	tests := []struct {
+		document, job, want string
+	}{
+		{"Report.pdf", "", "Report"},
+		{`C:\Users\me\Q3 Report.docx`, "", "Q3 Report"},
+		{"", "Meeting: notes?", "Meeting_ notes_"},
+		{"", "a/b/..", "Print job"},
+	}
+	for _, tt := range tests {
+		req := ippRequest(ippPrintJob,
+			ippStrings("document-name", ippTagName, tt.document),
+			ippStrings("job-name", ippTagName, tt.job),
+		)
+		if got := ippJobName(req); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("ippJobName(%q, %q) = %q, want %q", tt.document, tt.job, got, tt.want)
+		}
+	}
+
+	long := ippJobName(ippRequest(ippPrintJob, ippStrings("job-name", ippTagName, strings.Repeat("é", 150))))
+	if len(long) > maxIPPJobName || !utf8.ValidString(long) {
+		t.Errorf("long name truncated to %d bytes, valid UTF-8 %v", len(long), utf8.ValidString(long))
+	}
+}
+
+// postIPP sends msg followed by doc to s and returns the HTTP response
+func postIPP(t *testing.T, s *IPPServer, msg *ippMessage, doc []byte, user, password string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/ipp/print", bytes.NewReader(append(msg.encode(), doc...)))
+	req.Header.Set("Content-Type", "application/ipp")
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func newTestIPPServer() *IPPServer {
+	return &IPPServer{name: "Aviary", started: time.Now(), nextID: 1}
+}
+
+func TestIPPPrintJob(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	t.Setenv("API_KEY", "")
+	t.Setenv("AUTH_USERNAME", "")
+
+	var enqueued string
+	orig := enqueueLocalFile
+	enqueueLocalFile = func(path string, _ webhook.DocumentRequest, source string, _ uuid.UUID) string {
+		if source != "ipp" {
+			t.Errorf("source = %q, want ipp", source)
+		}
+		enqueued = path
+		return "job-1"
+	}
+	defer func() { enqueueLocalFile = orig }()
+
+	doc := []byte("%PDF-1.7 test")
+	resp := postIPP(t, newTestIPPServer(), ippRequest(ippPrintJob,
+		ippStrings("job-name", ippTagName, "Boarding pass.pdf"),
+	), doc, "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if enqueued == "" {
+		t.Fatal("no job was enqueued")
+	}
+	defer os.RemoveAll(filepath.Dir(enqueued))
+
+	if filepath.Base(enqueued) != "Boarding pass.pdf" {
+		t.Errorf("saved as %q, want Boarding pass.pdf", filepath.Base(enqueued))
+	}
+	if data, _ := os.ReadFile(enqueued); !bytes.Equal(data, doc) {
+		t.Errorf("saved document = %q, want %q", data, doc)
+	}
+
+	out, err := readIPPMessage(bufio.NewReader(resp.Body))
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if out.code != ippOK || out.requestID != 7 {
+		t.Errorf("response status %#x id %d, want %#x id 7", out.code, out.requestID, ippOK)
+	}
+	if out.attr(ippTagJob, "job-id") == nil {
+		t.Error("response has no job-id")
+	}
+}
+
+func TestIPPAuthenticatesBeforeParsing(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	t.Setenv("API_KEY", "secret")
+
+	s := newTestIPPServer()
+	garbage := &ippMessage{major: 2, code: ippGetPrinterAttributes}
+	if resp := postIPP(t, s, garbage, []byte("not ipp"), "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without credentials: status = %d, want 401", resp.StatusCode)
+	}
+	if resp := postIPP(t, s, ippRequest(ippGetPrinterAttributes), nil, "me", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want 401", resp.StatusCode)
+	}
+
+	resp := postIPP(t, s, ippRequest(ippGetPrinterAttributes), nil, "me", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("with credentials: status = %d, want 200", resp.StatusCode)
+	}
+	out, err := readIPPMessage(bufio.NewReader(resp.Body))
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if out.attr(ippTagPrinter, "printer-name") == nil {
+		t.Error("response has no printer attributes")
+	}
+}
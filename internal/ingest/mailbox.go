@@ -0,0 +1,368 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// maxMessagesPerCheck caps how many messages one check ingests, so a full
+// mailbox is worked through over several checks
+const maxMessagesPerCheck = 50
+
+// mailboxConfig is a mailbox to poll: the instance mailbox from IMAP_URL, or
+// a user's own
+type mailboxConfig struct {
+	name        string // For logs
+	addr        string
+	implicitTLS bool
+	username    string
+	password    string
+	folder      string
+	routes      mailRoutes
+	allowed     []string
+	options     webhook.DocumentRequest
+	// owner receives the attachments. The instance mailbox has none in
+	// multi-user mode and matches senders to users by email address instead,
+	// falling back to IMAP_USER.
+	owner    *database.User
+	fallback string
+	// tokenOnly only accepts mail sent to a user's personal address
+	tokenOnly bool
+}
+
+// MailResult summarizes one mailbox check
+type MailResult struct {
+	Messages    int      `json:"messages"`
+	Attachments int      `json:"attachments"`
+	Skipped     int      `json:"skipped"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// MailPoller checks the instance mailbox and every user's enabled mailboxes
+// for emailed documents each IMAP_INTERVAL
+type MailPoller struct {
+	instance *mailboxConfig
+	interval time.Duration
+}
+
+// checking guards against two checks of one mailbox running at once
+var (
+	checkingMu sync.Mutex
+	checking   = make(map[string]bool)
+)
+
+// NewMailPollerFromEnv returns a poller for the mailbox in IMAP_URL, if set,
+// and in multi-user mode for users' mailboxes. It returns nil in single-user
+// mode when IMAP_URL isn't set.
+func NewMailPollerFromEnv() (*MailPoller, error) {
+	p := &MailPoller{interval: config.GetDuration("IMAP_INTERVAL", 2*time.Minute)}
+	if p.interval <= 0 {
+		return nil, nil
+	}
+
+	rawURL := config.Get("IMAP_URL", "")
+	if rawURL == "" {
+		if !database.IsMultiUserMode() {
+			return nil, nil
+		}
+		return p, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMAP_URL: %w", err)
+	}
+	m := &mailboxConfig{name: u.Hostname(), folder: strings.TrimPrefix(u.Path, "/")}
+	switch u.Scheme {
+	case "imaps":
+		m.implicitTLS = true
+		m.addr = hostWithPort(u, "993")
+	case "imap":
+		m.addr = hostWithPort(u, "143")
+	default:
+		return nil, fmt.Errorf("unsupported IMAP_URL scheme %q (use imaps:// or imap://)", u.Scheme)
+	}
+	if u.User == nil {
+		return nil, errors.New("IMAP_URL must include a username and password")
+	}
+	m.username = u.User.Username()
+	m.password, _ = u.User.Password()
+	if m.folder == "" {
+		m.folder = "INBOX"
+	}
+	if m.routes, err = parseMailRoutes(config.Get("IMAP_ROUTES", "")); err != nil {
+		return nil, fmt.Errorf("invalid IMAP_ROUTES: %w", err)
+	}
+	m.allowed = splitSenders(config.Get("IMAP_ALLOWED_SENDERS", ""))
+	m.options = webhook.DocumentRequest{
+		RmDir:    config.Get("IMAP_RM_DIR", ""),
+		Compress: config.Get("IMAP_COMPRESS", ""),
+		Archive:  config.Get("IMAP_ARCHIVE", ""),
+	}
+	m.fallback = config.Get("IMAP_USER", "")
+	if m.fallback != "" && !database.IsMultiUserMode() {
+		return nil, errors.New("IMAP_USER is only used in multi-user mode")
+	}
+	p.instance = m
+	return p, nil
+}
+
+func hostWithPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Start checks the mailboxes in the background until ctx is cancelled
+func (p *MailPoller) Start(ctx context.Context) {
+	if p.instance != nil {
+		logging.Logf("[EMAIL] Checking %s/%s for emailed documents every %s", p.instance.name, p.instance.folder, p.interval)
+	}
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if p.instance != nil {
+				if _, err := checkMailbox(ctx, p.instance); err != nil {
+					logging.Logf("[EMAIL] Check of %s failed: %v", p.instance.name, err)
+				}
+			}
+			if database.IsMultiUserMode() && !maintenance.Enabled() {
+				checkUserMailboxes(ctx)
+			}
+		}
+	}()
+}
+
+func checkUserMailboxes(ctx context.Context) {
+	var mailboxes []database.Mailbox
+	if err := database.DB.Where("enabled = ?", true).Find(&mailboxes).Error; err != nil {
+		logging.Logf("[EMAIL] Failed to load mailboxes: %v", err)
+		return
+	}
+	for i := range mailboxes {
+		if _, err := CheckMailbox(ctx, &mailboxes[i]); err != nil {
+			logging.Logf("[EMAIL] Check of mailbox %s failed: %v", mailboxes[i].ID, err)
+		}
+	}
+}
+
+// CheckMailbox ingests the unseen messages in one of a user's mailboxes and
+// records the outcome on it
+func CheckMailbox(ctx context.Context, mb *database.Mailbox) (*MailResult, error) {
+	user, err := database.NewUserService(database.DB).GetUserByID(mb.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, errors.New("user is inactive")
+	}
+	routes, err := parseMailRoutes(mb.Routes)
+	if err != nil {
+		return nil, err
+	}
+	m := &mailboxConfig{
+		name:        mb.ID.String(),
+		addr:        net.JoinHostPort(mb.Host, strconv.Itoa(mb.Port)),
+		implicitTLS: mb.Security != "starttls",
+		username:    mb.Username,
+		password:    mb.Password,
+		folder:      mb.Folder,
+		routes:      routes,
+		allowed:     splitSenders(mb.AllowedSenders),
+		options:     webhook.DocumentRequest{RmDir: mb.RmDir},
+		owner:       user,
+	}
+
+	result, err := checkMailbox(ctx, m)
+
+	now := time.Now()
+	updates := map[string]interface{}{"last_check_at": now, "last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else if len(result.Errors) > 0 {
+		updates["last_error"] = strings.Join(result.Errors, "; ")
+	}
+	if dbErr := database.DB.Model(&database.Mailbox{}).Where("id = ?", mb.ID).Updates(updates).Error; dbErr != nil {
+		logging.Logf("[EMAIL] Failed to save mailbox %s: %v", mb.ID, dbErr)
+	}
+	mb.LastCheckAt = &now
+	return result, err
+}
+
+// checkMailbox logs in to m, ingests the attachments of its unseen messages
+// and marks them seen. Messages that fail to download stay unseen and are
+// tried again on the next check.
+func checkMailbox(ctx context.Context, m *mailboxConfig) (*MailResult, error) {
+	checkingMu.Lock()
+	if checking[m.name] {
+		checkingMu.Unlock()
+		return nil, errors.New("mailbox is already being checked")
+	}
+	checking[m.name] = true
+	checkingMu.Unlock()
+	defer func() {
+		checkingMu.Lock()
+		delete(checking, m.name)
+		checkingMu.Unlock()
+	}()
+
+	// Messages are left unseen until maintenance mode is turned off
+	if maintenance.Enabled() {
+		return nil, errors.New("maintenance mode: not accepting new jobs")
+	}
+
+	// A message can hold a few attachments of the maximum upload size
+	maxSize := webhook.MaxUploadSize() * 2
+	client, err := dialIMAP(ctx, m.addr, m.implicitTLS, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", m.addr, err)
+	}
+	defer client.Close()
+	if err := client.Login(m.username, m.password); err != nil {
+		return nil, err
+	}
+	if err := client.Select(m.folder); err != nil {
+		return nil, err
+	}
+	uids, err := client.SearchUnseen()
+	if err != nil {
+		return nil, err
+	}
+	if len(uids) > maxMessagesPerCheck {
+		uids = uids[:maxMessagesPerCheck]
+	}
+
+	result := &MailResult{}
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			break
+		}
+		size, err := client.Size(uid)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		if size > maxSize {
+			logging.Logf("[EMAIL] Skipping %d byte message %d in %s: too large", size, uid, m.name)
+			result.Skipped++
+			client.MarkSeen(uid)
+			continue
+		}
+		raw, err := client.Fetch(uid)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Messages++
+		n, err := ingestEmail(m, raw)
+		if err != nil {
+			logging.Logf("[EMAIL] Skipping message %d in %s: %v", uid, m.name, err)
+			result.Skipped++
+		}
+		result.Attachments += n
+		if err := client.MarkSeen(uid); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// ingestEmail starts a job for each attachment of a raw message and returns
+// how many were started
+func ingestEmail(m *mailboxConfig, raw []byte) (int, error) {
+	e, err := parseEmail(raw)
+	if err != nil {
+		return 0, err
+	}
+	if !senderAllowed(m.allowed, e.From) {
+		return 0, fmt.Errorf("sender %s is not allowed", e.From)
+	}
+	if len(e.Attachments) == 0 {
+		return 0, nil
+	}
+
+	user := m.owner
+	if user == nil && database.IsMultiUserMode() {
+		// A personal address names the user, whoever sent the mail
+		user = userByInboundToken(e.Recipients)
+		if user == nil && m.tokenOnly {
+			return 0, errors.New("not sent to a personal address")
+		}
+		if user == nil {
+			user = userByEmail(e.From)
+		}
+		if user == nil && m.fallback != "" {
+			user = activeUser(m.fallback)
+		}
+		if user == nil {
+			return 0, fmt.Errorf("no user has the address %s", e.From)
+		}
+	}
+	userID := uuid.Nil
+	if user != nil {
+		userID = user.ID
+	}
+
+	options := m.options
+	if dir, ok := m.routes.match(e.From); ok {
+		options.RmDir = dir
+	}
+
+	started := 0
+	for _, a := range e.Attachments {
+		if int64(len(a.Data)) > webhook.MaxUploadSize() {
+			logging.Logf("[EMAIL] Skipping %s from %s: larger than the upload limit", a.Filename, e.From)
+			continue
+		}
+		// The pipeline removes the file once the job finishes
+		tempDir, err := manager.CreateUserTempDir(userID)
+		if err != nil {
+			return started, err
+		}
+		path := filepath.Join(tempDir, a.Filename)
+		if err := os.WriteFile(path, a.Data, 0600); err != nil {
+			os.RemoveAll(tempDir)
+			return started, err
+		}
+		id := webhook.EnqueueLocalFile(path, options, "email", userID)
+		started++
+		if user != nil {
+			logging.LogfWithUser(user.Username, "[EMAIL] Enqueued job %s for %s from %s", id, a.Filename, e.From)
+		} else {
+			logging.Logf("[EMAIL] Enqueued job %s for %s from %s", id, a.Filename, e.From)
+		}
+	}
+	return started, nil
+}
+
+// userByEmail returns the active user whose account address is addr
+func userByEmail(addr string) *database.User {
+	var user database.User
+	if err := database.DB.Where("LOWER(email) = ? AND is_active = ?", addr, true).First(&user).Error; err != nil {
+		return nil
+	}
+	return &user
+}
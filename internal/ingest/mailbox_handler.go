@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// maxMailboxes caps how many mailboxes a user can add
+const maxMailboxes = 5
+
+// MailboxRequest creates or updates a mailbox
+type MailboxRequest struct {
+	Host           string `json:"host" binding:"required"`
+	Port           int    `json:"port"`
+	Security       string `json:"security"`
+	Username       string `json:"username" binding:"required"`
+	Password       string `json:"password"` // Required when creating; empty keeps the saved one
+	Folder         string `json:"folder"`
+	RmDir          string `json:"rm_dir"`
+	Routes         string `json:"routes"`
+	AllowedSenders string `json:"allowed_senders"`
+	Enabled        *bool  `json:"enabled"`
+}
+
+// apply validates req and copies it onto m
+func (req MailboxRequest) apply(m *database.Mailbox) error {
+	m.Host = strings.TrimSpace(req.Host)
+	// The server connects to the host, so it's held to the same rules as
+	// URLs users give it
+	if err := security.ValidateURL("https://" + m.Host); err != nil || strings.ContainsAny(m.Host, "/:@") {
+		return fmt.Errorf("invalid host %q", m.Host)
+	}
+	m.Security = strings.ToLower(strings.TrimSpace(req.Security))
+	switch m.Security {
+	case "":
+		m.Security = "tls"
+	case "tls", "starttls":
+	default:
+		return fmt.Errorf("security must be tls or starttls")
+	}
+	m.Port = req.Port
+	if m.Port == 0 {
+		m.Port = 993
+		if m.Security == "starttls" {
+			m.Port = 143
+		}
+	}
+	if m.Port < 1 || m.Port > 65535 {
+		return fmt.Errorf("invalid port %d", m.Port)
+	}
+	m.Username = strings.TrimSpace(req.Username)
+	if req.Password != "" {
+		m.Password = req.Password
+	}
+	if m.Password == "" {
+		return fmt.Errorf("password is required")
+	}
+	m.Folder = strings.TrimSpace(req.Folder)
+	if m.Folder == "" {
+		m.Folder = "INBOX"
+	}
+	m.RmDir = ""
+	if dir := strings.TrimSpace(req.RmDir); dir != "" {
+		m.RmDir = path.Clean("/" + dir)
+	}
+	if _, err := parseMailRoutes(req.Routes); err != nil {
+		return err
+	}
+	m.Routes = strings.TrimSpace(req.Routes)
+	m.AllowedSenders = strings.Join(splitSenders(req.AllowedSenders), ",")
+	if req.Enabled != nil {
+		m.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// getMailbox loads one of the current user's mailboxes, responding 404 if it
+// doesn't exist
+func getMailbox(c *gin.Context, userID uuid.UUID) (*database.Mailbox, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mailbox ID"})
+		return nil, false
+	}
+	var m database.Mailbox
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&m).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mailbox not found"})
+		return nil, false
+	}
+	return &m, true
+}
+
+// ListMailboxesHandler lists the current user's mailboxes
+func ListMailboxesHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mailboxes not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var mailboxes []database.Mailbox
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&mailboxes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get mailboxes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mailboxes": mailboxes})
+}
+
+// CreateMailboxHandler adds a mailbox for the current user. Only messages
+// that arrive unseen are ingested, so mail already read is left alone.
+func CreateMailboxHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mailboxes not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var req MailboxRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Host and username are required"})
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&database.Mailbox{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create mailbox"})
+		return
+	}
+	if count >= maxMailboxes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many mailboxes"})
+		return
+	}
+
+	m := database.Mailbox{UserID: user.ID, Enabled: true}
+	if err := req.apply(&m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create mailbox"})
+		return
+	}
+
+	logging.Logf("[EMAIL] User %s added mailbox %s@%s", user.Username, m.Username, m.Host)
+	c.JSON(http.StatusCreated, m)
+}
+
+// UpdateMailboxHandler replaces one of the current user's mailboxes
+func UpdateMailboxHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mailboxes not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	m, ok := getMailbox(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req MailboxRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Host and username are required"})
+		return
+	}
+	// The saved password only carries over to the same account
+	if !strings.EqualFold(strings.TrimSpace(req.Host), m.Host) || strings.TrimSpace(req.Username) != m.Username {
+		m.Password = ""
+	}
+	if err := req.apply(m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Save(m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mailbox"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// DeleteMailboxHandler removes one of the current user's mailboxes
+func DeleteMailboxHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mailboxes not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	m, ok := getMailbox(c, user.ID)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete mailbox"})
+		return
+	}
+
+	logging.Logf("[EMAIL] User %s removed mailbox %s@%s", user.Username, m.Username, m.Host)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// CheckMailboxHandler checks one of the current user's mailboxes now and
+// reports what was ingested
+func CheckMailboxHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mailboxes not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	m, ok := getMailbox(c, user.ID)
+	if !ok {
+		return
+	}
+
+	result, err := CheckMailbox(c.Request.Context(), m)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": len(result.Errors) == 0, "result": result, "mailbox": m})
+}
@@ -0,0 +1,314 @@
+// Package ingest provides ingestion interfaces other than the HTTP webhook.
+// Every interface hands requests to the webhook job pipeline, so jobs are
+// tracked in the same status store and can be polled via /api/status/:id.
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+const (
+	defaultNATSSubject    = "aviary.documents"
+	defaultNATSQueueGroup = "aviary"
+	natsDialTimeout       = 10 * time.Second
+	natsMaxBackoff        = 30 * time.Second
+)
+
+// Message is the payload accepted on the NATS subject: a webhook DocumentRequest
+// plus the API key identifying the user in multi-user mode.
+type Message struct {
+	webhook.DocumentRequest
+	APIKey string `json:"api_key"`
+}
+
+// Reply is published to the message's reply subject, if it has one
+type Reply struct {
+	JobID string `json:"jobId,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// enqueueDocumentRequest hands a message's request to the job pipeline. Tests
+// replace it to keep jobs from running.
+var enqueueDocumentRequest = webhook.EnqueueDocumentRequest
+
+// natsInfo holds the fields of the server INFO message that the consumer uses
+type natsInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// NATSConsumer subscribes to a NATS subject and enqueues each message as a job
+type NATSConsumer struct {
+	serverURL  *url.URL
+	subject    string
+	queueGroup string
+}
+
+// NewNATSConsumerFromEnv returns a consumer configured from NATS_URL, NATS_SUBJECT
+// and NATS_QUEUE_GROUP, or nil when NATS_URL is not set.
+func NewNATSConsumerFromEnv() (*NATSConsumer, error) {
+	rawURL := config.Get("NATS_URL", "")
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS_URL: %w", err)
+	}
+	switch u.Scheme {
+	case "nats", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported NATS_URL scheme %q (use nats:// or tls://)", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATSConsumer{
+		serverURL:  u,
+		subject:    config.Get("NATS_SUBJECT", defaultNATSSubject),
+		queueGroup: config.Get("NATS_QUEUE_GROUP", defaultNATSQueueGroup),
+	}, nil
+}
+
+// Start runs the consumer in the background, reconnecting with backoff until ctx is cancelled
+func (n *NATSConsumer) Start(ctx context.Context) {
+	go func() {
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := n.run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > natsMaxBackoff {
+				backoff = time.Second
+			}
+			logging.Logf("[NATS] Connection to %s lost: %v (reconnecting in %s)", n.serverURL.Host, err, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > natsMaxBackoff {
+				backoff = natsMaxBackoff
+			}
+		}
+	}()
+}
+
+// run holds a single connection open, processing messages until it fails
+func (n *NATSConsumer) run(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: natsDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.serverURL.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	line, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("invalid INFO: %w", err)
+	}
+
+	var rw net.Conn = conn
+	if info.TLSRequired || n.serverURL.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: n.serverURL.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		rw = tlsConn
+		reader = bufio.NewReader(tlsConn)
+	}
+
+	if err := n.handshake(rw); err != nil {
+		return err
+	}
+	logging.Logf("[NATS] Subscribed to %s (queue group %s) on %s", n.subject, n.queueGroup, n.serverURL.Host)
+
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(rw, "PONG\r\n"); err != nil {
+				return err
+			}
+		case line == "PONG", line == "+OK", strings.HasPrefix(line, "INFO "):
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case strings.HasPrefix(line, "MSG "):
+			replyTo, payload, err := readMsg(reader, line, info.MaxPayload)
+			if err != nil {
+				return err
+			}
+			reply := n.handle(payload)
+			if replyTo != "" {
+				if err := publish(rw, replyTo, reply); err != nil {
+					return err
+				}
+			}
+		default:
+			logging.Logf("[NATS] Ignoring unexpected protocol line %q", line)
+		}
+	}
+}
+
+// handshake sends CONNECT with any credentials from the URL, then subscribes
+func (n *NATSConsumer) handshake(w io.Writer) error {
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "aviary",
+		"lang":     "go",
+		"protocol": 0,
+	}
+	if user := n.serverURL.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			connect["user"] = user.Username()
+			connect["pass"] = pass
+		} else {
+			connect["auth_token"] = user.Username()
+		}
+	}
+	payload, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "CONNECT %s\r\nSUB %s %s 1\r\nPING\r\n", payload, n.subject, n.queueGroup)
+	return err
+}
+
+// handle authenticates and enqueues a single message
+func (n *NATSConsumer) handle(payload []byte) Reply {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		logging.Logf("[NATS] Rejected message: invalid JSON: %v", err)
+		return Reply{Error: "invalid JSON payload"}
+	}
+
+	userID, err := authenticate(msg.APIKey, n.subject)
+	if err != nil {
+		logging.Logf("[NATS] Rejected message: %v", err)
+		return Reply{Error: err.Error()}
+	}
+
+	if strings.TrimSpace(msg.Body) == "" {
+		return Reply{Error: "body is required"}
+	}
+
+	if maintenance.Enabled() {
+		logging.Logf("[NATS] Rejected message: maintenance mode is on")
+		return Reply{Error: "maintenance mode: not accepting new jobs"}
+	}
+
+	id := enqueueDocumentRequest(msg.DocumentRequest, userID)
+	logging.Logf("[NATS] Enqueued job %s from %s", id, n.subject)
+	return Reply{JobID: id}
+}
+
+// authenticate resolves the API key to a user in multi-user mode, or checks it
+// against API_KEY in single-user mode when one is configured
+func authenticate(apiKey, subject string) (uuid.UUID, error) {
+	if !database.IsMultiUserMode() {
+		envKey := config.Get("API_KEY", "")
+		if envKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(envKey)) != 1 {
+			return uuid.Nil, errors.New("invalid API key")
+		}
+		return uuid.Nil, nil
+	}
+
+	if apiKey == "" {
+		return uuid.Nil, errors.New("api_key is required in multi-user mode")
+	}
+	apiKeyService := database.NewAPIKeyService(database.DB)
+	user, key, err := apiKeyService.AuthenticateAPIKey(apiKey)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid API key")
+	}
+	if err := apiKeyService.RecordAPIKeyUsage(key.ID, "nats", "NATS "+subject); err != nil {
+		logging.Logf("[WARNING] Failed to record API key usage for %s: %v", key.ID, err)
+	}
+	return user.ID, nil
+}
+
+// readLine reads a single CRLF-terminated protocol line
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readMsg parses "MSG <subject> <sid> [reply-to] <#bytes>" and reads the payload
+func readMsg(r *bufio.Reader, line string, maxPayload int64) (string, []byte, error) {
+	fields := strings.Fields(line)
+	var replyTo, sizeField string
+	switch len(fields) {
+	case 4:
+		sizeField = fields[3]
+	case 5:
+		replyTo, sizeField = fields[3], fields[4]
+	default:
+		return "", nil, fmt.Errorf("malformed MSG line %q", line)
+	}
+	size, err := strconv.ParseInt(sizeField, 10, 64)
+	if err != nil || size < 0 || (maxPayload > 0 && size > maxPayload) {
+		return "", nil, fmt.Errorf("invalid MSG size %q", sizeField)
+	}
+
+	payload := make([]byte, size+2) // payload is followed by CRLF
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+	return replyTo, payload[:size], nil
+}
+
+// publish sends v as JSON to subject
+func publish(w io.Writer, subject string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload)
+	return err
+}
@@ -0,0 +1,190 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// fakeNATS is the server side of one consumer connection
+type fakeNATS struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// expect reads the next protocol line and checks it starts with prefix
+func (f *fakeNATS) expect(prefix string) string {
+	f.t.Helper()
+	f.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := readLine(f.reader)
+	if err != nil {
+		f.t.Fatalf("waiting for %s: %v", prefix, err)
+	}
+	if !strings.HasPrefix(line, prefix) {
+		f.t.Fatalf("got %q, want %s", line, prefix)
+	}
+	return line
+}
+
+func (f *fakeNATS) send(format string, args ...interface{}) {
+	f.t.Helper()
+	if _, err := fmt.Fprintf(f.conn, format, args...); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// startNATS runs a consumer against an in-process server, with credentials
+// ("user:pass@" or "token@") in its URL, and returns the server side once the
+// consumer has connected
+func startNATS(t *testing.T, credentials string) (*fakeNATS, *NATSConsumer) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	u, _ := url.Parse("nats://" + credentials + listener.Addr().String())
+	n := &NATSConsumer{serverURL: u, subject: "aviary.documents", queueGroup: "aviary"}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- n.run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Error("consumer didn't stop when cancelled")
+		}
+	})
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &fakeNATS{t: t, conn: conn, reader: bufio.NewReader(conn)}, n
+}
+
+func TestNATSHandshake(t *testing.T) {
+	f, _ := startNATS(t, "scanner:s3cret@")
+	f.send("INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+
+	line := f.expect("CONNECT ")
+	var connect map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &connect); err != nil {
+		t.Fatalf("CONNECT payload: %v", err)
+	}
+	if connect["user"] != "scanner" || connect["pass"] != "s3cret" || connect["verbose"] != false {
+		t.Errorf("CONNECT = %v, want user scanner with password, not verbose", connect)
+	}
+	if sub := f.expect("SUB "); sub != "SUB aviary.documents aviary 1" {
+		t.Errorf("SUB line = %q", sub)
+	}
+	f.expect("PING")
+	f.send("PONG\r\n")
+
+	// The server checks the client is alive
+	f.send("PING\r\n")
+	f.expect("PONG")
+}
+
+func TestNATSTokenAuth(t *testing.T) {
+	f, _ := startNATS(t, "t0ken@")
+	f.send("INFO {}\r\n")
+	line := f.expect("CONNECT ")
+	if !strings.Contains(line, `"auth_token":"t0ken"`) || strings.Contains(line, `"pass"`) {
+		t.Errorf("CONNECT = %q, want only the auth token", line)
+	}
+}
+
+func TestNATSMessages(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	t.Setenv("API_KEY", "key")
+
+	var got []webhook.DocumentRequest
+	orig := enqueueDocumentRequest
+	enqueueDocumentRequest = func(req webhook.DocumentRequest, _ uuid.UUID) string {
+		got = append(got, req)
+		return "job-1"
+	}
+	defer func() { enqueueDocumentRequest = orig }()
+
+	f, _ := startNATS(t, "")
+	f.send("INFO {\"max_payload\":1024}\r\n")
+	f.expect("CONNECT ")
+	f.expect("SUB ")
+	f.expect("PING")
+
+	replies := []struct {
+		payload string
+		want    Reply
+	}{
+		{`{"Body":"https://example.com/a.pdf","prefix":"Scan","api_key":"key"}`, Reply{JobID: "job-1"}},
+		{`{"Body":"https://example.com/a.pdf","api_key":"wrong"}`, Reply{Error: "invalid API key"}},
+		{`{"Body":"","api_key":"key"}`, Reply{Error: "body is required"}},
+		{`not json`, Reply{Error: "invalid JSON payload"}},
+	}
+	for i, r := range replies {
+		inbox := fmt.Sprintf("_INBOX.%d", i)
+		f.send("MSG aviary.documents 1 %s %d\r\n%s\r\n", inbox, len(r.payload), r.payload)
+
+		pub := f.expect("PUB " + inbox + " ")
+		var size int
+		fmt.Sscanf(strings.TrimPrefix(pub, "PUB "+inbox+" "), "%d", &size)
+		body := make([]byte, size+2)
+		if _, err := io.ReadFull(f.reader, body); err != nil {
+			t.Fatal(err)
+		}
+		var reply Reply
+		if err := json.Unmarshal(body[:size], &reply); err != nil {
+			t.Fatalf("reply %q: %v", body, err)
+		}
+		if reply != r.want {
+			t.Errorf("reply to %s = %+v, want %+v", r.payload, reply, r.want)
+		}
+	}
+
+	// A message without a reply subject is still handled
+	payload := `{"Body":"https://example.com/b.pdf","api_key":"key"}`
+	f.send("MSG aviary.documents 1 %d\r\n%s\r\nPING\r\n", len(payload), payload)
+	f.expect("PONG")
+
+	if len(got) != 2 || got[0].Body != "https://example.com/a.pdf" || got[0].Prefix != "Scan" || got[1].Body != "https://example.com/b.pdf" {
+		t.Errorf("enqueued %+v", got)
+	}
+}
+
+func TestReadMsg(t *testing.T) {
+	tests := []struct {
+		line, data string
+		max        int64
+		reply      string
+		payload    string
+		ok         bool
+	}{
+		{"MSG s 1 5", "hello\r\n", 0, "", "hello", true},
+		{"MSG s 1 _INBOX.x 2", "hi\r\n", 0, "_INBOX.x", "hi", true},
+		{"MSG s 1 5", "hello\r\n", 4, "", "", false},
+		{"MSG s 1 -1", "\r\n", 0, "", "", false},
+		{"MSG s", "", 0, "", "", false},
+		{"MSG s 1 10", "short\r\n", 0, "", "", false},
+	}
+	for _, tt := range tests {
+		reply, payload, err := readMsg(bufio.NewReader(strings.NewReader(tt.data)), tt.line, tt.max)
+		if (err == nil) != tt.ok || reply != tt.reply || string(payload) != tt.payload {
+			t.Errorf("readMsg(%q) = %q %q %v, want %q %q ok=%v", tt.line, reply, payload, err, tt.reply, tt.payload, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpUserKey is the permissions extension holding the authenticated user's ID
+const sftpUserKey = "aviary-user-id"
+
+// SFTPServer is an embedded SFTP server that accepts documents from scanners
+// and other systems that can only deliver files over SFTP. Each uploaded file
+// becomes a job, like a file uploaded through the web UI.
+type SFTPServer struct {
+	addr   string
+	config *ssh.ServerConfig
+}
+
+// NewSFTPServerFromEnv returns a server configured from SFTP_LISTEN and
+// SFTP_HOST_KEY, or nil when SFTP_LISTEN is not set
+func NewSFTPServerFromEnv() (*SFTPServer, error) {
+	addr := config.Get("SFTP_LISTEN", "")
+	if addr == "" {
+		return nil, nil
+	}
+	if !database.IsMultiUserMode() && !singleUserAuthConfigured() {
+		return nil, errors.New("SFTP needs API_KEY or AUTH_USERNAME and AUTH_PASSWORD in single-user mode")
+	}
+
+	signer, err := loadHostKey(config.Get("SFTP_HOST_KEY", filepath.Join(config.Get("DATA_DIR", "/data"), "sftp_host_key")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SFTP host key: %w", err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			host, _, _ := net.SplitHostPort(meta.RemoteAddr().String())
+			if !auth.AllowLogin(host) {
+				logging.Logf("[SFTP] Too many login attempts from %s", host)
+				return nil, errors.New("too many login attempts")
+			}
+			userID, err := authenticatePassword(meta.User(), string(password), host, "SFTP")
+			if err != nil {
+				logging.Logf("[SFTP] Rejected login for %s from %s: %v", meta.User(), meta.RemoteAddr(), err)
+				return nil, err
+			}
+			return &ssh.Permissions{Extensions: map[string]string{sftpUserKey: userID.String()}}, nil
+		},
+		MaxAuthTries: 3,
+	}
+	cfg.AddHostKey(signer)
+	return &SFTPServer{addr: addr, config: cfg}, nil
+}
+
+// loadHostKey reads the server's private key, generating an Ed25519 key on
+// first start so clients see the same host key across restarts
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, key, genErr := ed25519.GenerateKey(rand.Reader)
+		if genErr != nil {
+			return nil, genErr
+		}
+		block, genErr := ssh.MarshalPrivateKey(key, "aviary sftp")
+		if genErr != nil {
+			return nil, genErr
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		logging.Logf("[SFTP] Generated host key %s", path)
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// Start listens in the background until ctx is cancelled
+func (s *SFTPServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	logging.Logf("[SFTP] Listening on %s", listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logging.Logf("[SFTP] Accept failed: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			go s.serveConn(conn)
+		}
+	}()
+	return nil
+}
+
+// serveConn completes the SSH handshake and serves sftp subsystem requests
+func (s *SFTPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	userID, _ := uuid.Parse(sshConn.Permissions.Extensions[sftpUserKey])
+	var user *database.User
+	if database.IsMultiUserMode() {
+		if user, err = database.NewUserService(database.DB).GetUserByID(userID); err != nil {
+			return
+		}
+	}
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				// Only the sftp subsystem is offered; no shell or exec
+				isSFTP := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(isSFTP, nil)
+				if isSFTP {
+					newSFTPSession(channel, userID, user).serve()
+					return
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,529 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// SFTP version 3 packet types and status codes (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpName     = 104
+	fxpAttrs    = 105
+
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+
+	fxfWrite = 0x02
+
+	attrSize        = 0x01
+	attrPermissions = 0x04
+
+	// maxSFTPPacket bounds a single request; clients write in chunks of 32-256 KiB
+	maxSFTPPacket = 1 << 20
+)
+
+// sftpExts are the file types delivered when uploaded over SFTP
+var sftpExts = map[string]bool{".pdf": true, ".epub": true, ".jpg": true, ".jpeg": true, ".png": true}
+
+var errBadPacket = errors.New("malformed sftp packet")
+
+// sftpHandle is an open file being uploaded, or a directory being listed
+type sftpHandle struct {
+	path    string
+	file    *os.File
+	dir     bool
+	listed  bool
+	size    int64
+	tempDir string
+}
+
+// sftpSession serves one client's sftp subsystem. The tree it shows is
+// virtual and write-only: directories map to reMarkable folders, and each
+// file uploaded into one is delivered there once it's closed.
+type sftpSession struct {
+	rw      io.ReadWriter
+	userID  uuid.UUID
+	user    *database.User
+	handles map[string]*sftpHandle
+	nextID  int
+	dirs    map[string]bool
+	// held are uploads closed under a name that isn't delivered, such as
+	// WinSCP's "name.pdf.filepart", waiting to be renamed
+	held map[string]*sftpHandle
+}
+
+func newSFTPSession(rw io.ReadWriter, userID uuid.UUID, user *database.User) *sftpSession {
+	return &sftpSession{
+		rw:      rw,
+		userID:  userID,
+		user:    user,
+		handles: make(map[string]*sftpHandle),
+		dirs:    map[string]bool{"/": true},
+		held:    make(map[string]*sftpHandle),
+	}
+}
+
+// serve handles requests until the client disconnects, then discards any
+// unfinished uploads
+func (s *sftpSession) serve() {
+	defer func() {
+		for _, h := range s.handles {
+			s.discard(h)
+		}
+		for _, h := range s.held {
+			s.discard(h)
+		}
+	}()
+
+	for {
+		var length uint32
+		if err := binary.Read(s.rw, binary.BigEndian, &length); err != nil {
+			return
+		}
+		if length == 0 || length > maxSFTPPacket {
+			return
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(s.rw, packet); err != nil {
+			return
+		}
+		if err := s.handle(packet[0], &sftpReader{buf: packet[1:]}); err != nil {
+			logging.Logf("[SFTP] Closing session: %v", err)
+			return
+		}
+	}
+}
+
+func (s *sftpSession) handle(kind byte, r *sftpReader) error {
+	if kind == fxpInit {
+		return s.send(fxpVersion, uint32(3))
+	}
+	id, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case fxpRealpath:
+		p, err := r.string()
+		if err != nil {
+			return err
+		}
+		p = cleanSFTPPath(p)
+		return s.send(fxpName, id, uint32(1), p, p, s.attrs(p))
+
+	case fxpStat, fxpLstat:
+		p, err := r.string()
+		if err != nil {
+			return err
+		}
+		return s.stat(id, cleanSFTPPath(p))
+
+	case fxpFstat:
+		h, err := s.handleArg(r)
+		if err != nil {
+			return s.status(id, fxFailure, err.Error())
+		}
+		return s.send(fxpAttrs, id, s.attrs(h.path))
+
+	case fxpOpendir:
+		p, err := r.string()
+		if err != nil {
+			return err
+		}
+		p = cleanSFTPPath(p)
+		if !s.isDir(p) {
+			return s.status(id, fxNoSuchFile, "no such directory")
+		}
+		return s.send(fxpHandle, id, s.newHandle(&sftpHandle{path: p, dir: true}))
+
+	case fxpReaddir:
+		// Uploads are delivered, not stored, so every directory is empty
+		h, err := s.handleArg(r)
+		if err != nil || !h.dir {
+			return s.status(id, fxFailure, "invalid handle")
+		}
+		if h.listed {
+			return s.status(id, fxEOF, "")
+		}
+		h.listed = true
+		return s.send(fxpName, id, uint32(2), ".", ".", s.attrs(h.path), "..", "..", s.attrs(path.Dir(h.path)))
+
+	case fxpOpen:
+		p, err := r.string()
+		if err != nil {
+			return err
+		}
+		flags, err := r.uint32()
+		if err != nil {
+			return err
+		}
+		return s.open(id, cleanSFTPPath(p), flags)
+
+	case fxpWrite:
+		return s.write(id, r)
+
+	case fxpRead:
+		return s.status(id, fxPermissionDenied, "uploads only")
+
+	case fxpClose:
+		hid, err := r.string()
+		if err != nil {
+			return err
+		}
+		return s.close(id, hid)
+
+	case fxpRename:
+		from, err := r.string()
+		if err != nil {
+			return err
+		}
+		to, err := r.string()
+		if err != nil {
+			return err
+		}
+		return s.rename(id, cleanSFTPPath(from), cleanSFTPPath(to))
+
+	case fxpRemove:
+		p, err := r.string()
+		if err != nil {
+			return err
+		}
+		p = cleanSFTPPath(p)
+		if h, ok := s.held[p]; ok {
+			s.discard(h)
+			delete(s.held, p)
+			return s.status(id, fxOK, "")
+		}
+		return s.status(id, fxNoSuchFile, "no such file")
+
+	case fxpMkdir:
+		p, err := r.string()
+		if err != nil {
+			return err
+		}
+		s.dirs[cleanSFTPPath(p)] = true
+		return s.status(id, fxOK, "")
+
+	case fxpRmdir, fxpSetstat, fxpFsetstat:
+		// Accepted and ignored, so clients that preserve times don't fail
+		return s.status(id, fxOK, "")
+	}
+	return s.status(id, fxOpUnsupported, "operation not supported")
+}
+
+// isDir reports whether p is a directory: the root, one the client made, or
+// any path without a file extension, which names a reMarkable folder
+func (s *sftpSession) isDir(p string) bool {
+	return s.dirs[p] || path.Ext(p) == ""
+}
+
+func (s *sftpSession) stat(id uint32, p string) error {
+	if !s.isDir(p) && s.held[p] == nil && s.openFile(p) == nil {
+		return s.status(id, fxNoSuchFile, "no such file")
+	}
+	return s.send(fxpAttrs, id, s.attrs(p))
+}
+
+func (s *sftpSession) openFile(p string) *sftpHandle {
+	for _, h := range s.handles {
+		if !h.dir && h.path == p {
+			return h
+		}
+	}
+	return nil
+}
+
+// attrs returns the attributes shown for p
+func (s *sftpSession) attrs(p string) sftpAttrs {
+	if s.isDir(p) {
+		return sftpAttrs{mode: 0o40755}
+	}
+	a := sftpAttrs{mode: 0o100644}
+	if h := s.held[p]; h != nil {
+		a.size = h.size
+	} else if h := s.openFile(p); h != nil {
+		a.size = h.size
+	}
+	return a
+}
+
+func (s *sftpSession) open(id uint32, p string, flags uint32) error {
+	if flags&fxfWrite == 0 {
+		return s.status(id, fxPermissionDenied, "uploads only")
+	}
+	if s.isDir(p) {
+		return s.status(id, fxFailure, "is a directory")
+	}
+	if maintenance.Enabled() {
+		return s.status(id, fxFailure, "maintenance mode: not accepting new jobs")
+	}
+
+	// Each upload gets its own directory, so the file keeps its name
+	tempDir, err := manager.CreateUserTempDir(s.userID)
+	if err != nil {
+		return s.status(id, fxFailure, "failed to create upload")
+	}
+	file, err := os.Create(filepath.Join(tempDir, path.Base(p)))
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return s.status(id, fxFailure, "failed to create upload")
+	}
+	return s.send(fxpHandle, id, s.newHandle(&sftpHandle{path: p, file: file, tempDir: tempDir}))
+}
+
+func (s *sftpSession) write(id uint32, r *sftpReader) error {
+	h, err := s.handleArg(r)
+	if err != nil || h.file == nil {
+		return s.status(id, fxFailure, "invalid handle")
+	}
+	offset, err := r.uint64()
+	if err != nil {
+		return err
+	}
+	data, err := r.bytes()
+	if err != nil {
+		return err
+	}
+	// Checked before adding, so a huge offset can't wrap around
+	if offset > math.MaxInt64 || int64(offset) > webhook.MaxUploadSize()-int64(len(data)) {
+		return s.status(id, fxFailure, "file too large")
+	}
+	end := int64(offset) + int64(len(data))
+	if _, err := h.file.WriteAt(data, int64(offset)); err != nil {
+		return s.status(id, fxFailure, "write failed")
+	}
+	if end > h.size {
+		h.size = end
+	}
+	return s.status(id, fxOK, "")
+}
+
+func (s *sftpSession) close(id uint32, hid string) error {
+	h, ok := s.handles[hid]
+	if !ok {
+		return s.status(id, fxFailure, "invalid handle")
+	}
+	delete(s.handles, hid)
+	if h.dir {
+		return s.status(id, fxOK, "")
+	}
+	if err := h.file.Close(); err != nil {
+		s.discard(h)
+		return s.status(id, fxFailure, "write failed")
+	}
+	h.file = nil
+
+	if !sftpExts[strings.ToLower(path.Ext(h.path))] {
+		if prev, ok := s.held[h.path]; ok {
+			s.discard(prev)
+		}
+		s.held[h.path] = h
+		return s.status(id, fxOK, "")
+	}
+	if err := s.deliver(h); err != nil {
+		return s.status(id, fxFailure, err.Error())
+	}
+	return s.status(id, fxOK, "")
+}
+
+func (s *sftpSession) rename(id uint32, from, to string) error {
+	h, ok := s.held[from]
+	if !ok {
+		return s.status(id, fxNoSuchFile, "no such file")
+	}
+	delete(s.held, from)
+
+	oldPath := filepath.Join(h.tempDir, path.Base(from))
+	if err := os.Rename(oldPath, filepath.Join(h.tempDir, path.Base(to))); err != nil {
+		s.discard(h)
+		return s.status(id, fxFailure, "rename failed")
+	}
+	h.path = to
+	if !sftpExts[strings.ToLower(path.Ext(to))] {
+		s.held[to] = h
+		return s.status(id, fxOK, "")
+	}
+	if err := s.deliver(h); err != nil {
+		return s.status(id, fxFailure, err.Error())
+	}
+	return s.status(id, fxOK, "")
+}
+
+// deliver starts a job for a finished upload, into the reMarkable folder
+// matching its directory
+func (s *sftpSession) deliver(h *sftpHandle) error {
+	if h.size == 0 {
+		s.discard(h)
+		return errors.New("empty file")
+	}
+	if maintenance.Enabled() {
+		s.discard(h)
+		return errors.New("maintenance mode: not accepting new jobs")
+	}
+	var req webhook.DocumentRequest
+	if dir := path.Dir(h.path); dir != "/" {
+		req.RmDir = dir
+	}
+	id := enqueueLocalFile(filepath.Join(h.tempDir, path.Base(h.path)), req, "sftp", s.userID)
+	if s.user != nil {
+		logging.LogfWithUser(s.user.Username, "[SFTP] Enqueued job %s for %s", id, h.path)
+	} else {
+		logging.Logf("[SFTP] Enqueued job %s for %s", id, h.path)
+	}
+	return nil
+}
+
+// discard removes an upload that won't be delivered
+func (s *sftpSession) discard(h *sftpHandle) {
+	if h.file != nil {
+		h.file.Close()
+	}
+	if h.tempDir != "" {
+		os.RemoveAll(h.tempDir)
+	}
+}
+
+func (s *sftpSession) newHandle(h *sftpHandle) string {
+	s.nextID++
+	hid := strconv.Itoa(s.nextID)
+	s.handles[hid] = h
+	return hid
+}
+
+func (s *sftpSession) handleArg(r *sftpReader) (*sftpHandle, error) {
+	hid, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := s.handles[hid]
+	if !ok {
+		return nil, errors.New("invalid handle")
+	}
+	return h, nil
+}
+
+func (s *sftpSession) status(id uint32, code uint32, msg string) error {
+	return s.send(fxpStatus, id, code, msg, "")
+}
+
+// send writes a packet made of the given fields: uint32s, uint64s, strings
+// and attributes
+func (s *sftpSession) send(kind byte, fields ...interface{}) error {
+	buf := []byte{0, 0, 0, 0, kind}
+	for _, f := range fields {
+		switch v := f.(type) {
+		case uint32:
+			buf = binary.BigEndian.AppendUint32(buf, v)
+		case uint64:
+			buf = binary.BigEndian.AppendUint64(buf, v)
+		case string:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			buf = append(buf, v...)
+		case sftpAttrs:
+			buf = binary.BigEndian.AppendUint32(buf, attrSize|attrPermissions)
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v.size))
+			buf = binary.BigEndian.AppendUint32(buf, v.mode)
+		default:
+			return fmt.Errorf("unsupported sftp field %T", f)
+		}
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	_, err := s.rw.Write(buf)
+	return err
+}
+
+// sftpAttrs are the file attributes sent to clients
+type sftpAttrs struct {
+	size int64
+	mode uint32
+}
+
+// sftpReader decodes the fields of a request
+type sftpReader struct {
+	buf []byte
+}
+
+func (r *sftpReader) uint32() (uint32, error) {
+	if len(r.buf) < 4 {
+		return 0, errBadPacket
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v, nil
+}
+
+func (r *sftpReader) uint64() (uint64, error) {
+	if len(r.buf) < 8 {
+		return 0, errBadPacket
+	}
+	v := binary.BigEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v, nil
+}
+
+func (r *sftpReader) bytes() ([]byte, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(r.buf)) < n {
+		return nil, errBadPacket
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v, nil
+}
+
+func (r *sftpReader) string() (string, error) {
+	b, err := r.bytes()
+	return string(b), err
+}
+
+// cleanSFTPPath resolves p against the root of the virtual tree
+func cleanSFTPPath(p string) string {
+	if p == "" || p == "." {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
@@ -0,0 +1,210 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// sftpConn collects what a session sends; requests are passed to
+// sftpSession.handle directly
+type sftpConn struct {
+	out bytes.Buffer
+}
+
+func (c *sftpConn) Read([]byte) (int, error)    { return 0, io.EOF }
+func (c *sftpConn) Write(p []byte) (int, error) { return c.out.Write(p) }
+
+// sftpPacket encodes a packet's type and fields the way the session sends
+// them, without the length prefix
+func sftpPacket(t *testing.T, kind byte, fields ...interface{}) (byte, *sftpReader) {
+	t.Helper()
+	conn := &sftpConn{}
+	if err := (&sftpSession{rw: conn}).send(kind, fields...); err != nil {
+		t.Fatal(err)
+	}
+	return kind, &sftpReader{buf: conn.out.Bytes()[5:]}
+}
+
+// nextReply reads the next packet the session sent
+func nextReply(t *testing.T, conn *sftpConn) (byte, *sftpReader) {
+	t.Helper()
+	var length uint32
+	if err := binary.Read(&conn.out, binary.BigEndian, &length); err != nil {
+		t.Fatalf("no reply: %v", err)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(&conn.out, packet); err != nil {
+		t.Fatalf("short reply: %v", err)
+	}
+	return packet[0], &sftpReader{buf: packet[1:]}
+}
+
+// expectStatus reads a status reply and checks its code
+func expectStatus(t *testing.T, conn *sftpConn, want uint32) {
+	t.Helper()
+	kind, r := nextReply(t, conn)
+	if kind != fxpStatus {
+		t.Fatalf("reply type = %d, want status", kind)
+	}
+	r.uint32()
+	if code, _ := r.uint32(); code != want {
+		msg, _ := r.string()
+		t.Fatalf("status = %d (%s), want %d", code, msg, want)
+	}
+}
+
+func TestSFTPPacketCodec(t *testing.T) {
+	conn := &sftpConn{}
+	s := newSFTPSession(conn, uuid.Nil, nil)
+	if err := s.send(fxpName, uint32(7), uint32(1), "/Scans", "/Scans", sftpAttrs{size: 5, mode: 0o40755}); err != nil {
+		t.Fatal(err)
+	}
+
+	kind, r := nextReply(t, conn)
+	if kind != fxpName {
+		t.Fatalf("type = %d, want %d", kind, fxpName)
+	}
+	id, _ := r.uint32()
+	count, _ := r.uint32()
+	name, _ := r.string()
+	long, _ := r.string()
+	flags, _ := r.uint32()
+	size, _ := r.uint64()
+	mode, _ := r.uint32()
+	if id != 7 || count != 1 || name != "/Scans" || long != "/Scans" || flags != attrSize|attrPermissions || size != 5 || mode != 0o40755 {
+		t.Errorf("decoded %d %d %q %q %#x %d %o", id, count, name, long, flags, size, mode)
+	}
+	if len(r.buf) != 0 {
+		t.Errorf("%d bytes left over", len(r.buf))
+	}
+
+	for _, buf := range [][]byte{{0, 0}, {0, 0, 0, 9, 'a'}} {
+		if _, err := (&sftpReader{buf: buf}).string(); err != errBadPacket {
+			t.Errorf("string() of %v: err = %v, want %v", buf, err, errBadPacket)
+		}
+	}
+	if _, err := (&sftpReader{buf: []byte{1, 2, 3}}).uint64(); err != errBadPacket {
+		t.Errorf("uint64() of a short buffer: err = %v, want %v", err, errBadPacket)
+	}
+}
+
+func TestCleanSFTPPath(t *testing.T) {
+	tests := map[string]string{
+		"":                "/",
+		".":               "/",
+		"Scans":           "/Scans",
+		"/Scans/../../x":  "/x",
+		"//Books//a.pdf/": "/Books/a.pdf",
+	}
+	for in, want := range tests {
+		if got := cleanSFTPPath(in); got != want {
+			t.Errorf("cleanSFTPPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// stubEnqueue records the files handed to the pipeline until the test ends
+func stubEnqueue(t *testing.T) *[]string {
+	t.Helper()
+	var paths []string
+	orig := enqueueLocalFile
+	enqueueLocalFile = func(path string, req webhook.DocumentRequest, _ string, _ uuid.UUID) string {
+		paths = append(paths, req.RmDir+"|"+path)
+		t.Cleanup(func() { os.RemoveAll(filepath.Dir(path)) })
+		return "job"
+	}
+	t.Cleanup(func() { enqueueLocalFile = orig })
+	return &paths
+}
+
+// openForWrite opens p for writing and returns the handle
+func openForWrite(t *testing.T, s *sftpSession, conn *sftpConn, p string) string {
+	t.Helper()
+	if err := s.handle(sftpPacket(t, fxpOpen, uint32(1), p, uint32(fxfWrite|0x08), sftpAttrs{})); err != nil {
+		t.Fatal(err)
+	}
+	kind, r := nextReply(t, conn)
+	if kind != fxpHandle {
+		t.Fatalf("open %s: reply type = %d, want handle", p, kind)
+	}
+	r.uint32()
+	hid, _ := r.string()
+	return hid
+}
+
+func TestSFTPUpload(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	enqueued := stubEnqueue(t)
+	conn := &sftpConn{}
+	s := newSFTPSession(conn, uuid.Nil, nil)
+
+	if err := s.handle(sftpPacket(t, fxpInit, uint32(3))); err != nil {
+		t.Fatal(err)
+	}
+	if kind, _ := nextReply(t, conn); kind != fxpVersion {
+		t.Fatalf("init reply type = %d, want version", kind)
+	}
+
+	hid := openForWrite(t, s, conn, "/Scans/scan.pdf")
+	for _, chunk := range []struct {
+		offset uint64
+		data   string
+	}{{0, "%PDF-1.7 "}, {9, "body"}} {
+		if err := s.handle(sftpPacket(t, fxpWrite, uint32(2), hid, chunk.offset, chunk.data)); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, conn, fxOK)
+	}
+
+	// An offset past the int64 range is refused, not wrapped around
+	if err := s.handle(sftpPacket(t, fxpWrite, uint32(3), hid, uint64(1)<<63, "x")); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, conn, fxFailure)
+
+	if err := s.handle(sftpPacket(t, fxpClose, uint32(4), hid)); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, conn, fxOK)
+
+	if len(*enqueued) != 1 {
+		t.Fatalf("enqueued %v, want one upload", *enqueued)
+	}
+	rmDir, path, _ := bytes.Cut([]byte((*enqueued)[0]), []byte("|"))
+	if string(rmDir) != "/Scans" || filepath.Base(string(path)) != "scan.pdf" {
+		t.Errorf("enqueued %s into %s, want scan.pdf into /Scans", path, rmDir)
+	}
+	if data, _ := os.ReadFile(string(path)); string(data) != "%PDF-1.7 body" {
+		t.Errorf("uploaded content = %q", data)
+	}
+}
+
+func TestSFTPUploadRenamedIntoPlace(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	enqueued := stubEnqueue(t)
+	conn := &sftpConn{}
+	s := newSFTPSession(conn, uuid.Nil, nil)
+
+	// WinSCP uploads to a temporary name and renames it when done
+	hid := openForWrite(t, s, conn, "/doc.pdf.filepart")
+	s.handle(sftpPacket(t, fxpWrite, uint32(2), hid, uint64(0), "%PDF"))
+	expectStatus(t, conn, fxOK)
+	s.handle(sftpPacket(t, fxpClose, uint32(3), hid))
+	expectStatus(t, conn, fxOK)
+	if len(*enqueued) != 0 {
+		t.Fatalf("partial upload was enqueued: %v", *enqueued)
+	}
+
+	s.handle(sftpPacket(t, fxpRename, uint32(4), "/doc.pdf.filepart", "/doc.pdf"))
+	expectStatus(t, conn, fxOK)
+	if len(*enqueued) != 1 || filepath.Base((*enqueued)[0]) != "doc.pdf" {
+		t.Errorf("enqueued %v, want doc.pdf", *enqueued)
+	}
+}
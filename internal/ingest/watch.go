@@ -0,0 +1,323 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// watchExts are the file types picked up from a watch folder
+var watchExts = map[string]bool{".pdf": true, ".epub": true}
+
+// watcher reports changes to the directories added to it. It is backed by
+// inotify on Linux; elsewhere the watch folder is only polled.
+type watcher interface {
+	Add(dir string) error
+	Events() <-chan struct{}
+	Close() error
+}
+
+// fileState is a file seen in the watch folder, ingested once its size and
+// modification time have stopped changing
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// WatchFolder ingests PDFs and EPUBs dropped into a local directory, such as
+// a share a scanner writes to, and moves them to a processed directory. In
+// multi-user mode each user has a subdirectory named after their username.
+type WatchFolder struct {
+	root      string
+	processed string
+	owner     string
+	options   webhook.DocumentRequest
+	interval  time.Duration
+	settle    time.Duration
+
+	pending map[string]fileState
+	// failed holds files that couldn't be moved aside, so they aren't
+	// ingested again on every scan
+	failed map[string]fileState
+}
+
+// NewWatchFolderFromEnv returns a watch folder configured from WATCH_DIR and
+// the other WATCH_ settings, or nil when WATCH_DIR is not set
+func NewWatchFolderFromEnv() (*WatchFolder, error) {
+	root := config.Get("WATCH_DIR", "")
+	if root == "" {
+		return nil, nil
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("WATCH_DIR %s is not a directory", root)
+	}
+	processed := config.Get("WATCH_PROCESSED_DIR", filepath.Join(root, ".processed"))
+	if err := os.MkdirAll(processed, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WATCH_PROCESSED_DIR: %w", err)
+	}
+	return &WatchFolder{
+		root:      root,
+		processed: processed,
+		owner:     config.Get("WATCH_USER", ""),
+		options: webhook.DocumentRequest{
+			RmDir:    config.Get("WATCH_RM_DIR", ""),
+			Compress: config.Get("WATCH_COMPRESS", ""),
+			Archive:  config.Get("WATCH_ARCHIVE", ""),
+		},
+		interval: config.GetDuration("WATCH_INTERVAL", 30*time.Second),
+		settle:   config.GetDuration("WATCH_SETTLE", 5*time.Second),
+		pending:  make(map[string]fileState),
+		failed:   make(map[string]fileState),
+	}, nil
+}
+
+// Start watches the folder in the background until ctx is cancelled. Changes
+// reported by inotify trigger a scan right away; the folder is also scanned
+// every WATCH_INTERVAL, which catches writes inotify misses on network shares.
+func (w *WatchFolder) Start(ctx context.Context) {
+	notify, err := newWatcher()
+	if err != nil {
+		logging.Logf("[WATCH] File notifications unavailable, polling %s every %s: %v", w.root, w.interval, err)
+	}
+	logging.Logf("[WATCH] Watching %s for new documents", w.root)
+
+	go func() {
+		var events <-chan struct{}
+		if notify != nil {
+			defer notify.Close()
+			events = notify.Events()
+		}
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		settle := time.NewTimer(0)
+		defer settle.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				// Wait for the writer to finish before looking
+				settle.Reset(w.settle)
+				continue
+			case <-ticker.C:
+			case <-settle.C:
+			}
+			if w.scan(notify) {
+				settle.Reset(w.settle)
+			}
+		}
+	}()
+}
+
+// scan ingests every settled file and returns whether any are still being
+// written
+func (w *WatchFolder) scan(notify watcher) bool {
+	dirs, err := w.dirs()
+	if err != nil {
+		logging.Logf("[WATCH] Failed to scan %s: %v", w.root, err)
+		return false
+	}
+
+	seen := make(map[string]bool)
+	for dir, user := range dirs {
+		if notify != nil {
+			if err := notify.Add(dir); err != nil {
+				logging.Logf("[WATCH] Failed to watch %s: %v", dir, err)
+			}
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			logging.Logf("[WATCH] Failed to read %s: %v", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") || !watchExts[strings.ToLower(filepath.Ext(name))] {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			seen[path] = true
+			if w.settled(path, info) {
+				w.ingest(path, info, user)
+			}
+		}
+	}
+
+	for path := range w.pending {
+		if !seen[path] {
+			delete(w.pending, path)
+		}
+	}
+	for path := range w.failed {
+		if !seen[path] {
+			delete(w.failed, path)
+		}
+	}
+	return len(w.pending) > 0
+}
+
+// dirs returns the directories to ingest from and the user each belongs to
+func (w *WatchFolder) dirs() (map[string]*database.User, error) {
+	if !database.IsMultiUserMode() {
+		return map[string]*database.User{w.root: nil}, nil
+	}
+
+	dirs := make(map[string]*database.User)
+	if w.owner != "" {
+		if user := activeUser(w.owner); user != nil {
+			dirs[w.root] = user
+		}
+	}
+	entries, err := os.ReadDir(w.root)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(w.root, entry.Name())
+		if dir == w.processed {
+			continue
+		}
+		if user := activeUser(entry.Name()); user != nil {
+			dirs[dir] = user
+		}
+	}
+	return dirs, nil
+}
+
+func activeUser(username string) *database.User {
+	var user database.User
+	if err := database.DB.Where("username = ? AND is_active = ?", username, true).First(&user).Error; err != nil {
+		return nil
+	}
+	return &user
+}
+
+// settled reports whether a file has stopped changing for WATCH_SETTLE
+func (w *WatchFolder) settled(path string, info os.FileInfo) bool {
+	if f, ok := w.failed[path]; ok && f.size == info.Size() && f.modTime.Equal(info.ModTime()) {
+		return false
+	}
+	now := time.Now()
+	state, ok := w.pending[path]
+	if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+		w.pending[path] = fileState{size: info.Size(), modTime: info.ModTime(), since: now}
+		return false
+	}
+	return now.Sub(state.since) >= w.settle
+}
+
+// ingest moves a settled file to the processed directory and starts a job
+// for a copy of it
+func (w *WatchFolder) ingest(path string, info os.FileInfo, user *database.User) {
+	if maintenance.Enabled() {
+		// Left in place until maintenance mode is turned off
+		return
+	}
+	delete(w.pending, path)
+
+	userID := uuid.Nil
+	processedDir := w.processed
+	if user != nil {
+		userID = user.ID
+		if filepath.Dir(path) != w.root {
+			processedDir = filepath.Join(w.processed, user.Username)
+		}
+	}
+
+	fail := func(err error) {
+		logging.Logf("[WATCH] Failed to ingest %s: %v", path, err)
+		w.failed[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+	}
+
+	// The pipeline removes the file it's given, so it gets a copy in a temp dir
+	tempDir, err := manager.CreateUserTempDir(userID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	tempPath := filepath.Join(tempDir, filepath.Base(path))
+	if err := copyFile(path, tempPath); err != nil {
+		os.RemoveAll(tempDir)
+		fail(err)
+		return
+	}
+	if _, err := moveToDir(path, processedDir); err != nil {
+		os.RemoveAll(tempDir)
+		fail(fmt.Errorf("failed to move to %s: %w", processedDir, err))
+		return
+	}
+
+	id := enqueueLocalFile(tempPath, w.options, "watch", userID)
+	if user != nil {
+		logging.LogfWithUser(user.Username, "[WATCH] Enqueued job %s for %s", id, filepath.Base(path))
+	} else {
+		logging.Logf("[WATCH] Enqueued job %s for %s", id, filepath.Base(path))
+	}
+}
+
+// moveToDir moves path into dir, adding a timestamp to the name if a file of
+// that name was processed before
+func moveToDir(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = fmt.Sprintf("%s %s%s", strings.TrimSuffix(dest, ext), time.Now().Format("20060102-150405"), ext)
+	}
+	if err := os.Rename(path, dest); err == nil {
+		return dest, nil
+	}
+	// Rename fails across filesystems
+	if err := copyFile(path, dest); err != nil {
+		return "", err
+	}
+	return dest, os.Remove(path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// inotifyWatcher signals on any create, write or move in its directories.
+// Events aren't decoded since every change leads to a full scan.
+type inotifyWatcher struct {
+	fd      int
+	file    *os.File
+	events  chan struct{}
+	mu      sync.Mutex
+	watched map[string]bool
+}
+
+func newWatcher() (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// A non-blocking descriptor goes through the runtime poller, so Close
+	// unblocks the reader below
+	w := &inotifyWatcher{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan struct{}, 1),
+		watched: make(map[string]bool),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := w.file.Read(buf); err != nil {
+			close(w.events)
+			return
+		}
+		select {
+		case w.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *inotifyWatcher) Add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watched[dir] {
+		return nil
+	}
+	mask := uint32(syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE)
+	if _, err := syscall.InotifyAddWatch(w.fd, dir, mask); err != nil {
+		return err
+	}
+	w.watched[dir] = true
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,45 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	w, err := newWatcher()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	dir := t.TempDir()
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(dir); err != nil {
+		t.Errorf("adding a directory twice: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "scan.pdf"), []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-w.Events():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for a new file")
+	}
+
+	// Closing ends the event stream
+	w.Close()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-w.Events():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("events not closed after Close")
+		}
+	}
+}
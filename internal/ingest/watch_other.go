@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ingest
+
+import "errors"
+
+func newWatcher() (watcher, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
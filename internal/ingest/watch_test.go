@@ -0,0 +1,183 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// recordEnqueued replaces the job pipeline with one that keeps the contents
+// of each enqueued file, keyed by its name
+func recordEnqueued(t *testing.T) map[string]string {
+	t.Helper()
+	got := make(map[string]string)
+	orig := enqueueLocalFile
+	enqueueLocalFile = func(path string, req webhook.DocumentRequest, source string, _ uuid.UUID) string {
+		if source != "watch" || req.RmDir != "/Scans" {
+			t.Errorf("enqueued %s from %q into %q, want watch into /Scans", path, source, req.RmDir)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("enqueued file: %v", err)
+		}
+		got[filepath.Base(path)] = string(data)
+		os.RemoveAll(filepath.Dir(path))
+		return "job-1"
+	}
+	t.Cleanup(func() { enqueueLocalFile = orig })
+	return got
+}
+
+func newTestWatchFolder(t *testing.T) *WatchFolder {
+	t.Helper()
+	t.Setenv("MULTI_USER", "false")
+	t.Setenv("WATCH_DIR", t.TempDir())
+	t.Setenv("WATCH_PROCESSED_DIR", "")
+	t.Setenv("WATCH_RM_DIR", "/Scans")
+	w, err := NewWatchFolderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.settle = 0
+	return w
+}
+
+func writeWatched(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchFolderScan(t *testing.T) {
+	enqueued := recordEnqueued(t)
+	w := newTestWatchFolder(t)
+	if w.processed != filepath.Join(w.root, ".processed") {
+		t.Errorf("processed dir = %s, want .processed inside the watch dir", w.processed)
+	}
+
+	writeWatched(t, filepath.Join(w.root, "scan.pdf"), "%PDF scan")
+	writeWatched(t, filepath.Join(w.root, "book.EPUB"), "epub")
+	writeWatched(t, filepath.Join(w.root, "notes.txt"), "ignored")
+	writeWatched(t, filepath.Join(w.root, ".partial.pdf"), "ignored")
+	writeWatched(t, filepath.Join(w.root, "sub", "nested.pdf"), "ignored")
+
+	// A file is first seen, then ingested once it hasn't changed
+	if !w.scan(nil) {
+		t.Error("first scan reported nothing pending")
+	}
+	if len(enqueued) != 0 {
+		t.Fatalf("first scan enqueued %v before the files settled", enqueued)
+	}
+	if w.scan(nil) {
+		t.Error("second scan still reported files pending")
+	}
+	if len(enqueued) != 2 || enqueued["scan.pdf"] != "%PDF scan" || enqueued["book.EPUB"] != "epub" {
+		t.Errorf("enqueued %v, want scan.pdf and book.EPUB", enqueued)
+	}
+	for _, name := range []string{"scan.pdf", "book.EPUB"} {
+		if _, err := os.Stat(filepath.Join(w.root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left in the watch dir", name)
+		}
+		if _, err := os.Stat(filepath.Join(w.processed, name)); err != nil {
+			t.Errorf("%s not moved to the processed dir: %v", name, err)
+		}
+	}
+	for _, name := range []string{"notes.txt", ".partial.pdf", "sub/nested.pdf"} {
+		if _, err := os.Stat(filepath.Join(w.root, name)); err != nil {
+			t.Errorf("%s was touched: %v", name, err)
+		}
+	}
+}
+
+func TestWatchFolderWaitsForWrites(t *testing.T) {
+	enqueued := recordEnqueued(t)
+	w := newTestWatchFolder(t)
+	path := filepath.Join(w.root, "scan.pdf")
+
+	writeWatched(t, path, "%PDF part")
+	w.scan(nil)
+	writeWatched(t, path, "%PDF part, then the rest")
+	if !w.scan(nil) || len(enqueued) != 0 {
+		t.Fatalf("file ingested while it was still growing: %v", enqueued)
+	}
+	w.scan(nil)
+	if enqueued["scan.pdf"] != "%PDF part, then the rest" {
+		t.Errorf("enqueued %v, want the finished file", enqueued)
+	}
+
+	// A file that disappears before settling is forgotten
+	writeWatched(t, filepath.Join(w.root, "gone.pdf"), "%PDF")
+	w.scan(nil)
+	os.Remove(filepath.Join(w.root, "gone.pdf"))
+	if w.scan(nil) || len(w.pending) != 0 {
+		t.Errorf("pending = %v after the file was removed", w.pending)
+	}
+}
+
+func TestWatchFolderDuringMaintenance(t *testing.T) {
+	enqueued := recordEnqueued(t)
+	w := newTestWatchFolder(t)
+	path := filepath.Join(w.root, "scan.pdf")
+	writeWatched(t, path, "%PDF")
+
+	end := maintenance.BeginRestore()
+	w.scan(nil)
+	w.scan(nil)
+	if len(enqueued) != 0 {
+		t.Errorf("enqueued %v during maintenance", enqueued)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file moved during maintenance: %v", err)
+	}
+
+	end()
+	w.scan(nil)
+	if enqueued["scan.pdf"] != "%PDF" {
+		t.Errorf("enqueued %v after maintenance, want scan.pdf", enqueued)
+	}
+}
+
+func TestMoveToDir(t *testing.T) {
+	src, dest := t.TempDir(), filepath.Join(t.TempDir(), "processed")
+	first := filepath.Join(src, "scan.pdf")
+	writeWatched(t, first, "one")
+	got, err := moveToDir(first, dest)
+	if err != nil || got != filepath.Join(dest, "scan.pdf") {
+		t.Fatalf("moveToDir = %q, %v", got, err)
+	}
+
+	// A second file of the same name gets a timestamp instead of replacing the first
+	writeWatched(t, first, "two")
+	got, err = moveToDir(first, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Now().Format("20060102")
+	if !strings.HasPrefix(filepath.Base(got), "scan "+stamp) || filepath.Ext(got) != ".pdf" {
+		t.Errorf("second move = %s, want a timestamped name", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "scan.pdf")); string(data) != "one" {
+		t.Errorf("first file was replaced with %q", data)
+	}
+}
+
+func TestNewWatchFolderFromEnv(t *testing.T) {
+	t.Setenv("WATCH_DIR", "")
+	if w, err := NewWatchFolderFromEnv(); w != nil || err != nil {
+		t.Errorf("without WATCH_DIR = %v, %v, want nothing", w, err)
+	}
+	t.Setenv("WATCH_DIR", filepath.Join(t.TempDir(), "missing"))
+	if _, err := NewWatchFolderFromEnv(); err == nil {
+		t.Error("a missing WATCH_DIR was accepted")
+	}
+}
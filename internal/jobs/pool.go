@@ -0,0 +1,240 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+// Priority is the lane a job waits in. Waiting jobs of a higher priority
+// start before those of a lower one.
+type Priority int
+
+const (
+	// PriorityLow is for background work such as subscriptions
+	PriorityLow Priority = iota
+	// PriorityNormal is for webhook and API jobs
+	PriorityNormal
+	// PriorityHigh is for uploads someone is waiting on in the web UI
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// ParsePriority parses "low", "normal" or "high"
+func ParsePriority(s string) (Priority, bool) {
+	switch s {
+	case "low":
+		return PriorityLow, true
+	case "normal":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	}
+	return PriorityNormal, false
+}
+
+// Scheduler decides the order waiting jobs start in
+type Scheduler struct {
+	// FIFO ignores priorities and starts jobs in submission order
+	FIFO bool
+	// Aging raises a waiting job's priority one lane for every Aging it has
+	// waited, so a steady stream of higher priority jobs can't hold lower
+	// ones back forever. 0 turns it off.
+	Aging time.Duration
+}
+
+// task is a job waiting for or holding a worker slot
+type task struct {
+	id       string
+	userID   uuid.UUID
+	priority Priority
+	run      func()
+	queuedAt time.Time
+}
+
+// Pool runs jobs with a limit on how many run at once, overall and per user.
+// Jobs over either limit wait, highest priority first and then in submission
+// order; a user at their own limit doesn't hold up other users' jobs behind
+// theirs.
+type Pool struct {
+	mu        sync.Mutex
+	max       int
+	perUser   int
+	scheduler Scheduler
+	running   map[string]*task
+	byUser    map[uuid.UUID]int
+	waiting   []*task
+}
+
+// NewPool returns a pool that runs at most max jobs at once, and at most
+// perUser for any one user. A limit of 0 or less means no limit.
+func NewPool(max, perUser int) *Pool {
+	return &Pool{
+		max:     max,
+		perUser: perUser,
+		running: make(map[string]*task),
+		byUser:  make(map[uuid.UUID]int),
+	}
+}
+
+// SetScheduler changes the order waiting jobs start in
+func (p *Pool) SetScheduler(s Scheduler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scheduler = s
+	p.dispatchLocked()
+}
+
+// Submit runs run at normal priority, see SubmitPriority
+func (p *Pool) Submit(id string, userID uuid.UUID, run func()) bool {
+	return p.SubmitPriority(id, userID, PriorityNormal, run)
+}
+
+// SubmitPriority runs run in its own goroutine once a slot is free and no
+// job ahead of it in line could take it, and reports whether it started
+// right away
+func (p *Pool) SubmitPriority(id string, userID uuid.UUID, priority Priority, run func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waiting = append(p.waiting, &task{id: id, userID: userID, priority: priority, run: run, queuedAt: time.Now()})
+	p.dispatchLocked()
+	_, started := p.running[id]
+	return started
+}
+
+// dispatchLocked starts waiting jobs, in the scheduler's order, while there
+// are free slots
+func (p *Pool) dispatchLocked() {
+	p.orderLocked()
+	remaining := p.waiting[:0]
+	for _, t := range p.waiting {
+		if !p.canStartLocked(t) {
+			remaining = append(remaining, t)
+			continue
+		}
+		p.running[t.id] = t
+		p.byUser[t.userID]++
+		go func(t *task) {
+			defer p.finish(t)
+			t.run()
+		}(t)
+	}
+	for i := len(remaining); i < len(p.waiting); i++ {
+		p.waiting[i] = nil
+	}
+	p.waiting = remaining
+}
+
+// orderLocked sorts the waiting jobs into the order they should start in
+func (p *Pool) orderLocked() {
+	now := time.Now()
+	sort.SliceStable(p.waiting, func(i, j int) bool {
+		a, b := p.waiting[i], p.waiting[j]
+		if !p.scheduler.FIFO {
+			if pa, pb := p.effectivePriority(a, now), p.effectivePriority(b, now); pa != pb {
+				return pa > pb
+			}
+		}
+		return a.queuedAt.Before(b.queuedAt)
+	})
+}
+
+// effectivePriority is t's priority raised for the time it has waited
+func (p *Pool) effectivePriority(t *task, now time.Time) Priority {
+	priority := t.priority
+	if p.scheduler.Aging > 0 {
+		priority += Priority(now.Sub(t.queuedAt) / p.scheduler.Aging)
+	}
+	return min(priority, PriorityHigh)
+}
+
+func (p *Pool) canStartLocked(t *task) bool {
+	if p.max > 0 && len(p.running) >= p.max {
+		return false
+	}
+	return p.perUser <= 0 || p.byUser[t.userID] < p.perUser
+}
+
+func (p *Pool) finish(t *task) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.running, t.id)
+	if p.byUser[t.userID]--; p.byUser[t.userID] <= 0 {
+		delete(p.byUser, t.userID)
+	}
+	p.dispatchLocked()
+}
+
+// Position returns how many jobs are waiting ahead of id, and false if id
+// isn't waiting
+func (p *Pool) Position(id string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orderLocked()
+	for i, t := range p.waiting {
+		if t.id == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// WaitingJob is a job waiting for a free slot
+type WaitingJob struct {
+	ID       string            `json:"id"`
+	UserID   string            `json:"user_id,omitempty"`
+	Priority string            `json:"priority"`
+	QueuedAt time.Time         `json:"queued_at"`
+	Labels   map[string]string `json:"labels,omitempty"` // filled in by the caller from the job store
+}
+
+// PoolStats is a snapshot of a pool's limits and load
+type PoolStats struct {
+	MaxJobs     int          `json:"max_jobs"`
+	MaxUserJobs int          `json:"max_user_jobs"`
+	Scheduler   string       `json:"scheduler"` // "priority" or "fifo"
+	Running     int          `json:"running"`
+	Waiting     int          `json:"waiting"`
+	WaitingJobs []WaitingJob `json:"waiting_jobs"`
+	// Processes is what each external program (gs, mutool, rmapi...) used
+	// since the server started
+	Processes map[string]procstats.ToolUsage `json:"processes"`
+}
+
+// Stats returns the pool's current limits, running and waiting jobs
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orderLocked()
+	stats := PoolStats{
+		MaxJobs:     p.max,
+		MaxUserJobs: p.perUser,
+		Scheduler:   "priority",
+		Running:     len(p.running),
+		Waiting:     len(p.waiting),
+		WaitingJobs: make([]WaitingJob, 0, len(p.waiting)),
+	}
+	if p.scheduler.FIFO {
+		stats.Scheduler = "fifo"
+	}
+	for _, t := range p.waiting {
+		job := WaitingJob{ID: t.id, Priority: t.priority.String(), QueuedAt: t.queuedAt}
+		if t.userID != uuid.Nil {
+			job.UserID = t.userID.String()
+		}
+		stats.WaitingJobs = append(stats.WaitingJobs, job)
+	}
+	return stats
+}
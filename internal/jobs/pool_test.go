@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPoolLimits(t *testing.T) {
+	p := NewPool(2, 1)
+	alice, bob := uuid.New(), uuid.New()
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	block := func() {
+		defer wg.Done()
+		<-release
+	}
+
+	wg.Add(4)
+	if !p.Submit("a1", alice, block) {
+		t.Fatal("expected first job to start")
+	}
+	if p.Submit("a2", alice, block) {
+		t.Fatal("expected second job of the same user to wait")
+	}
+	if !p.Submit("b1", bob, block) {
+		t.Fatal("expected another user's job to start past the waiting one")
+	}
+	if p.Submit("b2", bob, block) {
+		t.Fatal("expected job over the pool limit to wait")
+	}
+
+	stats := p.Stats()
+	if stats.Running != 2 || stats.Waiting != 2 {
+		t.Fatalf("expected 2 running and 2 waiting, got %+v", stats)
+	}
+	if pos, ok := p.Position("b2"); !ok || pos != 1 {
+		t.Errorf("expected b2 second in line, got %d %v", pos, ok)
+	}
+
+	close(release)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting jobs never ran")
+	}
+}
+
+func TestPoolPriority(t *testing.T) {
+	p := NewPool(1, 0)
+	user := uuid.New()
+
+	release := make(chan struct{})
+	started := make(chan string, 4)
+	job := func(id string) func() {
+		return func() {
+			started <- id
+			<-release
+		}
+	}
+
+	p.Submit("running", user, job("running"))
+	<-started
+	p.SubmitPriority("low", user, PriorityLow, job("low"))
+	p.SubmitPriority("normal", user, PriorityNormal, job("normal"))
+	p.SubmitPriority("high", user, PriorityHigh, job("high"))
+
+	if pos, ok := p.Position("high"); !ok || pos != 0 {
+		t.Errorf("expected high priority job first in line, got %d %v", pos, ok)
+	}
+	for _, want := range []string{"high", "normal", "low"} {
+		release <- struct{}{}
+		select {
+		case id := <-started:
+			if id != want {
+				t.Fatalf("expected %s to start next, got %s", want, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s never started", want)
+		}
+	}
+	close(release)
+}
+
+func TestPoolFIFOAndAging(t *testing.T) {
+	p := NewPool(1, 0)
+	p.SetScheduler(Scheduler{FIFO: true})
+	now := time.Now()
+	p.waiting = []*task{
+		{id: "low", priority: PriorityLow, queuedAt: now.Add(-time.Second)},
+		{id: "high", priority: PriorityHigh, queuedAt: now},
+	}
+	p.orderLocked()
+	if p.waiting[0].id != "low" {
+		t.Errorf("expected FIFO to keep submission order, got %s first", p.waiting[0].id)
+	}
+
+	p.scheduler = Scheduler{Aging: time.Minute}
+	p.waiting[0].queuedAt = now.Add(-2 * time.Minute)
+	p.orderLocked()
+	if p.waiting[0].id != "low" {
+		t.Errorf("expected a low priority job that waited two aging periods to go first, got %s", p.waiting[0].id)
+	}
+	p.waiting[0].queuedAt = now.Add(-30 * time.Second)
+	p.orderLocked()
+	if p.waiting[0].id != "high" {
+		t.Errorf("expected high priority job first, got %s", p.waiting[0].id)
+	}
+}
@@ -3,15 +3,43 @@ package jobs
 import (
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Job represents the state of a single PDF process
 type Job struct {
+	ID        string            `json:"id,omitempty"`
 	Status    string            `json:"status"`
 	Message   string            `json:"message"`
 	Data      map[string]string `json:"data,omitempty"`
 	Progress  int               `json:"progress"`
 	Operation string            `json:"operation"` // e.g., "downloading", "compressing", "uploading"
+	Labels    map[string]string `json:"labels,omitempty"`
+	RequestID string            `json:"request_id,omitempty"` // the HTTP request that started the job
+}
+
+// Finished reports whether the job succeeded, failed or was cancelled
+func (j *Job) Finished() bool {
+	return j.Status == "success" || j.Status == "error" || j.Status == "cancelled"
+}
+
+// copy returns a copy of the job that later updates don't change
+func (j *Job) copy() *Job {
+	jobCopy := &Job{
+		ID:        j.ID,
+		Status:    j.Status,
+		Message:   j.Message,
+		Data:      make(map[string]string),
+		Progress:  j.Progress,
+		Operation: j.Operation,
+		Labels:    j.Labels,
+		RequestID: j.RequestID,
+	}
+	for k, v := range j.Data {
+		jobCopy.Data[k] = v
+	}
+	return jobCopy
 }
 
 // Store holds all jobs in memory
@@ -19,10 +47,19 @@ type Store struct {
 	mu       sync.RWMutex
 	jobs     map[string]*Job
 	watchers map[string][]chan *Job
+	// owners maps the jobs users submitted to them; internal jobs, such as
+	// the items of a batch, have none
+	owners       map[string]uuid.UUID
+	userWatchers map[uuid.UUID][]chan *Job
 }
 
 func NewStore() *Store {
-	return &Store{jobs: make(map[string]*Job), watchers: make(map[string][]chan *Job)}
+	return &Store{
+		jobs:         make(map[string]*Job),
+		watchers:     make(map[string][]chan *Job),
+		owners:       make(map[string]uuid.UUID),
+		userWatchers: make(map[uuid.UUID][]chan *Job),
+	}
 }
 
 // Subscribe returns a channel that receives job updates for the given id.
@@ -36,18 +73,7 @@ func (s *Store) Subscribe(id string) (<-chan *Job, func()) {
 
 	if job != nil {
 		// send current state (as a copy to prevent mutation issues)
-		jobCopy := &Job{
-			Status:    job.Status,
-			Message:   job.Message,
-			Data:      make(map[string]string),
-			Progress:  job.Progress,
-			Operation: job.Operation,
-		}
-		// Copy the data map
-		for k, v := range job.Data {
-			jobCopy.Data[k] = v
-		}
-		ch <- jobCopy
+		ch <- job.copy()
 	}
 
 	return ch, func() {
@@ -64,21 +90,50 @@ func (s *Store) Subscribe(id string) (<-chan *Job, func()) {
 	}
 }
 
-func (s *Store) broadcastLocked(id string) {
-	job := s.jobs[id]
-	jobCopy := &Job{
-		Status:    job.Status,
-		Message:   job.Message,
-		Data:      make(map[string]string),
-		Progress:  job.Progress,
-		Operation: job.Operation,
+// SubscribeUser returns a channel that receives updates for every job
+// userID submits, starting with the current state of their unfinished jobs.
+// In single-user mode jobs belong to uuid.Nil. The returned function should
+// be called to unsubscribe when done.
+func (s *Store) SubscribeUser(userID uuid.UUID) (<-chan *Job, func()) {
+	ch := make(chan *Job, 256)
+	s.mu.Lock()
+	s.userWatchers[userID] = append(s.userWatchers[userID], ch)
+	for id, owner := range s.owners {
+		if job := s.jobs[id]; owner == userID && job != nil && !job.Finished() {
+			select {
+			case ch <- job.copy():
+			default:
+			}
+		}
 	}
-	for k, v := range job.Data {
-		jobCopy.Data[k] = v
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		watchers := s.userWatchers[userID]
+		for i, c := range watchers {
+			if c == ch {
+				s.userWatchers[userID] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(s.userWatchers[userID]) == 0 {
+			delete(s.userWatchers, userID)
+		}
+		s.mu.Unlock()
+		close(ch)
 	}
+}
+
+func (s *Store) broadcastLocked(id string) {
+	job := s.jobs[id]
+	jobCopy := job.copy()
 
-	isTerminal := job.Status == "success" || job.Status == "error"
+	isTerminal := job.Finished()
 	watchers := append([]chan *Job(nil), s.watchers[id]...)
+	if owner, ok := s.owners[id]; ok {
+		watchers = append(watchers, s.userWatchers[owner]...)
+	}
 
 	for _, ch := range watchers {
 		if isTerminal {
@@ -103,11 +158,59 @@ func (s *Store) broadcast(id string) {
 
 func (s *Store) Create(id string) {
 	s.mu.Lock()
-	s.jobs[id] = &Job{Status: "pending", Message: "", Data: nil, Progress: 0, Operation: ""}
+	s.jobs[id] = &Job{ID: id, Status: "pending", Message: "", Data: nil, Progress: 0, Operation: ""}
 	s.broadcastLocked(id)
 	s.mu.Unlock()
 }
 
+// SetOwner records the user who submitted a job, so their SubscribeUser
+// streams see it
+func (s *Store) SetOwner(id string, userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	s.owners[id] = userID
+	jobCopy := j.copy()
+	for _, ch := range s.userWatchers[userID] {
+		select {
+		case ch <- jobCopy:
+		default:
+		}
+	}
+}
+
+// Owner returns the user who submitted a job, and false for jobs with no
+// owner
+func (s *Store) Owner(id string) (uuid.UUID, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userID, ok := s.owners[id]
+	return userID, ok
+}
+
+// SetLabels attaches the labels a job was submitted with. The map must not
+// be modified afterwards; job copies share it.
+func (s *Store) SetLabels(id string, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.Labels = labels
+	}
+}
+
+// SetRequestID records the ID of the HTTP request that started a job, so its
+// log lines can be matched with the request's
+func (s *Store) SetRequestID(id, requestID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.RequestID = requestID
+	}
+}
+
 func (s *Store) Update(id, status, msg string, data map[string]string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -119,6 +222,22 @@ func (s *Store) Update(id, status, msg string, data map[string]string) {
 	}
 }
 
+// UpdateIfWaiting updates a job that hasn't started running yet, i.e. is
+// still pending or queued, and reports whether it did
+func (s *Store) UpdateIfWaiting(id, status, msg string, data map[string]string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok || (j.Status != "pending" && j.Status != "Queued") {
+		return false
+	}
+	j.Status = status
+	j.Message = msg
+	j.Data = data
+	s.broadcastLocked(id)
+	return true
+}
+
 // UpdateWithOperation updates message, optional data, and operation type
 func (s *Store) UpdateWithOperation(id, status, msg string, data map[string]string, operation string) {
 	s.mu.Lock()
@@ -147,9 +266,36 @@ func (s *Store) UpdateProgress(id string, p int) {
 	}
 }
 
+// UpdateProgressMessage sets a running job's progress together with the
+// message and data describing it, in one update
+func (s *Store) UpdateProgressMessage(id, msg string, data map[string]string, p int) {
+	if p < 0 {
+		p = 0
+	} else if p > 100 {
+		p = 100
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.Message = msg
+		j.Data = data
+		j.Progress = p
+		s.broadcastLocked(id)
+	}
+}
+
 func (s *Store) Get(id string) (*Job, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	j, ok := s.jobs[id]
 	return j, ok
 }
+
+// Delete forgets a job. Subscribers should have unsubscribed first.
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	delete(s.watchers, id)
+	delete(s.owners, id)
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	jobIDKey
+	userKey
+)
+
+// WithRequestID returns ctx carrying the ID of the HTTP request it belongs to
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithJobID returns ctx carrying the ID of the job it belongs to
+func WithJobID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, jobIDKey, id)
+}
+
+// WithUser returns ctx carrying the name of the user it acts for
+func WithUser(ctx context.Context, username string) context.Context {
+	if username == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, userKey, username)
+}
+
+// contextAttrs returns the attributes ctx carries for log lines
+func contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if id, ok := ctx.Value(jobIDKey).(string); ok {
+		attrs = append(attrs, slog.String("job_id", id))
+	}
+	if name, ok := ctx.Value(userKey).(string); ok {
+		attrs = append(attrs, slog.String("user", name))
+	}
+	return attrs
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+var (
+	outputOnce sync.Once
+	out        io.Writer
+)
+
+// Writer returns where log lines go: stdout, and also LOG_FILE when it's set
+func Writer() io.Writer {
+	outputOnce.Do(func() {
+		out = os.Stdout
+		path := config.Get("LOG_FILE", "")
+		if path == "" {
+			return
+		}
+		f, err := openRotatingFile(path, rotateOptions{
+			MaxSize:    int64(config.GetInt("LOG_FILE_MAX_SIZE", 100)) << 20,
+			MaxAge:     config.GetDuration("LOG_FILE_MAX_AGE", 0),
+			MaxBackups: config.GetInt("LOG_FILE_MAX_BACKUPS", 5),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open log file %s, logging to stdout only: %v\n", path, err)
+			return
+		}
+		out = io.MultiWriter(os.Stdout, f)
+	})
+	return out
+}
+
+// rotateOptions limit how large a log file grows and how many rotated files
+// are kept. Zero means no limit.
+type rotateOptions struct {
+	// MaxSize is the size in bytes at which the file is rotated
+	MaxSize int64
+	// MaxAge removes rotated files last written longer ago than this
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept
+	MaxBackups int
+}
+
+// rotatingFile appends to a log file, renaming it to path.<timestamp> and
+// starting a new one once it reaches MaxSize
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	opts rotateOptions
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, opts rotateOptions) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.prune()
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.opts.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate must be called with mu held
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	rotated := r.path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(r.path, rotated); err != nil {
+		// Keep appending to the same file rather than lose lines
+		return r.open()
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+// prune removes rotated files beyond MaxBackups or older than MaxAge
+func (r *rotatingFile) prune() {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, m := range matches {
+		// Timestamps sort in the order the files were rotated
+		if suffix := strings.TrimPrefix(m, r.path+"."); len(suffix) == len("20060102-150405.000") && suffix[0] >= '0' && suffix[0] <= '9' {
+			rotated = append(rotated, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	for i, path := range rotated {
+		remove := r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups
+		if !remove && r.opts.MaxAge > 0 {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > r.opts.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(path)
+		}
+	}
+}
@@ -1,19 +1,196 @@
+// Package logging writes Aviary's logs. Lines are plain text by default, or
+// one JSON object each with LOG_FORMAT=json so they can be shipped to Loki,
+// Elasticsearch and the like. A leading [TAG] in a message becomes its
+// component, and lines logged with a request's or job's context carry its
+// request_id and job_id. With LOG_FILE set they're also written to a file
+// that is rotated by size.
 package logging
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+var (
+	loggerOnce sync.Once
+	logger     *slog.Logger
 )
 
+// Logger returns the logger every line goes through, for callers that want
+// to add their own attributes
+func Logger() *slog.Logger {
+	loggerOnce.Do(func() {
+		logger = slog.New(newHandler(Writer(), config.Get("LOG_FORMAT", "text"), level()))
+	})
+	return logger
+}
+
+// level is the lowest level logged, from LOG_LEVEL (debug, info, warn or
+// error; default info)
+func level() slog.Level {
+	switch strings.ToLower(config.Get("LOG_LEVEL", "")) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+func newHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	return &textHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
 // Logf logs a message with RFC3339 timestamp prefix
 func Logf(format string, v ...interface{}) {
-	fmt.Printf("[%s] "+format+"\n", append([]interface{}{time.Now().Format(time.RFC3339)}, v...)...)
+	logf(context.Background(), slog.LevelInfo, format, v...)
+}
+
+// LogfCtx logs a message with the request ID, job ID and user carried by ctx
+func LogfCtx(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelInfo, format, v...)
 }
 
 // LogfWithUser logs a message with username prefix if user is provided
 func LogfWithUser(username string, format string, v ...interface{}) {
-	if username != "" {
-		format = "[" + username + "] " + format
+	logf(WithUser(context.Background(), username), slog.LevelInfo, format, v...)
+}
+
+// DebugEnabled reports whether debug logging is turned on via LOG_LEVEL=debug
+func DebugEnabled() bool {
+	return strings.EqualFold(config.Get("LOG_LEVEL", ""), "debug")
+}
+
+// Debugf logs a message only when debug logging is enabled
+func Debugf(format string, v ...interface{}) {
+	if DebugEnabled() {
+		logf(context.Background(), slog.LevelDebug, format, v...)
 	}
-	Logf(format, v...)
-}
\ No newline at end of file
+}
+
+// tag matches the [TAG] most messages start with
+var tag = regexp.MustCompile(`^\[([A-Z][A-Z0-9_ -]*)\] `)
+
+// tagLevels are the tags that raise a message's level rather than name its
+// component
+var tagLevels = map[string]slog.Level{
+	"WARN":    slog.LevelWarn,
+	"WARNING": slog.LevelWarn,
+	"ERROR":   slog.LevelError,
+}
+
+func logf(ctx context.Context, lvl slog.Level, format string, v ...interface{}) {
+	log(ctx, lvl, fmt.Sprintf(format, v...))
+}
+
+// log splits the leading tag off msg into the component attribute, adds the
+// attributes carried by ctx and logs it
+func log(ctx context.Context, lvl slog.Level, msg string, attrs ...slog.Attr) {
+	l := Logger()
+	if m := tag.FindStringSubmatch(msg); m != nil {
+		if tagLvl, ok := tagLevels[m[1]]; ok {
+			if lvl == slog.LevelInfo {
+				lvl = tagLvl
+			}
+		} else {
+			attrs = append(attrs, slog.String("component", m[1]))
+		}
+		msg = msg[len(m[0]):]
+	}
+	if !l.Enabled(ctx, lvl) {
+		return
+	}
+	l.LogAttrs(ctx, lvl, msg, append(contextAttrs(ctx), attrs...)...)
+}
+
+// textHandler writes the plain "[time] [user] [component] message" lines
+// Aviary has always logged, followed by any other attributes as key=value.
+// Groups are left out; they hold details the message already says, for JSON
+// logs.
+type textHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func (h *textHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return lvl >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var user, component string
+	var extra []slog.Attr
+	collect := func(a slog.Attr) bool {
+		switch a.Key {
+		case "user":
+			user = a.Value.String()
+		case "component":
+			component = a.Value.String()
+		default:
+			if a.Value.Kind() == slog.KindGroup {
+				return true
+			}
+			extra = append(extra, a)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		collect(a)
+	}
+	r.Attrs(collect)
+
+	var b strings.Builder
+	b.WriteString("[" + r.Time.Format(time.RFC3339) + "] ")
+	if user != "" {
+		b.WriteString("[" + user + "] ")
+	}
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("[ERROR] ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("[WARNING] ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("[DEBUG] ")
+	}
+	if component != "" {
+		b.WriteString("[" + component + "] ")
+	}
+	b.WriteString(r.Message)
+	for _, a := range extra {
+		value := a.Value.String()
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + a.Key + "=" + value)
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &textHandler{mu: h.mu, w: h.w, level: h.level, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+// WithGroup isn't supported; attributes are written without the group
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func captureLogs(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	loggerOnce.Do(func() {})
+	prev := logger
+	logger = slog.New(newHandler(&buf, format, slog.LevelInfo))
+	t.Cleanup(func() { logger = prev })
+	return &buf
+}
+
+func TestTextFormat(t *testing.T) {
+	buf := captureLogs(t, "text")
+
+	LogfWithUser("alice", "[UPLOAD] Saved %s", "a.pdf")
+	Logf("[WARNING] Disk %d%% full", 95)
+	ctx := WithJobID(WithRequestID(context.Background(), "req-1"), "job-1")
+	LogfCtx(ctx, "processPDF success: %s", "done")
+	Debugf("hidden")
+
+	want := regexp.MustCompile(`^\[[^\]]+\] \[alice\] \[UPLOAD\] Saved a\.pdf
+\[[^\]]+\] \[WARNING\] Disk 95% full
+\[[^\]]+\] processPDF success: done request_id=req-1 job_id=job-1
+$`)
+	if !want.MatchString(buf.String()) {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := captureLogs(t, "json")
+
+	LogfCtx(WithRequestID(context.Background(), "req-1"), "[ERROR] [RMAPI] Upload failed")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if line["level"] != "ERROR" || line["msg"] != "[RMAPI] Upload failed" || line["request_id"] != "req-1" {
+		t.Errorf("unexpected line: %v", line)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aviary.log")
+	r, err := openRotatingFile(path, rotateOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := r.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+		// Rotated files are named by the time, to the millisecond
+		time.Sleep(2 * time.Millisecond)
+	}
+	r.file.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "12345678\n" {
+		t.Errorf("current file = %q, %v; want the last line only", data, err)
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Errorf("kept %d rotated files, want 2: %v", len(rotated), rotated)
+	}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header a request's ID is read from and returned in
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from clients or proxies to
+// ones that are safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+const quietKey = "logging_quiet"
+
+// Quiet logs a route's successful requests at debug level, for ones such as
+// health probes that would otherwise flood the log
+func Quiet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(quietKey, true)
+		c.Next()
+	}
+}
+
+// Middleware gives every request an ID, taken from X-Request-ID when the
+// client or a proxy sent a usable one, returns it in the response and puts it
+// in the request's context so log lines for the request carry it. Once the
+// request is done it logs the request in place of gin's logger.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		status := c.Writer.Status()
+		latency := time.Since(start)
+		lvl := slog.LevelInfo
+		if c.GetBool(quietKey) {
+			lvl = slog.LevelDebug
+		}
+		if status >= 500 {
+			lvl = slog.LevelError
+		}
+		log(c.Request.Context(), lvl, fmt.Sprintf("[HTTP] %s %s %d %v", c.Request.Method, path, status, latency),
+			slog.Group("http",
+				slog.String("method", c.Request.Method),
+				slog.String("path", path),
+				slog.Int("status", status),
+				slog.Int64("latency_ms", latency.Milliseconds()),
+				slog.String("client_ip", c.ClientIP()),
+			),
+		)
+	}
+}
@@ -0,0 +1,122 @@
+// Package maintenance tracks whether new jobs may be submitted. Admins can turn
+// maintenance mode on via the maintenance_mode system setting, and restores turn
+// it on automatically while they import data, as does shutting down. Jobs that
+// are already running are allowed to finish; only new submissions are rejected.
+package maintenance
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// SettingKey is the system setting that enables maintenance mode
+const SettingKey = "maintenance_mode"
+
+const (
+	// ReasonAdmin means an admin enabled maintenance mode
+	ReasonAdmin = "admin"
+	// ReasonRestore means a restore is importing data
+	ReasonRestore = "restore"
+	// ReasonShutdown means Aviary is shutting down
+	ReasonShutdown = "shutdown"
+)
+
+var (
+	shuttingDown atomic.Bool
+	restores     atomic.Int32
+	activeJobs   atomic.Int64
+
+	userJobsMu sync.Mutex
+	userJobs   = make(map[uuid.UUID]int)
+)
+
+// Status returns whether maintenance mode is active and why
+func Status() (bool, string) {
+	if shuttingDown.Load() {
+		return true, ReasonShutdown
+	}
+	if restores.Load() > 0 {
+		return true, ReasonRestore
+	}
+	if database.IsMultiUserMode() && database.DB != nil {
+		if value, err := database.GetSystemSetting(SettingKey); err == nil && value == "true" {
+			return true, ReasonAdmin
+		}
+	}
+	return false, ""
+}
+
+// Enabled reports whether new jobs should be rejected
+func Enabled() bool {
+	enabled, _ := Status()
+	return enabled
+}
+
+// BeginRestore enables maintenance mode until the returned func is called
+func BeginRestore() func() {
+	restores.Add(1)
+	logging.Logf("[MAINTENANCE] Entering maintenance mode for restore")
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			restores.Add(-1)
+			logging.Logf("[MAINTENANCE] Restore finished, leaving maintenance mode")
+		})
+	}
+}
+
+// BeginShutdown enables maintenance mode for good, so running jobs can finish
+// before Aviary exits
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// TrackJob records a running job for userID until the returned func is called
+func TrackJob(userID uuid.UUID) func() {
+	activeJobs.Add(1)
+	userJobsMu.Lock()
+	userJobs[userID]++
+	userJobsMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			activeJobs.Add(-1)
+			userJobsMu.Lock()
+			if userJobs[userID]--; userJobs[userID] <= 0 {
+				delete(userJobs, userID)
+			}
+			userJobsMu.Unlock()
+		})
+	}
+}
+
+// ActiveJobs returns the number of jobs currently running
+func ActiveJobs() int64 {
+	return activeJobs.Load()
+}
+
+// ActiveUserJobs returns the number of jobs currently running for userID
+func ActiveUserJobs(userID uuid.UUID) int {
+	userJobsMu.Lock()
+	defer userJobsMu.Unlock()
+	return userJobs[userID]
+}
+
+// WaitForJobs waits up to timeout for running jobs to finish and reports
+// whether they all did
+func WaitForJobs(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for activeJobs.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package manager
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,9 +14,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
 	"github.com/rmitchellscott/aviary/internal/auth"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
 	"github.com/rmitchellscott/aviary/internal/rmapi"
 	"gorm.io/gorm"
 )
@@ -23,6 +26,23 @@ import (
 // Global instance of user folder cache service
 var userFolderCacheService *UserFolderCacheService
 
+// tabletReachable reports whether Aviary can reach the user's tablet, either
+// through a paired rmapi or directly over USB or SSH
+func tabletReachable(userID uuid.UUID) bool {
+	if rmapi.IsUserPaired(userID) {
+		return true
+	}
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, err := database.NewUserService(database.DB).GetUserByID(userID)
+		if err != nil {
+			return false
+		}
+		user = u
+	}
+	return delivery.ForUser(user).Offline()
+}
+
 // isConfigFileValid checks if an rmapi config file exists and has content
 func isConfigFileValid(configPath string) bool {
 	// In DRY_RUN mode, always consider config as valid
@@ -64,7 +84,7 @@ func RefreshUserFolderCache(userID string) error {
 	}
 
 	// Check if user is paired before attempting refresh
-	if !rmapi.IsUserPaired(uuid) {
+	if !tabletReachable(uuid) {
 		return fmt.Errorf("user %s not paired", userID)
 	}
 
@@ -72,9 +92,43 @@ func RefreshUserFolderCache(userID string) error {
 	return err
 }
 
+// QueueFolderCacheRefresh schedules background folder cache refreshes for the
+// given users, or for all paired users when none are given
+func QueueFolderCacheRefresh(userIDs []uuid.UUID) int {
+	if userFolderCacheService == nil {
+		return 0 // Not in multi-user mode or not initialized
+	}
+	return userFolderCacheService.QueueRefresh(userIDs)
+}
+
+// RefreshAllFoldersHandler queues folder cache refreshes for every paired user (admin only)
+func RefreshAllFoldersHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder cache refresh not available in single-user mode"})
+		return
+	}
+
+	if _, ok := auth.RequireAdmin(c); !ok {
+		return
+	}
+
+	queued := QueueFolderCacheRefresh(nil)
+	Logf("Queued folder cache refresh for %d users", queued)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"queued":  queued,
+	})
+}
+
 // ListFolders returns a slice of all folder paths on the reMarkable device.
 // Paths are returned with a leading slash, e.g. "/Books/Fiction".
 func ListFolders(user *database.User) ([]string, error) {
+	// Tablets kept offline are read directly over USB or SSH
+	if target := delivery.ForUser(user); target.Offline() {
+		return delivery.ListFolders(context.Background(), target)
+	}
+
 	// Check pairing status based on mode
 	if database.IsMultiUserMode() {
 		if user != nil && !rmapi.IsUserPaired(user.ID) {
@@ -215,3 +269,64 @@ func FoldersHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"folders": dirs})
 }
+
+// CreateFolderRequest creates the folder Name inside Parent (default "/")
+type CreateFolderRequest struct {
+	Parent string `json:"parent"`
+	Name   string `json:"name" binding:"required"`
+}
+
+// FolderNode is a folder in the folder tree
+type FolderNode struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Parent string `json:"parent"`
+}
+
+// CreateFolderHandler creates a folder on the user's reMarkable cloud, along
+// with any missing parents, and adds it to the cached folder listing so it
+// can be picked as a destination straight away
+func CreateFolderHandler(c *gin.Context) {
+	var req CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "name is required")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "name must be a single folder name")
+		return
+	}
+	parent, err := cleanRemotePath(req.Parent)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	user, ok := remoteUser(c)
+	if !ok {
+		return
+	}
+
+	p := path.Join(parent, name)
+	if err := MakeFolder(p, user); err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to create folder %s: %v", p, err)
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to create "+p)
+		return
+	}
+	auditRemote(c, user, "created folder %s on the reMarkable cloud", p)
+	folderCreated(user, p)
+	c.JSON(http.StatusCreated, gin.H{"folder": FolderNode{Path: p, Name: name, Parent: parent}})
+}
+
+// folderCreated adds the folder p to the user's cached folder listing
+func folderCreated(user *database.User, p string) {
+	if user == nil {
+		addCachedFolder(p)
+		return
+	}
+	if userFolderCacheService != nil {
+		if err := userFolderCacheService.AddFolder(user.ID, p); err != nil {
+			LogfWithUser(user, "folder cache update failed: %v", err)
+		}
+	}
+}
@@ -2,13 +2,13 @@ package manager
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rmitchellscott/aviary/internal/config"
-	"github.com/rmitchellscott/aviary/internal/rmapi"
 )
 
 // folderCache stores the cached folder listing
@@ -64,7 +64,7 @@ func StartFolderCache() {
 // RefreshFolderCache manually triggers a folder cache refresh (single-user mode)
 func RefreshFolderCache() error {
 	// Check if single user is paired before attempting refresh
-	if !rmapi.IsUserPaired(uuid.Nil) {
+	if !tabletReachable(uuid.Nil) {
 		return fmt.Errorf("single user not paired")
 	}
 	return refreshFolderCache()
@@ -74,7 +74,7 @@ func RefreshFolderCache() error {
 // in the global cache.
 func refreshFolderCache() error {
 	// Check if single user is paired before attempting refresh
-	if !rmapi.IsUserPaired(uuid.Nil) {
+	if !tabletReachable(uuid.Nil) {
 		return fmt.Errorf("single user not paired")
 	}
 
@@ -128,3 +128,44 @@ func maybeRefreshFolderCache() {
 		}
 	}()
 }
+
+// insertFolder returns folders with p and any of its missing parents added,
+// each after the last folder already under its parent so the listing keeps
+// its depth-first order
+func insertFolder(folders []string, p string) []string {
+	current := ""
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		parent := current
+		if parent == "" {
+			parent = "/"
+		}
+		current += "/" + part
+		at, found := len(folders), false
+		for i, f := range folders {
+			if f == current {
+				found = true
+				break
+			}
+			if f == parent || strings.HasPrefix(f, strings.TrimSuffix(parent, "/")+"/") {
+				at = i + 1
+			}
+		}
+		if found {
+			continue
+		}
+		folders = append(folders, "")
+		copy(folders[at+1:], folders[at:])
+		folders[at] = current
+	}
+	return folders
+}
+
+// addCachedFolder adds p to the single-user folder cache, if it holds a
+// listing, without refreshing it from the device
+func addCachedFolder(p string) {
+	globalFoldersCache.mu.Lock()
+	defer globalFoldersCache.mu.Unlock()
+	if len(globalFoldersCache.folders) > 0 {
+		globalFoldersCache.folders = insertFolder(globalFoldersCache.folders, p)
+	}
+}
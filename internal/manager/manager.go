@@ -1,20 +1,24 @@
 package manager
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/procstats"
 	"github.com/rmitchellscott/aviary/internal/rmapi"
 	"github.com/rmitchellscott/aviary/internal/storage"
 )
@@ -25,6 +29,34 @@ type UploadOptions struct {
 	Coverpage          string
 	Contrast           string
 	CurrentPage        string
+	// Timeout limits the upload to the tablet; zero means no limit
+	Timeout time.Duration
+	// Deadline is when the whole job must be done; zero means no deadline
+	Deadline time.Time
+	// Usage, when set, collects the CPU time and memory rmapi used
+	Usage *procstats.Usage
+	// Context, when set, stops the upload once it's done, e.g. when the job
+	// is cancelled
+	Context context.Context
+}
+
+var (
+	// ErrUploadTimeout is returned when the upload to the tablet exceeds its timeout
+	ErrUploadTimeout = errors.New("upload timed out")
+	// ErrJobTimeout is returned when the job's deadline passes before or during the upload
+	ErrJobTimeout = errors.New("job timed out")
+)
+
+// uploadTimeout returns how long the upload may take, which is opts.Timeout
+// cut short by the job deadline, and the error to report when it runs out
+func (opts UploadOptions) uploadTimeout() (time.Duration, error) {
+	timeout, timeoutErr := opts.Timeout, ErrUploadTimeout
+	if !opts.Deadline.IsZero() {
+		if remaining := time.Until(opts.Deadline); timeout <= 0 || remaining < timeout {
+			timeout, timeoutErr = remaining, ErrJobTimeout
+		}
+	}
+	return timeout, timeoutErr
 }
 
 // ExecCommand is exec.Command by default, but can be overridden in tests.
@@ -63,13 +95,14 @@ func filterEnv(env []string, prefix string) []string {
 }
 
 func Logf(format string, v ...interface{}) {
-	fmt.Printf("[%s] "+format+"\n", append([]interface{}{time.Now().Format(time.RFC3339)}, v...)...)
+	logging.Logf(format, v...)
 }
 
 // LogfWithUser logs a message with username prefix in multi-user mode
 func LogfWithUser(user *database.User, format string, v ...interface{}) {
 	if database.IsMultiUserMode() && user != nil {
-		format = "[" + user.Username + "] " + format
+		logging.LogfWithUser(user.Username, format, v...)
+		return
 	}
 	Logf(format, v...)
 }
@@ -166,11 +199,8 @@ func RenameStorage(ctx context.Context, srcKey, prefix string, userID uuid.UUID)
 	return withYearKey, nil
 }
 
-// buildPutArgs constructs the rmapi put argument list from user settings and request options.
-func buildPutArgs(path string, user *database.User, opts UploadOptions) []string {
-	args := []string{"put"}
-	ext := strings.ToLower(filepath.Ext(path))
-
+// effectiveCoverpage resolves the coverpage setting from the request, user and environment.
+func effectiveCoverpage(user *database.User, opts UploadOptions) string {
 	coverpageSetting := opts.Coverpage
 	if coverpageSetting == "" && user != nil {
 		coverpageSetting = user.CoverpageSetting
@@ -182,10 +212,12 @@ func buildPutArgs(path string, user *database.User, opts UploadOptions) []string
 			coverpageSetting = "current"
 		}
 	}
-	if coverpageSetting == "first" {
-		args = append(args, "--coverpage=1")
-	}
+	return coverpageSetting
+}
 
+// RequestedConflictResolution returns the conflict resolution asked for by the
+// request, user or environment, before it is adjusted for the file type
+func RequestedConflictResolution(user *database.User, opts UploadOptions) string {
 	conflictResolution := opts.ConflictResolution
 	if conflictResolution == "" && user != nil {
 		conflictResolution = user.ConflictResolution
@@ -193,11 +225,41 @@ func buildPutArgs(path string, user *database.User, opts UploadOptions) []string
 	if conflictResolution == "" {
 		conflictResolution = config.Get("RMAPI_CONFLICT_RESOLUTION", "abort")
 	}
-	effectiveConflictResolution := conflictResolution
-	if conflictResolution == "content_only" && ext != ".pdf" {
-		effectiveConflictResolution = "abort"
+	return conflictResolution
+}
+
+// effectiveConflictResolution resolves the conflict resolution for path from the
+// request, user and environment. content_only only applies to PDFs.
+func effectiveConflictResolution(path string, user *database.User, opts UploadOptions) string {
+	conflictResolution := RequestedConflictResolution(user, opts)
+	if conflictResolution == "content_only" && strings.ToLower(filepath.Ext(path)) != ".pdf" {
+		return "abort"
+	}
+	return conflictResolution
+}
+
+// CheckBackendSupport returns an *rmapi.UnsupportedError when opts, or the
+// defaults they fall back to, ask for something the user's reMarkable cloud
+// host can't do, so the job fails before any work is done
+func CheckBackendSupport(user *database.User, opts UploadOptions) error {
+	if delivery.ForUser(user).Offline() {
+		return nil
+	}
+	caps := rmapi.GetCapabilities(context.Background(), rmapi.HostFor(user))
+	// content_only is only dropped for non-PDFs, so check it as if uploading a PDF
+	return caps.Check(effectiveConflictResolution("document.pdf", user, opts), effectiveCoverpage(user, opts))
+}
+
+// buildPutArgs constructs the rmapi put argument list from user settings and request options.
+func buildPutArgs(path string, user *database.User, opts UploadOptions) []string {
+	args := []string{"put"}
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if effectiveCoverpage(user, opts) == "first" {
+		args = append(args, "--coverpage=1")
 	}
-	switch effectiveConflictResolution {
+
+	switch effectiveConflictResolution(path, user, opts) {
 	case "overwrite":
 		args = append(args, "--force")
 	case "content_only":
@@ -225,13 +287,23 @@ func buildPutArgs(path string, user *database.User, opts UploadOptions) []string
 }
 
 // runPutCommand executes rmapi put and returns the parsed result.
-func runPutCommand(path, rmDir string, user *database.User, args []string) (string, error) {
+func runPutCommand(ctx context.Context, path, rmDir string, user *database.User, args []string, usage *procstats.Usage) (string, error) {
 	args = append(args, path, rmDir)
 	cmd, cleanup := rmapi.NewCommand(user, args...)
 	defer cleanup()
-	out, err := cmd.CombinedOutput()
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("rmapi put failed: %w", err)
+	}
+	// Kill rmapi if the upload outlives ctx
+	stop := context.AfterFunc(ctx, func() { cmd.Process.Kill() })
+	defer stop()
+	err := cmd.Wait()
+	procstats.Record(usage, "rmapi", cmd.ProcessState)
 	if err != nil {
-		raw := strings.TrimSpace(string(out))
+		raw := strings.TrimSpace(out.String())
 		if idx := strings.Index(raw, "Error:"); idx != -1 {
 			return "", fmt.Errorf("%s", raw[idx:])
 		}
@@ -241,10 +313,52 @@ func runPutCommand(path, rmDir string, user *database.User, args []string) (stri
 	return remoteName, nil
 }
 
-// SimpleUpload calls `rmapi put` and returns the uploaded filename or a detailed error.
+// uploadFile sends path to rmDir with the user's delivery method: `rmapi put`
+// through the reMarkable cloud, or the tablet's USB web interface or SSH for
+// tablets kept offline.
+func uploadFile(path, rmDir string, user *database.User, opts UploadOptions) (string, error) {
+	timeout, timeoutErr := opts.uploadTimeout()
+	if timeoutErr == ErrJobTimeout && timeout <= 0 {
+		return "", ErrJobTimeout
+	}
+	ctx := context.Background()
+	if opts.Context != nil {
+		ctx = opts.Context
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var (
+		remoteName string
+		err        error
+	)
+	if target := delivery.ForUser(user); !target.Offline() {
+		args := buildPutArgs(path, user, opts)
+		remoteName, err = runPutCommand(ctx, path, rmDir, user, args, opts.Usage)
+	} else {
+		remoteName, err = delivery.Upload(ctx, target, path, rmDir, delivery.Options{
+			ConflictResolution: effectiveConflictResolution(path, user, opts),
+			CoverFirstPage:     effectiveCoverpage(user, opts) == "first",
+		})
+	}
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return "", ctx.Err()
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if timeoutErr == ErrJobTimeout {
+			return "", ErrJobTimeout
+		}
+		return "", fmt.Errorf("%w after %s", ErrUploadTimeout, timeout)
+	}
+	return remoteName, err
+}
+
+// SimpleUpload uploads path to the tablet and returns the uploaded filename or a detailed error.
 func SimpleUpload(path, rmDir string, user *database.User, opts UploadOptions) (string, error) {
-	args := buildPutArgs(path, user, opts)
-	return runPutCommand(path, rmDir, user, args)
+	return uploadFile(path, rmDir, user, opts)
 }
 
 // RenameAndUpload takes a storage key, renames it in storage, uploads via rmapi, and creates archival copy
@@ -283,9 +397,8 @@ func RenameAndUpload(storageKey, prefix, rmDir string, user *database.User, opts
 		return "", fmt.Errorf("failed to download from storage: %w", err)
 	}
 
-	// Upload via rmapi
-	args := buildPutArgs(tempFilePath, user, opts)
-	_, err = runPutCommand(tempFilePath, rmDir, user, args)
+	// Upload to the tablet
+	_, err = uploadFile(tempFilePath, rmDir, user, opts)
 	if err != nil {
 		return "", err
 	}
@@ -308,6 +421,11 @@ func RenameAndUpload(storageKey, prefix, rmDir string, user *database.User, opts
 }
 
 func CleanupOld(prefix, rmDir string, retentionDays int, user *database.User) error {
+	if delivery.ForUser(user).Offline() {
+		Logf("[cleanup] skipped: managed cleanup needs the reMarkable cloud")
+		return nil
+	}
+
 	today := time.Now()
 	cutoff := today.AddDate(0, 0, -retentionDays)
 
@@ -338,36 +456,18 @@ func CleanupOld(prefix, rmDir string, retentionDays int, user *database.User) er
 		return fmt.Errorf("failed to parse rmapi ls --json output: %w", err)
 	}
 
-	// 2) Compile date regex
-	var dateRe *regexp.Regexp
-	if prefix != "" {
-		dateRe = regexp.MustCompile(
-			`^` + regexp.QuoteMeta(prefix+` `) + `([A-Za-z]+)\s+(\d+)(?:\.\w+)?$`,
-		)
-	} else {
-		dateRe = regexp.MustCompile(
-			`^([A-Za-z]+)\s+(\d+)(?:\.\w+)?$`,
-		)
-	}
-
-	// 3) Check each file entry
+	// 2) Check each file entry
 	for _, entry := range entries {
 		if entry.Type != "DocumentType" {
 			continue
 		}
 
-		md := dateRe.FindStringSubmatch(entry.Name)
-		if md == nil {
-			continue
-		}
-		monthStr, dayStr := md[1], md[2]
-
-		t, err := time.Parse("January 2", monthStr+" "+dayStr)
-		if err != nil {
-			Logf("  ↳ parse error: %v", err)
+		// Dates may use English or localized month names, in either order
+		month, day, ok := managedDocumentDate(entry.Name, prefix)
+		if !ok {
 			continue
 		}
-		fileDate := time.Date(today.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		fileDate := time.Date(today.Year(), month, day, 0, 0, 0, 0, time.Local)
 		if fileDate.After(today) {
 			fileDate = fileDate.AddDate(-1, 0, 0)
 		}
@@ -3,9 +3,9 @@ package manager
 import (
 	"fmt"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRenameFilenameGeneration(t *testing.T) {
@@ -66,58 +66,182 @@ func TestAppendYearFilenameGeneration(t *testing.T) {
 	}
 }
 
-func TestCleanupRegexMatchesExtensions(t *testing.T) {
+func TestManagedDocumentDateMatchesExtensions(t *testing.T) {
 	tests := []struct {
 		name    string
 		prefix  string
 		fname   string
-		wantMon string
-		wantDay string
+		wantMon time.Month
+		wantDay int
 	}{
-		{"pdf with prefix", "Notes", "Notes March 5.pdf", "March", "5"},
-		{"epub with prefix", "Notes", "Notes March 5.epub", "March", "5"},
-		{"no ext with prefix", "Notes", "Notes March 5", "March", "5"},
-		{"pdf no prefix", "", "March 5.pdf", "March", "5"},
-		{"epub no prefix", "", "March 5.epub", "March", "5"},
-		{"no ext no prefix", "", "March 5", "March", "5"},
+		{"pdf with prefix", "Notes", "Notes March 5.pdf", time.March, 5},
+		{"epub with prefix", "Notes", "Notes March 5.epub", time.March, 5},
+		{"no ext with prefix", "Notes", "Notes March 5", time.March, 5},
+		{"pdf no prefix", "", "March 5.pdf", time.March, 5},
+		{"epub no prefix", "", "March 5.epub", time.March, 5},
+		{"no ext no prefix", "", "March 5", time.March, 5},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var dateRe *regexp.Regexp
-			if tt.prefix != "" {
-				dateRe = regexp.MustCompile(
-					`^` + regexp.QuoteMeta(tt.prefix+` `) + `([A-Za-z]+)\s+(\d+)(?:\.\w+)?$`,
-				)
-			} else {
-				dateRe = regexp.MustCompile(
-					`^([A-Za-z]+)\s+(\d+)(?:\.\w+)?$`,
-				)
-			}
-			md := dateRe.FindStringSubmatch(tt.fname)
-			if md == nil {
-				t.Fatalf("regex did not match %q", tt.fname)
+			month, day, ok := managedDocumentDate(tt.fname, tt.prefix)
+			if !ok {
+				t.Fatalf("managedDocumentDate did not match %q", tt.fname)
 			}
-			if md[1] != tt.wantMon {
-				t.Errorf("month: got %q, want %q", md[1], tt.wantMon)
+			if month != tt.wantMon {
+				t.Errorf("month: got %v, want %v", month, tt.wantMon)
 			}
-			if md[2] != tt.wantDay {
-				t.Errorf("day: got %q, want %q", md[2], tt.wantDay)
+			if day != tt.wantDay {
+				t.Errorf("day: got %d, want %d", day, tt.wantDay)
 			}
 		})
 	}
 }
 
 func TestCleanupRegexRejectsNonMatches(t *testing.T) {
-	dateRe := regexp.MustCompile(`^([A-Za-z]+)\s+(\d+)(?:\.\w+)?$`)
 	nonMatches := []string{
 		"random file.pdf",
 		"March 5 2026.pdf",
 		"12 March.pdf",
 	}
 	for _, s := range nonMatches {
-		if dateRe.FindStringSubmatch(s) != nil {
-			t.Errorf("regex should not match %q", s)
+		if _, _, ok := managedDocumentDate(s, ""); ok {
+			t.Errorf("managedDocumentDate should not match %q", s)
+		}
+	}
+}
+
+func TestManagedDocumentDateRejectsMonthLikeWords(t *testing.T) {
+	for _, name := range []string{
+		"Notes Julian 5",
+		"Notes Juniper 5",
+		"Notes Augusta 5",
+		"Notes Marcher 5",
+		"Notes 5 Mayday",
+		"Notes Octopus 5",
+		"Notes Decembers 5",
+	} {
+		if _, _, ok := managedDocumentDate(name, "Notes"); ok {
+			t.Errorf("managedDocumentDate should not match %q", name)
+		}
+	}
+}
+
+func TestManagedDocumentDateLocalized(t *testing.T) {
+	t.Setenv("MANAGED_DATE_LANGUAGES", "en,de,fr,es,pl,fi,ja,ko")
+	tests := []struct {
+		prefix    string
+		name      string
+		wantMonth time.Month
+		wantDay   int
+	}{
+		{"Notes", "Notes October 16.pdf", time.October, 16},
+		{"Notes", "Notes 16. Oktober", time.October, 16},
+		{"Notes", "Notes 16 Oktober", time.October, 16},
+		{"", "16 octobre.pdf", time.October, 16},
+		{"", "16 de octubre", time.October, 16},
+		{"", "16 października", time.October, 16},
+		{"", "16 pazdziernika", time.October, 16},
+		{"", "16. lokakuuta", time.October, 16},
+		{"Daily", "Daily 3. März", time.March, 3},
+		{"Daily", "Daily 3. marz", time.March, 3},
+		{"", "10月16日", time.October, 16},
+		{"", "10월 16일", time.October, 16},
+	}
+	for _, tt := range tests {
+		month, day, ok := managedDocumentDate(tt.name, tt.prefix)
+		if !ok || month != tt.wantMonth || day != tt.wantDay {
+			t.Errorf("managedDocumentDate(%q, %q) = %v %d %v, want %v %d", tt.name, tt.prefix, month, day, ok, tt.wantMonth, tt.wantDay)
+		}
+	}
+}
+
+func TestManagedDocumentDateRejectsNonMatches(t *testing.T) {
+	t.Setenv("MANAGED_DATE_LANGUAGES", "en,de,fr,es,it,pt,pl,sv,fi")
+	for _, name := range []string{
+		"Notes random file.pdf",
+		"Notes October 16 2025.pdf",
+		"Notes February 30",
+		"Other October 16",
+		"Notes Ma 16",
+		// Abbreviations, many of which are ordinary words
+		"Notes Oct 16",
+		"Notes Sept. 5",
+		"Notes set 5",
+		"Notes 5 set",
+		"Notes out 5",
+		"Notes 5 gen",
+		"Notes mag 5",
+		"Notes 5 des",
+		"Notes lip 5",
+		"Notes 5 lis",
+		"Notes sie 5",
+		"Notes ago 5",
+		// Month names in the other language's order
+		"Notes 16 October",
+		"Notes Oktober 16",
+		"Notes octobre 16",
+		// A connector only where the language uses one
+		"Notes 16 de October",
+		"Notes 16 del octubre",
+		"Notes 16 de octobre",
+		// Dates in languages that aren't configured
+		"Notes 16 maart",
+		"Notes 10月16日",
+	} {
+		if _, _, ok := managedDocumentDate(name, "Notes"); ok {
+			t.Errorf("managedDocumentDate should not match %q", name)
+		}
+	}
+}
+
+func TestManagedDateLanguages(t *testing.T) {
+	t.Setenv("MANAGED_DATE_LANGUAGES", "")
+	t.Setenv("DEFAULT_LANGUAGE", "")
+	if _, _, ok := managedDocumentDate("Notes 16. Oktober", "Notes"); ok {
+		t.Error("German date matched with only English configured")
+	}
+	t.Setenv("DEFAULT_LANGUAGE", "de")
+	if _, _, ok := managedDocumentDate("Notes 16. Oktober", "Notes"); !ok {
+		t.Error("German date not matched with DEFAULT_LANGUAGE=de")
+	}
+	if _, _, ok := managedDocumentDate("Notes October 16", "Notes"); !ok {
+		t.Error("English date not matched with DEFAULT_LANGUAGE=de")
+	}
+}
+
+func TestUploadTimeoutCappedByDeadline(t *testing.T) {
+	opts := UploadOptions{Timeout: time.Hour}
+	if timeout, err := opts.uploadTimeout(); timeout != time.Hour || err != ErrUploadTimeout {
+		t.Errorf("no deadline: got %s %v", timeout, err)
+	}
+
+	opts.Deadline = time.Now().Add(time.Minute)
+	if timeout, err := opts.uploadTimeout(); timeout > time.Minute || err != ErrJobTimeout {
+		t.Errorf("deadline before timeout: got %s %v", timeout, err)
+	}
+
+	opts = UploadOptions{Deadline: time.Now().Add(-time.Second)}
+	if timeout, err := opts.uploadTimeout(); timeout > 0 || err != ErrJobTimeout {
+		t.Errorf("deadline passed: got %s %v", timeout, err)
+	}
+}
+
+func TestInsertFolder(t *testing.T) {
+	folders := []string{"/", "/Books", "/Books/Fiction", "/Work"}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/Books/Poetry", []string{"/", "/Books", "/Books/Fiction", "/Books/Poetry", "/Work"}},
+		{"/Notes", []string{"/", "/Books", "/Books/Fiction", "/Work", "/Notes"}},
+		{"/Work/2026/Q1", []string{"/", "/Books", "/Books/Fiction", "/Work", "/Work/2026", "/Work/2026/Q1"}},
+		{"/Books/Fiction", folders},
+	}
+	for _, tt := range tests {
+		got := insertFolder(append([]string(nil), folders...), tt.path)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("insertFolder(%q) = %v, want %v", tt.path, got, tt.want)
 		}
 	}
 }
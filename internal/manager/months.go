@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// dateLanguage is how one language writes the day and month in a managed
+// document's name. Only full month names are matched, never abbreviations,
+// since short forms such as "set", "out" or "mag" are ordinary words and
+// cleanup removes every document it matches.
+type dateLanguage struct {
+	// months are the full month names as written in a date, which in some
+	// languages is an inflected form, e.g. Polish "października"
+	months [12]string
+	// dayFirst is set for languages that write "16 octobre" rather than
+	// "October 16"
+	dayFirst bool
+	// connector is a word between the day and month, e.g. "de" in Spanish
+	connector string
+	// numeric languages write 10月16日 instead of a month name
+	numeric bool
+}
+
+// dateLanguages are the languages the UI is translated into
+var dateLanguages = map[string]dateLanguage{
+	"en":    {months: [12]string{"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"}},
+	"de":    {months: [12]string{"januar", "februar", "märz", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "dezember"}, dayFirst: true},
+	"nl":    {months: [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"}, dayFirst: true},
+	"da":    {months: [12]string{"januar", "februar", "marts", "april", "maj", "juni", "juli", "august", "september", "oktober", "november", "december"}, dayFirst: true},
+	"no":    {months: [12]string{"januar", "februar", "mars", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "desember"}, dayFirst: true},
+	"sv":    {months: [12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"}, dayFirst: true},
+	"fi":    {months: [12]string{"tammikuuta", "helmikuuta", "maaliskuuta", "huhtikuuta", "toukokuuta", "kesäkuuta", "heinäkuuta", "elokuuta", "syyskuuta", "lokakuuta", "marraskuuta", "joulukuuta"}, dayFirst: true},
+	"fr":    {months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}, dayFirst: true},
+	"es":    {months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}, dayFirst: true, connector: "de"},
+	"it":    {months: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"}, dayFirst: true},
+	"pt":    {months: [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"}, dayFirst: true, connector: "de"},
+	"pl":    {months: [12]string{"stycznia", "lutego", "marca", "kwietnia", "maja", "czerwca", "lipca", "sierpnia", "września", "października", "listopada", "grudnia"}, dayFirst: true},
+	"ja":    {numeric: true},
+	"zh-CN": {numeric: true},
+	"ko":    {numeric: true},
+}
+
+// managedDateLanguages returns the languages cleanup recognises dates in:
+// MANAGED_DATE_LANGUAGES, or English, which Aviary names managed uploads in,
+// plus DEFAULT_LANGUAGE
+func managedDateLanguages() []dateLanguage {
+	codes := config.Get("MANAGED_DATE_LANGUAGES", "")
+	if codes == "" {
+		codes = "en," + config.Get("DEFAULT_LANGUAGE", "")
+	}
+	var langs []dateLanguage
+	for _, code := range strings.Split(codes, ",") {
+		if lang, ok := dateLanguages[strings.TrimSpace(code)]; ok {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+var accentFolder = strings.NewReplacer(
+	"ä", "a", "å", "a", "ą", "a", "à", "a", "á", "a", "ç", "c", "ć", "c",
+	"é", "e", "è", "e", "ę", "e", "ł", "l", "ń", "n", "ö", "o", "ø", "o",
+	"ó", "o", "ś", "s", "û", "u", "ü", "u", "ź", "z", "ż", "z",
+)
+
+// foldAccents removes the diacritics used in month names
+func foldAccents(s string) string {
+	return accentFolder.Replace(s)
+}
+
+// month resolves a full month name, matched case-insensitively and with or
+// without accents
+func (l dateLanguage) month(token string) (time.Month, bool) {
+	token = foldAccents(strings.ToLower(token))
+	for i, name := range l.months {
+		if token == foldAccents(name) {
+			return time.Month(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// cjkDateRe matches the Japanese/Chinese (10月16日) and Korean (10월 16일) forms
+var cjkDateRe = regexp.MustCompile(`^(\d{1,2})\s*[月월]\s*(\d{1,2})\s*[日일]?$`)
+
+// extensionRe matches a trailing file extension
+var extensionRe = regexp.MustCompile(`\.\w+$`)
+
+// parse parses s as a date written the language's way, such as
+// "October 16", "16. Oktober", "16 de octubre" or "10月16日"
+func (l dateLanguage) parse(s string) (time.Month, int, bool) {
+	if l.numeric {
+		md := cjkDateRe.FindStringSubmatch(s)
+		if md == nil {
+			return 0, 0, false
+		}
+		month, _ := strconv.Atoi(md[1])
+		day, _ := strconv.Atoi(md[2])
+		return validMonthDay(time.Month(month), day)
+	}
+
+	fields := strings.Fields(s)
+	if !l.dayFirst {
+		if len(fields) != 2 {
+			return 0, 0, false
+		}
+		month, ok := l.month(fields[0])
+		day, err := strconv.Atoi(fields[1])
+		if !ok || err != nil {
+			return 0, 0, false
+		}
+		return validMonthDay(month, day)
+	}
+
+	if l.connector != "" {
+		if len(fields) != 3 || !strings.EqualFold(fields[1], l.connector) {
+			return 0, 0, false
+		}
+		fields = []string{fields[0], fields[2]}
+	}
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	// German and the Nordic languages write the day as an ordinal, "16."
+	day, err := strconv.Atoi(strings.TrimSuffix(fields[0], "."))
+	month, ok := l.month(fields[1])
+	if !ok || err != nil {
+		return 0, 0, false
+	}
+	return validMonthDay(month, day)
+}
+
+// parseMonthDay parses the date part of a managed document name in any of
+// langs. Names with a year are not accepted, since managed uploads are always
+// named without one.
+func parseMonthDay(s string, langs []dateLanguage) (time.Month, int, bool) {
+	s = strings.TrimSpace(s)
+	for _, lang := range langs {
+		if month, day, ok := lang.parse(s); ok {
+			return month, day, true
+		}
+	}
+	return 0, 0, false
+}
+
+// validMonthDay rejects days that don't exist in month (allowing February 29)
+func validMonthDay(month time.Month, day int) (time.Month, int, bool) {
+	if month < time.January || month > time.December || day < 1 {
+		return 0, 0, false
+	}
+	if t := time.Date(2000, month, day, 0, 0, 0, 0, time.UTC); t.Month() != month {
+		return 0, 0, false
+	}
+	return month, day, true
+}
+
+// managedDocumentDate extracts the month and day from a document named by a
+// managed workflow, i.e. "<prefix> <date>" (or just "<date>" without a prefix)
+// with an optional file extension, in one of the managed date languages.
+func managedDocumentDate(name, prefix string) (time.Month, int, bool) {
+	rest := name
+	if prefix != "" {
+		if !strings.HasPrefix(name, prefix+" ") {
+			return 0, 0, false
+		}
+		rest = strings.TrimPrefix(name, prefix+" ")
+	}
+
+	langs := managedDateLanguages()
+	if month, day, ok := parseMonthDay(rest, langs); ok {
+		return month, day, true
+	}
+	if ext := extensionRe.FindString(rest); ext != "" {
+		return parseMonthDay(strings.TrimSuffix(rest, ext), langs)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,618 @@
+package manager
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// MakeFolder creates rmDir and any missing parents on the reMarkable cloud.
+// Folders that already exist are left alone.
+func MakeFolder(rmDir string, user *database.User) error {
+	current := ""
+	for _, part := range strings.Split(strings.Trim(path.Clean("/"+rmDir), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		current += "/" + part
+		cmd, cleanup := rmapi.NewCommand(user, "mkdir", current)
+		out, err := cmd.CombinedOutput()
+		cleanup()
+		if err != nil && !strings.Contains(strings.ToLower(string(out)), "already exists") {
+			return fmt.Errorf("rmapi mkdir %s failed: %s", current, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// RemoveDocument deletes the document at remotePath from the reMarkable cloud
+func RemoveDocument(remotePath string, user *database.User) error {
+	cmd, cleanup := rmapi.NewCommand(user, "rm", remotePath)
+	defer cleanup()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("rmapi rm %s failed: %s", remotePath, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Types of RemoteEntry
+const (
+	RemoteFolder   = "folder"
+	RemoteDocument = "document"
+)
+
+// RemoteEntry is a folder or document on the reMarkable cloud
+type RemoteEntry struct {
+	ID       string     `json:"id,omitempty"`
+	Name     string     `json:"name"`
+	Path     string     `json:"path"`
+	Type     string     `json:"type"`
+	Modified *time.Time `json:"modified,omitempty"`
+	// DocumentID and UploadDate are set, in multi-user mode, for documents
+	// Aviary uploaded
+	DocumentID string     `json:"document_id,omitempty"`
+	UploadDate *time.Time `json:"upload_date,omitempty"`
+}
+
+// cleanRemotePath returns p as an absolute reMarkable path, such as
+// "/Books/Fiction"
+func cleanRemotePath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", errors.New("path must not contain ..")
+		}
+	}
+	return path.Clean("/" + p), nil
+}
+
+// ListRemote returns the folders and documents directly in dir on the
+// user's reMarkable cloud, folders first and then by name
+func ListRemote(user *database.User, dir string) ([]RemoteEntry, error) {
+	proc, cleanup := rmapi.NewCommand(user, "ls", "--json", dir)
+	defer cleanup()
+	out, err := proc.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var listed []struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		Modified string `json:"modifiedClient"`
+	}
+	if err := json.Unmarshal(out, &listed); err != nil {
+		return nil, fmt.Errorf("failed to parse rmapi ls --json output: %w", err)
+	}
+
+	entries := make([]RemoteEntry, 0, len(listed))
+	for _, l := range listed {
+		entry := RemoteEntry{ID: l.ID, Name: l.Name, Path: path.Join(dir, l.Name), Type: RemoteDocument}
+		if l.Type == "CollectionType" {
+			entry.Type = RemoteFolder
+		}
+		if t, err := time.Parse(time.RFC3339Nano, l.Modified); err == nil {
+			entry.Modified = &t
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == RemoteFolder
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries, nil
+}
+
+// matchUploads links the documents in entries to userID's records of the
+// uploads that put them there
+func matchUploads(userID uuid.UUID, entries []RemoteEntry) {
+	docs, err := database.NewUserService(database.DB).UploadedDocuments(userID)
+	if err != nil {
+		Logf("[BROWSE] Failed to load uploads of user %s: %v", userID, err)
+		return
+	}
+	// The tablet shows documents without their extension; later uploads
+	// to the same path replace earlier ones
+	byPath := make(map[string]database.Document, len(docs))
+	for _, doc := range docs {
+		p := path.Clean("/" + strings.ReplaceAll(doc.RemotePath, `\`, "/"))
+		byPath[strings.TrimSuffix(p, path.Ext(p))] = doc
+	}
+	for i, entry := range entries {
+		if entry.Type != RemoteDocument {
+			continue
+		}
+		if doc, ok := byPath[entry.Path]; ok {
+			entries[i].DocumentID = doc.ID.String()
+			uploaded := doc.UploadDate
+			entries[i].UploadDate = &uploaded
+		}
+	}
+}
+
+// remoteUser returns the user whose reMarkable cloud a request works on,
+// responding with an error if there's none to work on
+func remoteUser(c *gin.Context) (*database.User, bool) {
+	var user *database.User
+	userID := uuid.Nil
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return nil, false
+		}
+		user, userID = u, u.ID
+	}
+	if delivery.ForUser(user).Offline() {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "documents on a tablet reached over USB or SSH can't be browsed")
+		return nil, false
+	}
+	if !rmapi.IsUserPaired(userID) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "not paired with the reMarkable cloud")
+		return nil, false
+	}
+	return user, true
+}
+
+// RemoteDocumentsHandler lists the folders and documents in the folder given
+// by the path query parameter (default "/") on the user's reMarkable cloud
+func RemoteDocumentsHandler(c *gin.Context) {
+	dir, err := cleanRemotePath(c.DefaultQuery("path", "/"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	user, ok := remoteUser(c)
+	if !ok {
+		return
+	}
+
+	entries, err := ListRemote(user, dir)
+	if err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to list %s: %v", dir, err)
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to list "+dir+" on the reMarkable cloud")
+		return
+	}
+	if user != nil {
+		matchUploads(user.ID, entries)
+	}
+	c.JSON(http.StatusOK, gin.H{"path": dir, "entries": entries})
+}
+
+// findRemote returns the entry at p, listing its parent folder
+func findRemote(user *database.User, p string) (RemoteEntry, bool, error) {
+	entries, err := ListRemote(user, path.Dir(p))
+	if err != nil {
+		return RemoteEntry{}, false, err
+	}
+	for _, entry := range entries {
+		if entry.Path == p {
+			return entry, true, nil
+		}
+	}
+	return RemoteEntry{}, false, nil
+}
+
+// MoveRemote moves the document or folder at src to dst on the reMarkable
+// cloud. dst's folder must exist.
+func MoveRemote(user *database.User, src, dst string) error {
+	cmd, cleanup := rmapi.NewCommand(user, "mv", src, dst)
+	defer cleanup()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("rmapi mv %s failed: %s", src, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// moveUploadRecords points userID's records of the uploads under src, the
+// document itself or everything in a folder, at their new place under dst
+func moveUploadRecords(userID uuid.UUID, src, dst string) {
+	docs, err := database.NewUserService(database.DB).UploadedDocuments(userID)
+	if err != nil {
+		Logf("[BROWSE] Failed to load uploads of user %s: %v", userID, err)
+		return
+	}
+	for _, doc := range docs {
+		p := path.Clean("/" + strings.ReplaceAll(doc.RemotePath, `\`, "/"))
+		ext := path.Ext(p)
+		var moved string
+		switch {
+		case strings.TrimSuffix(p, ext) == src:
+			moved = dst + ext
+		case strings.HasPrefix(p, src+"/"):
+			moved = dst + strings.TrimPrefix(p, src)
+		default:
+			continue
+		}
+		if err := database.DB.Model(&database.Document{}).Where("id = ?", doc.ID).Update("remote_path", moved).Error; err != nil {
+			Logf("[BROWSE] Failed to update the path of document %s: %v", doc.ID, err)
+		}
+	}
+}
+
+// foldersChanged refreshes the user's cached folder list after a folder was
+// moved or deleted
+func foldersChanged(user *database.User) {
+	if user != nil {
+		QueueFolderCacheRefresh([]uuid.UUID{user.ID})
+		return
+	}
+	go func() {
+		if err := RefreshFolderCache(); err != nil {
+			Logf("folder cache refresh failed: %v", err)
+		}
+	}()
+}
+
+// auditRemote records a change a user made to their reMarkable cloud
+func auditRemote(c *gin.Context, user *database.User, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if user == nil {
+		Logf("[AUDIT] %s from %s", msg, c.ClientIP())
+		return
+	}
+	method, _ := c.Get("auth_method")
+	Logf("[AUDIT] %s (%s, %v) %s from %s", user.Username, user.ID, method, msg, c.ClientIP())
+}
+
+// remoteEntryFor finds the entry at the cleaned path p for a change to it,
+// responding with an error when p is the root, doesn't exist or can't be
+// listed
+func remoteEntryFor(c *gin.Context, user *database.User, p string) (RemoteEntry, bool) {
+	if p == "/" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "the root folder can't be changed")
+		return RemoteEntry{}, false
+	}
+	entry, found, err := findRemote(user, p)
+	if err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to list %s: %v", path.Dir(p), err)
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to list "+path.Dir(p)+" on the reMarkable cloud")
+		return RemoteEntry{}, false
+	}
+	if !found {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, p+" not found on the reMarkable cloud")
+		return RemoteEntry{}, false
+	}
+	return entry, true
+}
+
+// DeleteRemoteRequest names what to delete. Confirm must repeat the name of
+// the document or folder, so a stray request can't delete the wrong thing.
+type DeleteRemoteRequest struct {
+	Path    string `json:"path" binding:"required"`
+	Confirm string `json:"confirm"`
+}
+
+// DeleteRemoteHandler deletes a document, or an empty folder, from the
+// user's reMarkable cloud
+func DeleteRemoteHandler(c *gin.Context) {
+	var req DeleteRemoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "path is required")
+		return
+	}
+	p, err := cleanRemotePath(req.Path)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	user, ok := remoteUser(c)
+	if !ok {
+		return
+	}
+	entry, ok := remoteEntryFor(c, user, p)
+	if !ok {
+		return
+	}
+	if req.Confirm != entry.Name {
+		apierror.Respond(c, http.StatusBadRequest, "confirmation_required",
+			"confirm must be the name of the "+entry.Type+" to delete", gin.H{"confirm": entry.Name})
+		return
+	}
+
+	if err := RemoveDocument(p, user); err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to delete %s: %v", p, err)
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to delete "+p+"; folders must be empty")
+		return
+	}
+	auditRemote(c, user, "deleted %s %s from the reMarkable cloud", entry.Type, p)
+	if entry.Type == RemoteFolder {
+		foldersChanged(user)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "path": p})
+}
+
+// MoveRemoteRequest moves Path into the folder Destination, optionally
+// renaming it to Name
+type MoveRemoteRequest struct {
+	Path        string `json:"path" binding:"required"`
+	Destination string `json:"destination" binding:"required"`
+	Name        string `json:"name"`
+}
+
+// MoveRemoteHandler moves or renames a document or folder on the user's
+// reMarkable cloud. It won't replace anything already at the new path.
+func MoveRemoteHandler(c *gin.Context) {
+	var req MoveRemoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "path and destination are required")
+		return
+	}
+	src, err := cleanRemotePath(req.Path)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	dstDir, err := cleanRemotePath(req.Destination)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = path.Base(src)
+	}
+	if strings.Contains(name, "/") || name == "." || name == ".." {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "name must not contain /")
+		return
+	}
+	dst := path.Join(dstDir, name)
+	if dst == src {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "destination is the current path")
+		return
+	}
+	if dstDir == src || strings.HasPrefix(dstDir, src+"/") {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "a folder can't be moved into itself")
+		return
+	}
+	user, ok := remoteUser(c)
+	if !ok {
+		return
+	}
+	entry, ok := remoteEntryFor(c, user, src)
+	if !ok {
+		return
+	}
+
+	existing, err := ListRemote(user, dstDir)
+	if err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to list %s: %v", dstDir, err)
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "folder "+dstDir+" not found on the reMarkable cloud")
+		return
+	}
+	for _, e := range existing {
+		if e.Name == name {
+			apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, dst+" already exists")
+			return
+		}
+	}
+
+	if err := MoveRemote(user, src, dst); err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to move %s to %s: %v", src, dst, err)
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to move "+src)
+		return
+	}
+	auditRemote(c, user, "moved %s %s to %s on the reMarkable cloud", entry.Type, src, dst)
+	if user != nil {
+		moveUploadRecords(user.ID, src, dst)
+	}
+	if entry.Type == RemoteFolder {
+		foldersChanged(user)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "path": dst})
+}
+
+// DownloadRemote fetches the document at p from the reMarkable cloud with
+// rmapi get into dir and returns the file it wrote: an .rmdoc, or a .zip from
+// older rmapi versions, holding the document and its annotations
+func DownloadRemote(ctx context.Context, user *database.User, p, dir string) (string, error) {
+	cmd, cleanup := rmapi.NewCommand(user, "get", p)
+	defer cleanup()
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	stop := context.AfterFunc(ctx, func() { cmd.Process.Kill() })
+	defer stop()
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("rmapi get %s failed: %w", p, err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if f.Type().IsRegular() {
+			return filepath.Join(dir, f.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("rmapi get %s wrote no file", p)
+}
+
+// errNoOriginal is returned for documents with no PDF or EPUB, such as
+// notebooks
+var errNoOriginal = errors.New("no PDF or EPUB in the document")
+
+// extractOriginal writes the PDF or EPUB the document in the archive at
+// archivePath was made from next to it and returns its path. Annotations
+// made on the tablet are only in the archive.
+func extractOriginal(archivePath string) (string, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if (ext != ".pdf" && ext != ".epub") || strings.Contains(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		dst := strings.TrimSuffix(archivePath, filepath.Ext(archivePath)) + ext
+		out, err := os.Create(dst)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(out, rc); err != nil {
+			out.Close()
+			return "", err
+		}
+		return dst, out.Close()
+	}
+	return "", errNoOriginal
+}
+
+// archiveDownload copies a downloaded document into the user's archive as
+// filename and returns its storage key. In multi-user mode the copy is
+// recorded as a document with that archive key, like an archived upload, so
+// reconcile doesn't take it for an orphan.
+func archiveDownload(ctx context.Context, user *database.User, file, filename, remotePath string) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	if err := storage.CheckSpace(ctx, info.Size()); err != nil {
+		return "", err
+	}
+	userID := uuid.Nil
+	if user != nil {
+		userID = user.ID
+	}
+	multiUserMode := database.IsMultiUserMode()
+	key := storage.GenerateUserDocumentKey(userID, "", filename, multiUserMode)
+	if err := storage.CopyFileToStorage(ctx, file, key); err != nil {
+		return "", err
+	}
+	if !multiUserMode || user == nil {
+		storage.AddUsage(info.Size())
+		return key, nil
+	}
+
+	sum, err := storage.HashObject(ctx, key)
+	if err != nil {
+		storage.GetStorageBackend().Delete(ctx, key)
+		return "", err
+	}
+	now := time.Now()
+	doc := database.Document{
+		ID:                uuid.New(),
+		UserID:            userID,
+		DocumentName:      strings.TrimSuffix(filename, filepath.Ext(filename)),
+		RemotePath:        remotePath,
+		DocumentType:      strings.ToUpper(strings.TrimPrefix(filepath.Ext(filename), ".")),
+		FileSize:          info.Size(),
+		OriginalFilename:  filename,
+		ArchiveKey:        key,
+		ArchiveHash:       sum,
+		ArchiveStatus:     database.ArchiveStatusArchived,
+		ArchiveVerifiedAt: &now,
+	}
+	if err := database.DB.Create(&doc).Error; err != nil {
+		storage.GetStorageBackend().Delete(ctx, key)
+		return "", err
+	}
+	storage.AddUsage(info.Size())
+	return key, nil
+}
+
+// RemoteDownloadHandler sends a document from the user's reMarkable cloud,
+// given by the path query parameter. format picks what is sent: "original",
+// the PDF or EPUB it was made from; "archive", what rmapi get wrote, with the
+// annotations; or "auto" (the default), the original when there is one.
+// archive=true also keeps a copy in the user's archive, whose storage key is
+// returned in the X-Archive-Key header.
+func RemoteDownloadHandler(c *gin.Context) {
+	p, err := cleanRemotePath(c.Query("path"))
+	if err != nil || p == "/" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "path must name a document")
+		return
+	}
+	format := c.DefaultQuery("format", "auto")
+	if format != "auto" && format != "original" && format != "archive" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "format must be auto, original or archive")
+		return
+	}
+	user, ok := remoteUser(c)
+	if !ok {
+		return
+	}
+	entry, ok := remoteEntryFor(c, user, p)
+	if !ok {
+		return
+	}
+	if entry.Type != RemoteDocument {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "folders can't be downloaded")
+		return
+	}
+
+	userID := uuid.Nil
+	if user != nil {
+		userID = user.ID
+	}
+	dir, err := CreateUserTempDir(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "create_dir", "")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := DownloadRemote(c.Request.Context(), user, p, dir)
+	if err != nil {
+		LogfWithUser(user, "[BROWSE] Failed to download %s: %v", p, err)
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to download "+p+" from the reMarkable cloud")
+		return
+	}
+	if format != "archive" {
+		original, err := extractOriginal(file)
+		switch {
+		case err == nil:
+			file = original
+		case format == "original" && errors.Is(err, errNoOriginal):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, p+" has no PDF or EPUB; download the archive instead")
+			return
+		case format == "original":
+			LogfWithUser(user, "[BROWSE] Failed to unpack %s: %v", p, err)
+			apierror.Respond(c, http.StatusBadGateway, apierror.CodeBadGateway, "failed to unpack "+p)
+			return
+		}
+	}
+	filename := entry.Name + filepath.Ext(file)
+
+	if c.Query("archive") == "true" {
+		key, err := archiveDownload(c.Request.Context(), user, file, filename, p)
+		if err != nil {
+			LogfWithUser(user, "[BROWSE] Failed to archive %s: %v", p, err)
+			apierror.Respond(c, http.StatusInternalServerError, "save_file", "")
+			return
+		}
+		c.Header("X-Archive-Key", key)
+	}
+	LogfWithUser(user, "[BROWSE] Downloading %s as %s", p, filename)
+	c.FileAttachment(file, filename)
+}
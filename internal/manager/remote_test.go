@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+func TestArchiveDownloadRecordsDocument(t *testing.T) {
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("STORAGE_BACKEND", "filesystem")
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	if err := storage.InitializeStorage(); err != nil {
+		t.Fatal(err)
+	}
+	user, err := database.NewUserService(database.DB).CreateUser("reader", "reader@example.com", "correct-horse", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "download.pdf")
+	if err := os.WriteFile(file, []byte("%PDF annotated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := archiveDownload(context.Background(), user, file, "Paper.pdf", "/Books/Paper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.IsUserStorageKey(key, user.ID) {
+		t.Errorf("key %s is outside the user's storage", key)
+	}
+
+	// Reconcile only keeps objects that a document references
+	var doc database.Document
+	if err := database.DB.Where("archive_key = ?", key).First(&doc).Error; err != nil {
+		t.Fatalf("no document for the archived copy: %v", err)
+	}
+	if doc.UserID != user.ID || doc.DocumentName != "Paper" || doc.RemotePath != "/Books/Paper" || doc.DocumentType != "PDF" {
+		t.Errorf("document = %+v", doc)
+	}
+	if doc.ArchiveStatus != database.ArchiveStatusArchived || doc.ArchiveHash == "" || doc.ArchiveVerifiedAt == nil {
+		t.Errorf("archive not recorded as verified: %+v", doc)
+	}
+}
@@ -243,6 +243,38 @@ func (s *UserFolderCacheService) InvalidateUserCache(userID uuid.UUID) {
 	}
 }
 
+// AddFolder adds the folder p, and any missing parents, to the user's cached
+// listing without listing the cloud again. A user with no cached listing yet
+// gets the folder on their first refresh.
+func (s *UserFolderCacheService) AddFolder(userID uuid.UUID, p string) error {
+	s.mu.RLock()
+	userCache, exists := s.caches[userID]
+	s.mu.RUnlock()
+
+	var folders []string
+	if exists {
+		userCache.mu.Lock()
+		if len(userCache.folders) > 0 {
+			userCache.folders = insertFolder(userCache.folders, p)
+			folders = make([]string, len(userCache.folders))
+			copy(folders, userCache.folders)
+		}
+		userCache.mu.Unlock()
+	} else {
+		cached, err := s.LoadFolderCacheFromDatabase(userID)
+		if err != nil {
+			return err
+		}
+		if cached != nil {
+			folders = insertFolder(cached, p)
+		}
+	}
+	if folders == nil {
+		return nil
+	}
+	return s.saveFolderCacheToDatabase(userID, folders)
+}
+
 // StartBackgroundRefresh starts a background goroutine that periodically refreshes user caches
 func (s *UserFolderCacheService) StartBackgroundRefresh() {
 	if s.refreshInterval <= 0 {
@@ -322,3 +354,46 @@ func (s *UserFolderCacheService) refreshActiveUserCaches() {
 		}(userID, i)
 	}
 }
+
+// QueueRefresh schedules background refreshes for the given users, or for every
+// active paired user when userIDs is empty. Refreshes are staggered by the rate
+// limit so a large restore doesn't hammer the cloud. Returns the number queued.
+func (s *UserFolderCacheService) QueueRefresh(userIDs []uuid.UUID) int {
+	var users []database.User
+	query := s.db.Select("id").Where("is_active = ?", true)
+	if len(userIDs) > 0 {
+		query = query.Where("id IN ?", userIDs)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		Logf("Failed to get users for folder cache refresh: %v", err)
+		return 0
+	}
+
+	queued := 0
+	for _, user := range users {
+		if !rmapi.IsUserPaired(user.ID) {
+			continue
+		}
+
+		// Drop in-memory data so the refresh isn't short-circuited by stale entries
+		s.InvalidateUserCache(user.ID)
+
+		s.mu.Lock()
+		userCache, exists := s.caches[user.ID]
+		if !exists {
+			userCache = &userFolderCache{}
+			s.caches[user.ID] = userCache
+		}
+		s.mu.Unlock()
+
+		go func(uid uuid.UUID, cache *userFolderCache, delay int) {
+			time.Sleep(time.Duration(delay) * s.rateLimitDelay)
+			if _, err := s.refreshUserFolders(uid, cache, false); err != nil {
+				Logf("Queued folder refresh failed for user %s: %v", uid, err)
+			}
+		}(user.ID, userCache, queued)
+		queued++
+	}
+
+	return queued
+}
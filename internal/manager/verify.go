@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+)
+
+// ErrNotVerified is returned when an uploaded document doesn't show up in
+// the reMarkable cloud listing after every verification attempt
+var ErrNotVerified = errors.New("document not found on the reMarkable cloud after upload")
+
+// Sync statuses recorded on a Document
+const (
+	SyncVerified   = "verified"
+	SyncUnverified = "unverified"
+)
+
+// SyncVerifyEnabled reports whether uploads should be checked with a follow-up
+// `rmapi ls`. SYNC_VERIFY sets the default; a job can override it with its
+// verify_sync option.
+func SyncVerifyEnabled(option string) bool {
+	return config.BoolOption(option, "SYNC_VERIFY", false)
+}
+
+// VerifyUpload lists rmDir until remoteName appears, retrying up to
+// SYNC_VERIFY_ATTEMPTS times SYNC_VERIFY_DELAY apart since the cloud can take
+// a moment to settle. It returns ErrNotVerified if the document never shows
+// up. Offline tablets aren't checked.
+func VerifyUpload(remoteName, rmDir string, user *database.User) (bool, error) {
+	if delivery.ForUser(user).Offline() {
+		return false, nil
+	}
+
+	attempts := config.GetInt("SYNC_VERIFY_ATTEMPTS", 3)
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := config.GetDuration("SYNC_VERIFY_DELAY", 5*time.Second)
+	name := strings.TrimSuffix(remoteName, filepath.Ext(remoteName))
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(delay)
+		}
+		found, err := remoteDocumentExists(name, rmDir, user)
+		if err != nil {
+			lastErr = err
+			Logf("[verify] attempt %d/%d: listing %s failed: %v", attempt, attempts, rmDir, err)
+			continue
+		}
+		if found {
+			Logf("[verify] %s found in %s", name, rmDir)
+			return true, nil
+		}
+		Logf("[verify] attempt %d/%d: %s not yet in %s", attempt, attempts, name, rmDir)
+	}
+
+	if lastErr != nil {
+		return false, fmt.Errorf("%w: %v", ErrNotVerified, lastErr)
+	}
+	return false, ErrNotVerified
+}
+
+// remoteDocumentExists reports whether rmDir holds a document named name
+func remoteDocumentExists(name, rmDir string, user *database.User) (bool, error) {
+	proc, cleanup := rmapi.NewCommand(user, "ls", "--json", rmDir)
+	defer cleanup()
+	out, err := proc.Output()
+	if err != nil {
+		return false, err
+	}
+
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return false, fmt.Errorf("failed to parse rmapi ls --json output: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Type == "DocumentType" && entry.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,222 @@
+package mirror
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// maxMirrors caps how many folder mirrors a user can add
+const maxMirrors = 10
+
+// Request creates or updates a folder mirror
+type Request struct {
+	Prefix       string `json:"prefix" binding:"required"`
+	RmDir        string `json:"rm_dir" binding:"required"`
+	Prune        bool   `json:"prune"`
+	Enabled      *bool  `json:"enabled"`
+	SyncExisting bool   `json:"sync_existing"` // Upload files already under the prefix on the first sync
+}
+
+// apply validates req and copies it onto m
+func (req Request) apply(m *database.FolderMirror) error {
+	prefix, err := NormalizePrefix(req.Prefix)
+	if err != nil {
+		return err
+	}
+	m.Prefix = prefix
+	m.RmDir = path.Clean("/" + strings.TrimSpace(req.RmDir))
+	m.Prune = req.Prune
+	if req.Enabled != nil {
+		m.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// getMirror loads one of the current user's mirrors, responding 404 if it
+// doesn't exist
+func getMirror(c *gin.Context, userID uuid.UUID) (*database.FolderMirror, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mirror ID"})
+		return nil, false
+	}
+	var m database.FolderMirror
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&m).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mirror not found"})
+		return nil, false
+	}
+	return &m, true
+}
+
+// ListHandler lists the current user's folder mirrors
+func ListHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder mirrors not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var mirrors []database.FolderMirror
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&mirrors).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get mirrors"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mirrors": mirrors})
+}
+
+// CreateHandler adds a folder mirror for the current user. Files already under
+// the prefix are treated as mirrored unless sync_existing is set.
+func CreateHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder mirrors not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prefix and rm_dir are required"})
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&database.FolderMirror{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create mirror"})
+		return
+	}
+	if count >= maxMirrors {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many mirrors"})
+		return
+	}
+
+	m := database.FolderMirror{UserID: user.ID, Enabled: true}
+	if err := req.apply(&m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.SyncExisting {
+		if err := Baseline(c.Request.Context(), &m); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list prefix: " + err.Error()})
+			return
+		}
+	}
+	if err := database.DB.Create(&m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create mirror"})
+		return
+	}
+
+	logging.Logf("[MIRROR] User %s added mirror %s -> %s", user.Username, m.Prefix, m.RmDir)
+	c.JSON(http.StatusCreated, m)
+}
+
+// UpdateHandler replaces one of the current user's mirrors. Changing the
+// prefix starts it afresh from the files now under the new prefix.
+func UpdateHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder mirrors not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	m, ok := getMirror(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prefix and rm_dir are required"})
+		return
+	}
+
+	oldPrefix := m.Prefix
+	if err := req.apply(m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if m.Prefix != oldPrefix {
+		m.State = ""
+		if !req.SyncExisting {
+			if err := Baseline(c.Request.Context(), m); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list prefix: " + err.Error()})
+				return
+			}
+		}
+	}
+	if err := database.DB.Save(m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mirror"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// DeleteHandler removes one of the current user's mirrors. Documents already
+// on the reMarkable are left alone.
+func DeleteHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder mirrors not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	m, ok := getMirror(c, user.ID)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete mirror"})
+		return
+	}
+
+	logging.Logf("[MIRROR] User %s removed mirror %s -> %s", user.Username, m.Prefix, m.RmDir)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// SyncHandler syncs one of the current user's mirrors now and reports what
+// changed
+func SyncHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder mirrors not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	m, ok := getMirror(c, user.ID)
+	if !ok {
+		return
+	}
+
+	result, err := Sync(c.Request.Context(), m)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": len(result.Errors) == 0, "result": result, "mirror": m})
+}
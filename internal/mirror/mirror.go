@@ -0,0 +1,263 @@
+// Package mirror keeps reMarkable folders in step with storage prefixes.
+// Each sync uploads files that are new or changed since the last one and,
+// when a mirror prunes, removes documents whose files were deleted, so
+// dropping a file into the storage bucket delivers it to the tablet.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// supportedExts are the file types mirrored; anything else in the prefix is
+// ignored
+var supportedExts = map[string]bool{".pdf": true, ".epub": true}
+
+// Result summarizes one sync
+type Result struct {
+	Uploaded int      `json:"uploaded"`
+	Removed  int      `json:"removed"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// syncing guards against two syncs of one mirror running at once
+var (
+	syncingMu sync.Mutex
+	syncing   = make(map[uuid.UUID]bool)
+)
+
+// storagePrefix returns the storage prefix m mirrors, ending in a slash
+func storagePrefix(m *database.FolderMirror) string {
+	return storage.GenerateUserPrefix(m.UserID) + strings.Trim(m.Prefix, "/") + "/"
+}
+
+// version identifies one revision of a stored file
+func version(info storage.StorageInfo) string {
+	return fmt.Sprintf("%d@%s", info.Size, info.LastModified)
+}
+
+// NormalizePrefix cleans a mirror prefix given relative to the user's
+// storage, rejecting ones that escape it
+func NormalizePrefix(prefix string) (string, error) {
+	clean := strings.Trim(path.Clean("/"+strings.TrimSpace(prefix)), "/")
+	if clean == "" {
+		return "", fmt.Errorf("prefix is required")
+	}
+	if clean == "rmapi" || strings.HasPrefix(clean, "rmapi/") {
+		return "", fmt.Errorf("prefix %q holds reMarkable credentials and can't be mirrored", clean)
+	}
+	return clean, nil
+}
+
+// Baseline records the files currently under m's prefix as already mirrored,
+// so only files added afterwards are uploaded
+func Baseline(ctx context.Context, m *database.FolderMirror) error {
+	infos, err := storage.GetStorageBackend().ListWithInfo(ctx, storagePrefix(m))
+	if err != nil {
+		return err
+	}
+	state := make(map[string]string, len(infos))
+	for _, info := range infos {
+		state[info.Key] = version(info)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	m.State = string(data)
+	return nil
+}
+
+// Sync brings m's reMarkable folder up to date with its storage prefix
+func Sync(ctx context.Context, m *database.FolderMirror) (*Result, error) {
+	syncingMu.Lock()
+	if syncing[m.ID] {
+		syncingMu.Unlock()
+		return nil, fmt.Errorf("mirror is already syncing")
+	}
+	syncing[m.ID] = true
+	syncingMu.Unlock()
+	defer func() {
+		syncingMu.Lock()
+		delete(syncing, m.ID)
+		syncingMu.Unlock()
+	}()
+
+	result, err := syncMirror(ctx, m)
+
+	now := time.Now()
+	updates := map[string]interface{}{"last_sync_at": now, "state": m.State, "last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else if len(result.Errors) > 0 {
+		updates["last_error"] = strings.Join(result.Errors, "; ")
+	}
+	if dbErr := database.DB.Model(&database.FolderMirror{}).Where("id = ?", m.ID).Updates(updates).Error; dbErr != nil {
+		logging.Logf("[MIRROR] Failed to save mirror %s: %v", m.ID, dbErr)
+	}
+	m.LastSyncAt = &now
+	return result, err
+}
+
+func syncMirror(ctx context.Context, m *database.FolderMirror) (*Result, error) {
+	user, err := database.NewUserService(database.DB).GetUserByID(m.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	state := map[string]string{}
+	if m.State != "" {
+		if err := json.Unmarshal([]byte(m.State), &state); err != nil {
+			logging.Logf("[MIRROR] Ignoring unreadable state of mirror %s: %v", m.ID, err)
+		}
+	}
+
+	backend := storage.GetStorageBackend()
+	prefix := storagePrefix(m)
+	infos, err := backend.ListWithInfo(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+	offline := delivery.ForUser(user).Offline()
+	result := &Result{}
+	present := make(map[string]bool, len(infos))
+	madeFolders := map[string]bool{}
+	for _, info := range infos {
+		present[info.Key] = true
+		if !supportedExts[strings.ToLower(path.Ext(info.Key))] {
+			continue
+		}
+		if state[info.Key] == version(info) {
+			result.Skipped++
+			continue
+		}
+
+		rmDir := remoteDir(m, prefix, info.Key)
+		if !offline && !madeFolders[rmDir] {
+			if err := manager.MakeFolder(rmDir, user); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			madeFolders[rmDir] = true
+		}
+
+		// A file seen before has changed, so replace the document
+		_, changed := state[info.Key]
+		if err := uploadKey(ctx, info.Key, rmDir, user, changed); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path.Base(info.Key), err))
+			continue
+		}
+		state[info.Key] = version(info)
+		result.Uploaded++
+		manager.LogfWithUser(user, "[MIRROR] Uploaded %s to %s", path.Base(info.Key), rmDir)
+	}
+
+	for key := range state {
+		if present[key] {
+			continue
+		}
+		if m.Prune && !offline {
+			remote := path.Join(remoteDir(m, prefix, key), strings.TrimSuffix(path.Base(key), path.Ext(key)))
+			if err := manager.RemoveDocument(remote, user); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Removed++
+			manager.LogfWithUser(user, "[MIRROR] Removed %s", remote)
+		}
+		delete(state, key)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return result, err
+	}
+	m.State = string(data)
+	return result, nil
+}
+
+// remoteDir maps a stored file to the reMarkable folder it belongs in, keeping
+// the subfolders below the mirrored prefix
+func remoteDir(m *database.FolderMirror, prefix, key string) string {
+	rel := strings.TrimPrefix(key, prefix)
+	return path.Join("/", m.RmDir, path.Dir(rel))
+}
+
+// uploadKey downloads the stored file to a temporary folder under its own
+// name, so the document keeps it, and uploads it
+func uploadKey(ctx context.Context, key, rmDir string, user *database.User, replace bool) error {
+	dir, err := manager.CreateUserTempDir(user.ID)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	localPath := filepath.Join(dir, path.Base(key))
+	if err := storage.CopyFileFromStorage(ctx, key, localPath); err != nil {
+		return err
+	}
+
+	opts := manager.UploadOptions{}
+	if replace {
+		opts.ConflictResolution = "overwrite"
+	}
+	_, err = manager.SimpleUpload(localPath, rmDir, user, opts)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "entry already exists") {
+		// Already on the tablet, e.g. uploaded by Aviary before it was archived
+		return nil
+	}
+	return err
+}
+
+// Start syncs every enabled mirror each MIRROR_INTERVAL until ctx is
+// cancelled
+func Start(ctx context.Context) {
+	interval := config.GetDuration("MIRROR_INTERVAL", 15*time.Minute)
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				syncAll(ctx)
+			}
+		}
+	}()
+}
+
+func syncAll(ctx context.Context) {
+	var mirrors []database.FolderMirror
+	if err := database.DB.Where("enabled = ?", true).Find(&mirrors).Error; err != nil {
+		logging.Logf("[MIRROR] Failed to load mirrors: %v", err)
+		return
+	}
+	for i := range mirrors {
+		if _, err := Sync(ctx, &mirrors[i]); err != nil {
+			logging.Logf("[MIRROR] Sync of mirror %s failed: %v", mirrors[i].ID, err)
+		}
+	}
+}
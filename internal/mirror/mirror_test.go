@@ -0,0 +1,186 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"scans", "scans", true},
+		{" /scans/inbox/ ", "scans/inbox", true},
+		{"scans/../papers", "papers", true},
+		{"../../etc", "etc", true},
+		{"", "", false},
+		{"/", "", false},
+		{"..", "", false},
+		{"rmapi", "", false},
+		{"rmapi/conf", "", false},
+		{"rmapi-notes", "rmapi-notes", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePrefix(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("NormalizePrefix(%q) = %q, %v, want %q ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRemoteDir(t *testing.T) {
+	m := &database.FolderMirror{RmDir: "/Inbox"}
+	prefix := "users/u/scans/"
+	tests := map[string]string{
+		"users/u/scans/a.pdf":          "/Inbox",
+		"users/u/scans/work/b.pdf":     "/Inbox/work",
+		"users/u/scans/work/old/c.pdf": "/Inbox/work/old",
+	}
+	for key, want := range tests {
+		if got := remoteDir(m, prefix, key); got != want {
+			t.Errorf("remoteDir(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// setupMirror creates a multi-user database, filesystem storage and a user
+// whose reMarkable commands are recorded instead of run
+func setupMirror(t *testing.T) (*database.User, *[][]string) {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("STORAGE_BACKEND", "filesystem")
+	t.Setenv("DRY_RUN", "")
+
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	if err := storage.InitializeStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := database.NewUserService(database.DB).CreateUser("mirror", "mirror@example.com", "correct-horse", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cmds [][]string
+	record := func(name string, args ...string) *exec.Cmd {
+		cmds = append(cmds, append([]string{name}, args...))
+		return exec.Command("true")
+	}
+	mgrOrig, rmapiOrig := manager.ExecCommand, rmapi.ExecCommand
+	manager.ExecCommand, rmapi.ExecCommand = record, record
+	t.Cleanup(func() { manager.ExecCommand, rmapi.ExecCommand = mgrOrig, rmapiOrig })
+	return user, &cmds
+}
+
+// commandSummary keeps each command's verb and final argument, dropping
+// flags and temporary paths
+func commandSummary(cmds [][]string) []string {
+	var out []string
+	for _, c := range cmds {
+		if len(c) < 3 {
+			continue
+		}
+		last := c[len(c)-1]
+		if c[1] == "put" {
+			last = filepath.Base(c[len(c)-2]) + " " + last
+		}
+		out = append(out, c[1]+" "+last)
+	}
+	return out
+}
+
+func TestSync(t *testing.T) {
+	user, cmds := setupMirror(t)
+	root := filepath.Join(os.Getenv("DATA_DIR"), "users", user.ID.String(), "scans")
+	write := func(name, body string) {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old.pdf", "%PDF old")
+
+	m := &database.FolderMirror{ID: uuid.New(), UserID: user.ID, Prefix: "scans", RmDir: "/Inbox", Prune: true, Enabled: true}
+	if err := Baseline(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Files already there when the mirror was created are left alone
+	write("new.pdf", "%PDF new")
+	write("work/report.epub", "epub")
+	write("notes.txt", "ignored")
+	result, err := Sync(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 2 || result.Skipped != 1 || len(result.Errors) != 0 {
+		t.Errorf("first sync = %+v, want 2 uploaded and 1 skipped", result)
+	}
+	want := []string{"mkdir /Inbox", "put new.pdf /Inbox", "mkdir /Inbox", "mkdir /Inbox/work", "put report.epub /Inbox/work"}
+	if got := commandSummary(*cmds); !reflect.DeepEqual(got, want) {
+		t.Errorf("first sync ran %q, want %q", got, want)
+	}
+
+	// A changed file replaces its document and a deleted one is pruned
+	*cmds = nil
+	write("new.pdf", "%PDF new, revised")
+	if err := os.Remove(filepath.Join(root, "old.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Sync(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 1 || result.Removed != 1 || result.Skipped != 1 {
+		t.Errorf("second sync = %+v, want 1 uploaded, 1 removed and 1 skipped", result)
+	}
+	got := commandSummary(*cmds)
+	want = []string{"mkdir /Inbox", "put new.pdf /Inbox", "rm /Inbox/old"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second sync ran %q, want %q", got, want)
+	}
+	for _, c := range *cmds {
+		if c[1] == "put" && !strings.Contains(strings.Join(c, " "), "--force") {
+			t.Errorf("changed file uploaded without replacing it: %q", c)
+		}
+	}
+
+	var saved database.FolderMirror
+	if err := database.DB.First(&saved, "id = ?", m.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.State != m.State || saved.LastSyncAt == nil || saved.LastError != "" {
+		t.Errorf("saved mirror = state %s, last sync %v, error %q", saved.State, saved.LastSyncAt, saved.LastError)
+	}
+}
@@ -0,0 +1,73 @@
+package pdfprocessor
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// maxAspectDrift is how far, as a fraction, a page's largest image may differ
+// from the page's aspect ratio and still count as filling the page
+const maxAspectDrift = 0.1
+
+// DetectImageOnly reports whether every page of a PDF is filled by an image,
+// as with scans, including scans with an OCR text layer. It also returns the
+// size of the first page in points.
+func DetectImageOnly(path string) (bool, types.Dim, error) {
+	securePath, err := security.NewSecurePathFromExisting(path)
+	if err != nil {
+		return false, types.Dim{}, fmt.Errorf("invalid input path: %w", err)
+	}
+	f, err := security.SafeOpen(securePath)
+	if err != nil {
+		return false, types.Dim{}, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer f.Close()
+
+	conf := model.NewDefaultConfiguration()
+	ctx, err := api.ReadContext(f, conf)
+	if err != nil {
+		return false, types.Dim{}, fmt.Errorf("failed to read PDF context: %w", err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return false, types.Dim{}, fmt.Errorf("failed to ensure page count: %w", err)
+	}
+	dims, err := ctx.PageDims()
+	if err != nil || len(dims) == 0 {
+		return false, types.Dim{}, fmt.Errorf("failed to read page sizes: %v", err)
+	}
+
+	f.Seek(0, io.SeekStart)
+	allImages, err := api.Images(f, nil, conf)
+	if err != nil {
+		return false, dims[0], fmt.Errorf("failed to get images from PDF: %w", err)
+	}
+
+	// Largest image on each page
+	largest := make(map[int]model.Image)
+	for _, pageMap := range allImages {
+		for _, img := range pageMap {
+			if cur, ok := largest[img.PageNr]; !ok || img.Width*img.Height > cur.Width*cur.Height {
+				largest[img.PageNr] = img
+			}
+		}
+	}
+
+	for pageNr, dim := range dims {
+		img, ok := largest[pageNr+1]
+		if !ok || img.Width == 0 || img.Height == 0 || dim.Width == 0 || dim.Height == 0 {
+			return false, dims[0], nil
+		}
+		pageAspect := dim.Width / dim.Height
+		imgAspect := float64(img.Width) / float64(img.Height)
+		if math.Abs(imgAspect-pageAspect)/pageAspect > maxAspectDrift {
+			return false, dims[0], nil
+		}
+	}
+	return true, dims[0], nil
+}
@@ -0,0 +1,111 @@
+// Package procstats adds up the CPU time and peak memory of the child
+// processes (gs, mutool, rmapi and the like) run for each job, so slow or
+// memory hungry documents can be spotted and hosts sized to match.
+package procstats
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ToolUsage is what runs of one program used
+type ToolUsage struct {
+	Runs int `json:"runs"`
+	// CPUMillis is user plus system CPU time
+	CPUMillis int64 `json:"cpu_ms"`
+	// MaxRSSBytes is the largest resident set of any single run, or 0 where
+	// the OS doesn't report it
+	MaxRSSBytes int64 `json:"max_rss_bytes"`
+}
+
+func (t *ToolUsage) add(cpu time.Duration, rss int64) {
+	t.Runs++
+	t.CPUMillis += cpu.Milliseconds()
+	if rss > t.MaxRSSBytes {
+		t.MaxRSSBytes = rss
+	}
+}
+
+// Usage collects what a job's child processes used. The zero value is ready
+// to use and a nil *Usage records only into the process-wide totals.
+type Usage struct {
+	mu    sync.Mutex
+	tools map[string]*ToolUsage
+}
+
+var global Usage
+
+// Record adds the finished process in state to u under tool, and to the
+// process-wide totals. A nil state, from a process that never started, is
+// ignored.
+func Record(u *Usage, tool string, state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+	cpu := state.UserTime() + state.SystemTime()
+	rss := maxRSS(state)
+	global.add(tool, cpu, rss)
+	if u != nil {
+		u.add(tool, cpu, rss)
+	}
+}
+
+func (u *Usage) add(tool string, cpu time.Duration, rss int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.tools == nil {
+		u.tools = make(map[string]*ToolUsage)
+	}
+	t := u.tools[tool]
+	if t == nil {
+		t = &ToolUsage{}
+		u.tools[tool] = t
+	}
+	t.add(cpu, rss)
+}
+
+// Tools returns a copy of the usage per program
+func (u *Usage) Tools() map[string]ToolUsage {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make(map[string]ToolUsage, len(u.tools))
+	for name, t := range u.tools {
+		out[name] = *t
+	}
+	return out
+}
+
+// Total returns the usage of all programs together. MaxRSSBytes is the
+// largest of any single run, as runs don't overlap within a job.
+func (u *Usage) Total() ToolUsage {
+	var total ToolUsage
+	for _, t := range u.Tools() {
+		total.Runs += t.Runs
+		total.CPUMillis += t.CPUMillis
+		if t.MaxRSSBytes > total.MaxRSSBytes {
+			total.MaxRSSBytes = t.MaxRSSBytes
+		}
+	}
+	return total
+}
+
+// Names returns the programs that ran, sorted
+func (u *Usage) Names() []string {
+	tools := u.Tools()
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Totals returns what each program used since the server started
+func Totals() map[string]ToolUsage {
+	return global.Tools()
+}
@@ -0,0 +1,15 @@
+package procstats
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak resident set of the process in bytes. Linux
+// reports it in kilobytes.
+func maxRSS(state *os.ProcessState) int64 {
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok && ru != nil {
+		return int64(ru.Maxrss) * 1024
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package procstats
+
+import "os"
+
+// maxRSS isn't reported consistently outside Linux, so it's left at 0
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,51 @@
+package receipt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the QR specification's worked example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("error correction = %v, want %v", got, want)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// Level M format strings for each mask
+	want := []int{
+		0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+		0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000,
+	}
+	for mask, w := range want {
+		if got := formatBits(mask); got != w {
+			t.Errorf("mask %d: format bits = %015b, want %015b", mask, got, w)
+		}
+	}
+}
+
+func TestEncodeQRVersion(t *testing.T) {
+	cases := []struct {
+		length, version int
+	}{
+		{14, 1},
+		{15, 2},
+		{100, 6},
+		{213, 10},
+	}
+	for _, tc := range cases {
+		q, err := encodeQR(bytes.Repeat([]byte("a"), tc.length))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tc.length, err)
+		}
+		if want := tc.version*4 + 17; q.size != want {
+			t.Errorf("%d bytes: size = %d, want %d", tc.length, q.size, want)
+		}
+	}
+	if _, err := encodeQR(bytes.Repeat([]byte("a"), 214)); err == nil {
+		t.Error("214 bytes: expected an error")
+	}
+}
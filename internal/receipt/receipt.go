@@ -0,0 +1,121 @@
+// Package receipt builds upload receipts: a short JSON summary of what was
+// delivered where, with a QR code linking back to it, that chat and push
+// notification integrations can pass along.
+package receipt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+const (
+	// qrScale is the size of a QR module in pixels
+	qrScale = 4
+	// qrBorder is the quiet zone around the code in modules
+	qrBorder = 4
+)
+
+// Document is one delivered document on a receipt
+type Document struct {
+	// ID is the Document record, only kept in multi-user mode
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size,omitempty"`
+	SyncStatus string `json:"sync_status,omitempty"`
+}
+
+// Receipt confirms what a job delivered and where
+type Receipt struct {
+	JobID      string     `json:"job_id"`
+	Username   string     `json:"username,omitempty"`
+	Folder     string     `json:"folder"`
+	Documents  []Document `json:"documents"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+	// Link opens Aviary at the document, or at the folder for several
+	Link string `json:"link"`
+}
+
+// Enabled reports whether a job should return a receipt. RECEIPTS sets the
+// default; a job can override it with its receipt option.
+func Enabled(option string) bool {
+	return config.BoolOption(option, "RECEIPTS", false)
+}
+
+// New builds a receipt for the documents a job delivered to folder
+func New(jobID, username, folder string, docs []Document) *Receipt {
+	r := &Receipt{
+		JobID:      jobID,
+		Username:   username,
+		Folder:     folder,
+		Documents:  docs,
+		UploadedAt: time.Now().UTC(),
+	}
+
+	query := url.Values{}
+	if len(docs) == 1 {
+		query.Set("path", docs[0].Path)
+		if docs[0].ID != "" {
+			query.Set("document", docs[0].ID)
+		}
+	} else {
+		query.Set("path", folder)
+	}
+	siteURL := strings.TrimRight(config.Get("SITE_URL", "http://localhost:8000"), "/")
+	r.Link = siteURL + "/?" + query.Encode()
+	return r
+}
+
+// QRCode renders the receipt link as a PNG QR code
+func (r *Receipt) QRCode() ([]byte, error) {
+	q, err := encodeQR([]byte(r.Link))
+	if err != nil {
+		return nil, err
+	}
+
+	side := (q.size + 2*qrBorder) * qrScale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < qrScale; dy++ {
+				for dx := 0; dx < qrScale; dx++ {
+					img.SetColorIndex((x+qrBorder)*qrScale+dx, (y+qrBorder)*qrScale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AddTo adds the receipt to a job's status data: the JSON under "receipt"
+// and the QR code as a PNG data URL under "receipt_qr"
+func (r *Receipt) AddTo(data map[string]string) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	qr, err := r.QRCode()
+	if err != nil {
+		return err
+	}
+	data["receipt"] = string(body)
+	data["receipt_qr"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr)
+	return nil
+}
@@ -0,0 +1,92 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// ReportHandler returns the last reconciliation's report
+func ReportHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reconciliation not available in single-user mode"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": LastReport()})
+}
+
+// RunHandler runs a reconciliation and returns its report. With "fix": true
+// in the body it also cleans up what it finds.
+func RunHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reconciliation not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Fix bool `json:"fix"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+			return
+		}
+	}
+
+	logging.LogfWithUser(user.Username, "[RECONCILE] Reconciliation started (fix: %t)", req.Fix)
+	report, err := Run(context.Background(), req.Fix)
+	if errors.Is(err, ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Reconciliation failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// VerifyReportHandler returns the last archive verification's report
+func VerifyReportHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive verification not available in single-user mode"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": LastVerifyReport()})
+}
+
+// VerifyHandler checks every archived copy against its recorded hash and
+// returns the report
+func VerifyHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive verification not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	logging.LogfWithUser(user.Username, "[RECONCILE] Archive verification started")
+	report, err := Verify(context.Background())
+	if errors.Is(err, ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "verification already running"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
@@ -0,0 +1,274 @@
+// Package reconcile compares the archived copies in the storage backend with
+// the Document records that point at them. Failed jobs and manual deletions
+// leave objects no document refers to, and documents whose archived copy is
+// gone; a run reports both and can clean them up.
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// ErrRunning is returned when a reconciliation is already in progress
+var ErrRunning = errors.New("reconciliation already running")
+
+// OrphanObject is a stored file no document refers to
+type OrphanObject struct {
+	UserID       uuid.UUID `json:"user_id"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Deleted      bool      `json:"deleted,omitempty"`
+}
+
+// MissingObject is a document whose archived copy is gone from storage
+type MissingObject struct {
+	UserID     uuid.UUID `json:"user_id"`
+	DocumentID uuid.UUID `json:"document_id"`
+	Document   string    `json:"document"`
+	ArchiveKey string    `json:"archive_key"`
+	Cleared    bool      `json:"cleared,omitempty"`
+}
+
+// Report is the outcome of one run
+type Report struct {
+	StartedAt        time.Time       `json:"started_at"`
+	FinishedAt       time.Time       `json:"finished_at"`
+	Fix              bool            `json:"fix"`
+	Users            int             `json:"users"`
+	ObjectsScanned   int             `json:"objects_scanned"`
+	DocumentsScanned int             `json:"documents_scanned"`
+	OrphanObjects    []OrphanObject  `json:"orphan_objects"`
+	OrphanBytes      int64           `json:"orphan_bytes"`
+	MissingObjects   []MissingObject `json:"missing_objects"`
+	// Relinked counts documents archived before archive keys were recorded
+	// that were matched to their stored file by name
+	Relinked int      `json:"relinked"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+var (
+	runMu   sync.Mutex
+	running bool
+	last    *Report
+)
+
+// LastReport returns the most recent run's report, or nil if none ran yet
+func LastReport() *Report {
+	runMu.Lock()
+	defer runMu.Unlock()
+	return last
+}
+
+// Run reconciles every user's archive. With fix, orphaned objects older than
+// RECONCILE_GRACE (default 1h) are deleted, documents with a missing copy
+// have their archive key cleared, and legacy documents are relinked. Without
+// it the run only reports.
+func Run(ctx context.Context, fix bool) (*Report, error) {
+	runMu.Lock()
+	if running {
+		runMu.Unlock()
+		return nil, ErrRunning
+	}
+	running = true
+	runMu.Unlock()
+
+	report := &Report{StartedAt: time.Now(), Fix: fix, OrphanObjects: []OrphanObject{}, MissingObjects: []MissingObject{}}
+	err := run(ctx, report)
+	report.FinishedAt = time.Now()
+
+	runMu.Lock()
+	running = false
+	if err == nil {
+		last = report
+	}
+	runMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	logging.Logf("[RECONCILE] Scanned %d objects and %d documents: %d orphaned objects (%d bytes), %d missing copies, %d relinked",
+		report.ObjectsScanned, report.DocumentsScanned, len(report.OrphanObjects), report.OrphanBytes, len(report.MissingObjects), report.Relinked)
+	return report, nil
+}
+
+func run(ctx context.Context, report *Report) error {
+	if database.DB == nil || !database.IsMultiUserMode() {
+		return errors.New("reconciliation requires multi-user mode")
+	}
+	var userIDs []uuid.UUID
+	if err := database.DB.Model(&database.User{}).Pluck("id", &userIDs).Error; err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	report.Users = len(userIDs)
+	grace := config.GetDuration("RECONCILE_GRACE", time.Hour)
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := reconcileUser(ctx, userID, grace, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("user %s: %v", userID, err))
+		}
+	}
+	return nil
+}
+
+// yearSuffix matches the year managed uploads append to archived copies
+var yearSuffix = regexp.MustCompile(`^(.*) \d{4}(\.[^.]*)$`)
+
+func reconcileUser(ctx context.Context, userID uuid.UUID, grace time.Duration, report *Report) error {
+	backend := storage.GetStorageBackend()
+	objects, err := backend.ListWithInfo(ctx, storage.GenerateUserDocumentPrefix(userID))
+	if err != nil {
+		return fmt.Errorf("failed to list storage: %w", err)
+	}
+	var docs []database.Document
+	if err := database.DB.Where("user_id = ?", userID).Order("upload_date").Find(&docs).Error; err != nil {
+		return fmt.Errorf("failed to load documents: %w", err)
+	}
+	var mirrors []database.FolderMirror
+	if err := database.DB.Where("user_id = ?", userID).Find(&mirrors).Error; err != nil {
+		return fmt.Errorf("failed to load mirrors: %w", err)
+	}
+	report.ObjectsScanned += len(objects)
+	report.DocumentsScanned += len(docs)
+
+	// Files in mirrored prefixes are the user's own, not archived copies
+	var mirrorPrefixes []string
+	for _, m := range mirrors {
+		mirrorPrefixes = append(mirrorPrefixes, storage.GenerateUserPrefix(userID)+strings.Trim(m.Prefix, "/")+"/")
+	}
+
+	referenced := make(map[string]bool)
+	// legacy maps the file names of archived documents without an archive
+	// key to the newest such document
+	legacy := make(map[string]*database.Document)
+	for i := range docs {
+		doc := &docs[i]
+		if doc.ArchiveKey != "" {
+			referenced[doc.ArchiveKey] = true
+		} else if archivedWithoutKey(doc) {
+			legacy[path.Base(doc.LocalPath)] = doc
+		}
+	}
+
+	stored := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		stored[obj.Key] = true
+		if referenced[obj.Key] || underAny(obj.Key, mirrorPrefixes) {
+			continue
+		}
+		if doc := legacyMatch(legacy, path.Base(obj.Key)); doc != nil {
+			report.Relinked++
+			if report.Fix {
+				if err := database.DB.Model(doc).Update("archive_key", obj.Key).Error; err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("relink %s: %v", doc.ID, err))
+				}
+			}
+			delete(legacy, path.Base(doc.LocalPath))
+			continue
+		}
+		// Jobs copy the archive before recording the document
+		if modified, err := time.Parse(time.RFC3339, obj.LastModified); err == nil && time.Since(modified) < grace {
+			continue
+		}
+
+		orphan := OrphanObject{UserID: userID, Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}
+		if report.Fix {
+			if err := backend.Delete(ctx, obj.Key); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete %s: %v", obj.Key, err))
+			} else {
+				orphan.Deleted = true
+			}
+		}
+		report.OrphanObjects = append(report.OrphanObjects, orphan)
+		report.OrphanBytes += obj.Size
+	}
+
+	for i := range docs {
+		doc := &docs[i]
+		if doc.ArchiveKey == "" || stored[doc.ArchiveKey] {
+			continue
+		}
+		missing := MissingObject{UserID: userID, DocumentID: doc.ID, Document: doc.DocumentName, ArchiveKey: doc.ArchiveKey}
+		if report.Fix {
+			if err := database.DB.Model(doc).Update("archive_key", "").Error; err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("clear %s: %v", doc.ID, err))
+			} else {
+				missing.Cleared = true
+			}
+		}
+		report.MissingObjects = append(report.MissingObjects, missing)
+	}
+	return nil
+}
+
+// archivedWithoutKey reports whether doc was uploaded with archive=true but
+// has no archive key, as for documents archived before keys were recorded
+func archivedWithoutKey(doc *database.Document) bool {
+	if doc.ProcessingOptions == "" || doc.LocalPath == "" {
+		return false
+	}
+	var options map[string]string
+	if json.Unmarshal([]byte(doc.ProcessingOptions), &options) != nil {
+		return false
+	}
+	return options["archive"] == "true"
+}
+
+// legacyMatch returns the legacy document stored under name, which may have
+// the year managed uploads add
+func legacyMatch(legacy map[string]*database.Document, name string) *database.Document {
+	if doc, ok := legacy[name]; ok {
+		return doc
+	}
+	if m := yearSuffix.FindStringSubmatch(name); m != nil {
+		return legacy[m[1]+m[2]]
+	}
+	return nil
+}
+
+func underAny(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start runs a reconciliation every RECONCILE_INTERVAL (default off). Scheduled
+// runs only report unless RECONCILE_FIX is true.
+func Start(ctx context.Context) {
+	interval := config.GetDuration("RECONCILE_INTERVAL", 0)
+	if interval <= 0 {
+		return
+	}
+	fix := config.GetBool("RECONCILE_FIX", false)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := Run(ctx, fix); err != nil {
+					logging.Logf("[RECONCILE] Scheduled run failed: %v", err)
+				}
+			}
+		}
+	}()
+}
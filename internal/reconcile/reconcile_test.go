@@ -0,0 +1,231 @@
+package reconcile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// setupReconcile creates a multi-user database with one user and a
+// filesystem backend in a temporary directory
+func setupReconcile(t *testing.T) (*database.User, string) {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("RECONCILE_GRACE", "1h")
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	if err := storage.ConfigureStorage(storage.StorageConfig{Backend: "filesystem", DataDir: dataDir}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := database.NewUserService(database.DB).CreateUser("archivist", "archivist@example.com", "correct-horse", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, dataDir
+}
+
+// putObject stores an object under the user's documents, last modified age ago
+func putObject(t *testing.T, dataDir string, userID uuid.UUID, name string, age time.Duration) string {
+	t.Helper()
+	key := storage.GenerateUserDocumentPrefix(userID) + name
+	if err := storage.GetStorageBackend().Put(context.Background(), key, strings.NewReader("%PDF "+name)); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(dataDir, filepath.FromSlash(key)), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func createDocument(t *testing.T, doc database.Document) *database.Document {
+	t.Helper()
+	doc.ID = uuid.New()
+	if err := database.DB.Create(&doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+func objectExists(t *testing.T, key string) bool {
+	t.Helper()
+	exists, err := storage.GetStorageBackend().Exists(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func archiveKey(t *testing.T, doc *database.Document) string {
+	t.Helper()
+	var got database.Document
+	if err := database.DB.First(&got, "id = ?", doc.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return got.ArchiveKey
+}
+
+// seededArchive is one object of each kind reconcile tells apart and the
+// documents that refer to them
+type seededArchive struct {
+	referenced, orphan, recent, mirrored, legacyKey string
+	legacy, missing                                 *database.Document
+}
+
+// seedArchive stores the objects, documents and folder mirror of a
+// seededArchive
+func seedArchive(t *testing.T, user *database.User, dataDir string) seededArchive {
+	t.Helper()
+	old := 2 * time.Hour
+	s := seededArchive{
+		referenced: putObject(t, dataDir, user.ID, "Referenced.pdf", old),
+		orphan:     putObject(t, dataDir, user.ID, "Orphan.pdf", old),
+		recent:     putObject(t, dataDir, user.ID, "Recent.pdf", time.Minute),
+		mirrored:   putObject(t, dataDir, user.ID, "Papers/Own.pdf", old),
+		legacyKey:  putObject(t, dataDir, user.ID, "Reports/Reports October 16 2026.pdf", old),
+	}
+	createDocument(t, database.Document{UserID: user.ID, DocumentName: "Referenced", ArchiveKey: s.referenced})
+	s.legacy = createDocument(t, database.Document{
+		UserID:            user.ID,
+		DocumentName:      "Reports October 16",
+		LocalPath:         "/data/users/x/Reports October 16.pdf",
+		ProcessingOptions: `{"archive":"true","manage":"true"}`,
+	})
+	s.missing = createDocument(t, database.Document{UserID: user.ID, DocumentName: "Gone", ArchiveKey: storage.GenerateUserDocumentPrefix(user.ID) + "Gone.pdf"})
+	// A document that was never archived is left alone
+	createDocument(t, database.Document{UserID: user.ID, DocumentName: "Unarchived", LocalPath: "/data/Unarchived.pdf", ProcessingOptions: `{"archive":"false"}`})
+
+	mirror := database.FolderMirror{ID: uuid.New(), UserID: user.ID, Prefix: "/pdfs/Papers/", RmDir: "/Papers", Enabled: true}
+	if err := database.DB.Create(&mirror).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRunReportOnly(t *testing.T) {
+	user, dataDir := setupReconcile(t)
+	s := seedArchive(t, user, dataDir)
+
+	report, err := Run(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 1 || report.ObjectsScanned != 5 || report.DocumentsScanned != 4 {
+		t.Errorf("scanned %d users, %d objects, %d documents, want 1, 5, 4", report.Users, report.ObjectsScanned, report.DocumentsScanned)
+	}
+	// Only the old unreferenced object is an orphan: not the recent one
+	// still inside the grace window, nor the mirrored file, nor the legacy copy
+	if len(report.OrphanObjects) != 1 || report.OrphanObjects[0].Key != s.orphan || report.OrphanObjects[0].Deleted {
+		t.Errorf("orphans = %+v, want only %s, not deleted", report.OrphanObjects, s.orphan)
+	}
+	if report.OrphanBytes != int64(len("%PDF Orphan.pdf")) {
+		t.Errorf("orphan bytes = %d", report.OrphanBytes)
+	}
+	if len(report.MissingObjects) != 1 || report.MissingObjects[0].DocumentID != s.missing.ID || report.MissingObjects[0].Cleared {
+		t.Errorf("missing = %+v, want the Gone document, not cleared", report.MissingObjects)
+	}
+	if report.Relinked != 1 {
+		t.Errorf("relinked = %d, want 1", report.Relinked)
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("errors = %v", report.Errors)
+	}
+
+	// Nothing was changed
+	for _, key := range []string{s.referenced, s.orphan, s.recent, s.mirrored, s.legacyKey} {
+		if !objectExists(t, key) {
+			t.Errorf("report-only run deleted %s", key)
+		}
+	}
+	if key := archiveKey(t, s.legacy); key != "" {
+		t.Errorf("report-only run relinked the legacy document to %s", key)
+	}
+	if key := archiveKey(t, s.missing); key == "" {
+		t.Error("report-only run cleared the missing document's key")
+	}
+	if LastReport() != report {
+		t.Error("LastReport isn't the finished run")
+	}
+}
+
+func TestRunFix(t *testing.T) {
+	user, dataDir := setupReconcile(t)
+	s := seedArchive(t, user, dataDir)
+
+	report, err := Run(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanObjects) != 1 || !report.OrphanObjects[0].Deleted {
+		t.Errorf("orphans = %+v, want one deleted", report.OrphanObjects)
+	}
+	if objectExists(t, s.orphan) {
+		t.Errorf("%s not deleted", s.orphan)
+	}
+	for _, key := range []string{s.referenced, s.recent, s.mirrored, s.legacyKey} {
+		if !objectExists(t, key) {
+			t.Errorf("%s was deleted", key)
+		}
+	}
+
+	// The legacy document is matched by name, ignoring the year managed
+	// uploads add to the archived copy
+	if key := archiveKey(t, s.legacy); key != s.legacyKey {
+		t.Errorf("legacy document relinked to %q, want %s", key, s.legacyKey)
+	}
+	if len(report.MissingObjects) != 1 || !report.MissingObjects[0].Cleared {
+		t.Errorf("missing = %+v, want one cleared", report.MissingObjects)
+	}
+	if key := archiveKey(t, s.missing); key != "" {
+		t.Errorf("missing document still points at %s", key)
+	}
+
+	// A second run finds nothing left to do
+	report, err = Run(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanObjects) != 0 || len(report.MissingObjects) != 0 || report.Relinked != 0 {
+		t.Errorf("second run = %+v, want nothing found", report)
+	}
+}
+
+func TestRunGraceWindow(t *testing.T) {
+	user, dataDir := setupReconcile(t)
+	recent := putObject(t, dataDir, user.ID, "Recent.pdf", 10*time.Minute)
+
+	t.Setenv("RECONCILE_GRACE", "5m")
+	report, err := Run(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanObjects) != 1 || report.OrphanObjects[0].Key != recent || objectExists(t, recent) {
+		t.Errorf("orphans = %+v, want %s deleted once past a shorter grace", report.OrphanObjects, recent)
+	}
+}
+
+func TestRunRequiresMultiUser(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	if _, err := Run(context.Background(), false); err == nil {
+		t.Error("Run in single-user mode succeeded")
+	}
+}
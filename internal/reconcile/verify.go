@@ -0,0 +1,152 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// CorruptObject is a document whose archived copy no longer matches the hash
+// recorded when it was stored, or can't be read
+type CorruptObject struct {
+	UserID     uuid.UUID `json:"user_id"`
+	DocumentID uuid.UUID `json:"document_id"`
+	Document   string    `json:"document"`
+	ArchiveKey string    `json:"archive_key"`
+	Error      string    `json:"error"`
+}
+
+// VerifyReport is the outcome of one verification run
+type VerifyReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Verified   int       `json:"verified"`
+	// Hashed counts documents archived before hashes were recorded, whose
+	// current copy was hashed for later runs
+	Hashed  int             `json:"hashed"`
+	Corrupt []CorruptObject `json:"corrupt"`
+	Errors  []string        `json:"errors,omitempty"`
+}
+
+var (
+	verifyMu      sync.Mutex
+	verifying     bool
+	lastVerifyRun *VerifyReport
+)
+
+// LastVerifyReport returns the most recent verification's report, or nil if
+// none ran yet
+func LastVerifyReport() *VerifyReport {
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+	return lastVerifyRun
+}
+
+// Verify reads back every archived copy and compares it with the hash
+// recorded on its document. Copies that differ or can't be read are marked
+// corrupt on the document; ones that match have their verification time
+// updated.
+func Verify(ctx context.Context) (*VerifyReport, error) {
+	verifyMu.Lock()
+	if verifying {
+		verifyMu.Unlock()
+		return nil, ErrRunning
+	}
+	verifying = true
+	verifyMu.Unlock()
+
+	report := &VerifyReport{StartedAt: time.Now(), Corrupt: []CorruptObject{}}
+	err := verify(ctx, report)
+	report.FinishedAt = time.Now()
+
+	verifyMu.Lock()
+	verifying = false
+	if err == nil {
+		lastVerifyRun = report
+	}
+	verifyMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	logging.Logf("[RECONCILE] Verified %d archived copies: %d corrupt, %d hashed for the first time",
+		report.Verified, len(report.Corrupt), report.Hashed)
+	return report, nil
+}
+
+func verify(ctx context.Context, report *VerifyReport) error {
+	if database.DB == nil || !database.IsMultiUserMode() {
+		return errors.New("verification requires multi-user mode")
+	}
+	var docs []database.Document
+	if err := database.DB.Select("id", "user_id", "document_name", "archive_key", "archive_hash").
+		Where("archive_key <> ''").Find(&docs).Error; err != nil {
+		return fmt.Errorf("failed to load documents: %w", err)
+	}
+
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sum, err := storage.HashObject(ctx, doc.ArchiveKey)
+		now := time.Now()
+		switch {
+		case err == nil && doc.ArchiveHash == "":
+			report.Hashed++
+			err = database.DB.Model(&database.Document{}).Where("id = ?", doc.ID).
+				Updates(map[string]interface{}{"archive_hash": sum, "archive_verified_at": now}).Error
+		case err == nil && sum == doc.ArchiveHash:
+			report.Verified++
+			err = database.DB.Model(&database.Document{}).Where("id = ?", doc.ID).Update("archive_verified_at", now).Error
+		default:
+			if err == nil {
+				err = fmt.Errorf("%w: has %s, expected %s", storage.ErrChecksumMismatch, sum, doc.ArchiveHash)
+			}
+			report.Corrupt = append(report.Corrupt, CorruptObject{
+				UserID:     doc.UserID,
+				DocumentID: doc.ID,
+				Document:   doc.DocumentName,
+				ArchiveKey: doc.ArchiveKey,
+				Error:      err.Error(),
+			})
+			err = database.DB.Model(&database.Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+				"archive_status": database.ArchiveStatusCorrupt,
+				"archive_error":  err.Error(),
+			}).Error
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("document %s: %v", doc.ID, err))
+		}
+	}
+	return nil
+}
+
+// StartVerify runs a verification every ARCHIVE_VERIFY_INTERVAL (default
+// off). Each run reads every archived copy back from storage.
+func StartVerify(ctx context.Context) {
+	interval := config.GetDuration("ARCHIVE_VERIFY_INTERVAL", 0)
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := Verify(ctx); err != nil {
+					logging.Logf("[RECONCILE] Scheduled verification failed: %v", err)
+				}
+			}
+		}
+	}()
+}
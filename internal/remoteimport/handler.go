@@ -0,0 +1,97 @@
+package remoteimport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// sourceRequest names the other instance and one of its admins' API keys
+type sourceRequest struct {
+	URL    string `json:"url" binding:"required"`
+	APIKey string `json:"api_key" binding:"required"`
+}
+
+func (req sourceRequest) source() (Source, error) {
+	u, err := NormalizeURL(req.URL)
+	return Source{URL: u, APIKey: req.APIKey}, err
+}
+
+// ListUsersHandler lists the users of the other instance, marking those that
+// clash with local users
+func ListUsersHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Remote import not available in single-user mode"})
+		return
+	}
+
+	var req sourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL and API key are required"})
+		return
+	}
+	src, err := req.source()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, err := ListUsers(c.Request.Context(), src)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// StartHandler starts importing the named users from the other instance
+func StartHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Remote import not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		sourceRequest
+		Usernames []string `json:"usernames" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL, API key and usernames are required"})
+		return
+	}
+	src, err := req.source()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logging.LogfWithUser(user.Username, "[REMOTE IMPORT] Importing %d users from %s", len(req.Usernames), src.URL)
+	err = Start(src, req.Usernames)
+	if errors.Is(err, ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": LastStatus()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": LastStatus()})
+}
+
+// StatusHandler returns the current or last import's progress
+func StatusHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Remote import not available in single-user mode"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": LastStatus()})
+}
@@ -0,0 +1,344 @@
+// Package remoteimport pulls users from another Aviary instance over its API.
+// The other instance makes a backup of just those users, which is downloaded
+// and merged into this instance's database and storage, keeping the users'
+// IDs, settings, rmapi pairings and archived documents.
+package remoteimport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/export"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// ErrRunning is returned when an import is already in progress
+var ErrRunning = errors.New("remote import already running")
+
+const (
+	apiTimeout   = 30 * time.Second
+	pollInterval = 5 * time.Second
+	// backupTimeout caps how long the other instance may take to make the
+	// backup
+	backupTimeout = time.Hour
+)
+
+// Source is the instance users are pulled from, reached with one of its
+// admins' API keys
+type Source struct {
+	URL    string
+	APIKey string
+}
+
+// RemoteUser is a user on the other instance
+type RemoteUser struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	IsAdmin  bool      `json:"is_admin"`
+	IsActive bool      `json:"is_active"`
+	// Conflict says why the user can't be imported, when a local user
+	// already has its ID, username or email
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Status is the progress of the current or last import
+type Status struct {
+	Source     string     `json:"source"`
+	Usernames  []string   `json:"usernames"`
+	Stage      string     `json:"stage"` // backing_up, downloading, importing, completed or failed
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	Tables []export.TableImportResult `json:"tables,omitempty"`
+}
+
+var (
+	statusMu sync.Mutex
+	current  *Status
+)
+
+// LastStatus returns the current or last import's status, or nil if none ran
+// yet
+func LastStatus() *Status {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if current == nil {
+		return nil
+	}
+	s := *current
+	return &s
+}
+
+func setStage(stage string) {
+	statusMu.Lock()
+	current.Stage = stage
+	statusMu.Unlock()
+}
+
+// NormalizeURL checks an instance URL and returns it without a trailing slash
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid instance URL %q", raw)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// do calls the other instance's API and decodes its JSON response into out
+func (s Source) do(ctx context.Context, method, path string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, s.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", s.APIKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s %s returned an unexpected response: %w", method, path, err)
+	}
+	return nil
+}
+
+// ListUsers returns the other instance's users, each marked with any
+// conflict with a local user
+func ListUsers(ctx context.Context, src Source) ([]RemoteUser, error) {
+	var users []RemoteUser
+	for page := 1; ; page++ {
+		var resp struct {
+			Users      []RemoteUser `json:"users"`
+			TotalPages int          `json:"total_pages"`
+		}
+		if err := src.do(ctx, http.MethodGet, fmt.Sprintf("/api/users?limit=100&page=%d", page), &resp); err != nil {
+			return nil, err
+		}
+		users = append(users, resp.Users...)
+		if page >= resp.TotalPages {
+			break
+		}
+	}
+	for i := range users {
+		users[i].Conflict = conflict(users[i])
+	}
+	return users, nil
+}
+
+// conflict returns why u can't be added alongside the local users
+func conflict(u RemoteUser) string {
+	var local database.User
+	if err := database.DB.Where("id = ?", u.ID).First(&local).Error; err == nil {
+		return "a user with this ID already exists"
+	}
+	if err := database.DB.Where("LOWER(username) = LOWER(?)", u.Username).First(&local).Error; err == nil {
+		return "username already taken"
+	}
+	if u.Email != "" {
+		if err := database.DB.Where("LOWER(email) = LOWER(?)", u.Email).First(&local).Error; err == nil {
+			return "email already in use"
+		}
+	}
+	return ""
+}
+
+// Start checks the selected users can be imported and then imports them in
+// the background. Progress is reported through LastStatus.
+func Start(src Source, usernames []string) error {
+	statusMu.Lock()
+	if current != nil && current.FinishedAt == nil {
+		statusMu.Unlock()
+		return ErrRunning
+	}
+	current = &Status{Source: src.URL, Usernames: usernames, Stage: "checking", StartedAt: time.Now()}
+	statusMu.Unlock()
+
+	ids, err := selectUsers(context.Background(), src, usernames)
+	if err != nil {
+		finish(err, nil)
+		return err
+	}
+	go func() {
+		tables, err := run(context.Background(), src, ids)
+		finish(err, tables)
+	}()
+	return nil
+}
+
+func finish(err error, tables []export.TableImportResult) {
+	now := time.Now()
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	current.FinishedAt = &now
+	current.Tables = tables
+	if err != nil {
+		current.Stage = "failed"
+		current.Error = err.Error()
+		logging.Logf("[REMOTE IMPORT] Import from %s failed: %v", current.Source, err)
+		return
+	}
+	current.Stage = "completed"
+	logging.Logf("[REMOTE IMPORT] Imported %s from %s", strings.Join(current.Usernames, ", "), current.Source)
+}
+
+// selectUsers returns the IDs of the named users on the other instance,
+// refusing if any is missing or clashes with a local user
+func selectUsers(ctx context.Context, src Source, usernames []string) ([]uuid.UUID, error) {
+	users, err := ListUsers(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]RemoteUser, len(users))
+	for _, u := range users {
+		byName[strings.ToLower(u.Username)] = u
+	}
+	var ids []uuid.UUID
+	var problems []string
+	for _, name := range usernames {
+		u, ok := byName[strings.ToLower(name)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: not found", name))
+		case u.Conflict != "":
+			problems = append(problems, fmt.Sprintf("%s: %s", name, u.Conflict))
+		default:
+			ids = append(ids, u.ID)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("can't import %s", strings.Join(problems, "; "))
+	}
+	return ids, nil
+}
+
+// run has the other instance back up the users, downloads the backup and
+// merges it in
+func run(ctx context.Context, src Source, ids []uuid.UUID) ([]export.TableImportResult, error) {
+	setStage("backing_up")
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, id.String())
+	}
+	var created struct {
+		JobID uuid.UUID `json:"job_id"`
+	}
+	path := "/api/admin/backup-job?include_files=true&include_configs=true&retention_days=1&user_ids=" + url.QueryEscape(strings.Join(strs, ","))
+	if err := src.do(ctx, http.MethodPost, path, &created); err != nil {
+		return nil, fmt.Errorf("failed to start backup: %w", err)
+	}
+	jobPath := "/api/admin/backup-job/" + created.JobID.String()
+	// The backup is only needed until it's downloaded
+	defer func() {
+		if err := src.do(context.Background(), http.MethodDelete, jobPath, nil); err != nil {
+			logging.Logf("[REMOTE IMPORT] Warning: failed to delete backup on %s: %v", src.URL, err)
+		}
+	}()
+
+	if err := waitForBackup(ctx, src, jobPath); err != nil {
+		return nil, err
+	}
+
+	setStage("downloading")
+	tempDir, err := os.MkdirTemp("", "aviary-remote-import-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	archivePath := filepath.Join(tempDir, "backup.tar.gz")
+	if err := download(ctx, src, jobPath+"/download", archivePath); err != nil {
+		return nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	setStage("importing")
+	dataDir := config.Get("DATA_DIR", "")
+	if dataDir == "" {
+		dataDir = "/data"
+	}
+	importer := export.NewImporter(database.DB, dataDir)
+	_, err = importer.Import(archivePath, export.ImportOptions{
+		OverwriteFiles:    true,
+		OverwriteDatabase: true,
+		UserIDs:           ids,
+		Merge:             true,
+	})
+	return importer.TableResults(), err
+}
+
+// waitForBackup polls the backup job until it completes
+func waitForBackup(ctx context.Context, src Source, jobPath string) error {
+	deadline := time.Now().Add(backupTimeout)
+	for time.Now().Before(deadline) {
+		var job struct {
+			Status       string `json:"status"`
+			ErrorMessage string `json:"error_message"`
+		}
+		if err := src.do(ctx, http.MethodGet, jobPath, &job); err != nil {
+			return err
+		}
+		switch job.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("backup failed on the other instance: %s", job.ErrorMessage)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	return errors.New("timed out waiting for the other instance's backup")
+}
+
+// download saves the backup archive to dest
+func download(ctx context.Context, src Source, path, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", src.APIKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", path, resp.Status)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,227 @@
+package remoteimport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"https://aviary.example.com", "https://aviary.example.com", true},
+		{" https://aviary.example.com/ ", "https://aviary.example.com", true},
+		{"http://10.0.0.5:8000/aviary/", "http://10.0.0.5:8000/aviary", true},
+		{"aviary.example.com", "", false},
+		{"ftp://aviary.example.com", "", false},
+		{"https://", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("NormalizeURL(%q) = %q, %v, want %q ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// fakeInstance is another Aviary instance's admin API
+type fakeInstance struct {
+	users     []RemoteUser
+	jobStatus string
+	archive   string
+	mu        sync.Mutex
+	requests  []string
+}
+
+func (f *fakeInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.mu.Unlock()
+	if r.Header.Get("X-API-Key") != "admin-key" {
+		http.Error(w, `{"error":"invalid API key"}`, http.StatusUnauthorized)
+		return
+	}
+
+	jobPath := "/api/admin/backup-job/" + fakeJobID.String()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/users":
+		// One user per page
+		var page int
+		fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+		resp := map[string]interface{}{"total_pages": len(f.users), "users": []RemoteUser{}}
+		if page >= 1 && page <= len(f.users) {
+			resp["users"] = f.users[page-1 : page]
+		}
+		json.NewEncoder(w).Encode(resp)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/admin/backup-job":
+		if r.URL.Query().Get("include_files") != "true" || r.URL.Query().Get("user_ids") == "" {
+			http.Error(w, "bad backup request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"job_id": fakeJobID})
+	case r.Method == http.MethodGet && r.URL.Path == jobPath:
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": f.jobStatus, "error_message": "disk full"})
+	case r.Method == http.MethodGet && r.URL.Path == jobPath+"/download":
+		w.Write([]byte(f.archive))
+	case r.Method == http.MethodDelete && r.URL.Path == jobPath:
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeInstance) seen() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+var fakeJobID = uuid.New()
+
+// setupRemoteImport creates a local multi-user database with one user and
+// serves a fake instance
+func setupRemoteImport(t *testing.T, f *fakeInstance) Source {
+	t.Helper()
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", t.TempDir())
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	if _, err := database.NewUserService(database.DB).CreateUser("alice", "alice@example.com", "correct-horse", true); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return Source{URL: srv.URL, APIKey: "admin-key"}
+}
+
+func remoteUsers() []RemoteUser {
+	return []RemoteUser{
+		{ID: uuid.New(), Username: "bob", Email: "bob@example.com", IsActive: true},
+		{ID: uuid.New(), Username: "Alice", Email: "alice@elsewhere.example.com", IsActive: true},
+		{ID: uuid.New(), Username: "carol", Email: "ALICE@example.com", IsActive: true},
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	f := &fakeInstance{users: remoteUsers()}
+	src := setupRemoteImport(t, f)
+
+	users, err := ListUsers(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, u := range users {
+		got[u.Username] = u.Conflict
+	}
+	want := map[string]string{"bob": "", "Alice": "username already taken", "carol": "email already in use"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("users and conflicts = %v, want %v", got, want)
+	}
+	if pages := len(f.seen()); pages != 3 {
+		t.Errorf("fetched %d pages, want 3", pages)
+	}
+
+	src.APIKey = "wrong"
+	if _, err := ListUsers(context.Background(), src); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("ListUsers with a bad key = %v, want the 401", err)
+	}
+}
+
+func TestSelectUsers(t *testing.T) {
+	f := &fakeInstance{users: remoteUsers()}
+	src := setupRemoteImport(t, f)
+
+	ids, err := selectUsers(context.Background(), src, []string{"BOB"})
+	if err != nil || len(ids) != 1 || ids[0] != f.users[0].ID {
+		t.Errorf("selectUsers(BOB) = %v, %v, want bob's ID", ids, err)
+	}
+	_, err = selectUsers(context.Background(), src, []string{"bob", "alice", "dave"})
+	if err == nil || !strings.Contains(err.Error(), "alice: username already taken") || !strings.Contains(err.Error(), "dave: not found") {
+		t.Errorf("selectUsers with clashes = %v, want each problem listed", err)
+	}
+}
+
+func TestRunDeletesRemoteBackup(t *testing.T) {
+	f := &fakeInstance{users: remoteUsers(), jobStatus: "completed", archive: "not a backup"}
+	src := setupRemoteImport(t, f)
+	current = &Status{StartedAt: time.Now()}
+
+	_, err := run(context.Background(), src, []uuid.UUID{f.users[0].ID})
+	if err == nil {
+		t.Fatal("importing a corrupt archive succeeded")
+	}
+	jobPath := "/api/admin/backup-job/" + fakeJobID.String()
+	want := []string{
+		"POST /api/admin/backup-job",
+		"GET " + jobPath,
+		"GET " + jobPath + "/download",
+		"DELETE " + jobPath,
+	}
+	if got := f.seen(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	if stage := LastStatus().Stage; stage != "importing" {
+		t.Errorf("stage = %s, want importing", stage)
+	}
+
+	// A failed backup is reported and still deleted
+	f.jobStatus, f.requests = "failed", nil
+	_, err = run(context.Background(), src, []uuid.UUID{f.users[0].ID})
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("run with a failed backup = %v, want its error", err)
+	}
+	if got := f.seen(); len(got) == 0 || got[len(got)-1] != "DELETE "+jobPath {
+		t.Errorf("requests = %q, want the backup deleted", got)
+	}
+}
+
+func TestStart(t *testing.T) {
+	f := &fakeInstance{users: remoteUsers()}
+	src := setupRemoteImport(t, f)
+
+	current = &Status{Stage: "downloading", StartedAt: time.Now()}
+	if err := Start(src, []string{"bob"}); err != ErrRunning {
+		t.Errorf("Start during an import = %v, want ErrRunning", err)
+	}
+
+	now := time.Now()
+	current.FinishedAt = &now
+	if err := Start(src, []string{"dave"}); err == nil {
+		t.Error("Start with an unknown user succeeded")
+	}
+	status := LastStatus()
+	if status.Stage != "failed" || status.FinishedAt == nil || !strings.Contains(status.Error, "dave: not found") {
+		t.Errorf("status = %+v, want failed with the missing user", status)
+	}
+	// The check runs before anything is backed up
+	for _, r := range f.seen() {
+		if strings.Contains(r, "backup-job") {
+			t.Errorf("backup started for a rejected import: %s", r)
+		}
+	}
+}
@@ -89,6 +89,14 @@ func (w *ExtractionWorker) run() {
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
+	// Enforce retention whenever the worker spins up
+	if _, err := CleanupExpiredUploads(w.db); err != nil {
+		logging.Logf("[RESTORE] Warning: failed to cleanup expired restore uploads: %v", err)
+	}
+	if err := CleanupExpiredExtractions(w.db); err != nil {
+		logging.Logf("[RESTORE] Warning: failed to cleanup expired extraction jobs: %v", err)
+	}
+
 	for {
 		select {
 		case <-w.quit:
@@ -485,8 +493,8 @@ func CleanupExtractionJob(db *gorm.DB, jobID uuid.UUID, adminUserID uuid.UUID) e
 
 // CleanupExpiredExtractions removes old extraction jobs and their files
 func CleanupExpiredExtractions(db *gorm.DB) error {
-	// Find extraction jobs older than 24 hours
-	cutoff := time.Now().Add(-24 * time.Hour)
+	// Find extraction jobs older than the restore upload retention window
+	cutoff := time.Now().Add(-GetUploadRetention())
 	var oldJobs []database.RestoreExtractionJob
 	if err := db.Where("created_at < ?", cutoff).Find(&oldJobs).Error; err != nil {
 		return err
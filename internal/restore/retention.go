@@ -0,0 +1,91 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"gorm.io/gorm"
+)
+
+// UploadRetentionSettingKey is the system setting controlling how long restore uploads are kept
+const UploadRetentionSettingKey = "restore_upload_retention_hours"
+
+const defaultUploadRetention = 24 * time.Hour
+
+// CleanupResult summarizes what a retention sweep removed
+type CleanupResult struct {
+	Removed        int   `json:"removed"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// GetUploadRetention returns how long uploaded restore files and their
+// extractions are kept before the workers remove them
+func GetUploadRetention() time.Duration {
+	value, err := database.GetSystemSetting(UploadRetentionSettingKey)
+	if err != nil {
+		return defaultUploadRetention
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours <= 0 {
+		return defaultUploadRetention
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// CleanupExpiredUploads removes restore uploads past their expiry along with
+// any extraction job created for them
+func CleanupExpiredUploads(db *gorm.DB) (CleanupResult, error) {
+	var result CleanupResult
+
+	var expired []database.RestoreUpload
+	if err := db.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return result, err
+	}
+
+	for _, upload := range expired {
+		if job, err := GetExtractionJobByUpload(db, upload.ID, upload.AdminUserID); err == nil {
+			result.ReclaimedBytes += dirSize(job.ExtractedPath)
+			if err := CleanupExtractionJob(db, job.ID, upload.AdminUserID); err != nil {
+				logging.Logf("[WARNING] Failed to cleanup extraction job %s for expired upload %s: %v", job.ID, upload.ID, err)
+			}
+		}
+
+		if err := os.Remove(upload.FilePath); err == nil {
+			result.ReclaimedBytes += upload.FileSize
+		} else if !os.IsNotExist(err) {
+			logging.Logf("[WARNING] Failed to remove expired restore file %s: %v", upload.FilePath, err)
+			continue
+		}
+
+		if err := db.Delete(&upload).Error; err != nil {
+			logging.Logf("[WARNING] Failed to delete expired restore upload %s: %v", upload.ID, err)
+			continue
+		}
+		result.Removed++
+	}
+
+	if result.Removed > 0 {
+		logging.Logf("[RESTORE] Retention removed %d expired restore upload(s), reclaimed %d bytes", result.Removed, result.ReclaimedBytes)
+	}
+
+	return result, nil
+}
+
+// dirSize returns the total size of regular files under path
+func dirSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,179 @@
+package rmapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// Capabilities describes which upload options a reMarkable cloud host
+// supports. Self-hosted hosts such as rmfakecloud may only implement part of
+// the official API.
+type Capabilities struct {
+	// Host is the RMAPI_HOST the capabilities belong to; empty for the official cloud
+	Host string `json:"host"`
+	// Known is false when the host could not be probed, in which case nothing is rejected
+	Known bool `json:"known"`
+	// Sync15 reports whether the host implements the sync 1.5 API
+	Sync15 bool `json:"sync15"`
+	// ContentOnly reports whether existing documents can have their file replaced
+	ContentOnly bool `json:"content_only"`
+	// Coverpage reports whether the cover page can be set on upload
+	Coverpage bool      `json:"coverpage"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// UnsupportedError is returned when an upload option is not supported by the
+// user's reMarkable cloud host
+type UnsupportedError struct {
+	Host   string
+	Option string
+	Value  string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s=%s is not supported by the reMarkable cloud at %s", e.Option, e.Value, e.Host)
+}
+
+const (
+	capabilitiesTTL      = time.Hour
+	capabilitiesRetryTTL = time.Minute
+)
+
+var (
+	capabilitiesMu    sync.Mutex
+	capabilitiesCache = make(map[string]Capabilities)
+	probeClient       = &http.Client{Timeout: 10 * time.Second}
+)
+
+// HostFor returns the RMAPI_HOST used for user's uploads; empty means the
+// official cloud
+func HostFor(user *database.User) string {
+	if database.IsMultiUserMode() {
+		if user == nil {
+			return ""
+		}
+		return user.RmapiHost
+	}
+	return config.Get("RMAPI_HOST", "")
+}
+
+// GetCapabilities returns the capabilities of host, probing it when they are
+// not cached
+func GetCapabilities(ctx context.Context, host string) Capabilities {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return Capabilities{Known: true, Sync15: true, ContentOnly: true, Coverpage: true}
+	}
+	if features := config.Get("RMAPI_HOST_FEATURES", ""); features != "" {
+		return capabilitiesFromFeatures(host, features)
+	}
+
+	capabilitiesMu.Lock()
+	cached, ok := capabilitiesCache[host]
+	capabilitiesMu.Unlock()
+	ttl := capabilitiesTTL
+	if !cached.Known {
+		ttl = capabilitiesRetryTTL
+	}
+	if ok && time.Since(cached.CheckedAt) < ttl {
+		return cached
+	}
+
+	caps := ProbeCapabilities(ctx, host)
+	capabilitiesMu.Lock()
+	capabilitiesCache[host] = caps
+	capabilitiesMu.Unlock()
+	return caps
+}
+
+// ProbeCapabilities asks host which sync API it implements. Replacing a
+// document's content and setting its cover page both rewrite the document's
+// files, which rmapi only does through the sync 1.5 API.
+func ProbeCapabilities(ctx context.Context, host string) Capabilities {
+	caps := Capabilities{Host: host, CheckedAt: time.Now()}
+	base := strings.TrimRight(host, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	for _, p := range []string{"/sync/v4/root", "/sync/v3/root"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+p, nil)
+		if err != nil {
+			caps.Error = err.Error()
+			return caps
+		}
+		resp, err := probeClient.Do(req)
+		if err != nil {
+			caps.Error = err.Error()
+			logging.Logf("[RMAPI] Could not probe %s: %v", host, err)
+			return caps
+		}
+		resp.Body.Close()
+		caps.Known = true
+		// Without a token the endpoint answers 401; only a missing route means no support
+		if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusMethodNotAllowed {
+			caps.Sync15 = true
+			break
+		}
+	}
+
+	caps.ContentOnly = caps.Sync15
+	caps.Coverpage = caps.Sync15
+	logging.Logf("[RMAPI] %s capabilities: sync15=%t content_only=%t coverpage=%t", host, caps.Sync15, caps.ContentOnly, caps.Coverpage)
+	return caps
+}
+
+// capabilitiesFromFeatures builds capabilities from a comma-separated
+// RMAPI_HOST_FEATURES list instead of probing
+func capabilitiesFromFeatures(host, features string) Capabilities {
+	caps := Capabilities{Host: host, Known: true, CheckedAt: time.Now()}
+	for _, f := range strings.Split(features, ",") {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "sync15":
+			caps.Sync15 = true
+		case "content_only":
+			caps.ContentOnly = true
+		case "coverpage":
+			caps.Coverpage = true
+		}
+	}
+	return caps
+}
+
+// Check returns an UnsupportedError when conflictResolution or coverpage asks
+// for something the host can't do
+func (c Capabilities) Check(conflictResolution, coverpage string) error {
+	if !c.Known {
+		return nil
+	}
+	if conflictResolution == "content_only" && !c.ContentOnly {
+		return &UnsupportedError{Host: c.Host, Option: "conflict_resolution", Value: conflictResolution}
+	}
+	if coverpage == "first" && !c.Coverpage {
+		return &UnsupportedError{Host: c.Host, Option: "coverpage", Value: coverpage}
+	}
+	return nil
+}
+
+// CapabilitiesHandler returns the capabilities of the current user's reMarkable cloud host
+func CapabilitiesHandler(c *gin.Context) {
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, ok := requireUser(c)
+		if !ok {
+			return
+		}
+		user = u
+	}
+	c.JSON(http.StatusOK, GetCapabilities(c.Request.Context(), HostFor(user)))
+}
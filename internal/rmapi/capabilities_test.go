@@ -0,0 +1,78 @@
+package rmapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeCloud stands in for an rmfakecloud server that answers on the given routes
+func fakeCloud(t *testing.T, routes ...string) *httptest.Server {
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string
+		sync15 bool
+	}{
+		{"sync 1.5 v3", []string{"/sync/v3/root"}, true},
+		{"sync 1.5 v4", []string{"/sync/v4/root"}, true},
+		{"sync 1.0 only", []string{"/document-storage/json/2/docs"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeCloud(t, tt.routes...)
+			caps := ProbeCapabilities(context.Background(), srv.URL)
+			if !caps.Known {
+				t.Fatalf("probe failed: %s", caps.Error)
+			}
+			if caps.Sync15 != tt.sync15 || caps.ContentOnly != tt.sync15 || caps.Coverpage != tt.sync15 {
+				t.Errorf("got sync15=%t content_only=%t coverpage=%t, want %t", caps.Sync15, caps.ContentOnly, caps.Coverpage, tt.sync15)
+			}
+		})
+	}
+}
+
+func TestProbeCapabilitiesUnreachable(t *testing.T) {
+	srv := fakeCloud(t)
+	srv.Close()
+	caps := ProbeCapabilities(context.Background(), srv.URL)
+	if caps.Known {
+		t.Fatal("unreachable host reported as known")
+	}
+	if err := caps.Check("content_only", "first"); err != nil {
+		t.Errorf("unknown capabilities should not reject options: %v", err)
+	}
+}
+
+func TestCapabilitiesCheck(t *testing.T) {
+	legacy := Capabilities{Host: "rm.example.com", Known: true}
+
+	var unsupported *UnsupportedError
+	if err := legacy.Check("content_only", "current"); !errors.As(err, &unsupported) || unsupported.Option != "conflict_resolution" {
+		t.Errorf("content_only: got %v", err)
+	}
+	if err := legacy.Check("abort", "first"); !errors.As(err, &unsupported) || unsupported.Option != "coverpage" {
+		t.Errorf("coverpage: got %v", err)
+	}
+	if err := legacy.Check("overwrite", "current"); err != nil {
+		t.Errorf("overwrite: got %v", err)
+	}
+
+	caps := capabilitiesFromFeatures("rm.example.com", "content_only, coverpage")
+	if err := caps.Check("content_only", "first"); err != nil {
+		t.Errorf("RMAPI_HOST_FEATURES: got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package rmapi
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
@@ -127,20 +128,35 @@ func PairHandler(c *gin.Context) {
 		return
 	}
 
+	if err := PairUser(user, req.Code); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Pairing failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// PairUser pairs user's account with the reMarkable cloud using a one-time
+// code and saves the resulting rmapi config (multi-user mode)
+func PairUser(user *database.User, code string) error {
+	// Mock successful pairing in DRY_RUN mode
+	if config.Get("DRY_RUN", "") != "" {
+		return nil
+	}
+
 	// Create temporary directory for rmapi pairing process
 	tempDir, err := os.MkdirTemp("", "rmapi-pair-*")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp directory"})
-		return
+		return fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tempDir)
-	
+
 	cfgPath := filepath.Join(tempDir, "rmapi.conf")
 
 	// Run rmapi cd command with user-specific configuration
 	cmd := exec.Command("rmapi", "cd")
-	cmd.Stdin = strings.NewReader(req.Code + "\n")
-	
+	cmd.Stdin = strings.NewReader(strings.TrimSpace(code) + "\n")
+
 	env := os.Environ()
 	env = append(env, "RMAPI_CONFIG="+cfgPath)
 	if user.RmapiHost != "" {
@@ -150,23 +166,22 @@ func PairHandler(c *gin.Context) {
 		env = filterEnv(env, "RMAPI_HOST")
 	}
 	cmd.Env = env
-	
+
 	if err := cmd.Run(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Pairing failed"})
-		return
+		return fmt.Errorf("rmapi pairing failed: %w", err)
 	}
 
 	// After successful pairing, save config to database
 	if configContent, err := os.ReadFile(cfgPath); err == nil {
 		SaveUserConfig(user.ID, string(configContent))
 	}
+	database.RecordOnboarding(user.ID, database.OnboardingPairedDevice)
 
 	// Call post-pairing callback if set (async for folder cache refresh)
 	if postPairingCallback != nil {
 		go postPairingCallback(user.ID.String(), false) // false = multi-user mode
 	}
-
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	return nil
 }
 
 // UnpairHandler removes the rmapi configuration for the current user
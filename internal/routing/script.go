@@ -0,0 +1,245 @@
+// Package routing evaluates an admin-provided Starlark script for each request
+// to pick the target folder, prefix and document name from the source URL and
+// request metadata, so routing rules can change without code changes.
+//
+// The script must define a route(doc) function. doc exposes url, host, path,
+// filename, username, rm_dir, prefix, manage and fields (the remaining request
+// parameters as a dict). route returns None to keep the request as-is, or a
+// dict with any of rm_dir, prefix and filename:
+//
+//	def route(doc):
+//	    if doc.host.endswith("arxiv.org"):
+//	        return {"rm_dir": "/Papers", "prefix": "arXiv"}
+//	    return None
+//
+// Scripts run without file, network or module access and are stopped once they
+// exceed ROUTING_SCRIPT_MAX_STEPS, ROUTING_SCRIPT_TIMEOUT or
+// ROUTING_SCRIPT_MAX_MEMORY_MB.
+package routing
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	routeFunc = "route"
+
+	defaultMaxSteps    = 100000
+	defaultMaxMemoryMB = 64
+	memoryPollInterval = 5 * time.Millisecond
+	maxScriptSize      = 64 * 1024
+	maxResultLength    = 255
+)
+
+// allocMetric is the cumulative number of bytes allocated on the Go heap
+const allocMetric = "/gc/heap/allocs:bytes"
+
+// Input describes the request the script routes
+type Input struct {
+	URL      string
+	Filename string
+	Username string
+	RmDir    string
+	Prefix   string
+	Manage   bool
+	// Fields holds the remaining request parameters
+	Fields map[string]string
+}
+
+// Result holds the values returned by the script; empty fields are unchanged
+type Result struct {
+	RmDir    string
+	Prefix   string
+	Filename string
+}
+
+// Enabled reports whether ROUTING_SCRIPT is configured
+func Enabled() bool {
+	return config.Get("ROUTING_SCRIPT", "") != ""
+}
+
+// Evaluate runs the ROUTING_SCRIPT route function for in. The script is read on
+// every call so edits take effect without a restart.
+func Evaluate(in Input) (Result, error) {
+	scriptPath := config.Get("ROUTING_SCRIPT", "")
+	if scriptPath == "" {
+		return Result{}, nil
+	}
+	src, err := readScript(scriptPath)
+	if err != nil {
+		return Result{}, err
+	}
+
+	thread := &starlark.Thread{
+		Name: "routing",
+		Print: func(_ *starlark.Thread, msg string) {
+			logging.Logf("[ROUTING] script: %s", msg)
+		},
+		Load: func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("load(%q) is not allowed in routing scripts", module)
+		},
+	}
+	thread.SetMaxExecutionSteps(uint64(config.GetInt("ROUTING_SCRIPT_MAX_STEPS", defaultMaxSteps)))
+
+	timeout := config.GetDuration("ROUTING_SCRIPT_TIMEOUT", time.Second)
+	timer := time.AfterFunc(timeout, func() {
+		thread.Cancel(fmt.Sprintf("timed out after %s", timeout))
+	})
+	defer timer.Stop()
+	stopWatch := watchMemory(thread, int64(config.GetInt("ROUTING_SCRIPT_MAX_MEMORY_MB", defaultMaxMemoryMB))<<20)
+	defer stopWatch()
+
+	globals, err := starlark.ExecFile(thread, path.Base(scriptPath), src, starlark.StringDict{
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("routing script failed: %w", err)
+	}
+	fn, ok := globals[routeFunc].(starlark.Callable)
+	if !ok {
+		return Result{}, fmt.Errorf("routing script does not define %s(doc)", routeFunc)
+	}
+
+	value, err := starlark.Call(thread, fn, starlark.Tuple{document(in)}, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("routing script failed: %w", err)
+	}
+	return parseResult(value)
+}
+
+// readScript reads the script, refusing anything implausibly large
+func readScript(scriptPath string) ([]byte, error) {
+	info, err := os.Stat(scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ROUTING_SCRIPT: %w", err)
+	}
+	if info.Size() > maxScriptSize {
+		return nil, fmt.Errorf("ROUTING_SCRIPT is larger than %d bytes", maxScriptSize)
+	}
+	return os.ReadFile(scriptPath)
+}
+
+// watchMemory cancels thread once the heap has grown by more than limit bytes
+// since the script started. Allocation is measured process-wide, so the limit
+// is approximate when other jobs are running. The returned func stops the watch.
+func watchMemory(thread *starlark.Thread, limit int64) func() {
+	if limit <= 0 {
+		return func() {}
+	}
+	sample := []metrics.Sample{{Name: allocMetric}}
+	metrics.Read(sample)
+	start := sample[0].Value.Uint64()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(memoryPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				metrics.Read(sample)
+				if int64(sample[0].Value.Uint64()-start) > limit {
+					thread.Cancel(fmt.Sprintf("exceeded memory limit of %d MB", limit>>20))
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// document builds the doc value passed to route
+func document(in Input) starlark.Value {
+	var host, urlPath string
+	if u, err := url.Parse(in.URL); err == nil && in.URL != "" {
+		host = u.Hostname()
+		urlPath = u.Path
+	}
+
+	fields := starlark.NewDict(len(in.Fields))
+	for k, v := range in.Fields {
+		fields.SetKey(starlark.String(k), starlark.String(v))
+	}
+	fields.Freeze()
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"url":      starlark.String(in.URL),
+		"host":     starlark.String(host),
+		"path":     starlark.String(urlPath),
+		"filename": starlark.String(in.Filename),
+		"username": starlark.String(in.Username),
+		"rm_dir":   starlark.String(in.RmDir),
+		"prefix":   starlark.String(in.Prefix),
+		"manage":   starlark.Bool(in.Manage),
+		"fields":   fields,
+	})
+}
+
+// parseResult validates the value returned by route
+func parseResult(value starlark.Value) (Result, error) {
+	var result Result
+	if value == starlark.None {
+		return result, nil
+	}
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return result, fmt.Errorf("route must return a dict or None, got %s", value.Type())
+	}
+
+	for _, item := range dict.Items() {
+		key, ok := starlark.AsString(item[0])
+		if !ok {
+			return result, fmt.Errorf("route returned a non-string key %s", item[0])
+		}
+		if item[1] == starlark.None {
+			continue
+		}
+		val, ok := starlark.AsString(item[1])
+		if !ok {
+			return result, fmt.Errorf("route returned a non-string value for %q", key)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) > maxResultLength {
+			return result, fmt.Errorf("route returned a %q longer than %d characters", key, maxResultLength)
+		}
+
+		switch key {
+		case "rm_dir":
+			if val == "" {
+				continue
+			}
+			if !strings.HasPrefix(val, "/") {
+				val = "/" + val
+			}
+			for _, segment := range strings.Split(val, "/") {
+				if segment == ".." {
+					return result, fmt.Errorf("route returned an invalid rm_dir %q", val)
+				}
+			}
+			result.RmDir = path.Clean(val)
+		case "prefix":
+			result.Prefix = val
+		case "filename":
+			if val != "" && (strings.ContainsAny(val, `/\`) || val == "." || val == "..") {
+				return result, fmt.Errorf("route returned an invalid filename %q", val)
+			}
+			result.Filename = val
+		default:
+			return result, fmt.Errorf("route returned unknown key %q (expected rm_dir, prefix or filename)", key)
+		}
+	}
+	return result, nil
+}
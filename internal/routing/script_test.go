@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, src string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "route.star")
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ROUTING_SCRIPT", file)
+}
+
+func TestEvaluateRoutesByHost(t *testing.T) {
+	writeScript(t, `
+def route(doc):
+    if doc.host.endswith("arxiv.org"):
+        return {"rm_dir": "Papers/" + doc.fields["tag"], "prefix": "arXiv", "filename": doc.path.split("/")[-1]}
+    return None
+`)
+
+	got, err := Evaluate(Input{
+		URL:    "https://arxiv.org/pdf/2401.00001",
+		Fields: map[string]string{"tag": "ml"},
+	})
+	if err != nil {
+		t.Fatalf("Evaluate returned error: %v", err)
+	}
+	want := Result{RmDir: "/Papers/ml", Prefix: "arXiv", Filename: "2401.00001"}
+	if got != want {
+		t.Errorf("Evaluate = %+v, want %+v", got, want)
+	}
+
+	got, err = Evaluate(Input{URL: "https://example.com/a.pdf"})
+	if err != nil || got != (Result{}) {
+		t.Errorf("Evaluate = %+v, %v, want no changes", got, err)
+	}
+}
+
+func TestEvaluateEnforcesLimits(t *testing.T) {
+	writeScript(t, `
+def route(doc):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return None
+`)
+	t.Setenv("ROUTING_SCRIPT_MAX_STEPS", "1000")
+	if _, err := Evaluate(Input{}); err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Errorf("expected step limit error, got %v", err)
+	}
+
+	t.Setenv("ROUTING_SCRIPT_MAX_STEPS", "0")
+	t.Setenv("ROUTING_SCRIPT_TIMEOUT", "50ms")
+	if _, err := Evaluate(Input{}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestEvaluateRejectsInvalidResults(t *testing.T) {
+	for _, src := range []string{
+		`def route(doc): return {"rm_dir": "/Books/../.."}`,
+		`def route(doc): return {"filename": "../escape.pdf"}`,
+		`def route(doc): return {"folder": "/Books"}`,
+		`def route(doc): return "/Books"`,
+		`load("os.star", "os")`,
+	} {
+		writeScript(t, src)
+		if _, err := Evaluate(Input{}); err == nil {
+			t.Errorf("expected error for script %q", src)
+		}
+	}
+}
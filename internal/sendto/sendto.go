@@ -0,0 +1,213 @@
+// Package sendto delivers copies of uploaded documents to a user's other
+// readers once they've reached the reMarkable: by email, e.g. to a Send to
+// Kindle address, or into a folder a Kobo or other reader syncs from.
+package sendto
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/smtp"
+)
+
+const (
+	// KindEmail mails the document as an attachment
+	KindEmail = "email"
+	// KindFolder copies the document into a folder under SEND_TARGET_DIR
+	KindFolder = "folder"
+)
+
+// maxAttachmentSize is the largest document mailed to an email target.
+// Kindle accepts up to 50 MB, but many SMTP servers stop at 25.
+func maxAttachmentSize() int64 {
+	return int64(config.GetInt("SEND_TARGET_MAX_MB", 25)) << 20
+}
+
+// folderRoot is the directory folder targets live under, or empty when
+// folder targets are disabled
+func folderRoot() string {
+	return config.Get("SEND_TARGET_DIR", "")
+}
+
+// FoldersEnabled reports whether users may add folder targets
+func FoldersEnabled() bool {
+	return folderRoot() != ""
+}
+
+// Normalize tidies t's fields and checks it can be delivered to
+func Normalize(t *database.SendTarget) error {
+	t.Kind = strings.ToLower(strings.TrimSpace(t.Kind))
+	t.Address = strings.TrimSpace(t.Address)
+	t.Name = strings.TrimSpace(t.Name)
+
+	var formats []string
+	for _, f := range strings.Split(t.Formats, ",") {
+		if f = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(f)), "."); f != "" {
+			formats = append(formats, f)
+		}
+	}
+	t.Formats = strings.Join(formats, ",")
+
+	switch t.Kind {
+	case KindEmail:
+		addr, err := mail.ParseAddress(t.Address)
+		if err != nil {
+			return fmt.Errorf("invalid email address %q", t.Address)
+		}
+		t.Address = addr.Address
+		if !smtp.IsSMTPConfigured() {
+			return errors.New("email targets need SMTP to be configured")
+		}
+	case KindFolder:
+		if !FoldersEnabled() {
+			return errors.New("folder targets are disabled on this server")
+		}
+		clean := filepath.Clean("/" + t.Address)
+		if clean == "/" {
+			return errors.New("folder is required")
+		}
+		t.Address = strings.TrimPrefix(clean, "/")
+	default:
+		return fmt.Errorf("unknown target kind %q (valid options: email, folder)", t.Kind)
+	}
+	if t.Name == "" {
+		t.Name = t.Address
+	}
+	return nil
+}
+
+// wants reports whether t takes documents named name
+func wants(t database.SendTarget, name string) bool {
+	if t.Formats == "" {
+		return true
+	}
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	for _, f := range strings.Split(t.Formats, ",") {
+		if f == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Deliver sends the document at path to each of userID's enabled targets that
+// takes its format. Folder copies are made before it returns, so the caller
+// may remove path; emails are sent in the background. Failures are logged
+// and recorded on the target rather than failing the upload.
+func Deliver(userID uuid.UUID, path string) {
+	if database.DB == nil || userID == uuid.Nil {
+		return
+	}
+	var targets []database.SendTarget
+	if err := database.DB.Where("user_id = ? AND enabled = ?", userID, true).Find(&targets).Error; err != nil {
+		logging.Logf("[SENDTO] Failed to load targets for user %s: %v", userID, err)
+		return
+	}
+
+	name := filepath.Base(path)
+	var data []byte
+	for _, t := range targets {
+		if !wants(t, name) {
+			continue
+		}
+		if t.Kind == KindEmail && data == nil {
+			var err error
+			if data, err = readAttachment(path); err != nil {
+				record(t, err)
+				continue
+			}
+		}
+		t := t
+		if t.Kind == KindEmail {
+			go func() { record(t, send(t, path, data)) }()
+			continue
+		}
+		record(t, send(t, path, nil))
+	}
+}
+
+// Send delivers the document at path to t right away, for testing a target
+func Send(t database.SendTarget, path string) error {
+	var data []byte
+	if t.Kind == KindEmail {
+		var err error
+		if data, err = readAttachment(path); err != nil {
+			return err
+		}
+	}
+	err := send(t, path, data)
+	record(t, err)
+	return err
+}
+
+func send(t database.SendTarget, path string, data []byte) error {
+	if config.Get("DRY_RUN", "") != "" {
+		logging.Logf("[SENDTO] [DRY RUN] would send %s to %s target %s", filepath.Base(path), t.Kind, t.Name)
+		return nil
+	}
+	switch t.Kind {
+	case KindEmail:
+		return smtp.SendDocumentEmail(t.Address, filepath.Base(path), data)
+	case KindFolder:
+		return copyToFolder(t.Address, path)
+	}
+	return fmt.Errorf("unknown target kind %q", t.Kind)
+}
+
+// readAttachment reads a document to mail, refusing ones too big to send
+func readAttachment(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if max := maxAttachmentSize(); info.Size() > max {
+		return nil, fmt.Errorf("%s is %d MB, over the %d MB email limit", filepath.Base(path), info.Size()>>20, max>>20)
+	}
+	return os.ReadFile(path)
+}
+
+// copyToFolder copies the document at path into folder under SEND_TARGET_DIR
+func copyToFolder(folder, path string) error {
+	root := folderRoot()
+	if root == "" {
+		return errors.New("folder targets are disabled on this server")
+	}
+	dir := filepath.Join(root, filepath.Clean("/"+folder))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Write under a temporary name so a syncing reader never sees a partial file
+	dest := filepath.Join(dir, filepath.Base(path))
+	tmp := dest + ".part"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// record saves the outcome of a delivery on the target
+func record(t database.SendTarget, err error) {
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		logging.Logf("[SENDTO] Failed to send to %s target %s: %v", t.Kind, t.Name, err)
+		updates["last_error"] = err.Error()
+	} else {
+		updates["last_sent_at"] = time.Now()
+	}
+	if dbErr := database.DB.Model(&database.SendTarget{}).Where("id = ?", t.ID).Updates(updates).Error; dbErr != nil {
+		logging.Logf("[SENDTO] Failed to record delivery to %s: %v", t.Name, dbErr)
+	}
+}
@@ -0,0 +1,69 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SendDocumentEmail mails a document as an attachment, e.g. to a Send to
+// Kindle address. The subject is the document name, without extension.
+func SendDocumentEmail(to, filename string, data []byte) error {
+	cfg, err := GetSMTPConfig()
+	if err != nil {
+		return fmt.Errorf("SMTP not configured: %w", err)
+	}
+
+	filename = filepath.Base(filename)
+	subject := strings.TrimSuffix(filename, filepath.Ext(filename))
+	var contentType string
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".epub":
+		contentType = "application/epub+zip"
+	case ".pdf":
+		contentType = "application/pdf"
+	default:
+		if contentType = mime.TypeByExtension(ext); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	boundary := "aviary-" + uuid.NewString()
+
+	var message bytes.Buffer
+	message.WriteString(fmt.Sprintf("From: %s\r\n", cfg.From))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
+	message.WriteString("\r\n")
+
+	message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
+	message.WriteString("Content-Transfer-Encoding: 7bit\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(fmt.Sprintf("Sent by Aviary: %s\r\n", filename))
+
+	encodedName := mime.QEncoding.Encode("utf-8", filename)
+	message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	message.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", contentType, encodedName))
+	message.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", encodedName))
+	message.WriteString("Content-Transfer-Encoding: base64\r\n")
+	message.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		message.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	message.WriteString(encoded + "\r\n")
+	message.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+
+	auth := smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	return smtp.SendMail(addr, auth, cfg.From, []string{to}, message.Bytes())
+}
@@ -0,0 +1,118 @@
+package smtp
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// QuotaWarning describes a quota a user is close to, or at, the limit of
+type QuotaWarning struct {
+	Username string
+	// Quota is "storage" or "uploads"
+	Quota   string
+	Percent int
+	Used    string
+	Limit   string
+	SiteURL string
+	// Language is the locale the email is written in
+	Language string
+}
+
+// Exceeded reports whether the quota is used up
+func (w QuotaWarning) Exceeded() bool {
+	return w.Percent >= 100
+}
+
+// Noun names the quota in a sentence
+func (w QuotaWarning) Noun() string {
+	if w.Quota == "uploads" {
+		return tr(w.Language, "quota.uploads")
+	}
+	return tr(w.Language, "quota.storage")
+}
+
+// Heading is the warning's title, also used for its subject
+func (w QuotaWarning) Heading() string {
+	if w.Exceeded() {
+		return tr(w.Language, "quota.heading_exceeded", "quota", w.Noun())
+	}
+	return tr(w.Language, "quota.heading_warning", "quota", w.Noun(), "percent", strconv.Itoa(w.Percent))
+}
+
+// Next tells the user what happens next and what they can do about it
+func (w QuotaWarning) Next() string {
+	switch {
+	case !w.Exceeded():
+		return tr(w.Language, "quota.warning_next")
+	case w.Quota == "uploads":
+		return tr(w.Language, "quota.exceeded_next_uploads")
+	}
+	return tr(w.Language, "quota.exceeded_next")
+}
+
+// SendQuotaWarningEmail tells a user they've used most or all of a quota
+func SendQuotaWarningEmail(email string, w QuotaWarning) error {
+	cfg, err := GetSMTPConfig()
+	if err != nil {
+		return fmt.Errorf("SMTP not configured: %w", err)
+	}
+
+	siteURL, err := validateURL(config.Get("SITE_URL", "http://localhost:8000"))
+	if err != nil {
+		return fmt.Errorf("invalid site URL: %w", err)
+	}
+	w.SiteURL = siteURL
+	w.Username = sanitizeUsername(w.Username)
+
+	subject := "Aviary: " + w.Heading()
+
+	htmlBody, err := generateQuotaWarningHTML(w)
+	if err != nil {
+		return fmt.Errorf("failed to generate quota warning HTML: %w", err)
+	}
+	return sendEmail(cfg, email, subject, generateQuotaWarningText(w), htmlBody)
+}
+
+func generateQuotaWarningHTML(w QuotaWarning) (string, error) {
+	tmpl := `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Heading}} - Aviary</title>
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <h1 style="font-size: 22px;">{{.Heading}}</h1>
+    <p>{{t "greeting" "username" .Username}}</p>
+    <p>{{t "quota.used" "used" .Used "quota" .Noun "limit" .Limit}}</p>
+    <p>{{.Next}}</p>
+    <p><a href="{{.SiteURL}}">{{t "quota.open" "site" "Aviary"}}</a></p>
+</body>
+</html>`
+
+	t, err := template.New("quota").Funcs(templateFuncs(w.Language)).Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, w); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func generateQuotaWarningText(w QuotaWarning) string {
+	return fmt.Sprintf(`%s
+
+%s
+
+%s
+
+%s: %s
+`, tr(w.Language, "greeting", "username", w.Username),
+		tr(w.Language, "quota.used", "used", w.Used, "quota", w.Noun(), "limit", w.Limit),
+		w.Next(), tr(w.Language, "quota.open", "site", "Aviary"), w.SiteURL)
+}
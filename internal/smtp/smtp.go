@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html"
 	"html/template"
+	"mime"
 	"net/smtp"
 	"net/url"
 	"regexp"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/i18n"
 )
 
 // SMTPConfig holds SMTP configuration
@@ -34,6 +36,29 @@ type EmailData struct {
 	SiteName    string
 	SiteURL     string
 	ExpiryHours int
+	// Invite words the reset email as an invitation to set a first password
+	Invite bool
+	// Language is the locale the email is written in
+	Language string
+}
+
+// tr returns the email message for key in lang, with pairs of placeholder
+// names and values filled in
+func tr(lang, key string, pairs ...string) string {
+	vars := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		vars[pairs[i]] = pairs[i+1]
+	}
+	return i18n.T(lang, "email."+key, vars)
+}
+
+// templateFuncs gives email templates a t function translating into lang
+func templateFuncs(lang string) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, pairs ...string) string {
+			return tr(lang, key, pairs...)
+		},
+	}
 }
 
 var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
@@ -129,14 +154,21 @@ func sanitizeEmailData(data *EmailData) error {
 	return nil
 }
 
-// GetSMTPConfig reads SMTP configuration from environment variables
+// GetSMTPConfig reads SMTP configuration from environment variables. When
+// SMTP_HOST isn't set in multi-user mode, the smtp_* system settings saved by
+// the setup wizard are used instead.
 func GetSMTPConfig() (*SMTPConfig, error) {
-	host := config.Get("SMTP_HOST", "")
+	get := config.Get
+	if config.Get("SMTP_HOST", "") == "" && database.IsMultiUserMode() && database.DB != nil {
+		get = storedSetting
+	}
+
+	host := get("SMTP_HOST", "")
 	if host == "" {
 		return nil, fmt.Errorf("SMTP_HOST not configured")
 	}
 
-	portStr := config.Get("SMTP_PORT", "")
+	portStr := get("SMTP_PORT", "")
 	if portStr == "" {
 		portStr = "587"
 	}
@@ -145,16 +177,16 @@ func GetSMTPConfig() (*SMTPConfig, error) {
 		return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
 	}
 
-	username := config.Get("SMTP_USERNAME", "")
-	password := config.Get("SMTP_PASSWORD", "")
-	from := config.Get("SMTP_FROM", "")
+	username := get("SMTP_USERNAME", "")
+	password := get("SMTP_PASSWORD", "")
+	from := get("SMTP_FROM", "")
 
 	if from == "" {
 		return nil, fmt.Errorf("SMTP_FROM not configured")
 	}
 
 	useTLS := true
-	if tlsStr := config.Get("SMTP_TLS", ""); tlsStr != "" {
+	if tlsStr := get("SMTP_TLS", ""); tlsStr != "" {
 		useTLS = strings.ToLower(tlsStr) == "true"
 	}
 
@@ -168,14 +200,33 @@ func GetSMTPConfig() (*SMTPConfig, error) {
 	}, nil
 }
 
+// storedSetting reads the system setting for an SMTP_* variable, e.g.
+// smtp_host for SMTP_HOST
+func storedSetting(key, def string) string {
+	if value, err := database.GetSystemSetting(strings.ToLower(key)); err == nil && value != "" {
+		return value
+	}
+	return def
+}
+
 // IsSMTPConfigured checks if SMTP is properly configured
 func IsSMTPConfigured() bool {
 	_, err := GetSMTPConfig()
 	return err == nil
 }
 
-// SendPasswordResetEmail sends a password reset email
-func SendPasswordResetEmail(email, username, resetToken string) error {
+// SendPasswordResetEmail sends a password reset email in lang
+func SendPasswordResetEmail(email, username, resetToken, lang string) error {
+	return sendResetLinkEmail(email, username, resetToken, lang, false)
+}
+
+// SendInviteEmail invites a user created by an admin to choose their password
+// through a password reset link, in lang
+func SendInviteEmail(email, username, resetToken, lang string) error {
+	return sendResetLinkEmail(email, username, resetToken, lang, true)
+}
+
+func sendResetLinkEmail(email, username, resetToken, lang string, invite bool) error {
 	cfg, err := GetSMTPConfig()
 	if err != nil {
 		return fmt.Errorf("SMTP not configured: %w", err)
@@ -212,10 +263,15 @@ func SendPasswordResetEmail(email, username, resetToken string) error {
 		SiteName:    "Aviary",
 		SiteURL:     siteURL,
 		ExpiryHours: expiryHours,
+		Invite:      invite,
+		Language:    lang,
 	}
 
 	// Generate email content
-	subject := "Password Reset"
+	subject := tr(lang, "reset.subject")
+	if invite {
+		subject = tr(lang, "invite.subject", "site", emailData.SiteName)
+	}
 	htmlBody, err := generatePasswordResetHTML(emailData)
 	if err != nil {
 		return fmt.Errorf("failed to generate email HTML: %w", err)
@@ -227,8 +283,8 @@ func SendPasswordResetEmail(email, username, resetToken string) error {
 	return sendEmail(cfg, email, subject, textBody, htmlBody)
 }
 
-// SendWelcomeEmail sends a welcome email to new users
-func SendWelcomeEmail(email, username string) error {
+// SendWelcomeEmail sends a welcome email to new users in lang
+func SendWelcomeEmail(email, username, lang string) error {
 	cfg, err := GetSMTPConfig()
 	if err != nil {
 		return fmt.Errorf("SMTP not configured: %w", err)
@@ -248,9 +304,10 @@ func SendWelcomeEmail(email, username string) error {
 		Username: sanitizeUsername(username),
 		SiteName: "Aviary",
 		SiteURL:  validatedSiteURL,
+		Language: lang,
 	}
 
-	subject := "Welcome to Aviary!"
+	subject := tr(lang, "welcome.subject", "site", emailData.SiteName)
 	htmlBody, err := generateWelcomeHTML(emailData)
 	if err != nil {
 		return fmt.Errorf("failed to generate welcome email HTML: %w", err)
@@ -267,7 +324,7 @@ func sendEmail(config *SMTPConfig, to, subject, textBody, htmlBody string) error
 	headers := make(map[string]string)
 	headers["From"] = config.From
 	headers["To"] = to
-	headers["Subject"] = subject
+	headers["Subject"] = mime.QEncoding.Encode("utf-8", subject)
 	headers["MIME-Version"] = "1.0"
 	headers["Content-Type"] = "multipart/alternative; boundary=\"boundary123\""
 
@@ -280,14 +337,14 @@ func sendEmail(config *SMTPConfig, to, subject, textBody, htmlBody string) error
 	// Add multipart content
 	message.WriteString("--boundary123\r\n")
 	message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-	message.WriteString("Content-Transfer-Encoding: 7bit\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
 	message.WriteString("\r\n")
 	message.WriteString(textBody)
 	message.WriteString("\r\n")
 
 	message.WriteString("--boundary123\r\n")
 	message.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-	message.WriteString("Content-Transfer-Encoding: 7bit\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
 	message.WriteString("\r\n")
 	message.WriteString(htmlBody)
 	message.WriteString("\r\n")
@@ -309,7 +366,7 @@ func generatePasswordResetHTML(data EmailData) (string, error) {
 <html>
 <head>
     <meta charset="UTF-8">
-    <title>Password Reset - {{.SiteName}}</title>
+    <title>{{if .Invite}}{{t "invite.heading"}}{{else}}{{t "reset.subject"}}{{end}} - {{.SiteName}}</title>
     <style>
         body { 
             font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, "Helvetica Neue", Arial, sans-serif; 
@@ -437,22 +494,23 @@ func generatePasswordResetHTML(data EmailData) (string, error) {
                 </svg>
             </div>
             <div class="content">
-                <h2>Password Reset Request</h2>
-                <p>Hello <strong>{{.Username}}</strong>,</p>
-                <p>We received a request to reset your password for your {{.SiteName}} account.</p>
-                <p>Click the button below to reset your password:</p>
+                {{if .Invite}}<h2>{{t "invite.heading"}}</h2>{{else}}<h2>{{t "reset.heading"}}</h2>{{end}}
+                <p>{{t "greeting" "username" .Username}}</p>
+                {{if .Invite}}<p>{{t "invite.intro" "site" .SiteName}}</p>
+                <p>{{t "invite.action"}}</p>{{else}}<p>{{t "reset.intro" "site" .SiteName}}</p>
+                <p>{{t "reset.action"}}</p>{{end}}
                 <div style="text-align: center;">
-                    <a href="{{.ResetURL}}" class="button">Reset Password</a>
+                    <a href="{{.ResetURL}}" class="button">{{if .Invite}}{{t "invite.button"}}{{else}}{{t "reset.button"}}{{end}}</a>
                 </div>
-                <p>If the button doesn't work, copy and paste this link into your browser:</p>
+                <p>{{t "link_fallback"}}</p>
                 <p><a href="{{.ResetURL}}" class="link">{{.ResetURL}}</a></p>
                 <div class="warning">
-                    <p><strong>Important:</strong> This link will expire in {{.ExpiryHours}} hours for security reasons.</p>
+                    <p><strong>{{t "reset.expiry" "hours" (printf "%d" .ExpiryHours)}}</strong></p>
                 </div>
-                <p>If you didn't request this password reset, please ignore this email. Your password will remain unchanged and your account is secure.</p>
+                {{if .Invite}}<p>{{t "invite.expired"}}</p>{{else}}<p>{{t "reset.ignore"}}</p>{{end}}
             </div>
             <div class="footer">
-                <p>This email was sent by {{.SiteName}} • <a href="{{.SiteURL}}">{{.SiteURL}}</a></p>
+                <p>{{t "footer" "site" .SiteName}} • <a href="{{.SiteURL}}">{{.SiteURL}}</a></p>
             </div>
         </div>
     </div>
@@ -460,7 +518,7 @@ func generatePasswordResetHTML(data EmailData) (string, error) {
 </html>
 `
 
-	t, err := template.New("password_reset").Parse(tmpl)
+	t, err := template.New("password_reset").Funcs(templateFuncs(data.Language)).Parse(tmpl)
 	if err != nil {
 		return "", err
 	}
@@ -475,22 +533,51 @@ func generatePasswordResetHTML(data EmailData) (string, error) {
 
 // generatePasswordResetText generates plain text content for password reset email
 func generatePasswordResetText(data EmailData) string {
-	return fmt.Sprintf(`Password Reset Request - %s
+	lang := data.Language
+	hours := strconv.Itoa(data.ExpiryHours)
+	if data.Invite {
+		return fmt.Sprintf(`%s
 
-Hello %s,
+%s
 
-We received a request to reset your password for your %s account.
+%s
 
-To reset your password, please visit the following link:
+%s
 %s
 
-This link will expire in %d hours.
+%s %s
 
-If you didn't request this password reset, please ignore this email. Your password will remain unchanged.
+--
+%s (%s)
+`, tr(lang, "invite.subject", "site", data.SiteName),
+			tr(lang, "greeting", "username", data.Username),
+			tr(lang, "invite.intro", "site", data.SiteName),
+			tr(lang, "invite.action_link"), data.ResetURL,
+			tr(lang, "reset.expiry", "hours", hours), tr(lang, "invite.expired"),
+			tr(lang, "footer", "site", data.SiteName), data.SiteURL)
+	}
+	return fmt.Sprintf(`%s - %s
+
+%s
+
+%s
+
+%s
+%s
+
+%s
+
+%s
 
 --
-This email was sent by %s (%s)
-`, data.SiteName, data.Username, data.SiteName, data.ResetURL, data.ExpiryHours, data.SiteName, data.SiteURL)
+%s (%s)
+`, tr(lang, "reset.heading"), data.SiteName,
+		tr(lang, "greeting", "username", data.Username),
+		tr(lang, "reset.intro", "site", data.SiteName),
+		tr(lang, "reset.action_link"), data.ResetURL,
+		tr(lang, "reset.expiry", "hours", hours),
+		tr(lang, "reset.ignore"),
+		tr(lang, "footer", "site", data.SiteName), data.SiteURL)
 }
 
 // generateWelcomeHTML generates HTML content for welcome email
@@ -500,7 +587,7 @@ func generateWelcomeHTML(data EmailData) (string, error) {
 <html>
 <head>
     <meta charset="UTF-8">
-    <title>Welcome to {{.SiteName}}</title>
+    <title>{{t "welcome.subject" "site" .SiteName}}</title>
     <style>
         body { 
             font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, "Helvetica Neue", Arial, sans-serif; 
@@ -621,26 +708,26 @@ func generateWelcomeHTML(data EmailData) (string, error) {
                         </g>
                     </g>
                 </svg>
-                <p style="margin: 16px 0 0 0; color: oklch(0.556 0 0); font-size: 18px; font-weight: 500;">Welcome to Aviary!</p>
+                <p style="margin: 16px 0 0 0; color: oklch(0.556 0 0); font-size: 18px; font-weight: 500;">{{t "welcome.subject" "site" .SiteName}}</p>
             </div>
             <div class="content">
-                <h2>Hello {{.Username}},</h2>
-                <p>Welcome to {{.SiteName}}! Your account has been created successfully.</p>
-                <p>{{.SiteName}} is a web-based document uploader that automatically downloads and sends ePubs, images, and PDFs to your reMarkable tablet.</p>
+                <h2>{{t "greeting" "username" .Username}}</h2>
+                <p>{{t "welcome.intro" "site" .SiteName}}</p>
+                <p>{{t "welcome.about" "site" .SiteName}}</p>
                 <div class="feature-box">
-                    <p><strong>You can now:</strong></p>
+                    <p><strong>{{t "welcome.can_now"}}</strong></p>
                     <ul>
-                        <li>Configure your sending preferences</li>
-                        <li>Upload documents from URLs or local files</li>
-                        <li>Manage your API keys for programmatic access</li>
+                        <li>{{t "welcome.feature_preferences"}}</li>
+                        <li>{{t "welcome.feature_upload"}}</li>
+                        <li>{{t "welcome.feature_api_keys"}}</li>
                     </ul>
                 </div>
                 <div style="text-align: center;">
-                    <a href="{{.SiteURL}}" class="button">Go to {{.SiteName}}</a>
+                    <a href="{{.SiteURL}}" class="button">{{t "welcome.button" "site" .SiteName}}</a>
                 </div>
             </div>
             <div class="footer">
-                <p>This email was sent by {{.SiteName}} • <a href="{{.SiteURL}}">{{.SiteURL}}</a></p>
+                <p>{{t "footer" "site" .SiteName}} • <a href="{{.SiteURL}}">{{.SiteURL}}</a></p>
             </div>
         </div>
     </div>
@@ -648,7 +735,7 @@ func generateWelcomeHTML(data EmailData) (string, error) {
 </html>
 `
 
-	t, err := template.New("welcome").Parse(tmpl)
+	t, err := template.New("welcome").Funcs(templateFuncs(data.Language)).Parse(tmpl)
 	if err != nil {
 		return "", err
 	}
@@ -663,24 +750,34 @@ func generateWelcomeHTML(data EmailData) (string, error) {
 
 // generateWelcomeText generates plain text content for welcome email
 func generateWelcomeText(data EmailData) string {
-	return fmt.Sprintf(`Welcome to %s!
+	lang := data.Language
+	return fmt.Sprintf(`%s
 
-Hello %s,
+%s
 
-Welcome to %s! Your account has been created successfully.
+%s
 
-%s is a web-based document uploader that automatically downloads and sends PDFs to your reMarkable tablet.
+%s
 
-You can now:
-- Configure your sending preferences
-- Upload documents from URLs or local files
-- Manage your API keys for programmatic access
+%s
+- %s
+- %s
+- %s
 
-Visit %s to get started!
+%s
 
 --
-This email was sent by %s (%s)
-`, data.SiteName, data.Username, data.SiteName, data.SiteName, data.SiteURL, data.SiteName, data.SiteURL)
+%s (%s)
+`, tr(lang, "welcome.subject", "site", data.SiteName),
+		tr(lang, "greeting", "username", data.Username),
+		tr(lang, "welcome.intro", "site", data.SiteName),
+		tr(lang, "welcome.about", "site", data.SiteName),
+		tr(lang, "welcome.can_now"),
+		tr(lang, "welcome.feature_preferences"),
+		tr(lang, "welcome.feature_upload"),
+		tr(lang, "welcome.feature_api_keys"),
+		tr(lang, "welcome.get_started", "url", data.SiteURL),
+		tr(lang, "footer", "site", data.SiteName), data.SiteURL)
 }
 
 // TestSMTPConnection tests the SMTP connection
@@ -19,9 +19,22 @@ var globalConfig StorageConfig
 
 // InitializeStorage initializes the global storage backend based on configuration
 func InitializeStorage() error {
-	cfg := GetStorageConfig()
+	return ConfigureStorage(GetStorageConfig())
+}
+
+// ConfigureStorage replaces the global storage backend with one built from cfg
+func ConfigureStorage(cfg StorageConfig) error {
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return err
+	}
 	globalConfig = cfg
-	
+	globalBackend = backend
+	return nil
+}
+
+// NewBackend builds a storage backend from cfg without installing it
+func NewBackend(cfg StorageConfig) (StorageBackendWithInfo, error) {
 	var backend StorageBackendWithInfo
 	var err error
 	
@@ -29,7 +42,7 @@ func InitializeStorage() error {
 	case "s3":
 		backend, err = createS3Backend(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to create S3 backend: %w", err)
+			return nil, fmt.Errorf("failed to create S3 backend: %w", err)
 		}
 		logging.Logf("[STORAGE] Initialized S3 backend: s3://%s (endpoint: %s)", cfg.S3Bucket, cfg.S3Endpoint)
 		
@@ -44,11 +57,10 @@ func InitializeStorage() error {
 		logging.Logf("[STORAGE] Initialized filesystem backend: %s", storageDir)
 		
 	default:
-		return fmt.Errorf("unknown storage backend: %s", cfg.Backend)
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend)
 	}
 	
-	globalBackend = backend
-	return nil
+	return backend, nil
 }
 
 // GetStorageBackend returns the initialized global storage backend
@@ -76,22 +88,23 @@ func createS3Backend(cfg StorageConfig) (StorageBackendWithInfo, error) {
 	var awsCfg aws.Config
 	var err error
 	
+	opts := []func(*config.LoadOptions) error{config.WithRegion(cfg.S3Region)}
+	if cfg.S3MaxAttempts > 0 {
+		// Each request, including each part of a multipart upload, is
+		// retried on its own
+		opts = append(opts, config.WithRetryMaxAttempts(cfg.S3MaxAttempts))
+	}
+
 	// Configure credentials if provided
 	if cfg.S3AccessKeyID != "" && cfg.S3SecretKey != "" {
-		awsCfg, err = config.LoadDefaultConfig(context.TODO(),
-			config.WithRegion(cfg.S3Region),
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				cfg.S3AccessKeyID,
-				cfg.S3SecretKey,
-				"",
-			)),
-		)
-	} else {
-		// Use default credential chain (IAM roles, etc.)
-		awsCfg, err = config.LoadDefaultConfig(context.TODO(),
-			config.WithRegion(cfg.S3Region),
-		)
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			cfg.S3AccessKeyID,
+			cfg.S3SecretKey,
+			"",
+		)))
 	}
+	// Without credentials the default chain is used (IAM roles, etc.)
+	awsCfg, err = config.LoadDefaultConfig(context.TODO(), opts...)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
@@ -124,7 +137,7 @@ func createS3Backend(cfg StorageConfig) (StorageBackendWithInfo, error) {
 		return nil, fmt.Errorf("failed to access S3 bucket %s: %w", cfg.S3Bucket, err)
 	}
 	
-	backend := NewS3Backend(s3Client, cfg.S3Bucket)
+	backend := NewS3Backend(s3Client, cfg.S3Bucket, cfg)
 	return backend, nil
 }
 
@@ -20,12 +20,27 @@ type S3Backend struct {
 	bucket   string
 }
 
-func NewS3Backend(client *s3.Client, bucket string) *S3Backend {
+// maxCopyObjectSize is the largest object a single CopyObject can copy;
+// larger ones are copied in parts
+const maxCopyObjectSize = 5 << 30
+
+// copyPartSize is the size of each part of a multipart copy
+const copyPartSize = 512 << 20
+
+func NewS3Backend(client *s3.Client, bucket string, cfg StorageConfig) *S3Backend {
+	partSize := int64(cfg.S3PartSizeMB) << 20
+	if partSize < manager.MinUploadPartSize {
+		partSize = manager.MinUploadPartSize
+	}
+	concurrency := cfg.S3UploadConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
-		// Set part size to 5MB for multipart uploads
-		u.PartSize = 5 * 1024 * 1024
-		// Enable concurrency for large files
-		u.Concurrency = 5
+		// Objects larger than a part are sent in parts, each retried on
+		// its own, and a failed upload is aborted so no parts are left
+		u.PartSize = partSize
+		u.Concurrency = concurrency
 	})
 	
 	return &S3Backend{
@@ -126,7 +141,22 @@ func (s3b *S3Backend) Exists(ctx context.Context, key string) (bool, error) {
 func (s3b *S3Backend) Copy(ctx context.Context, srcKey, dstKey string) error {
 	copySource := fmt.Sprintf("%s/%s", s3b.bucket, srcKey)
 
-	_, err := s3b.client.CopyObject(ctx, &s3.CopyObjectInput{
+	head, err := s3b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3b.bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy object from %s to %s: %w", srcKey, dstKey, err)
+	}
+	if size := aws.ToInt64(head.ContentLength); size > maxCopyObjectSize {
+		if err := s3b.multipartCopy(ctx, copySource, dstKey, size); err != nil {
+			return fmt.Errorf("failed to copy object from %s to %s: %w", srcKey, dstKey, err)
+		}
+		logging.Logf("[STORAGE] S3 Copy (multipart): s3://%s/%s -> s3://%s/%s", s3b.bucket, srcKey, s3b.bucket, dstKey)
+		return nil
+	}
+
+	_, err = s3b.client.CopyObject(ctx, &s3.CopyObjectInput{
 		Bucket:     aws.String(s3b.bucket),
 		Key:        aws.String(dstKey),
 		CopySource: aws.String(copySource),
@@ -140,6 +170,57 @@ func (s3b *S3Backend) Copy(ctx context.Context, srcKey, dstKey string) error {
 	return nil
 }
 
+// multipartCopy copies an object too large for CopyObject in parts of
+// copyPartSize, aborting the upload if any part fails
+func (s3b *S3Backend) multipartCopy(ctx context.Context, copySource, dstKey string, size int64) error {
+	created, err := s3b.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s3b.bucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		return err
+	}
+	abort := func() {
+		s3b.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s3b.bucket),
+			Key:      aws.String(dstKey),
+			UploadId: created.UploadId,
+		})
+	}
+
+	var parts []types.CompletedPart
+	for start, n := int64(0), int32(1); start < size; start, n = start+copyPartSize, n+1 {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		part, err := s3b.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(s3b.bucket),
+			Key:             aws.String(dstKey),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			PartNumber:      aws.Int32(n),
+			UploadId:        created.UploadId,
+		})
+		if err != nil {
+			abort()
+			return fmt.Errorf("part %d: %w", n, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int32(n)})
+	}
+
+	if _, err := s3b.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s3b.bucket),
+		Key:             aws.String(dstKey),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		abort()
+		return err
+	}
+	return nil
+}
+
 func (s3b *S3Backend) ListWithInfo(ctx context.Context, prefix string) ([]StorageInfo, error) {
 	var infos []StorageInfo
 
@@ -14,6 +14,11 @@ type StorageConfig struct {
 	S3AccessKeyID    string
 	S3SecretKey      string
 	S3ForcePathStyle bool
+	// Multipart uploads: part size in MB, parts sent at once, and attempts
+	// per request before giving up
+	S3PartSizeMB        int
+	S3UploadConcurrency int
+	S3MaxAttempts       int
 }
 
 // GetStorageConfig returns storage configuration from environment variables
@@ -27,6 +32,10 @@ func GetStorageConfig() StorageConfig {
 		S3AccessKeyID:    internalConfig.Get("S3_ACCESS_KEY_ID", ""),
 		S3SecretKey:      internalConfig.Get("S3_SECRET_ACCESS_KEY", ""),
 		S3ForcePathStyle: internalConfig.GetBool("S3_FORCE_PATH_STYLE", false),
+
+		S3PartSizeMB:        internalConfig.GetInt("S3_PART_SIZE_MB", 5),
+		S3UploadConcurrency: internalConfig.GetInt("S3_UPLOAD_CONCURRENCY", 5),
+		S3MaxAttempts:       internalConfig.GetInt("S3_MAX_ATTEMPTS", 5),
 	}
 }
 
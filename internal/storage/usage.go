@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	internalConfig "github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// ErrStorageFull is returned when archiving a file would take the local
+// storage backend past LOCAL_STORAGE_LIMIT_MB
+var ErrStorageFull = errors.New("local storage limit reached")
+
+// usageMaxAge is how long a measurement is reused before the storage is
+// walked again
+const usageMaxAge = 5 * time.Minute
+
+// DiskUsage is how much space the local storage backend takes up
+type DiskUsage struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path,omitempty"`
+	// UsedBytes and Files cover everything under the storage directory
+	UsedBytes int64           `json:"used_bytes"`
+	Files     int             `json:"files"`
+	Users     []UserDiskUsage `json:"users"`
+	// Other is the size of each top-level folder that isn't a user's, such
+	// as backups
+	Other map[string]int64 `json:"other"`
+	// LimitBytes is LOCAL_STORAGE_LIMIT_MB, or 0 for no limit
+	LimitBytes  int64     `json:"limit_bytes"`
+	Warning     bool      `json:"warning"`
+	Full        bool      `json:"full"`
+	VolumeBytes int64     `json:"volume_bytes,omitempty"`
+	VolumeFree  int64     `json:"volume_free_bytes,omitempty"`
+	MeasuredAt  time.Time `json:"measured_at"`
+}
+
+// UserDiskUsage is the space one user's files take up
+type UserDiskUsage struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username,omitempty"`
+	Bytes    int64     `json:"bytes"`
+	Files    int       `json:"files"`
+}
+
+var (
+	usageMu     sync.Mutex
+	usageCache  *DiskUsage
+	usageWarned bool
+)
+
+// LocalStorageLimit is LOCAL_STORAGE_LIMIT_MB in bytes, or 0 for no limit
+func LocalStorageLimit() int64 {
+	return int64(internalConfig.GetInt("LOCAL_STORAGE_LIMIT_MB", 0)) << 20
+}
+
+// storageWarnPercent is how full the local storage may get before warnings
+// are logged
+func storageWarnPercent() int64 {
+	return int64(internalConfig.GetInt("LOCAL_STORAGE_WARN_PERCENT", 90))
+}
+
+// MeasureUsage walks the local storage backend and totals its size overall,
+// per user and per top-level folder. Other backends only report their type.
+func MeasureUsage(ctx context.Context) (*DiskUsage, error) {
+	fs, ok := GetStorageBackend().(*FilesystemBackend)
+	if !ok {
+		return &DiskUsage{Backend: GetStorageType(), Users: []UserDiskUsage{}, Other: map[string]int64{}, MeasuredAt: time.Now()}, nil
+	}
+	objects, err := fs.ListWithInfo(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure storage: %w", err)
+	}
+
+	usage := &DiskUsage{
+		Backend:    "filesystem",
+		Path:       fs.basePath,
+		Users:      []UserDiskUsage{},
+		Other:      map[string]int64{},
+		LimitBytes: LocalStorageLimit(),
+		MeasuredAt: time.Now(),
+	}
+	users := map[uuid.UUID]*UserDiskUsage{}
+	for _, obj := range objects {
+		usage.UsedBytes += obj.Size
+		usage.Files++
+		top, rest, _ := strings.Cut(obj.Key, "/")
+		if top == "users" {
+			idStr, _, _ := strings.Cut(rest, "/")
+			if id, err := uuid.Parse(idStr); err == nil {
+				u := users[id]
+				if u == nil {
+					u = &UserDiskUsage{UserID: id}
+					users[id] = u
+				}
+				u.Bytes += obj.Size
+				u.Files++
+				continue
+			}
+		}
+		if rest == "" {
+			top = "."
+		}
+		usage.Other[top] += obj.Size
+	}
+	for _, u := range users {
+		usage.Users = append(usage.Users, *u)
+	}
+	sort.Slice(usage.Users, func(i, j int) bool { return usage.Users[i].Bytes > usage.Users[j].Bytes })
+	usage.VolumeBytes, usage.VolumeFree = volumeSpace(fs.basePath)
+	usage.updateLimits()
+	return usage, nil
+}
+
+func (u *DiskUsage) updateLimits() {
+	u.Full = u.LimitBytes > 0 && u.UsedBytes >= u.LimitBytes
+	u.Warning = u.LimitBytes > 0 && u.UsedBytes*100 >= u.LimitBytes*storageWarnPercent()
+}
+
+// CurrentUsage returns the last measurement of the local storage backend,
+// measuring it again if it's older than a few minutes
+func CurrentUsage(ctx context.Context) (*DiskUsage, error) {
+	usageMu.Lock()
+	if usageCache != nil && time.Since(usageCache.MeasuredAt) < usageMaxAge {
+		u := *usageCache
+		usageMu.Unlock()
+		return &u, nil
+	}
+	usageMu.Unlock()
+	return RefreshUsage(ctx)
+}
+
+// RefreshUsage measures the local storage backend now and keeps the result
+// for CurrentUsage
+func RefreshUsage(ctx context.Context) (*DiskUsage, error) {
+	usage, err := MeasureUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usageMu.Lock()
+	cached := *usage
+	usageCache = &cached
+	usageMu.Unlock()
+	return usage, nil
+}
+
+// CheckSpace returns ErrStorageFull if storing size more bytes would take
+// the local storage backend past LOCAL_STORAGE_LIMIT_MB, and logs a warning
+// once it's over LOCAL_STORAGE_WARN_PERCENT of it
+func CheckSpace(ctx context.Context, size int64) error {
+	limit := LocalStorageLimit()
+	if limit <= 0 || GetStorageType() != "filesystem" {
+		return nil
+	}
+	usage, err := CurrentUsage(ctx)
+	if err != nil {
+		// Don't stop archiving because the storage couldn't be measured
+		logging.Logf("[STORAGE] Warning: %v", err)
+		return nil
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	if usage.UsedBytes+size > limit {
+		logging.Logf("[STORAGE] Warning: local storage limit reached (%d of %d bytes used), not archiving", usage.UsedBytes, limit)
+		return ErrStorageFull
+	}
+	if usage.Warning && !usageWarned {
+		logging.Logf("[STORAGE] Warning: local storage is %d%% full (%d of %d bytes used)", usage.UsedBytes*100/limit, usage.UsedBytes, limit)
+	}
+	usageWarned = usage.Warning
+	return nil
+}
+
+// AddUsage counts size bytes just written to the local storage backend
+// toward the last measurement, so the limit holds between measurements
+func AddUsage(size int64) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	if usageCache != nil {
+		usageCache.UsedBytes += size
+		usageCache.updateLimits()
+	}
+}
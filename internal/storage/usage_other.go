@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package storage
+
+// volumeSpace isn't available on this platform
+func volumeSpace(path string) (size, free int64) {
+	return 0, 0
+}
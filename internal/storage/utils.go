@@ -2,6 +2,9 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -162,4 +165,36 @@ func MoveInStorage(ctx context.Context, srcKey, dstKey string) error {
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// ErrChecksumMismatch is returned when a stored object doesn't hash to the
+// expected value
+var ErrChecksumMismatch = errors.New("stored object checksum mismatch")
+
+// HashObject reads the object at storageKey back from the backend and returns
+// its hex SHA-256
+func HashObject(ctx context.Context, storageKey string) (string, error) {
+	reader, err := GetStorageBackend().Get(ctx, storageKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file from storage %s: %w", storageKey, err)
+	}
+	defer reader.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", fmt.Errorf("failed to read file from storage %s: %w", storageKey, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyObject reads the object at storageKey back and returns
+// ErrChecksumMismatch unless its SHA-256 is sha
+func VerifyObject(ctx context.Context, storageKey, sha string) error {
+	got, err := HashObject(ctx, storageKey)
+	if err != nil {
+		return err
+	}
+	if got != sha {
+		return fmt.Errorf("%w: %s has %s, expected %s", ErrChecksumMismatch, storageKey, got, sha)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package subscription
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// maxSubscriptions caps how many subscriptions a user can add
+const maxSubscriptions = 20
+
+// Request creates or updates a subscription
+type Request struct {
+	Name          string `json:"name" binding:"required"`
+	URL           string `json:"url" binding:"required"`
+	Cron          string `json:"cron" binding:"required"`
+	Timezone      string `json:"timezone"`
+	Enabled       *bool  `json:"enabled"`
+	RmDir         string `json:"rm_dir"`
+	Prefix        string `json:"prefix"`
+	Manage        bool   `json:"manage"`
+	RetentionDays int    `json:"retention_days"`
+	Archive       bool   `json:"archive"`
+	Compress      bool   `json:"compress"`
+	OutputFormat  string `json:"output_format"`
+	UpdatePolicy  string `json:"update_policy"`
+}
+
+// apply validates req and copies it onto s
+func (req Request) apply(s *database.Subscription) error {
+	s.Name = strings.TrimSpace(req.Name)
+	s.URL = strings.TrimSpace(req.URL)
+	s.Cron = strings.TrimSpace(req.Cron)
+	s.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	s.RmDir = ""
+	if dir := strings.TrimSpace(req.RmDir); dir != "" {
+		s.RmDir = path.Clean("/" + dir)
+	}
+	s.Prefix = strings.TrimSpace(req.Prefix)
+	s.Manage = req.Manage
+	s.RetentionDays = req.RetentionDays
+	if s.RetentionDays == 0 {
+		s.RetentionDays = 7
+	}
+	s.Archive = req.Archive
+	s.Compress = req.Compress
+	s.OutputFormat = strings.ToLower(strings.TrimSpace(req.OutputFormat))
+	s.UpdatePolicy = strings.ToLower(strings.TrimSpace(req.UpdatePolicy))
+	return Validate(s)
+}
+
+// Response is a subscription along with the status of its last fetch
+type Response struct {
+	database.Subscription
+	// LastStatus is the last fetch job's status, such as "running",
+	// "success" or "error", while the job is still known
+	LastStatus string `json:"last_status,omitempty"`
+}
+
+func newResponse(s database.Subscription) Response {
+	status, _ := webhook.JobStatus(s.LastJobID)
+	return Response{Subscription: s, LastStatus: status}
+}
+
+// getSubscription loads one of the current user's subscriptions, responding
+// 404 if it doesn't exist
+func getSubscription(c *gin.Context, userID uuid.UUID) (*database.Subscription, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return nil, false
+	}
+	var s database.Subscription
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&s).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return nil, false
+	}
+	return &s, true
+}
+
+// ListHandler lists the current user's subscriptions
+func ListHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriptions not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var subs []database.Subscription
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get subscriptions"})
+		return
+	}
+	resp := make([]Response, 0, len(subs))
+	for _, s := range subs {
+		resp = append(resp, newResponse(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": resp})
+}
+
+// CreateHandler adds a subscription for the current user. It's first fetched
+// when its schedule next comes due.
+func CreateHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriptions not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name, url and cron are required"})
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&database.Subscription{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+	if count >= maxSubscriptions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many subscriptions"})
+		return
+	}
+
+	s := database.Subscription{UserID: user.ID, Enabled: true}
+	if err := req.apply(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.NextRunAt = NextRun(&s, time.Now())
+	if err := database.DB.Create(&s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	logging.Logf("[SUBSCRIPTION] User %s added subscription %q (%s)", user.Username, s.Name, s.Cron)
+	c.JSON(http.StatusCreated, newResponse(s))
+}
+
+// UpdateHandler replaces one of the current user's subscriptions and
+// reschedules it
+func UpdateHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriptions not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	s, ok := getSubscription(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name, url and cron are required"})
+		return
+	}
+	if err := req.apply(s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.NextRunAt = NextRun(s, time.Now())
+	if err := database.DB.Save(s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, newResponse(*s))
+}
+
+// DeleteHandler removes one of the current user's subscriptions. Documents
+// it already uploaded are left alone.
+func DeleteHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriptions not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	s, ok := getSubscription(c, user.ID)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subscription"})
+		return
+	}
+
+	logging.Logf("[SUBSCRIPTION] User %s removed subscription %q", user.Username, s.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RunHandler fetches one of the current user's subscriptions now, without
+// changing its schedule, and returns the job ID
+func RunHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriptions not available in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireUser(c)
+	if !ok {
+		return
+	}
+
+	s, ok := getSubscription(c, user.ID)
+	if !ok {
+		return
+	}
+
+	id, err := Run(s)
+	if errors.Is(err, ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "jobId": s.LastJobID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"jobId": id})
+}
@@ -0,0 +1,179 @@
+// Package subscription fetches URLs on a cron schedule, such as a daily
+// newspaper PDF, and uploads them through the webhook pipeline. Managed
+// subscriptions name each upload after the prefix and date and remove copies
+// older than their retention, so the folder holds only the recent issues.
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/backup"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+// ErrRunning is returned when the previous fetch of a subscription hasn't
+// finished
+var ErrRunning = errors.New("the previous fetch hasn't finished")
+
+// checkInterval is how often due subscriptions are looked for; cron
+// schedules have minute resolution
+const checkInterval = time.Minute
+
+// enqueueURL hands a subscription's request to the job pipeline. Tests
+// replace it to keep jobs from running.
+var enqueueURL = webhook.EnqueueURL
+
+// Validate checks a subscription's URL, schedule and upload options
+func Validate(s *database.Subscription) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if _, err := backup.ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	if _, err := manager.SanitizePrefix(s.Prefix); err != nil {
+		return err
+	}
+	// Cleanup removes every dated document with the prefix, so a managed
+	// subscription without one could remove unrelated documents
+	if s.Manage && s.Prefix == "" {
+		return errors.New("prefix is required for managed subscriptions")
+	}
+	if s.RetentionDays < 0 {
+		return errors.New("retention_days must not be negative")
+	}
+	if s.OutputFormat != "" && s.OutputFormat != "pdf" && s.OutputFormat != "epub" {
+		return fmt.Errorf("invalid output format %q", s.OutputFormat)
+	}
+	if !webhook.ValidUpdatePolicy(s.UpdatePolicy) {
+		return fmt.Errorf("invalid update policy %q", s.UpdatePolicy)
+	}
+	return nil
+}
+
+// NextRun returns when s next runs after t, or nil if it's disabled or its
+// schedule never matches
+func NextRun(s *database.Subscription, t time.Time) *time.Time {
+	if !s.Enabled {
+		return nil
+	}
+	c, err := backup.ParseCron(s.Cron)
+	if err != nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil
+	}
+	next := c.Next(t.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// request returns the webhook request that fetches s
+func request(s *database.Subscription) webhook.DocumentRequest {
+	req := webhook.DocumentRequest{
+		Body:         s.URL,
+		Prefix:       s.Prefix,
+		Manage:       strconv.FormatBool(s.Manage),
+		Archive:      strconv.FormatBool(s.Archive),
+		Compress:     strconv.FormatBool(s.Compress),
+		RmDir:        s.RmDir,
+		OutputFormat: s.OutputFormat,
+		UpdatePolicy: s.UpdatePolicy,
+	}
+	if s.RetentionDays > 0 {
+		req.RetentionDays = strconv.Itoa(s.RetentionDays)
+	}
+	return req
+}
+
+// Run starts a fetch of s now, records it on s and returns the job ID. It
+// returns ErrRunning if the previous fetch is still queued or running.
+func Run(s *database.Subscription) (string, error) {
+	if status, ok := webhook.JobStatus(s.LastJobID); ok {
+		switch status {
+		case "pending", "queued", "running":
+			return "", ErrRunning
+		}
+	}
+	if maintenance.Enabled() {
+		return "", errors.New("maintenance mode: not accepting new jobs")
+	}
+
+	id := enqueueURL(request(s), "subscription", s.UserID)
+	now := time.Now()
+	s.LastRunAt = &now
+	s.LastJobID = id
+	s.LastError = ""
+	if err := database.DB.Model(&database.Subscription{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+		"last_run_at": now, "last_job_id": id, "last_error": "",
+	}).Error; err != nil {
+		logging.Logf("[SUBSCRIPTION] Failed to save subscription %s: %v", s.ID, err)
+	}
+	return id, nil
+}
+
+// Start fetches each enabled subscription when its schedule comes due, until
+// ctx is cancelled. A subscription that came due while the server was down
+// is fetched once when it starts.
+func Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			runDue(time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDue fetches the subscriptions due at now and schedules their next run
+func runDue(now time.Time) {
+	var subs []database.Subscription
+	if err := database.DB.Where("enabled = ? AND next_run_at <= ?", true, now).Find(&subs).Error; err != nil {
+		logging.Logf("[SUBSCRIPTION] Failed to load subscriptions: %v", err)
+		return
+	}
+	for i := range subs {
+		s := &subs[i]
+		lastError := ""
+		if id, err := Run(s); err != nil {
+			lastError = err.Error()
+			logging.Logf("[SUBSCRIPTION] Skipped %q (%s): %v", s.Name, s.ID, err)
+		} else {
+			logging.Logf("[SUBSCRIPTION] Fetching %q (%s) as job %s", s.Name, s.ID, id)
+		}
+
+		updates := map[string]interface{}{"next_run_at": NextRun(s, now)}
+		if lastError != "" {
+			updates["last_error"] = lastError
+		}
+		if err := database.DB.Model(&database.Subscription{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+			logging.Logf("[SUBSCRIPTION] Failed to schedule subscription %s: %v", s.ID, err)
+		}
+	}
+}
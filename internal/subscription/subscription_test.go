@@ -0,0 +1,163 @@
+package subscription
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/webhook"
+)
+
+func validSubscription() database.Subscription {
+	return database.Subscription{
+		Name:     "Morning paper",
+		URL:      "https://example.com/today.pdf",
+		Cron:     "0 6 * * *",
+		Timezone: "America/New_York",
+		Enabled:  true,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*database.Subscription)
+		ok     bool
+	}{
+		{"valid", func(s *database.Subscription) {}, true},
+		{"server timezone", func(s *database.Subscription) { s.Timezone = "" }, true},
+		{"managed with prefix", func(s *database.Subscription) { s.Manage, s.Prefix = true, "Paper" }, true},
+		{"epub output", func(s *database.Subscription) { s.OutputFormat = "epub" }, true},
+		{"replace policy", func(s *database.Subscription) { s.UpdatePolicy = "replace" }, true},
+		{"blank name", func(s *database.Subscription) { s.Name = "  " }, false},
+		{"ftp url", func(s *database.Subscription) { s.URL = "ftp://example.com/a.pdf" }, false},
+		{"url without host", func(s *database.Subscription) { s.URL = "https:///a.pdf" }, false},
+		{"bad cron", func(s *database.Subscription) { s.Cron = "every morning" }, false},
+		{"bad timezone", func(s *database.Subscription) { s.Timezone = "Mars/Olympus" }, false},
+		{"managed without prefix", func(s *database.Subscription) { s.Manage = true }, false},
+		{"prefix with a slash", func(s *database.Subscription) { s.Prefix = "a/b" }, false},
+		{"negative retention", func(s *database.Subscription) { s.RetentionDays = -1 }, false},
+		{"docx output", func(s *database.Subscription) { s.OutputFormat = "docx" }, false},
+		{"unknown policy", func(s *database.Subscription) { s.UpdatePolicy = "sometimes" }, false},
+	}
+	for _, tt := range tests {
+		s := validSubscription()
+		tt.change(&s)
+		if err := Validate(&s); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	s := validSubscription()
+	next := NextRun(&s, now)
+	if want := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC); next == nil || !next.Equal(want) {
+		t.Errorf("NextRun at 08:00 New York = %v, want %v", next, want)
+	}
+
+	s.Timezone = ""
+	if next := NextRun(&s, now); next == nil || !next.Equal(time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("NextRun in UTC = %v, want 06:00 tomorrow", next)
+	}
+
+	s.Enabled = false
+	if next := NextRun(&s, now); next != nil {
+		t.Errorf("NextRun of a disabled subscription = %v, want nil", next)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	s := validSubscription()
+	s.Prefix, s.Manage, s.RetentionDays, s.RmDir, s.UpdatePolicy = "Paper", true, 3, "/News", "skip"
+	want := webhook.DocumentRequest{
+		Body:          s.URL,
+		Prefix:        "Paper",
+		Manage:        "true",
+		Archive:       "false",
+		Compress:      "false",
+		RmDir:         "/News",
+		RetentionDays: "3",
+		UpdatePolicy:  "skip",
+	}
+	if got := request(&s); !reflect.DeepEqual(got, want) {
+		t.Errorf("request = %+v, want %+v", got, want)
+	}
+
+	// Without a retention the webhook's default applies
+	s.RetentionDays = 0
+	if got := request(&s); got.RetentionDays != "" {
+		t.Errorf("request without retention = %q, want empty", got.RetentionDays)
+	}
+}
+
+func TestRunDue(t *testing.T) {
+	t.Setenv("MULTI_USER", "true")
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DATA_DIR", t.TempDir())
+	origDB := database.DB
+	if err := database.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = origDB
+	})
+	user, err := database.NewUserService(database.DB).CreateUser("reader", "reader@example.com", "correct-horse", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetched []string
+	orig := enqueueURL
+	enqueueURL = func(req webhook.DocumentRequest, source string, userID uuid.UUID) string {
+		if source != "subscription" || userID != user.ID {
+			t.Errorf("enqueued from %q for %s", source, userID)
+		}
+		fetched = append(fetched, req.Body)
+		return "job-" + uuid.NewString()
+	}
+	defer func() { enqueueURL = orig }()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	earlier, later := now.Add(-time.Hour), now.Add(time.Hour)
+	subs := map[string]*database.Subscription{}
+	for name, next := range map[string]*time.Time{"due": &earlier, "later": &later} {
+		s := validSubscription()
+		s.ID, s.UserID, s.Name, s.URL, s.NextRunAt = uuid.New(), user.ID, name, "https://example.com/"+name+".pdf", next
+		if err := database.DB.Create(&s).Error; err != nil {
+			t.Fatal(err)
+		}
+		subs[name] = &s
+	}
+
+	runDue(now)
+	if !reflect.DeepEqual(fetched, []string{"https://example.com/due.pdf"}) {
+		t.Errorf("fetched %v, want only the due subscription", fetched)
+	}
+
+	var due database.Subscription
+	if err := database.DB.First(&due, "id = ?", subs["due"].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if due.LastJobID == "" || due.LastRunAt == nil {
+		t.Errorf("due subscription not recorded as run: %+v", due)
+	}
+	if want := NextRun(&due, now); due.NextRunAt == nil || !due.NextRunAt.Equal(*want) {
+		t.Errorf("next run = %v, want %v", due.NextRunAt, want)
+	}
+
+	// Once rescheduled it isn't due again
+	fetched = nil
+	runDue(now)
+	if len(fetched) != 0 {
+		t.Errorf("fetched %v again", fetched)
+	}
+}
@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// PreviewHandler shows whether telemetry is on, where it goes, and exactly
+// what the next report would contain
+func PreviewHandler(c *gin.Context) {
+	sendMu.Lock()
+	sent, sendErr := lastSent, lastError
+	sendMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":      Enabled(),
+		"url":          config.Get("TELEMETRY_URL", ""),
+		"interval":     config.GetDuration("TELEMETRY_INTERVAL", defaultInterval).String(),
+		"last_sent_at": sent,
+		"last_error":   sendErr,
+		"report":       Collect(),
+	})
+}
+
+// UpdateHandler turns telemetry on or off (multi-user mode; single-user
+// installs use TELEMETRY)
+func UpdateHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Telemetry is set with TELEMETRY in single-user mode"})
+		return
+	}
+
+	user, ok := auth.RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_type": "invalid_request"})
+		return
+	}
+
+	if err := database.SetSystemSetting(SettingKey, strconv.FormatBool(*req.Enabled), &user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
+		return
+	}
+	logging.LogfWithUser(user.Username, "[TELEMETRY] Telemetry set to %t", *req.Enabled)
+
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
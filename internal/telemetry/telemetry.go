@@ -0,0 +1,235 @@
+// Package telemetry sends an anonymous usage report (version, database and
+// storage type, which features are on, and aggregate job counts) so
+// development can focus on what installs actually use. It is strictly opt-in:
+// nothing is sent unless TELEMETRY is true or an admin turns it on, and admins
+// can preview the exact report before it goes anywhere. No usernames, file
+// names, URLs or addresses are ever included.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/smtp"
+	"github.com/rmitchellscott/aviary/internal/version"
+)
+
+const (
+	// SettingKey is the system setting admins toggle telemetry with
+	SettingKey = "telemetry_enabled"
+	// instanceSettingKey holds the random instance ID in multi-user mode
+	instanceSettingKey = "telemetry_instance_id"
+
+	defaultInterval = 24 * time.Hour
+	sendTimeout     = 30 * time.Second
+)
+
+// Jobs counts finished jobs since the last report
+type Jobs struct {
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+// Report is everything a telemetry report contains
+type Report struct {
+	// InstanceID is random and only tells reports from the same install apart
+	InstanceID string          `json:"instance_id"`
+	Version    string          `json:"version"`
+	OS         string          `json:"os"`
+	Arch       string          `json:"arch"`
+	Mode       string          `json:"mode"`
+	Database   string          `json:"database,omitempty"`
+	Storage    string          `json:"storage"`
+	Features   map[string]bool `json:"features"`
+	Users      int64           `json:"users,omitempty"`
+	Jobs       Jobs            `json:"jobs"`
+}
+
+var (
+	jobsSucceeded atomic.Int64
+	jobsFailed    atomic.Int64
+
+	instanceOnce sync.Once
+	instanceID   string
+
+	sendMu    sync.Mutex
+	lastSent  *time.Time
+	lastError string
+)
+
+// RecordJob counts a finished job for the next report
+func RecordJob(err error) {
+	if err != nil {
+		jobsFailed.Add(1)
+	} else {
+		jobsSucceeded.Add(1)
+	}
+}
+
+// Enabled reports whether reports are sent. In multi-user mode the
+// telemetry_enabled setting wins once an admin has set it; otherwise
+// TELEMETRY decides, and it defaults to false.
+func Enabled() bool {
+	if database.IsMultiUserMode() && database.DB != nil {
+		if value, err := database.GetSystemSetting(SettingKey); err == nil && value != "" {
+			return value == "true"
+		}
+	}
+	return config.GetBool("TELEMETRY", false)
+}
+
+// Collect builds the report that would be sent now
+func Collect() Report {
+	r := Report{
+		InstanceID: instance(),
+		Version:    version.Version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Mode:       "single_user",
+		Storage:    config.Get("STORAGE_BACKEND", "filesystem"),
+		Features:   features(),
+		Jobs: Jobs{
+			Succeeded: jobsSucceeded.Load(),
+			Failed:    jobsFailed.Load(),
+		},
+	}
+	if database.IsMultiUserMode() && database.DB != nil {
+		r.Mode = "multi_user"
+		r.Database = config.Get("DB_TYPE", "sqlite")
+		database.DB.Model(&database.User{}).Count(&r.Users)
+	}
+	return r
+}
+
+// features reports which optional features are turned on
+func features() map[string]bool {
+	return map[string]bool{
+		"oidc":           auth.IsOIDCEnabled(),
+		"proxy_auth":     auth.IsProxyAuthEnabled(),
+		"smtp":           smtp.IsSMTPConfigured(),
+		"self_hosted":    config.Get("RMAPI_HOST", "") != "",
+		"queue_ingest":   config.Get("NATS_URL", "") != "",
+		"degraded_mode":  config.GetBool("DEGRADED_MODE", true),
+		"sync_verify":    config.GetBool("SYNC_VERIFY", false),
+		"receipts":       config.GetBool("RECEIPTS", false),
+		"archive_pdfa":   config.GetBool("ARCHIVE_PDFA", false),
+		"compress_skip":  config.GetBool("COMPRESS_SKIP", true),
+		"update_check":   config.GetBool("UPDATE_CHECK", false),
+		"dry_run":        config.Get("DRY_RUN", "") != "",
+		"ui_disabled":    config.Get("DISABLE_UI", "") != "",
+		"upload_hooks":   config.Get("HOOK_PRE_UPLOAD", "") != "" || config.Get("HOOK_POST_UPLOAD", "") != "",
+		"routing_script": config.Get("ROUTING_SCRIPT", "") != "",
+	}
+}
+
+// instance returns this install's random ID, creating it on first use. It is
+// kept as a system setting in multi-user mode and in DATA_DIR otherwise.
+func instance() string {
+	instanceOnce.Do(func() {
+		if database.IsMultiUserMode() && database.DB != nil {
+			if id, err := database.GetSystemSetting(instanceSettingKey); err == nil && id != "" {
+				instanceID = id
+				return
+			}
+			instanceID = uuid.NewString()
+			if err := database.SetSystemSetting(instanceSettingKey, instanceID, nil); err != nil {
+				logging.Logf("[TELEMETRY] Failed to save instance ID: %v", err)
+			}
+			return
+		}
+
+		path := filepath.Join(config.Get("DATA_DIR", "/data"), "telemetry_id")
+		if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) != "" {
+			instanceID = strings.TrimSpace(string(data))
+			return
+		}
+		instanceID = uuid.NewString()
+		if err := os.WriteFile(path, []byte(instanceID+"\n"), 0644); err != nil {
+			logging.Logf("[TELEMETRY] Failed to save instance ID: %v", err)
+		}
+	})
+	return instanceID
+}
+
+// Start sends a report every TELEMETRY_INTERVAL while telemetry is enabled,
+// until ctx is cancelled. Whether it's enabled is checked before every send,
+// so an admin toggling it takes effect without a restart.
+func Start(ctx context.Context) {
+	url := config.Get("TELEMETRY_URL", "")
+	if url == "" {
+		if Enabled() {
+			logging.Logf("[TELEMETRY] Telemetry is enabled but TELEMETRY_URL is not set; nothing will be sent")
+		}
+		return
+	}
+	interval := config.GetDuration("TELEMETRY_INTERVAL", defaultInterval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !Enabled() {
+				continue
+			}
+			if err := send(ctx, url, Collect()); err != nil {
+				logging.Logf("[TELEMETRY] Failed to send report: %v", err)
+			}
+		}
+	}()
+}
+
+// send posts r to url and, once it's accepted, starts the job counts over
+func send(ctx context.Context, url string, r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "aviary/"+version.Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+	}
+
+	now := time.Now()
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	if err != nil {
+		lastError = err.Error()
+		return err
+	}
+	lastSent = &now
+	lastError = ""
+	jobsSucceeded.Add(-r.Jobs.Succeeded)
+	jobsFailed.Add(-r.Jobs.Failed)
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package tracing sends OpenTelemetry traces of HTTP requests and the jobs
+// they start to an OTLP collector such as Tempo or Jaeger, so a slow upload
+// can be followed from the request through download, conversion,
+// compression and rmapi put. It is off unless OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set; the exporter reads the other
+// standard OTEL_* variables itself.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/version"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "aviary"
+	tracerName  = "github.com/rmitchellscott/aviary"
+)
+
+// Enabled reports whether an OTLP endpoint is configured
+func Enabled() bool {
+	if strings.EqualFold(config.Get("OTEL_SDK_DISABLED", ""), "true") {
+		return false
+	}
+	return config.Get("OTEL_EXPORTER_OTLP_ENDPOINT", "") != "" ||
+		config.Get("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "") != ""
+}
+
+// Init starts exporting traces when Enabled and returns a function that
+// flushes and stops the exporter. Trace context is taken from and passed on
+// in W3C traceparent headers either way.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName), semconv.ServiceVersion(version.Version)),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a span for each API request, continuing the caller's
+// trace when it sends a traceparent header. Probes and the UI's static files
+// aren't traced.
+func Middleware() gin.HandlerFunc {
+	if !Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/api/status/public"
+	}))
+}
+
+// Start starts a span named name as a child of the one in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed when err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceParent returns the W3C traceparent of the span in ctx, so work done
+// later, such as a queued job, can join the request's trace. It's "" when
+// ctx has no span.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceParent returns ctx carrying the remote span in traceparent, as
+// returned by TraceParent, for new spans to be children of
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
@@ -0,0 +1,56 @@
+package version
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// toolVersionPattern picks a version number out of a tool's version output
+var toolVersionPattern = regexp.MustCompile(`v?[0-9]+(?:\.[0-9]+)+[0-9A-Za-z.\-]*`)
+
+// toolVersionArgs are the external tools documents pass through and how to
+// ask each for its version
+var toolVersionArgs = map[string][]string{
+	"gs":     {"gs", "--version"},
+	"mutool": {"mutool", "-v"},
+	"rmapi":  {"rmapi", "-version"},
+}
+
+var (
+	toolsOnce sync.Once
+	tools     map[string]string
+)
+
+// Tools returns the versions of the external tools documents are processed
+// with, keyed by name. Tools that are missing or don't report a version are
+// "unknown". The versions are looked up once and cached, since the tools
+// can't change without a restart.
+func Tools() map[string]string {
+	toolsOnce.Do(func() {
+		tools = make(map[string]string, len(toolVersionArgs))
+		for name, args := range toolVersionArgs {
+			tools[name] = toolVersion(args)
+		}
+	})
+	out := make(map[string]string, len(tools))
+	for name, v := range tools {
+		out[name] = v
+	}
+	return out
+}
+
+func toolVersion(args []string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// mutool prints its version to stderr and exits non-zero, so the exit
+	// status is ignored as long as something was printed
+	out, _ := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if v := toolVersionPattern.FindString(string(out)); v != "" {
+		return strings.TrimPrefix(v, "v")
+	}
+	return "unknown"
+}
@@ -0,0 +1,168 @@
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+const (
+	defaultUpdateCheckURL      = "https://api.github.com/repos/rmitchellscott/aviary/releases/latest"
+	defaultUpdateCheckInterval = 24 * time.Hour
+	updateCheckTimeout         = 30 * time.Second
+)
+
+// UpdateStatus is the result of the latest release check
+type UpdateStatus struct {
+	Enabled         bool       `json:"enabled"`
+	Current         string     `json:"current"`
+	Latest          string     `json:"latest,omitempty"`
+	UpdateAvailable bool       `json:"update_available"`
+	ReleaseURL      string     `json:"release_url,omitempty"`
+	ChangelogURL    string     `json:"changelog_url,omitempty"`
+	CheckedAt       *time.Time `json:"checked_at,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+var (
+	updateMu     sync.RWMutex
+	updateStatus = UpdateStatus{Current: Version}
+)
+
+// UpdateCheck returns the result of the latest release check
+func UpdateCheck() UpdateStatus {
+	updateMu.RLock()
+	defer updateMu.RUnlock()
+	return updateStatus
+}
+
+// StartUpdateCheck looks for a newer release every UPDATE_CHECK_INTERVAL until
+// ctx is cancelled. It does nothing unless UPDATE_CHECK is true, so air-gapped
+// installs never reach out to GitHub.
+func StartUpdateCheck(ctx context.Context) {
+	if !config.GetBool("UPDATE_CHECK", false) {
+		return
+	}
+	updateMu.Lock()
+	updateStatus.Enabled = true
+	updateMu.Unlock()
+
+	url := config.Get("UPDATE_CHECK_URL", defaultUpdateCheckURL)
+	interval := config.GetDuration("UPDATE_CHECK_INTERVAL", defaultUpdateCheckInterval)
+	logging.Logf("[UPDATE] Checking %s for new releases every %s", url, interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			checkForUpdate(ctx, url)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// release is the part of a GitHub release the check needs
+type release struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+func checkForUpdate(ctx context.Context, url string) {
+	rel, err := fetchLatestRelease(ctx, url)
+	now := time.Now()
+
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	updateStatus.CheckedAt = &now
+	if err != nil {
+		updateStatus.Error = err.Error()
+		logging.Logf("[UPDATE] Release check failed: %v", err)
+		return
+	}
+	updateStatus.Error = ""
+	updateStatus.Latest = strings.TrimPrefix(rel.TagName, "v")
+	updateStatus.ReleaseURL = rel.HTMLURL
+	updateStatus.ChangelogURL = rel.HTMLURL
+	available := newerVersion(updateStatus.Latest, Version)
+	if available && !updateStatus.UpdateAvailable {
+		logging.Logf("[UPDATE] Aviary %s is available (running %s): %s", updateStatus.Latest, Version, rel.HTMLURL)
+	}
+	updateStatus.UpdateAvailable = available
+}
+
+func fetchLatestRelease(ctx context.Context, url string) (*release, error) {
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "aviary/"+Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	var rel release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+	if rel.TagName == "" {
+		return nil, fmt.Errorf("release has no tag")
+	}
+	return &rel, nil
+}
+
+// newerVersion reports whether latest is a newer release than current. Dev
+// builds and anything that isn't a semantic version are never flagged.
+func newerVersion(latest, current string) bool {
+	latest = strings.TrimPrefix(latest, "v")
+	current = strings.TrimPrefix(current, "v")
+	if !semverRegex.MatchString(latest) || !semverRegex.MatchString(current) {
+		return false
+	}
+	l, lpre := splitSemver(latest)
+	c, cpre := splitSemver(current)
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	// Same release: the final one is newer than a prerelease of it
+	return !lpre && cpre
+}
+
+// splitSemver returns the major, minor and patch numbers of v and whether it
+// is a prerelease
+func splitSemver(v string) ([3]int, bool) {
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+	pre := false
+	if i := strings.Index(v, "-"); i >= 0 {
+		v = v[:i]
+		pre = true
+	}
+	var nums [3]int
+	for i, part := range strings.SplitN(v, ".", 3) {
+		nums[i], _ = strconv.Atoi(part)
+	}
+	return nums, pre
+}
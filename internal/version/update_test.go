@@ -0,0 +1,26 @@
+package version
+
+import "testing"
+
+func TestNewerVersion(t *testing.T) {
+	cases := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"1.7.0", "1.6.2", true},
+		{"v1.10.0", "1.9.9", true},
+		{"2.0.0", "1.99.0", true},
+		{"1.6.2", "1.6.2", false},
+		{"1.6.1", "1.6.2", false},
+		{"1.6.2", "1.6.2-rc1", true},
+		{"1.6.2-rc1", "1.6.2", false},
+		{"1.7.0", "dev", false},
+		{"1.7.0", "main", false},
+		{"nightly", "1.6.2", false},
+	}
+	for _, tc := range cases {
+		if got := newerVersion(tc.latest, tc.current); got != tc.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tc.latest, tc.current, got, tc.want)
+		}
+	}
+}
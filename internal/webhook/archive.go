@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/compressor"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/security"
+	"github.com/rmitchellscott/aviary/internal/storage"
+)
+
+// archiveSource returns the file to keep in the archive for the uploaded
+// file at path. With PDF/A archiving on for the job, PDFs are archived as a
+// PDF/A copy while the tablet keeps the optimized original. The returned
+// func removes any copy made; if conversion fails the original is archived.
+func archiveSource(jobID, path string, form map[string]string) (string, func()) {
+	noop := func() {}
+	if !config.BoolOption(form["archive_pdfa"], "ARCHIVE_PDFA", false) || !strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return path, noop
+	}
+
+	jobStore.UpdateWithOperation(jobID, "Running", "backend.status.converting_pdfa", nil, "processing")
+	pdfaPath, err := compressor.ConvertToPDFA(path, jobUsage(jobID))
+	if err != nil {
+		manager.Logf("archival warning: keeping the original, PDF/A conversion failed: %v", err)
+		return path, noop
+	}
+	return pdfaPath, func() {
+		if securePath, err := security.NewSecurePathFromExisting(pdfaPath); err == nil {
+			security.SafeRemove(securePath)
+		}
+	}
+}
+
+// archiveFile copies the file at path into the user's archive as filename and
+// returns its storage key and SHA-256. Managed files are stored under their
+// dated name and then copied to a name with the year added, which becomes the
+// key; if only that second copy fails, the dated copy is kept. The stored
+// copy is read back and removed if it doesn't match the file. Nothing is
+// stored once the local storage limit is reached.
+func archiveFile(ctx context.Context, userID uuid.UUID, path, filename, prefix string, manage bool) (string, string, error) {
+	sp, err := security.NewSecurePathFromExisting(path)
+	if err != nil {
+		return "", "", err
+	}
+	sum, err := fileSHA256(sp)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	if err := storage.CheckSpace(ctx, info.Size()); err != nil {
+		return "", "", err
+	}
+
+	multiUserMode := database.IsMultiUserMode()
+	var key string
+	if !manage {
+		key = storage.GenerateUserDocumentKey(userID, "", filename, multiUserMode)
+		if err := storage.CopyFileToStorage(ctx, path, key); err != nil {
+			return "", "", err
+		}
+	} else {
+		noYearKey := storage.GenerateUserDocumentKey(userID, prefix, filename, multiUserMode)
+		if err := storage.CopyFileToStorage(ctx, path, noYearKey); err != nil {
+			return "", "", err
+		}
+		if key, err = manager.AppendYearStorage(ctx, noYearKey, userID); err != nil {
+			manager.Logf("archival warning: failed to create year copy: %v", err)
+			key = noYearKey
+		}
+	}
+
+	if err := storage.VerifyObject(ctx, key, sum); err != nil {
+		if errors.Is(err, storage.ErrChecksumMismatch) {
+			storage.GetStorageBackend().Delete(ctx, key)
+		}
+		return "", "", err
+	}
+	storage.AddUsage(info.Size())
+	return key, sum, nil
+}
@@ -0,0 +1,336 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"gorm.io/gorm"
+)
+
+// archiveRetry is a document whose copy to the storage backend failed. The
+// file is kept in DATA_DIR/archive-retry until the copy succeeds, it has
+// failed ARCHIVE_RETRY_ATTEMPTS times, or the document is deleted.
+type archiveRetry struct {
+	DocumentID uuid.UUID `json:"document_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	File       string    `json:"file"`
+	Filename   string    `json:"filename"`
+	Prefix     string    `json:"prefix,omitempty"`
+	Manage     bool      `json:"manage"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+var archiveRetryMu sync.Mutex
+
+// archiveRetryDir returns the directory failed archive copies are kept in
+func archiveRetryDir() string {
+	return filepath.Join(config.Get("DATA_DIR", "/data"), "archive-retry")
+}
+
+// archiveRetryAttempts is how many automatic retries a failed archive copy
+// gets. Retries from the admin endpoint aren't limited.
+func archiveRetryAttempts() int {
+	return config.GetInt("ARCHIVE_RETRY_ATTEMPTS", 5)
+}
+
+// stageArchiveRetry keeps a copy of the file whose archive copy failed for
+// documentID so it can be retried
+func stageArchiveRetry(documentID, userID uuid.UUID, path, filename, prefix string, manage bool) {
+	archiveRetryMu.Lock()
+	defer archiveRetryMu.Unlock()
+
+	id := documentID.String()
+	dir := filepath.Join(archiveRetryDir(), id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logging.Logf("[ARCHIVE] Failed to keep file of document %s: %v", id, err)
+		return
+	}
+	file := filepath.Join(dir, filepath.Base(path))
+	if err := copyFile(path, file); err != nil {
+		logging.Logf("[ARCHIVE] Failed to keep file of document %s: %v", id, err)
+		os.RemoveAll(dir)
+		return
+	}
+	r := archiveRetry{
+		DocumentID: documentID,
+		UserID:     userID,
+		File:       file,
+		Filename:   filename,
+		Prefix:     prefix,
+		Manage:     manage,
+		FailedAt:   time.Now(),
+	}
+	if err := writeArchiveRetry(r); err != nil {
+		logging.Logf("[ARCHIVE] Failed to save archive retry for document %s: %v", id, err)
+		os.RemoveAll(dir)
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func writeArchiveRetry(r archiveRetry) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(archiveRetryDir(), r.DocumentID.String()+".json")
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func loadArchiveRetry(id string) (*archiveRetry, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(archiveRetryDir(), id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var r archiveRetry
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func removeArchiveRetry(id string) {
+	os.Remove(filepath.Join(archiveRetryDir(), id+".json"))
+	os.RemoveAll(filepath.Join(archiveRetryDir(), id))
+}
+
+// listArchiveRetries returns every staged archive retry
+func listArchiveRetries() []archiveRetry {
+	entries, err := os.ReadDir(archiveRetryDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Logf("[ARCHIVE] Failed to list failed archive copies: %v", err)
+		}
+		return nil
+	}
+	var retries []archiveRetry
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if r, err := loadArchiveRetry(strings.TrimSuffix(entry.Name(), ".json")); err == nil {
+			retries = append(retries, *r)
+		}
+	}
+	return retries
+}
+
+// retryArchive copies the kept file of a document to the storage backend
+// again and records the outcome on the document. The kept file is removed
+// once the copy succeeds or the document no longer exists.
+func retryArchive(ctx context.Context, r archiveRetry) error {
+	id := r.DocumentID.String()
+	var doc database.Document
+	if err := database.DB.Select("id").First(&doc, "id = ?", r.DocumentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			removeArchiveRetry(id)
+			return errors.New("document no longer exists")
+		}
+		return err
+	}
+
+	key, sum, err := archiveFile(ctx, r.UserID, r.File, r.Filename, r.Prefix, r.Manage)
+	if err != nil {
+		r.Attempts++
+		r.Error = err.Error()
+		if werr := writeArchiveRetry(r); werr != nil {
+			logging.Logf("[ARCHIVE] Failed to save archive retry for document %s: %v", id, werr)
+		}
+		database.DB.Model(&database.Document{}).Where("id = ?", r.DocumentID).Update("archive_error", truncate(err.Error(), 1000))
+		return err
+	}
+
+	if err := database.DB.Model(&database.Document{}).Where("id = ?", r.DocumentID).Updates(map[string]interface{}{
+		"archive_key":         key,
+		"archive_hash":        sum,
+		"archive_verified_at": time.Now(),
+		"archive_status":      database.ArchiveStatusArchived,
+		"archive_error":       "",
+	}).Error; err != nil {
+		return err
+	}
+	removeArchiveRetry(id)
+	logging.Logf("[ARCHIVE] Archived document %s after %d failed attempt(s)", id, r.Attempts+1)
+	return nil
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// RetryFailedArchives retries every failed archive copy that hasn't used up
+// its ARCHIVE_RETRY_ATTEMPTS and returns how many succeeded
+func RetryFailedArchives(ctx context.Context) int {
+	archiveRetryMu.Lock()
+	defer archiveRetryMu.Unlock()
+
+	archived := 0
+	for _, r := range listArchiveRetries() {
+		if r.Attempts >= archiveRetryAttempts() {
+			continue
+		}
+		if err := retryArchive(ctx, r); err == nil {
+			archived++
+		}
+	}
+	return archived
+}
+
+// StartArchiveRetry retries failed archive copies every
+// ARCHIVE_RETRY_INTERVAL until ctx is done. A zero interval turns automatic
+// retries off.
+func StartArchiveRetry(ctx context.Context) {
+	interval := config.GetDuration("ARCHIVE_RETRY_INTERVAL", time.Hour)
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if n := RetryFailedArchives(ctx); n > 0 {
+				logging.Logf("[ARCHIVE] Archived %d document(s) on retry", n)
+			}
+		}
+	}()
+}
+
+// ArchiveFailuresHandler lists documents whose archive copy failed and is
+// waiting to be retried (admin only)
+func ArchiveFailuresHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive retries not available in single-user mode"})
+		return
+	}
+
+	if _, ok := auth.RequireAdmin(c); !ok {
+		return
+	}
+
+	archiveRetryMu.Lock()
+	retries := listArchiveRetries()
+	archiveRetryMu.Unlock()
+
+	type failure struct {
+		DocumentID uuid.UUID `json:"document_id"`
+		UserID     uuid.UUID `json:"user_id"`
+		Filename   string    `json:"filename"`
+		Attempts   int       `json:"attempts"`
+		Error      string    `json:"error"`
+		FailedAt   time.Time `json:"failed_at"`
+	}
+	failures := make([]failure, 0, len(retries))
+	for _, r := range retries {
+		failures = append(failures, failure{r.DocumentID, r.UserID, r.Filename, r.Attempts, r.Error, r.FailedAt})
+	}
+	c.JSON(http.StatusOK, gin.H{"failures": failures, "max_attempts": archiveRetryAttempts()})
+}
+
+// RetryArchivesRequest selects which failed archive copies to retry; all of
+// them when empty
+type RetryArchivesRequest struct {
+	DocumentIDs []string `json:"document_ids"`
+}
+
+// RetryArchivesHandler retries failed archive copies now, regardless of how
+// many attempts they've had, and reports the result for each (admin only)
+func RetryArchivesHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive retries not available in single-user mode"})
+		return
+	}
+
+	if _, ok := auth.RequireAdmin(c); !ok {
+		return
+	}
+
+	var req RetryArchivesRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+			return
+		}
+	}
+
+	archiveRetryMu.Lock()
+	defer archiveRetryMu.Unlock()
+
+	var retries []archiveRetry
+	if len(req.DocumentIDs) == 0 {
+		retries = listArchiveRetries()
+	} else {
+		for _, id := range req.DocumentIDs {
+			r, err := loadArchiveRetry(id)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No failed archive copy for document " + id})
+				return
+			}
+			retries = append(retries, *r)
+		}
+	}
+
+	type result struct {
+		DocumentID uuid.UUID `json:"document_id"`
+		Archived   bool      `json:"archived"`
+		Error      string    `json:"error,omitempty"`
+	}
+	results := make([]result, 0, len(retries))
+	archived := 0
+	for _, r := range retries {
+		res := result{DocumentID: r.DocumentID, Archived: true}
+		if err := retryArchive(c.Request.Context(), r); err != nil {
+			res.Archived, res.Error = false, err.Error()
+		} else {
+			archived++
+		}
+		results = append(results, res)
+	}
+	c.JSON(http.StatusOK, gin.H{"archived": archived, "results": results})
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+)
+
+// overload describes why a new job would be turned away
+type overload struct {
+	Status     int
+	ErrorType  string
+	Message    string
+	RetryAfter time.Duration
+}
+
+// loadAverage returns the 1-minute load average per CPU, or 0 where
+// /proc/loadavg isn't available
+func loadAverage() float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return load / float64(runtime.NumCPU())
+}
+
+// checkBackpressure returns the reason to turn a new job for userID away, or
+// nil to accept it. A user over their own job limit gets 429; a server over
+// its job or load limit gets BACKPRESSURE_STATUS (503 by default).
+func checkBackpressure(userID uuid.UUID) *overload {
+	retryAfter := config.GetDuration("BACKPRESSURE_RETRY_AFTER", 30*time.Second)
+
+	if limit := config.GetInt("BACKPRESSURE_MAX_USER_JOBS", 0); limit > 0 && maintenance.ActiveUserJobs(userID) >= limit {
+		return &overload{
+			Status:     http.StatusTooManyRequests,
+			ErrorType:  "too_many_jobs",
+			Message:    "Too many jobs are already running for this user",
+			RetryAfter: retryAfter,
+		}
+	}
+
+	status := http.StatusServiceUnavailable
+	if config.GetInt("BACKPRESSURE_STATUS", http.StatusServiceUnavailable) == http.StatusTooManyRequests {
+		status = http.StatusTooManyRequests
+	}
+	busy := &overload{
+		Status:     status,
+		ErrorType:  "server_busy",
+		Message:    "Aviary is busy and not accepting new jobs right now",
+		RetryAfter: retryAfter,
+	}
+
+	if limit := config.GetInt("BACKPRESSURE_MAX_JOBS", 0); limit > 0 && maintenance.ActiveJobs() >= int64(limit) {
+		return busy
+	}
+	if maxLoad := configFloat("BACKPRESSURE_MAX_LOAD"); maxLoad > 0 {
+		if load := loadAverage(); load >= maxLoad {
+			logging.Logf("[BACKPRESSURE] Rejecting job: load %.2f per CPU is over %.2f", load, maxLoad)
+			return busy
+		}
+	}
+	return nil
+}
+
+func configFloat(key string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(config.Get(key, "")), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// retryAfterSeconds formats d for the Retry-After header
+func retryAfterSeconds(d time.Duration) string {
+	secs := int(d.Round(time.Second) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.Itoa(secs)
+}
+
+// rejectUnderLoad responds with 429 or 503 and a Retry-After header, and
+// returns true, when a new job for userID would overload the server
+func rejectUnderLoad(c *gin.Context, userID uuid.UUID) bool {
+	o := checkBackpressure(userID)
+	if o == nil {
+		return false
+	}
+	c.Header("Retry-After", retryAfterSeconds(o.RetryAfter))
+	apierror.Respond(c, o.Status, o.ErrorType, o.Message)
+	return true
+}
@@ -0,0 +1,234 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/manager"
+)
+
+// batchResult is the outcome of one URL of a batch
+type batchResult struct {
+	URL     string `json:"url"`
+	Status  string `json:"status"` // "success" or "error"
+	Message string `json:"message"`
+	Path    string `json:"path,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// batchURLs returns the URLs of a Body holding several, either as a JSON
+// array or one per line, and nil for any other Body. Text that merely
+// mentions several URLs isn't a batch; its first URL is used as before.
+func batchURLs(body string) []string {
+	body = strings.TrimSpace(body)
+	var candidates []string
+	if strings.HasPrefix(body, "[") {
+		if err := json.Unmarshal([]byte(body), &candidates); err != nil {
+			return nil
+		}
+	} else {
+		candidates = strings.Split(body, "\n")
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range candidates {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if !isURL(u) || strings.ContainsAny(u, " \t") {
+			return nil
+		}
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) < 2 {
+		return nil
+	}
+	return urls
+}
+
+// maxURLListSize is the largest .txt or .csv upload read as a list of URLs
+const maxURLListSize = 4 << 20
+
+// urlListFile returns the URLs in an uploaded .txt or .csv file listing
+// them, such as a reading list exported from another service, and nil for
+// any other file. Every line of a text file must be a URL, apart from blank
+// lines and # comments. In a CSV file they're taken from the column headed
+// "url", or else from the first column of each row holding one.
+func urlListFile(path string) []string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".txt" && ext != ".csv" {
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > maxURLListSize {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	var candidates []string
+	if ext == ".csv" {
+		candidates = csvURLs(data)
+	} else {
+		candidates = textURLs(data)
+	}
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range candidates {
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func textURLs(data []byte) []string {
+	var urls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isURL(line) || strings.ContainsAny(line, " \t") {
+			return nil
+		}
+		urls = append(urls, line)
+	}
+	return urls
+}
+
+func csvURLs(data []byte) []string {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil
+	}
+
+	column := -1
+	for i, field := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(field), "url") {
+			column = i
+			records = records[1:]
+			break
+		}
+	}
+	var urls []string
+	for _, record := range records {
+		for i, field := range record {
+			field = strings.TrimSpace(field)
+			if column >= 0 && i != column {
+				continue
+			}
+			if isURL(field) && !strings.ContainsAny(field, " \t") {
+				urls = append(urls, field)
+				break
+			}
+		}
+	}
+	return urls
+}
+
+// processURLBatchForUser runs the pipeline for each URL of a batch in turn,
+// reporting each one's progress on the batch job, and combines the results.
+// The batch fails if any URL did, with every URL's outcome in its data.
+func processURLBatchForUser(jobID string, form map[string]string, userID uuid.UUID, urls []string) (string, map[string]string, error) {
+	if max := config.GetInt("MAX_BATCH_URLS", 20); max > 0 && len(urls) > max {
+		return "backend.status.too_many_urls", map[string]string{"max": strconv.Itoa(max)},
+			fmt.Errorf("%d URLs in one request, at most %d allowed", len(urls), max)
+	}
+
+	results := make([]batchResult, 0, len(urls))
+	paths := make([]string, 0, len(urls))
+	failed := 0
+	for i, u := range urls {
+		if err := jobContext(jobID).Err(); err != nil {
+			return "backend.status.cancelled", nil, err
+		}
+		itemForm := make(map[string]string, len(form))
+		for k, v := range form {
+			itemForm[k] = v
+		}
+		itemForm["Body"] = u
+
+		msgKey, data, err := runBatchItem(jobID, i, len(urls), itemForm, userID)
+		result := batchResult{URL: u, Status: "success", Message: msgKey}
+		if err != nil {
+			manager.Logf("batch item %d/%d (%s) failed: %v", i+1, len(urls), u, err)
+			result.Status = "error"
+			result.Error = err.Error()
+			failed++
+		} else if data["path"] != "" {
+			result.Path = data["path"]
+			paths = append(paths, data["path"])
+		}
+		results = append(results, result)
+	}
+
+	data := map[string]string{}
+	if resultsJSON, err := json.Marshal(results); err == nil {
+		data["results"] = string(resultsJSON)
+	}
+	if pathsJSON, err := json.Marshal(paths); err == nil {
+		data["paths"] = string(pathsJSON)
+	}
+	jobStore.UpdateProgress(jobID, 100)
+	if failed > 0 {
+		data["failed"] = strconv.Itoa(failed)
+		data["total"] = strconv.Itoa(len(urls))
+		return "backend.status.batch_failed", data, fmt.Errorf("%d of %d URLs failed", failed, len(urls))
+	}
+	return "backend.status.upload_success_multiple", data, nil
+}
+
+// runBatchItem processes one URL of a batch as its own job, forwarding its
+// status to the batch job with the URL's position and its share of the
+// progress
+func runBatchItem(jobID string, index, count int, form map[string]string, userID uuid.UUID) (string, map[string]string, error) {
+	itemID := jobID + "-" + strconv.Itoa(index+1)
+	jobStore.Create(itemID)
+	childJobContext(jobID, itemID)
+	defer endJobContext(itemID)
+	updates, unsubscribe := jobStore.Subscribe(itemID)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for job := range updates {
+			data := map[string]string{
+				"url":       form["Body"],
+				"url_index": strconv.Itoa(index + 1),
+				"url_count": strconv.Itoa(count),
+			}
+			for k, v := range job.Data {
+				if _, ok := data[k]; !ok {
+					data[k] = v
+				}
+			}
+			jobStore.UpdateWithOperation(jobID, "Running", job.Message, data, job.Operation)
+			jobStore.UpdateProgress(jobID, (index*100+job.Progress)/count)
+		}
+	}()
+
+	msgKey, data, err := processPDFForUser(itemID, form, userID)
+	unsubscribe()
+	<-done
+	jobStore.Delete(itemID)
+	return msgKey, data, err
+}
@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+)
+
+// broadcastTTL is how long a broadcast's progress can be looked up
+const broadcastTTL = 24 * time.Hour
+
+// broadcast is one document sent to several users as individual jobs
+type broadcast struct {
+	ID        string
+	CreatedAt time.Time
+	CreatedBy string
+	Document  string
+	Jobs      []broadcastJob
+}
+
+type broadcastJob struct {
+	UserID   uuid.UUID
+	Username string
+	JobID    string
+}
+
+var (
+	broadcastsMu sync.Mutex
+	broadcasts   = make(map[string]*broadcast)
+)
+
+// broadcastFormFields are the upload options passed on to every job
+var broadcastFormFields = []string{
+	"prefix", "compress", "compress_preset", "manage", "archive", "archive_pdfa",
+	"rm_dir", "retention_days", "conflict_resolution", "coverpage", "contrast",
+	"currentpage", "remove_background", "outputFormat", "extract_content", "upload_timeout",
+	"job_timeout", "verify_sync", "skip_duplicates", "receipt", "labels",
+}
+
+// broadcastRecipients returns the users named in userIDs, or every active user
+// whose tablet can receive uploads when none are named. Named users that can't
+// receive the document are returned in skipped with the reason.
+func broadcastRecipients(userIDs []string) ([]database.User, map[string]string, error) {
+	skipped := make(map[string]string)
+	var users []database.User
+
+	if len(userIDs) == 0 {
+		if err := database.DB.Where("is_active = ?", true).Find(&users).Error; err != nil {
+			return nil, nil, err
+		}
+		reachable := users[:0]
+		for _, u := range users {
+			if rmapi.IsUserPaired(u.ID) || delivery.ForUser(&u).Offline() {
+				reachable = append(reachable, u)
+			}
+		}
+		return reachable, skipped, nil
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, idStr := range userIDs {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			skipped[idStr] = "Invalid user ID"
+			continue
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var u database.User
+		if err := database.DB.Where("id = ? AND is_active = ?", id, true).First(&u).Error; err != nil {
+			skipped[idStr] = "User not found"
+			continue
+		}
+		if !rmapi.IsUserPaired(u.ID) && !delivery.ForUser(&u).Offline() {
+			skipped[idStr] = "User is not paired"
+			continue
+		}
+		users = append(users, u)
+	}
+	return users, skipped, nil
+}
+
+// splitUserIDs accepts user IDs as repeated fields or comma-separated
+func splitUserIDs(values []string) []string {
+	var ids []string
+	for _, v := range values {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// copyForUser copies the broadcast document into userID's temp directory,
+// since each job cleans up its own file
+func copyForUser(src string, userID uuid.UUID) (string, error) {
+	dir, err := manager.CreateUserTempDir(userID)
+	if err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	dst := filepath.Join(dir, filepath.Base(src))
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// BroadcastHandler delivers one document to many users' tablets, starting a
+// separate job for each (admin only). The document is either an uploaded
+// file or a URL in Body; user_ids picks the recipients, defaulting to every
+// paired user.
+func BroadcastHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast not available in single-user mode"})
+		return
+	}
+
+	admin, ok := auth.RequireAdmin(c)
+	if !ok {
+		return
+	}
+
+	if rejectDuringMaintenance(c) {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxUploadSize())
+
+	var srcPath, document string
+	if header, err := c.FormFile("file"); err == nil {
+		dir, err := manager.CreateUserTempDir(admin.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store document"})
+			return
+		}
+		defer os.RemoveAll(dir)
+		srcPath = filepath.Join(dir, filepath.Base(header.Filename))
+		if err := c.SaveUploadedFile(header, srcPath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store document"})
+			return
+		}
+		document = filepath.Base(header.Filename)
+	} else if body := strings.TrimSpace(c.PostForm("Body")); body != "" && isURL(body) {
+		document = body
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file or a URL in Body is required"})
+		return
+	}
+
+	if rejectInvalidLabels(c, c.PostForm("labels")) {
+		return
+	}
+
+	userIDs := splitUserIDs(c.PostFormArray("user_ids"))
+	users, skipped, err := broadcastRecipients(userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+	if len(users) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No paired users to deliver to", "skipped": skipped})
+		return
+	}
+
+	b := &broadcast{
+		ID:        uuid.NewString(),
+		CreatedAt: time.Now(),
+		CreatedBy: admin.Username,
+		Document:  document,
+	}
+	for i := range users {
+		user := &users[i]
+		form := map[string]string{"source": "broadcast"}
+		for _, key := range broadcastFormFields {
+			if v := c.PostForm(key); v != "" {
+				form[key] = v
+			}
+		}
+		if srcPath != "" {
+			path, err := copyForUser(srcPath, user.ID)
+			if err != nil {
+				skipped[user.ID.String()] = fmt.Sprintf("Failed to copy document: %v", err)
+				continue
+			}
+			form["Body"] = path
+		} else {
+			form["Body"] = document
+		}
+
+		jobID := enqueueJobForUser(form, user.ID)
+		b.Jobs = append(b.Jobs, broadcastJob{UserID: user.ID, Username: user.Username, JobID: jobID})
+	}
+
+	broadcastsMu.Lock()
+	for id, old := range broadcasts {
+		if time.Since(old.CreatedAt) > broadcastTTL {
+			delete(broadcasts, id)
+		}
+	}
+	broadcasts[b.ID] = b
+	broadcastsMu.Unlock()
+
+	logging.Logf("[AUDIT] %s broadcast %q to %d users (broadcast %s)", admin.Username, document, len(b.Jobs), b.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"broadcastId": b.ID,
+		"jobs":        len(b.Jobs),
+		"skipped":     skipped,
+	})
+}
+
+// BroadcastStatusHandler reports the combined progress of a broadcast and the
+// state of each of its jobs (admin only)
+func BroadcastStatusHandler(c *gin.Context) {
+	if !database.IsMultiUserMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast not available in single-user mode"})
+		return
+	}
+
+	if _, ok := auth.RequireAdmin(c); !ok {
+		return
+	}
+
+	broadcastsMu.Lock()
+	b, ok := broadcasts[c.Param("id")]
+	broadcastsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast not found"})
+		return
+	}
+
+	type jobInfo struct {
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+		JobID    string `json:"job_id"`
+		Status   string `json:"status"`
+		Message  string `json:"message"`
+		Progress int    `json:"progress"`
+	}
+	jobs := make([]jobInfo, 0, len(b.Jobs))
+	var pending, running, succeeded, failed, progress int
+	for _, bj := range b.Jobs {
+		info := jobInfo{UserID: bj.UserID.String(), Username: bj.Username, JobID: bj.JobID, Status: "pending"}
+		if job, ok := jobStore.Get(bj.JobID); ok {
+			info.Status, info.Message, info.Progress = job.Status, job.Message, job.Progress
+		}
+		switch strings.ToLower(info.Status) {
+		case "success":
+			succeeded++
+			info.Progress = 100
+		case "error", "cancelled":
+			failed++
+			info.Progress = 100
+		case "running":
+			running++
+		default:
+			pending++
+		}
+		progress += info.Progress
+		jobs = append(jobs, info)
+	}
+	if len(jobs) > 0 {
+		progress /= len(jobs)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         b.ID,
+		"document":   b.Document,
+		"created_by": b.CreatedBy,
+		"created_at": b.CreatedAt,
+		"total":      len(jobs),
+		"pending":    pending,
+		"running":    running,
+		"succeeded":  succeeded,
+		"failed":     failed,
+		"progress":   progress,
+		"done":       succeeded+failed == len(jobs),
+		"jobs":       jobs,
+	})
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+type jobCancel struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var (
+	cancelMu    sync.Mutex
+	jobContexts = make(map[string]jobCancel)
+)
+
+// beginJobContext creates the context of job id as it starts running. The
+// runner ends it with endJobContext.
+func beginJobContext(id string) context.Context {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	var jc jobCancel
+	jc.ctx, jc.cancel = context.WithCancel(context.Background())
+	jobContexts[id] = jc
+	return jc.ctx
+}
+
+// jobContext returns the context job id's downloads, Ghostscript and rmapi
+// runs use, which is cancelled when the job is. A job that isn't running,
+// such as one processed directly in tests, gets a context that is never
+// cancelled.
+func jobContext(id string) context.Context {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	if jc, ok := jobContexts[id]; ok {
+		return jc.ctx
+	}
+	return context.Background()
+}
+
+// childJobContext makes the context of job id one that is also cancelled
+// with parent's, for the items of a batch
+func childJobContext(parent, id string) {
+	ctx := jobContext(parent)
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	var jc jobCancel
+	jc.ctx, jc.cancel = context.WithCancel(ctx)
+	jobContexts[id] = jc
+}
+
+// setJobDeadline makes job id's context also expire at deadline, so the
+// job's downloads, conversions and upload all stop once its timeout has
+// passed, and returns the new context. A job that isn't running keeps a
+// context without a deadline.
+func setJobDeadline(id string, deadline time.Time) context.Context {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	jc, ok := jobContexts[id]
+	if !ok {
+		return context.Background()
+	}
+	ctx, cancelDeadline := context.WithDeadline(jc.ctx, deadline)
+	cancel := jc.cancel
+	jobContexts[id] = jobCancel{ctx: ctx, cancel: func() {
+		cancelDeadline()
+		cancel()
+	}}
+	return ctx
+}
+
+// jobTimedOut reports whether job id's deadline has passed
+func jobTimedOut(id string) bool {
+	return errors.Is(jobContext(id).Err(), context.DeadlineExceeded)
+}
+
+// endJobContext forgets job id's context once the job is done
+func endJobContext(id string) {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	if jc, ok := jobContexts[id]; ok {
+		jc.cancel()
+		delete(jobContexts, id)
+	}
+}
+
+// cancelJob cancels job id's context and reports whether the job was
+// running. A job that hasn't started has no context to cancel.
+func cancelJob(id string) bool {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	jc, ok := jobContexts[id]
+	if ok {
+		jc.cancel()
+	}
+	return ok
+}
+
+// removeUploads deletes the local files referenced by the Body of a job that
+// was cancelled before it started, which the pipeline would otherwise have
+// removed. Only files in the temp directories uploads are saved to are
+// touched.
+func removeUploads(body string) {
+	paths := []string{body}
+	if strings.HasPrefix(body, "files:") {
+		paths = nil
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(body, "files:")), &paths); err != nil {
+			return
+		}
+	}
+	for _, p := range paths {
+		if inUploadDir(p) {
+			os.Remove(p)
+		}
+	}
+}
+
+// inUploadDir reports whether p is a file inside one of the temp
+// directories manager.CreateUserTempDir makes
+func inUploadDir(p string) bool {
+	if !filepath.IsAbs(p) {
+		return false
+	}
+	rel, err := filepath.Rel(os.TempDir(), filepath.Clean(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	dir, _, nested := strings.Cut(rel, string(filepath.Separator))
+	return nested && strings.HasPrefix(dir, "aviary-")
+}
+
+// CancelHandler stops a job that hasn't finished. A waiting job never
+// starts; a running one has its download, Ghostscript and rmapi processes
+// stopped, and its temporary files are cleaned up as when a job fails. Its
+// status becomes "cancelled".
+func CancelHandler(c *gin.Context) {
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return
+		}
+		user = u
+	}
+
+	id := c.Param("id")
+	job, ok := jobStore.Get(id)
+	if ok && user != nil && !user.IsAdmin {
+		owner, owned := jobStore.Owner(id)
+		ok = owned && owner == user.ID
+	}
+	if !ok {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "job not found")
+		return
+	}
+	if job.Finished() {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "job has already finished")
+		return
+	}
+
+	// Jobs held for degraded mode or a delivery window aren't in the pool
+	dropQueuedJob(id)
+	// Waiting jobs are skipped when their turn comes. A job that starts
+	// running meanwhile creates its context before checking its status, so
+	// one of the two always stops it.
+	if jobStore.UpdateIfWaiting(id, "cancelled", "backend.status.cancelled", nil) {
+		cancelJob(id)
+		logging.Logf("[CANCEL] Cancelled job %s before it started", id)
+	} else if cancelJob(id) {
+		logging.Logf("[CANCEL] Cancelling running job %s", id)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "jobId": id})
+}
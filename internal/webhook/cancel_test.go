@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCancelJobWithoutContext(t *testing.T) {
+	if cancelJob("not-running") {
+		t.Error("cancelJob reported a job that never started as running")
+	}
+	cancelMu.Lock()
+	_, leaked := jobContexts["not-running"]
+	cancelMu.Unlock()
+	if leaked {
+		t.Error("cancelJob created a context for a job that never started")
+	}
+	if err := jobContext("not-running").Err(); err != nil {
+		t.Errorf("jobContext of a job that isn't running = %v, want nil", err)
+	}
+}
+
+func TestCancelJobRacesEnd(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		ctx := beginJobContext("racing")
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); cancelJob("racing") }()
+		go func() { defer wg.Done(); endJobContext("racing") }()
+		wg.Wait()
+		if ctx.Err() == nil {
+			t.Fatal("context still live after cancel and end")
+		}
+	}
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	if _, ok := jobContexts["racing"]; ok {
+		t.Error("context left behind after endJobContext")
+	}
+}
+
+func TestJobDeadline(t *testing.T) {
+	if ctx := setJobDeadline("not-running", time.Now()); ctx.Err() != nil {
+		t.Errorf("deadline set on a job that isn't running: %v", ctx.Err())
+	}
+
+	begun := beginJobContext("slow")
+	ctx := setJobDeadline("slow", time.Now().Add(20*time.Millisecond))
+	if jobContext("slow") != ctx {
+		t.Fatal("jobContext doesn't return the context with the deadline")
+	}
+	<-ctx.Done()
+	if !jobTimedOut("slow") {
+		t.Errorf("jobTimedOut = false after the deadline, err %v", ctx.Err())
+	}
+	if begun.Err() != nil {
+		t.Error("the deadline cancelled the job itself")
+	}
+	endJobContext("slow")
+	if begun.Err() == nil {
+		t.Error("endJobContext didn't release the job's context")
+	}
+
+	// Cancelling a job with a deadline reports it as cancelled, not timed out
+	beginJobContext("cancelled")
+	ctx = setJobDeadline("cancelled", time.Now().Add(time.Hour))
+	if !cancelJob("cancelled") || ctx.Err() == nil {
+		t.Fatal("cancelJob didn't cancel the context with the deadline")
+	}
+	if jobTimedOut("cancelled") {
+		t.Error("cancelled job reported as timed out")
+	}
+	endJobContext("cancelled")
+}
+
+func TestRemoveUploadsOnlyInTempDirs(t *testing.T) {
+	uploadDir, err := os.MkdirTemp("", "aviary-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(uploadDir)
+	upload := filepath.Join(uploadDir, "upload.pdf")
+	other := filepath.Join(t.TempDir(), "keep.pdf")
+	for _, p := range []string{upload, other} {
+		if err := os.WriteFile(p, []byte("%PDF"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeUploads(`files:["` + upload + `","` + other + `"]`)
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Errorf("upload %s was not removed", upload)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("file outside the upload dirs was touched: %v", err)
+	}
+
+	for _, p := range []string{
+		uploadDir,
+		filepath.Join(uploadDir, "..", "..", "etc", "passwd"),
+		"https://example.com/a.pdf",
+		"relative/aviary-x/a.pdf",
+	} {
+		if inUploadDir(p) {
+			t.Errorf("inUploadDir(%q) = true, want false", p)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// Chunked uploads send a large file in pieces small enough to pass proxies
+// with low body size limits. The client starts an upload, PUTs the file's
+// bytes in order, asks for the offset to resume after a dropped connection,
+// and completes the upload, which checks the size and checksum and starts
+// the job.
+
+// maxChunkedUploadsPerUser limits how many unfinished uploads a user can have
+const maxChunkedUploadsPerUser = 10
+
+// chunkedUpload is a file being uploaded in pieces
+type chunkedUpload struct {
+	mu       sync.Mutex
+	id       string
+	userID   uuid.UUID
+	filename string
+	size     int64
+	sha256   string // expected lowercase hex digest; empty skips the check
+	dir      string // temp directory holding the partial file
+	offset   int64
+	updated  time.Time
+	// busy is set while a chunk is being written or the upload completed
+	busy bool
+}
+
+func (u *chunkedUpload) path() string {
+	return filepath.Join(u.dir, "upload.part")
+}
+
+func (u *chunkedUpload) status() gin.H {
+	return gin.H{
+		"upload_id":  u.id,
+		"filename":   u.filename,
+		"size":       u.size,
+		"offset":     u.offset,
+		"chunk_size": chunkSize(),
+		"expires_at": u.updated.Add(chunkedUploadTTL()),
+	}
+}
+
+var (
+	chunkedMu      sync.Mutex
+	chunkedUploads = make(map[string]*chunkedUpload)
+)
+
+// chunkSize is the largest chunk accepted, from UPLOAD_CHUNK_SIZE in bytes
+// (default 5 MB). Clients may send smaller chunks.
+func chunkSize() int64 {
+	return int64(config.GetInt("UPLOAD_CHUNK_SIZE", 5<<20))
+}
+
+// chunkedUploadTTL is how long an upload may sit without a new chunk before
+// it's discarded, from CHUNKED_UPLOAD_TTL (default 24h)
+func chunkedUploadTTL() time.Duration {
+	return config.GetDuration("CHUNKED_UPLOAD_TTL", 24*time.Hour)
+}
+
+// removeChunkedUpload forgets u and deletes its partial file
+func removeChunkedUpload(u *chunkedUpload) {
+	chunkedMu.Lock()
+	delete(chunkedUploads, u.id)
+	chunkedMu.Unlock()
+	os.RemoveAll(u.dir)
+}
+
+// sweepChunkedUploads discards uploads that stopped receiving chunks
+func sweepChunkedUploads() {
+	cutoff := time.Now().Add(-chunkedUploadTTL())
+	var stale []*chunkedUpload
+	chunkedMu.Lock()
+	for _, u := range chunkedUploads {
+		u.mu.Lock()
+		if !u.busy && u.updated.Before(cutoff) {
+			stale = append(stale, u)
+		}
+		u.mu.Unlock()
+	}
+	chunkedMu.Unlock()
+	for _, u := range stale {
+		logging.Logf("[UPLOAD] Discarding abandoned chunked upload %s (%s)", u.id, u.filename)
+		removeChunkedUpload(u)
+	}
+}
+
+// chunkedUploadFor returns the caller's upload named in the URL, responding
+// with an error if there isn't one
+func chunkedUploadFor(c *gin.Context) (*chunkedUpload, *database.User, bool) {
+	var user *database.User
+	userID := uuid.Nil
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return nil, nil, false
+		}
+		user, userID = u, u.ID
+	}
+	chunkedMu.Lock()
+	u := chunkedUploads[c.Param("id")]
+	chunkedMu.Unlock()
+	if u == nil || u.userID != userID {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "upload not found")
+		return nil, nil, false
+	}
+	return u, user, true
+}
+
+// StartChunkedUploadHandler starts a chunked upload of a file with the given
+// name and size, and optionally its SHA-256 checksum
+func StartChunkedUploadHandler(c *gin.Context) {
+	if rejectDuringMaintenance(c) {
+		return
+	}
+
+	var req struct {
+		Filename string `json:"filename" binding:"required"`
+		Size     int64  `json:"size" binding:"required"`
+		SHA256   string `json:"sha256"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Size <= 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "filename and size are required")
+		return
+	}
+	filename, err := security.ValidateAndCleanFilename(req.Filename)
+	if err != nil || filename == "." {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "invalid filename")
+		return
+	}
+	checksum := strings.ToLower(strings.TrimSpace(req.SHA256))
+	if checksum != "" {
+		if b, err := hex.DecodeString(checksum); err != nil || len(b) != sha256.Size {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "sha256 must be a hex SHA-256 digest")
+			return
+		}
+	}
+
+	userID := uuid.Nil
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return
+		}
+		user, userID = u, u.ID
+	}
+	if rejectTooLarge(c, req.Size, MaxUploadSizeFor(user)) {
+		return
+	}
+	if rejectBlockedContent(c, user, fileKind(filename)) {
+		return
+	}
+	if rejectUnderLoad(c, userID) {
+		return
+	}
+
+	sweepChunkedUploads()
+	chunkedMu.Lock()
+	open := 0
+	for _, u := range chunkedUploads {
+		if u.userID == userID {
+			open++
+		}
+	}
+	chunkedMu.Unlock()
+	if open >= maxChunkedUploadsPerUser {
+		apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeTooManyRequests, "too many unfinished uploads")
+		return
+	}
+
+	dir, err := manager.CreateUserTempDir(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "create_dir", "")
+		return
+	}
+	u := &chunkedUpload{
+		id:       uuid.NewString(),
+		userID:   userID,
+		filename: filename,
+		size:     req.Size,
+		sha256:   checksum,
+		dir:      dir,
+		updated:  time.Now(),
+	}
+	f, err := os.Create(u.path())
+	if err != nil {
+		os.RemoveAll(dir)
+		apierror.Respond(c, http.StatusInternalServerError, "create_file", "")
+		return
+	}
+	f.Close()
+
+	chunkedMu.Lock()
+	chunkedUploads[u.id] = u
+	chunkedMu.Unlock()
+	logging.Logf("[UPLOAD] Started chunked upload %s: %s (%d bytes)", u.id, filename, req.Size)
+	c.JSON(http.StatusCreated, u.status())
+}
+
+// ChunkedUploadStatusHandler returns how much of the file has arrived, so an
+// interrupted upload can resume from there
+func ChunkedUploadStatusHandler(c *gin.Context) {
+	u, _, ok := chunkedUploadFor(c)
+	if !ok {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c.JSON(http.StatusOK, u.status())
+}
+
+// UploadChunkHandler appends the request body to the upload. The offset query
+// parameter (or Upload-Offset header) must match the bytes received so far;
+// otherwise the request is refused with 409 and the current offset.
+func UploadChunkHandler(c *gin.Context) {
+	u, _, ok := chunkedUploadFor(c)
+	if !ok {
+		return
+	}
+
+	offsetStr := c.Query("offset")
+	if offsetStr == "" {
+		offsetStr = c.GetHeader("Upload-Offset")
+	}
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "offset is required")
+		return
+	}
+
+	u.mu.Lock()
+	if u.busy {
+		u.mu.Unlock()
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "another chunk is being written")
+		return
+	}
+	if offset != u.offset {
+		current := u.offset
+		u.mu.Unlock()
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "offset does not match the bytes received", gin.H{"offset": current})
+		return
+	}
+	u.busy = true
+	u.mu.Unlock()
+
+	limit := chunkSize()
+	if remaining := u.size - offset; remaining < limit {
+		limit = remaining
+	}
+	if c.Request.ContentLength > limit {
+		u.mu.Lock()
+		u.busy = false
+		u.mu.Unlock()
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("chunk may be at most %d bytes", limit))
+		return
+	}
+
+	// Keep whatever arrived, even if the connection drops mid-chunk, so the
+	// client can resume from the new offset
+	n, copyErr := writeChunk(u.path(), offset, http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	u.mu.Lock()
+	u.offset += n
+	u.updated = time.Now()
+	u.busy = false
+	status := u.status()
+	u.mu.Unlock()
+
+	if copyErr != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(copyErr, &tooLarge) {
+			apierror.Respond(c, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("chunk may be at most %d bytes", limit), gin.H{"offset": status["offset"]})
+			return
+		}
+		logging.Logf("[UPLOAD] Chunk for upload %s failed after %d bytes: %v", u.id, n, copyErr)
+		apierror.Respond(c, http.StatusInternalServerError, "upload_stream_failed", "", gin.H{"offset": status["offset"]})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// writeChunk writes r into the file at path starting at offset and returns
+// how many bytes were written
+func writeChunk(path string, offset int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	// Drop anything past the new end, left by an earlier failed write
+	if terr := os.Truncate(path, offset+n); err == nil {
+		err = terr
+	}
+	return n, err
+}
+
+// CompleteChunkedUploadHandler checks the finished file's size and checksum
+// and starts a job for it. The body holds the same options as /api/upload,
+// as JSON or form fields.
+func CompleteChunkedUploadHandler(c *gin.Context) {
+	if rejectDuringMaintenance(c) {
+		return
+	}
+	u, user, ok := chunkedUploadFor(c)
+	if !ok {
+		return
+	}
+
+	formValues, err := completionOptions(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "parse_form", "")
+		return
+	}
+
+	u.mu.Lock()
+	if u.busy {
+		u.mu.Unlock()
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "a chunk is still being written")
+		return
+	}
+	if u.offset != u.size {
+		status := u.status()
+		u.mu.Unlock()
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "upload is incomplete", gin.H{"offset": status["offset"]})
+		return
+	}
+	u.busy = true
+	u.mu.Unlock()
+	release := func() {
+		u.mu.Lock()
+		u.busy = false
+		u.mu.Unlock()
+	}
+
+	info, err := os.Stat(u.path())
+	if err != nil || info.Size() != u.size {
+		release()
+		logging.Logf("[UPLOAD] Chunked upload %s has the wrong size on disk", u.id)
+		removeChunkedUpload(u)
+		apierror.Respond(c, http.StatusUnprocessableEntity, "save_file", "uploaded file is incomplete")
+		return
+	}
+	if u.sha256 != "" {
+		sp, err := security.NewSecurePathFromExisting(u.path())
+		var sum string
+		if err == nil {
+			sum, err = fileSHA256(sp)
+		}
+		if err != nil || sum != u.sha256 {
+			logging.Logf("[UPLOAD] Chunked upload %s failed its checksum", u.id)
+			removeChunkedUpload(u)
+			apierror.Respond(c, http.StatusUnprocessableEntity, apierror.CodeBadRequest, "checksum mismatch, start the upload again")
+			return
+		}
+	}
+
+	// Admins can deliver the upload to another user's tablet
+	userID := u.userID
+	target := user
+	if database.IsMultiUserMode() {
+		t, err := resolveTargetUser(user, requestedTarget(c, formValues["user_id"]))
+		if err != nil {
+			release()
+			status, errType := onBehalfError(err)
+			apierror.Respond(c, status, errType, err.Error())
+			return
+		}
+		target = t
+	}
+	userID = targetID(target, userID)
+	if rejectInvalidLabels(c, formValues["labels"]) {
+		release()
+		return
+	}
+
+	finalPath := filepath.Join(u.dir, u.filename)
+	if err := os.Rename(u.path(), finalPath); err != nil {
+		release()
+		apierror.Respond(c, http.StatusInternalServerError, "save_file", "")
+		return
+	}
+	// The job owns the file from here on
+	chunkedMu.Lock()
+	delete(chunkedUploads, u.id)
+	chunkedMu.Unlock()
+
+	jobId := enqueueJobForUser(uploadForm(c.Request.Context(), uploadBody(finalPath), formValues), userID)
+	logging.Logf("[UPLOAD] Completed chunked upload %s: %s", u.id, u.filename)
+	auditOnBehalf(c, user, target, jobId)
+	c.JSON(http.StatusAccepted, gin.H{"jobId": jobId})
+}
+
+// completionOptions reads the job options sent to complete an upload, as a
+// JSON object or form fields
+func completionOptions(c *gin.Context) (map[string]string, error) {
+	values := make(map[string]string)
+	if c.ContentType() == "application/json" {
+		var raw map[string]interface{}
+		if err := json.NewDecoder(c.Request.Body).Decode(&raw); err != nil && err != io.EOF {
+			return nil, err
+		}
+		for k, v := range raw {
+			if v != nil {
+				values[k] = fmt.Sprint(v)
+			}
+		}
+		return values, nil
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		return nil, err
+	}
+	for k := range c.Request.PostForm {
+		values[k] = c.Request.PostForm.Get(k)
+	}
+	return values, nil
+}
+
+// CancelChunkedUploadHandler abandons an upload and deletes what was received
+func CancelChunkedUploadHandler(c *gin.Context) {
+	u, _, ok := chunkedUploadFor(c)
+	if !ok {
+		return
+	}
+	u.mu.Lock()
+	busy := u.busy
+	u.mu.Unlock()
+	if busy {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "a chunk is still being written")
+		return
+	}
+	removeChunkedUpload(u)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func startChunkedUpload(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/upload/chunk", StartChunkedUploadHandler)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/chunk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestStartChunkedUploadRejectsBadFilenames(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	for _, name := range []string{
+		"",
+		"   ",
+		".",
+		"..",
+		"../../etc/cron.d/job",
+		"Books/a.pdf",
+		`C:\Users\alice\a.pdf`,
+		"a\x00.pdf",
+	} {
+		body, _ := json.Marshal(map[string]interface{}{"filename": name, "size": 10})
+		w := startChunkedUpload(t, string(body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("filename %q: status = %d, want %d", name, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestStartChunkedUpload(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	w := startChunkedUpload(t, `{"filename":" report.pdf ","size":10}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	var resp struct {
+		ID       string `json:"upload_id"`
+		Filename string `json:"filename"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	chunkedMu.Lock()
+	u := chunkedUploads[resp.ID]
+	delete(chunkedUploads, resp.ID)
+	chunkedMu.Unlock()
+	if u == nil {
+		t.Fatal("upload not registered")
+	}
+	defer os.RemoveAll(u.dir)
+	if resp.Filename != "report.pdf" || filepath.Dir(filepath.Join(u.dir, u.filename)) != u.dir {
+		t.Errorf("filename = %q, want report.pdf inside the upload dir", resp.Filename)
+	}
+}
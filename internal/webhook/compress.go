@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rmitchellscott/aviary/internal/compressor"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/converter"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/pdfprocessor"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// compressOptions picks Ghostscript options for the PDF at path from the
+// job's compression preset. Scans gain the most: their images are downsampled
+// to the resolution at which the page fills the tablet's screen.
+func compressOptions(path string, form map[string]string, dbUser *database.User) compressor.Options {
+	preset := compressor.Preset(form["compress_preset"])
+	if preset == compressor.PresetStandard {
+		return compressor.Options{}
+	}
+
+	imageOnly, page, err := pdfprocessor.DetectImageOnly(path)
+	if err != nil {
+		manager.Logf("image detection failed for %q, using standard compression: %v", path, err)
+		return compressor.Options{}
+	}
+	if preset == compressor.PresetAuto && !imageOnly {
+		return compressor.Options{}
+	}
+
+	var resolution string
+	if dbUser != nil {
+		resolution = dbUser.PageResolution
+	}
+	screenW, screenH, err := converter.ScreenResolution(resolution)
+	if err != nil {
+		manager.Logf("invalid page resolution, using standard compression: %v", err)
+		return compressor.Options{}
+	}
+	opts := compressor.Options{ImageDPI: compressor.DeviceDPI(page.Width, page.Height, screenW, screenH)}
+	if imageOnly {
+		manager.Logf("%q is image-only, downsampling images to %d DPI", path, opts.ImageDPI)
+	} else {
+		manager.Logf("Downsampling images in %q to %d DPI", path, opts.ImageDPI)
+	}
+	return opts
+}
+
+// compressFiles compresses the PDFs among paths concurrently, replacing each
+// entry with its compressed file. How many run at once is capped across all
+// jobs by COMPRESS_WORKERS, and files compressor.SkipReason rules out are
+// left alone. Progress is reported by pages done out of totalPages. On
+// failure it returns the status key and the first error.
+func compressFiles(jobID string, form map[string]string, dbUser *database.User, paths []string, totalPages int) (string, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		done     = make([]int, len(paths))
+		statuses = make([]string, len(paths))
+		errs     = make([]error, len(paths))
+		pdfs     int
+		skipped  int
+	)
+
+	// report must be called with mu held
+	report := func() {
+		if totalPages <= 0 {
+			return
+		}
+		sum := 0
+		for _, pages := range done {
+			sum += pages
+		}
+		jobStore.UpdateProgress(jobID, min(sum*100/totalPages, 100))
+	}
+
+	for i, path := range paths {
+		if strings.ToLower(filepath.Ext(path)) != ".pdf" {
+			continue
+		}
+		pdfs++
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+
+			// Usually cached from the page total worked out before compressing
+			pages := 1
+			if n, err := compressor.GetPDFPageCount(path); err == nil {
+				pages = n
+			}
+
+			if reason, skip := compressor.SkipReason(path); skip {
+				manager.Logf("Skipping compression of %q: %s", path, reason)
+				mu.Lock()
+				skipped++
+				done[i] = pages
+				report()
+				mu.Unlock()
+				return
+			}
+			manager.Logf("Compressing PDF %q", path)
+
+			opts := compressOptions(path, form, dbUser)
+			opts.Usage = jobUsage(jobID)
+			opts.Context = jobContext(jobID)
+			compressedPath, err := compressor.CompressPDFWithOptions(path, opts, func(page, total int) {
+				if total > 0 {
+					mu.Lock()
+					done[i] = page * pages / total
+					report()
+					mu.Unlock()
+				}
+			})
+			if err != nil {
+				statuses[i], errs[i] = "backend.status.compress_error", err
+				return
+			}
+			mu.Lock()
+			done[i] = pages
+			report()
+			mu.Unlock()
+
+			// Remove the uncompressed version and drop the "_compressed" suffix
+			// to match the single file flow
+			if securePath, err := security.NewSecurePathFromExisting(path); err == nil {
+				security.SafeRemove(securePath)
+			}
+			origPath := strings.TrimSuffix(compressedPath, "_compressed.pdf") + ".pdf"
+			secureCompressedPath, compErr := security.NewSecurePathFromExisting(compressedPath)
+			secureOrigPath, origErr := security.NewSecurePathFromExisting(origPath)
+			if compErr != nil || origErr != nil || security.SafeRename(secureCompressedPath, secureOrigPath) != nil {
+				paths[i] = compressedPath
+				statuses[i], errs[i] = "backend.status.rename_error", fmt.Errorf("failed to rename compressed file")
+				return
+			}
+			paths[i] = origPath
+		}(i, path)
+	}
+	wg.Wait()
+
+	if pdfs > 0 && skipped == pdfs {
+		jobStore.UpdateWithOperation(jobID, "Running", "backend.status.compress_skipped", nil, "compressing")
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return statuses[i], err
+		}
+	}
+	return "", nil
+}
+
+// optimizeEPUB shrinks the images in the EPUB at path, in place, when it's
+// larger than EPUB_OPTIMIZE_ABOVE bytes: image-heavy EPUBs take a long time
+// to sync to the tablet. Images are fitted to the user's page resolution. The
+// EPUB is sent as it was when optimizing fails or doesn't make it smaller.
+func optimizeEPUB(ctx context.Context, jobID, path string, dbUser *database.User) {
+	threshold := int64(config.GetInt("EPUB_OPTIMIZE_ABOVE", 20<<20))
+	info, err := os.Stat(path)
+	if threshold <= 0 || err != nil || info.Size() <= threshold {
+		return
+	}
+
+	var resolution string
+	if dbUser != nil {
+		resolution = dbUser.PageResolution
+	}
+	screenW, screenH, err := converter.ScreenResolution(resolution)
+	if err != nil {
+		manager.Logf("invalid page resolution, not optimizing EPUB: %v", err)
+		return
+	}
+
+	manager.Logf("Optimizing images in %q (%d bytes)", path, info.Size())
+	jobStore.UpdateWithOperation(jobID, "Running", "backend.status.optimizing_epub", nil, "compressing")
+	jobStore.UpdateProgress(jobID, 0)
+	optimized, err := converter.OptimizeEPUB(path, converter.EPUBOptimizeOptions{
+		MaxWidth:   screenW,
+		MaxHeight:  screenH,
+		Quality:    config.GetInt("EPUB_IMAGE_QUALITY", 80),
+		StripFonts: config.GetBool("EPUB_STRIP_FONTS", false),
+		Context:    ctx,
+		Usage:      jobUsage(jobID),
+		Progress: func(done, total int) {
+			jobStore.UpdateProgress(jobID, done*100/total)
+		},
+	})
+	if err != nil {
+		manager.Logf("EPUB optimization failed, sending %q as it is: %v", path, err)
+		return
+	}
+	jobStore.UpdateProgress(jobID, 100)
+
+	secureOptimized, err := security.NewSecurePathFromExisting(optimized)
+	if err != nil {
+		return
+	}
+	if smaller, err := os.Stat(optimized); err != nil || smaller.Size() >= info.Size() {
+		manager.Logf("Optimizing %q didn't make it smaller, sending it as it is", path)
+		security.SafeRemove(secureOptimized)
+		return
+	}
+	securePath, err := security.NewSecurePathFromExisting(path)
+	if err != nil || security.SafeRename(secureOptimized, securePath) != nil {
+		manager.Logf("could not replace %q with its optimized version", path)
+		security.SafeRemove(secureOptimized)
+		return
+	}
+	if optimizedInfo, err := os.Stat(path); err == nil {
+		manager.Logf("Optimized EPUB %q from %d to %d bytes", path, info.Size(), optimizedInfo.Size())
+	}
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// skipDuplicatesEnabled reports whether a job should skip uploading a file
+// its user already uploaded to the same folder. SKIP_DUPLICATES sets the
+// default; a job can override it with its skip_duplicates option.
+func skipDuplicatesEnabled(option string) bool {
+	return config.BoolOption(option, "SKIP_DUPLICATES", true)
+}
+
+// findDuplicate returns the user's document in rmDir with the same content
+// as the file at path, or nil if there's none. Documents removed from the
+// history don't count, so removing one allows it to be sent again.
+func findDuplicate(userID uuid.UUID, path, rmDir string) *database.Document {
+	if database.DB == nil || userID == uuid.Nil {
+		return nil
+	}
+	sp, err := security.NewSecurePathFromExisting(path)
+	if err != nil {
+		return nil
+	}
+	hash, err := fileSHA256(sp)
+	if err != nil {
+		return nil
+	}
+
+	var docs []database.Document
+	if err := database.DB.Where("user_id = ? AND content_hash = ?", userID, hash).
+		Order("upload_date DESC").Find(&docs).Error; err != nil {
+		return nil
+	}
+	folder := remoteFolder(rmDir)
+	for i := range docs {
+		if remoteFolder(filepath.Dir(docs[i].RemotePath)) == folder {
+			return &docs[i]
+		}
+	}
+	return nil
+}
+
+// remoteFolder normalizes a reMarkable folder path for comparison
+func remoteFolder(dir string) string {
+	return strings.Trim(filepath.ToSlash(filepath.Clean("/"+dir)), "/")
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rmitchellscott/aviary/internal/compressor"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/converter"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/version"
+)
+
+// jobEnvironment records the software and settings a job ran with, so a
+// conversion that looks different after an upgrade or a settings change can
+// be explained later
+type jobEnvironment struct {
+	Aviary   string            `json:"aviary"`
+	Commit   string            `json:"commit"`
+	Tools    map[string]string `json:"tools"`
+	Settings map[string]string `json:"settings"`
+}
+
+// newJobEnvironment snapshots the versions and effective conversion settings
+// for a job run for dbUser with form's options
+func newJobEnvironment(form map[string]string, dbUser *database.User) jobEnvironment {
+	var resolution string
+	var dpi float64
+	if database.IsMultiUserMode() && dbUser != nil {
+		resolution, dpi = dbUser.PageResolution, dbUser.PageDPI
+	}
+	pdfOptions := converter.GetPDFOptionsForUser(resolution, dpi)
+
+	info := version.Get()
+	return jobEnvironment{
+		Aviary: info.Version,
+		Commit: info.GitCommit,
+		Tools:  version.Tools(),
+		Settings: map[string]string{
+			"gs_compat":       config.Get("GS_COMPAT", "1.7"),
+			"gs_settings":     config.Get("GS_SETTINGS", "/ebook"),
+			"compress_preset": compressor.Preset(form["compress_preset"]),
+			"page_resolution": pdfOptions.PageSize,
+			"page_dpi":        fmt.Sprint(pdfOptions.DPI),
+			"output_format":   getOutputFormat(form, dbUser),
+		},
+	}
+}
+
+// JSON returns the snapshot as a JSON object, or "" if it can't be encoded
+func (e jobEnvironment) JSON() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// Update policies decide what a job fetching a URL does when the user was
+// sent the same URL before
+const (
+	// UpdateAlways uploads every fetch, as before fingerprints existed
+	UpdateAlways = "always"
+	// UpdateSkip skips a fetch whose content hasn't changed since the last
+	// delivery
+	UpdateSkip = "skip"
+	// UpdateReplace skips unchanged content too, and removes the last
+	// delivery from the reMarkable once changed content is uploaded
+	UpdateReplace = "replace"
+)
+
+// ValidUpdatePolicy reports whether policy is one of the update policies.
+// Empty means UpdateAlways.
+func ValidUpdatePolicy(policy string) bool {
+	switch policy {
+	case "", UpdateAlways, UpdateSkip, UpdateReplace:
+		return true
+	}
+	return false
+}
+
+// updatePolicy returns the job's update_policy option
+func updatePolicy(form map[string]string) string {
+	policy := strings.ToLower(strings.TrimSpace(form["update_policy"]))
+	if policy == "" || !ValidUpdatePolicy(policy) {
+		return UpdateAlways
+	}
+	return policy
+}
+
+var (
+	htmlTags   = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// bytesFingerprint returns the fingerprint of fetched content
+func bytesFingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileFingerprint returns the fingerprint of a downloaded file, or "" if it
+// can't be read
+func fileFingerprint(p string) string {
+	sp, err := security.NewSecurePathFromExisting(p)
+	if err != nil {
+		return ""
+	}
+	hash, err := fileSHA256(sp)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// articleFingerprint returns the fingerprint of an article's title and text.
+// Markup and whitespace are left out, so a page whose layout changes but
+// whose text doesn't keeps its fingerprint.
+func articleFingerprint(title, body string) string {
+	text := html.UnescapeString(htmlTags.ReplaceAllString(body, " "))
+	text = strings.TrimSpace(whitespace.ReplaceAllString(title+"\n"+text, " "))
+	return bytesFingerprint([]byte(text))
+}
+
+// previousDelivery returns the user's last document fetched from url, when
+// the job's update policy compares against it, or nil. Documents removed from
+// the history don't count, so removing one allows the content to be sent
+// again.
+func previousDelivery(userID uuid.UUID, form map[string]string, url string) *database.Document {
+	if updatePolicy(form) == UpdateAlways || !database.IsMultiUserMode() || database.DB == nil || userID == uuid.Nil || url == "" {
+		return nil
+	}
+	var doc database.Document
+	if err := database.DB.Where("user_id = ? AND source_url = ? AND fingerprint <> ''", userID, url).
+		Order("upload_date DESC").First(&doc).Error; err != nil {
+		return nil
+	}
+	return &doc
+}
+
+// unchanged reports whether fetched content with fingerprint is what was
+// delivered in previous
+func unchanged(previous *database.Document, fingerprint string) bool {
+	return previous != nil && fingerprint != "" && previous.Fingerprint == fingerprint
+}
+
+// unchangedStatus finishes a job whose content hasn't changed since previous
+func unchangedStatus(jobID string, previous *database.Document) (string, map[string]string, error) {
+	manager.Logf("Skipping upload: content unchanged since %s", previous.UploadDate.Format("2006-01-02 15:04"))
+	jobStore.UpdateProgress(jobID, 100)
+	return "backend.status.unchanged_skipped", map[string]string{
+		"path":        strings.TrimPrefix(previous.RemotePath, "/"),
+		"document_id": previous.ID.String(),
+	}, nil
+}
+
+// replacePrevious removes the previous delivery from the reMarkable once its
+// updated content was uploaded as rmDir/remoteName, and marks its record
+// replaced. A failure is logged; the new document is already there.
+func replacePrevious(previous *database.Document, rmDir, remoteName string, dbUser *database.User) {
+	if previous == nil || previous.RemotePath == "" {
+		return
+	}
+	// The upload may have overwritten the previous document in place
+	if path.Clean("/"+previous.RemotePath) == path.Clean("/"+path.Join(rmDir, remoteName)) {
+		return
+	}
+	if err := manager.RemoveDocument(previous.RemotePath, dbUser); err != nil {
+		manager.Logf("replace warning: could not remove previous delivery %s: %v", previous.RemotePath, err)
+		return
+	}
+	manager.Logf("Removed previous delivery %s", previous.RemotePath)
+	if err := database.DB.Model(previous).Update("status", "replaced").Error; err != nil {
+		manager.Logf("replace warning: could not update %s: %v", previous.ID, err)
+	}
+}
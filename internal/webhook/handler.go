@@ -5,11 +5,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -20,18 +22,30 @@ import (
 	"github.com/coder/websocket/wsjson"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
 	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/clouddrive"
 	"github.com/rmitchellscott/aviary/internal/compressor"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/converter"
 	"github.com/rmitchellscott/aviary/internal/downloads"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/degraded"
+	"github.com/rmitchellscott/aviary/internal/delivery"
 	"github.com/rmitchellscott/aviary/internal/downloader"
+	"github.com/rmitchellscott/aviary/internal/hooks"
 	"github.com/rmitchellscott/aviary/internal/jobs"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
 	"github.com/rmitchellscott/aviary/internal/manager"
 	"github.com/rmitchellscott/aviary/internal/pdfprocessor"
+	"github.com/rmitchellscott/aviary/internal/receipt"
+	"github.com/rmitchellscott/aviary/internal/rmapi"
+	"github.com/rmitchellscott/aviary/internal/routing"
 	"github.com/rmitchellscott/aviary/internal/security"
-	"github.com/rmitchellscott/aviary/internal/storage"
+	"github.com/rmitchellscott/aviary/internal/sendto"
+	"github.com/rmitchellscott/aviary/internal/telemetry"
+	"github.com/rmitchellscott/aviary/internal/tracing"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -78,6 +92,10 @@ func keyToMessage(key string) string {
 		return "Conversion error"
 	case "backend.status.compressing_pdf":
 		return "Compressing PDF"
+	case "backend.status.compress_skipped":
+		return "Compression skipped (already optimized)"
+	case "backend.status.optimizing_epub":
+		return "Optimizing EPUB images"
 	case "backend.status.compress_error":
 		return "Compression error"
 	case "backend.status.removing_background":
@@ -86,12 +104,50 @@ func keyToMessage(key string) string {
 		return "Rename error"
 	case "backend.status.uploading":
 		return "Uploading"
+	case "backend.status.converting_pdfa":
+		return "Converting archive copy to PDF/A"
+	case "backend.status.verifying_sync":
+		return "Verifying sync with the cloud"
+	case "backend.status.sync_unverified":
+		return "Uploaded, but the document did not appear in the cloud"
+	case "backend.status.running_hook":
+		return "Running upload hook"
+	case "backend.status.hook_error":
+		return "Upload hook failed"
+	case "backend.status.routing_error":
+		return "Routing script failed"
+	case "backend.status.cloud_drive_private":
+		return "Cloud drive file is not shared publicly"
+	case "backend.status.queued_delivery_window":
+		return "Queued until the delivery window opens"
+	case "backend.status.queued_degraded":
+		return "Queued until storage and reMarkable cloud recover"
+	case "backend.status.waiting_for_worker":
+		return "Waiting for a free worker"
+	case "backend.status.backend_unsupported":
+		return "Option not supported by the reMarkable cloud host"
+	case "backend.status.invalid_timeout":
+		return "Invalid timeout"
+	case "backend.status.upload_timeout":
+		return "Upload timed out"
+	case "backend.status.job_timeout":
+		return "Job timed out"
+	case "backend.status.quota_exceeded":
+		return "Quota exceeded"
 	case "backend.status.invalid_prefix":
 		return "Invalid prefix"
 	case "backend.status.job_not_found":
 		return "Job not found"
 	case "backend.status.conflict_entry_exists":
 		return "Entry already exists"
+	case "backend.status.duplicate_skipped":
+		return "Already uploaded, skipped"
+	case "backend.status.unchanged_skipped":
+		return "Unchanged since last delivery, skipped"
+	case "backend.status.content_type_blocked":
+		return "Content type not allowed"
+	case "backend.status.file_too_large":
+		return "File too large"
 	default:
 		return key // fallback to key if not found
 	}
@@ -111,6 +167,9 @@ var (
 		"text/markdown",
 		"text/html",
 		"text/plain", // for .md files that might be detected as plain text
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text",
 	}
 )
 
@@ -122,8 +181,10 @@ type DocumentRequest struct {
 	IsContent          bool   `form:"IsContent" json:"isContent"`     // Flag: true=content, false=URL
 	Prefix             string `form:"prefix" json:"prefix"`
 	Compress           string `form:"compress" json:"compress"`
+	CompressPreset     string `form:"compress_preset" json:"compress_preset"`
 	Manage             string `form:"manage" json:"manage"`
 	Archive            string `form:"archive" json:"archive"`
+	ArchivePDFA        string `form:"archive_pdfa" json:"archive_pdfa"` // overrides ARCHIVE_PDFA
 	RmDir              string `form:"rm_dir" json:"rm_dir"`
 	RetentionDays      string `form:"retention_days" json:"retention_days"`
 	ConflictResolution string `form:"conflict_resolution" json:"conflict_resolution"`
@@ -131,6 +192,18 @@ type DocumentRequest struct {
 	Contrast           string `form:"contrast" json:"contrast"`
 	CurrentPage        string `form:"currentpage" json:"currentpage"`
 	RemoveBackground   string `form:"remove_background" json:"removeBackground"`
+	OutputFormat       string `form:"outputFormat" json:"outputFormat"`     // "pdf" or "epub" for converted web pages; overrides conversion_output_format
+	ExtractContent     string `form:"extract_content" json:"extract_content"` // web pages: keep only the article (true) or the whole page (false)
+	UploadTimeout      string `form:"upload_timeout" json:"upload_timeout"` // seconds or a duration such as "10m"
+	JobTimeout         string `form:"job_timeout" json:"job_timeout"`
+	VerifySync         string `form:"verify_sync" json:"verify_sync"` // overrides SYNC_VERIFY
+	SkipDuplicates     string `form:"skip_duplicates" json:"skip_duplicates"` // overrides SKIP_DUPLICATES
+	UpdatePolicy       string `form:"update_policy" json:"update_policy"`     // URLs sent before: "always", "skip" or "replace"
+	Receipt            string `form:"receipt" json:"receipt"`         // overrides RECEIPTS
+	Labels             string `form:"labels" json:"labels"`           // key=value pairs separated by commas, e.g. "source=rss,project=thesis"
+	UserID             string `form:"user_id" json:"user_id"`         // Admins only: run the job as this user (ID or username)
+	RequestID          string `form:"-" json:"-"`                     // the HTTP request that submitted it, for the job's logs
+	TraceParent        string `form:"-" json:"-"`                     // the trace of the request that submitted it, for the job's spans
 }
 
 // enqueueJob creates a new job ID, logs form fields, starts processPDF(form) in a goroutine,
@@ -154,6 +227,9 @@ func enqueueJobForUser(form map[string]string, userID uuid.UUID) string {
 	// Log each form field in "Human Key: Value" format with username.
 	titleCaser := cases.Title(language.English)
 	for key, val := range form {
+		if key == "request_id" || key == "traceparent" {
+			continue
+		}
 		humanKey := titleCaser.String(strings.ReplaceAll(key, "_", " "))
 		manager.LogfWithUser(user, "%s: %s", humanKey, val)
 	}
@@ -161,50 +237,170 @@ func enqueueJobForUser(form map[string]string, userID uuid.UUID) string {
 	// Create a new job in the in-memory store.
 	id := uuid.NewString()
 	jobStore.Create(id)
+	jobStore.SetOwner(id, userID)
+	jobStore.SetRequestID(id, form["request_id"])
+	applyLabels(id, form, user)
+
+	// Hold the job until storage and rmapi are healthy again
+	if degraded.Active() && queueJob(id, userID, form, nil) {
+		return id
+	}
+	// Hold the job until the user's delivery window opens
+	if w, closed := windowClosed(user); closed && holdForWindow(id, userID, form, nil, w) {
+		return id
+	}
 
-	// Launch background worker
-	go func() {
+	startJob(id, form, userID, user)
+	return id
+}
+
+// startJob runs processPDFForUser for an existing job ID in a goroutine
+func startJob(id string, form map[string]string, userID uuid.UUID, user *database.User) {
+	jobDone := maintenance.TrackJob(userID)
+
+	// Run in the job pool once a worker is free
+	runJob(id, userID, jobPriority(form), func() {
+		defer jobDone()
+		beginJobContext(id)
+		defer endJobContext(id)
+		if status, _ := JobStatus(id); status == "cancelled" {
+			removeUploads(form["Body"])
+			return
+		}
 		jobStore.Update(id, "Running", "", nil)
 		jobStore.UpdateProgress(id, 0)
+		ctx := jobLogContext(id, user)
 
 		// Catch panics
 		defer func() {
+			endJobUsage(id)
 			if r := recover(); r != nil {
-				manager.LogfWithUser(user, "Panic in processPDF: %v", r)
+				logging.LogfCtx(ctx, "Panic in processPDF: %v", r)
 				jobStore.Update(id, "Error", "backend.status.internal_error", nil)
 			}
 		}()
 
 		// Do the actual work
+		endTrace := traceJob(id, "job", form["traceparent"])
 		msgKey, data, err := processPDFForUser(id, form, userID)
-		if err != nil {
-			manager.LogfWithUser(user, "processPDF error: %v, message: %s", err, keyToMessage(msgKey))
+		endTrace(err)
+		telemetry.RecordJob(err)
+		if usage := endJobUsage(id); usage != nil {
+			logging.LogfCtx(ctx, "processPDF resource usage: %s", usageSummary(usage))
+			data = withUsage(data, usage)
+		}
+		if err != nil && jobTimedOut(id) {
+			logging.LogfCtx(ctx, "processPDF timed out: %v", err)
+			jobStore.Update(id, "error", "backend.status.job_timeout", data)
+		} else if err != nil && jobContext(id).Err() != nil {
+			logging.LogfCtx(ctx, "processPDF cancelled: %v", err)
+			jobStore.Update(id, "cancelled", "backend.status.cancelled", data)
+		} else if err != nil {
+			logging.LogfCtx(ctx, "processPDF error: %v, message: %s", err, keyToMessage(msgKey))
 			jobStore.Update(id, "error", msgKey, data)
 		} else {
 			logMsg := keyToMessage(msgKey)
 			if data != nil && data["path"] != "" {
 				logMsg += " -> " + data["path"]
 			}
-			manager.LogfWithUser(user, "processPDF success: %s", logMsg)
+			logging.LogfCtx(ctx, "processPDF success: %s", logMsg)
 			jobStore.Update(id, "success", msgKey, data)
 		}
-	}()
+	})
+}
 
-	return id
+// EnqueueDocumentRequest starts a job for a JSON document request (content or URL)
+// on behalf of userID and returns the job ID. It is shared by every ingestion
+// interface so they all use the same pipeline and status store.
+func EnqueueDocumentRequest(req DocumentRequest, userID uuid.UUID) string {
+	if req.IsContent {
+		return enqueueDocumentJobForUser(req, userID)
+	}
+	return enqueueJobForUser(requestForm(req), userID)
+}
+
+// EnqueueLocalFile starts a job for a file already on disk on behalf of
+// userID, using the options in req, and returns the job ID. The pipeline
+// removes the file once the job finishes.
+func EnqueueLocalFile(path string, req DocumentRequest, source string, userID uuid.UUID) string {
+	req.Body = path
+	form := requestForm(req)
+	form["source"] = source
+	return enqueueJobForUser(form, userID)
+}
+
+// EnqueueURL starts a job fetching the URL in req.Body on behalf of userID,
+// recording source as where the job came from, and returns the job ID
+func EnqueueURL(req DocumentRequest, source string, userID uuid.UUID) string {
+	form := requestForm(req)
+	form["source"] = source
+	return enqueueJobForUser(form, userID)
+}
+
+// requestForm converts a URL or local file request to the form map the
+// pipeline takes
+func requestForm(req DocumentRequest) map[string]string {
+	form := map[string]string{
+		"Body":                req.Body,
+		"prefix":              req.Prefix,
+		"compress":            req.Compress,
+		"compress_preset":     req.CompressPreset,
+		"manage":              req.Manage,
+		"archive":             req.Archive,
+		"archive_pdfa":        req.ArchivePDFA,
+		"rm_dir":              req.RmDir,
+		"retention_days":      req.RetentionDays,
+		"conflict_resolution": req.ConflictResolution,
+		"coverpage":           req.Coverpage,
+		"contrast":            req.Contrast,
+		"currentpage":         req.CurrentPage,
+		"remove_background":   req.RemoveBackground,
+		"outputFormat":        req.OutputFormat,
+		"extract_content":     req.ExtractContent,
+		"upload_timeout":      req.UploadTimeout,
+		"job_timeout":         req.JobTimeout,
+		"verify_sync":         req.VerifySync,
+		"skip_duplicates":     req.SkipDuplicates,
+		"update_policy":       req.UpdatePolicy,
+		"receipt":             req.Receipt,
+		"labels":              req.Labels,
+		"request_id":          req.RequestID,
+		"traceparent":         req.TraceParent,
+	}
+	// Set defaults for empty values
+	if form["compress"] == "" {
+		form["compress"] = "false"
+	}
+	if form["manage"] == "" {
+		form["manage"] = "false"
+	}
+	if form["archive"] == "" {
+		form["archive"] = "false"
+	}
+	if form["retention_days"] == "" {
+		form["retention_days"] = "7"
+	}
+	return form
 }
 
 // EnqueueHandler accepts either form-values (URL-based flow) or JSON (document content flow), enqueues a job, and returns JSON{"jobId": "..."}.
 func EnqueueHandler(c *gin.Context) {
 	// Get user context for multi-user mode
 	var userID uuid.UUID
+	var user *database.User
 	if database.IsMultiUserMode() {
-		user, ok := auth.RequireUser(c)
+		u, ok := auth.RequireUser(c)
 		if !ok {
 			return // auth.RequireUser already set the response
 		}
+		user = u
 		userID = user.ID
 	}
 
+	if rejectDuringMaintenance(c) {
+		return
+	}
+
 	// Check if this is a JSON request with document content
 	contentType := c.GetHeader("Content-Type")
 	if strings.HasPrefix(contentType, "application/json") {
@@ -213,51 +409,41 @@ func EnqueueHandler(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
 			return
 		}
-
-		// Handle document content or URL processing via JSON
-		if req.IsContent {
-			id := enqueueDocumentJobForUser(req, userID)
-			c.JSON(http.StatusAccepted, gin.H{"jobId": id})
-		} else {
-			// JSON URL processing - convert to form map
-			form := map[string]string{
-				"Body":                req.Body,
-				"prefix":              req.Prefix,
-				"compress":            req.Compress,
-				"manage":              req.Manage,
-				"archive":             req.Archive,
-				"rm_dir":              req.RmDir,
-				"retention_days":      req.RetentionDays,
-				"conflict_resolution": req.ConflictResolution,
-				"coverpage":           req.Coverpage,
-				"contrast":            req.Contrast,
-				"currentpage":         req.CurrentPage,
-				"remove_background":   req.RemoveBackground,
-			}
-			// Set defaults for empty values
-			if form["compress"] == "" {
-				form["compress"] = "false"
-			}
-			if form["manage"] == "" {
-				form["manage"] = "false"
-			}
-			if form["archive"] == "" {
-				form["archive"] = "false"
-			}
-			if form["retention_days"] == "" {
-				form["retention_days"] = "7"
-			}
-			id := enqueueJobForUser(form, userID)
-			c.JSON(http.StatusAccepted, gin.H{"jobId": id})
+		req.RequestID = logging.RequestID(c.Request.Context())
+		req.TraceParent = tracing.TraceParent(c.Request.Context())
+		target, ok := onBehalfTarget(c, user, req.UserID)
+		if !ok {
+			return
+		}
+		if rejectUnsupportedOptions(c, target, req.ConflictResolution, req.Coverpage) {
+			return
+		}
+		if rejectInvalidLabels(c, req.Labels) {
+			return
+		}
+		if req.IsContent && rejectTooLarge(c, base64DecodedSize(req.Body), MaxUploadSizeFor(user)) {
+			return
+		}
+		if req.IsContent && rejectBlockedContent(c, target, documentKind(req.Filename, req.ContentType)) {
+			return
+		}
+		if rejectUnderLoad(c, targetID(target, userID)) {
+			return
 		}
+
+		id := EnqueueDocumentRequest(req, targetID(target, userID))
+		auditOnBehalf(c, user, target, id)
+		c.JSON(http.StatusAccepted, gin.H{"jobId": id})
 	} else {
 		// Legacy form-encoded processing (for frontend compatibility)
 		form := map[string]string{
 			"Body":                c.PostForm("Body"),
 			"prefix":              c.PostForm("prefix"),
 			"compress":            c.DefaultPostForm("compress", "false"),
+			"compress_preset":     c.PostForm("compress_preset"),
 			"manage":              c.DefaultPostForm("manage", "false"),
 			"archive":             c.DefaultPostForm("archive", "false"),
+			"archive_pdfa":        c.PostForm("archive_pdfa"),
 			"rm_dir":              c.PostForm("rm_dir"),
 			"retention_days":      c.DefaultPostForm("retention_days", "7"),
 			"conflict_resolution": c.PostForm("conflict_resolution"),
@@ -265,26 +451,98 @@ func EnqueueHandler(c *gin.Context) {
 			"contrast":            c.PostForm("contrast"),
 			"currentpage":         c.PostForm("currentpage"),
 			"remove_background":   c.PostForm("remove_background"),
+			"outputFormat":        c.PostForm("outputFormat"),
+			"extract_content":     c.PostForm("extract_content"),
+			"upload_timeout":      c.PostForm("upload_timeout"),
+			"job_timeout":         c.PostForm("job_timeout"),
+			"verify_sync":         c.PostForm("verify_sync"),
+			"skip_duplicates":     c.PostForm("skip_duplicates"),
+			"update_policy":       c.PostForm("update_policy"),
+			"receipt":             c.PostForm("receipt"),
+			"labels":              c.PostForm("labels"),
 			"source":              "ui",
+			"request_id":          logging.RequestID(c.Request.Context()),
+			"traceparent":         tracing.TraceParent(c.Request.Context()),
+		}
+		target, ok := onBehalfTarget(c, user, c.PostForm("user_id"))
+		if !ok {
+			return
+		}
+		if rejectUnsupportedOptions(c, target, form["conflict_resolution"], form["coverpage"]) {
+			return
+		}
+		if rejectInvalidLabels(c, form["labels"]) {
+			return
+		}
+		if rejectUnderLoad(c, targetID(target, userID)) {
+			return
 		}
-		id := enqueueJobForUser(form, userID)
+		id := enqueueJobForUser(form, targetID(target, userID))
+		auditOnBehalf(c, user, target, id)
 		c.JSON(http.StatusAccepted, gin.H{"jobId": id})
 	}
 }
 
+// rejectDuringMaintenance responds with 503 and returns true while maintenance
+// mode is on, so no new jobs are started
+func rejectDuringMaintenance(c *gin.Context) bool {
+	enabled, reason := maintenance.Status()
+	if !enabled {
+		return false
+	}
+	c.Header("Retry-After", "60")
+	apierror.Respond(c, http.StatusServiceUnavailable, "maintenance_mode",
+		"Aviary is in maintenance mode and not accepting new jobs", gin.H{"reason": reason})
+	return true
+}
+
+// rejectUnsupportedOptions responds with 400 and returns true when the user's
+// reMarkable cloud host doesn't support the requested upload options
+func rejectUnsupportedOptions(c *gin.Context, user *database.User, conflictResolution, coverpage string) bool {
+	err := manager.CheckBackendSupport(user, manager.UploadOptions{
+		ConflictResolution: conflictResolution,
+		Coverpage:          coverpage,
+	})
+	var unsupported *rmapi.UnsupportedError
+	if !errors.As(err, &unsupported) {
+		return false
+	}
+	apierror.Respond(c, http.StatusBadRequest, "backend_unsupported", err.Error(), gin.H{
+		"option": unsupported.Option,
+		"value":  unsupported.Value,
+	})
+	return true
+}
+
 // StatusHandler returns current status & message for a given jobId.
 func StatusHandler(c *gin.Context) {
 	id := c.Param("id")
 	if job, ok := jobStore.Get(id); ok {
 		c.JSON(http.StatusOK, job)
+	} else if status, ok := failedJobStatus(id); ok {
+		c.JSON(http.StatusOK, status)
 	} else {
 		c.JSON(http.StatusNotFound, gin.H{"error": "backend.status.job_not_found"})
 	}
 }
 
+// JobStatus returns the lowercased status of a job, such as "queued",
+// "running", "success", "error" or "cancelled", and false if the job isn't known
+func JobStatus(id string) (string, bool) {
+	job, ok := jobStore.Get(id)
+	if !ok {
+		return "", false
+	}
+	return strings.ToLower(job.Status), true
+}
+
 // StatusWSHandler streams job updates over a WebSocket connection.
 func StatusWSHandler(c *gin.Context) {
-	id := c.Param("id")
+	streamJobStatus(c, c.Param("id"))
+}
+
+// streamJobStatus sends every update for job id over a WebSocket until the job finishes.
+func streamJobStatus(c *gin.Context, id string) {
 	if _, ok := jobStore.Get(id); !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "backend.status.job_not_found"})
 		return
@@ -304,13 +562,108 @@ func StatusWSHandler(c *gin.Context) {
 		if err := wsjson.Write(ctx, conn, job); err != nil {
 			return
 		}
-		if job.Status == "success" || job.Status == "error" {
+		if job.Finished() {
 			conn.Close(websocket.StatusNormalClosure, "done")
 			return
 		}
 	}
 }
 
+// JobsWSHandler streams updates for all of the caller's jobs over a
+// WebSocket, starting with the current state of their unfinished ones. Each
+// message is a job status with its id. Unlike StatusWSHandler the stream
+// stays open after jobs finish, until the client disconnects.
+func JobsWSHandler(c *gin.Context) {
+	userID := uuid.Nil
+	if database.IsMultiUserMode() {
+		user, ok := auth.RequireUser(c)
+		if !ok {
+			return
+		}
+		userID = user.ID
+	}
+
+	conn, err := websocket.Accept(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "internal error")
+
+	ch, unsubscribe := jobStore.SubscribeUser(userID)
+	defer unsubscribe()
+
+	// Nothing is read from the client; this notices when it goes away
+	ctx := conn.CloseRead(c.Request.Context())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-ch:
+			if err := wsjson.Write(ctx, conn, job); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ShareStatusHandler creates a signed, expiring link that lets anyone holding it
+// watch a job's status without an account. The optional ttl query parameter
+// (e.g. "30m", "2h") is capped by STATUS_LINK_MAX_TTL.
+func ShareStatusHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := jobStore.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backend.status.job_not_found"})
+		return
+	}
+
+	ttl := config.GetDuration("STATUS_LINK_TTL", 24*time.Hour)
+	if v := c.Query("ttl"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl"})
+			return
+		}
+		ttl = parsed
+	}
+	if maxTTL := config.GetDuration("STATUS_LINK_MAX_TTL", 7*24*time.Hour); ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	token, expiresAt, err := auth.SignStatusToken(id, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create status link"})
+		return
+	}
+
+	query := "?token=" + url.QueryEscape(token)
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"url":        "/api/public/status/" + id + query,
+		"ws_url":     "/api/public/status/ws/" + id + query,
+		"expires_at": expiresAt,
+	})
+}
+
+// PublicStatusHandler returns a job's status for holders of a signed status link.
+func PublicStatusHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := auth.VerifyStatusToken(id, c.Query("token")); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired status link"})
+		return
+	}
+	StatusHandler(c)
+}
+
+// PublicStatusWSHandler streams a job's status for holders of a signed status link.
+func PublicStatusWSHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := auth.VerifyStatusToken(id, c.Query("token")); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired status link"})
+		return
+	}
+	streamJobStatus(c, id)
+}
+
 // processPDF is the core pipeline: Given a form-map, it either treats form["Body"] as a local file path
 // (if it exists on disk) or else extracts a URL from form["Body"], downloads it, and then proceeds to
 // (optionally) compress, then upload/manage on the reMarkable. Returns a human-readable status message
@@ -326,6 +679,10 @@ func processPDF(jobID string, form map[string]string) (string, map[string]string
 func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (string, map[string]string, error) {
 
 	body := form["Body"]
+	// Several URLs are processed one after another as a batch
+	if urls := batchURLs(body); urls != nil {
+		return processURLBatchForUser(jobID, form, userID, urls)
+	}
 	prefix := form["prefix"]
 	if p, perr := manager.SanitizePrefix(prefix); perr != nil {
 		return "backend.status.invalid_prefix", nil, perr
@@ -341,6 +698,8 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		Coverpage:          form["coverpage"],
 		Contrast:           form["contrast"],
 		CurrentPage:        form["currentpage"],
+		Usage:              jobUsage(jobID),
+		Context:            jobContext(jobID),
 	}
 
 	retentionDays := 7
@@ -360,6 +719,25 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		dbUser, _ = database.NewUserService(database.DB).GetUserByID(userID)
 	}
 
+	// Fail before any work if the reMarkable cloud host can't honor the options
+	if err := manager.CheckBackendSupport(dbUser, uploadOpts); err != nil {
+		return "backend.status.backend_unsupported", nil, err
+	}
+
+	if err := checkQuota(dbUser); err != nil {
+		return "backend.status.quota_exceeded", nil, err
+	}
+
+	uploadTimeout, jobTimeout, err := jobTimeouts(form, dbUser)
+	if err != nil {
+		return "backend.status.invalid_timeout", nil, err
+	}
+	uploadOpts.Timeout = uploadTimeout
+	if jobTimeout > 0 {
+		uploadOpts.Deadline = time.Now().Add(jobTimeout)
+		uploadOpts.Context = setJobDeadline(jobID, uploadOpts.Deadline)
+	}
+
 	// Determine target reMarkable directory
 	rmDir := form["rm_dir"]
 	if rmDir == "" {
@@ -372,16 +750,53 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		}
 	}
 
+	// Let the routing script override the folder, prefix and document name
+	var routedName string
+	// titledName is the name taken from a downloaded document's title
+	var titledName string
+	// A retried upload was already routed
+	if routing.Enabled() && !isTrue(form["retry"]) {
+		route, err := runRoutingScript(form, rmDir, prefix, dbUser)
+		if err != nil {
+			return "backend.status.routing_error", nil, err
+		}
+		if route.RmDir != "" {
+			rmDir = route.RmDir
+			form["rm_dir"] = rmDir
+		}
+		if route.Prefix != "" {
+			p, perr := manager.SanitizePrefix(route.Prefix)
+			if perr != nil {
+				return "backend.status.invalid_prefix", nil, perr
+			}
+			prefix = p
+			form["prefix"] = p
+		}
+		routedName = route.Filename
+	}
+
 	// 1) Handle multiple files if Body starts with "files:"
 	if strings.HasPrefix(body, "files:") {
 		return processMultipleFilesForUser(jobID, form, userID)
 	}
 
+	source := newDocumentSource(form, dbUser)
+	if isTrue(form["retry"]) {
+		source.URL = form["source_url"]
+	}
+	// previous is the last delivery of the same URL, when the job's update
+	// policy compares fetched content against it
+	var previous *database.Document
+
 	// 2) If "Body" is already a valid local file path, skip download.
 	// First validate the path to prevent path injection attacks
 	if secureBodyPath, err := security.NewSecurePathFromExisting(body); err == nil {
 		if fi, statErr := security.SafeStat(secureBodyPath); statErr == nil && !fi.IsDir() {
 			localPath = body
+			source.OriginalFilename = filepath.Base(body)
+			if form["page_url"] != "" {
+				source.URL = form["page_url"]
+			}
 			manager.Logf("processPDF: using local file path %q, skipping download", localPath)
 			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.using_uploaded_file", nil, "processing")
 			// Ensure we delete this file (even on error) once we're done
@@ -393,6 +808,9 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 					}
 				}
 			}()
+			if key, err := checkFilePolicy(dbUser, localPath); err != nil {
+				return key, nil, err
+			}
 		}
 	} else {
 		// 2) Otherwise, extract a URL
@@ -400,18 +818,45 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		if match == "" {
 			return "backend.status.no_url", nil, fmt.Errorf("no URL")
 		}
+		source.URL = match
+		previous = previousDelivery(userID, form, match)
+
+		// Detect content type from URL path extension or HTTP sniffing. Cloud
+		// drive share links always point at a file rather than an article.
+		_, isCloudDrive := clouddrive.Parse(match)
+		contentType := ""
+		if !isCloudDrive {
+			contentType = detectURLContentType(match)
+			if key, err := checkContentPolicy(dbUser, urlKind(contentType)); err != nil {
+				return key, nil, err
+			}
+		}
+		// A downloaded file is checked once it's on disk
+		var downloaded bool
 
-		// Detect content type from URL path extension or HTTP sniffing
-		contentType := detectURLContentType(match)
-
-		if contentType == "application/pdf" || contentType == "application/epub+zip" {
-			// Direct download of PDF/EPUB
+		_, isOffice := converter.OfficeContentTypes[contentType]
+		if isCloudDrive || isOffice || contentType == "application/pdf" || contentType == "application/epub+zip" {
+			// Direct download of PDF/EPUB, or an office document to convert
 			manager.Logf("DownloadPDF: tmp=true, prefix=%q", prefix)
 			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.downloading", nil, "downloading")
-			localPath, err = downloader.DownloadPDFForUser(match, true, prefix, userID, nil)
+			localPath, err = downloader.DownloadPDFForUserContext(uploadOpts.Context, match, true, prefix, userID, downloadProgress(jobID))
+			if errors.Is(err, downloader.ErrCloudDriveNotShared) {
+				return "backend.status.cloud_drive_private", nil, err
+			}
 			if err != nil {
 				return "backend.status.download_error", nil, err
 			}
+			source.OriginalFilename = filepath.Base(localPath)
+			downloaded = true
+
+			// Name unmanaged downloads after the document's own title when
+			// the only name available came from the URL
+			if !manage && routedName == "" && !isCloudDrive && urlDerivedName(source.OriginalFilename, match) {
+				if title := documentTitle(localPath); title != "" {
+					titledName = sanitizeFilename(title)
+					manager.Logf("Using document title for filename: %s", titledName)
+				}
+			}
 		} else if contentType == "text/markdown" || contentType == "text/plain" {
 			// Markdown URL - fetch raw content and convert
 			manager.Logf("Fetching markdown from URL: %s", match)
@@ -432,6 +877,10 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 			if err != nil {
 				return "backend.status.download_error", nil, fmt.Errorf("failed to read markdown: %w", err)
 			}
+			source.Fingerprint = bytesFingerprint(mdBytes)
+			if unchanged(previous, source.Fingerprint) {
+				return unchangedStatus(jobID, previous)
+			}
 
 			mdContent, err := converter.ConvertMarkdownStringToHTML(string(mdBytes))
 			if err != nil {
@@ -477,6 +926,7 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 					pdfOptions = converter.GetPDFOptionsFromConfig()
 				}
 				pdfOptions.Title = title
+				pdfOptions.Usage = jobUsage(jobID)
 				convErr = converter.ConvertHTMLToPDF(mdContent.HTML, convertedPath, pdfOptions)
 			}
 
@@ -485,17 +935,25 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 			}
 
 			localPath = convertedPath
+			source.addConverter("markdown_to_" + outputFormat)
 			manager.Logf("Markdown converted: %s", localPath)
 		} else {
-			// Web article - extract readable content and convert to EPUB/PDF
-			manager.Logf("Extracting article from URL: %s", match)
+			// Web page - extract readable content and convert to EPUB/PDF
+			manager.Logf("Fetching web page: %s", match)
 			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.fetching_url", nil, "fetching")
 
-			// Extract readable content from URL
-			articleContent, extractErr := converter.ExtractFromURL(match)
+			page, pageURL, fetchErr := downloader.FetchPageContext(uploadOpts.Context, match)
+			if fetchErr != nil {
+				return "backend.status.download_error", nil, fmt.Errorf("failed to fetch page: %w", fetchErr)
+			}
+			articleContent, extractErr := pageContent(page, pageURL, form, dbUser)
 			if extractErr != nil {
 				return "backend.status.download_error", nil, fmt.Errorf("failed to extract article: %w", extractErr)
 			}
+			source.Fingerprint = articleFingerprint(articleContent.Title, articleContent.HTML)
+			if unchanged(previous, source.Fingerprint) {
+				return unchangedStatus(jobID, previous)
+			}
 
 			// Determine output format
 			outputFormat := getOutputFormat(form, dbUser)
@@ -536,6 +994,7 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 				}
 				pdfOptions.Title = articleContent.Title
 				pdfOptions.SourceURL = match
+				pdfOptions.Usage = jobUsage(jobID)
 
 				convErr = converter.ConvertHTMLToPDF(articleContent.HTML, convertedPath, pdfOptions)
 			}
@@ -545,6 +1004,7 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 			}
 
 			localPath = convertedPath
+			source.addConverter("article_to_" + outputFormat)
 			manager.Logf("Article converted: %s", localPath)
 		}
 
@@ -559,6 +1019,15 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 				}
 			}
 		}()
+		if downloaded {
+			if key, err := checkFilePolicy(dbUser, localPath); err != nil {
+				return key, nil, err
+			}
+			source.Fingerprint = fileFingerprint(localPath)
+			if unchanged(previous, source.Fingerprint) {
+				return unchangedStatus(jobID, previous)
+			}
+		}
 	}
 
 	// 3) If the file is an image, convert it to PDF now.
@@ -595,6 +1064,31 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 
 		// Replace localPath so the rest of the pipeline uses the PDF
 		localPath = pdfPath
+		source.addConverter("image_to_pdf")
+	}
+
+	// 3.25) Office documents are converted to PDF with LibreOffice
+	if converter.IsOfficeDocument(localPath) {
+		manager.Logf("Detected office document %q – converting to PDF", localPath)
+		jobStore.UpdateWithOperation(jobID, "Running", "backend.status.converting_pdf", nil, "converting")
+		pdfPath, convErr := converter.ConvertOfficeToPDF(localPath)
+		if convErr != nil {
+			return "backend.status.conversion_error", nil, convErr
+		}
+
+		// Schedule cleanup of the generated PDF at the end of processPDF
+		defer func() {
+			if securePdfPath, err := security.NewSecurePathFromExisting(pdfPath); err == nil {
+				if security.SafeStatExists(securePdfPath) {
+					if cleanupErr = security.SafeRemove(securePdfPath); cleanupErr != nil {
+						manager.Logf("cleanup warning (on exit): could not remove generated PDF %q: %v", pdfPath, cleanupErr)
+					}
+				}
+			}
+		}()
+
+		localPath = pdfPath
+		source.addConverter("office_to_pdf")
 	}
 
 	// 3.5) Handle HTML/Markdown conversion to EPUB or PDF
@@ -605,6 +1099,11 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		outputFormat := getOutputFormat(form, dbUser)
 		manager.Logf("Output format: %s", outputFormat)
 
+		var pageURL *url.URL
+		if form["page_url"] != "" {
+			pageURL, _ = url.Parse(form["page_url"])
+		}
+
 		var htmlContent *converter.ArticleContent
 		var title string
 		var convErr error
@@ -629,27 +1128,47 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		} else {
 			// HTML → extract readable content via go-readability
 			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.extracting_article", nil, "extracting")
-			htmlContent, convErr = converter.ExtractFromHTML(localPath)
+			if pageURL != nil || !shouldExtractContent(form, dbUser) {
+				// A page posted by the browser resolves its links against where it came from
+				pageHTML, readErr := os.ReadFile(localPath)
+				if readErr != nil {
+					return "backend.status.conversion_error", nil, fmt.Errorf("failed to read HTML: %w", readErr)
+				}
+				htmlContent, convErr = pageContent(string(pageHTML), pageURL, form, dbUser)
+			} else {
+				htmlContent, convErr = converter.ExtractFromHTML(localPath)
+			}
 			if convErr != nil {
 				return "backend.status.conversion_error", nil, fmt.Errorf("HTML extraction failed: %w", convErr)
 			}
 			title = htmlContent.Title
+			if t := strings.TrimSpace(form["page_title"]); t != "" {
+				title = t
+			}
 			if title == "" {
 				title = strings.TrimSuffix(filepath.Base(localPath), ext)
 			}
 		}
 
-		// Convert to EPUB or PDF based on output format
+		// Convert to EPUB or PDF based on output format. Pages posted by the
+		// browser are named after their title rather than the saved file.
+		outBase := strings.TrimSuffix(localPath, ext)
+		if form["source"] == "html" {
+			outBase = filepath.Join(filepath.Dir(localPath), sanitizeFilename(title))
+		}
 		var convertedPath string
 		if outputFormat == "epub" {
 			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.generating_epub", nil, "generating")
-			epubPath := strings.TrimSuffix(localPath, ext) + ".epub"
+			epubPath := outBase + ".epub"
 
 			epubOptions := converter.EPUBOptions{
 				Title:   title,
 				Author:  htmlContent.Byline,
 				Language: "en",
 			}
+			if pageURL != nil {
+				epubOptions.SourceURL = pageURL.String()
+			}
 
 			convErr = converter.ConvertHTMLToEPUB(htmlContent.HTML, epubPath, epubOptions)
 			if convErr != nil {
@@ -659,7 +1178,7 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		} else {
 			// PDF
 			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.rendering_pdf", nil, "rendering")
-			pdfPath := strings.TrimSuffix(localPath, ext) + ".pdf"
+			pdfPath := outBase + ".pdf"
 
 			var pdfOptions converter.PDFOptions
 			if database.IsMultiUserMode() && dbUser != nil {
@@ -668,6 +1187,10 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 				pdfOptions = converter.GetPDFOptionsFromConfig()
 			}
 			pdfOptions.Title = title
+			pdfOptions.Usage = jobUsage(jobID)
+			if pageURL != nil {
+				pdfOptions.SourceURL = pageURL.String()
+			}
 
 			convErr = converter.ConvertHTMLToPDF(htmlContent.HTML, pdfPath, pdfOptions)
 			if convErr != nil {
@@ -689,9 +1212,35 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 
 		// Replace localPath so the rest of the pipeline uses the converted file
 		localPath = convertedPath
+		if ext == ".md" || ext == ".markdown" {
+			source.addConverter("markdown_to_" + outputFormat)
+		} else {
+			source.addConverter("html_to_" + outputFormat)
+		}
 		manager.Logf("Conversion complete: %s", localPath)
 	}
 
+	// content_only can only replace a PDF's content, so lay out EPUBs as PDFs
+	if epubNeedsPDF(localPath, dbUser, uploadOpts) {
+		manager.Logf("Converting EPUB to PDF for content-only replacement")
+		jobStore.UpdateWithOperation(jobID, "Running", "backend.status.converting_pdf", nil, "converting")
+		pdfPath, convErr := convertEPUBToDevicePDF(jobID, localPath, dbUser)
+		if convErr != nil {
+			return "backend.status.conversion_error", nil, convErr
+		}
+		defer func() {
+			if securePDFPath, err := security.NewSecurePathFromExisting(pdfPath); err == nil {
+				if security.SafeStatExists(securePDFPath) {
+					if cleanupErr = security.SafeRemove(securePDFPath); cleanupErr != nil {
+						manager.Logf("cleanup warning (on exit): could not remove converted PDF %q: %v", pdfPath, cleanupErr)
+					}
+				}
+			}
+		}()
+		localPath = pdfPath
+		source.addConverter("epub_to_pdf")
+	}
+
 	// 4) Optionally remove background images from PDF
 	if shouldRemoveBackground(form, dbUser) && strings.ToLower(filepath.Ext(localPath)) == ".pdf" {
 		manager.Logf("Removing background images from PDF")
@@ -724,12 +1273,27 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		}
 	}
 
-	// 5) Optionally compress the PDF
+	// 5) Optionally compress the PDF, unless it's unlikely to get any smaller.
+	// EPUBs, such as web articles converted to EPUB, are sent as they are.
+	if compress && !strings.EqualFold(filepath.Ext(localPath), ".pdf") {
+		manager.Logf("Skipping compression: %s is not a PDF", filepath.Base(localPath))
+		compress = false
+	}
+	if compress {
+		if reason, skip := compressor.SkipReason(localPath); skip {
+			manager.Logf("Skipping compression: %s", reason)
+			jobStore.UpdateWithOperation(jobID, "Running", "backend.status.compress_skipped", nil, "compressing")
+			compress = false
+		}
+	}
 	if compress {
 		manager.Logf("Compressing PDF")
 		jobStore.UpdateWithOperation(jobID, "Running", "backend.status.compressing_pdf", nil, "compressing")
 		jobStore.UpdateProgress(jobID, 0)
-		compressedPath, compErr := compressor.CompressPDFWithProgress(localPath, func(page, total int) {
+		opts := compressOptions(localPath, form, dbUser)
+		opts.Usage = jobUsage(jobID)
+		opts.Context = uploadOpts.Context
+		compressedPath, compErr := compressor.CompressPDFWithOptions(localPath, opts, func(page, total int) {
 			pct := int(float64(page) / float64(total) * 100)
 			jobStore.UpdateProgress(jobID, pct)
 		})
@@ -761,23 +1325,39 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		localPath = origPath
 	}
 
-	// 6) Rename file for managed workflows
+	// 5.5) Shrink the images in oversized EPUBs
+	if strings.EqualFold(filepath.Ext(localPath), ".epub") {
+		optimizeEPUB(uploadOpts.Context, jobID, localPath, dbUser)
+	}
+
+	// 6) Rename file for managed workflows, to the name chosen by the routing script,
+	// or to the downloaded document's title
 	var finalLocalPath string
+	var newFilename string
+	localExt := filepath.Ext(localPath)
 	if manage {
 		// Create new filename with month and day but no year
 		today := time.Now()
 		month, day := today.Format("January"), today.Day()
 
-		ext := filepath.Ext(localPath)
-		var newFilename string
 		if prefix != "" {
 			manager.Logf("Renaming file for managed workflow with prefix: %s", prefix)
-			newFilename = fmt.Sprintf("%s %s %d%s", prefix, month, day, ext)
+			newFilename = fmt.Sprintf("%s %s %d%s", prefix, month, day, localExt)
 		} else {
 			manager.Logf("Renaming file for managed workflow (no prefix)")
-			newFilename = fmt.Sprintf("%s %d%s", month, day, ext)
+			newFilename = fmt.Sprintf("%s %d%s", month, day, localExt)
+		}
+	} else if routedName != "" {
+		manager.Logf("Renaming file to routed name: %s", routedName)
+		newFilename = routedName
+		if !strings.EqualFold(filepath.Ext(routedName), localExt) {
+			newFilename += localExt
 		}
+	} else if titledName != "" {
+		newFilename = titledName + localExt
+	}
 
+	if newFilename != "" {
 		// Create renamed file in same directory as original
 		dir := filepath.Dir(localPath)
 		finalLocalPath = filepath.Join(dir, newFilename)
@@ -809,52 +1389,75 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 		finalLocalPath = localPath
 	}
 
+	// Run the pre-upload hook, which may modify the file in place
+	if hooks.Enabled(hooks.StagePreUpload) {
+		jobStore.UpdateWithOperation(jobID, "Running", "backend.status.running_hook", nil, "processing")
+		if err := runUploadHook(hooks.StagePreUpload, jobID, finalLocalPath, rmDir, "", form, dbUser); err != nil && hooks.FailurePolicy() == hooks.PolicyAbort {
+			return "backend.status.hook_error", nil, err
+		}
+	}
+
+	// Skip files the user already sent to this folder
+	if database.IsMultiUserMode() && skipDuplicatesEnabled(form["skip_duplicates"]) {
+		if dup := findDuplicate(userID, finalLocalPath, rmDir); dup != nil {
+			manager.Logf("Skipping upload: identical to %s uploaded %s", dup.RemotePath, dup.UploadDate.Format(time.RFC3339))
+			jobStore.UpdateProgress(jobID, 100)
+			return "backend.status.duplicate_skipped", map[string]string{
+				"path":        strings.TrimPrefix(dup.RemotePath, "/"),
+				"document_id": dup.ID.String(),
+			}, nil
+		}
+	}
+
+	// Conversion can't be interrupted, so stop here if the job was cancelled
+	if err := uploadOpts.Context.Err(); err != nil {
+		return "backend.status.cancelled", nil, err
+	}
+
 	// 5) Upload to rmapi
 	jobStore.UpdateWithOperation(jobID, "Running", "backend.status.uploading", nil, "uploading")
 	manager.Logf("Uploading to reMarkable")
 	remoteName, err = manager.SimpleUpload(finalLocalPath, rmDir, dbUser, uploadOpts)
 	if err != nil {
+		msgKey, data := "backend.status.internal_error", map[string]string(nil)
 		if isConflictError(err) {
-			return "backend.status.conflict_entry_exists", map[string]string{
+			msgKey, data = "backend.status.conflict_entry_exists", map[string]string{
 				"conflict_resolution": "settings.labels.conflict_resolution",
 				"settings":            "app.settings",
-			}, err
+			}
+		} else if key := timeoutStatus(err); key != "" {
+			msgKey = key
+		}
+		if errors.Is(err, context.Canceled) {
+			return msgKey, data, err
 		}
-		return "backend.status.internal_error", nil, err
+		// Keep the processed file so the upload can be retried
+		data = stageFailedUpload(jobID, userID, form, finalLocalPath, source.URL, msgKey, data, err)
+		return msgKey, data, err
 	}
 
-	// 6) Archive to storage backend if requested
+	// Post-upload hook failures are logged but can't undo the upload
+	runUploadHook(hooks.StagePostUpload, jobID, finalLocalPath, rmDir, remoteName, form, dbUser)
+
+	// A put that reports success can still be lost cloud-side; the failure is
+	// reported once the document is recorded as unverified
+	syncErr := source.verifySync(jobID, form, remoteName, rmDir, dbUser)
+
+	// 6) Archive to storage backend if requested. A failed copy doesn't fail
+	// the job; it's kept to be retried once the document is recorded.
+	var failedArchivePath string
 	if archive {
 		manager.Logf("Archiving to storage backend")
-		filename := filepath.Base(finalLocalPath)
-		multiUserMode := database.IsMultiUserMode()
-
-		var storageKey string
-		if manage {
-			// For managed files, use no-year format first, then add year for archival
-			noYearKey := storage.GenerateUserDocumentKey(userID, prefix, filename, multiUserMode)
-
-			// Copy to storage with no-year format
-			ctx := context.Background()
-			if err := storage.CopyFileToStorage(ctx, finalLocalPath, noYearKey); err != nil {
-				manager.Logf("archival warning: failed to copy to storage: %v", err)
-			} else {
-				// Add year for archival copy
-				if yearKey, err2 := manager.AppendYearStorage(ctx, noYearKey, userID); err2 != nil {
-					manager.Logf("archival warning: failed to create year copy: %v", err2)
-				} else {
-					storageKey = yearKey
-				}
-			}
+		archivePath, removeArchiveCopy := archiveSource(jobID, finalLocalPath, form)
+		defer removeArchiveCopy()
+		key, sum, err := archiveFile(context.Background(), userID, archivePath, filepath.Base(finalLocalPath), prefix, manage)
+		if err != nil {
+			manager.Logf("archival warning: failed to copy to storage: %v", err)
+			source.ArchiveStatus, source.ArchiveError = database.ArchiveStatusFailed, truncate(err.Error(), 1000)
+			failedArchivePath = archivePath
 		} else {
-			// For non-managed files, archive as-is
-			storageKey = storage.GenerateUserDocumentKey(userID, "", filename, multiUserMode)
-			ctx := context.Background()
-			if err := storage.CopyFileToStorage(ctx, finalLocalPath, storageKey); err != nil {
-				manager.Logf("archival warning: failed to copy to storage: %v", err)
-			}
+			source.ArchiveKey, source.ArchiveHash, source.ArchiveStatus = key, sum, database.ArchiveStatusArchived
 		}
-
 	}
 
 	// 7) If manage==true, perform cleanup
@@ -865,12 +1468,27 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 	}
 
 	// 8) Track document in database if in multi-user mode
+	var documentID uuid.UUID
 	if database.IsMultiUserMode() && userID != uuid.Nil {
-		if err := trackDocumentUpload(userID, finalLocalPath, remoteName, rmDir); err != nil {
+		if documentID, err = trackDocumentUpload(userID, finalLocalPath, remoteName, rmDir, source); err != nil {
 			manager.Logf("failed to track document upload: %v", err)
 			// Continue anyway - the upload was successful
+		} else {
+			go notifyQuotaUsage(dbUser)
+			if failedArchivePath != "" {
+				stageArchiveRetry(documentID, userID, failedArchivePath, filepath.Base(finalLocalPath), prefix, manage)
+			}
 		}
 	}
+	if syncErr == nil {
+		sendto.Deliver(userID, finalLocalPath)
+	}
+	if syncErr != nil {
+		return "backend.status.sync_unverified", nil, syncErr
+	}
+	if updatePolicy(form) == UpdateReplace {
+		replacePrevious(previous, rmDir, remoteName, dbUser)
+	}
 
 	// 9) Now that the file has been uploaded to the reMarkable, build final status message
 	fullPath := filepath.Join(rmDir, remoteName)
@@ -886,6 +1504,7 @@ func processPDFForUser(jobID string, form map[string]string, userID uuid.UUID) (
 			data["download_token"] = token
 		}
 	}
+	addReceipt(jobID, form, dbUser, rmDir, []receipt.Document{receiptDocument(documentID, finalLocalPath, rmDir, remoteName, source)}, data)
 
 	return "backend.status.upload_success", data, nil
 }
@@ -903,32 +1522,69 @@ func enqueueDocumentJobForUser(req DocumentRequest, userID uuid.UUID) string {
 	// Create a new job in the in-memory store
 	id := uuid.NewString()
 	jobStore.Create(id)
+	jobStore.SetOwner(id, userID)
+	jobStore.SetRequestID(id, req.RequestID)
+
+	// Hold the job until storage and rmapi are healthy again
+	if degraded.Active() && queueJob(id, userID, nil, &req) {
+		return id
+	}
+	if w, closed := windowClosed(queuedJobUser(userID)); closed && holdForWindow(id, userID, nil, &req, w) {
+		return id
+	}
+
+	startDocumentJob(id, req, userID)
+	return id
+}
 
-	// Launch background worker
-	go func() {
+// startDocumentJob runs processDocumentForUser for an existing job ID in a goroutine
+func startDocumentJob(id string, req DocumentRequest, userID uuid.UUID) {
+	jobDone := maintenance.TrackJob(userID)
+
+	// Run in the job pool once a worker is free
+	runJob(id, userID, jobs.PriorityNormal, func() {
+		defer jobDone()
+		beginJobContext(id)
+		defer endJobContext(id)
+		if status, _ := JobStatus(id); status == "cancelled" {
+			return
+		}
 		jobStore.Update(id, "Running", "", nil)
 		jobStore.UpdateProgress(id, 0)
+		ctx := jobLogContext(id, queuedJobUser(userID))
 
 		// Catch panics
 		defer func() {
+			endJobUsage(id)
 			if r := recover(); r != nil {
-				manager.Logf("Panic in processDocument: %v", r)
+				logging.LogfCtx(ctx, "Panic in processDocument: %v", r)
 				jobStore.Update(id, "Error", "backend.status.internal_error", nil)
 			}
 		}()
 
 		// Process the document content
+		endTrace := traceJob(id, "job", req.TraceParent)
 		msgKey, data, err := processDocumentForUser(id, req, userID)
-		if err != nil {
-			manager.Logf("processDocument error: %v, message: %q", err, msgKey)
+		endTrace(err)
+		telemetry.RecordJob(err)
+		if usage := endJobUsage(id); usage != nil {
+			logging.LogfCtx(ctx, "processDocument resource usage: %s", usageSummary(usage))
+			data = withUsage(data, usage)
+		}
+		if err != nil && jobTimedOut(id) {
+			logging.LogfCtx(ctx, "processDocument timed out: %v", err)
+			jobStore.Update(id, "error", "backend.status.job_timeout", data)
+		} else if err != nil && jobContext(id).Err() != nil {
+			logging.LogfCtx(ctx, "processDocument cancelled: %v", err)
+			jobStore.Update(id, "cancelled", "backend.status.cancelled", data)
+		} else if err != nil {
+			logging.LogfCtx(ctx, "processDocument error: %v, message: %q", err, msgKey)
 			jobStore.Update(id, "error", msgKey, data)
 		} else {
-			manager.Logf("processDocument success: %s", msgKey)
+			logging.LogfCtx(ctx, "processDocument success: %s", msgKey)
 			jobStore.Update(id, "success", msgKey, data)
 		}
-	}()
-
-	return id
+	})
 }
 
 // processDocument handles document content processing
@@ -991,6 +1647,10 @@ func processDocumentForUser(jobID string, req DocumentRequest, userID uuid.UUID)
 			filename += ".png"
 		case strings.HasPrefix(contentTypeToUse, "application/epub"):
 			filename += ".epub"
+		default:
+			if ext, ok := converter.OfficeContentTypes[contentTypeToUse]; ok {
+				filename += ext
+			}
 		}
 	}
 
@@ -1015,8 +1675,10 @@ func processDocumentForUser(jobID string, req DocumentRequest, userID uuid.UUID)
 		"Body":                tempFilePath,
 		"prefix":              req.Prefix,
 		"compress":            req.Compress,
+		"compress_preset":     req.CompressPreset,
 		"manage":              req.Manage,
 		"archive":             req.Archive,
+		"archive_pdfa":        req.ArchivePDFA,
 		"rm_dir":              req.RmDir,
 		"retention_days":      req.RetentionDays,
 		"conflict_resolution": req.ConflictResolution,
@@ -1024,6 +1686,15 @@ func processDocumentForUser(jobID string, req DocumentRequest, userID uuid.UUID)
 		"contrast":            req.Contrast,
 		"currentpage":         req.CurrentPage,
 		"remove_background":   req.RemoveBackground,
+		"outputFormat":        req.OutputFormat,
+		"extract_content":     req.ExtractContent,
+		"upload_timeout":      req.UploadTimeout,
+		"job_timeout":         req.JobTimeout,
+		"verify_sync":         req.VerifySync,
+		"skip_duplicates":     req.SkipDuplicates,
+		"update_policy":       req.UpdatePolicy,
+		"receipt":             req.Receipt,
+		"labels":              req.Labels,
 	}
 
 	// Set defaults for empty values
@@ -1077,6 +1748,9 @@ func isContentTypeMatch(claimed, detected string) bool {
 	case strings.HasPrefix(claimed, "application/epub") && strings.HasPrefix(detected, "application/zip"):
 		// EPUB files are detected as application/zip
 		return true
+	case converter.OfficeContentTypes[claimed] != "" && strings.HasPrefix(detected, "application/zip"):
+		// So are .docx, .odt and .pptx files
+		return true
 	default:
 		return strings.HasPrefix(detected, claimed) || strings.HasPrefix(claimed, detected)
 	}
@@ -1104,7 +1778,7 @@ func sanitizeFilename(title string) string {
 		return "article"
 	}
 
-	name := strings.TrimSpace(title)
+	name := strings.TrimSpace(transliterate(title))
 	name = invalidFilenameChars.ReplaceAllString(name, "_")
 	name = strings.ReplaceAll(name, "  ", " ")
 
@@ -1122,6 +1796,29 @@ func sanitizeFilename(title string) string {
 	return name
 }
 
+// shouldExtractContent reports whether web pages are reduced to their
+// readable article, from the request, then the user's setting, then
+// EXTRACT_CONTENT
+func shouldExtractContent(form map[string]string, dbUser *database.User) bool {
+	if val := form["extract_content"]; val != "" {
+		return isTrue(val)
+	}
+	if dbUser != nil && dbUser.ExtractContent != nil {
+		return *dbUser.ExtractContent
+	}
+	return config.GetBool("EXTRACT_CONTENT", true)
+}
+
+// pageContent returns the content of a web page to convert: its readable
+// article, or the whole page when extraction is off for the job
+func pageContent(page string, pageURL *url.URL, form map[string]string, dbUser *database.User) (*converter.ArticleContent, error) {
+	if shouldExtractContent(form, dbUser) {
+		return converter.ExtractFromHTMLString(page, pageURL)
+	}
+	manager.Logf("Content extraction off, keeping the whole page")
+	return converter.PageFromHTMLString(page, pageURL)
+}
+
 // getOutputFormat determines the output format (pdf or epub) based on:
 // 1. Request parameter override (outputFormat in form)
 // 2. User's per-user setting (if multi-user mode)
@@ -1145,6 +1842,34 @@ func getOutputFormat(form map[string]string, dbUser *database.User) string {
 	return config.GetConversionOutputFormat()
 }
 
+// epubNeedsPDF reports whether an EPUB should be laid out as a PDF before
+// upload. rmapi can only replace the content of PDF documents, so with
+// content_only conflict resolution recurring EPUBs are sent as PDFs and keep
+// their annotations when they are refreshed.
+func epubNeedsPDF(path string, dbUser *database.User, opts manager.UploadOptions) bool {
+	if strings.ToLower(filepath.Ext(path)) != ".epub" || !config.GetBool("EPUB_CONTENT_ONLY_CONVERT", true) {
+		return false
+	}
+	// Offline delivery replaces the whole document either way
+	if delivery.ForUser(dbUser).Offline() {
+		return false
+	}
+	return manager.RequestedConflictResolution(dbUser, opts) == "content_only"
+}
+
+// convertEPUBToDevicePDF lays out an EPUB as a PDF at the user's page
+// resolution and DPI
+func convertEPUBToDevicePDF(jobID, path string, dbUser *database.User) (string, error) {
+	var pdfOptions converter.PDFOptions
+	if database.IsMultiUserMode() && dbUser != nil {
+		pdfOptions = converter.GetPDFOptionsForUser(dbUser.PageResolution, dbUser.PageDPI)
+	} else {
+		pdfOptions = converter.GetPDFOptionsFromConfig()
+	}
+	pdfOptions.Usage = jobUsage(jobID)
+	return converter.ConvertEPUBToPDF(path, pdfOptions)
+}
+
 func shouldOfferDownloadLink(dbUser *database.User) bool {
 	if dbUser != nil && dbUser.ExperimentalDownloadLink != nil {
 		return *dbUser.ExperimentalDownloadLink
@@ -1177,6 +1902,11 @@ func detectURLContentType(urlStr string) string {
 		case ".md", ".markdown":
 			return "text/markdown"
 		}
+		for mime, officeExt := range converter.OfficeContentTypes {
+			if ext == officeExt {
+				return mime
+			}
+		}
 	}
 
 	if mime, err := downloader.SniffMime(urlStr); err == nil {
@@ -1186,18 +1916,90 @@ func detectURLContentType(urlStr string) string {
 	return "text/html"
 }
 
-// trackDocumentUpload records a document upload in the database
-func trackDocumentUpload(userID uuid.UUID, localPath, remoteName, rmDir string) error {
+// runRoutingScript evaluates ROUTING_SCRIPT for the request in form
+func runRoutingScript(form map[string]string, rmDir, prefix string, dbUser *database.User) (routing.Result, error) {
+	body := form["Body"]
+	in := routing.Input{
+		RmDir:  rmDir,
+		Prefix: prefix,
+		Manage: isTrue(form["manage"]),
+		Fields: make(map[string]string, len(form)),
+	}
+	for k, v := range form {
+		if k != "Body" && v != "" {
+			in.Fields[k] = v
+		}
+	}
+	if isURL(body) {
+		in.URL = body
+		if u, err := url.Parse(body); err == nil && strings.Trim(u.Path, "/") != "" {
+			in.Filename = path.Base(u.Path)
+		}
+	} else if !strings.HasPrefix(body, "files:") {
+		in.Filename = filepath.Base(body)
+	}
+	if dbUser != nil {
+		in.Username = dbUser.Username
+	}
+
+	route, err := routing.Evaluate(in)
+	if err != nil {
+		return route, err
+	}
+	if route != (routing.Result{}) {
+		manager.LogfWithUser(dbUser, "Routing script result: rm_dir=%q prefix=%q filename=%q", route.RmDir, route.Prefix, route.Filename)
+	}
+	return route, nil
+}
+
+// runUploadHook runs the hook for stage on a single file, passing the job's
+// form fields (other than the raw body) as metadata. The hook is stopped with
+// the job.
+func runUploadHook(stage, jobID, filePath, rmDir, remoteName string, form map[string]string, dbUser *database.User) error {
+	metadata := make(map[string]string, len(form))
+	for k, v := range form {
+		if k != "Body" && v != "" {
+			metadata[k] = v
+		}
+	}
+	if isURL(form["Body"]) {
+		metadata["source_url"] = form["Body"]
+	}
+
+	ev := hooks.Event{
+		Stage:      stage,
+		JobID:      jobID,
+		FilePath:   filePath,
+		RmDir:      rmDir,
+		RemoteName: remoteName,
+		Metadata:   metadata,
+	}
+	if dbUser != nil {
+		ev.Username = dbUser.Username
+		ev.UserID = dbUser.ID.String()
+	}
+	return hooks.Run(jobContext(jobID), ev)
+}
+
+// trackDocumentUpload records a document upload in the database and returns
+// the new Document's ID
+func trackDocumentUpload(userID uuid.UUID, localPath, remoteName, rmDir string, source documentSource) (uuid.UUID, error) {
 	if database.DB == nil {
-		return nil // Database not initialized
+		return uuid.Nil, nil // Database not initialized
 	}
 
 	// Get file info
 	var fileSize int64
+	var contentHash string
 	if secureLocalPath, err := security.NewSecurePathFromExisting(localPath); err == nil {
 		if info, err := security.SafeStat(secureLocalPath); err == nil {
 			fileSize = info.Size()
 		}
+		if hash, err := fileSHA256(secureLocalPath); err == nil {
+			contentHash = hash
+		} else {
+			manager.Logf("could not hash %q: %v", localPath, err)
+		}
 	}
 
 	// Determine document type from extension
@@ -1226,9 +2028,32 @@ func trackDocumentUpload(userID uuid.UUID, localPath, remoteName, rmDir string)
 		DocumentType: docType,
 		FileSize:     fileSize,
 		Status:       "uploaded",
-	}
 
-	return database.DB.Create(&doc).Error
+		SourceURL:         source.URL,
+		Fingerprint:       source.Fingerprint,
+		OriginalFilename:  source.OriginalFilename,
+		ContentHash:       contentHash,
+		Converter:         strings.Join(source.Converters, ","),
+		ProcessingOptions: source.optionsJSON(),
+		SyncStatus:        source.SyncStatus,
+		VerifiedAt:        source.VerifiedAt,
+		Environment:       source.Environment.JSON(),
+		Labels:            database.LabelsJSON(source.Labels),
+		ArchiveKey:        source.ArchiveKey,
+		ArchiveHash:       source.ArchiveHash,
+		ArchiveStatus:     source.ArchiveStatus,
+		ArchiveError:      source.ArchiveError,
+	}
+	if doc.ArchiveHash != "" {
+		now := time.Now()
+		doc.ArchiveVerifiedAt = &now
+	}
+
+	if err := database.DB.Create(&doc).Error; err != nil {
+		return uuid.Nil, err
+	}
+	database.RecordOnboarding(userID, database.OnboardingFirstUpload)
+	return doc.ID, nil
 }
 
 // processMultipleFilesForUser handles processing multiple files uploaded together
@@ -1241,6 +2066,8 @@ func processMultipleFilesForUser(jobID string, form map[string]string, userID uu
 		Coverpage:          form["coverpage"],
 		Contrast:           form["contrast"],
 		CurrentPage:        form["currentpage"],
+		Usage:              jobUsage(jobID),
+		Context:            jobContext(jobID),
 	}
 
 	// Extract file paths from the "files:" prefix
@@ -1258,17 +2085,37 @@ func processMultipleFilesForUser(jobID string, form map[string]string, userID uu
 	}
 
 	var (
-		dbUser         *database.User
-		finalPaths     []string
-		totalPages     int
-		processedPages int
-		cleanupPaths   []string
+		dbUser       *database.User
+		finalPaths   []string
+		finalSources []documentSource
+		totalPages   int
+		cleanupPaths []string
 	)
 
 	if database.IsMultiUserMode() && userID != uuid.Nil {
 		dbUser, _ = database.NewUserService(database.DB).GetUserByID(userID)
 	}
 
+	if err := checkQuota(dbUser); err != nil {
+		return "backend.status.quota_exceeded", nil, err
+	}
+
+	for _, filePath := range filePaths {
+		if key, err := checkFilePolicy(dbUser, filePath); err != nil {
+			return key, nil, err
+		}
+	}
+
+	uploadTimeout, jobTimeout, err := jobTimeouts(form, dbUser)
+	if err != nil {
+		return "backend.status.invalid_timeout", nil, err
+	}
+	uploadOpts.Timeout = uploadTimeout
+	if jobTimeout > 0 {
+		uploadOpts.Deadline = time.Now().Add(jobTimeout)
+		uploadOpts.Context = setJobDeadline(jobID, uploadOpts.Deadline)
+	}
+
 	// Determine target reMarkable directory
 	rmDir := form["rm_dir"]
 	if rmDir == "" {
@@ -1322,6 +2169,8 @@ func processMultipleFilesForUser(jobID string, form map[string]string, userID uu
 	// Process each file in the reordered list
 	for _, filePath := range orderedPaths {
 		cleanupPaths = append(cleanupPaths, filePath)
+		source := newDocumentSource(form, dbUser)
+		source.OriginalFilename = filepath.Base(filePath)
 
 		// Convert images to PDF if needed
 		ext := strings.ToLower(filepath.Ext(filePath))
@@ -1341,68 +2190,68 @@ func processMultipleFilesForUser(jobID string, form map[string]string, userID uu
 			}
 			cleanupPaths = append(cleanupPaths, pdfPath)
 			filePath = pdfPath
+			source.addConverter("image_to_pdf")
 		}
-
-		// Compress PDF if requested and file is PDF
-		if compress && (strings.ToLower(filepath.Ext(filePath)) == ".pdf") {
-			manager.Logf("Compressing PDF %q", filePath)
-
-			// Get the expected page count for this file from our pre-calculation
-			expectedPages := 1 // fallback
-			if pages, err := compressor.GetPDFPageCount(filePath); err == nil {
-				expectedPages = pages
+		if converter.IsOfficeDocument(filePath) {
+			manager.Logf("Converting office document %q to PDF", filePath)
+			pdfPath, convErr := converter.ConvertOfficeToPDF(filePath)
+			if convErr != nil {
+				secureCleanupPaths(cleanupPaths)
+				return "backend.status.conversion_error", nil, convErr
 			}
+			cleanupPaths = append(cleanupPaths, pdfPath)
+			filePath = pdfPath
+			source.addConverter("office_to_pdf")
+		}
 
-			compressedPath, compErr := compressor.CompressPDFWithProgress(filePath, func(page, total int) {
-				// Calculate overall progress: (all previously processed pages + current progress within this file) / total pages
-				if totalPages > 0 && total > 0 {
-					// Current progress within this file as a fraction of its total pages
-					fileProgressPages := float64(page*expectedPages) / float64(total)
-					overallProgress := int((float64(processedPages) + fileProgressPages) / float64(totalPages) * 100)
-					jobStore.UpdateProgress(jobID, overallProgress)
-				}
-			})
-			if compErr != nil {
-				// Clean up any processed files before returning error
+		// content_only can only replace a PDF's content, so lay out EPUBs as PDFs
+		if epubNeedsPDF(filePath, dbUser, uploadOpts) {
+			manager.Logf("Converting EPUB %q to PDF for content-only replacement", filePath)
+			pdfPath, convErr := convertEPUBToDevicePDF(jobID, filePath, dbUser)
+			if convErr != nil {
 				secureCleanupPaths(cleanupPaths)
-				return "backend.status.compress_error", nil, compErr
+				return "backend.status.conversion_error", nil, convErr
 			}
+			cleanupPaths = append(cleanupPaths, pdfPath)
+			filePath = pdfPath
+			source.addConverter("epub_to_pdf")
+		}
+		if strings.EqualFold(filepath.Ext(filePath), ".epub") {
+			optimizeEPUB(uploadOpts.Context, jobID, filePath, dbUser)
+		}
 
-			// Update processed pages count with the expected pages for this file
-			processedPages += expectedPages
+		finalPaths = append(finalPaths, filePath)
+		finalSources = append(finalSources, source)
+	}
 
-			// Remove uncompressed version
-			if secureFilePath, err := security.NewSecurePathFromExisting(filePath); err == nil {
-				security.SafeRemove(secureFilePath)
-			}
-			cleanupPaths = append(cleanupPaths, compressedPath)
+	// Compress the PDFs once everything is converted
+	if compress {
+		status, compErr := compressFiles(jobID, form, dbUser, finalPaths, totalPages)
+		cleanupPaths = append(cleanupPaths, finalPaths...)
+		if compErr != nil {
+			secureCleanupPaths(cleanupPaths)
+			return status, nil, compErr
+		}
+	}
 
-			// Rename compressed file to remove "_compressed" suffix (to match single file flow)
-			origPath := strings.TrimSuffix(compressedPath, "_compressed.pdf") + ".pdf"
-			secureCompressedPath, compErr := security.NewSecurePathFromExisting(compressedPath)
-			secureOrigPath, origErr := security.NewSecurePathFromExisting(origPath)
-			if compErr != nil || origErr != nil || security.SafeRename(secureCompressedPath, secureOrigPath) != nil {
-				// Clean up any processed files before returning error
+	// Run the pre-upload hook on every file before anything is uploaded
+	if hooks.Enabled(hooks.StagePreUpload) {
+		jobStore.UpdateWithOperation(jobID, "Running", "backend.status.running_hook", nil, "processing")
+		for _, filePath := range finalPaths {
+			if err := runUploadHook(hooks.StagePreUpload, jobID, filePath, rmDir, "", form, dbUser); err != nil && hooks.FailurePolicy() == hooks.PolicyAbort {
 				secureCleanupPaths(cleanupPaths)
-				return "backend.status.rename_error", nil, fmt.Errorf("failed to rename compressed file")
+				return "backend.status.hook_error", nil, err
 			}
-
-			// Update cleanup paths and file path
-			cleanupPaths[len(cleanupPaths)-1] = origPath // Replace the last entry
-			filePath = origPath
-		} else if compress {
-			// For non-PDF files (images), still increment processed pages to keep progress accurate
-			processedPages += 1
 		}
-
-		finalPaths = append(finalPaths, filePath)
 	}
 
 	// Upload all processed files
 	var uploadedPaths []string
+	var receiptDocs []receipt.Document
+	var syncErr error
 	jobStore.UpdateWithOperation(jobID, "Running", "backend.status.uploading", nil, "uploading")
 
-	for _, filePath := range finalPaths {
+	for i, filePath := range finalPaths {
 		// Use simple upload for each file
 		remoteName, err := manager.SimpleUpload(filePath, rmDir, dbUser, uploadOpts)
 		if err != nil {
@@ -1414,19 +2263,38 @@ func processMultipleFilesForUser(jobID string, form map[string]string, userID uu
 					"settings":            "app.settings",
 				}, err
 			}
+			if key := timeoutStatus(err); key != "" {
+				return key, nil, err
+			}
 			return "backend.status.internal_error", nil, err
 		}
 
+		runUploadHook(hooks.StagePostUpload, jobID, filePath, rmDir, remoteName, form, dbUser)
+
+		if err := finalSources[i].verifySync(jobID, form, remoteName, rmDir, dbUser); err != nil && syncErr == nil {
+			syncErr = err
+		}
+
 		fullPath := filepath.Join(rmDir, remoteName)
 		fullPath = strings.TrimPrefix(fullPath, "/")
 		uploadedPaths = append(uploadedPaths, fullPath)
 
 		// Track document in database if in multi-user mode
+		var documentID uuid.UUID
 		if database.IsMultiUserMode() && userID != uuid.Nil {
-			if err := trackDocumentUpload(userID, filePath, remoteName, rmDir); err != nil {
+			if documentID, err = trackDocumentUpload(userID, filePath, remoteName, rmDir, finalSources[i]); err != nil {
 				manager.Logf("failed to track document upload: %v", err)
 			}
 		}
+		sendto.Deliver(userID, filePath)
+		receiptDocs = append(receiptDocs, receiptDocument(documentID, filePath, rmDir, remoteName, finalSources[i]))
+	}
+	if database.IsMultiUserMode() && userID != uuid.Nil {
+		go notifyQuotaUsage(dbUser)
+	}
+	if syncErr != nil {
+		secureCleanupPaths(cleanupPaths)
+		return "backend.status.sync_unverified", nil, syncErr
 	}
 
 	var downloadTokens []string
@@ -1463,6 +2331,7 @@ func processMultipleFilesForUser(jobID string, form map[string]string, userID uu
 			data["download_tokens"] = string(tokensJSON)
 		}
 	}
+	addReceipt(jobID, form, dbUser, rmDir, receiptDocs, data)
 
 	jobStore.UpdateProgress(jobID, 100)
 	return "backend.status.upload_success_multiple", data, nil
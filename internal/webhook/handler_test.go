@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/rmitchellscott/aviary/internal/compressor"
+	"github.com/rmitchellscott/aviary/internal/contentpolicy"
 	"github.com/rmitchellscott/aviary/internal/manager"
 	"github.com/rmitchellscott/aviary/internal/rmapi"
 )
@@ -107,3 +108,130 @@ func TestProcessPDFRmapiCommands(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessPDFHTMLAsEPUB(t *testing.T) {
+	t.Setenv("PDF_DIR", t.TempDir())
+	t.Setenv("CONVERSION_OUTPUT_FORMAT", "pdf")
+
+	tmpDir := t.TempDir()
+	input := filepath.Join(tmpDir, "input.html")
+	page := `<html><head><title>Article</title></head><body><article><h1>Article</h1>` +
+		strings.Repeat("<p>Some readable paragraph text for the article body.</p>", 20) +
+		`</article></body></html>`
+	if err := os.WriteFile(input, []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cmds, compCmds [][]string
+	mgrOrig := manager.ExecCommand
+	compOrig := compressor.ExecCommand
+	rmapiOrig := rmapi.ExecCommand
+	manager.ExecCommand = stubCommand(&cmds)
+	compressor.ExecCommand = stubCommand(&compCmds)
+	rmapi.ExecCommand = stubCommand(&cmds)
+	defer func() {
+		manager.ExecCommand = mgrOrig
+		compressor.ExecCommand = compOrig
+		rmapi.ExecCommand = rmapiOrig
+	}()
+
+	// The request asks for EPUB over the configured PDF, and EPUBs aren't compressed
+	form := map[string]string{
+		"Body":           input,
+		"compress":       "true",
+		"manage":         "false",
+		"archive":        "false",
+		"rm_dir":         "/Articles",
+		"retention_days": "7",
+		"outputFormat":   "epub",
+	}
+	if _, _, err := processPDF("testjob", form); err != nil {
+		t.Fatalf("processPDF error: %v", err)
+	}
+
+	expect := [][]string{{"rmapi", "put", filepath.Join(tmpDir, "input.epub"), "/Articles"}}
+	if !reflect.DeepEqual(cmds, expect) {
+		t.Fatalf("commands mismatch:\n got  %v\n want %v", cmds, expect)
+	}
+	if len(compCmds) != 0 {
+		t.Fatalf("EPUB was compressed: %v", compCmds)
+	}
+}
+
+func TestBatchURLs(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"https://a.example/1.pdf", nil},
+		{"https://a.example/1.pdf\nhttps://b.example/2\n", []string{"https://a.example/1.pdf", "https://b.example/2"}},
+		{"https://a.example/1.pdf\r\n\r\nhttps://a.example/1.pdf\r\nhttps://b.example/2", []string{"https://a.example/1.pdf", "https://b.example/2"}},
+		{`["https://a.example/1.pdf", "https://b.example/2"]`, []string{"https://a.example/1.pdf", "https://b.example/2"}},
+		{"Read https://a.example/1 and https://b.example/2", nil},
+		{"https://a.example/1\nnot a url", nil},
+	}
+	for _, tt := range tests {
+		if got := batchURLs(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("batchURLs(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestURLListFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"list.txt", "# exported\nhttps://a.example/1\n\nhttps://b.example/2\nhttps://a.example/1\n", []string{"https://a.example/1", "https://b.example/2"}},
+		{"notes.txt", "https://a.example/1\nsome notes\n", nil},
+		{"pocket.csv", "title,url,time_added\n\"A, title\",https://a.example/1,1700000000\nB,https://b.example/2,1700000001\n", []string{"https://a.example/1", "https://b.example/2"}},
+		{"instapaper.csv", "https://a.example/1,A\nhttps://b.example/2,B\n", []string{"https://a.example/1", "https://b.example/2"}},
+		{"table.csv", "name,count\napples,3\n", nil},
+		{"doc.pdf", "https://a.example/1\n", nil},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := urlListFile(path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("urlListFile(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDocumentKind(t *testing.T) {
+	tests := []struct {
+		filename, contentType, want string
+	}{
+		{"scan.PDF", "", contentpolicy.PDF},
+		{"photo.jpeg", "", contentpolicy.Image},
+		{"notes.md", "", contentpolicy.Markdown},
+		{"report.docx", "", contentpolicy.Office},
+		{"document", "image/png", contentpolicy.Image},
+		{"document", "text/html; charset=utf-8", contentpolicy.HTML},
+		{"document", "application/epub+zip", contentpolicy.EPUB},
+		{"list.txt", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := documentKind(tt.filename, tt.contentType); got != tt.want {
+			t.Errorf("documentKind(%q, %q) = %q, want %q", tt.filename, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestArticleFingerprint(t *testing.T) {
+	base := articleFingerprint("Weekly", "<p>Hello &amp; welcome</p><p>Issue 12</p>")
+	if got := articleFingerprint("Weekly", "<div class=\"new\">\n  <p>Hello &amp; welcome</p>\n<p>Issue   12</p></div>"); got != base {
+		t.Errorf("fingerprint changed with markup and whitespace only")
+	}
+	if got := articleFingerprint("Weekly", "<p>Hello &amp; welcome</p><p>Issue 13</p>"); got == base {
+		t.Errorf("fingerprint unchanged when the text changed")
+	}
+	if got := articleFingerprint("Monthly", "<p>Hello &amp; welcome</p><p>Issue 12</p>"); got == base {
+		t.Errorf("fingerprint unchanged when the title changed")
+	}
+}
@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/tracing"
+)
+
+// HTMLRequest is a page's HTML as the browser rendered it, posted by a
+// browser extension or bookmarklet. The upload options are the same as for
+// the webhook.
+type HTMLRequest struct {
+	HTML  string `form:"html" json:"html"`
+	URL   string `form:"url" json:"url"`     // page URL, used to resolve relative links and images
+	Title string `form:"title" json:"title"` // optional, names the document instead of the page's own title
+	DocumentRequest
+}
+
+// HTMLHandler renders posted HTML to a PDF or EPUB and uploads it, for pages
+// the server can't fetch itself, such as those behind a login. The readable
+// article is extracted from the page like for a web article URL.
+func HTMLHandler(c *gin.Context) {
+	var userID uuid.UUID
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return
+		}
+		user = u
+		userID = user.ID
+	}
+
+	if rejectDuringMaintenance(c) {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxUploadSize())
+	var req HTMLRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if strings.TrimSpace(req.HTML) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "html is required"})
+		return
+	}
+	if req.URL != "" {
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http or https URL"})
+			return
+		}
+	}
+
+	target, ok := onBehalfTarget(c, user, req.UserID)
+	if !ok {
+		return
+	}
+	if rejectUnsupportedOptions(c, target, req.ConflictResolution, req.Coverpage) {
+		return
+	}
+	if rejectInvalidLabels(c, req.Labels) {
+		return
+	}
+	if rejectUnderLoad(c, targetID(target, userID)) {
+		return
+	}
+
+	// The pipeline converts .html files, naming the result after the page's
+	// title, and removes them once done
+	jobUserID := targetID(target, userID)
+	tempDir, err := manager.CreateUserTempDir(jobUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save page"})
+		return
+	}
+	path := filepath.Join(tempDir, "page.html")
+	if err := os.WriteFile(path, []byte(req.HTML), 0600); err != nil {
+		os.RemoveAll(tempDir)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save page"})
+		return
+	}
+
+	form := requestForm(req.DocumentRequest)
+	form["Body"] = path
+	form["page_url"] = req.URL
+	form["page_title"] = req.Title
+	form["source"] = "html"
+	form["request_id"] = logging.RequestID(c.Request.Context())
+	form["traceparent"] = tracing.TraceParent(c.Request.Context())
+	id := enqueueJobForUser(form, jobUserID)
+	auditOnBehalf(c, user, target, id)
+	c.JSON(http.StatusAccepted, gin.H{"jobId": id})
+}
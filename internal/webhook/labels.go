@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+)
+
+// rejectInvalidLabels responds with 400 and returns true when the labels
+// option isn't a valid list of key=value pairs
+func rejectInvalidLabels(c *gin.Context, labels string) bool {
+	if _, err := database.ParseLabels(labels); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return true
+	}
+	return false
+}
+
+// applyLabels attaches the job's labels to it in the job store and rewrites
+// form["labels"] in canonical order. Labels that don't parse are dropped;
+// handlers reject them before a job is created.
+func applyLabels(id string, form map[string]string, user *database.User) {
+	if form["labels"] == "" {
+		return
+	}
+	labels, err := database.ParseLabels(form["labels"])
+	if err != nil {
+		manager.LogfWithUser(user, "ignoring labels: %v", err)
+		delete(form, "labels")
+		return
+	}
+	form["labels"] = database.FormatLabels(labels)
+	if len(labels) > 0 {
+		jobStore.SetLabels(id, labels)
+	}
+}
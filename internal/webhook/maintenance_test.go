@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
+)
+
+func TestSubmissionsRejectedDuringMaintenance(t *testing.T) {
+	t.Setenv("MULTI_USER", "false")
+	gin.SetMode(gin.TestMode)
+	end := maintenance.BeginRestore()
+	defer end()
+
+	handlers := map[string]gin.HandlerFunc{
+		"/api/upload":  UploadHandler,
+		"/api/webhook": EnqueueHandler,
+	}
+	var bodies []map[string]interface{}
+	for path, handler := range handlers {
+		r := gin.New()
+		r.POST(path, handler)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("Body=https://example.com/a.pdf"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: status %d, Retry-After %q, want 503 with Retry-After", path, w.Code, w.Header().Get("Retry-After"))
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: response is not JSON: %s", path, w.Body)
+		}
+		details, _ := body["details"].(map[string]interface{})
+		if body["error_type"] != "maintenance_mode" || details["reason"] != maintenance.ReasonRestore {
+			t.Errorf("%s: body = %v", path, body)
+		}
+		delete(body, "correlation_id")
+		bodies = append(bodies, body)
+	}
+	if !reflect.DeepEqual(bodies[0], bodies[1]) {
+		t.Errorf("upload and webhook responses differ: %v vs %v", bodies[0], bodies[1])
+	}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// OnBehalfHeader names the user an admin is submitting a job for, by ID or username
+const OnBehalfHeader = "X-Aviary-User"
+
+var (
+	errOnBehalfForbidden = errors.New("only admins can submit jobs for another user")
+	errTargetNotFound    = errors.New("target user not found")
+)
+
+// requestedTarget returns the user named in the X-Aviary-User header, or else
+// in the request's user_id field
+func requestedTarget(c *gin.Context, field string) string {
+	if h := strings.TrimSpace(c.GetHeader(OnBehalfHeader)); h != "" {
+		return h
+	}
+	return strings.TrimSpace(field)
+}
+
+// resolveTargetUser returns the user a job should run as. Admins may name any
+// active user by ID or username; everyone else can only name themselves.
+func resolveTargetUser(actor *database.User, requested string) (*database.User, error) {
+	if actor == nil || requested == "" || requested == actor.ID.String() || strings.EqualFold(requested, actor.Username) {
+		return actor, nil
+	}
+	if !actor.IsAdmin {
+		return nil, errOnBehalfForbidden
+	}
+
+	var target database.User
+	query := database.DB.Where("is_active = ?", true)
+	if id, err := uuid.Parse(requested); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("LOWER(username) = LOWER(?)", requested)
+	}
+	if err := query.First(&target).Error; err != nil {
+		return nil, errTargetNotFound
+	}
+	return &target, nil
+}
+
+// onBehalfError maps a resolveTargetUser error to an HTTP status and error type
+func onBehalfError(err error) (int, string) {
+	if errors.Is(err, errOnBehalfForbidden) {
+		return http.StatusForbidden, "on_behalf_forbidden"
+	}
+	return http.StatusNotFound, "target_user_not_found"
+}
+
+// auditOnBehalf records a job an admin submitted for another user
+func auditOnBehalf(c *gin.Context, actor, target *database.User, jobID string) {
+	if actor == nil || target == nil || actor.ID == target.ID {
+		return
+	}
+	method, _ := c.Get("auth_method")
+	logging.Logf("[AUDIT] %s (%s, %v) submitted job %s for user %s from %s",
+		actor.Username, actor.ID, method, jobID, target.Username, c.ClientIP())
+}
+
+// onBehalfTarget resolves the user an EnqueueHandler request runs as, writing
+// a JSON error and returning false when it can't be used
+func onBehalfTarget(c *gin.Context, actor *database.User, field string) (*database.User, bool) {
+	if !database.IsMultiUserMode() {
+		return actor, true
+	}
+	target, err := resolveTargetUser(actor, requestedTarget(c, field))
+	if err != nil {
+		status, errType := onBehalfError(err)
+		apierror.Respond(c, status, errType, err.Error())
+		return nil, false
+	}
+	return target, true
+}
+
+// targetID returns target's ID, or fallback in single-user mode
+func targetID(target *database.User, fallback uuid.UUID) uuid.UUID {
+	if target == nil {
+		return fallback
+	}
+	return target.ID
+}
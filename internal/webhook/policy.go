@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/contentpolicy"
+	"github.com/rmitchellscott/aviary/internal/converter"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+var (
+	// errContentBlocked is returned when a job's content is of a kind its
+	// user may not send
+	errContentBlocked = errors.New("content type blocked")
+	// errJobFileTooLarge is returned when a downloaded or ingested file is
+	// larger than its user's upload limit
+	errJobFileTooLarge = errors.New("file too large")
+)
+
+// fileKind returns the kind of content in a file from its name, or "" when
+// Aviary doesn't know it
+func fileKind(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		return contentpolicy.PDF
+	case ".epub":
+		return contentpolicy.EPUB
+	case ".jpg", ".jpeg", ".png":
+		return contentpolicy.Image
+	case ".md", ".markdown":
+		return contentpolicy.Markdown
+	case ".html", ".htm":
+		return contentpolicy.HTML
+	}
+	if converter.IsOfficeDocument(name) {
+		return contentpolicy.Office
+	}
+	return ""
+}
+
+// urlKind returns the kind of a URL from the content type
+// detectURLContentType found. Anything that isn't a document is fetched as a
+// web page.
+func urlKind(contentType string) string {
+	switch contentType {
+	case "application/pdf":
+		return contentpolicy.PDF
+	case "application/epub+zip":
+		return contentpolicy.EPUB
+	case "text/markdown", "text/plain":
+		return contentpolicy.Markdown
+	}
+	if _, ok := converter.OfficeContentTypes[contentType]; ok {
+		return contentpolicy.Office
+	}
+	return contentpolicy.WebPage
+}
+
+// documentKind returns the kind of content sent as a file, from its name or,
+// failing that, the content type it was sent with
+func documentKind(filename, contentType string) string {
+	if kind := fileKind(filename); kind != "" {
+		return kind
+	}
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch {
+	case contentType == "":
+		return ""
+	case strings.HasPrefix(contentType, "image/"):
+		return contentpolicy.Image
+	case contentType == "text/html":
+		return contentpolicy.HTML
+	}
+	return urlKind(contentType)
+}
+
+// rejectBlockedContent responds with a content_type_blocked error naming the
+// kind, and returns true, when user may not send content of kind
+func rejectBlockedContent(c *gin.Context, user *database.User, kind string) bool {
+	if !contentpolicy.Blocked(user, kind) {
+		return false
+	}
+	logging.Logf("[UPLOAD] Rejected %s content blocked for user %s", kind, user.Username)
+	apierror.Respond(c, http.StatusBadRequest, "content_type_blocked", "", gin.H{
+		"content_type": kind,
+		"blocked":      contentpolicy.BlockedFor(user),
+	})
+	return true
+}
+
+// checkContentPolicy fails a job whose content is of a kind dbUser may not
+// send. It catches what the upload handlers can't: URLs, whose kind is only
+// known once they're fetched, and files from email or a watched folder.
+func checkContentPolicy(dbUser *database.User, kind string) (string, error) {
+	if contentpolicy.Blocked(dbUser, kind) {
+		return "backend.status.content_type_blocked", fmt.Errorf("%w: %s", errContentBlocked, kind)
+	}
+	return "", nil
+}
+
+// checkFilePolicy fails a job whose local file is of a blocked kind or, in
+// multi-user mode, larger than dbUser's upload limit
+func checkFilePolicy(dbUser *database.User, path string) (string, error) {
+	if key, err := checkContentPolicy(dbUser, fileKind(path)); err != nil {
+		return key, err
+	}
+	if dbUser == nil {
+		return "", nil
+	}
+	if info, err := os.Stat(path); err == nil {
+		if limit := MaxUploadSizeFor(dbUser); info.Size() > limit {
+			return "backend.status.file_too_large", fmt.Errorf("%w: %d bytes (limit: %d bytes)", errJobFileTooLarge, info.Size(), limit)
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/jobs"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+var (
+	poolOnce sync.Once
+	pool     *jobs.Pool
+)
+
+// jobPool returns the pool every job runs in, limited by MAX_CONCURRENT_JOBS
+// (default: the number of CPUs, at least 2) and MAX_CONCURRENT_JOBS_PER_USER.
+// Low resource mode runs one job at a time. Waiting jobs start by priority
+// unless JOB_SCHEDULER is "fifo", with JOB_PRIORITY_AGING (default 10m)
+// moving a job up a lane for each period it has waited.
+func jobPool() *jobs.Pool {
+	poolOnce.Do(func() {
+		max := config.GetInt("MAX_CONCURRENT_JOBS", max(2, runtime.NumCPU()))
+		perUser := config.GetInt("MAX_CONCURRENT_JOBS_PER_USER", 0)
+		if config.LowResource() {
+			max, perUser = 1, 1
+		}
+		pool = jobs.NewPool(max, perUser)
+
+		scheduler := jobs.Scheduler{Aging: config.GetDuration("JOB_PRIORITY_AGING", 10*time.Minute)}
+		switch s := strings.ToLower(config.Get("JOB_SCHEDULER", "priority")); s {
+		case "priority":
+		case "fifo":
+			scheduler.FIFO = true
+		default:
+			logging.Logf("[QUEUE] Warning: unknown JOB_SCHEDULER %q, using priority", s)
+		}
+		pool.SetScheduler(scheduler)
+	})
+	return pool
+}
+
+// jobPriority returns the lane a job waits in: uploads from the web UI go
+// ahead of webhook and API jobs, and subscriptions go last. The lane of a
+// source can be changed with PRIORITY_<SOURCE>, e.g. PRIORITY_EMAIL=low.
+func jobPriority(form map[string]string) jobs.Priority {
+	source := form["source"]
+	fallback := jobs.PriorityNormal
+	switch source {
+	case "ui":
+		fallback = jobs.PriorityHigh
+	case "subscription":
+		fallback = jobs.PriorityLow
+	}
+	if source == "" {
+		return fallback
+	}
+	name := "PRIORITY_" + strings.ToUpper(source)
+	setting := config.Get(name, "")
+	if setting == "" {
+		return fallback
+	}
+	priority, ok := jobs.ParsePriority(strings.ToLower(setting))
+	if !ok {
+		logging.Logf("[QUEUE] Warning: ignoring %s=%q, expected low, normal or high", name, setting)
+		return fallback
+	}
+	return priority
+}
+
+// runJob runs work for job id once the pool has a free slot and no job of a
+// higher priority is waiting for it, marking the job as waiting until then
+func runJob(id string, userID uuid.UUID, priority jobs.Priority, work func()) {
+	if jobPool().SubmitPriority(id, userID, priority, work) {
+		return
+	}
+	pos, ok := jobPool().Position(id)
+	if !ok {
+		return
+	}
+	// The job may have started since Submit returned
+	jobStore.UpdateIfWaiting(id, "Queued", "backend.status.waiting_for_worker", map[string]string{
+		"position": strconv.Itoa(pos + 1),
+	})
+}
+
+// jobLogContext carries job id, the request that started it and, in
+// multi-user mode, user's name into the job's log lines
+func jobLogContext(id string, user *database.User) context.Context {
+	ctx := logging.WithJobID(context.Background(), id)
+	if j, ok := jobStore.Get(id); ok {
+		ctx = logging.WithRequestID(ctx, j.RequestID)
+	}
+	if database.IsMultiUserMode() && user != nil {
+		ctx = logging.WithUser(ctx, user.Username)
+	}
+	return ctx
+}
+
+// JobPoolHandler returns the job concurrency limits and how many jobs are
+// running and waiting for a slot. Waiting jobs can be filtered with one or
+// more label=key:value query parameters.
+func JobPoolHandler(c *gin.Context) {
+	filters := make(map[string]string)
+	for _, f := range c.QueryArray("label") {
+		key, value, err := database.ParseLabelFilter(f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filters[key] = value
+	}
+
+	stats := jobPool().Stats()
+	waiting := stats.WaitingJobs[:0]
+	for _, job := range stats.WaitingJobs {
+		if j, ok := jobStore.Get(job.ID); ok {
+			job.Labels = j.Labels
+		}
+		if hasLabels(job.Labels, filters) {
+			waiting = append(waiting, job)
+		}
+	}
+	stats.WaitingJobs = waiting
+	stats.Processes = procstats.Totals()
+	c.JSON(http.StatusOK, stats)
+}
+
+// hasLabels reports whether labels include every key and value in want
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
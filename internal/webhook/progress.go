@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// progressInterval limits how often download progress is sent to the job's
+// watchers
+const progressInterval = 500 * time.Millisecond
+
+// downloadProgress returns a callback for downloader.DownloadPDFForUser that
+// reports the bytes downloaded on jobID. The job data carries the raw byte
+// counts, the average speed in bytes per second and, when the server sent a
+// Content-Length, the percentage and seconds left.
+func downloadProgress(jobID string) func(done, total int64) {
+	start := time.Now()
+	var mu sync.Mutex
+	var last time.Time
+	return func(done, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		finished := total > 0 && done >= total
+		if !finished && now.Sub(last) < progressInterval {
+			return
+		}
+		last = now
+
+		var speed int64
+		if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+			speed = int64(float64(done) / elapsed)
+		}
+		data := map[string]string{
+			"downloaded_bytes": strconv.FormatInt(done, 10),
+			"speed_bps":        strconv.FormatInt(speed, 10),
+			"downloaded":       formatBytes(done),
+			"speed":            formatBytes(speed),
+		}
+		if total <= 0 {
+			jobStore.UpdateProgressMessage(jobID, "backend.status.downloading_bytes", data, 0)
+			return
+		}
+		data["total_bytes"] = strconv.FormatInt(total, 10)
+		data["total"] = formatBytes(total)
+		eta := time.Duration(0)
+		if speed > 0 {
+			eta = time.Duration(float64(total-done)/float64(speed)) * time.Second
+		}
+		data["eta_seconds"] = strconv.Itoa(int(eta.Seconds()))
+		data["eta"] = eta.String()
+		jobStore.UpdateProgressMessage(jobID, "backend.status.downloading_progress", data, int(done*100/total))
+	}
+}
+
+// formatBytes returns n as a short human-readable size, e.g. "4.2 MB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,405 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/degraded"
+	"github.com/rmitchellscott/aviary/internal/delivery"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/manager"
+)
+
+const (
+	queuedKindForm     = "form"
+	queuedKindDocument = "document"
+
+	// queuedForDegraded holds a job until degraded mode ends (the default)
+	queuedForDegraded = "degraded"
+	// queuedForWindow holds a job until the user's delivery window opens
+	queuedForWindow = "delivery_window"
+)
+
+// queuedJob is a job held back while in degraded mode or outside the user's
+// delivery window. It is written to DATA_DIR/queue so queued jobs survive a
+// restart.
+type queuedJob struct {
+	ID       string            `json:"id"`
+	UserID   uuid.UUID         `json:"user_id"`
+	Kind     string            `json:"kind"`
+	Form     map[string]string `json:"form,omitempty"`
+	Document *DocumentRequest  `json:"document,omitempty"`
+	QueuedAt time.Time         `json:"queued_at"`
+	Reason   string            `json:"reason,omitempty"`
+}
+
+var (
+	queueMu  sync.Mutex
+	resumeMu sync.Mutex
+)
+
+// queueDir returns the directory queued jobs are persisted in
+func queueDir() string {
+	return filepath.Join(config.Get("DATA_DIR", "/data"), "queue")
+}
+
+// queueJob persists a job so it can run once degraded mode ends. Uploaded files
+// are moved out of the temp directory alongside it. It returns false if the job
+// could not be saved, in which case the caller should run it immediately.
+func queueJob(id string, userID uuid.UUID, form map[string]string, doc *DocumentRequest) bool {
+	if !persistJob(id, userID, form, doc, queuedForDegraded) {
+		return false
+	}
+	logging.Logf("[DEGRADED] Queued job %s until dependencies recover", id)
+	jobStore.Update(id, "Queued", "backend.status.queued_degraded", nil)
+	return true
+}
+
+// holdForWindow persists a job submitted outside the user's delivery window
+// so it runs once the window opens. Like queueJob, it returns false if the job
+// could not be saved.
+func holdForWindow(id string, userID uuid.UUID, form map[string]string, doc *DocumentRequest, w *delivery.Window) bool {
+	if !persistJob(id, userID, form, doc, queuedForWindow) {
+		return false
+	}
+	opens := w.NextOpen(time.Now())
+	logging.Logf("[DELIVERY] Holding job %s until the delivery window opens at %s", id, opens.Format(time.RFC3339))
+	jobStore.Update(id, "Queued", "backend.status.queued_delivery_window", map[string]string{
+		"opens_at": opens.Format("15:04"),
+	})
+	return true
+}
+
+// windowClosed returns the user's delivery window when it's currently closed
+func windowClosed(user *database.User) (*delivery.Window, bool) {
+	w := delivery.WindowForUser(user)
+	if w == nil || w.Open(time.Now()) {
+		return nil, false
+	}
+	return w, true
+}
+
+func persistJob(id string, userID uuid.UUID, form map[string]string, doc *DocumentRequest, reason string) bool {
+	job := queuedJob{ID: id, UserID: userID, Document: doc, QueuedAt: time.Now(), Reason: reason}
+	if doc != nil {
+		job.Kind = queuedKindDocument
+	} else {
+		job.Kind = queuedKindForm
+		job.Form = make(map[string]string, len(form))
+		for k, v := range form {
+			job.Form[k] = v
+		}
+	}
+
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	if job.Form != nil {
+		body, err := relocateUploads(job.Form["Body"], filepath.Join(queueDir(), id))
+		if err != nil {
+			logging.Logf("[DEGRADED] Failed to queue uploaded files for job %s: %v", id, err)
+			return false
+		}
+		job.Form["Body"] = body
+	}
+	if err := writeQueuedJob(job); err != nil {
+		logging.Logf("[DEGRADED] Failed to queue job %s: %v", id, err)
+		os.RemoveAll(filepath.Join(queueDir(), id))
+		return false
+	}
+	return true
+}
+
+func writeQueuedJob(job queuedJob) error {
+	if err := os.MkdirAll(queueDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(queueDir(), job.ID+".json")
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// listQueuedJobs returns the persisted jobs, oldest first
+func listQueuedJobs() ([]queuedJob, error) {
+	entries, err := os.ReadDir(queueDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var queued []queuedJob
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(queueDir(), entry.Name()))
+		if err != nil {
+			logging.Logf("[DEGRADED] Failed to read queued job %s: %v", entry.Name(), err)
+			continue
+		}
+		var job queuedJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			logging.Logf("[DEGRADED] Skipping corrupt queued job %s: %v", entry.Name(), err)
+			continue
+		}
+		queued = append(queued, job)
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].QueuedAt.Before(queued[j].QueuedAt) })
+	return queued, nil
+}
+
+// relocateUploads moves the local files referenced by a form Body (a single
+// path or a "files:" JSON list) into dir and returns the rewritten Body. URLs
+// are returned unchanged.
+func relocateUploads(body, dir string) (string, error) {
+	if strings.HasPrefix(body, "files:") {
+		var paths []string
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(body, "files:")), &paths); err != nil {
+			return "", err
+		}
+		for i, p := range paths {
+			moved, err := moveUpload(p, dir)
+			if err != nil {
+				return "", err
+			}
+			paths[i] = moved
+		}
+		data, err := json.Marshal(paths)
+		if err != nil {
+			return "", err
+		}
+		return "files:" + string(data), nil
+	}
+	if !filepath.IsAbs(body) {
+		return body, nil
+	}
+	if _, err := os.Stat(body); err != nil {
+		return body, nil
+	}
+	return moveUpload(body, dir)
+}
+
+// moveUpload moves src into dir, copying when a rename crosses filesystems
+func moveUpload(src, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(src))
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	os.Remove(src)
+	return dst, nil
+}
+
+// ResumeQueuedJobs starts every queued job whose delivery window is open. It
+// stops early if degraded mode is entered again.
+func ResumeQueuedJobs() {
+	resumeMu.Lock()
+	defer resumeMu.Unlock()
+
+	queued, err := listQueuedJobs()
+	if err != nil {
+		logging.Logf("[DEGRADED] Failed to list queued jobs: %v", err)
+		return
+	}
+	resumed := 0
+	defer func() {
+		if resumed > 0 {
+			logging.Logf("[DEGRADED] Resumed %d queued job(s)", resumed)
+		}
+	}()
+
+	for _, job := range queued {
+		if degraded.Active() {
+			logging.Logf("[DEGRADED] Dependencies failing again, leaving remaining jobs queued")
+			return
+		}
+		// Jobs whose delivery window is closed wait for it instead
+		if w, closed := windowClosed(queuedJobUser(job.UserID)); closed {
+			if job.Reason != queuedForWindow {
+				job.Reason = queuedForWindow
+				queueMu.Lock()
+				err := writeQueuedJob(job)
+				queueMu.Unlock()
+				if err != nil {
+					logging.Logf("[DEGRADED] Failed to update queued job %s: %v", job.ID, err)
+				}
+				jobStore.Update(job.ID, "Queued", "backend.status.queued_delivery_window", map[string]string{
+					"opens_at": w.NextOpen(time.Now()).Format("15:04"),
+				})
+			}
+			continue
+		}
+		if err := resumeQueuedJob(job); err != nil {
+			logging.Logf("[DEGRADED] Failed to resume queued job %s: %v", job.ID, err)
+			continue
+		}
+		resumed++
+	}
+}
+
+// StartDeliveryWindows checks every minute for queued jobs whose delivery
+// window has opened and starts them, until ctx is done
+func StartDeliveryWindows(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !degraded.Active() {
+					ResumeQueuedJobs()
+				}
+			}
+		}
+	}()
+}
+
+func resumeQueuedJob(job queuedJob) error {
+	queueMu.Lock()
+	jobDir := filepath.Join(queueDir(), job.ID)
+	if job.Kind == queuedKindForm {
+		// Hand the files back to a temp dir so the pipeline cleans them up as usual
+		tempDir, err := manager.CreateUserTempDir(job.UserID)
+		if err != nil {
+			queueMu.Unlock()
+			return err
+		}
+		body, err := relocateUploads(job.Form["Body"], tempDir)
+		if err != nil {
+			queueMu.Unlock()
+			return err
+		}
+		job.Form["Body"] = body
+	}
+	err := os.Remove(filepath.Join(queueDir(), job.ID+".json"))
+	os.RemoveAll(jobDir)
+	queueMu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The in-memory store is empty after a restart
+	if _, ok := jobStore.Get(job.ID); !ok {
+		jobStore.Create(job.ID)
+		jobStore.SetOwner(job.ID, job.UserID)
+	}
+
+	switch job.Kind {
+	case queuedKindForm:
+		startJob(job.ID, job.Form, job.UserID, queuedJobUser(job.UserID))
+	case queuedKindDocument:
+		if job.Document == nil {
+			return fmt.Errorf("queued document job has no request")
+		}
+		startDocumentJob(job.ID, *job.Document, job.UserID)
+	default:
+		return fmt.Errorf("unknown queued job kind %q", job.Kind)
+	}
+	return nil
+}
+
+// dropQueuedJob removes a held job and its uploaded files, and reports
+// whether there was one
+func dropQueuedJob(id string) bool {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	err := os.Remove(filepath.Join(queueDir(), id+".json"))
+	if err != nil {
+		return false
+	}
+	os.RemoveAll(filepath.Join(queueDir(), id))
+	return true
+}
+
+func queuedJobUser(userID uuid.UUID) *database.User {
+	if !database.IsMultiUserMode() || userID == uuid.Nil {
+		return nil
+	}
+	user, err := database.NewUserService(database.DB).GetUserByID(userID)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// QueuedJobsHandler returns degraded mode status and the jobs waiting for it
+// to end or for their delivery window to open
+func QueuedJobsHandler(c *gin.Context) {
+	queued, err := listQueuedJobs()
+	if err != nil {
+		logging.Logf("[DEGRADED] Failed to list queued jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list queued jobs"})
+		return
+	}
+
+	type queuedJobInfo struct {
+		ID       string    `json:"id"`
+		UserID   string    `json:"user_id,omitempty"`
+		Kind     string    `json:"kind"`
+		Source   string    `json:"source,omitempty"`
+		Reason   string    `json:"reason"`
+		QueuedAt time.Time `json:"queued_at"`
+	}
+	jobs := make([]queuedJobInfo, 0, len(queued))
+	for _, job := range queued {
+		info := queuedJobInfo{ID: job.ID, Kind: job.Kind, Reason: job.Reason, QueuedAt: job.QueuedAt}
+		if info.Reason == "" {
+			info.Reason = queuedForDegraded
+		}
+		if job.UserID != uuid.Nil {
+			info.UserID = job.UserID.String()
+		}
+		if job.Form != nil {
+			info.Source = job.Form["source"]
+		}
+		jobs = append(jobs, info)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"degraded": degraded.GetStatus(),
+		"jobs":     jobs,
+	})
+}
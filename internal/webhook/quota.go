@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"fmt"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/smtp"
+)
+
+// checkQuota returns an error when dbUser has used up their storage or
+// monthly upload quota. Failing to read usage doesn't block the job.
+func checkQuota(dbUser *database.User) error {
+	if dbUser == nil || (dbUser.StorageQuotaMB == 0 && dbUser.UploadQuota == 0) {
+		return nil
+	}
+	usage, err := database.NewUserService(database.DB).GetQuotaUsage(dbUser)
+	if err != nil {
+		manager.LogfWithUser(dbUser, "could not check quota: %v", err)
+		return nil
+	}
+	if exceeded := usage.Exceeded(); exceeded != "" {
+		return fmt.Errorf("%s quota exceeded", exceeded)
+	}
+	return nil
+}
+
+// quotaLevel returns the warning level percent has reached: 100, warnPercent
+// or 0
+func quotaLevel(percent, warnPercent int) int {
+	switch {
+	case percent >= 100:
+		return 100
+	case percent >= warnPercent:
+		return warnPercent
+	}
+	return 0
+}
+
+// notifyQuotaUsage warns dbUser once when a quota crosses the warning
+// threshold and again when it's used up. Levels drop back as usage does, so
+// a user who cleans up is warned again next time.
+func notifyQuotaUsage(dbUser *database.User) {
+	if dbUser == nil || (dbUser.StorageQuotaMB == 0 && dbUser.UploadQuota == 0) {
+		return
+	}
+	userService := database.NewUserService(database.DB)
+	usage, err := userService.GetQuotaUsage(dbUser)
+	if err != nil {
+		manager.LogfWithUser(dbUser, "could not check quota: %v", err)
+		return
+	}
+	warnPercent := database.QuotaWarningPercent()
+
+	updates := make(map[string]interface{})
+	var warnings []smtp.QuotaWarning
+
+	storageLevel := quotaLevel(usage.StoragePercent(), warnPercent)
+	if storageLevel != dbUser.StorageQuotaWarned {
+		updates["storage_quota_warned"] = storageLevel
+		if storageLevel > dbUser.StorageQuotaWarned {
+			warnings = append(warnings, smtp.QuotaWarning{
+				Quota:   "storage",
+				Percent: usage.StoragePercent(),
+				Used:    formatMB(usage.StorageBytes),
+				Limit:   formatMB(usage.StorageLimitBytes),
+			})
+		}
+	}
+
+	warned := dbUser.UploadQuotaWarned
+	if dbUser.UploadQuotaWarnedFor == nil || !dbUser.UploadQuotaWarnedFor.Equal(usage.PeriodStart) {
+		warned = 0
+	}
+	uploadLevel := quotaLevel(usage.UploadPercent(), warnPercent)
+	if uploadLevel != warned {
+		updates["upload_quota_warned"] = uploadLevel
+		updates["upload_quota_warned_for"] = usage.PeriodStart
+		if uploadLevel > warned {
+			warnings = append(warnings, smtp.QuotaWarning{
+				Quota:   "uploads",
+				Percent: usage.UploadPercent(),
+				Used:    fmt.Sprintf("%d uploads", usage.Uploads),
+				Limit:   fmt.Sprintf("%d uploads", usage.UploadLimit),
+			})
+		}
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+	if err := userService.UpdateUserSettings(dbUser.ID, updates); err != nil {
+		manager.LogfWithUser(dbUser, "could not record quota warning: %v", err)
+		return
+	}
+
+	for _, w := range warnings {
+		manager.LogfWithUser(dbUser, "%s quota at %d%%", w.Quota, w.Percent)
+		if dbUser.Email == "" || !smtp.IsSMTPConfigured() {
+			continue
+		}
+		w.Username = dbUser.Username
+		w.Language = dbUser.Language
+		if err := smtp.SendQuotaWarningEmail(dbUser.Email, w); err != nil {
+			manager.LogfWithUser(dbUser, "could not send quota warning email: %v", err)
+		}
+	}
+}
+
+// formatMB formats a byte count in megabytes
+func formatMB(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/receipt"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// receiptDocument describes an uploaded file for the job's receipt
+func receiptDocument(documentID uuid.UUID, localPath, rmDir, remoteName string, source documentSource) receipt.Document {
+	doc := receipt.Document{
+		Name:       remoteName,
+		Path:       strings.TrimPrefix(filepath.Join(rmDir, remoteName), "/"),
+		SyncStatus: source.SyncStatus,
+	}
+	if documentID != uuid.Nil {
+		doc.ID = documentID.String()
+	}
+	if securePath, err := security.NewSecurePathFromExisting(localPath); err == nil {
+		if info, err := security.SafeStat(securePath); err == nil {
+			doc.Size = info.Size()
+		}
+	}
+	return doc
+}
+
+// addReceipt adds an upload receipt to the job's status data when receipts
+// are on for the job. A receipt that can't be built is logged, not fatal.
+func addReceipt(jobID string, form map[string]string, dbUser *database.User, rmDir string, docs []receipt.Document, data map[string]string) {
+	if !receipt.Enabled(form["receipt"]) {
+		return
+	}
+	var username string
+	if dbUser != nil {
+		username = dbUser.Username
+	}
+	if err := receipt.New(jobID, username, rmDir, docs).AddTo(data); err != nil {
+		manager.Logf("receipt warning: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/degraded"
+	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/manager"
+)
+
+// failedJob is a job whose upload to the reMarkable failed. The processed
+// file is kept in DATA_DIR/failed for FAILED_JOB_RETENTION so the upload can
+// be retried without downloading or converting it again.
+type failedJob struct {
+	ID        string            `json:"id"`
+	UserID    uuid.UUID         `json:"user_id"`
+	Form      map[string]string `json:"form"`
+	File      string            `json:"file"`
+	SourceURL string            `json:"source_url,omitempty"`
+	Message   string            `json:"message"`
+	Data      map[string]string `json:"data,omitempty"`
+	Error     string            `json:"error"`
+	FailedAt  time.Time         `json:"failed_at"`
+}
+
+var failedMu sync.Mutex
+
+// failedDir returns the directory failed jobs are kept in
+func failedDir() string {
+	return filepath.Join(config.Get("DATA_DIR", "/data"), "failed")
+}
+
+// failedJobRetention is how long a failed upload can be retried. Zero turns
+// retries off.
+func failedJobRetention() time.Duration {
+	return config.GetDuration("FAILED_JOB_RETENTION", 24*time.Hour)
+}
+
+// stageFailedUpload keeps the processed file of a job whose upload failed so
+// it can be retried, and returns data with "retryable" set when it was kept
+func stageFailedUpload(jobID string, userID uuid.UUID, form map[string]string, localPath, sourceURL, msgKey string, data map[string]string, uploadErr error) map[string]string {
+	if failedJobRetention() <= 0 {
+		return data
+	}
+
+	failedMu.Lock()
+	defer failedMu.Unlock()
+
+	job := failedJob{
+		ID:        jobID,
+		UserID:    userID,
+		Form:      make(map[string]string, len(form)),
+		SourceURL: sourceURL,
+		Message:   msgKey,
+		Data:      data,
+		Error:     uploadErr.Error(),
+		FailedAt:  time.Now(),
+	}
+	for k, v := range form {
+		job.Form[k] = v
+	}
+	// The body may be the whole document; the staged file replaces it
+	delete(job.Form, "Body")
+
+	file, err := moveUpload(localPath, filepath.Join(failedDir(), jobID))
+	if err != nil {
+		logging.Logf("[RETRY] Failed to keep file of failed job %s: %v", jobID, err)
+		return data
+	}
+	job.File = file
+	if err := writeFailedJob(job); err != nil {
+		logging.Logf("[RETRY] Failed to save failed job %s: %v", jobID, err)
+		os.RemoveAll(filepath.Join(failedDir(), jobID))
+		return data
+	}
+
+	retryData := map[string]string{"retryable": "true"}
+	for k, v := range data {
+		retryData[k] = v
+	}
+	return retryData
+}
+
+func writeFailedJob(job failedJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(failedDir(), job.ID+".json")
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// loadFailedJob reads a failed job, treating expired ones as gone
+func loadFailedJob(id string) (*failedJob, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(failedDir(), id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var job failedJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	if time.Since(job.FailedAt) > failedJobRetention() {
+		return nil, os.ErrNotExist
+	}
+	return &job, nil
+}
+
+// removeFailedJob deletes a failed job and its file
+func removeFailedJob(id string) {
+	os.Remove(filepath.Join(failedDir(), id+".json"))
+	os.RemoveAll(filepath.Join(failedDir(), id))
+}
+
+// CleanupFailedJobs removes failed jobs older than FAILED_JOB_RETENTION and
+// returns how many were removed
+func CleanupFailedJobs() int {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+
+	entries, err := os.ReadDir(failedDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Logf("[RETRY] Failed to list failed jobs: %v", err)
+		}
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if _, err := loadFailedJob(id); err == nil {
+			continue
+		}
+		removeFailedJob(id)
+		removed++
+	}
+	return removed
+}
+
+// StartFailedJobCleanup removes expired failed jobs every hour until ctx is
+// done
+func StartFailedJobCleanup(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if n := CleanupFailedJobs(); n > 0 {
+				logging.Logf("[RETRY] Removed %d expired failed job(s)", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RetryRequest optionally changes how a retried upload handles a document
+// that already exists
+type RetryRequest struct {
+	ConflictResolution string `json:"conflict_resolution"`
+}
+
+// RetryHandler retries the upload of a failed job with the file it had
+// already downloaded and converted. The job keeps its ID, so its status can be
+// followed as before.
+func RetryHandler(c *gin.Context) {
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return
+		}
+		user = u
+	}
+
+	if rejectDuringMaintenance(c) {
+		return
+	}
+
+	var req RetryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+			return
+		}
+	}
+
+	id := c.Param("id")
+	failedMu.Lock()
+	job, err := loadFailedJob(id)
+	if err == nil && user != nil && job.UserID != user.ID && !user.IsAdmin {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		failedMu.Unlock()
+		if !errors.Is(err, os.ErrNotExist) {
+			logging.Logf("[RETRY] Failed to read failed job %s: %v", id, err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "backend.status.job_not_found"})
+		return
+	}
+
+	target := queuedJobUser(job.UserID)
+	if req.ConflictResolution != "" {
+		if rejectUnsupportedOptions(c, target, req.ConflictResolution, job.Form["coverpage"]) {
+			failedMu.Unlock()
+			return
+		}
+		job.Form["conflict_resolution"] = req.ConflictResolution
+	}
+
+	// Hand the file back to a temp dir so the pipeline cleans it up as usual
+	tempDir, err := manager.CreateUserTempDir(job.UserID)
+	if err == nil {
+		job.Form["Body"], err = moveUpload(job.File, tempDir)
+	}
+	if err != nil {
+		failedMu.Unlock()
+		logging.Logf("[RETRY] Failed to restore file of job %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry job"})
+		return
+	}
+	removeFailedJob(id)
+	failedMu.Unlock()
+
+	// The file is already processed, so only the upload and what follows run
+	form := job.Form
+	form["retry"] = "true"
+	form["source_url"] = job.SourceURL
+	form["compress"] = "false"
+	form["remove_background"] = "false"
+
+	if _, ok := jobStore.Get(id); ok {
+		jobStore.Update(id, "pending", "", nil)
+	} else {
+		// The in-memory store is empty after a restart
+		jobStore.Create(id)
+		jobStore.SetOwner(id, job.UserID)
+	}
+	logging.Logf("[RETRY] Retrying upload of job %s", id)
+
+	switch {
+	case degraded.Active() && queueJob(id, job.UserID, form, nil):
+	case holdIfWindowClosed(id, job.UserID, form, target):
+	default:
+		startJob(id, form, job.UserID, target)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"jobId": id})
+}
+
+// holdIfWindowClosed holds a job until the user's delivery window opens,
+// returning false if the window is open or the job couldn't be held
+func holdIfWindowClosed(id string, userID uuid.UUID, form map[string]string, user *database.User) bool {
+	w, closed := windowClosed(user)
+	return closed && holdForWindow(id, userID, form, nil, w)
+}
+
+// failedJobStatus returns the status of a failed job kept for retrying, for
+// jobs no longer in memory after a restart
+func failedJobStatus(id string) (gin.H, bool) {
+	failedMu.Lock()
+	job, err := loadFailedJob(id)
+	failedMu.Unlock()
+	if err != nil {
+		return nil, false
+	}
+	data := map[string]string{"retryable": "true"}
+	for k, v := range job.Data {
+		data[k] = v
+	}
+	return gin.H{"status": "error", "message": job.Message, "data": data, "progress": 0, "operation": ""}, true
+}
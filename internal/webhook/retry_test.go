@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStageFailedUpload(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+
+	src := filepath.Join(t.TempDir(), "Paper.pdf")
+	if err := os.WriteFile(src, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.NewString()
+	form := map[string]string{"Body": src, "rm_dir": "/Papers"}
+
+	data := stageFailedUpload(id, uuid.Nil, form, src, "https://example.com/paper.pdf",
+		"backend.status.upload_timeout", nil, errors.New("timed out"))
+	if data["retryable"] != "true" {
+		t.Fatalf("expected job to be retryable, got %v", data)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("expected staged file to be moved out of %s", src)
+	}
+
+	job, err := loadFailedJob(id)
+	if err != nil {
+		t.Fatalf("loadFailedJob: %v", err)
+	}
+	if job.Form["Body"] != "" {
+		t.Errorf("expected Body to be dropped, got %q", job.Form["Body"])
+	}
+	if job.Form["rm_dir"] != "/Papers" || job.SourceURL != "https://example.com/paper.pdf" {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if _, err := os.Stat(job.File); err != nil {
+		t.Errorf("staged file missing: %v", err)
+	}
+
+	// Expired jobs are treated as gone and removed by cleanup
+	job.FailedAt = time.Now().Add(-48 * time.Hour)
+	if err := writeFailedJob(*job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFailedJob(id); !os.IsNotExist(err) {
+		t.Errorf("expected expired job to be gone, got %v", err)
+	}
+	if n := CleanupFailedJobs(); n != 1 {
+		t.Errorf("expected 1 job removed, got %d", n)
+	}
+	if _, err := os.Stat(job.File); !os.IsNotExist(err) {
+		t.Errorf("expected staged file to be removed")
+	}
+}
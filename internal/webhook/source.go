@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/security"
+)
+
+// documentSource records where an uploaded document came from and how it was
+// processed, for the Document record
+type documentSource struct {
+	URL              string
+	OriginalFilename string
+	// Fingerprint identifies the content fetched from URL
+	Fingerprint string
+	// Converters lists each conversion the file went through, in order
+	Converters []string
+	Options    map[string]string
+	Labels     map[string]string
+	// SyncStatus and VerifiedAt record the upload's sync verification
+	SyncStatus string
+	VerifiedAt *time.Time
+	// Environment is the software and settings the job ran with
+	Environment jobEnvironment
+	// ArchiveKey is where the archived copy was stored, if any, and
+	// ArchiveHash its verified SHA-256
+	ArchiveKey  string
+	ArchiveHash string
+	// ArchiveStatus and ArchiveError record whether archiving worked
+	ArchiveStatus string
+	ArchiveError  string
+}
+
+// recordedOptions are the form fields kept on the Document record. Body is
+// left out because it holds the URL, a local path or the whole document.
+var recordedOptions = []string{
+	"prefix", "compress", "compress_preset", "manage", "archive", "archive_pdfa",
+	"rm_dir", "retention_days", "conflict_resolution", "coverpage", "contrast", "currentpage",
+	"remove_background", "outputFormat", "extract_content", "source", "verify_sync",
+	"skip_duplicates", "update_policy",
+}
+
+// newDocumentSource starts a documentSource with the job's non-empty options
+// and a snapshot of the environment it runs in
+func newDocumentSource(form map[string]string, dbUser *database.User) documentSource {
+	options := make(map[string]string)
+	for _, key := range recordedOptions {
+		if v := form[key]; v != "" {
+			options[key] = v
+		}
+	}
+	labels, _ := database.ParseLabels(form["labels"])
+	return documentSource{Options: options, Labels: labels, Environment: newJobEnvironment(form, dbUser)}
+}
+
+func (s *documentSource) addConverter(name string) {
+	s.Converters = append(s.Converters, name)
+}
+
+// verifySync checks that remoteName reached the reMarkable cloud when sync
+// verification is on for the job, recording the outcome on s. It returns
+// manager.ErrNotVerified if the document never appeared.
+func (s *documentSource) verifySync(jobID string, form map[string]string, remoteName, rmDir string, dbUser *database.User) error {
+	if !manager.SyncVerifyEnabled(form["verify_sync"]) {
+		return nil
+	}
+	jobStore.UpdateWithOperation(jobID, "Running", "backend.status.verifying_sync", nil, "uploading")
+	verified, err := manager.VerifyUpload(remoteName, rmDir, dbUser)
+	if err != nil {
+		s.SyncStatus = manager.SyncUnverified
+		manager.LogfWithUser(dbUser, "sync verification failed for %s: %v", remoteName, err)
+		return err
+	}
+	if verified {
+		now := time.Now()
+		s.SyncStatus = manager.SyncVerified
+		s.VerifiedAt = &now
+	}
+	return nil
+}
+
+// optionsJSON returns Options as a JSON object, or "" if there are none
+func (s documentSource) optionsJSON() string {
+	if len(s.Options) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(s.Options)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at sp
+func fileSHA256(sp *security.SecurePath) (string, error) {
+	f, err := security.SafeOpen(sp)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/manager"
+)
+
+// defaultUploadTimeout bounds the upload to the tablet when nothing else is
+// configured, so a stalled connection can't hold a job forever
+const defaultUploadTimeout = time.Hour
+
+// parseTimeout parses a request timeout given as seconds ("600") or as a
+// duration ("10m"). Empty means unset.
+func parseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("timeout must not be negative: %s", s)
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := config.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	return d, nil
+}
+
+// jobTimeouts resolves the upload and whole-job timeouts from the request's
+// upload_timeout and job_timeout, then the user's settings, then the
+// UPLOAD_TIMEOUT and JOB_TIMEOUT environment variables. Zero means no limit.
+func jobTimeouts(form map[string]string, dbUser *database.User) (upload, job time.Duration, err error) {
+	if upload, err = parseTimeout(form["upload_timeout"]); err != nil {
+		return 0, 0, err
+	}
+	if job, err = parseTimeout(form["job_timeout"]); err != nil {
+		return 0, 0, err
+	}
+	if upload == 0 && dbUser != nil && dbUser.UploadTimeout > 0 {
+		upload = time.Duration(dbUser.UploadTimeout) * time.Second
+	}
+	if job == 0 && dbUser != nil && dbUser.JobTimeout > 0 {
+		job = time.Duration(dbUser.JobTimeout) * time.Second
+	}
+	if upload == 0 {
+		upload = config.GetDuration("UPLOAD_TIMEOUT", defaultUploadTimeout)
+	}
+	if job == 0 {
+		job = config.GetDuration("JOB_TIMEOUT", 0)
+	}
+	return upload, job, nil
+}
+
+// timeoutStatus returns the status key for an upload that ran out of time or
+// was cancelled, or "" if err is neither
+func timeoutStatus(err error) string {
+	switch {
+	case errors.Is(err, manager.ErrJobTimeout):
+		return "backend.status.job_timeout"
+	case errors.Is(err, manager.ErrUploadTimeout):
+		return "backend.status.upload_timeout"
+	case errors.Is(err, context.Canceled):
+		return "backend.status.cancelled"
+	}
+	return ""
+}
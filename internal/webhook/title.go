@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/rmitchellscott/aviary/internal/config"
+	"github.com/rmitchellscott/aviary/internal/security"
+	"golang.org/x/text/unicode/norm"
+)
+
+// junkTitles matches titles that authoring tools fill in on their own
+var junkTitles = regexp.MustCompile(`(?i)^(untitled|untitled document|document\d*|title|no title|print|pdf|microsoft word|slide ?\d*)$`)
+
+// toolPrefixes are stripped from titles set by office suites on export
+var toolPrefixes = []string{"Microsoft Word - ", "Microsoft PowerPoint - ", "Microsoft Excel - "}
+
+// urlDerivedName reports whether name was taken from the last segment of
+// urlStr rather than from the server's Content-Disposition header
+func urlDerivedName(name, urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return true
+	}
+	base := path.Base(u.Path)
+	if base == "." || base == "/" {
+		return true
+	}
+	trim := func(s string) string { return strings.TrimSuffix(s, filepath.Ext(s)) }
+	return trim(name) == trim(base)
+}
+
+// documentTitle returns the title embedded in a downloaded PDF or EPUB, or ""
+// if it has none worth using
+func documentTitle(localPath string) string {
+	var title string
+	switch strings.ToLower(filepath.Ext(localPath)) {
+	case ".pdf":
+		title = pdfTitle(localPath)
+	case ".epub":
+		title = epubTitle(localPath)
+	}
+	return cleanTitle(title, filepath.Base(localPath))
+}
+
+// cleanTitle drops titles that say nothing about the document: placeholders,
+// bare filenames and the name the file already has
+func cleanTitle(title, filename string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	for _, p := range toolPrefixes {
+		title = strings.TrimPrefix(title, p)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" || junkTitles.MatchString(title) {
+		return ""
+	}
+	switch strings.ToLower(filepath.Ext(title)) {
+	case ".pdf", ".doc", ".docx", ".odt", ".tex", ".dvi", ".indd", ".epub", ".html", ".htm":
+		return ""
+	}
+	if strings.EqualFold(title, strings.TrimSuffix(filename, filepath.Ext(filename))) {
+		return ""
+	}
+	return title
+}
+
+// pdfTitle reads /Title from the PDF's document information dictionary
+func pdfTitle(localPath string) string {
+	sp, err := security.NewSecurePathFromExisting(localPath)
+	if err != nil {
+		return ""
+	}
+	f, err := security.SafeOpen(sp)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	ctx, err := api.ReadContext(f, model.NewDefaultConfiguration())
+	if err != nil || ctx.Info == nil {
+		return ""
+	}
+	obj, err := ctx.Dereference(*ctx.Info)
+	if err != nil {
+		return ""
+	}
+	info, ok := obj.(types.Dict)
+	if !ok {
+		return ""
+	}
+
+	var title string
+	switch v := info["Title"].(type) {
+	case types.StringLiteral:
+		title, err = types.StringLiteralToString(v)
+	case types.HexLiteral:
+		title, err = types.HexLiteralToString(v)
+	}
+	if err != nil {
+		return ""
+	}
+	return title
+}
+
+// epubTitle reads dc:title from the EPUB's package document
+func epubTitle(localPath string) string {
+	r, err := zip.OpenReader(localPath)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if !readZipXML(&r.Reader, "META-INF/container.xml", &container) || len(container.Rootfiles) == 0 {
+		return ""
+	}
+	var pkg struct {
+		Titles []string `xml:"metadata>title"`
+	}
+	if !readZipXML(&r.Reader, container.Rootfiles[0].FullPath, &pkg) || len(pkg.Titles) == 0 {
+		return ""
+	}
+	return pkg.Titles[0]
+}
+
+func readZipXML(r *zip.Reader, name string, v interface{}) bool {
+	for _, f := range r.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return false
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v) == nil
+	}
+	return false
+}
+
+// latinFolds covers letters that don't decompose into a base letter and a mark
+var latinFolds = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE", "ø", "o", "Ø", "O",
+	"ł", "l", "Ł", "L", "đ", "d", "Đ", "D", "þ", "th", "Þ", "Th", "ı", "i",
+	"‘", "'", "’", "'", "“", "'", "”", "'", "–", "-", "—", "-", "…", "...",
+)
+
+// transliterate folds accented Latin letters and typographic punctuation to
+// ASCII when FILENAME_TRANSLITERATE is on. Other scripts are left as they are,
+// marks included, so Greek tonos or Japanese dakuten survive.
+func transliterate(name string) string {
+	if !config.GetBool("FILENAME_TRANSLITERATE", false) {
+		return name
+	}
+	var b strings.Builder
+	for _, r := range norm.NFC.String(latinFolds.Replace(name)) {
+		if !unicode.Is(unicode.Latin, r) {
+			b.WriteRune(r)
+			continue
+		}
+		for _, d := range norm.NFD.String(string(r)) {
+			if !unicode.Is(unicode.Mn, d) {
+				b.WriteRune(d)
+			}
+		}
+	}
+	return b.String()
+}
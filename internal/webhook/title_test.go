@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		title, filename, want string
+	}{
+		{"A Study of Sparrows", "paper.pdf", "A Study of Sparrows"},
+		{"  A   Study\nof Sparrows ", "paper.pdf", "A Study of Sparrows"},
+		{"Microsoft Word - Quarterly Report", "q3.pdf", "Quarterly Report"},
+		{"Microsoft PowerPoint - Roadmap", "deck.pdf", "Roadmap"},
+		{"", "paper.pdf", ""},
+		{"   ", "paper.pdf", ""},
+		{"Untitled", "paper.pdf", ""},
+		{"untitled document", "paper.pdf", ""},
+		{"Document1", "paper.pdf", ""},
+		{"Slide 3", "paper.pdf", ""},
+		{"Microsoft Word", "paper.pdf", ""},
+		{"report_final.docx", "paper.pdf", ""},
+		{"thesis.TEX", "paper.pdf", ""},
+		{"Paper", "paper.pdf", ""},
+		{"Documentation", "paper.pdf", "Documentation"},
+		{"Notes on v1.2", "paper.pdf", "Notes on v1.2"},
+	}
+	for _, tt := range tests {
+		if got := cleanTitle(tt.title, tt.filename); got != tt.want {
+			t.Errorf("cleanTitle(%q, %q) = %q, want %q", tt.title, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestURLDerivedName(t *testing.T) {
+	tests := []struct {
+		name, url string
+		want      bool
+	}{
+		{"paper.pdf", "https://example.com/files/paper.pdf", true},
+		{"paper.pdf", "https://example.com/files/paper", true},
+		{"paper.pdf", "https://example.com/files/paper.pdf?download=1", true},
+		{"Annual Report.pdf", "https://example.com/download?id=42", false},
+		{"Annual Report.pdf", "https://example.com/files/ar2024.pdf", false},
+		{"document.pdf", "https://example.com/", true},
+		{"document.pdf", "https://example.com", true},
+		{"document.pdf", "://bad url", true},
+	}
+	for _, tt := range tests {
+		if got := urlDerivedName(tt.name, tt.url); got != tt.want {
+			t.Errorf("urlDerivedName(%q, %q) = %v, want %v", tt.name, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := map[string]string{
+		"Café Crème":            "Cafe Creme",
+		"Cafe\u0301 decomposed": "Cafe decomposed",
+		"Straße":                "Strasse",
+		"Œuvres complètes":      "OEuvres completes",
+		"Łódź – notes":          "Lodz - notes",
+		"“Quoted” it’s…":        "'Quoted' it's...",
+		"Søren Kierkegaard":     "Soren Kierkegaard",
+		"デジタル版":                 "デジタル版",
+		"日本語のタイトル":              "日本語のタイトル",
+		"Ελληνικά":              "Ελληνικά",
+		"plain ascii-name_01":   "plain ascii-name_01",
+	}
+
+	t.Setenv("FILENAME_TRANSLITERATE", "false")
+	if got := transliterate("Café"); got != "Café" {
+		t.Errorf("transliterate with FILENAME_TRANSLITERATE off = %q, want it unchanged", got)
+	}
+
+	t.Setenv("FILENAME_TRANSLITERATE", "true")
+	for in, want := range tests {
+		if got := transliterate(in); got != want {
+			t.Errorf("transliterate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEPUBTitle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, body := range map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>The Birds of Aviary</dc:title></metadata>
+</package>`,
+	} {
+		zw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw.Write([]byte(body))
+	}
+	w.Close()
+	f.Close()
+
+	if got := documentTitle(path); got != "The Birds of Aviary" {
+		t.Errorf("documentTitle = %q, want The Birds of Aviary", got)
+	}
+	if got := epubTitle(filepath.Join(t.TempDir(), "missing.epub")); got != "" {
+		t.Errorf("epubTitle of a missing file = %q", got)
+	}
+}
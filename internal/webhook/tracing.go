@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"github.com/rmitchellscott/aviary/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceJob starts the span covering job id's run, joining the trace of the
+// request that submitted it, and a child span for each stage the job
+// reports as its operation (downloading, converting, compressing,
+// uploading...). The returned function ends them, failing the job's span
+// and the stage it stopped in with err.
+func traceJob(id, name, traceparent string) func(err error) {
+	ctx := tracing.WithTraceParent(jobContext(id), traceparent)
+	ctx, span := tracing.Start(ctx, name, attribute.String("aviary.job_id", id))
+
+	var stage trace.Span
+	updates, unsubscribe := jobStore.Subscribe(id)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var operation string
+		for job := range updates {
+			if job.Operation == operation {
+				continue
+			}
+			if stage != nil {
+				stage.End()
+			}
+			operation, stage = job.Operation, nil
+			if operation != "" {
+				_, stage = tracing.Start(ctx, operation)
+			}
+		}
+	}()
+
+	return func(err error) {
+		unsubscribe()
+		<-done
+		if stage != nil {
+			tracing.End(stage, err)
+		}
+		tracing.End(span, err)
+	}
+}
@@ -1,7 +1,9 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -13,43 +15,52 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/rmitchellscott/aviary/internal/apierror"
 	"github.com/rmitchellscott/aviary/internal/auth"
 	"github.com/rmitchellscott/aviary/internal/database"
 	"github.com/rmitchellscott/aviary/internal/logging"
 	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/tracing"
 )
 
 func UploadHandler(c *gin.Context) {
-	maxUploadSize := getMaxUploadSize()
-	
-	contentLength := c.Request.ContentLength
-	if contentLength > maxUploadSize {
-		logging.Logf("[UPLOAD] File too large: %d bytes (limit: %d bytes)", contentLength, maxUploadSize)
-		c.String(http.StatusBadRequest, "backend.errors.file_too_large")
+	if rejectDuringMaintenance(c) {
+		return
+	}
+
+	var userID uuid.UUID
+	var user *database.User
+	if database.IsMultiUserMode() {
+		u, ok := auth.RequireUser(c)
+		if !ok {
+			return
+		}
+		user = u
+		userID = user.ID
+	}
+
+	maxUploadSize := MaxUploadSizeFor(user)
+	if rejectTooLarge(c, c.Request.ContentLength, maxUploadSize) {
 		return
 	}
 
 	mediaType, params, err := parseContentType(c.Request.Header.Get("Content-Type"))
 	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
-		c.String(http.StatusBadRequest, "backend.errors.parse_form")
+		apierror.Respond(c, http.StatusBadRequest, "parse_form", "")
 		return
 	}
 	
 	boundary := params["boundary"]
 	if boundary == "" {
-		c.String(http.StatusBadRequest, "backend.errors.parse_form")
+		apierror.Respond(c, http.StatusBadRequest, "parse_form", "")
 		return
 	}
 	
 	multipartReader := multipart.NewReader(c.Request.Body, boundary)
 
-	var userID uuid.UUID
-	if database.IsMultiUserMode() {
-		user, ok := auth.RequireUser(c)
-		if !ok {
-			return
-		}
-		userID = user.ID
+	// Turn the upload away before reading it if the server is overloaded
+	if rejectUnderLoad(c, userID) {
+		return
 	}
 
 	// 3) Process multipart stream to extract files and form values
@@ -62,7 +73,7 @@ func UploadHandler(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			c.String(http.StatusBadRequest, "backend.errors.parse_form")
+			apierror.Respond(c, http.StatusBadRequest, "parse_form", "")
 			return
 		}
 		
@@ -71,10 +82,19 @@ func UploadHandler(c *gin.Context) {
 		
 		if filename != "" {
 			if fieldName == "file" || fieldName == "files" {
-				filePath, err := processFilePart(part, filename, userID)
+				if rejectBlockedContent(c, user, fileKind(filename)) {
+					secureCleanupPaths(savedPaths)
+					return
+				}
+				filePath, err := processFilePart(part, filename, userID, maxUploadSize)
+				if errors.Is(err, errFileTooLarge) {
+					secureCleanupPaths(append(savedPaths, filePath))
+					respondTooLarge(c, maxUploadSize)
+					return
+				}
 				if err != nil {
 					logging.Logf("[UPLOAD] Failed to process file %s: %v", filename, err)
-					c.String(http.StatusInternalServerError, "backend.errors.upload_stream_failed")
+					apierror.Respond(c, http.StatusInternalServerError, "upload_stream_failed", "")
 					return
 				}
 				savedPaths = append(savedPaths, filePath)
@@ -83,7 +103,7 @@ func UploadHandler(c *gin.Context) {
 		} else {
 			value, err := io.ReadAll(part)
 			if err != nil {
-				c.String(http.StatusBadRequest, "backend.errors.parse_form")
+				apierror.Respond(c, http.StatusBadRequest, "parse_form", "")
 				return
 			}
 			formValues[fieldName] = string(value)
@@ -93,51 +113,84 @@ func UploadHandler(c *gin.Context) {
 	}
 	
 	if len(savedPaths) == 0 {
-		c.String(http.StatusBadRequest, "backend.errors.get_file")
+		apierror.Respond(c, http.StatusBadRequest, "get_file", "")
+		return
+	}
+
+	// Admins can deliver the upload to another user's tablet
+	target := user
+	if database.IsMultiUserMode() {
+		t, err := resolveTargetUser(user, requestedTarget(c, formValues["user_id"]))
+		if err != nil {
+			secureCleanupPaths(savedPaths)
+			status, errType := onBehalfError(err)
+			apierror.Respond(c, status, errType, err.Error())
+			return
+		}
+		target = t
+	}
+	userID = targetID(target, userID)
+	if rejectInvalidLabels(c, formValues["labels"]) {
+		secureCleanupPaths(savedPaths)
 		return
 	}
 
-	compressVal := formValues["compress"]
-	manageVal := formValues["manage"]
-	archiveVal := formValues["archive"]
-	rmDirVal := formValues["rm_dir"]
-	prefixVal := formValues["prefix"]
-	removeBackgroundVal := formValues["remove_background"]
 	var jobId string
 	if len(savedPaths) == 1 {
-		form := map[string]string{
-			"Body":              savedPaths[0],
-			"prefix":            prefixVal,
-			"compress":          compressVal,
-			"manage":            manageVal,
-			"archive":           archiveVal,
-			"rm_dir":            rmDirVal,
-			"remove_background": removeBackgroundVal,
-			"source":            "ui",
-		}
-		jobId = enqueueJobForUser(form, userID)
+		jobId = enqueueJobForUser(uploadForm(c.Request.Context(), uploadBody(savedPaths[0]), formValues), userID)
 	} else {
 		pathsJSON, err := json.Marshal(savedPaths)
 		if err != nil {
-			c.String(http.StatusInternalServerError, "backend.errors.internal_error")
+			apierror.Respond(c, http.StatusInternalServerError, "internal_error", "")
 			return
 		}
-		form := map[string]string{
-			"Body":              fmt.Sprintf("files:%s", string(pathsJSON)),
-			"prefix":            prefixVal,
-			"compress":          compressVal,
-			"manage":            manageVal,
-			"archive":           archiveVal,
-			"rm_dir":            rmDirVal,
-			"remove_background": removeBackgroundVal,
-			"source":            "ui",
-		}
-		jobId = enqueueJobForUser(form, userID)
+		jobId = enqueueJobForUser(uploadForm(c.Request.Context(), fmt.Sprintf("files:%s", string(pathsJSON)), formValues), userID)
 	}
+	auditOnBehalf(c, user, target, jobId)
 	c.JSON(http.StatusAccepted, gin.H{"jobId": jobId})
 }
 
-func getMaxUploadSize() int64 {
+// uploadBody returns the Body of the job for a single uploaded file: the
+// URLs it lists, one per line, when it's a .txt or .csv list of them, which
+// then run as a batch, and otherwise the file's path
+func uploadBody(path string) string {
+	urls := urlListFile(path)
+	if urls == nil {
+		return path
+	}
+	secureCleanupPaths([]string{path})
+	logging.Logf("[UPLOAD] Read %d URL(s) from %s", len(urls), filepath.Base(path))
+	return strings.Join(urls, "\n")
+}
+
+// uploadForm builds the job form for uploaded files in body from the
+// options sent with them and the ID and trace of the request in ctx that
+// sent them
+func uploadForm(ctx context.Context, body string, formValues map[string]string) map[string]string {
+	return map[string]string{
+		"Body":              body,
+		"prefix":            formValues["prefix"],
+		"compress":          formValues["compress"],
+		"compress_preset":   formValues["compress_preset"],
+		"manage":            formValues["manage"],
+		"archive":           formValues["archive"],
+		"archive_pdfa":      formValues["archive_pdfa"],
+		"rm_dir":            formValues["rm_dir"],
+		"remove_background": formValues["remove_background"],
+		"upload_timeout":    formValues["upload_timeout"],
+		"job_timeout":       formValues["job_timeout"],
+		"verify_sync":       formValues["verify_sync"],
+		"skip_duplicates":   formValues["skip_duplicates"],
+		"receipt":           formValues["receipt"],
+		"labels":            formValues["labels"],
+		"source":            "ui",
+		"request_id":        logging.RequestID(ctx),
+		"traceparent":       tracing.TraceParent(ctx),
+	}
+}
+
+// MaxUploadSize is the largest file accepted, from MAX_UPLOAD_SIZE in bytes
+func MaxUploadSize() int64 {
 	if sizeStr := os.Getenv("MAX_UPLOAD_SIZE"); sizeStr != "" {
 		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
 			return size
@@ -167,7 +220,9 @@ func parseContentType(contentType string) (mediaType string, params map[string]s
 	return mediaType, params, nil
 }
 
-func processFilePart(part *multipart.Part, filename string, userID uuid.UUID) (string, error) {
+// processFilePart saves an uploaded file, returning errFileTooLarge along
+// with its path if it's larger than limit
+func processFilePart(part *multipart.Part, filename string, userID uuid.UUID, limit int64) (string, error) {
 	uploadDir, err := manager.CreateUserTempDir(userID)
 	if err != nil {
 		return "", fmt.Errorf("could not create upload directory: %w", err)
@@ -180,10 +235,13 @@ func processFilePart(part *multipart.Part, filename string, userID uuid.UUID) (s
 	}
 	defer dstFile.Close()
 	
-	_, err = io.Copy(dstFile, part)
+	n, err := io.Copy(dstFile, io.LimitReader(part, limit+1))
 	if err != nil {
 		return "", fmt.Errorf("could not save file: %w", err)
 	}
+	if n > limit {
+		return dstPath, errFileTooLarge
+	}
 	
 	return dstPath, nil
 }
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/apierror"
+	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/logging"
+)
+
+// errFileTooLarge is returned when an uploaded file turns out larger than
+// the limit while it's being read
+var errFileTooLarge = errors.New("file too large")
+
+// MaxUploadSizeFor is the largest file user may upload. A user's
+// max_upload_mb overrides the max_upload_mb system setting, which overrides
+// MAX_UPLOAD_SIZE; zero leaves the choice to the next one.
+func MaxUploadSizeFor(user *database.User) int64 {
+	if user != nil && user.MaxUploadMB > 0 {
+		return int64(user.MaxUploadMB) << 20
+	}
+	if database.IsMultiUserMode() {
+		if value, err := database.GetSystemSetting("max_upload_mb"); err == nil {
+			if mb, err := strconv.Atoi(value); err == nil && mb > 0 {
+				return int64(mb) << 20
+			}
+		}
+	}
+	return MaxUploadSize()
+}
+
+// rejectTooLarge responds with a file_too_large error carrying the limit, so
+// the UI can tell the user what it is, and returns true when size is over
+// limit
+func rejectTooLarge(c *gin.Context, size, limit int64) bool {
+	if size <= limit {
+		return false
+	}
+	logging.Logf("[UPLOAD] File too large: %d bytes (limit: %d bytes)", size, limit)
+	respondTooLarge(c, limit)
+	return true
+}
+
+func respondTooLarge(c *gin.Context, limit int64) {
+	apierror.Respond(c, http.StatusBadRequest, "file_too_large", "", gin.H{
+		"max_upload_bytes": limit,
+		"max_upload_mb":    limit >> 20,
+	})
+}
+
+// base64DecodedSize is roughly how large base64 content is once decoded
+func base64DecodedSize(content string) int64 {
+	return int64(base64.StdEncoding.DecodedLen(len(content)))
+}
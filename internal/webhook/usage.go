@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rmitchellscott/aviary/internal/procstats"
+)
+
+var (
+	usageMu   sync.Mutex
+	jobUsages = make(map[string]*procstats.Usage)
+)
+
+// jobUsage returns the collector for the child processes run for job id
+func jobUsage(id string) *procstats.Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u := jobUsages[id]
+	if u == nil {
+		u = &procstats.Usage{}
+		jobUsages[id] = u
+	}
+	return u
+}
+
+// endJobUsage stops collecting for job id and returns what its child
+// processes used, or nil if none ran
+func endJobUsage(id string) *procstats.Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u := jobUsages[id]
+	delete(jobUsages, id)
+	return u
+}
+
+// withUsage adds the CPU time and peak memory in u to a finished job's data
+func withUsage(data map[string]string, u *procstats.Usage) map[string]string {
+	total := u.Total()
+	if total.Runs == 0 {
+		return data
+	}
+	if data == nil {
+		data = make(map[string]string)
+	}
+	data["cpu_ms"] = strconv.FormatInt(total.CPUMillis, 10)
+	data["max_rss_bytes"] = strconv.FormatInt(total.MaxRSSBytes, 10)
+	return data
+}
+
+// usageSummary describes u for the job log, e.g.
+// "gs: 2 runs, 1.4s CPU, 182.3 MB peak; rmapi: 1 run, 0.2s CPU, 24.0 MB peak"
+func usageSummary(u *procstats.Usage) string {
+	tools := u.Tools()
+	parts := make([]string, 0, len(tools))
+	for _, name := range u.Names() {
+		t := tools[name]
+		runs := "runs"
+		if t.Runs == 1 {
+			runs = "run"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d %s, %.1fs CPU, %s peak",
+			name, t.Runs, runs, float64(t.CPUMillis)/1000, formatBytes(t.MaxRSSBytes)))
+	}
+	return strings.Join(parts, "; ")
+}
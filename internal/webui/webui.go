@@ -0,0 +1,115 @@
+// Package webui serves the frontend, either the build embedded in the binary
+// or one in UI_DIR on disk, so a custom build can be used without
+// recompiling.
+package webui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rmitchellscott/aviary/internal/auth"
+	"github.com/rmitchellscott/aviary/internal/config"
+)
+
+// Source picks the frontend to serve: UI_DIR when it's set, otherwise the
+// embedded build. It returns where the UI comes from for the startup log, or
+// a nil FS if the binary was built without the UI and UI_DIR isn't set.
+func Source(embedded fs.FS) (fs.FS, string, error) {
+	if dir := config.Get("UI_DIR", ""); dir != "" {
+		uiFS := os.DirFS(dir)
+		if _, err := fs.Stat(uiFS, "index.html"); err != nil {
+			return nil, "", fmt.Errorf("UI_DIR %s has no index.html: %w", dir, err)
+		}
+		return uiFS, dir, nil
+	}
+	if embedded == nil {
+		return nil, "", nil
+	}
+	return embedded, "embedded", nil
+}
+
+// hashedAsset matches the files Vite names after a hash of their content,
+// e.g. assets/index-B7x2kQ9d.js, which never change under the same name
+var hashedAsset = regexp.MustCompile(`^assets/.+[-.][A-Za-z0-9_-]{8,}\.[A-Za-z0-9]+$`)
+
+// Handler serves files from uiFS, falling back to index.html so the UI's
+// own routes work on reload. Unknown assets are 404s.
+//
+// Hashed assets are cached for a year as immutable. Everything else,
+// index.html included, is sent with "no-cache" and an ETag, so browsers
+// revalidate and get a 304 while the file is unchanged. Embedded files have
+// no modification time, so their ETag is a hash of their content.
+func Handler(uiFS fs.FS) gin.HandlerFunc {
+	var etags sync.Map
+	etag := func(p string, stat fs.FileInfo) string {
+		if !stat.ModTime().IsZero() {
+			return fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size())
+		}
+		if tag, ok := etags.Load(p); ok {
+			return tag.(string)
+		}
+		data, err := fs.ReadFile(uiFS, p)
+		if err != nil {
+			return ""
+		}
+		sum := sha256.Sum256(data)
+		tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		etags.Store(p, tag)
+		return tag
+	}
+
+	return func(c *gin.Context) {
+		p := strings.TrimPrefix(c.Request.URL.Path, "/")
+		if p == "" {
+			p = "index.html"
+		}
+
+		stat, err := fs.Stat(uiFS, p)
+		if err != nil || stat.IsDir() {
+			if strings.HasPrefix(p, "assets/") {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			p = "index.html"
+			if stat, err = fs.Stat(uiFS, p); err != nil {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+		}
+
+		if p == "index.html" {
+			envUsername := config.Get("AUTH_USERNAME", "")
+			envPassword := config.Get("AUTH_PASSWORD", "")
+			webAuthDisabled := envUsername == "" || envPassword == ""
+
+			if webAuthDisabled {
+				// The page carries the UI secret, so it's never stored
+				c.Header("Cache-Control", "no-store")
+				auth.ServeIndexWithSecret(c, uiFS, auth.GetUISecret())
+				return
+			}
+		}
+
+		if strings.HasSuffix(p, ".js") {
+			c.Header("Content-Type", "application/javascript")
+		}
+		if hashedAsset.MatchString(p) {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			c.Header("Cache-Control", "no-cache")
+		}
+		// ServeFileFS answers If-None-Match with a 304 when the ETag matches
+		if tag := etag(p, stat); tag != "" {
+			c.Header("ETag", tag)
+		}
+		http.ServeFileFS(c.Writer, c.Request, uiFS, p)
+	}
+}
@@ -0,0 +1,56 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandlerCaching(t *testing.T) {
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD", "secret")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.NoRoute(Handler(fstest.MapFS{
+		"index.html":               {Data: []byte("<html></html>")},
+		"assets/index-B7x2kQ9d.js": {Data: []byte("console.log(1)")},
+		"favicon.svg":              {Data: []byte("<svg/>")},
+	}))
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	asset := get("/assets/index-B7x2kQ9d.js", "")
+	if got := asset.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("hashed asset Cache-Control = %q", got)
+	}
+	for _, path := range []string{"/", "/settings", "/favicon.svg"} {
+		w := get(path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, w.Code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("%s: Cache-Control = %q, want no-cache", path, got)
+		}
+		tag := w.Header().Get("ETag")
+		if tag == "" {
+			t.Fatalf("%s: no ETag", path)
+		}
+		if w := get(path, tag); w.Code != http.StatusNotModified {
+			t.Errorf("%s: status %d with matching ETag, want 304", path, w.Code)
+		}
+	}
+	if w := get("/assets/missing.js", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing asset: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/rmitchellscott/aviary/internal/i18n"
+)
+
+//go:embed locales/*.json
+var embeddedLocales embed.FS
+
+// loadLocales loads the UI's locale files, built into the binary, for the
+// server's own messages
+func loadLocales() error {
+	localesFS, err := fs.Sub(embeddedLocales, "locales")
+	if err != nil {
+		return err
+	}
+	return i18n.Load(localesFS)
+}
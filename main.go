@@ -3,13 +3,14 @@ package main
 import (
 	// standard library
 	"context"
-	"embed"
+	"errors"
 	"fmt"
-	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	// third-party
@@ -18,31 +19,70 @@ import (
 	"github.com/joho/godotenv"
 
 	// internal
+	"github.com/rmitchellscott/aviary/internal/apierror"
 	"github.com/rmitchellscott/aviary/internal/auth"
 	"github.com/rmitchellscott/aviary/internal/backup"
 	"github.com/rmitchellscott/aviary/internal/config"
 	"github.com/rmitchellscott/aviary/internal/database"
+	"github.com/rmitchellscott/aviary/internal/degraded"
+	"github.com/rmitchellscott/aviary/internal/demo"
 	"github.com/rmitchellscott/aviary/internal/downloader"
 	"github.com/rmitchellscott/aviary/internal/downloads"
 	"github.com/rmitchellscott/aviary/internal/handlers"
+	"github.com/rmitchellscott/aviary/internal/health"
+	"github.com/rmitchellscott/aviary/internal/httpcompress"
+	"github.com/rmitchellscott/aviary/internal/ingest"
 	"github.com/rmitchellscott/aviary/internal/logging"
+	"github.com/rmitchellscott/aviary/internal/maintenance"
 	"github.com/rmitchellscott/aviary/internal/manager"
+	"github.com/rmitchellscott/aviary/internal/mirror"
+	"github.com/rmitchellscott/aviary/internal/reconcile"
+	"github.com/rmitchellscott/aviary/internal/remoteimport"
 	"github.com/rmitchellscott/aviary/internal/restore"
 	"github.com/rmitchellscott/aviary/internal/rmapi"
 	"github.com/rmitchellscott/aviary/internal/storage"
+	"github.com/rmitchellscott/aviary/internal/subscription"
+	"github.com/rmitchellscott/aviary/internal/telemetry"
+	"github.com/rmitchellscott/aviary/internal/tracing"
 	"github.com/rmitchellscott/aviary/internal/version"
 	"github.com/rmitchellscott/aviary/internal/webhook"
+	"github.com/rmitchellscott/aviary/internal/webui"
 )
 
-//go:generate npm --prefix ui install
-//go:generate npm --prefix ui run build
-//go:embed ui/dist
-//go:embed ui/dist/assets
-var embeddedUI embed.FS
-
 func main() {
 	_ = godotenv.Load()
+	// Cancelled on SIGINT or SIGTERM, which stops background work and starts
+	// the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Fatal startup errors go to LOG_FILE too
+	log.SetOutput(logging.Writer())
 	logging.Logf("[STARTUP] Starting %s", version.String())
+	demo.Apply()
+	if config.LowResource() {
+		logging.Logf("[STARTUP] Low resource mode: jobs run one at a time with conservative conversion settings")
+		if limit := config.ApplyLowResourceLimits(); limit > 0 {
+			logging.Logf("[STARTUP] Memory limit set to %d MB", limit>>20)
+		}
+	}
+
+	if err := loadLocales(); err != nil {
+		log.Fatalf("Failed to load locales: %v", err)
+	}
+
+	stopTracing, err := tracing.Init(ctx)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	if tracing.Enabled() {
+		logging.Logf("[STARTUP] Exporting traces over OTLP")
+	}
+	// Flush the spans of jobs that finished during shutdown
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopTracing(flushCtx)
+	}()
 
 	// Initialize storage backend early
 	if err := storage.InitializeStorage(); err != nil {
@@ -50,7 +90,7 @@ func main() {
 	}
 
 	if config.GetBool("EXPERIMENTAL_DOWNLOAD_LINK", false) {
-		downloads.CleanupAll(context.Background())
+		downloads.CleanupAll(ctx)
 		downloads.StartCleanup(5 * time.Minute)
 		logging.Logf("[STARTUP] Experimental download link feature enabled (TTL: %v)",
 			config.GetDuration("DOWNLOAD_LINK_TTL", 1*time.Hour))
@@ -78,12 +118,32 @@ func main() {
 		if err := database.MigrateToMultiUser(); err != nil {
 			log.Fatalf("Failed to migrate to multi-user mode: %v", err)
 		}
+		auth.ApplyStoredStorage()
+
+		if demo.Enabled() {
+			if err := demo.Seed(database.DB); err != nil {
+				logging.Logf("[WARNING] Failed to seed demo data: %v", err)
+			}
+		}
 
 		if err := auth.CleanupOrphanedRestoreUploads(); err != nil {
 			logging.Logf("[WARNING] Failed to cleanup orphaned restore uploads during startup: %v", err)
 		}
 
+		if _, err := restore.CleanupExpiredUploads(database.DB); err != nil {
+			logging.Logf("[WARNING] Failed to cleanup expired restore uploads during startup: %v", err)
+		}
+		if _, err := backup.CleanupExpiredBackups(database.DB); err != nil {
+			logging.Logf("[WARNING] Failed to cleanup expired backups during startup: %v", err)
+		}
+
 		manager.InitializeUserFolderCache(database.DB)
+		backup.StartScheduler(ctx, database.DB)
+		backup.StartRetention(ctx, database.DB)
+		mirror.Start(ctx)
+		reconcile.Start(ctx)
+		reconcile.StartVerify(ctx)
+		subscription.Start(ctx)
 
 		// Check if continuous worker mode is enabled
 		if config.Get("WORKERS_ALWAYS_ON", "") == "true" {
@@ -143,16 +203,101 @@ func main() {
 		}
 	})
 
+	// Warm folder caches for restored users so the UI isn't empty after a restore
+	auth.SetPostRestoreCallback(func(userIDs []uuid.UUID) {
+		queued := manager.QueueFolderCacheRefresh(userIDs)
+		logging.Logf("[RESTORE] Queued folder cache refresh for %d users", queued)
+	})
+
+	// Let admin bulk actions queue folder refreshes
+	auth.SetFolderRefreshCallback(manager.QueueFolderCacheRefresh)
+
 	// Set up cache cleanup hook for user deletion
 	database.SetUserCacheCleanupHook(func(userID uuid.UUID) {
 		cachePath := rmapi.GetUserCachePath(userID)
 		rmapi.CleanupUserCache(cachePath)
 	})
 
-	uiFS, err := fs.Sub(embeddedUI, "ui/dist")
+	// Optional queue-based ingestion alongside the HTTP webhook
+	natsConsumer, err := ingest.NewNATSConsumerFromEnv()
 	if err != nil {
-		log.Fatalf("embed error: %v", err)
+		log.Fatalf("Failed to configure NATS ingestion: %v", err)
 	}
+	if natsConsumer != nil {
+		natsConsumer.Start(ctx)
+	}
+	watchFolder, err := ingest.NewWatchFolderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure watch folder: %v", err)
+	}
+	if watchFolder != nil {
+		watchFolder.Start(ctx)
+	}
+	sftpServer, err := ingest.NewSFTPServerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SFTP server: %v", err)
+	}
+	if sftpServer != nil {
+		if err := sftpServer.Start(ctx); err != nil {
+			log.Fatalf("Failed to start SFTP server: %v", err)
+		}
+	}
+	mailPoller, err := ingest.NewMailPollerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure email ingestion: %v", err)
+	}
+	if mailPoller != nil {
+		mailPoller.Start(ctx)
+	}
+	ippServer, err := ingest.NewIPPServerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure IPP printer: %v", err)
+	}
+	if ippServer != nil {
+		if err := ippServer.Start(ctx); err != nil {
+			log.Fatalf("Failed to start IPP printer: %v", err)
+		}
+	}
+
+	// Queue jobs instead of failing them while storage or the reMarkable cloud is down
+	degraded.Register("storage", func(ctx context.Context) error {
+		key := ".aviary-healthcheck"
+		if err := storage.GetStorageBackend().Put(ctx, key, strings.NewReader(time.Now().UTC().Format(time.RFC3339))); err != nil {
+			return err
+		}
+		return storage.GetStorageBackend().Delete(ctx, key)
+	})
+	degraded.Register("rmapi", func(ctx context.Context) error {
+		target := config.Get("DEGRADED_RMAPI_CHECK_URL", "")
+		if target == "" {
+			target = "https://internal.cloud.remarkable.com"
+			if host := config.Get("RMAPI_HOST", ""); host != "" {
+				target = host
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("%s returned %s", target, resp.Status)
+		}
+		return nil
+	})
+	degraded.OnRecover(webhook.ResumeQueuedJobs)
+	degraded.Start(ctx)
+	// Pick up jobs that were still queued when Aviary last stopped
+	go webhook.ResumeQueuedJobs()
+	webhook.StartDeliveryWindows(ctx)
+	webhook.StartFailedJobCleanup(ctx)
+	webhook.StartArchiveRetry(ctx)
+	version.StartUpdateCheck(ctx)
+	telemetry.Start(ctx)
 
 	if mode := config.Get("GIN_MODE", ""); mode != "" {
 		gin.SetMode(mode)
@@ -161,7 +306,12 @@ func main() {
 	}
 
 	router := gin.New()
-	router.Use(gin.Logger(), gin.Recovery())
+	router.Use(tracing.Middleware(), logging.Middleware(), gin.Recovery(), httpcompress.Middleware(), apierror.Middleware(), demo.Middleware())
+
+	// Liveness and readiness probes, outside /api so they need no auth
+	router.GET("/healthz", logging.Quiet(), apierror.Raw(), health.LivenessHandler)
+	router.GET("/readyz", logging.Quiet(), apierror.Raw(), health.ReadinessHandler)
+	router.GET("/api/status/public", logging.Quiet(), apierror.Raw(), health.PublicStatusHandler) // GET /api/status/public - health, version and registration for anyone
 
 	router.POST("/api/auth/login", auth.MultiUserLoginHandler)
 	router.POST("/api/auth/logout", auth.LogoutHandler)
@@ -173,6 +323,7 @@ func main() {
 		router.GET("/api/auth/oidc/callback", auth.OIDCCallbackHandler)
 		router.POST("/api/auth/oidc/logout", auth.OIDCLogoutHandler)
 		router.GET("/api/auth/proxy/check", auth.ProxyAuthCheckHandler)
+		router.GET("/api/auth/cloud-drive/callback", auth.CloudDriveCallbackHandler)
 	}
 
 	router.POST("/api/auth/register", auth.MultiUserAuthMiddleware(), auth.RegisterHandler)
@@ -180,6 +331,25 @@ func main() {
 	router.POST("/api/auth/password-reset", auth.PasswordResetHandler)
 	router.POST("/api/auth/password-reset/confirm", auth.PasswordResetConfirmHandler)
 
+	// First-run setup wizard for multi-user installs, locked once completed
+	router.GET("/api/setup", auth.OptionalAuthMiddleware(), auth.GetSetupStatusHandler) // GET /api/setup - whether setup is needed and which steps are done
+	router.POST("/api/setup/admin", auth.SetupAdminHandler)                              // POST /api/setup/admin - create the first admin and sign in
+	setup := router.Group("/api/setup")
+	setup.Use(auth.MultiUserAuthMiddleware())
+	{
+		setup.PUT("/smtp", auth.SetupSMTPHandler)            // PUT /api/setup/smtp - save and test SMTP settings
+		setup.POST("/rmapi/test", auth.SetupRmapiTestHandler) // POST /api/setup/rmapi/test - check the admin's reMarkable pairing
+		setup.PUT("/storage", auth.SetupStorageHandler)      // PUT /api/setup/storage - check and switch the storage backend
+		setup.POST("/complete", auth.SetupCompleteHandler)   // POST /api/setup/complete - finish and lock setup
+	}
+
+	// Signed, expiring status links created via POST /api/status/:id/share
+	router.GET("/api/public/status/:id", webhook.PublicStatusHandler)
+	router.GET("/api/public/status/ws/:id", webhook.PublicStatusWSHandler)
+
+	// Inbound mail from a mail provider, authenticated with INBOUND_EMAIL_SECRET
+	router.POST("/api/inbound-email", ingest.InboundEmailHandler) // POST /api/inbound-email - upload attachments mailed to a personal address
+
 	protected := router.Group("/api")
 	if auth.AuthRequired() || database.IsMultiUserMode() {
 		protected.Use(auth.MultiUserAuthMiddleware())
@@ -188,25 +358,50 @@ func main() {
 	users := protected.Group("/users")
 	{
 		users.GET("", auth.GetUsersHandler)                               // GET /api/users - list all users (admin)
+		users.POST("", auth.CreateUserHandler)                            // POST /api/users - create user with initial settings (admin)
 		users.GET("/:id", auth.GetUserHandler)                            // GET /api/users/:id - get user (admin)
 		users.PUT("/:id", auth.UpdateUserHandler)                         // PUT /api/users/:id - update user (admin)
 		users.POST("/:id/password", auth.AdminUpdatePasswordHandler)      // POST /api/users/:id/password - update password (admin)
 		users.POST("/:id/reset-password", auth.AdminResetPasswordHandler) // POST /api/users/:id/reset-password - reset password (admin)
 		users.POST("/:id/deactivate", auth.DeactivateUserHandler)         // POST /api/users/:id/deactivate - deactivate user (admin)
 		users.POST("/:id/activate", auth.ActivateUserHandler)             // POST /api/users/:id/activate - activate user (admin)
+		users.POST("/:id/logout-all", auth.LogoutAllSessionsHandler)      // POST /api/users/:id/logout-all - sign user out everywhere (admin)
 		users.POST("/:id/promote", auth.PromoteUserHandler)               // POST /api/users/:id/promote - promote user to admin (admin)
 		users.POST("/:id/demote", auth.DemoteUserHandler)                 // POST /api/users/:id/demote - demote admin to user (admin)
 		users.DELETE("/:id", auth.DeleteUserHandler)                      // DELETE /api/users/:id - delete user (admin)
 		users.GET("/stats", auth.GetUserStatsHandler)                     // GET /api/users/stats - get user statistics (admin)
+		users.POST("/bulk", auth.BulkUsersHandler)                        // POST /api/users/bulk - apply an action to several users (admin)
 	}
 
 	profile := protected.Group("/profile")
 	{
 		profile.PUT("", auth.UpdateCurrentUserHandler)         // PUT /api/profile - update current user
 		profile.POST("/password", auth.UpdatePasswordHandler)  // POST /api/profile/password - update password
+		profile.POST("/password/local", auth.SetLocalPasswordHandler) // POST /api/profile/password/local - set password on an OIDC-only account
+		profile.GET("/links", auth.GetAccountLinksHandler)             // GET /api/profile/links - list linked sign-in methods
+		profile.POST("/oidc/link", auth.OIDCLinkHandler)               // POST /api/profile/oidc/link - start linking an OIDC account
+		profile.DELETE("/oidc", auth.UnlinkOIDCHandler)                // DELETE /api/profile/oidc - unlink the OIDC account
+		profile.GET("/cloud-drives", auth.GetCloudDrivesHandler) // GET /api/profile/cloud-drives - list cloud drive connections
+		profile.GET("/cloud-drives/:provider/connect", auth.ConnectCloudDriveHandler) // GET /api/profile/cloud-drives/:provider/connect - connect a cloud drive account
+		profile.DELETE("/cloud-drives/:provider", auth.DisconnectCloudDriveHandler) // DELETE /api/profile/cloud-drives/:provider - disconnect a cloud drive account
+		profile.GET("/delivery", auth.GetDeliveryHandler) // GET /api/profile/delivery - get USB/SSH delivery settings
+		profile.PUT("/delivery", auth.UpdateDeliveryHandler) // PUT /api/profile/delivery - update USB/SSH delivery settings
+		profile.POST("/delivery/test", auth.TestDeliveryHandler) // POST /api/profile/delivery/test - test the connection to the tablet
+		profile.GET("/send-targets", auth.GetSendTargetsHandler) // GET /api/profile/send-targets - list "also send to" targets
+		profile.POST("/send-targets", auth.CreateSendTargetHandler) // POST /api/profile/send-targets - add an "also send to" target
+		profile.PUT("/send-targets/:id", auth.UpdateSendTargetHandler) // PUT /api/profile/send-targets/:id - update a target
+		profile.DELETE("/send-targets/:id", auth.DeleteSendTargetHandler) // DELETE /api/profile/send-targets/:id - remove a target
+		profile.POST("/send-targets/:id/test", auth.TestSendTargetHandler) // POST /api/profile/send-targets/:id/test - send a test document to a target
 		profile.POST("/pair", rmapi.PairHandler)               // POST /api/profile/pair - pair rmapi
 		profile.POST("/disconnect", rmapi.UnpairHandler)       // POST /api/profile/disconnect - remove rmapi config
+		profile.POST("/secrets/export", auth.ExportSecretsHandler) // POST /api/profile/secrets/export - download an encrypted bundle of the pairing and settings
+		profile.POST("/secrets/import", auth.ImportSecretsHandler) // POST /api/profile/secrets/import - restore a bundle exported on another instance
+		profile.GET("/inbound-email", ingest.GetInboundEmailHandler)        // GET /api/profile/inbound-email - get the personal inbound email address
+		profile.POST("/inbound-email", ingest.RotateInboundEmailHandler)    // POST /api/profile/inbound-email - create or rotate the personal address
+		profile.DELETE("/inbound-email", ingest.DisableInboundEmailHandler) // DELETE /api/profile/inbound-email - turn the personal address off
 		profile.GET("/stats", auth.GetCurrentUserStatsHandler) // GET /api/profile/stats - get current user stats
+		profile.POST("/onboarding/dismiss", auth.DismissOnboardingHandler) // POST /api/profile/onboarding/dismiss - hide the onboarding checklist
+		profile.POST("/onboarding/reset", auth.ResetOnboardingHandler)     // POST /api/profile/onboarding/reset - show the onboarding checklist again
 		profile.DELETE("", auth.DeleteCurrentUserHandler)      // DELETE /api/profile - delete current user account
 	}
 
@@ -236,6 +431,7 @@ func main() {
 		admin.GET("/status", auth.GetSystemStatusHandler)                                    // GET /api/admin/status - get system status
 		admin.GET("/settings", auth.GetSystemSettingsHandler)                                // GET /api/admin/settings - get system settings
 		admin.PUT("/settings", auth.UpdateSystemSettingHandler)                              // PUT /api/admin/settings - update system setting
+		admin.POST("/folders/refresh-all", manager.RefreshAllFoldersHandler)                 // POST /api/admin/folders/refresh-all - queue folder cache refresh for all users
 		admin.POST("/test-smtp", auth.TestSMTPHandler)                                       // POST /api/admin/test-smtp - test SMTP config
 		admin.POST("/cleanup", auth.CleanupDataHandler)                                      // POST /api/admin/cleanup - cleanup old data
 		admin.POST("/backup/analyze", auth.AnalyzeBackupHandler)                             // POST /api/admin/backup/analyze - analyze backup file
@@ -244,79 +440,139 @@ func main() {
 		admin.GET("/backup-job/:id", auth.GetBackupJobHandler)                               // GET /api/admin/backup-job/:id - get backup job
 		admin.GET("/backup-job/:id/download", auth.DownloadBackupHandler)                    // GET /api/admin/backup-job/:id/download - download backup
 		admin.DELETE("/backup-job/:id", auth.DeleteBackupJobHandler)                         // DELETE /api/admin/backup-job/:id - delete backup job
+		admin.GET("/backup-schedule", auth.GetBackupScheduleHandler)                         // GET /api/admin/backup-schedule - get the recurring backup schedule
+		admin.PUT("/backup-schedule", auth.UpdateBackupScheduleHandler)                      // PUT /api/admin/backup-schedule - update the recurring backup schedule
 		admin.POST("/restore/upload", auth.UploadRestoreFileHandler)                         // POST /api/admin/restore/upload - upload restore file
 		admin.GET("/restore/uploads", auth.GetRestoreUploadsHandler)                         // GET /api/admin/restore/uploads - get pending uploads
 		admin.POST("/restore/uploads/:id/analyze", auth.AnalyzeRestoreUploadHandler)         // POST /api/admin/restore/uploads/:id/analyze - analyze uploaded restore file
 		admin.GET("/restore/uploads/:id/extraction-status", auth.GetExtractionStatusHandler) // GET /api/admin/restore/uploads/:id/extraction-status - get extraction progress
 		admin.DELETE("/restore/uploads/:id", auth.DeleteRestoreUploadHandler)                // DELETE /api/admin/restore/uploads/:id - delete restore upload
 		admin.POST("/restore", auth.RestoreDatabaseHandler)                                  // POST /api/admin/restore - restore from backup
+		admin.GET("/queue", webhook.QueuedJobsHandler)                                       // GET /api/admin/queue - degraded mode status and queued jobs
+		admin.GET("/jobs", webhook.JobPoolHandler)                                           // GET /api/admin/jobs - job concurrency limits, running and waiting jobs
+		admin.POST("/broadcast", webhook.BroadcastHandler)                                   // POST /api/admin/broadcast - deliver one document to many users
+		admin.GET("/broadcast/:id", webhook.BroadcastStatusHandler)                          // GET /api/admin/broadcast/:id - combined progress of a broadcast
+		admin.GET("/reconcile", reconcile.ReportHandler)                                     // GET /api/admin/reconcile - last storage reconciliation report
+		admin.POST("/reconcile", reconcile.RunHandler)                                       // POST /api/admin/reconcile - compare storage with document records, optionally fixing
+		admin.GET("/storage", auth.GetStorageUsageHandler)                                   // GET /api/admin/storage - local storage usage, per user and against LOCAL_STORAGE_LIMIT_MB
+		admin.GET("/archive-verify", reconcile.VerifyReportHandler)                          // GET /api/admin/archive-verify - last archive checksum verification report
+		admin.POST("/archive-verify", reconcile.VerifyHandler)                               // POST /api/admin/archive-verify - check archived copies against their recorded hashes
+		admin.GET("/archive-failures", webhook.ArchiveFailuresHandler)                       // GET /api/admin/archive-failures - documents whose archive copy failed
+		admin.POST("/archive-failures/retry", webhook.RetryArchivesHandler)                  // POST /api/admin/archive-failures/retry - retry failed archive copies now
+		admin.POST("/remote-import/users", remoteimport.ListUsersHandler)                    // POST /api/admin/remote-import/users - list another instance's users
+		admin.POST("/remote-import", remoteimport.StartHandler)                              // POST /api/admin/remote-import - pull users from another instance
+		admin.GET("/remote-import", remoteimport.StatusHandler)                              // GET /api/admin/remote-import - progress of the current or last remote import
+		admin.GET("/telemetry", telemetry.PreviewHandler)                                    // GET /api/admin/telemetry - telemetry state and a preview of the next report
+		admin.PUT("/telemetry", telemetry.UpdateHandler)                                     // PUT /api/admin/telemetry - turn telemetry on or off
 	}
 
 	protected.POST("/webhook", webhook.EnqueueHandler)
 	protected.POST("/upload", webhook.UploadHandler)
+	protected.POST("/upload/chunk", webhook.StartChunkedUploadHandler)                 // POST /api/upload/chunk - start a resumable upload
+	protected.GET("/upload/chunk/:id", webhook.ChunkedUploadStatusHandler)             // GET /api/upload/chunk/:id - bytes received so far
+	protected.PUT("/upload/chunk/:id", webhook.UploadChunkHandler)                     // PUT /api/upload/chunk/:id - append a chunk at ?offset=
+	protected.POST("/upload/chunk/:id/complete", webhook.CompleteChunkedUploadHandler) // POST /api/upload/chunk/:id/complete - verify the file and start the job
+	protected.DELETE("/upload/chunk/:id", webhook.CancelChunkedUploadHandler)          // DELETE /api/upload/chunk/:id - abandon an upload
+	protected.POST("/html", webhook.HTMLHandler) // POST /api/html - render HTML posted by a browser and upload it
 	protected.GET("/status/:id", webhook.StatusHandler)
+	protected.GET("/status/ws", webhook.JobsWSHandler) // GET /api/status/ws - stream updates for all of the user's jobs
 	protected.GET("/status/ws/:id", webhook.StatusWSHandler)
+	protected.POST("/status/:id/share", webhook.ShareStatusHandler)
+	protected.POST("/status/:id/retry", webhook.RetryHandler)   // POST /api/status/:id/retry - retry a failed upload with its processed file
+	protected.POST("/status/:id/cancel", webhook.CancelHandler) // POST /api/status/:id/cancel - stop a waiting or running job
 	protected.GET("/sniff", downloader.SniffHandler)
 	protected.GET("/download/:token", downloads.DownloadHandler)
 	protected.GET("/folders", manager.FoldersHandler)
-	protected.GET("/version", func(c *gin.Context) {
-		c.JSON(http.StatusOK, version.Get())
-	})
+	protected.POST("/folders", manager.CreateFolderHandler)
+	protected.GET("/documents", auth.GetDocumentsHandler)          // GET /api/documents - page through upload history
+	protected.GET("/documents/:id", auth.GetDocumentHandler)       // GET /api/documents/:id - get one document
+	protected.DELETE("/documents/:id", auth.DeleteDocumentHandler) // DELETE /api/documents/:id - remove a document from history
+	protected.GET("/archive", auth.GetArchiveHandler)                          // GET /api/archive - browse archived documents by reMarkable folder
+	protected.GET("/archive/:id/download", auth.DownloadArchivedDocumentHandler) // GET /api/archive/:id/download - download a document's archived copy
+
+	// Documents on the reMarkable cloud
+	protected.GET("/rm/documents", manager.RemoteDocumentsHandler)         // GET /api/rm/documents - list a folder on the reMarkable cloud
+	protected.GET("/rm/documents/download", manager.RemoteDownloadHandler) // GET /api/rm/documents/download - download a document from the reMarkable cloud
+	protected.DELETE("/rm/documents", manager.DeleteRemoteHandler)         // DELETE /api/rm/documents - delete a document or empty folder
+	protected.POST("/rm/documents/move", manager.MoveRemoteHandler)        // POST /api/rm/documents/move - move or rename a document or folder
+
+	// Folder mirrors (multi-user mode)
+	protected.GET("/mirrors", mirror.ListHandler)           // GET /api/mirrors - list folder mirrors
+	protected.POST("/mirrors", mirror.CreateHandler)        // POST /api/mirrors - mirror a storage prefix to a reMarkable folder
+	protected.PUT("/mirrors/:id", mirror.UpdateHandler)     // PUT /api/mirrors/:id - update a mirror
+	protected.DELETE("/mirrors/:id", mirror.DeleteHandler)  // DELETE /api/mirrors/:id - remove a mirror
+	protected.POST("/mirrors/:id/sync", mirror.SyncHandler) // POST /api/mirrors/:id/sync - sync a mirror now
+
+	// Mailboxes polled for emailed documents (multi-user mode)
+	protected.GET("/mailboxes", ingest.ListMailboxesHandler)           // GET /api/mailboxes - list mailboxes
+	protected.POST("/mailboxes", ingest.CreateMailboxHandler)          // POST /api/mailboxes - ingest attachments from an IMAP mailbox
+	protected.PUT("/mailboxes/:id", ingest.UpdateMailboxHandler)       // PUT /api/mailboxes/:id - update a mailbox
+	protected.DELETE("/mailboxes/:id", ingest.DeleteMailboxHandler)    // DELETE /api/mailboxes/:id - remove a mailbox
+	protected.POST("/mailboxes/:id/check", ingest.CheckMailboxHandler) // POST /api/mailboxes/:id/check - check a mailbox now
+
+	// Subscriptions (multi-user mode)
+	protected.GET("/subscriptions", subscription.ListHandler)          // GET /api/subscriptions - list subscriptions
+	protected.POST("/subscriptions", subscription.CreateHandler)       // POST /api/subscriptions - fetch a URL on a schedule
+	protected.PUT("/subscriptions/:id", subscription.UpdateHandler)    // PUT /api/subscriptions/:id - update a subscription
+	protected.DELETE("/subscriptions/:id", subscription.DeleteHandler) // DELETE /api/subscriptions/:id - remove a subscription
+	protected.POST("/subscriptions/:id/run", subscription.RunHandler)  // POST /api/subscriptions/:id/run - fetch a subscription now
+
+	protected.GET("/rmapi/capabilities", rmapi.CapabilitiesHandler) // GET /api/rmapi/capabilities - options supported by the reMarkable cloud host
+	protected.GET("/version", handlers.VersionHandler) // GET /api/version - build info, plus the release check for admins
 	router.GET("/api/config", handlers.ConfigHandler)
 
-	if config.Get("DISABLE_UI", "") == "" {
-		router.NoRoute(func(c *gin.Context) {
-			p := strings.TrimPrefix(c.Request.URL.Path, "/")
-			if p == "" {
-				p = "index.html"
-			}
-
-			if p == "index.html" {
-				envUsername := config.Get("AUTH_USERNAME", "")
-				envPassword := config.Get("AUTH_PASSWORD", "")
-				webAuthDisabled := envUsername == "" || envPassword == ""
-
-				if webAuthDisabled {
-					auth.ServeIndexWithSecret(c, uiFS, auth.GetUISecret())
-					return
-				}
-			}
-
-			if stat, err := fs.Stat(uiFS, p); err != nil || stat.IsDir() {
-				if strings.HasPrefix(p, "assets/") {
-					c.AbortWithStatus(http.StatusNotFound)
-					return
-				}
-				p = "index.html"
-				if p == "index.html" {
-					envUsername := config.Get("AUTH_USERNAME", "")
-					envPassword := config.Get("AUTH_PASSWORD", "")
-					webAuthDisabled := envUsername == "" || envPassword == ""
-
-					if webAuthDisabled {
-						auth.ServeIndexWithSecret(c, uiFS, auth.GetUISecret())
-						return
-					}
-				}
-			}
-
-			if strings.HasSuffix(p, ".js") {
-				c.Header("Content-Type", "application/javascript")
-			}
-			if p == "index.html" {
-				c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-				c.Header("Pragma", "no-cache")
-				c.Header("Expires", "0")
-			}
-			http.ServeFileFS(c.Writer, c.Request, uiFS, p)
-		})
+	uiFS, uiSource, err := webui.Source(embeddedUIFS())
+	if err != nil {
+		log.Fatalf("UI error: %v", err)
+	}
+	if config.Get("DISABLE_UI", "") == "" && uiFS != nil {
+		if uiSource != "embedded" {
+			logging.Logf("[STARTUP] Serving the UI from %s", uiSource)
+		}
+		router.NoRoute(webui.Handler(uiFS))
 	} else {
-		logging.Logf("[STARTUP] DISABLE_UI is set → running in API-only mode (no UI).")
+		if uiFS == nil {
+			logging.Logf("[STARTUP] Built without the UI and UI_DIR is not set → running in API-only mode (no UI).")
+		} else {
+			logging.Logf("[STARTUP] DISABLE_UI is set → running in API-only mode (no UI).")
+		}
 		router.NoRoute(func(c *gin.Context) {
 			c.AbortWithStatus(http.StatusNotFound)
 		})
 	}
 
-	logging.Logf("[STARTUP] Listening on %s…", addr)
-	log.Fatal(http.ListenAndServe(addr, router))
+	srv := &http.Server{Addr: addr, Handler: router}
+	go func() {
+		logging.Logf("[STARTUP] Listening on %s…", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	// A second signal exits right away
+	stop()
+	shutdown(srv)
+}
+
+// shutdown stops taking new jobs, waits up to SHUTDOWN_TIMEOUT for running
+// ones to finish while status requests are still served, then waits for
+// in-flight requests such as uploads before the server closes. The database
+// is closed by main's deferred calls once this returns.
+func shutdown(srv *http.Server) {
+	timeout := config.GetDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	logging.Logf("[SHUTDOWN] Shutting down, waiting up to %v for %d running job(s)", timeout, maintenance.ActiveJobs())
+	maintenance.BeginShutdown()
+
+	deadline := time.Now().Add(timeout)
+	if !maintenance.WaitForJobs(timeout) {
+		logging.Logf("[WARNING] %d job(s) still running at shutdown will be interrupted", maintenance.ActiveJobs())
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(5*time.Second))
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logging.Logf("[WARNING] Requests still in flight at shutdown were interrupted: %v", err)
+	}
+	logging.Logf("[SHUTDOWN] Stopped")
 }
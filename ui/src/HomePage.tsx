@@ -2,6 +2,7 @@ import { useState, useEffect, useMemo, useRef } from "react";
 import { useAuth } from "@/components/AuthProvider";
 import { LoginForm } from "@/components/LoginForm";
 import { PairingDialog } from "@/components/PairingDialog";
+import { DocumentBrowser } from "@/components/DocumentBrowser";
 import { useUserData } from "@/hooks/useUserData";
 import { useConfig } from "@/components/ConfigProvider";
 import { useFolderRefresh } from "@/hooks/useFolderRefresh";
@@ -72,7 +73,7 @@ function waitForJobWS(
       try {
         const st = JSON.parse(ev.data);
         onUpdate(st);
-        if (st.status === "success" || st.status === "error") {
+        if (st.status === "success" || st.status === "error" || st.status === "cancelled") {
           setTimeout(() => {
             ws.close();
             safeResolve();
@@ -139,6 +140,7 @@ export default function HomePage() {
   const [progress, setProgress] = useState<number>(0);
   const [uploadProgress, setUploadProgress] = useState<number>(0);
   const [uploadPhase, setUploadPhase] = useState<'idle' | 'uploading' | 'processing'>('idle');
+  const [jobId, setJobId] = useState<string | null>(null);
   const [fileError, setFileError] = useState<string | null>(null);
   const DEFAULT_RM_DIR = "default";
   const [folders, setFolders] = useState<string[]>([]);
@@ -150,6 +152,11 @@ export default function HomePage() {
   const hasHandledShareUrl = useRef(false);
 
   const [pairingDialogOpen, setPairingDialogOpen] = useState(false);
+  const [browserOpen, setBrowserOpen] = useState(false);
+  const [newFolderOpen, setNewFolderOpen] = useState(false);
+  const [newFolderName, setNewFolderName] = useState("");
+  const [newFolderBusy, setNewFolderBusy] = useState(false);
+  const [newFolderError, setNewFolderError] = useState<string | null>(null);
 
   const isCompressibleFileOrUrl = useMemo(() => {
     if (selectedFiles.length > 0) {
@@ -378,6 +385,42 @@ export default function HomePage() {
     };
   }, [isAuthenticated, rmapiPaired, userDataLoading, refreshTrigger]);
 
+  // New folders are created inside the selected destination
+  const newFolderParent = rmDir === DEFAULT_RM_DIR ? "/" : `/${rmDir}`;
+
+  const createFolder = async () => {
+    setNewFolderBusy(true);
+    setNewFolderError(null);
+    try {
+      const headers: HeadersInit = {
+        "Content-Type": "application/json",
+        "Accept-Language": i18n.language,
+      };
+      if (uiSecret) {
+        headers["X-UI-Token"] = uiSecret;
+      }
+      const res = await fetch("/api/folders", {
+        method: "POST",
+        headers,
+        credentials: "include",
+        body: JSON.stringify({ parent: newFolderParent, name: newFolderName.trim() }),
+      });
+      const data = await res.json().catch(() => ({}));
+      if (!res.ok) {
+        setNewFolderError(data.error || t("home.create_folder_error"));
+        return;
+      }
+      const created = String(data.folder.path).replace(/^\//, "");
+      setFolders((prev) => (prev.includes(created) ? prev : [...prev, created]));
+      setRmDir(created);
+      setNewFolderOpen(false);
+    } catch {
+      setNewFolderError(t("home.create_folder_error"));
+    } finally {
+      setNewFolderBusy(false);
+    }
+  };
+
   const handlePairingSuccess = () => {
     updatePairingStatus(true);
     setFolders([]);
@@ -538,7 +581,17 @@ export default function HomePage() {
             reject(new Error('Invalid response format'));
           }
         } else {
-          reject(new Error(xhr.responseText || `HTTP ${xhr.status}`));
+          let message = xhr.responseText;
+          try {
+            const body = JSON.parse(xhr.responseText);
+            message = body.i18n_key || body.error || message;
+            if (body.code === 'file_too_large' && body.details?.max_upload_mb) {
+              message = t('backend.errors.file_too_large_limit', { max_mb: body.details.max_upload_mb });
+            }
+          } catch {
+            // Not a JSON error body
+          }
+          reject(new Error(message || `HTTP ${xhr.status}`));
         }
       });
       
@@ -630,6 +683,7 @@ export default function HomePage() {
 
         setStatus("running");
         setProgress(0);
+        setJobId(jobId);
         await waitForJobWS(jobId, handleStatusUpdate);
       } catch (err: unknown) {
         const msg = getErrorMessage(err);
@@ -642,6 +696,7 @@ export default function HomePage() {
         setProgress(0);
         setUploadProgress(0);
         setUploadPhase('idle');
+        setJobId(null);
         // Don't clear status data immediately - let it persist to show success message properly
         // setStatusData(null);
         setLoading(false);
@@ -674,12 +729,16 @@ export default function HomePage() {
         });
         if (!res.ok) {
           const errText = await res.text();
+          if (res.status === 503 && errText.includes('"maintenance_mode"')) {
+            throw new Error("backend.errors.maintenance_mode");
+          }
           throw new Error(errText);
         }
         const { jobId } = await res.json();
         setStatus("running");
         setMessage(t("home.job_queued", { id: jobId }));
         setProgress(0);
+        setJobId(jobId);
 
         await waitForJobWS(jobId, handleStatusUpdate);
       } catch (err: unknown) {
@@ -689,6 +748,7 @@ export default function HomePage() {
       } finally {
         setUrl("");
         setProgress(0);
+        setJobId(null);
         // Don't clear status data immediately - let it persist to show success message properly
         // setStatusData(null);
         setLoading(false);
@@ -696,6 +756,23 @@ export default function HomePage() {
     }
   };
 
+  const handleCancel = async () => {
+    if (!jobId) return;
+    const headers: HeadersInit = { "Accept-Language": i18n.language };
+    if (uiSecret) {
+      headers["X-UI-Token"] = uiSecret;
+    }
+    try {
+      await fetch(`/api/status/${jobId}/cancel`, {
+        method: "POST",
+        headers,
+        credentials: "include",
+      });
+    } catch {
+      // The job's status stream reports whether it stopped
+    }
+  };
+
   return (
     <div className="bg-background pt-0 pb-8 px-8">
       <Card className="max-w-md mx-auto bg-card">
@@ -807,7 +884,33 @@ export default function HomePage() {
           </div>
 
           <div className="space-y-2">
-            <Label htmlFor="rmDir">{t("home.destination_folder")}</Label>
+            <div className="flex items-center justify-between">
+              <Label htmlFor="rmDir">{t("home.destination_folder")}</Label>
+              {rmapiPaired && (
+                <div className="flex items-center gap-3">
+                  <Button
+                    type="button"
+                    variant="link"
+                    className="h-auto p-0 text-sm"
+                    onClick={() => {
+                      setNewFolderName("");
+                      setNewFolderError(null);
+                      setNewFolderOpen(true);
+                    }}
+                  >
+                    {t("home.new_folder")}
+                  </Button>
+                  <Button
+                    type="button"
+                    variant="link"
+                    className="h-auto p-0 text-sm"
+                    onClick={() => setBrowserOpen(true)}
+                  >
+                    {t("home.browse_documents")}
+                  </Button>
+                </div>
+              )}
+            </div>
             <Select 
               value={rmDir} 
               onValueChange={setRmDir}
@@ -909,7 +1012,7 @@ export default function HomePage() {
               {status === "success" && (
                 <CircleCheck className="size-4 flex-shrink-0 text-primary" />
               )}
-              {status === "error" && (
+              {(status === "error" || status === "cancelled") && (
                 <XCircle className="size-4 flex-shrink-0 text-destructive" />
               )}
 {(() => {
@@ -942,6 +1045,16 @@ export default function HomePage() {
                 // Default text rendering
                 return <span className="break-words whitespace-pre-line">{message}</span>;
               })()}
+              {jobId && uploadPhase !== 'uploading' && !["success", "error", "cancelled"].includes(status) && (
+                <Button
+                  variant="ghost"
+                  size="sm"
+                  onClick={handleCancel}
+                  className="ml-auto h-7 px-2"
+                >
+                  {t("home.cancel")}
+                </Button>
+              )}
             </div>
           )}
           {status === "success" && showDownloadLink && (() => {
@@ -1010,12 +1123,58 @@ export default function HomePage() {
         </DialogContent>
       </Dialog>
 
+      <Dialog open={newFolderOpen} onOpenChange={setNewFolderOpen}>
+        <DialogContent>
+          <DialogHeader>
+            <DialogTitle>{t("home.new_folder")}</DialogTitle>
+            <DialogDescription>
+              {t("home.new_folder_description", { parent: newFolderParent })}
+            </DialogDescription>
+          </DialogHeader>
+          <form
+            className="space-y-3"
+            onSubmit={(e) => {
+              e.preventDefault();
+              createFolder();
+            }}
+          >
+            <div className="space-y-1">
+              <Label htmlFor="new-folder-name">{t("home.new_folder_name")}</Label>
+              <Input
+                id="new-folder-name"
+                value={newFolderName}
+                onChange={(e) => setNewFolderName(e.target.value)}
+                autoFocus
+              />
+            </div>
+            {newFolderError && <p className="text-sm text-destructive">{newFolderError}</p>}
+            <div className="flex justify-end gap-2">
+              <DialogClose asChild>
+                <Button type="button" variant="outline" disabled={newFolderBusy}>
+                  {t("home.cancel")}
+                </Button>
+              </DialogClose>
+              <Button type="submit" disabled={newFolderBusy || !newFolderName.trim()}>
+                {newFolderBusy && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+                {t("home.create_folder")}
+              </Button>
+            </div>
+          </form>
+        </DialogContent>
+      </Dialog>
+
       <PairingDialog
         isOpen={pairingDialogOpen}
         onClose={() => setPairingDialogOpen(false)}
         onPairingSuccess={handlePairingSuccess}
         rmapiHost={rmapiHost}
       />
+
+      <DocumentBrowser
+        isOpen={browserOpen}
+        onClose={() => setBrowserOpen(false)}
+        initialPath={rmDir === DEFAULT_RM_DIR ? "/" : rmDir}
+      />
     </div>
   );
 }
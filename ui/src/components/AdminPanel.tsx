@@ -177,10 +177,23 @@ interface SystemStatus {
   settings: {
     registration_enabled: string;
     max_api_keys_per_user: string;
+    max_upload_mb?: string;
+    public_status_fields?: string;
+    blocked_content_types?: string;
     session_timeout_hours: string;
+    maintenance_mode: string;
+  };
+  maintenance: {
+    enabled: boolean;
+    reason: string;
+    active_jobs: number;
   };
   mode: string;
   dry_run: boolean;
+  low_resource?: {
+    enabled: boolean;
+    compress_workers: number;
+  };
 }
 
 interface AdminPanelProps {
@@ -215,8 +228,12 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
   const [newPassword, setNewPassword] = useState("");
 
   const [registrationEnabled, setRegistrationEnabled] = useState(false);
+  const [maintenanceMode, setMaintenanceMode] = useState(false);
   const [maxApiKeys, setMaxApiKeys] = useState("10");
   const [maxApiKeysError, setMaxApiKeysError] = useState<string | null>(null);
+  const [maxUploadMB, setMaxUploadMB] = useState("0");
+  const [publicStatusFields, setPublicStatusFields] = useState<string[]>([]);
+  const [blockedContentTypes, setBlockedContentTypes] = useState<string[]>([]);
 
   const [resetPasswordDialog, setResetPasswordDialog] = useState<{
     isOpen: boolean;
@@ -363,7 +380,19 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
         const status = await response.json();
         setSystemStatus(status);
         setRegistrationEnabled(status.settings.registration_enabled === "true");
+        setMaintenanceMode(status.settings.maintenance_mode === "true");
         setMaxApiKeys(status.settings.max_api_keys_per_user);
+        setMaxUploadMB(status.settings.max_upload_mb || "0");
+        setPublicStatusFields(
+          (status.settings.public_status_fields || "")
+            .split(",")
+            .filter((f: string) => f && f !== "none"),
+        );
+        setBlockedContentTypes(
+          (status.settings.blocked_content_types || "")
+            .split(",")
+            .filter((k: string) => k && k !== "none"),
+        );
       }
     } catch (error) {
       console.error("Failed to fetch system status:", error);
@@ -499,6 +528,29 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
     }
   };
 
+  const logoutAllSessions = async (user: User) => {
+    if (!window.confirm(t("admin.dialogs.logout_all_confirm", { username: user.username }))) {
+      return;
+    }
+    setError(null);
+    setSuccessMessage(null);
+    try {
+      const response = await fetch(`/api/users/${user.id}/logout-all`, {
+        method: "POST",
+        credentials: "include",
+      });
+
+      if (response.ok) {
+        setSuccessMessage(t("admin.success.logout_all", { username: user.username }));
+        await fetchUsers();
+      } else {
+        setError(t("admin.errors.logout_all"));
+      }
+    } catch (error) {
+      setError(t("admin.errors.logout_all"));
+    }
+  };
+
   const toggleAdminStatus = async (userId: string, makeAdmin: boolean) => {
     try {
       const endpoint = makeAdmin ? "promote" : "demote";
@@ -1326,7 +1378,15 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
                     {systemStatus.auth?.proxy_auth_enabled && (
                       <Badge variant="secondary">{t("admin.badges.proxy_auth")}</Badge>
                     )}
+                    {systemStatus.low_resource?.enabled && (
+                      <Badge variant="default">{t("admin.badges.low_resource")}</Badge>
+                    )}
                   </div>
+                  {systemStatus.low_resource?.enabled && (
+                    <p className="text-sm text-muted-foreground mt-3">
+                      {t("admin.descriptions.low_resource")}
+                    </p>
+                  )}
                 </CardContent>
               </Card>
             </div>
@@ -1535,6 +1595,14 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
                                         >
                                           {user.is_active ? t("admin.actions.deactivate") : t("admin.actions.activate")}
                                         </Button>
+                                        <Button
+                                          size="sm"
+                                          variant="outline"
+                                          onClick={() => logoutAllSessions(user)}
+                                          className="w-full justify-start"
+                                        >
+                                          {t("admin.actions.logout_all")}
+                                        </Button>
                                       </>
                                     )}
                                   </div>
@@ -1702,6 +1770,42 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
                 </CardContent>
               </Card>
 
+              <Card>
+                <CardHeader>
+                  <CardTitle>{t("admin.cards.maintenance")}</CardTitle>
+                </CardHeader>
+                <CardContent className="space-y-4">
+                  <div className="flex items-center justify-between">
+                    <div className="space-y-1">
+                      <Label htmlFor="maintenance-mode">
+                        {t("admin.labels.maintenance_mode")}
+                      </Label>
+                      <p className="text-sm text-muted-foreground">
+                        {t("admin.descriptions.maintenance_help")}
+                      </p>
+                      {systemStatus?.maintenance?.enabled && (
+                        <p className="text-sm text-muted-foreground">
+                          {t("admin.descriptions.maintenance_active_jobs", {
+                            count: systemStatus.maintenance.active_jobs,
+                          })}
+                        </p>
+                      )}
+                    </div>
+                    <Switch
+                      id="maintenance-mode"
+                      checked={maintenanceMode}
+                      onCheckedChange={(checked) => {
+                        setMaintenanceMode(checked);
+                        updateSystemSetting(
+                          "maintenance_mode",
+                          checked.toString(),
+                        );
+                      }}
+                    />
+                  </div>
+                </CardContent>
+              </Card>
+
               <Card>
                 <CardHeader>
                   <CardTitle>{t("admin.cards.api_key_settings")}</CardTitle>
@@ -1757,6 +1861,95 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
                 </CardContent>
               </Card>
 
+              <Card>
+                <CardHeader>
+                  <CardTitle>{t("admin.cards.upload_settings")}</CardTitle>
+                </CardHeader>
+                <CardContent className="space-y-4">
+                  <div>
+                    <Label htmlFor="max-upload-mb">
+                      {t("admin.labels.max_upload_mb")}
+                    </Label>
+                    <Input
+                      id="max-upload-mb"
+                      type="number"
+                      min="0"
+                      value={maxUploadMB}
+                      onChange={(e) => setMaxUploadMB(e.target.value)}
+                      onBlur={() => {
+                        const numValue = parseInt(maxUploadMB, 10);
+                        if (!isNaN(numValue) && numValue >= 0) {
+                          updateSystemSetting("max_upload_mb", String(numValue));
+                        }
+                      }}
+                      className="mt-2 max-w-[200px]"
+                    />
+                    <p className="text-sm text-muted-foreground mt-2">
+                      {t("admin.descriptions.max_upload_mb_help")}
+                    </p>
+                  </div>
+                  <div className="space-y-2">
+                    <Label>{t("admin.labels.blocked_content_types")}</Label>
+                    <p className="text-sm text-muted-foreground">
+                      {t("admin.descriptions.blocked_content_types_help")}
+                    </p>
+                    {["pdf", "epub", "image", "office", "markdown", "html", "webpage"].map((kind) => (
+                      <div key={kind} className="flex items-center justify-between">
+                        <Label htmlFor={`blocked-content-${kind}`}>
+                          {t(`admin.labels.content_type_${kind}`)}
+                        </Label>
+                        <Switch
+                          id={`blocked-content-${kind}`}
+                          checked={blockedContentTypes.includes(kind)}
+                          onCheckedChange={(checked) => {
+                            const kinds = checked
+                              ? [...blockedContentTypes, kind]
+                              : blockedContentTypes.filter((k) => k !== kind);
+                            setBlockedContentTypes(kinds);
+                            updateSystemSetting(
+                              "blocked_content_types",
+                              kinds.length > 0 ? kinds.join(",") : "none",
+                            );
+                          }}
+                        />
+                      </div>
+                    ))}
+                  </div>
+                </CardContent>
+              </Card>
+
+              <Card>
+                <CardHeader>
+                  <CardTitle>{t("admin.cards.public_status")}</CardTitle>
+                </CardHeader>
+                <CardContent className="space-y-4">
+                  <p className="text-sm text-muted-foreground">
+                    {t("admin.descriptions.public_status_help")}
+                  </p>
+                  {["health", "version", "registration"].map((field) => (
+                    <div key={field} className="flex items-center justify-between">
+                      <Label htmlFor={`public-status-${field}`}>
+                        {t(`admin.labels.public_status_${field}`)}
+                      </Label>
+                      <Switch
+                        id={`public-status-${field}`}
+                        checked={publicStatusFields.includes(field)}
+                        onCheckedChange={(checked) => {
+                          const fields = checked
+                            ? [...publicStatusFields, field]
+                            : publicStatusFields.filter((f) => f !== field);
+                          setPublicStatusFields(fields);
+                          updateSystemSetting(
+                            "public_status_fields",
+                            fields.length > 0 ? fields.join(",") : "none",
+                          );
+                        }}
+                      />
+                    </div>
+                  ))}
+                </CardContent>
+              </Card>
+
             </div>
           </TabsContent>
 
@@ -2146,6 +2339,16 @@ export function AdminPanel({ isOpen, onClose }: AdminPanelProps) {
                           >
                             {viewUser.is_active ? t("admin.actions.deactivate") : t("admin.actions.activate")}
                           </Button>
+                          <Button
+                            size="sm"
+                            variant="outline"
+                            onClick={() => {
+                              logoutAllSessions(viewUser);
+                            }}
+                            className="w-full justify-start"
+                          >
+                            {t("admin.actions.logout_all")}
+                          </Button>
                         </>
                       )}
                     </div>
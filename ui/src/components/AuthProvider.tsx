@@ -23,6 +23,7 @@ interface User {
   conversion_output_format?: string
   pdf_background_removal?: boolean
   experimental_download_link?: boolean
+  language?: string
   created_at: string
   last_login?: string
 }
@@ -0,0 +1,279 @@
+import { useState, useEffect, useCallback } from "react";
+import { useTranslation } from "react-i18next";
+import {
+  Dialog,
+  DialogContent,
+  DialogHeader,
+  DialogTitle,
+  DialogDescription,
+} from "@/components/ui/dialog";
+import { Button } from "@/components/ui/button";
+import { Badge } from "@/components/ui/badge";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import { Folder, FileText, ChevronRight, Loader2, Trash2, FolderInput, Download } from "lucide-react";
+
+interface RemoteEntry {
+  id?: string;
+  name: string;
+  path: string;
+  type: "folder" | "document";
+  modified?: string;
+  document_id?: string;
+  upload_date?: string;
+}
+
+interface DocumentBrowserProps {
+  isOpen: boolean;
+  onClose: () => void;
+  initialPath?: string;
+}
+
+/**
+ * View of the folders and documents on the reMarkable cloud, where they can
+ * be downloaded, moved, renamed or deleted.
+ */
+export function DocumentBrowser({ isOpen, onClose, initialPath = "/" }: DocumentBrowserProps) {
+  const { t } = useTranslation();
+  const [path, setPath] = useState(initialPath);
+  const [entries, setEntries] = useState<RemoteEntry[]>([]);
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+  const [deleting, setDeleting] = useState<RemoteEntry | null>(null);
+  const [moving, setMoving] = useState<RemoteEntry | null>(null);
+  const [destination, setDestination] = useState("");
+  const [newName, setNewName] = useState("");
+  const [busy, setBusy] = useState(false);
+  const [actionError, setActionError] = useState<string | null>(null);
+
+  const resetAction = () => {
+    setDeleting(null);
+    setMoving(null);
+    setActionError(null);
+  };
+
+  const load = useCallback(async (dir: string) => {
+    setLoading(true);
+    setError(null);
+    try {
+      const res = await fetch(`/api/rm/documents?path=${encodeURIComponent(dir)}`, {
+        credentials: "include",
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        setError(data.error || t("browser.load_error"));
+        setEntries([]);
+        return;
+      }
+      setPath(data.path);
+      setEntries(data.entries || []);
+    } catch {
+      setError(t("browser.load_error"));
+      setEntries([]);
+    } finally {
+      setLoading(false);
+    }
+  }, [t]);
+
+  useEffect(() => {
+    if (isOpen) {
+      resetAction();
+      load(initialPath);
+    }
+  }, [isOpen, initialPath, load]);
+
+  const startMove = (entry: RemoteEntry) => {
+    resetAction();
+    setMoving(entry);
+    setDestination(path);
+    setNewName(entry.name);
+  };
+
+  const startDelete = (entry: RemoteEntry) => {
+    resetAction();
+    setDeleting(entry);
+  };
+
+  const runAction = async (url: string, method: string, body: object) => {
+    setBusy(true);
+    setActionError(null);
+    try {
+      const res = await fetch(url, {
+        method,
+        headers: { "Content-Type": "application/json" },
+        credentials: "include",
+        body: JSON.stringify(body),
+      });
+      if (!res.ok) {
+        const data = await res.json().catch(() => ({}));
+        setActionError(data.error || t("browser.action_error"));
+        return;
+      }
+      resetAction();
+      load(path);
+    } catch {
+      setActionError(t("browser.action_error"));
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  const confirmDelete = () => {
+    if (!deleting) return;
+    runAction("/api/rm/documents", "DELETE", { path: deleting.path, confirm: deleting.name });
+  };
+
+  const confirmMove = () => {
+    if (!moving) return;
+    runAction("/api/rm/documents/move", "POST", {
+      path: moving.path,
+      destination: destination.trim() || "/",
+      name: newName.trim(),
+    });
+  };
+
+  const crumbs = path.split("/").filter(Boolean);
+
+  return (
+    <Dialog open={isOpen} onOpenChange={(open) => !open && onClose()}>
+      <DialogContent className="sm:max-w-2xl max-h-[80vh] overflow-y-auto">
+        <DialogHeader>
+          <DialogTitle>{t("browser.title")}</DialogTitle>
+          <DialogDescription>{t("browser.description")}</DialogDescription>
+        </DialogHeader>
+
+        <div className="flex flex-wrap items-center gap-1 text-sm">
+          <Button variant="link" className="h-auto p-0" onClick={() => load("/")} disabled={loading}>
+            {t("browser.root")}
+          </Button>
+          {crumbs.map((name, i) => (
+            <span key={i} className="flex items-center gap-1">
+              <ChevronRight className="h-3 w-3 text-muted-foreground" />
+              <Button
+                variant="link"
+                className="h-auto p-0"
+                onClick={() => load("/" + crumbs.slice(0, i + 1).join("/"))}
+                disabled={loading || i === crumbs.length - 1}
+              >
+                {name}
+              </Button>
+            </span>
+          ))}
+        </div>
+
+        {loading ? (
+          <div className="flex items-center gap-2 py-6 text-muted-foreground">
+            <Loader2 className="h-4 w-4 animate-spin" />
+            {t("browser.loading")}
+          </div>
+        ) : error ? (
+          <p className="py-6 text-sm text-destructive">{error}</p>
+        ) : entries.length === 0 ? (
+          <p className="py-6 text-sm text-muted-foreground">{t("browser.empty")}</p>
+        ) : (
+          <ul className="divide-y">
+            {entries.map((entry) => (
+              <li key={entry.id || entry.path} className="flex items-center gap-3 py-2">
+                {entry.type === "folder" ? (
+                  <button
+                    type="button"
+                    className="flex flex-1 items-center gap-2 text-left hover:underline"
+                    onClick={() => load(entry.path)}
+                  >
+                    <Folder className="h-4 w-4 shrink-0" />
+                    <span className="truncate">{entry.name}</span>
+                  </button>
+                ) : (
+                  <div className="flex flex-1 items-center gap-2 min-w-0">
+                    <FileText className="h-4 w-4 shrink-0 text-muted-foreground" />
+                    <span className="truncate">{entry.name}</span>
+                    {entry.document_id && (
+                      <Badge variant="secondary">{t("browser.uploaded_by_aviary")}</Badge>
+                    )}
+                  </div>
+                )}
+                {entry.modified && (
+                  <span className="text-xs text-muted-foreground whitespace-nowrap">
+                    {new Date(entry.modified).toLocaleDateString()}
+                  </span>
+                )}
+                {entry.type === "document" && (
+                  <Button variant="ghost" size="icon" className="h-8 w-8" title={t("browser.download")} asChild>
+                    <a href={`/api/rm/documents/download?path=${encodeURIComponent(entry.path)}`} download>
+                      <Download className="h-4 w-4" />
+                    </a>
+                  </Button>
+                )}
+                <Button
+                  variant="ghost"
+                  size="icon"
+                  className="h-8 w-8"
+                  title={t("browser.move")}
+                  onClick={() => startMove(entry)}
+                >
+                  <FolderInput className="h-4 w-4" />
+                </Button>
+                <Button
+                  variant="ghost"
+                  size="icon"
+                  className="h-8 w-8"
+                  title={t("browser.delete")}
+                  onClick={() => startDelete(entry)}
+                >
+                  <Trash2 className="h-4 w-4" />
+                </Button>
+              </li>
+            ))}
+          </ul>
+        )}
+
+        {deleting && (
+          <div className="space-y-3 rounded-md border p-3">
+            <p className="text-sm">
+              {t(deleting.type === "folder" ? "browser.delete_folder_confirm" : "browser.delete_confirm", { name: deleting.name })}
+            </p>
+            {actionError && <p className="text-sm text-destructive">{actionError}</p>}
+            <div className="flex justify-end gap-2">
+              <Button variant="outline" onClick={resetAction} disabled={busy}>
+                {t("browser.cancel")}
+              </Button>
+              <Button variant="destructive" onClick={confirmDelete} disabled={busy}>
+                {busy && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+                {t("browser.delete")}
+              </Button>
+            </div>
+          </div>
+        )}
+
+        {moving && (
+          <div className="space-y-3 rounded-md border p-3">
+            <p className="text-sm">{t("browser.move_title", { name: moving.name })}</p>
+            <div className="space-y-1">
+              <Label htmlFor="move-destination">{t("browser.destination")}</Label>
+              <Input
+                id="move-destination"
+                value={destination}
+                onChange={(e) => setDestination(e.target.value)}
+                placeholder="/"
+              />
+            </div>
+            <div className="space-y-1">
+              <Label htmlFor="move-name">{t("browser.name")}</Label>
+              <Input id="move-name" value={newName} onChange={(e) => setNewName(e.target.value)} />
+            </div>
+            {actionError && <p className="text-sm text-destructive">{actionError}</p>}
+            <div className="flex justify-end gap-2">
+              <Button variant="outline" onClick={resetAction} disabled={busy}>
+                {t("browser.cancel")}
+              </Button>
+              <Button onClick={confirmMove} disabled={busy || !newName.trim()}>
+                {busy && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+                {t("browser.move")}
+              </Button>
+            </div>
+          </div>
+        )}
+      </DialogContent>
+    </Dialog>
+  );
+}
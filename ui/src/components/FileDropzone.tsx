@@ -19,6 +19,11 @@ const ACCEPT_CONFIG = {
   'image/png': ['.png'],
   'text/markdown': ['.md', '.markdown'],
   'text/html': ['.html', '.htm'],
+  'application/vnd.openxmlformats-officedocument.wordprocessingml.document': ['.docx'],
+  'application/vnd.openxmlformats-officedocument.presentationml.presentation': ['.pptx'],
+  'application/vnd.oasis.opendocument.text': ['.odt'],
+  'text/plain': ['.txt'],
+  'text/csv': ['.csv'],
 }
 
 /**
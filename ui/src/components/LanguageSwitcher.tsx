@@ -4,6 +4,7 @@ import { useState, useRef, useEffect } from "react"
 import { useTranslation } from "react-i18next"
 import { Globe, Check } from "lucide-react"
 import i18n from "@/lib/i18n"
+import { useAuth } from "@/components/AuthProvider"
 
 import { Button } from "@/components/ui/button"
 import { Popover, PopoverTrigger, PopoverContent } from "@/components/ui/popover"
@@ -36,6 +37,7 @@ const getAvailableLanguages = () => {
 
 export default function LanguageSwitcher() {
   const { i18n, t } = useTranslation()
+  const { isAuthenticated, multiUserMode } = useAuth()
   const current = i18n.resolvedLanguage || i18n.language.split("-")[0]
   const [open, setOpen] = useState(false)
   const availableLanguages = getAvailableLanguages()
@@ -51,6 +53,15 @@ export default function LanguageSwitcher() {
   const handleLanguageChange = (langValue: string) => {
     i18n.changeLanguage(langValue)
     setOpen(false)
+    // Emails are sent in the language last chosen here
+    if (multiUserMode && isAuthenticated) {
+      fetch("/api/profile", {
+        method: "PUT",
+        headers: { "Content-Type": "application/json" },
+        credentials: "include",
+        body: JSON.stringify({ language: langValue }),
+      }).catch(() => {})
+    }
   }
 
   return (
@@ -29,6 +29,27 @@ export function LoginForm({ onLogin }: LoginFormProps) {
   const oidcButtonText = config?.oidcButtonText || "";
   const proxyAuthEnabled = config?.proxyAuthEnabled || false;
 
+  // Show errors from a failed OIDC callback, then drop the code from the URL
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.search);
+    const oidcError = params.get("oidc_error");
+    if (!oidcError) {
+      return;
+    }
+    const messageKeys: Record<string, string> = {
+      invalid_state: "session_expired",
+      missing_code: "session_expired",
+      provider_error: "provider_error",
+      user_not_found: "user_not_found",
+      account_disabled: "account_disabled",
+      no_username: "no_username",
+    };
+    setError(t(`login.oidc_errors.${messageKeys[oidcError] || "generic"}`));
+    params.delete("oidc_error");
+    const query = params.toString();
+    window.history.replaceState(null, "", window.location.pathname + (query ? `?${query}` : ""));
+  }, [t]);
+
   useEffect(() => {
     // Focus the username field when component mounts
     const usernameInput = document.getElementById("username");
@@ -116,6 +137,7 @@ export function LoginForm({ onLogin }: LoginFormProps) {
               >
                 {oidcButtonText || t("login.sso_button")}
               </Button>
+              {isSsoOnly && error && <p className="mt-4 text-sm text-destructive">{error}</p>}
               {/* Only show divider if not in SSO-only mode */}
               {!oidcSsoOnly && (
                 <div className="relative my-4">
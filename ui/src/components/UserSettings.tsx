@@ -185,6 +185,14 @@ export function UserSettings({ isOpen, onClose }: UserSettingsProps) {
   const [newPassword, setNewPassword] = useState("");
   const [confirmPassword, setConfirmPassword] = useState("");
 
+  const [accountLinks, setAccountLinks] = useState<{
+    has_local_password: boolean;
+    oidc_linked: boolean;
+    oidc_enabled: boolean;
+  } | null>(null);
+  const [localPassword, setLocalPassword] = useState("");
+  const [confirmLocalPassword, setConfirmLocalPassword] = useState("");
+
   const [deletePassword, setDeletePassword] = useState("");
   const [deleteConfirmation, setDeleteConfirmation] = useState("");
 
@@ -213,6 +221,7 @@ export function UserSettings({ isOpen, onClose }: UserSettingsProps) {
   useEffect(() => {
     if (isOpen) {
       fetchAPIKeys();
+      fetchAccountLinks();
       if (user) {
         const email = user.email;
         const userRmapiHost = user.rmapi_host || "";
@@ -326,6 +335,9 @@ export function UserSettings({ isOpen, onClose }: UserSettingsProps) {
       setCurrentPassword("");
       setNewPassword("");
       setConfirmPassword("");
+      setLocalPassword("");
+      setConfirmLocalPassword("");
+      setAccountLinks(null);
       setDeletePassword("");
       setDeleteConfirmation("");
       setNewKeyName("");
@@ -604,6 +616,102 @@ export function UserSettings({ isOpen, onClose }: UserSettingsProps) {
     }
   };
 
+  const fetchAccountLinks = async () => {
+    try {
+      const response = await fetch("/api/profile/links", {
+        credentials: "include",
+      });
+      if (response.ok) {
+        setAccountLinks(await response.json());
+      }
+    } catch (error) {
+      console.error("Failed to fetch account links:", error);
+    }
+  };
+
+  const setLocalAccountPassword = async () => {
+    if (localPassword !== confirmLocalPassword) {
+      setError(t("settings.errors.passwords_mismatch"));
+      return;
+    }
+
+    try {
+      setSaving(true);
+      setError(null);
+
+      const response = await fetch("/api/profile/password/local", {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        credentials: "include",
+        body: JSON.stringify({ new_password: localPassword }),
+      });
+
+      if (response.ok) {
+        setLocalPassword("");
+        setConfirmLocalPassword("");
+        await fetchAccountLinks();
+      } else {
+        const errorData = await response.json();
+        setError(errorData.error || t("settings.errors.set_password"));
+      }
+    } catch (error) {
+      setError(t("settings.errors.set_password"));
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  const linkOIDC = async () => {
+    try {
+      setSaving(true);
+      setError(null);
+
+      const response = await fetch("/api/profile/oidc/link", {
+        method: "POST",
+        credentials: "include",
+      });
+
+      if (response.ok) {
+        const data = await response.json();
+        window.location.href = data.redirect_url;
+        return;
+      }
+      setError(t("settings.errors.link_oidc"));
+    } catch (error) {
+      setError(t("settings.errors.link_oidc"));
+    }
+    setSaving(false);
+  };
+
+  const unlinkOIDC = async () => {
+    try {
+      setSaving(true);
+      setError(null);
+
+      const response = await fetch("/api/profile/oidc", {
+        method: "DELETE",
+        credentials: "include",
+      });
+
+      if (response.ok) {
+        await fetchAccountLinks();
+      } else {
+        const errorData = await response.json();
+        setError(
+          errorData.error_type === "local_password_required"
+            ? t("settings.messages.unlink_requires_password")
+            : t("settings.errors.unlink_oidc")
+        );
+      }
+    } catch (error) {
+      setError(t("settings.errors.unlink_oidc"));
+    } finally {
+      setSaving(false);
+    }
+  };
+
   const createAPIKey = async () => {
     try {
       setSaving(true);
@@ -1205,6 +1313,52 @@ export function UserSettings({ isOpen, onClose }: UserSettingsProps) {
 
             <TabsContent value="account">
               <div className="grid grid-cols-1 lg:grid-cols-2 gap-6">
+                {accountLinks && !accountLinks.has_local_password ? (
+                <Card>
+                  <CardHeader>
+                    <CardTitle>{t("settings.cards.set_password")}</CardTitle>
+                  </CardHeader>
+                  <CardContent className="space-y-4">
+                    <p className="text-sm text-muted-foreground">
+                      {t("settings.messages.set_password_help")}
+                    </p>
+
+                    <div>
+                      <Label htmlFor="local-password">{t("settings.labels.new_password")}</Label>
+                      <Input
+                        id="local-password"
+                        type="password"
+                        value={localPassword}
+                        onChange={(e) => setLocalPassword(e.target.value)}
+                        placeholder={t('settings.placeholders.new_password')}
+                        className="mt-2"
+                      />
+                    </div>
+
+                    <div>
+                      <Label htmlFor="confirm-local-password">{t("settings.labels.confirm_new_password")}</Label>
+                      <Input
+                        id="confirm-local-password"
+                        type="password"
+                        value={confirmLocalPassword}
+                        onChange={(e) => setConfirmLocalPassword(e.target.value)}
+                        placeholder={t('settings.placeholders.new_password')}
+                        className="mt-2"
+                      />
+                    </div>
+
+                    <div className="flex flex-col sm:flex-row sm:justify-end">
+                      <Button
+                        onClick={setLocalAccountPassword}
+                        className="w-full sm:w-auto"
+                        disabled={saving || !localPassword || !confirmLocalPassword}
+                      >
+                        {saving ? t('settings.loading_states.updating') : t('settings.buttons.set_password')}
+                      </Button>
+                    </div>
+                  </CardContent>
+                </Card>
+                ) : (
                 <Card>
                   <CardHeader>
                     <CardTitle>{t("settings.cards.change_password")}</CardTitle>
@@ -1262,6 +1416,47 @@ export function UserSettings({ isOpen, onClose }: UserSettingsProps) {
                     </div>
                   </CardContent>
                 </Card>
+                )}
+
+                {accountLinks?.oidc_enabled && (
+                  <Card>
+                    <CardHeader>
+                      <CardTitle>{t("settings.cards.single_sign_on")}</CardTitle>
+                    </CardHeader>
+                    <CardContent className="space-y-4">
+                      <p className="text-sm text-muted-foreground">
+                        {accountLinks.oidc_linked
+                          ? t("settings.messages.oidc_linked")
+                          : t("settings.messages.oidc_not_linked")}
+                      </p>
+                      <div className="flex flex-col sm:flex-row sm:justify-end">
+                        {accountLinks.oidc_linked ? (
+                          <Button
+                            variant="outline"
+                            onClick={unlinkOIDC}
+                            className="w-full sm:w-auto"
+                            disabled={saving || !accountLinks.has_local_password}
+                          >
+                            {t('settings.buttons.unlink_oidc')}
+                          </Button>
+                        ) : (
+                          <Button
+                            onClick={linkOIDC}
+                            className="w-full sm:w-auto"
+                            disabled={saving}
+                          >
+                            {t('settings.buttons.link_oidc')}
+                          </Button>
+                        )}
+                      </div>
+                      {accountLinks.oidc_linked && !accountLinks.has_local_password && (
+                        <p className="text-sm text-muted-foreground">
+                          {t("settings.messages.unlink_requires_password")}
+                        </p>
+                      )}
+                    </CardContent>
+                  </Card>
+                )}
 
                 <Card>
                   <CardHeader>
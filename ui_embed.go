@@ -0,0 +1,24 @@
+//go:build !noui
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+)
+
+//go:generate npm --prefix ui install
+//go:generate npm --prefix ui run build
+//go:embed ui/dist
+//go:embed ui/dist/assets
+var embeddedUI embed.FS
+
+// embeddedUIFS returns the UI built into the binary
+func embeddedUIFS() fs.FS {
+	uiFS, err := fs.Sub(embeddedUI, "ui/dist")
+	if err != nil {
+		log.Fatalf("embed error: %v", err)
+	}
+	return uiFS
+}
@@ -0,0 +1,11 @@
+//go:build noui
+
+package main
+
+import "io/fs"
+
+// embeddedUIFS returns nil in binaries built with the noui tag, which leave
+// the UI out. UI_DIR can still serve one.
+func embeddedUIFS() fs.FS {
+	return nil
+}